@@ -69,6 +69,8 @@ type getKubeconfigOIDCParams struct {
 	upstreamIDPName   string
 	upstreamIDPType   string
 	upstreamIDPFlow   string
+
+	bindToClientCertificate bool
 }
 
 type getKubeconfigConciergeParams struct {
@@ -138,8 +140,9 @@ func kubeconfigCommand(deps kubeconfigDeps) *cobra.Command {
 	f.BoolVar(&flags.oidc.debugSessionCache, "oidc-debug-session-cache", false, "Print debug logs related to the OpenID Connect session cache")
 	f.StringVar(&flags.oidc.requestAudience, "oidc-request-audience", "", "Request a token with an alternate audience using RFC8693 token exchange")
 	f.StringVar(&flags.oidc.upstreamIDPName, "upstream-identity-provider-name", "", "The name of the upstream identity provider used during login with a Supervisor")
-	f.StringVar(&flags.oidc.upstreamIDPType, "upstream-identity-provider-type", "", fmt.Sprintf("The type of the upstream identity provider used during login with a Supervisor (e.g. '%s', '%s', '%s')", idpdiscoveryv1alpha1.IDPTypeOIDC, idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory))
+	f.StringVar(&flags.oidc.upstreamIDPType, "upstream-identity-provider-type", "", fmt.Sprintf("The type of the upstream identity provider used during login with a Supervisor (e.g. '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%s')", idpdiscoveryv1alpha1.IDPTypeOIDC, idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory, idpdiscoveryv1alpha1.IDPTypeGitHub, idpdiscoveryv1alpha1.IDPTypeSAML, idpdiscoveryv1alpha1.IDPTypeOAuth2, idpdiscoveryv1alpha1.IDPTypeWebhook, idpdiscoveryv1alpha1.IDPTypeLocal))
 	f.StringVar(&flags.oidc.upstreamIDPFlow, "upstream-identity-provider-flow", "", fmt.Sprintf("The type of client flow to use with the upstream identity provider during login with a Supervisor (e.g. '%s', '%s')", idpdiscoveryv1alpha1.IDPFlowCLIPassword, idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode))
+	f.BoolVar(&flags.oidc.bindToClientCertificate, "oidc-bind-to-client-certificate", false, "During OpenID Connect login, present a client certificate to the Supervisor so it can bind the tokens to it")
 	f.StringVar(&flags.kubeconfigPath, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to kubeconfig file")
 	f.StringVar(&flags.kubeconfigContextOverride, "kubeconfig-context", "", "Kubeconfig context name (default: current active context)")
 	f.BoolVar(&flags.skipValidate, "skip-validation", false, "Skip final validation of the kubeconfig (default: false)")
@@ -338,6 +341,9 @@ func newExecConfig(deps kubeconfigDeps, flags getKubeconfigParams) (*clientcmdap
 	if flags.oidc.upstreamIDPFlow != "" {
 		execConfig.Args = append(execConfig.Args, "--upstream-identity-provider-flow="+flags.oidc.upstreamIDPFlow)
 	}
+	if flags.oidc.bindToClientCertificate {
+		execConfig.Args = append(execConfig.Args, "--bind-to-client-certificate")
+	}
 
 	return execConfig, nil
 }
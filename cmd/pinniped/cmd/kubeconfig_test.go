@@ -137,6 +137,7 @@ func TestGetKubeconfig(t *testing.T) {
 				      --kubeconfig string                        Path to kubeconfig file
 				      --kubeconfig-context string                Kubeconfig context name (default: current active context)
 				      --no-concierge                             Generate a configuration which does not use the Concierge, but sends the credential to the cluster directly
+				      --oidc-bind-to-client-certificate          During OpenID Connect login, present a client certificate to the Supervisor so it can bind the tokens to it
 				      --oidc-ca-bundle path                      Path to TLS certificate authority bundle (PEM format, optional, can be repeated)
 				      --oidc-client-id string                    OpenID Connect client ID (default: autodiscover) (default "pinniped-cli")
 				      --oidc-issuer string                       OpenID Connect issuer URL (default: autodiscover)
@@ -152,7 +153,7 @@ func TestGetKubeconfig(t *testing.T) {
 				      --timeout duration                         Timeout for autodiscovery and validation (default 10m0s)
 				      --upstream-identity-provider-flow string   The type of client flow to use with the upstream identity provider during login with a Supervisor (e.g. 'cli_password', 'browser_authcode')
 				      --upstream-identity-provider-name string   The name of the upstream identity provider used during login with a Supervisor
-				      --upstream-identity-provider-type string   The type of the upstream identity provider used during login with a Supervisor (e.g. 'oidc', 'ldap', 'activedirectory')
+				      --upstream-identity-provider-type string   The type of the upstream identity provider used during login with a Supervisor (e.g. 'oidc', 'ldap', 'activedirectory', 'github', 'saml', 'oauth2', 'webhook', 'local')
 			`)
 			},
 		},
@@ -1492,6 +1493,7 @@ func TestGetKubeconfig(t *testing.T) {
 					"--oidc-session-cache", "/path/to/cache/dir/sessions.yaml",
 					"--oidc-debug-session-cache",
 					"--oidc-request-audience", "test-audience",
+					"--oidc-bind-to-client-certificate",
 					"--skip-validation",
 					"--generated-name-suffix", "-sso",
 					"--credential-cache", "/path/to/cache/dir/credentials.yaml",
@@ -1546,6 +1548,7 @@ func TestGetKubeconfig(t *testing.T) {
 						  - --session-cache=/path/to/cache/dir/sessions.yaml
 						  - --debug-session-cache
 						  - --request-audience=test-audience
+						  - --bind-to-client-certificate
 						  command: '.../path/to/pinniped'
 						  env: []
 						  installHint: The pinniped CLI does not appear to be installed.  See https://get.pinniped.dev/cli
@@ -1,12 +1,15 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package cmd
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -76,6 +79,8 @@ type oidcLoginFlags struct {
 	upstreamIdentityProviderName string
 	upstreamIdentityProviderType string
 	upstreamIdentityProviderFlow string
+	bindToClientCertificate      bool
+	workloadIdentityTokenFile    string
 }
 
 func oidcLoginCommand(deps oidcLoginCommandDeps) *cobra.Command {
@@ -109,8 +114,10 @@ func oidcLoginCommand(deps oidcLoginCommandDeps) *cobra.Command {
 	cmd.Flags().StringVar(&flags.conciergeAPIGroupSuffix, "concierge-api-group-suffix", groupsuffix.PinnipedDefaultSuffix, "Concierge API group suffix")
 	cmd.Flags().StringVar(&flags.credentialCachePath, "credential-cache", filepath.Join(mustGetConfigDir(), "credentials.yaml"), "Path to cluster-specific credentials cache (\"\" disables the cache)")
 	cmd.Flags().StringVar(&flags.upstreamIdentityProviderName, "upstream-identity-provider-name", "", "The name of the upstream identity provider used during login with a Supervisor")
-	cmd.Flags().StringVar(&flags.upstreamIdentityProviderType, "upstream-identity-provider-type", idpdiscoveryv1alpha1.IDPTypeOIDC.String(), fmt.Sprintf("The type of the upstream identity provider used during login with a Supervisor (e.g. '%s', '%s', '%s')", idpdiscoveryv1alpha1.IDPTypeOIDC, idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory))
+	cmd.Flags().StringVar(&flags.upstreamIdentityProviderType, "upstream-identity-provider-type", idpdiscoveryv1alpha1.IDPTypeOIDC.String(), fmt.Sprintf("The type of the upstream identity provider used during login with a Supervisor (e.g. '%s', '%s', '%s', '%s', '%s', '%s', '%s', '%s')", idpdiscoveryv1alpha1.IDPTypeOIDC, idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory, idpdiscoveryv1alpha1.IDPTypeGitHub, idpdiscoveryv1alpha1.IDPTypeSAML, idpdiscoveryv1alpha1.IDPTypeOAuth2, idpdiscoveryv1alpha1.IDPTypeWebhook, idpdiscoveryv1alpha1.IDPTypeLocal))
 	cmd.Flags().StringVar(&flags.upstreamIdentityProviderFlow, "upstream-identity-provider-flow", "", fmt.Sprintf("The type of client flow to use with the upstream identity provider during login with a Supervisor (e.g. '%s', '%s')", idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode, idpdiscoveryv1alpha1.IDPFlowCLIPassword))
+	cmd.Flags().BoolVar(&flags.bindToClientCertificate, "bind-to-client-certificate", false, "Present a client certificate, which is stored next to the session cache, to the Supervisor so it can bind the tokens to it")
+	cmd.Flags().StringVar(&flags.workloadIdentityTokenFile, "workload-identity-token-file", "", "Path to a JWT issued to this workload, which is exchanged for a cluster-scoped token without an interactive login (requires --request-audience)")
 
 	// --skip-listen is mainly needed for testing. We'll leave it hidden until we have a non-testing use case.
 	mustMarkHidden(cmd, "skip-listen")
@@ -196,20 +203,52 @@ func runOIDCLogin(cmd *cobra.Command, deps oidcLoginCommandDeps, flags oidcLogin
 		opts = append(opts, oidcclient.WithSkipListen())
 	}
 
-	if len(flags.caBundlePaths) > 0 || len(flags.caBundleData) > 0 {
-		client, err := makeClient(flags.caBundlePaths, flags.caBundleData)
+	// --bind-to-client-certificate presents a client certificate, which the Supervisor can bind the tokens to.
+	var clientCert *tls.Certificate
+	if flags.bindToClientCertificate {
+		cert, err := filesession.LoadOrCreateClientCertificate(clientCertificatePath(flags.sessionCachePath))
+		if err != nil {
+			plog.WarningErr("Could not load or create the client certificate, continuing without binding tokens to it", err)
+		} else {
+			clientCert = &cert
+		}
+	}
+
+	if len(flags.caBundlePaths) > 0 || len(flags.caBundleData) > 0 || clientCert != nil {
+		client, err := makeClient(flags.caBundlePaths, flags.caBundleData, clientCert)
 		if err != nil {
 			return err
 		}
 		opts = append(opts, oidcclient.WithClient(client))
 	}
-	// Look up cached credentials based on a hash of all the CLI arguments and the cluster info.
+
+	// --workload-identity-token-file exchanges a token of the workload instead of logging in. The file is read on
+	// every run, because the tokens of workloads are usually rotated by their platform.
+	var workloadIdentityTokenHash string
+	if flags.workloadIdentityTokenFile != "" {
+		workloadIdentityToken, err := ioutil.ReadFile(flags.workloadIdentityTokenFile)
+		if err != nil {
+			return fmt.Errorf("could not read --workload-identity-token-file: %w", err)
+		}
+		token := strings.TrimSpace(string(workloadIdentityToken))
+		if token == "" {
+			return fmt.Errorf("could not read --workload-identity-token-file: %s is empty", flags.workloadIdentityTokenFile)
+		}
+		opts = append(opts, oidcclient.WithWorkloadIdentityToken(token))
+		hash := sha256.Sum256([]byte(token))
+		workloadIdentityTokenHash = hex.EncodeToString(hash[:])
+	}
+
+	// Look up cached credentials based on a hash of all the CLI arguments and the cluster info. When the workload
+	// identity token is rotated, the cached credentials of the old token are not used.
 	cacheKey := struct {
-		Args        []string                   `json:"args"`
-		ClusterInfo *clientauthv1beta1.Cluster `json:"cluster"`
+		Args                  []string                   `json:"args"`
+		ClusterInfo           *clientauthv1beta1.Cluster `json:"cluster"`
+		WorkloadIdentityToken string                     `json:"workloadIdentityToken,omitempty"`
 	}{
-		Args:        os.Args[1:],
-		ClusterInfo: loadClusterInfo(),
+		Args:                  os.Args[1:],
+		ClusterInfo:           loadClusterInfo(),
+		WorkloadIdentityToken: workloadIdentityTokenHash,
 	}
 	var credCache *execcredcache.Cache
 	if flags.credentialCachePath != "" {
@@ -266,17 +305,41 @@ func flowOptions(requestedIDPType idpdiscoveryv1alpha1.IDPType, requestedFlow id
 				"--upstream-identity-provider-flow value not recognized for identity provider type %q: %s (supported values: %s)",
 				requestedIDPType, requestedFlow, strings.Join([]string{idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode.String(), idpdiscoveryv1alpha1.IDPFlowCLIPassword.String()}, ", "))
 		}
-	case idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeActiveDirectory:
+	case idpdiscoveryv1alpha1.IDPTypeLDAP, idpdiscoveryv1alpha1.IDPTypeWebhook, idpdiscoveryv1alpha1.IDPTypeLocal:
 		switch requestedFlow {
 		case idpdiscoveryv1alpha1.IDPFlowCLIPassword, "":
 			return useCLIFlow, nil
-		case idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode:
-			fallthrough // not supported for LDAP providers, so fallthrough to error case
+		case idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode, idpdiscoveryv1alpha1.IDPFlowCLIKerberos:
+			fallthrough // not supported for LDAP, webhook, or local providers, so fallthrough to error case
 		default:
 			return nil, fmt.Errorf(
 				"--upstream-identity-provider-flow value not recognized for identity provider type %q: %s (supported values: %s)",
 				requestedIDPType, requestedFlow, []string{idpdiscoveryv1alpha1.IDPFlowCLIPassword.String()})
 		}
+	case idpdiscoveryv1alpha1.IDPTypeActiveDirectory:
+		switch requestedFlow {
+		case idpdiscoveryv1alpha1.IDPFlowCLIPassword, "":
+			return useCLIFlow, nil
+		case idpdiscoveryv1alpha1.IDPFlowCLIKerberos:
+			return []oidcclient.Option{oidcclient.WithCLISendingKerberosTicket()}, nil
+		case idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode:
+			fallthrough // not supported for Active Directory providers, so fallthrough to error case
+		default:
+			return nil, fmt.Errorf(
+				"--upstream-identity-provider-flow value not recognized for identity provider type %q: %s (supported values: %s)",
+				requestedIDPType, requestedFlow, []string{idpdiscoveryv1alpha1.IDPFlowCLIPassword.String(), idpdiscoveryv1alpha1.IDPFlowCLIKerberos.String()})
+		}
+	case idpdiscoveryv1alpha1.IDPTypeGitHub, idpdiscoveryv1alpha1.IDPTypeSAML, idpdiscoveryv1alpha1.IDPTypeOAuth2:
+		switch requestedFlow {
+		case idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode, "":
+			return nil, nil // browser authcode flow is the default Option, so don't need to return an Option here
+		case idpdiscoveryv1alpha1.IDPFlowCLIPassword:
+			fallthrough // not supported for GitHub, SAML or OAuth2 providers, so fallthrough to error case
+		default:
+			return nil, fmt.Errorf(
+				"--upstream-identity-provider-flow value not recognized for identity provider type %q: %s (supported values: %s)",
+				requestedIDPType, requestedFlow, []string{idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode.String()})
+		}
 	default:
 		// Surprisingly cobra does not support this kind of flag validation. See https://github.com/spf13/pflag/issues/236
 		return nil, fmt.Errorf(
@@ -286,13 +349,27 @@ func flowOptions(requestedIDPType idpdiscoveryv1alpha1.IDPType, requestedFlow id
 				idpdiscoveryv1alpha1.IDPTypeOIDC.String(),
 				idpdiscoveryv1alpha1.IDPTypeLDAP.String(),
 				idpdiscoveryv1alpha1.IDPTypeActiveDirectory.String(),
+				idpdiscoveryv1alpha1.IDPTypeGitHub.String(),
+				idpdiscoveryv1alpha1.IDPTypeSAML.String(),
+				idpdiscoveryv1alpha1.IDPTypeOAuth2.String(),
+				idpdiscoveryv1alpha1.IDPTypeWebhook.String(),
+				idpdiscoveryv1alpha1.IDPTypeLocal.String(),
 			}, ", "),
 		)
 	}
 }
 
-func makeClient(caBundlePaths []string, caBundleData []string) (*http.Client, error) {
-	pool := x509.NewCertPool()
+// clientCertificatePath returns the path of the client certificate which is stored next to the session cache.
+func clientCertificatePath(sessionCachePath string) string {
+	return filepath.Join(filepath.Dir(sessionCachePath), "session-client-certificate.pem")
+}
+
+func makeClient(caBundlePaths []string, caBundleData []string, clientCert *tls.Certificate) (*http.Client, error) {
+	// Use the system trust store unless a CA bundle was given.
+	var pool *x509.CertPool
+	if len(caBundlePaths) > 0 || len(caBundleData) > 0 {
+		pool = x509.NewCertPool()
+	}
 	for _, p := range caBundlePaths {
 		pem, err := ioutil.ReadFile(p)
 		if err != nil {
@@ -307,6 +384,9 @@ func makeClient(caBundlePaths []string, caBundleData []string) (*http.Client, er
 		}
 		pool.AppendCertsFromPEM(pem)
 	}
+	if clientCert != nil {
+		return phttp.DefaultWithOptions(pool, phttp.WithClientCertificate(*clientCert)), nil
+	}
 	return phttp.Default(pool), nil
 }
 
@@ -36,11 +36,16 @@ type ActiveDirectoryIdentityProviderStatus struct {
 }
 
 type ActiveDirectoryIdentityProviderBind struct {
-	// SecretName contains the name of a namespace-local Secret object that provides the username and
-	// password for an Active Directory bind user. This account will be used to perform LDAP searches. The Secret should be
+	// SecretName contains the name of a namespace-local Secret object that provides the credentials
+	// for an Active Directory bind user. This account will be used to perform LDAP searches. The Secret should be
 	// of type "kubernetes.io/basic-auth" which includes "username" and "password" keys. The username value
 	// should be the full dn (distinguished name) of your bind account, e.g. "cn=bind-account,ou=users,dc=example,dc=com".
 	// The password must be non-empty.
+	// Alternatively, the Secret may be of type "kubernetes.io/tls" which includes "tls.crt" and "tls.key" keys,
+	// containing a client certificate and its private key. The client certificate will be presented during the TLS
+	// handshake with the server, and the bind will be performed using the SASL EXTERNAL mechanism, so the server
+	// must be configured to map the client certificate to the bind account.
+	// See https://datatracker.ietf.org/doc/html/rfc4422#appendix-A.
 	// +kubebuilder:validation:MinLength=1
 	SecretName string `json:"secretName"`
 }
@@ -64,6 +69,8 @@ type ActiveDirectoryIdentityProviderGroupSearchAttributes struct {
 	// in the user's list of groups after a successful authentication.
 	// The value of this field is case-sensitive and must match the case of the attribute name returned by the ActiveDirectory
 	// server in the user's entry. E.g. "cn" for common name. Distinguished names can be used by specifying lower-case "dn".
+	// Groups can be named by their SIDs (security identifiers), e.g. "S-1-5-21-1004336348-1177238915-682003330-512",
+	// by specifying "objectSid".
 	// Optional. When not specified, this defaults to a custom field that looks like "sAMAccountName@domain",
 	// where domain is constructed from the domain components of the group DN.
 	// +optional
@@ -127,11 +134,32 @@ type ActiveDirectoryIdentityProviderGroupSearch struct {
 	// +optional
 	Filter string `json:"filter,omitempty"`
 
+	// UseTokenGroups, when set to true, means that the user's groups will be found using the "tokenGroups" attribute
+	// of the user's entry instead of using the Filter. Active Directory computes this attribute to contain the SIDs
+	// (security identifiers) of all the security groups which the user belongs to, including nested groups. The
+	// groups with those SIDs are then found using a single search under the Base. This is typically much faster than
+	// searching with the Filter in large forests. Note that the tokenGroups attribute does not include distribution
+	// groups. When true, the Filter is ignored.
+	// Optional. When not specified, the Filter is used.
+	// +optional
+	UseTokenGroups bool `json:"useTokenGroups,omitempty"`
+
 	// Attributes specifies how the group's information should be read from each ActiveDirectory entry which was found as
 	// the result of the group search.
 	// +optional
 	Attributes ActiveDirectoryIdentityProviderGroupSearchAttributes `json:"attributes,omitempty"`
 
+	// CacheTTLSeconds, when greater than zero, is the number of seconds for which the groups which were found for
+	// a user are remembered by the Supervisor and reused when the user's session is refreshed, instead of searching
+	// for the user's groups again during every refresh. The user's entry is still searched for during every refresh.
+	// The user's groups are always searched for when the user logs in. Caching the groups reduces the load on the
+	// LDAP server caused by refreshes, at the cost of group membership changes taking up to this long to be
+	// reflected in the user's session. Unlike skipGroupRefresh, the groups are still refreshed after this time.
+	// Optional. When not specified or zero, the user's groups are searched for during every refresh.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	CacheTTLSeconds int32 `json:"cacheTTLSeconds,omitempty"`
+
 	// The user's group membership is refreshed as they interact with the supervisor
 	// to obtain new credentials (as their old credentials expire).  This allows group
 	// membership changes to be quickly reflected into Kubernetes clusters.  Since
@@ -158,12 +186,53 @@ type ActiveDirectoryIdentityProviderGroupSearch struct {
 	SkipGroupRefresh bool `json:"skipGroupRefresh,omitempty"`
 }
 
+type ActiveDirectoryIdentityProviderKerberos struct {
+	// KeytabSecretName contains the name of a namespace-local Secret object that provides the keytab of the
+	// Supervisor's Kerberos service principal. The keys from the keytab will be used to validate the Kerberos
+	// tickets which are presented by users during login. The Secret must be of type
+	// "secrets.pinniped.dev/kerberos-keytab" with the key "keytab", whose value is the binary keytab file, e.g. as
+	// created by the "ktpass" or "ktutil" commands.
+	// +kubebuilder:validation:MinLength=1
+	KeytabSecretName string `json:"keytabSecretName"`
+
+	// ServicePrincipalName is the name of the Supervisor's service principal, e.g. "HTTP/supervisor.example.com".
+	// Clients will request tickets for the principal named "HTTP/" followed by the hostname of the issuer of the
+	// FederationDomain, so this principal should be registered in Active Directory with that name.
+	// Optional. When not specified, tickets for any of the principals in the keytab will be accepted.
+	// +optional
+	ServicePrincipalName string `json:"servicePrincipalName,omitempty"`
+}
+
+type ActiveDirectoryIdentityProviderDomainControllerDiscovery struct {
+	// Domain is the DNS name of the Active Directory domain, e.g. "corp.example.com". When the Host and the
+	// AdditionalHosts cannot be reached, the domain controllers which are listed in the DNS SRV records for
+	// "_ldap._tcp.<domain>" will be tried in the order of their priority and weight. Each domain controller is
+	// tried using the port from its SRV record, and the same connection protocol which is used for the Host.
+	// +kubebuilder:validation:MinLength=1
+	Domain string `json:"domain"`
+}
+
 // Spec for configuring an ActiveDirectory identity provider.
 type ActiveDirectoryIdentityProviderSpec struct {
 	// Host is the hostname of this Active Directory identity provider, i.e., where to connect. For example: ldap.example.com:636.
 	// +kubebuilder:validation:MinLength=1
 	Host string `json:"host"`
 
+	// AdditionalHosts are the hostnames of other domain controllers of this Active Directory domain. When the Host
+	// cannot be reached, the Supervisor will fail over to these domain controllers in the order in which they are
+	// listed. Domain controllers which recently could not be reached are tried last. Only ordered failover is
+	// supported: connections are not load balanced across the domain controllers, so all connections are made to the
+	// Host while it can be reached. Each entry has the same format as the Host. The Host is still used to identify
+	// this identity provider, for example in the subject of the downstream ID tokens, regardless of which domain
+	// controller was used.
+	// +optional
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+
+	// DomainControllerDiscovery contains the configuration for discovering more domain controllers using DNS.
+	// Optional. When not specified, only the Host and the AdditionalHosts are used.
+	// +optional
+	DomainControllerDiscovery *ActiveDirectoryIdentityProviderDomainControllerDiscovery `json:"domainControllerDiscovery,omitempty"`
+
 	// TLS contains the connection settings for how to establish the connection to the Host.
 	TLS *TLSSpec `json:"tls,omitempty"`
 
@@ -176,6 +245,15 @@ type ActiveDirectoryIdentityProviderSpec struct {
 
 	// GroupSearch contains the configuration for searching for a user's group membership in ActiveDirectory.
 	GroupSearch ActiveDirectoryIdentityProviderGroupSearch `json:"groupSearch,omitempty"`
+
+	// Kerberos contains the configuration for allowing users to log in using their existing Kerberos tickets, e.g. on
+	// domain-joined workstations, instead of using their passwords. The tickets are sent by the client using the
+	// SPNEGO (Negotiate) HTTP authentication scheme. After validating the ticket, the user and their groups are
+	// looked up using the configured user and group searches, with the username of the ticket's principal (without
+	// its realm) as the username. Only users from the realm of the Supervisor's service principal are accepted.
+	// Optional. When not specified, Kerberos logins are not allowed.
+	// +optional
+	Kerberos *ActiveDirectoryIdentityProviderKerberos `json:"kerberos,omitempty"`
 }
 
 // ActiveDirectoryIdentityProvider describes the configuration of an upstream Microsoft Active Directory identity provider.
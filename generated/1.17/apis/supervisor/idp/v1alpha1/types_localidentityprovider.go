@@ -0,0 +1,89 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type LocalIdentityProviderPhase string
+
+const (
+	// LocalPhasePending is the default phase for newly-created LocalIdentityProvider resources.
+	LocalPhasePending LocalIdentityProviderPhase = "Pending"
+
+	// LocalPhaseReady is the phase for a LocalIdentityProvider resource in a healthy state.
+	LocalPhaseReady LocalIdentityProviderPhase = "Ready"
+
+	// LocalPhaseError is the phase for a LocalIdentityProvider in an unhealthy state.
+	LocalPhaseError LocalIdentityProviderPhase = "Error"
+)
+
+// LocalIdentityProviderStatus is the status of a local identity provider.
+type LocalIdentityProviderStatus struct {
+	// Phase summarizes the overall status of the LocalIdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase LocalIdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// LocalUsers selects the Secrets which define the users of a local identity provider.
+type LocalUsers struct {
+	// SecretSelector selects the Secrets in the same namespace as the LocalIdentityProvider which define its users.
+	// Only Secrets of type "secrets.pinniped.dev/local-user" are considered. When this is empty, all such Secrets in
+	// the namespace are selected.
+	//
+	// Each Secret defines one user. The name of the Secret is the username and its UID is the UID of the user. The
+	// Secret must contain the key "passwordHash", which holds a bcrypt hash of the user's password, e.g. as produced
+	// by "htpasswd -nbBC 10 username password". It may also contain these optional keys:
+	// "groups", which holds a comma-separated list of the user's group memberships;
+	// "disabled", which prevents the user from logging in or refreshing their session when it is set to "true";
+	// "passwordExpiresAt", which holds an RFC3339 timestamp after which the user's password is no longer accepted and
+	// their sessions can no longer be refreshed.
+	// +optional
+	SecretSelector metav1.LabelSelector `json:"secretSelector,omitempty"`
+}
+
+// LocalIdentityProviderSpec is the spec for configuring a local identity provider.
+type LocalIdentityProviderSpec struct {
+	// Users selects the Secrets which define the users of this identity provider.
+	// +optional
+	Users LocalUsers `json:"users,omitempty"`
+}
+
+// LocalIdentityProvider describes the configuration of an identity provider whose users are stored in Secrets
+// in the Supervisor's namespace. This allows small teams, or administrators who need break-glass access, to log in
+// without running an external identity provider.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type LocalIdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec LocalIdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status LocalIdentityProviderStatus `json:"status,omitempty"`
+}
+
+// LocalIdentityProviderList lists LocalIdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type LocalIdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []LocalIdentityProvider `json:"items"`
+}
@@ -138,6 +138,24 @@ type OIDCClaims struct {
 	// the ID token.
 	// +optional
 	Username string `json:"username"`
+
+	// UsernameExpression is a CEL expression (see https://github.com/google/cel-spec) which will be used to compute an
+	// identity's username from the merged claims of the ID token and the userinfo endpoint response. The claims are
+	// available to the expression as a map called "claims", so nested claims may be read with expressions such as
+	// `claims.profile.login` and values may be concatenated with expressions such as
+	// `claims.given_name + "." + claims.family_name`. The expression must evaluate to a string. This setting cannot
+	// be used at the same time as the username setting.
+	// +optional
+	UsernameExpression string `json:"usernameExpression,omitempty"`
+
+	// GroupsExpression is a CEL expression (see https://github.com/google/cel-spec) which will be used to compute the
+	// groups to which an identity belongs from the merged claims of the ID token and the userinfo endpoint response.
+	// The claims are available to the expression as a map called "claims". For example, roles which are nested under
+	// a client ID could be used as groups with `claims.resource_access["my-client"].roles`, or could be prefixed with
+	// `claims.resource_access["my-client"].roles.map(r, "my-client:" + r)`. The expression must evaluate to a list
+	// of strings or to a single string. This setting cannot be used at the same time as the groups setting.
+	// +optional
+	GroupsExpression string `json:"groupsExpression,omitempty"`
 }
 
 // OIDCClient contains information about an OIDC client (e.g., client ID and client
@@ -147,9 +165,31 @@ type OIDCClient struct {
 	// clientSecret for an OIDC client. If only the SecretName is specified in an OIDCClient
 	// struct, then it is expected that the Secret is of type "secrets.pinniped.dev/oidc-client" with keys
 	// "clientID" and "clientSecret".
+	// To authenticate to your OIDC provider's token endpoint using the "private_key_jwt" client authentication method
+	// instead of a client secret (see https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication),
+	// replace the "clientSecret" key with a "privateKey" key which contains a PEM-encoded RSA or ECDSA private key.
+	// The corresponding public key must be registered with your OIDC provider for this client. An optional
+	// "privateKeyID" key may be used to set the "kid" header of the signed client assertions, which may be required
+	// by your OIDC provider to find the registered public key.
 	SecretName string `json:"secretName"`
 }
 
+// OIDCTLSSpec configures TLS parameters for requests to an OIDC identity provider.
+type OIDCTLSSpec struct {
+	// X.509 Certificate Authority (base64-encoded PEM bundle). If omitted, a default set of system roots will be trusted.
+	// +optional
+	CertificateAuthorityData string `json:"certificateAuthorityData,omitempty"`
+
+	// ClientCertificateSecretName is the name of a namespace-local Secret of type "kubernetes.io/tls" which contains a
+	// client certificate and private key in its "tls.crt" and "tls.key" keys. When set, the client certificate will be
+	// presented to the issuer whenever it requests a client certificate (mutual TLS). This applies to all requests to
+	// the issuer, including its discovery, token, userinfo and revocation endpoints, and also allows the
+	// "tls_client_auth" client authentication method (see https://datatracker.ietf.org/doc/html/rfc8705#section-2.1),
+	// in which case the Secret referenced by the client settings does not need to contain a client secret.
+	// +optional
+	ClientCertificateSecretName string `json:"clientCertificateSecretName,omitempty"`
+}
+
 // OIDCIdentityProviderSpec is the spec for configuring an OIDC identity provider.
 type OIDCIdentityProviderSpec struct {
 	// Issuer is the issuer URL of this OIDC identity provider, i.e., where to fetch
@@ -160,7 +200,13 @@ type OIDCIdentityProviderSpec struct {
 
 	// TLS configuration for discovery/JWKS requests to the issuer.
 	// +optional
-	TLS *TLSSpec `json:"tls,omitempty"`
+	TLS *OIDCTLSSpec `json:"tls,omitempty"`
+
+	// Proxy configures an HTTP proxy for all requests to the issuer, including discovery, JWKS, token, userinfo and
+	// revocation requests. By default, the proxy settings from the Supervisor's environment variables (HTTPS_PROXY,
+	// HTTP_PROXY and NO_PROXY) will be used.
+	// +optional
+	Proxy *ProxySpec `json:"proxy,omitempty"`
 
 	// AuthorizationConfig holds information about how to form the OAuth2 authorization request
 	// parameters to be used with this OIDC identity provider.
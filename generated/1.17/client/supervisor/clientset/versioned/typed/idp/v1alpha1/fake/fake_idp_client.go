@@ -19,14 +19,38 @@ func (c *FakeIDPV1alpha1) ActiveDirectoryIdentityProviders(namespace string) v1a
 	return &FakeActiveDirectoryIdentityProviders{c, namespace}
 }
 
+func (c *FakeIDPV1alpha1) GitHubIdentityProviders(namespace string) v1alpha1.GitHubIdentityProviderInterface {
+	return &FakeGitHubIdentityProviders{c, namespace}
+}
+
 func (c *FakeIDPV1alpha1) LDAPIdentityProviders(namespace string) v1alpha1.LDAPIdentityProviderInterface {
 	return &FakeLDAPIdentityProviders{c, namespace}
 }
 
+func (c *FakeIDPV1alpha1) LocalIdentityProviders(namespace string) v1alpha1.LocalIdentityProviderInterface {
+	return &FakeLocalIdentityProviders{c, namespace}
+}
+
+func (c *FakeIDPV1alpha1) OAuth2IdentityProviders(namespace string) v1alpha1.OAuth2IdentityProviderInterface {
+	return &FakeOAuth2IdentityProviders{c, namespace}
+}
+
 func (c *FakeIDPV1alpha1) OIDCIdentityProviders(namespace string) v1alpha1.OIDCIdentityProviderInterface {
 	return &FakeOIDCIdentityProviders{c, namespace}
 }
 
+func (c *FakeIDPV1alpha1) SAMLIdentityProviders(namespace string) v1alpha1.SAMLIdentityProviderInterface {
+	return &FakeSAMLIdentityProviders{c, namespace}
+}
+
+func (c *FakeIDPV1alpha1) WebhookIdentityProviders(namespace string) v1alpha1.WebhookIdentityProviderInterface {
+	return &FakeWebhookIdentityProviders{c, namespace}
+}
+
+func (c *FakeIDPV1alpha1) WorkloadIdentityProviders(namespace string) v1alpha1.WorkloadIdentityProviderInterface {
+	return &FakeWorkloadIdentityProviders{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeIDPV1alpha1) RESTClient() rest.Interface {
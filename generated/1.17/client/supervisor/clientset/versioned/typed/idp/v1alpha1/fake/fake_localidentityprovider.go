@@ -0,0 +1,127 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1alpha1 "go.pinniped.dev/generated/1.17/apis/supervisor/idp/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeLocalIdentityProviders implements LocalIdentityProviderInterface
+type FakeLocalIdentityProviders struct {
+	Fake *FakeIDPV1alpha1
+	ns   string
+}
+
+var localidentityprovidersResource = schema.GroupVersionResource{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Resource: "localidentityproviders"}
+
+var localidentityprovidersKind = schema.GroupVersionKind{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Kind: "LocalIdentityProvider"}
+
+// Get takes name of the localIdentityProvider, and returns the corresponding localIdentityProvider object, and an error if there is any.
+func (c *FakeLocalIdentityProviders) Get(name string, options v1.GetOptions) (result *v1alpha1.LocalIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(localidentityprovidersResource, c.ns, name), &v1alpha1.LocalIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.LocalIdentityProvider), err
+}
+
+// List takes label and field selectors, and returns the list of LocalIdentityProviders that match those selectors.
+func (c *FakeLocalIdentityProviders) List(opts v1.ListOptions) (result *v1alpha1.LocalIdentityProviderList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(localidentityprovidersResource, localidentityprovidersKind, c.ns, opts), &v1alpha1.LocalIdentityProviderList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.LocalIdentityProviderList{ListMeta: obj.(*v1alpha1.LocalIdentityProviderList).ListMeta}
+	for _, item := range obj.(*v1alpha1.LocalIdentityProviderList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested localIdentityProviders.
+func (c *FakeLocalIdentityProviders) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(localidentityprovidersResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a localIdentityProvider and creates it.  Returns the server's representation of the localIdentityProvider, and an error, if there is any.
+func (c *FakeLocalIdentityProviders) Create(localIdentityProvider *v1alpha1.LocalIdentityProvider) (result *v1alpha1.LocalIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(localidentityprovidersResource, c.ns, localIdentityProvider), &v1alpha1.LocalIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.LocalIdentityProvider), err
+}
+
+// Update takes the representation of a localIdentityProvider and updates it. Returns the server's representation of the localIdentityProvider, and an error, if there is any.
+func (c *FakeLocalIdentityProviders) Update(localIdentityProvider *v1alpha1.LocalIdentityProvider) (result *v1alpha1.LocalIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(localidentityprovidersResource, c.ns, localIdentityProvider), &v1alpha1.LocalIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.LocalIdentityProvider), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeLocalIdentityProviders) UpdateStatus(localIdentityProvider *v1alpha1.LocalIdentityProvider) (*v1alpha1.LocalIdentityProvider, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(localidentityprovidersResource, "status", c.ns, localIdentityProvider), &v1alpha1.LocalIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.LocalIdentityProvider), err
+}
+
+// Delete takes name of the localIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *FakeLocalIdentityProviders) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(localidentityprovidersResource, c.ns, name), &v1alpha1.LocalIdentityProvider{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeLocalIdentityProviders) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(localidentityprovidersResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.LocalIdentityProviderList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched localIdentityProvider.
+func (c *FakeLocalIdentityProviders) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.LocalIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(localidentityprovidersResource, c.ns, name, pt, data, subresources...), &v1alpha1.LocalIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.LocalIdentityProvider), err
+}
@@ -14,8 +14,14 @@ import (
 type IDPV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	ActiveDirectoryIdentityProvidersGetter
+	GitHubIdentityProvidersGetter
 	LDAPIdentityProvidersGetter
+	LocalIdentityProvidersGetter
+	OAuth2IdentityProvidersGetter
 	OIDCIdentityProvidersGetter
+	SAMLIdentityProvidersGetter
+	WebhookIdentityProvidersGetter
+	WorkloadIdentityProvidersGetter
 }
 
 // IDPV1alpha1Client is used to interact with features provided by the idp.supervisor.pinniped.dev group.
@@ -27,14 +33,38 @@ func (c *IDPV1alpha1Client) ActiveDirectoryIdentityProviders(namespace string) A
 	return newActiveDirectoryIdentityProviders(c, namespace)
 }
 
+func (c *IDPV1alpha1Client) GitHubIdentityProviders(namespace string) GitHubIdentityProviderInterface {
+	return newGitHubIdentityProviders(c, namespace)
+}
+
 func (c *IDPV1alpha1Client) LDAPIdentityProviders(namespace string) LDAPIdentityProviderInterface {
 	return newLDAPIdentityProviders(c, namespace)
 }
 
+func (c *IDPV1alpha1Client) LocalIdentityProviders(namespace string) LocalIdentityProviderInterface {
+	return newLocalIdentityProviders(c, namespace)
+}
+
+func (c *IDPV1alpha1Client) OAuth2IdentityProviders(namespace string) OAuth2IdentityProviderInterface {
+	return newOAuth2IdentityProviders(c, namespace)
+}
+
 func (c *IDPV1alpha1Client) OIDCIdentityProviders(namespace string) OIDCIdentityProviderInterface {
 	return newOIDCIdentityProviders(c, namespace)
 }
 
+func (c *IDPV1alpha1Client) SAMLIdentityProviders(namespace string) SAMLIdentityProviderInterface {
+	return newSAMLIdentityProviders(c, namespace)
+}
+
+func (c *IDPV1alpha1Client) WebhookIdentityProviders(namespace string) WebhookIdentityProviderInterface {
+	return newWebhookIdentityProviders(c, namespace)
+}
+
+func (c *IDPV1alpha1Client) WorkloadIdentityProviders(namespace string) WorkloadIdentityProviderInterface {
+	return newWorkloadIdentityProviders(c, namespace)
+}
+
 // NewForConfig creates a new IDPV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*IDPV1alpha1Client, error) {
 	config := *c
@@ -0,0 +1,178 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"time"
+
+	v1alpha1 "go.pinniped.dev/generated/1.17/apis/supervisor/idp/v1alpha1"
+	scheme "go.pinniped.dev/generated/1.17/client/supervisor/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// LocalIdentityProvidersGetter has a method to return a LocalIdentityProviderInterface.
+// A group's client should implement this interface.
+type LocalIdentityProvidersGetter interface {
+	LocalIdentityProviders(namespace string) LocalIdentityProviderInterface
+}
+
+// LocalIdentityProviderInterface has methods to work with LocalIdentityProvider resources.
+type LocalIdentityProviderInterface interface {
+	Create(*v1alpha1.LocalIdentityProvider) (*v1alpha1.LocalIdentityProvider, error)
+	Update(*v1alpha1.LocalIdentityProvider) (*v1alpha1.LocalIdentityProvider, error)
+	UpdateStatus(*v1alpha1.LocalIdentityProvider) (*v1alpha1.LocalIdentityProvider, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.LocalIdentityProvider, error)
+	List(opts v1.ListOptions) (*v1alpha1.LocalIdentityProviderList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.LocalIdentityProvider, err error)
+	LocalIdentityProviderExpansion
+}
+
+// localIdentityProviders implements LocalIdentityProviderInterface
+type localIdentityProviders struct {
+	client rest.Interface
+	ns     string
+}
+
+// newLocalIdentityProviders returns a LocalIdentityProviders
+func newLocalIdentityProviders(c *IDPV1alpha1Client, namespace string) *localIdentityProviders {
+	return &localIdentityProviders{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the localIdentityProvider, and returns the corresponding localIdentityProvider object, and an error if there is any.
+func (c *localIdentityProviders) Get(name string, options v1.GetOptions) (result *v1alpha1.LocalIdentityProvider, err error) {
+	result = &v1alpha1.LocalIdentityProvider{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of LocalIdentityProviders that match those selectors.
+func (c *localIdentityProviders) List(opts v1.ListOptions) (result *v1alpha1.LocalIdentityProviderList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.LocalIdentityProviderList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested localIdentityProviders.
+func (c *localIdentityProviders) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a localIdentityProvider and creates it.  Returns the server's representation of the localIdentityProvider, and an error, if there is any.
+func (c *localIdentityProviders) Create(localIdentityProvider *v1alpha1.LocalIdentityProvider) (result *v1alpha1.LocalIdentityProvider, err error) {
+	result = &v1alpha1.LocalIdentityProvider{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		Body(localIdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a localIdentityProvider and updates it. Returns the server's representation of the localIdentityProvider, and an error, if there is any.
+func (c *localIdentityProviders) Update(localIdentityProvider *v1alpha1.LocalIdentityProvider) (result *v1alpha1.LocalIdentityProvider, err error) {
+	result = &v1alpha1.LocalIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		Name(localIdentityProvider.Name).
+		Body(localIdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *localIdentityProviders) UpdateStatus(localIdentityProvider *v1alpha1.LocalIdentityProvider) (result *v1alpha1.LocalIdentityProvider, err error) {
+	result = &v1alpha1.LocalIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		Name(localIdentityProvider.Name).
+		SubResource("status").
+		Body(localIdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the localIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *localIdentityProviders) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *localIdentityProviders) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched localIdentityProvider.
+func (c *localIdentityProviders) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.LocalIdentityProvider, err error) {
+	result = &v1alpha1.LocalIdentityProvider{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("localidentityproviders").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
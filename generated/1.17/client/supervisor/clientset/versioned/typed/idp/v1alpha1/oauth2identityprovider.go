@@ -0,0 +1,178 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"time"
+
+	v1alpha1 "go.pinniped.dev/generated/1.17/apis/supervisor/idp/v1alpha1"
+	scheme "go.pinniped.dev/generated/1.17/client/supervisor/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// OAuth2IdentityProvidersGetter has a method to return a OAuth2IdentityProviderInterface.
+// A group's client should implement this interface.
+type OAuth2IdentityProvidersGetter interface {
+	OAuth2IdentityProviders(namespace string) OAuth2IdentityProviderInterface
+}
+
+// OAuth2IdentityProviderInterface has methods to work with OAuth2IdentityProvider resources.
+type OAuth2IdentityProviderInterface interface {
+	Create(*v1alpha1.OAuth2IdentityProvider) (*v1alpha1.OAuth2IdentityProvider, error)
+	Update(*v1alpha1.OAuth2IdentityProvider) (*v1alpha1.OAuth2IdentityProvider, error)
+	UpdateStatus(*v1alpha1.OAuth2IdentityProvider) (*v1alpha1.OAuth2IdentityProvider, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.OAuth2IdentityProvider, error)
+	List(opts v1.ListOptions) (*v1alpha1.OAuth2IdentityProviderList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.OAuth2IdentityProvider, err error)
+	OAuth2IdentityProviderExpansion
+}
+
+// oAuth2IdentityProviders implements OAuth2IdentityProviderInterface
+type oAuth2IdentityProviders struct {
+	client rest.Interface
+	ns     string
+}
+
+// newOAuth2IdentityProviders returns a OAuth2IdentityProviders
+func newOAuth2IdentityProviders(c *IDPV1alpha1Client, namespace string) *oAuth2IdentityProviders {
+	return &oAuth2IdentityProviders{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the oAuth2IdentityProvider, and returns the corresponding oAuth2IdentityProvider object, and an error if there is any.
+func (c *oAuth2IdentityProviders) Get(name string, options v1.GetOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of OAuth2IdentityProviders that match those selectors.
+func (c *oAuth2IdentityProviders) List(opts v1.ListOptions) (result *v1alpha1.OAuth2IdentityProviderList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.OAuth2IdentityProviderList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested oAuth2IdentityProviders.
+func (c *oAuth2IdentityProviders) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a oAuth2IdentityProvider and creates it.  Returns the server's representation of the oAuth2IdentityProvider, and an error, if there is any.
+func (c *oAuth2IdentityProviders) Create(oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Body(oAuth2IdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a oAuth2IdentityProvider and updates it. Returns the server's representation of the oAuth2IdentityProvider, and an error, if there is any.
+func (c *oAuth2IdentityProviders) Update(oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(oAuth2IdentityProvider.Name).
+		Body(oAuth2IdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *oAuth2IdentityProviders) UpdateStatus(oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(oAuth2IdentityProvider.Name).
+		SubResource("status").
+		Body(oAuth2IdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the oAuth2IdentityProvider and deletes it. Returns an error if one occurs.
+func (c *oAuth2IdentityProviders) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *oAuth2IdentityProviders) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched oAuth2IdentityProvider.
+func (c *oAuth2IdentityProviders) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
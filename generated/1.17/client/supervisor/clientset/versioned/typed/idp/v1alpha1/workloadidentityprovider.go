@@ -0,0 +1,178 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"time"
+
+	v1alpha1 "go.pinniped.dev/generated/1.17/apis/supervisor/idp/v1alpha1"
+	scheme "go.pinniped.dev/generated/1.17/client/supervisor/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// WorkloadIdentityProvidersGetter has a method to return a WorkloadIdentityProviderInterface.
+// A group's client should implement this interface.
+type WorkloadIdentityProvidersGetter interface {
+	WorkloadIdentityProviders(namespace string) WorkloadIdentityProviderInterface
+}
+
+// WorkloadIdentityProviderInterface has methods to work with WorkloadIdentityProvider resources.
+type WorkloadIdentityProviderInterface interface {
+	Create(*v1alpha1.WorkloadIdentityProvider) (*v1alpha1.WorkloadIdentityProvider, error)
+	Update(*v1alpha1.WorkloadIdentityProvider) (*v1alpha1.WorkloadIdentityProvider, error)
+	UpdateStatus(*v1alpha1.WorkloadIdentityProvider) (*v1alpha1.WorkloadIdentityProvider, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.WorkloadIdentityProvider, error)
+	List(opts v1.ListOptions) (*v1alpha1.WorkloadIdentityProviderList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.WorkloadIdentityProvider, err error)
+	WorkloadIdentityProviderExpansion
+}
+
+// workloadIdentityProviders implements WorkloadIdentityProviderInterface
+type workloadIdentityProviders struct {
+	client rest.Interface
+	ns     string
+}
+
+// newWorkloadIdentityProviders returns a WorkloadIdentityProviders
+func newWorkloadIdentityProviders(c *IDPV1alpha1Client, namespace string) *workloadIdentityProviders {
+	return &workloadIdentityProviders{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the workloadIdentityProvider, and returns the corresponding workloadIdentityProvider object, and an error if there is any.
+func (c *workloadIdentityProviders) Get(name string, options v1.GetOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of WorkloadIdentityProviders that match those selectors.
+func (c *workloadIdentityProviders) List(opts v1.ListOptions) (result *v1alpha1.WorkloadIdentityProviderList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.WorkloadIdentityProviderList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested workloadIdentityProviders.
+func (c *workloadIdentityProviders) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a workloadIdentityProvider and creates it.  Returns the server's representation of the workloadIdentityProvider, and an error, if there is any.
+func (c *workloadIdentityProviders) Create(workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Body(workloadIdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a workloadIdentityProvider and updates it. Returns the server's representation of the workloadIdentityProvider, and an error, if there is any.
+func (c *workloadIdentityProviders) Update(workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(workloadIdentityProvider.Name).
+		Body(workloadIdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+
+func (c *workloadIdentityProviders) UpdateStatus(workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(workloadIdentityProvider.Name).
+		SubResource("status").
+		Body(workloadIdentityProvider).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the workloadIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *workloadIdentityProviders) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *workloadIdentityProviders) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched workloadIdentityProvider.
+func (c *workloadIdentityProviders) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,81 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "go.pinniped.dev/generated/1.17/apis/supervisor/idp/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// LocalIdentityProviderLister helps list LocalIdentityProviders.
+type LocalIdentityProviderLister interface {
+	// List lists all LocalIdentityProviders in the indexer.
+	List(selector labels.Selector) (ret []*v1alpha1.LocalIdentityProvider, err error)
+	// LocalIdentityProviders returns an object that can list and get LocalIdentityProviders.
+	LocalIdentityProviders(namespace string) LocalIdentityProviderNamespaceLister
+	LocalIdentityProviderListerExpansion
+}
+
+// localIdentityProviderLister implements the LocalIdentityProviderLister interface.
+type localIdentityProviderLister struct {
+	indexer cache.Indexer
+}
+
+// NewLocalIdentityProviderLister returns a new LocalIdentityProviderLister.
+func NewLocalIdentityProviderLister(indexer cache.Indexer) LocalIdentityProviderLister {
+	return &localIdentityProviderLister{indexer: indexer}
+}
+
+// List lists all LocalIdentityProviders in the indexer.
+func (s *localIdentityProviderLister) List(selector labels.Selector) (ret []*v1alpha1.LocalIdentityProvider, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.LocalIdentityProvider))
+	})
+	return ret, err
+}
+
+// LocalIdentityProviders returns an object that can list and get LocalIdentityProviders.
+func (s *localIdentityProviderLister) LocalIdentityProviders(namespace string) LocalIdentityProviderNamespaceLister {
+	return localIdentityProviderNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// LocalIdentityProviderNamespaceLister helps list and get LocalIdentityProviders.
+type LocalIdentityProviderNamespaceLister interface {
+	// List lists all LocalIdentityProviders in the indexer for a given namespace.
+	List(selector labels.Selector) (ret []*v1alpha1.LocalIdentityProvider, err error)
+	// Get retrieves the LocalIdentityProvider from the indexer for a given namespace and name.
+	Get(name string) (*v1alpha1.LocalIdentityProvider, error)
+	LocalIdentityProviderNamespaceListerExpansion
+}
+
+// localIdentityProviderNamespaceLister implements the LocalIdentityProviderNamespaceLister
+// interface.
+type localIdentityProviderNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all LocalIdentityProviders in the indexer for a given namespace.
+func (s localIdentityProviderNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.LocalIdentityProvider, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.LocalIdentityProvider))
+	})
+	return ret, err
+}
+
+// Get retrieves the LocalIdentityProvider from the indexer for a given namespace and name.
+func (s localIdentityProviderNamespaceLister) Get(name string) (*v1alpha1.LocalIdentityProvider, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("localidentityprovider"), name)
+	}
+	return obj.(*v1alpha1.LocalIdentityProvider), nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "go.pinniped.dev/generated/1.17/apis/supervisor/idp/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// OAuth2IdentityProviderLister helps list OAuth2IdentityProviders.
+type OAuth2IdentityProviderLister interface {
+	// List lists all OAuth2IdentityProviders in the indexer.
+	List(selector labels.Selector) (ret []*v1alpha1.OAuth2IdentityProvider, err error)
+	// OAuth2IdentityProviders returns an object that can list and get OAuth2IdentityProviders.
+	OAuth2IdentityProviders(namespace string) OAuth2IdentityProviderNamespaceLister
+	OAuth2IdentityProviderListerExpansion
+}
+
+// oAuth2IdentityProviderLister implements the OAuth2IdentityProviderLister interface.
+type oAuth2IdentityProviderLister struct {
+	indexer cache.Indexer
+}
+
+// NewOAuth2IdentityProviderLister returns a new OAuth2IdentityProviderLister.
+func NewOAuth2IdentityProviderLister(indexer cache.Indexer) OAuth2IdentityProviderLister {
+	return &oAuth2IdentityProviderLister{indexer: indexer}
+}
+
+// List lists all OAuth2IdentityProviders in the indexer.
+func (s *oAuth2IdentityProviderLister) List(selector labels.Selector) (ret []*v1alpha1.OAuth2IdentityProvider, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.OAuth2IdentityProvider))
+	})
+	return ret, err
+}
+
+// OAuth2IdentityProviders returns an object that can list and get OAuth2IdentityProviders.
+func (s *oAuth2IdentityProviderLister) OAuth2IdentityProviders(namespace string) OAuth2IdentityProviderNamespaceLister {
+	return oAuth2IdentityProviderNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// OAuth2IdentityProviderNamespaceLister helps list and get OAuth2IdentityProviders.
+type OAuth2IdentityProviderNamespaceLister interface {
+	// List lists all OAuth2IdentityProviders in the indexer for a given namespace.
+	List(selector labels.Selector) (ret []*v1alpha1.OAuth2IdentityProvider, err error)
+	// Get retrieves the OAuth2IdentityProvider from the indexer for a given namespace and name.
+	Get(name string) (*v1alpha1.OAuth2IdentityProvider, error)
+	OAuth2IdentityProviderNamespaceListerExpansion
+}
+
+// oAuth2IdentityProviderNamespaceLister implements the OAuth2IdentityProviderNamespaceLister
+// interface.
+type oAuth2IdentityProviderNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all OAuth2IdentityProviders in the indexer for a given namespace.
+func (s oAuth2IdentityProviderNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.OAuth2IdentityProvider, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.OAuth2IdentityProvider))
+	})
+	return ret, err
+}
+
+// Get retrieves the OAuth2IdentityProvider from the indexer for a given namespace and name.
+func (s oAuth2IdentityProviderNamespaceLister) Get(name string) (*v1alpha1.OAuth2IdentityProvider, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("oauth2identityprovider"), name)
+	}
+	return obj.(*v1alpha1.OAuth2IdentityProvider), nil
+}
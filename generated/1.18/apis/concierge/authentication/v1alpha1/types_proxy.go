@@ -0,0 +1,24 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+// Configuration for an HTTP proxy to use when making requests to an identity provider.
+type ProxySpec struct {
+	// URL of the HTTP proxy, e.g. "http://proxy.example.com:3128". The scheme must be http or https. Credentials must
+	// not be included in the URL. Use credentialsSecretName instead.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	URL string `json:"url"`
+
+	// NoProxy is a comma-separated list of host names, domain names, IP addresses, and CIDR ranges for which the proxy
+	// should not be used, using the same format as the NO_PROXY environment variable. By default, all requests to the
+	// identity provider will use the proxy.
+	// +optional
+	NoProxy string `json:"noProxy,omitempty"`
+
+	// CredentialsSecretName is the name of a Secret of type "kubernetes.io/basic-auth" in the namespace where the
+	// Concierge is installed, which contains the "username" and "password" which will be used to authenticate to the
+	// proxy using basic auth. By default, no credentials will be sent to the proxy.
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+}
@@ -0,0 +1,125 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type WorkloadIdentityProviderPhase string
+
+const (
+	// WorkloadPhasePending is the default phase for newly-created WorkloadIdentityProvider resources.
+	WorkloadPhasePending WorkloadIdentityProviderPhase = "Pending"
+
+	// WorkloadPhaseReady is the phase for a WorkloadIdentityProvider resource in a healthy state.
+	WorkloadPhaseReady WorkloadIdentityProviderPhase = "Ready"
+
+	// WorkloadPhaseError is the phase for a WorkloadIdentityProvider in an unhealthy state.
+	WorkloadPhaseError WorkloadIdentityProviderPhase = "Error"
+)
+
+// WorkloadIdentityProviderStatus is the status of a workload identity provider.
+type WorkloadIdentityProviderStatus struct {
+	// Phase summarizes the overall status of the WorkloadIdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase WorkloadIdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// WorkloadClaims describes how the claims of a workload's JWT are mapped to a downstream identity.
+type WorkloadClaims struct {
+	// Username is the name of the claim which will be used as the downstream username. When neither this setting
+	// nor the usernameExpression setting are set, the "sub" claim is used.
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// UsernameExpression is a CEL expression (see https://github.com/google/cel-spec) which will be used to compute
+	// the downstream username from the claims of the JWT, which are available to the expression as a map called
+	// "claims", e.g. `"github:" + claims.repository`. The expression must evaluate to a string. This setting cannot
+	// be used at the same time as the username setting.
+	// +optional
+	UsernameExpression string `json:"usernameExpression,omitempty"`
+
+	// Groups is the name of the claim which will be used as the downstream groups. The claim must be a string or a
+	// list of strings. When neither this setting nor the groupsExpression setting are set, the workload will not
+	// belong to any groups.
+	// +optional
+	Groups string `json:"groups,omitempty"`
+
+	// GroupsExpression is a CEL expression (see https://github.com/google/cel-spec) which will be used to compute the
+	// downstream groups from the claims of the JWT, which are available to the expression as a map called "claims",
+	// e.g. `["github:" + claims.repository_owner]`. The expression must evaluate to a list of strings or to a single
+	// string. This setting cannot be used at the same time as the groups setting.
+	// +optional
+	GroupsExpression string `json:"groupsExpression,omitempty"`
+
+	// Conditions are CEL expressions (see https://github.com/google/cel-spec) which must all evaluate to true for a
+	// JWT to be accepted, e.g. `claims.repository_owner == "my-org" && claims.ref == "refs/heads/main"`. The
+	// claims of the JWT are available to the expressions as a map called "claims". A condition which refers to a
+	// claim which is not present in the JWT rejects the JWT, unless it checks for the claim with has() first.
+	// +optional
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// WorkloadIdentityProviderSpec is the spec for configuring a workload identity provider.
+type WorkloadIdentityProviderSpec struct {
+	// Issuer is the issuer URL of the OIDC provider which issues JWTs to workloads, e.g.
+	// "https://token.actions.githubusercontent.com" for GitHub Actions, or the service account issuer of a
+	// Kubernetes cluster. The issuer must serve an OIDC discovery document and a JWKS.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^https://`
+	Issuer string `json:"issuer"`
+
+	// Audience is the value which must be present in the "aud" claim of the JWTs, which should be unique to this
+	// Supervisor so that the JWTs cannot be replayed to other services.
+	// +kubebuilder:validation:MinLength=1
+	Audience string `json:"audience"`
+
+	// TLS configuration for discovery and JWKS requests to the issuer.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// Claims describes which JWTs are accepted and how their claims are mapped to a downstream identity.
+	// +optional
+	Claims WorkloadClaims `json:"claims,omitempty"`
+}
+
+// WorkloadIdentityProvider describes the configuration of an external issuer of JWTs to workloads, e.g. Kubernetes
+// service accounts or CI pipelines, whose JWTs may be exchanged for tokens of the Supervisor's FederationDomains
+// using the RFC 8693 token exchange. Workloads do not log in interactively, so these identity providers are not
+// listed for users.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Issuer",type=string,JSONPath=`.spec.issuer`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type WorkloadIdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec WorkloadIdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status WorkloadIdentityProviderStatus `json:"status,omitempty"`
+}
+
+// WorkloadIdentityProviderList lists WorkloadIdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type WorkloadIdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []WorkloadIdentityProvider `json:"items"`
+}
@@ -0,0 +1,129 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "go.pinniped.dev/generated/1.18/apis/supervisor/idp/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeSAMLIdentityProviders implements SAMLIdentityProviderInterface
+type FakeSAMLIdentityProviders struct {
+	Fake *FakeIDPV1alpha1
+	ns   string
+}
+
+var samlidentityprovidersResource = schema.GroupVersionResource{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Resource: "samlidentityproviders"}
+
+var samlidentityprovidersKind = schema.GroupVersionKind{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Kind: "SAMLIdentityProvider"}
+
+// Get takes name of the sAMLIdentityProvider, and returns the corresponding sAMLIdentityProvider object, and an error if there is any.
+func (c *FakeSAMLIdentityProviders) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(samlidentityprovidersResource, c.ns, name), &v1alpha1.SAMLIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.SAMLIdentityProvider), err
+}
+
+// List takes label and field selectors, and returns the list of SAMLIdentityProviders that match those selectors.
+func (c *FakeSAMLIdentityProviders) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.SAMLIdentityProviderList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(samlidentityprovidersResource, samlidentityprovidersKind, c.ns, opts), &v1alpha1.SAMLIdentityProviderList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.SAMLIdentityProviderList{ListMeta: obj.(*v1alpha1.SAMLIdentityProviderList).ListMeta}
+	for _, item := range obj.(*v1alpha1.SAMLIdentityProviderList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested sAMLIdentityProviders.
+func (c *FakeSAMLIdentityProviders) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(samlidentityprovidersResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a sAMLIdentityProvider and creates it.  Returns the server's representation of the sAMLIdentityProvider, and an error, if there is any.
+func (c *FakeSAMLIdentityProviders) Create(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.CreateOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(samlidentityprovidersResource, c.ns, sAMLIdentityProvider), &v1alpha1.SAMLIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.SAMLIdentityProvider), err
+}
+
+// Update takes the representation of a sAMLIdentityProvider and updates it. Returns the server's representation of the sAMLIdentityProvider, and an error, if there is any.
+func (c *FakeSAMLIdentityProviders) Update(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(samlidentityprovidersResource, c.ns, sAMLIdentityProvider), &v1alpha1.SAMLIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.SAMLIdentityProvider), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeSAMLIdentityProviders) UpdateStatus(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.UpdateOptions) (*v1alpha1.SAMLIdentityProvider, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(samlidentityprovidersResource, "status", c.ns, sAMLIdentityProvider), &v1alpha1.SAMLIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.SAMLIdentityProvider), err
+}
+
+// Delete takes name of the sAMLIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *FakeSAMLIdentityProviders) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(samlidentityprovidersResource, c.ns, name), &v1alpha1.SAMLIdentityProvider{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeSAMLIdentityProviders) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(samlidentityprovidersResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.SAMLIdentityProviderList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched sAMLIdentityProvider.
+func (c *FakeSAMLIdentityProviders) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(samlidentityprovidersResource, c.ns, name, pt, data, subresources...), &v1alpha1.SAMLIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.SAMLIdentityProvider), err
+}
@@ -0,0 +1,182 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "go.pinniped.dev/generated/1.18/apis/supervisor/idp/v1alpha1"
+	scheme "go.pinniped.dev/generated/1.18/client/supervisor/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// SAMLIdentityProvidersGetter has a method to return a SAMLIdentityProviderInterface.
+// A group's client should implement this interface.
+type SAMLIdentityProvidersGetter interface {
+	SAMLIdentityProviders(namespace string) SAMLIdentityProviderInterface
+}
+
+// SAMLIdentityProviderInterface has methods to work with SAMLIdentityProvider resources.
+type SAMLIdentityProviderInterface interface {
+	Create(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.CreateOptions) (*v1alpha1.SAMLIdentityProvider, error)
+	Update(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.UpdateOptions) (*v1alpha1.SAMLIdentityProvider, error)
+	UpdateStatus(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.UpdateOptions) (*v1alpha1.SAMLIdentityProvider, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.SAMLIdentityProvider, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.SAMLIdentityProviderList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.SAMLIdentityProvider, err error)
+	SAMLIdentityProviderExpansion
+}
+
+// sAMLIdentityProviders implements SAMLIdentityProviderInterface
+type sAMLIdentityProviders struct {
+	client rest.Interface
+	ns     string
+}
+
+// newSAMLIdentityProviders returns a SAMLIdentityProviders
+func newSAMLIdentityProviders(c *IDPV1alpha1Client, namespace string) *sAMLIdentityProviders {
+	return &sAMLIdentityProviders{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the sAMLIdentityProvider, and returns the corresponding sAMLIdentityProvider object, and an error if there is any.
+func (c *sAMLIdentityProviders) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	result = &v1alpha1.SAMLIdentityProvider{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of SAMLIdentityProviders that match those selectors.
+func (c *sAMLIdentityProviders) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.SAMLIdentityProviderList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.SAMLIdentityProviderList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested sAMLIdentityProviders.
+func (c *sAMLIdentityProviders) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a sAMLIdentityProvider and creates it.  Returns the server's representation of the sAMLIdentityProvider, and an error, if there is any.
+func (c *sAMLIdentityProviders) Create(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.CreateOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	result = &v1alpha1.SAMLIdentityProvider{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(sAMLIdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a sAMLIdentityProvider and updates it. Returns the server's representation of the sAMLIdentityProvider, and an error, if there is any.
+func (c *sAMLIdentityProviders) Update(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	result = &v1alpha1.SAMLIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		Name(sAMLIdentityProvider.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(sAMLIdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *sAMLIdentityProviders) UpdateStatus(ctx context.Context, sAMLIdentityProvider *v1alpha1.SAMLIdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	result = &v1alpha1.SAMLIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		Name(sAMLIdentityProvider.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(sAMLIdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the sAMLIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *sAMLIdentityProviders) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *sAMLIdentityProviders) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched sAMLIdentityProvider.
+func (c *sAMLIdentityProviders) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.SAMLIdentityProvider, err error) {
+	result = &v1alpha1.SAMLIdentityProvider{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("samlidentityproviders").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
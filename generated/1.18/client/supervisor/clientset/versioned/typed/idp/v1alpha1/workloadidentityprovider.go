@@ -0,0 +1,182 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "go.pinniped.dev/generated/1.18/apis/supervisor/idp/v1alpha1"
+	scheme "go.pinniped.dev/generated/1.18/client/supervisor/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// WorkloadIdentityProvidersGetter has a method to return a WorkloadIdentityProviderInterface.
+// A group's client should implement this interface.
+type WorkloadIdentityProvidersGetter interface {
+	WorkloadIdentityProviders(namespace string) WorkloadIdentityProviderInterface
+}
+
+// WorkloadIdentityProviderInterface has methods to work with WorkloadIdentityProvider resources.
+type WorkloadIdentityProviderInterface interface {
+	Create(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.CreateOptions) (*v1alpha1.WorkloadIdentityProvider, error)
+	Update(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.UpdateOptions) (*v1alpha1.WorkloadIdentityProvider, error)
+	UpdateStatus(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.UpdateOptions) (*v1alpha1.WorkloadIdentityProvider, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.WorkloadIdentityProvider, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.WorkloadIdentityProviderList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.WorkloadIdentityProvider, err error)
+	WorkloadIdentityProviderExpansion
+}
+
+// workloadIdentityProviders implements WorkloadIdentityProviderInterface
+type workloadIdentityProviders struct {
+	client rest.Interface
+	ns     string
+}
+
+// newWorkloadIdentityProviders returns a WorkloadIdentityProviders
+func newWorkloadIdentityProviders(c *IDPV1alpha1Client, namespace string) *workloadIdentityProviders {
+	return &workloadIdentityProviders{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the workloadIdentityProvider, and returns the corresponding workloadIdentityProvider object, and an error if there is any.
+func (c *workloadIdentityProviders) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of WorkloadIdentityProviders that match those selectors.
+func (c *workloadIdentityProviders) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.WorkloadIdentityProviderList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.WorkloadIdentityProviderList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested workloadIdentityProviders.
+func (c *workloadIdentityProviders) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a workloadIdentityProvider and creates it.  Returns the server's representation of the workloadIdentityProvider, and an error, if there is any.
+func (c *workloadIdentityProviders) Create(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.CreateOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(workloadIdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a workloadIdentityProvider and updates it. Returns the server's representation of the workloadIdentityProvider, and an error, if there is any.
+func (c *workloadIdentityProviders) Update(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(workloadIdentityProvider.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(workloadIdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *workloadIdentityProviders) UpdateStatus(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(workloadIdentityProvider.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(workloadIdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the workloadIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *workloadIdentityProviders) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *workloadIdentityProviders) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched workloadIdentityProvider.
+func (c *workloadIdentityProviders) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	result = &v1alpha1.WorkloadIdentityProvider{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("workloadidentityproviders").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -13,6 +13,14 @@ type ActiveDirectoryIdentityProviderListerExpansion interface{}
 // ActiveDirectoryIdentityProviderNamespaceLister.
 type ActiveDirectoryIdentityProviderNamespaceListerExpansion interface{}
 
+// GitHubIdentityProviderListerExpansion allows custom methods to be added to
+// GitHubIdentityProviderLister.
+type GitHubIdentityProviderListerExpansion interface{}
+
+// GitHubIdentityProviderNamespaceListerExpansion allows custom methods to be added to
+// GitHubIdentityProviderNamespaceLister.
+type GitHubIdentityProviderNamespaceListerExpansion interface{}
+
 // LDAPIdentityProviderListerExpansion allows custom methods to be added to
 // LDAPIdentityProviderLister.
 type LDAPIdentityProviderListerExpansion interface{}
@@ -21,6 +29,22 @@ type LDAPIdentityProviderListerExpansion interface{}
 // LDAPIdentityProviderNamespaceLister.
 type LDAPIdentityProviderNamespaceListerExpansion interface{}
 
+// LocalIdentityProviderListerExpansion allows custom methods to be added to
+// LocalIdentityProviderLister.
+type LocalIdentityProviderListerExpansion interface{}
+
+// LocalIdentityProviderNamespaceListerExpansion allows custom methods to be added to
+// LocalIdentityProviderNamespaceLister.
+type LocalIdentityProviderNamespaceListerExpansion interface{}
+
+// OAuth2IdentityProviderListerExpansion allows custom methods to be added to
+// OAuth2IdentityProviderLister.
+type OAuth2IdentityProviderListerExpansion interface{}
+
+// OAuth2IdentityProviderNamespaceListerExpansion allows custom methods to be added to
+// OAuth2IdentityProviderNamespaceLister.
+type OAuth2IdentityProviderNamespaceListerExpansion interface{}
+
 // OIDCIdentityProviderListerExpansion allows custom methods to be added to
 // OIDCIdentityProviderLister.
 type OIDCIdentityProviderListerExpansion interface{}
@@ -28,3 +52,27 @@ type OIDCIdentityProviderListerExpansion interface{}
 // OIDCIdentityProviderNamespaceListerExpansion allows custom methods to be added to
 // OIDCIdentityProviderNamespaceLister.
 type OIDCIdentityProviderNamespaceListerExpansion interface{}
+
+// SAMLIdentityProviderListerExpansion allows custom methods to be added to
+// SAMLIdentityProviderLister.
+type SAMLIdentityProviderListerExpansion interface{}
+
+// SAMLIdentityProviderNamespaceListerExpansion allows custom methods to be added to
+// SAMLIdentityProviderNamespaceLister.
+type SAMLIdentityProviderNamespaceListerExpansion interface{}
+
+// WebhookIdentityProviderListerExpansion allows custom methods to be added to
+// WebhookIdentityProviderLister.
+type WebhookIdentityProviderListerExpansion interface{}
+
+// WebhookIdentityProviderNamespaceListerExpansion allows custom methods to be added to
+// WebhookIdentityProviderNamespaceLister.
+type WebhookIdentityProviderNamespaceListerExpansion interface{}
+
+// WorkloadIdentityProviderListerExpansion allows custom methods to be added to
+// WorkloadIdentityProviderLister.
+type WorkloadIdentityProviderListerExpansion interface{}
+
+// WorkloadIdentityProviderNamespaceListerExpansion allows custom methods to be added to
+// WorkloadIdentityProviderNamespaceLister.
+type WorkloadIdentityProviderNamespaceListerExpansion interface{}
@@ -0,0 +1,81 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "go.pinniped.dev/generated/1.18/apis/supervisor/idp/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// WorkloadIdentityProviderLister helps list WorkloadIdentityProviders.
+type WorkloadIdentityProviderLister interface {
+	// List lists all WorkloadIdentityProviders in the indexer.
+	List(selector labels.Selector) (ret []*v1alpha1.WorkloadIdentityProvider, err error)
+	// WorkloadIdentityProviders returns an object that can list and get WorkloadIdentityProviders.
+	WorkloadIdentityProviders(namespace string) WorkloadIdentityProviderNamespaceLister
+	WorkloadIdentityProviderListerExpansion
+}
+
+// workloadIdentityProviderLister implements the WorkloadIdentityProviderLister interface.
+type workloadIdentityProviderLister struct {
+	indexer cache.Indexer
+}
+
+// NewWorkloadIdentityProviderLister returns a new WorkloadIdentityProviderLister.
+func NewWorkloadIdentityProviderLister(indexer cache.Indexer) WorkloadIdentityProviderLister {
+	return &workloadIdentityProviderLister{indexer: indexer}
+}
+
+// List lists all WorkloadIdentityProviders in the indexer.
+func (s *workloadIdentityProviderLister) List(selector labels.Selector) (ret []*v1alpha1.WorkloadIdentityProvider, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.WorkloadIdentityProvider))
+	})
+	return ret, err
+}
+
+// WorkloadIdentityProviders returns an object that can list and get WorkloadIdentityProviders.
+func (s *workloadIdentityProviderLister) WorkloadIdentityProviders(namespace string) WorkloadIdentityProviderNamespaceLister {
+	return workloadIdentityProviderNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// WorkloadIdentityProviderNamespaceLister helps list and get WorkloadIdentityProviders.
+type WorkloadIdentityProviderNamespaceLister interface {
+	// List lists all WorkloadIdentityProviders in the indexer for a given namespace.
+	List(selector labels.Selector) (ret []*v1alpha1.WorkloadIdentityProvider, err error)
+	// Get retrieves the WorkloadIdentityProvider from the indexer for a given namespace and name.
+	Get(name string) (*v1alpha1.WorkloadIdentityProvider, error)
+	WorkloadIdentityProviderNamespaceListerExpansion
+}
+
+// workloadIdentityProviderNamespaceLister implements the WorkloadIdentityProviderNamespaceLister
+// interface.
+type workloadIdentityProviderNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all WorkloadIdentityProviders in the indexer for a given namespace.
+func (s workloadIdentityProviderNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.WorkloadIdentityProvider, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.WorkloadIdentityProvider))
+	})
+	return ret, err
+}
+
+// Get retrieves the WorkloadIdentityProvider from the indexer for a given namespace and name.
+func (s workloadIdentityProviderNamespaceLister) Get(name string) (*v1alpha1.WorkloadIdentityProvider, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("workloadidentityprovider"), name)
+	}
+	return obj.(*v1alpha1.WorkloadIdentityProvider), nil
+}
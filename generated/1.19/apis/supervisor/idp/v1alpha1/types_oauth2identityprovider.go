@@ -0,0 +1,161 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type OAuth2IdentityProviderPhase string
+
+const (
+	// OAuth2PhasePending is the default phase for newly-created OAuth2IdentityProvider resources.
+	OAuth2PhasePending OAuth2IdentityProviderPhase = "Pending"
+
+	// OAuth2PhaseReady is the phase for an OAuth2IdentityProvider resource in a healthy state.
+	OAuth2PhaseReady OAuth2IdentityProviderPhase = "Ready"
+
+	// OAuth2PhaseError is the phase for an OAuth2IdentityProvider in an unhealthy state.
+	OAuth2PhaseError OAuth2IdentityProviderPhase = "Error"
+)
+
+// OAuth2IdentityProviderStatus is the status of an OAuth2 identity provider.
+type OAuth2IdentityProviderStatus struct {
+	// Phase summarizes the overall status of the OAuth2IdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase OAuth2IdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// OAuth2Endpoints are the endpoints of an OAuth2 identity provider.
+type OAuth2Endpoints struct {
+	// AuthorizationURL is the URL of the authorization endpoint of the OAuth2 identity provider
+	// (see https://datatracker.ietf.org/doc/html/rfc6749#section-3.1).
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^https://`
+	AuthorizationURL string `json:"authorizationURL"`
+
+	// TokenURL is the URL of the token endpoint of the OAuth2 identity provider
+	// (see https://datatracker.ietf.org/doc/html/rfc6749#section-3.2).
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^https://`
+	TokenURL string `json:"tokenURL"`
+
+	// ProfileURL is the URL of an API endpoint of the OAuth2 identity provider which returns a JSON object describing
+	// the user who owns the access token, e.g. "https://api.example.com/v1/me". The Supervisor will send a GET request
+	// to this URL with the access token in the "Authorization" header as a bearer token.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^https://`
+	ProfileURL string `json:"profileURL"`
+}
+
+// OAuth2AuthorizationConfig provides information about how to form the OAuth2 authorization request parameters.
+type OAuth2AuthorizationConfig struct {
+	// Scopes are the scopes that will be requested from your OAuth2 provider in the authorization request. These
+	// should include any scopes which are required to read the user's profile, and the scope which is required to
+	// receive a refresh token, if your OAuth2 provider uses one. By default, no scopes are requested.
+	// +optional
+	Scopes []string `json:"scopes,omitempty"`
+
+	// AdditionalAuthorizeParameters are extra query parameters that should be included in the authorize request to
+	// your OAuth2 provider. By default, no extra parameters are sent. The standard parameters that will be sent are
+	// "response_type", "scope", "client_id", "state", "code_challenge", "code_challenge_method", and "redirect_uri".
+	// These parameters cannot be included in this setting.
+	// +optional
+	// +patchMergeKey=name
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=name
+	AdditionalAuthorizeParameters []Parameter `json:"additionalAuthorizeParameters,omitempty"`
+}
+
+// OAuth2Claims provides a mapping from the JSON profile of the user into identities. Each setting is a JSONPath
+// expression (see https://kubernetes.io/docs/reference/kubectl/jsonpath/) which is evaluated against the response
+// of the profile endpoint, e.g. "{.data.login}".
+type OAuth2Claims struct {
+	// Username is the JSONPath expression which will be used to ascertain an identity's username. The expression
+	// must select exactly one non-empty string or number.
+	// +kubebuilder:validation:MinLength=1
+	Username string `json:"username"`
+
+	// Groups is the JSONPath expression which will be used to ascertain the groups to which an identity belongs,
+	// e.g. "{.teams[*].name}". The expression must select strings, or lists of strings. By default, the identities
+	// will not include any group memberships when this setting is not configured.
+	// +optional
+	Groups string `json:"groups,omitempty"`
+
+	// UserID is the JSONPath expression which will be used to ascertain an identifier of the user which is unique
+	// and which never changes, e.g. "{.id}". It will become part of the subject of the downstream ID tokens. The
+	// expression must select exactly one non-empty string or number. Defaults to the username expression, which is
+	// only appropriate when your OAuth2 provider does not allow usernames to change or to be reused.
+	// +optional
+	UserID string `json:"userID,omitempty"`
+}
+
+// OAuth2Client contains information about an OAuth2 client (e.g., client ID and client secret).
+type OAuth2Client struct {
+	// SecretName contains the name of a namespace-local Secret object that provides the clientID and
+	// clientSecret for an OAuth2 client. The Secret must be of type "secrets.pinniped.dev/oauth2-client"
+	// with keys "clientID" and "clientSecret".
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+}
+
+// OAuth2IdentityProviderSpec is the spec for configuring an OAuth2 identity provider.
+type OAuth2IdentityProviderSpec struct {
+	// Endpoints are the endpoints of the OAuth2 identity provider.
+	Endpoints OAuth2Endpoints `json:"endpoints"`
+
+	// TLS configuration for requests to the token and profile endpoints.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// AuthorizationConfig holds information about how to form the OAuth2 authorization request
+	// parameters to be used with this OAuth2 identity provider.
+	// +optional
+	AuthorizationConfig OAuth2AuthorizationConfig `json:"authorizationConfig,omitempty"`
+
+	// Claims provides the JSONPath expressions that will be used to read an identity from the profile of the user.
+	Claims OAuth2Claims `json:"claims"`
+
+	// Client contains OAuth2 client information to be used with this OAuth2 identity provider. Its redirect URI
+	// must be set to the callback endpoint of the FederationDomain, e.g. "https://example.com/issuer/callback".
+	Client OAuth2Client `json:"client"`
+}
+
+// OAuth2IdentityProvider describes the configuration of an upstream OAuth 2.0 identity provider which does not
+// support OpenID Connect, but which offers an API endpoint to look up the profile of the user.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Authorization URL",type=string,JSONPath=`.spec.endpoints.authorizationURL`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type OAuth2IdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec OAuth2IdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status OAuth2IdentityProviderStatus `json:"status,omitempty"`
+}
+
+// OAuth2IdentityProviderList lists OAuth2IdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type OAuth2IdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []OAuth2IdentityProvider `json:"items"`
+}
@@ -0,0 +1,129 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "go.pinniped.dev/generated/1.19/apis/supervisor/idp/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeOAuth2IdentityProviders implements OAuth2IdentityProviderInterface
+type FakeOAuth2IdentityProviders struct {
+	Fake *FakeIDPV1alpha1
+	ns   string
+}
+
+var oauth2identityprovidersResource = schema.GroupVersionResource{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Resource: "oauth2identityproviders"}
+
+var oauth2identityprovidersKind = schema.GroupVersionKind{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Kind: "OAuth2IdentityProvider"}
+
+// Get takes name of the oAuth2IdentityProvider, and returns the corresponding oAuth2IdentityProvider object, and an error if there is any.
+func (c *FakeOAuth2IdentityProviders) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(oauth2identityprovidersResource, c.ns, name), &v1alpha1.OAuth2IdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OAuth2IdentityProvider), err
+}
+
+// List takes label and field selectors, and returns the list of OAuth2IdentityProviders that match those selectors.
+func (c *FakeOAuth2IdentityProviders) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.OAuth2IdentityProviderList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(oauth2identityprovidersResource, oauth2identityprovidersKind, c.ns, opts), &v1alpha1.OAuth2IdentityProviderList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.OAuth2IdentityProviderList{ListMeta: obj.(*v1alpha1.OAuth2IdentityProviderList).ListMeta}
+	for _, item := range obj.(*v1alpha1.OAuth2IdentityProviderList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested oAuth2IdentityProviders.
+func (c *FakeOAuth2IdentityProviders) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(oauth2identityprovidersResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a oAuth2IdentityProvider and creates it.  Returns the server's representation of the oAuth2IdentityProvider, and an error, if there is any.
+func (c *FakeOAuth2IdentityProviders) Create(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.CreateOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(oauth2identityprovidersResource, c.ns, oAuth2IdentityProvider), &v1alpha1.OAuth2IdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OAuth2IdentityProvider), err
+}
+
+// Update takes the representation of a oAuth2IdentityProvider and updates it. Returns the server's representation of the oAuth2IdentityProvider, and an error, if there is any.
+func (c *FakeOAuth2IdentityProviders) Update(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(oauth2identityprovidersResource, c.ns, oAuth2IdentityProvider), &v1alpha1.OAuth2IdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OAuth2IdentityProvider), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeOAuth2IdentityProviders) UpdateStatus(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.UpdateOptions) (*v1alpha1.OAuth2IdentityProvider, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(oauth2identityprovidersResource, "status", c.ns, oAuth2IdentityProvider), &v1alpha1.OAuth2IdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OAuth2IdentityProvider), err
+}
+
+// Delete takes name of the oAuth2IdentityProvider and deletes it. Returns an error if one occurs.
+func (c *FakeOAuth2IdentityProviders) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(oauth2identityprovidersResource, c.ns, name), &v1alpha1.OAuth2IdentityProvider{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeOAuth2IdentityProviders) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(oauth2identityprovidersResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.OAuth2IdentityProviderList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched oAuth2IdentityProvider.
+func (c *FakeOAuth2IdentityProviders) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(oauth2identityprovidersResource, c.ns, name, pt, data, subresources...), &v1alpha1.OAuth2IdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.OAuth2IdentityProvider), err
+}
@@ -0,0 +1,129 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "go.pinniped.dev/generated/1.19/apis/supervisor/idp/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeWorkloadIdentityProviders implements WorkloadIdentityProviderInterface
+type FakeWorkloadIdentityProviders struct {
+	Fake *FakeIDPV1alpha1
+	ns   string
+}
+
+var workloadidentityprovidersResource = schema.GroupVersionResource{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Resource: "workloadidentityproviders"}
+
+var workloadidentityprovidersKind = schema.GroupVersionKind{Group: "idp.supervisor.pinniped.dev", Version: "v1alpha1", Kind: "WorkloadIdentityProvider"}
+
+// Get takes name of the workloadIdentityProvider, and returns the corresponding workloadIdentityProvider object, and an error if there is any.
+func (c *FakeWorkloadIdentityProviders) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(workloadidentityprovidersResource, c.ns, name), &v1alpha1.WorkloadIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.WorkloadIdentityProvider), err
+}
+
+// List takes label and field selectors, and returns the list of WorkloadIdentityProviders that match those selectors.
+func (c *FakeWorkloadIdentityProviders) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.WorkloadIdentityProviderList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(workloadidentityprovidersResource, workloadidentityprovidersKind, c.ns, opts), &v1alpha1.WorkloadIdentityProviderList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.WorkloadIdentityProviderList{ListMeta: obj.(*v1alpha1.WorkloadIdentityProviderList).ListMeta}
+	for _, item := range obj.(*v1alpha1.WorkloadIdentityProviderList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested workloadIdentityProviders.
+func (c *FakeWorkloadIdentityProviders) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(workloadidentityprovidersResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a workloadIdentityProvider and creates it.  Returns the server's representation of the workloadIdentityProvider, and an error, if there is any.
+func (c *FakeWorkloadIdentityProviders) Create(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.CreateOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(workloadidentityprovidersResource, c.ns, workloadIdentityProvider), &v1alpha1.WorkloadIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.WorkloadIdentityProvider), err
+}
+
+// Update takes the representation of a workloadIdentityProvider and updates it. Returns the server's representation of the workloadIdentityProvider, and an error, if there is any.
+func (c *FakeWorkloadIdentityProviders) Update(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(workloadidentityprovidersResource, c.ns, workloadIdentityProvider), &v1alpha1.WorkloadIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.WorkloadIdentityProvider), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeWorkloadIdentityProviders) UpdateStatus(ctx context.Context, workloadIdentityProvider *v1alpha1.WorkloadIdentityProvider, opts v1.UpdateOptions) (*v1alpha1.WorkloadIdentityProvider, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(workloadidentityprovidersResource, "status", c.ns, workloadIdentityProvider), &v1alpha1.WorkloadIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.WorkloadIdentityProvider), err
+}
+
+// Delete takes name of the workloadIdentityProvider and deletes it. Returns an error if one occurs.
+func (c *FakeWorkloadIdentityProviders) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(workloadidentityprovidersResource, c.ns, name), &v1alpha1.WorkloadIdentityProvider{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeWorkloadIdentityProviders) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(workloadidentityprovidersResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.WorkloadIdentityProviderList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched workloadIdentityProvider.
+func (c *FakeWorkloadIdentityProviders) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.WorkloadIdentityProvider, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(workloadidentityprovidersResource, c.ns, name, pt, data, subresources...), &v1alpha1.WorkloadIdentityProvider{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.WorkloadIdentityProvider), err
+}
@@ -0,0 +1,182 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "go.pinniped.dev/generated/1.19/apis/supervisor/idp/v1alpha1"
+	scheme "go.pinniped.dev/generated/1.19/client/supervisor/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// OAuth2IdentityProvidersGetter has a method to return a OAuth2IdentityProviderInterface.
+// A group's client should implement this interface.
+type OAuth2IdentityProvidersGetter interface {
+	OAuth2IdentityProviders(namespace string) OAuth2IdentityProviderInterface
+}
+
+// OAuth2IdentityProviderInterface has methods to work with OAuth2IdentityProvider resources.
+type OAuth2IdentityProviderInterface interface {
+	Create(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.CreateOptions) (*v1alpha1.OAuth2IdentityProvider, error)
+	Update(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.UpdateOptions) (*v1alpha1.OAuth2IdentityProvider, error)
+	UpdateStatus(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.UpdateOptions) (*v1alpha1.OAuth2IdentityProvider, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.OAuth2IdentityProvider, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.OAuth2IdentityProviderList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.OAuth2IdentityProvider, err error)
+	OAuth2IdentityProviderExpansion
+}
+
+// oAuth2IdentityProviders implements OAuth2IdentityProviderInterface
+type oAuth2IdentityProviders struct {
+	client rest.Interface
+	ns     string
+}
+
+// newOAuth2IdentityProviders returns a OAuth2IdentityProviders
+func newOAuth2IdentityProviders(c *IDPV1alpha1Client, namespace string) *oAuth2IdentityProviders {
+	return &oAuth2IdentityProviders{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the oAuth2IdentityProvider, and returns the corresponding oAuth2IdentityProvider object, and an error if there is any.
+func (c *oAuth2IdentityProviders) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of OAuth2IdentityProviders that match those selectors.
+func (c *oAuth2IdentityProviders) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.OAuth2IdentityProviderList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.OAuth2IdentityProviderList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested oAuth2IdentityProviders.
+func (c *oAuth2IdentityProviders) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a oAuth2IdentityProvider and creates it.  Returns the server's representation of the oAuth2IdentityProvider, and an error, if there is any.
+func (c *oAuth2IdentityProviders) Create(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.CreateOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(oAuth2IdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a oAuth2IdentityProvider and updates it. Returns the server's representation of the oAuth2IdentityProvider, and an error, if there is any.
+func (c *oAuth2IdentityProviders) Update(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(oAuth2IdentityProvider.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(oAuth2IdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *oAuth2IdentityProviders) UpdateStatus(ctx context.Context, oAuth2IdentityProvider *v1alpha1.OAuth2IdentityProvider, opts v1.UpdateOptions) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(oAuth2IdentityProvider.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(oAuth2IdentityProvider).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the oAuth2IdentityProvider and deletes it. Returns an error if one occurs.
+func (c *oAuth2IdentityProviders) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *oAuth2IdentityProviders) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched oAuth2IdentityProvider.
+func (c *oAuth2IdentityProviders) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.OAuth2IdentityProvider, err error) {
+	result = &v1alpha1.OAuth2IdentityProvider{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("oauth2identityproviders").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
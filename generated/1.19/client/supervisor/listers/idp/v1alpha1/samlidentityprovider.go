@@ -0,0 +1,86 @@
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "go.pinniped.dev/generated/1.19/apis/supervisor/idp/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// SAMLIdentityProviderLister helps list SAMLIdentityProviders.
+// All objects returned here must be treated as read-only.
+type SAMLIdentityProviderLister interface {
+	// List lists all SAMLIdentityProviders in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1alpha1.SAMLIdentityProvider, err error)
+	// SAMLIdentityProviders returns an object that can list and get SAMLIdentityProviders.
+	SAMLIdentityProviders(namespace string) SAMLIdentityProviderNamespaceLister
+	SAMLIdentityProviderListerExpansion
+}
+
+// sAMLIdentityProviderLister implements the SAMLIdentityProviderLister interface.
+type sAMLIdentityProviderLister struct {
+	indexer cache.Indexer
+}
+
+// NewSAMLIdentityProviderLister returns a new SAMLIdentityProviderLister.
+func NewSAMLIdentityProviderLister(indexer cache.Indexer) SAMLIdentityProviderLister {
+	return &sAMLIdentityProviderLister{indexer: indexer}
+}
+
+// List lists all SAMLIdentityProviders in the indexer.
+func (s *sAMLIdentityProviderLister) List(selector labels.Selector) (ret []*v1alpha1.SAMLIdentityProvider, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.SAMLIdentityProvider))
+	})
+	return ret, err
+}
+
+// SAMLIdentityProviders returns an object that can list and get SAMLIdentityProviders.
+func (s *sAMLIdentityProviderLister) SAMLIdentityProviders(namespace string) SAMLIdentityProviderNamespaceLister {
+	return sAMLIdentityProviderNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// SAMLIdentityProviderNamespaceLister helps list and get SAMLIdentityProviders.
+// All objects returned here must be treated as read-only.
+type SAMLIdentityProviderNamespaceLister interface {
+	// List lists all SAMLIdentityProviders in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1alpha1.SAMLIdentityProvider, err error)
+	// Get retrieves the SAMLIdentityProvider from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1alpha1.SAMLIdentityProvider, error)
+	SAMLIdentityProviderNamespaceListerExpansion
+}
+
+// sAMLIdentityProviderNamespaceLister implements the SAMLIdentityProviderNamespaceLister
+// interface.
+type sAMLIdentityProviderNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all SAMLIdentityProviders in the indexer for a given namespace.
+func (s sAMLIdentityProviderNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.SAMLIdentityProvider, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.SAMLIdentityProvider))
+	})
+	return ret, err
+}
+
+// Get retrieves the SAMLIdentityProvider from the indexer for a given namespace and name.
+func (s sAMLIdentityProviderNamespaceLister) Get(name string) (*v1alpha1.SAMLIdentityProvider, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("samlidentityprovider"), name)
+	}
+	return obj.(*v1alpha1.SAMLIdentityProvider), nil
+}
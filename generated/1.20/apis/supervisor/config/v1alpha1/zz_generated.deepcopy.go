@@ -40,6 +40,22 @@ func (in *FederationDomain) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationDomainBrandingSpec) DeepCopyInto(out *FederationDomainBrandingSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationDomainBrandingSpec.
+func (in *FederationDomainBrandingSpec) DeepCopy() *FederationDomainBrandingSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationDomainBrandingSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FederationDomainList) DeepCopyInto(out *FederationDomainList) {
 	*out = *in
@@ -93,6 +109,27 @@ func (in *FederationDomainSecrets) DeepCopy() *FederationDomainSecrets {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationDomainSecurityHeadersSpec) DeepCopyInto(out *FederationDomainSecurityHeadersSpec) {
+	*out = *in
+	if in.StrictTransportSecurity != nil {
+		in, out := &in.StrictTransportSecurity, &out.StrictTransportSecurity
+		*out = new(FederationDomainStrictTransportSecuritySpec)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationDomainSecurityHeadersSpec.
+func (in *FederationDomainSecurityHeadersSpec) DeepCopy() *FederationDomainSecurityHeadersSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationDomainSecurityHeadersSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FederationDomainSpec) DeepCopyInto(out *FederationDomainSpec) {
 	*out = *in
@@ -101,6 +138,21 @@ func (in *FederationDomainSpec) DeepCopyInto(out *FederationDomainSpec) {
 		*out = new(FederationDomainTLSSpec)
 		**out = **in
 	}
+	if in.Branding != nil {
+		in, out := &in.Branding, &out.Branding
+		*out = new(FederationDomainBrandingSpec)
+		**out = **in
+	}
+	if in.SecurityHeaders != nil {
+		in, out := &in.SecurityHeaders, &out.SecurityHeaders
+		*out = new(FederationDomainSecurityHeadersSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tokens != nil {
+		in, out := &in.Tokens, &out.Tokens
+		*out = new(FederationDomainTokensSpec)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -135,6 +187,22 @@ func (in *FederationDomainStatus) DeepCopy() *FederationDomainStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationDomainStrictTransportSecuritySpec) DeepCopyInto(out *FederationDomainStrictTransportSecuritySpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationDomainStrictTransportSecuritySpec.
+func (in *FederationDomainStrictTransportSecuritySpec) DeepCopy() *FederationDomainStrictTransportSecuritySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationDomainStrictTransportSecuritySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FederationDomainTLSSpec) DeepCopyInto(out *FederationDomainTLSSpec) {
 	*out = *in
@@ -150,3 +218,68 @@ func (in *FederationDomainTLSSpec) DeepCopy() *FederationDomainTLSSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationDomainTokenExchangeClientSpec) DeepCopyInto(out *FederationDomainTokenExchangeClientSpec) {
+	*out = *in
+	if in.AllowedAudiences != nil {
+		in, out := &in.AllowedAudiences, &out.AllowedAudiences
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationDomainTokenExchangeClientSpec.
+func (in *FederationDomainTokenExchangeClientSpec) DeepCopy() *FederationDomainTokenExchangeClientSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationDomainTokenExchangeClientSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationDomainTokenExchangeSpec) DeepCopyInto(out *FederationDomainTokenExchangeSpec) {
+	*out = *in
+	if in.Clients != nil {
+		in, out := &in.Clients, &out.Clients
+		*out = make([]FederationDomainTokenExchangeClientSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationDomainTokenExchangeSpec.
+func (in *FederationDomainTokenExchangeSpec) DeepCopy() *FederationDomainTokenExchangeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationDomainTokenExchangeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FederationDomainTokensSpec) DeepCopyInto(out *FederationDomainTokensSpec) {
+	*out = *in
+	if in.TokenExchange != nil {
+		in, out := &in.TokenExchange, &out.TokenExchange
+		*out = new(FederationDomainTokenExchangeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FederationDomainTokensSpec.
+func (in *FederationDomainTokensSpec) DeepCopy() *FederationDomainTokensSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(FederationDomainTokensSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -35,6 +35,12 @@ type JWTAuthenticatorSpec struct {
 	// TLS configuration for communicating with the OIDC provider.
 	// +optional
 	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// Proxy configures an HTTP proxy for all requests to the OIDC provider, including discovery and JWKS requests.
+	// By default, the proxy settings from the Concierge's environment variables (HTTPS_PROXY, HTTP_PROXY and NO_PROXY)
+	// will be used.
+	// +optional
+	Proxy *ProxySpec `json:"proxy,omitempty"`
 }
 
 // JWTTokenClaims allows customization of the claims that will be mapped to user identity
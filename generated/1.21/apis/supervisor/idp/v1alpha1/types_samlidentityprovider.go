@@ -0,0 +1,129 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type SAMLIdentityProviderPhase string
+
+const (
+	// SAMLPhasePending is the default phase for newly-created SAMLIdentityProvider resources.
+	SAMLPhasePending SAMLIdentityProviderPhase = "Pending"
+
+	// SAMLPhaseReady is the phase for a SAMLIdentityProvider resource in a healthy state.
+	SAMLPhaseReady SAMLIdentityProviderPhase = "Ready"
+
+	// SAMLPhaseError is the phase for a SAMLIdentityProvider in an unhealthy state.
+	SAMLPhaseError SAMLIdentityProviderPhase = "Error"
+)
+
+// SAMLIdentityProviderStatus is the status of a SAML identity provider.
+type SAMLIdentityProviderStatus struct {
+	// Phase summarizes the overall status of the SAMLIdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase SAMLIdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// SAMLIDPMetadataSpec describes where to find the SAML metadata of the identity provider.
+// Exactly one of url or xml must be set.
+type SAMLIDPMetadataSpec struct {
+	// URL is the https URL from which the metadata of the identity provider can be downloaded.
+	// The metadata will be downloaded again periodically, so that the Supervisor notices when the identity
+	// provider rotates its signing certificates.
+	// +kubebuilder:validation:Pattern=`^https://`
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// XML is the metadata of the identity provider, as an XML document.
+	// +optional
+	XML string `json:"xml,omitempty"`
+
+	// TLS configuration for downloading the metadata from url.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+}
+
+// SAMLClaims provides a mapping from SAML assertion attributes to the username and groups claims.
+type SAMLClaims struct {
+	// Username is the name of the SAML attribute which will be used as the username of the user. The attribute
+	// must have exactly one value. The name of an attribute is matched against both its Name and its FriendlyName.
+	// When not set, the NameID of the subject of the assertion will be used as the username.
+	// +optional
+	Username string `json:"username,omitempty"`
+
+	// Groups is the name of the SAML attribute whose values will be used as the group memberships of the user.
+	// The name of an attribute is matched against both its Name and its FriendlyName.
+	// When not set, the user will not have any group memberships.
+	// +optional
+	Groups string `json:"groups,omitempty"`
+}
+
+// SAMLServiceProviderSpec configures the Supervisor in its role as a SAML service provider.
+type SAMLServiceProviderSpec struct {
+	// KeyPairSecretName is the name of a namespace-local Secret of type "kubernetes.io/tls" which contains an
+	// RSA private key and its certificate. When set, the Supervisor will use the private key to sign its
+	// authentication requests, and to decrypt encrypted assertions sent by the identity provider. The certificate
+	// should be registered with the identity provider as both the signing and encryption certificate of the
+	// service provider. When not set, authentication requests will not be signed, and the identity provider
+	// must not encrypt its assertions.
+	// +optional
+	KeyPairSecretName string `json:"keyPairSecretName,omitempty"`
+}
+
+// SAMLIdentityProviderSpec is the spec for configuring a SAML identity provider.
+//
+// The Supervisor acts as a SAML service provider. For each FederationDomain, the entity ID of the service provider
+// is the issuer of the FederationDomain, e.g. "https://example.com/issuer", and its assertion consumer service URL
+// uses the HTTP-POST binding at the "/saml/acs" path below the issuer, e.g. "https://example.com/issuer/saml/acs".
+type SAMLIdentityProviderSpec struct {
+	// IDPMetadata describes where to find the SAML metadata of the identity provider. The identity provider must
+	// offer a single sign-on service which uses the HTTP-Redirect binding.
+	IDPMetadata SAMLIDPMetadataSpec `json:"idpMetadata"`
+
+	// Claims provides a mapping from SAML assertion attributes to the username and groups claims.
+	// +optional
+	Claims SAMLClaims `json:"claims,omitempty"`
+
+	// ServiceProvider configures the Supervisor in its role as a SAML service provider.
+	// +optional
+	ServiceProvider SAMLServiceProviderSpec `json:"serviceProvider,omitempty"`
+}
+
+// SAMLIdentityProvider describes the configuration of an upstream SAML 2.0 identity provider.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Metadata URL",type=string,JSONPath=`.spec.idpMetadata.url`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type SAMLIdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec SAMLIdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status SAMLIdentityProviderStatus `json:"status,omitempty"`
+}
+
+// SAMLIdentityProviderList lists SAMLIdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type SAMLIdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []SAMLIdentityProvider `json:"items"`
+}
@@ -13,10 +13,22 @@ import (
 type Interface interface {
 	// ActiveDirectoryIdentityProviders returns a ActiveDirectoryIdentityProviderInformer.
 	ActiveDirectoryIdentityProviders() ActiveDirectoryIdentityProviderInformer
+	// GitHubIdentityProviders returns a GitHubIdentityProviderInformer.
+	GitHubIdentityProviders() GitHubIdentityProviderInformer
 	// LDAPIdentityProviders returns a LDAPIdentityProviderInformer.
 	LDAPIdentityProviders() LDAPIdentityProviderInformer
+	// LocalIdentityProviders returns a LocalIdentityProviderInformer.
+	LocalIdentityProviders() LocalIdentityProviderInformer
+	// OAuth2IdentityProviders returns a OAuth2IdentityProviderInformer.
+	OAuth2IdentityProviders() OAuth2IdentityProviderInformer
 	// OIDCIdentityProviders returns a OIDCIdentityProviderInformer.
 	OIDCIdentityProviders() OIDCIdentityProviderInformer
+	// SAMLIdentityProviders returns a SAMLIdentityProviderInformer.
+	SAMLIdentityProviders() SAMLIdentityProviderInformer
+	// WebhookIdentityProviders returns a WebhookIdentityProviderInformer.
+	WebhookIdentityProviders() WebhookIdentityProviderInformer
+	// WorkloadIdentityProviders returns a WorkloadIdentityProviderInformer.
+	WorkloadIdentityProviders() WorkloadIdentityProviderInformer
 }
 
 type version struct {
@@ -35,12 +47,42 @@ func (v *version) ActiveDirectoryIdentityProviders() ActiveDirectoryIdentityProv
 	return &activeDirectoryIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// GitHubIdentityProviders returns a GitHubIdentityProviderInformer.
+func (v *version) GitHubIdentityProviders() GitHubIdentityProviderInformer {
+	return &gitHubIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // LDAPIdentityProviders returns a LDAPIdentityProviderInformer.
 func (v *version) LDAPIdentityProviders() LDAPIdentityProviderInformer {
 	return &lDAPIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
 
+// LocalIdentityProviders returns a LocalIdentityProviderInformer.
+func (v *version) LocalIdentityProviders() LocalIdentityProviderInformer {
+	return &localIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// OAuth2IdentityProviders returns a OAuth2IdentityProviderInformer.
+func (v *version) OAuth2IdentityProviders() OAuth2IdentityProviderInformer {
+	return &oAuth2IdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
 // OIDCIdentityProviders returns a OIDCIdentityProviderInformer.
 func (v *version) OIDCIdentityProviders() OIDCIdentityProviderInformer {
 	return &oIDCIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
 }
+
+// SAMLIdentityProviders returns a SAMLIdentityProviderInformer.
+func (v *version) SAMLIdentityProviders() SAMLIdentityProviderInformer {
+	return &sAMLIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// WebhookIdentityProviders returns a WebhookIdentityProviderInformer.
+func (v *version) WebhookIdentityProviders() WebhookIdentityProviderInformer {
+	return &webhookIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
+
+// WorkloadIdentityProviders returns a WorkloadIdentityProviderInformer.
+func (v *version) WorkloadIdentityProviders() WorkloadIdentityProviderInformer {
+	return &workloadIdentityProviderInformer{factory: v.factory, namespace: v.namespace, tweakListOptions: v.tweakListOptions}
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type WebhookIdentityProviderPhase string
+
+const (
+	// WebhookPhasePending is the default phase for newly-created WebhookIdentityProvider resources.
+	WebhookPhasePending WebhookIdentityProviderPhase = "Pending"
+
+	// WebhookPhaseReady is the phase for a WebhookIdentityProvider resource in a healthy state.
+	WebhookPhaseReady WebhookIdentityProviderPhase = "Ready"
+
+	// WebhookPhaseError is the phase for a WebhookIdentityProvider in an unhealthy state.
+	WebhookPhaseError WebhookIdentityProviderPhase = "Error"
+)
+
+// WebhookIdentityProviderStatus is the status of a webhook identity provider.
+type WebhookIdentityProviderStatus struct {
+	// Phase summarizes the overall status of the WebhookIdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase WebhookIdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// WebhookClient contains information about how the Supervisor authenticates itself to the webhook.
+type WebhookClient struct {
+	// SecretName contains the name of a namespace-local Secret object that provides a bearer token which will be
+	// sent in the "Authorization" header of every request to the webhook. The Secret must be of type
+	// "secrets.pinniped.dev/webhook-client" with the key "token".
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+}
+
+// WebhookIdentityProviderSpec is the spec for configuring a webhook identity provider.
+type WebhookIdentityProviderSpec struct {
+	// Endpoint is the HTTPS URL of the webhook, e.g. "https://users.example.com/pinniped". The Supervisor sends a POST
+	// request with a JSON body to this URL to authenticate a user with their username and password, which looks like
+	// {"type": "authenticate", "username": "...", "password": "..."}, and to revalidate the user whenever their
+	// session is refreshed, which looks like {"type": "refresh", "username": "...", "uid": "..."}. When the user is
+	// valid, the webhook must respond with a status of 200 and a JSON body like {"authenticated": true, "user":
+	// {"username": "...", "uid": "...", "groups": ["..."]}}, where the uid is an identifier of the user which is unique
+	// and which never changes, and where the groups are optional. When the password is wrong, or when the user no
+	// longer exists or is no longer allowed to log in, the webhook must respond with a status of 200 and a JSON body
+	// like {"authenticated": false}. Any other response is treated as an error.
+	// +kubebuilder:validation:MinLength=1
+	// +kubebuilder:validation:Pattern=`^https://`
+	Endpoint string `json:"endpoint"`
+
+	// TLS configuration for requests to the webhook.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+
+	// Client contains information about how the Supervisor authenticates itself to the webhook. By default, no
+	// credentials are sent to the webhook, so the webhook should be protected by other means, e.g. network policies.
+	// +optional
+	Client *WebhookClient `json:"client,omitempty"`
+}
+
+// WebhookIdentityProvider describes the configuration of an upstream identity provider which validates usernames
+// and passwords using an HTTPS webhook, e.g. a user directory which is neither an LDAP server nor an OIDC provider.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Endpoint",type=string,JSONPath=`.spec.endpoint`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type WebhookIdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec WebhookIdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status WebhookIdentityProviderStatus `json:"status,omitempty"`
+}
+
+// WebhookIdentityProviderList lists WebhookIdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type WebhookIdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []WebhookIdentityProvider `json:"items"`
+}
@@ -36,6 +36,18 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&LDAPIdentityProviderList{},
 		&ActiveDirectoryIdentityProvider{},
 		&ActiveDirectoryIdentityProviderList{},
+		&GitHubIdentityProvider{},
+		&GitHubIdentityProviderList{},
+		&SAMLIdentityProvider{},
+		&SAMLIdentityProviderList{},
+		&OAuth2IdentityProvider{},
+		&OAuth2IdentityProviderList{},
+		&WebhookIdentityProvider{},
+		&WebhookIdentityProviderList{},
+		&LocalIdentityProvider{},
+		&LocalIdentityProviderList{},
+		&WorkloadIdentityProvider{},
+		&WorkloadIdentityProviderList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
@@ -15,9 +15,15 @@ const (
 	IDPTypeOIDC            IDPType = "oidc"
 	IDPTypeLDAP            IDPType = "ldap"
 	IDPTypeActiveDirectory IDPType = "activedirectory"
+	IDPTypeGitHub          IDPType = "github"
+	IDPTypeSAML            IDPType = "saml"
+	IDPTypeOAuth2          IDPType = "oauth2"
+	IDPTypeWebhook         IDPType = "webhook"
+	IDPTypeLocal           IDPType = "local"
 
 	IDPFlowCLIPassword     IDPFlow = "cli_password"
 	IDPFlowBrowserAuthcode IDPFlow = "browser_authcode"
+	IDPFlowCLIKerberos     IDPFlow = "cli_kerberos"
 )
 
 // Equals is a convenience function for comparing an IDPType to a string.
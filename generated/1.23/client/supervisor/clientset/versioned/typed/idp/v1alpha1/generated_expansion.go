@@ -7,6 +7,18 @@ package v1alpha1
 
 type ActiveDirectoryIdentityProviderExpansion interface{}
 
+type GitHubIdentityProviderExpansion interface{}
+
 type LDAPIdentityProviderExpansion interface{}
 
+type LocalIdentityProviderExpansion interface{}
+
+type OAuth2IdentityProviderExpansion interface{}
+
 type OIDCIdentityProviderExpansion interface{}
+
+type SAMLIdentityProviderExpansion interface{}
+
+type WebhookIdentityProviderExpansion interface{}
+
+type WorkloadIdentityProviderExpansion interface{}
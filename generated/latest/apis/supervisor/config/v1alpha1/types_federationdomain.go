@@ -42,6 +42,142 @@ type FederationDomainTLSSpec struct {
 	SecretName string `json:"secretName,omitempty"`
 }
 
+// FederationDomainBrandingSpec is a struct that describes how to customize the HTML pages which are shown to users
+// by an OIDC Provider.
+type FederationDomainBrandingSpec struct {
+	// ConfigMapName is the name of a ConfigMap in the same namespace which customizes the HTML pages which are shown
+	// to users during browser-based logins, such as the page shown after a successful login or after a login error.
+	// All keys of the ConfigMap are optional, and unknown keys are not allowed:
+	//
+	// - `style.css` is a stylesheet which is added to each page after the default styles.
+	//
+	// - `logo.png`, `logo.jpg` or `logo.svg` is an image which is shown at the top of each page. It may be provided
+	// in either the `data` or the `binaryData` of the ConfigMap. At most one logo may be provided.
+	//
+	// - `header.gohtml` and `footer.gohtml` are Go html/template fragments which are shown at the top and bottom of
+	// each page. They may use `{{ .LogoURL }}` as the source of an img element to show the logo. Only a limited set of
+	// formatting elements (such as div, span, p, a and img) and attributes (such as class and id) may be used.
+	// Scripts, styles and event handlers are not allowed. Links may only use https, http or mailto URLs.
+	//
+	// The Content-Security-Policy of the pages is not relaxed, so the stylesheet and fragments may not load any
+	// external resources.
+	// +kubebuilder:validation:MinLength=1
+	ConfigMapName string `json:"configMapName"`
+}
+
+// FederationDomainSecurityHeadersSpec is a struct that describes security-related response headers of an OIDC
+// Provider. Each field which is set overrides the corresponding setting in the securityHeaders section of the
+// Supervisor's configuration.
+type FederationDomainSecurityHeadersSpec struct {
+	// StrictTransportSecurity configures the Strict-Transport-Security (HSTS) header.
+	// +optional
+	StrictTransportSecurity *FederationDomainStrictTransportSecuritySpec `json:"strictTransportSecurity,omitempty"`
+
+	// ContentSecurityPolicy is sent as an additional Content-Security-Policy header. Browsers enforce every
+	// Content-Security-Policy header of a response, so this can only make the built-in policy of each endpoint
+	// stricter, e.g. by adding "upgrade-insecure-requests" or a "report-uri" directive.
+	// +optional
+	ContentSecurityPolicy string `json:"contentSecurityPolicy,omitempty"`
+
+	// PermissionsPolicy is the value of the Permissions-Policy header, e.g. "camera=(), microphone=()".
+	// +optional
+	PermissionsPolicy string `json:"permissionsPolicy,omitempty"`
+
+	// CrossOriginOpenerPolicy is the value of the Cross-Origin-Opener-Policy header.
+	// +kubebuilder:validation:Enum=unsafe-none;same-origin-allow-popups;same-origin
+	// +optional
+	CrossOriginOpenerPolicy string `json:"crossOriginOpenerPolicy,omitempty"`
+
+	// CrossOriginEmbedderPolicy is the value of the Cross-Origin-Embedder-Policy header.
+	// +kubebuilder:validation:Enum=unsafe-none;require-corp;credentialless
+	// +optional
+	CrossOriginEmbedderPolicy string `json:"crossOriginEmbedderPolicy,omitempty"`
+}
+
+// FederationDomainStrictTransportSecuritySpec is a struct that describes the Strict-Transport-Security header.
+type FederationDomainStrictTransportSecuritySpec struct {
+	// MaxAgeSeconds is how long browsers should only use HTTPS to connect to the issuer's host. Zero tells browsers
+	// to forget a previous Strict-Transport-Security header.
+	// +kubebuilder:validation:Minimum=0
+	MaxAgeSeconds int64 `json:"maxAgeSeconds"`
+
+	// IncludeSubDomains applies the header to all subdomains of the issuer's host too.
+	// +optional
+	IncludeSubDomains bool `json:"includeSubDomains,omitempty"`
+
+	// Preload allows the issuer's host to be included in the HSTS preload lists of browsers. It requires
+	// IncludeSubDomains and a MaxAgeSeconds of at least one year (31536000).
+	// +optional
+	Preload bool `json:"preload,omitempty"`
+}
+
+// FederationDomainCertificateBinding controls whether the tokens issued by an OIDC Provider are bound to the
+// TLS client certificate of the client.
+// +kubebuilder:validation:Enum=Disabled;Optional;Required
+type FederationDomainCertificateBinding string
+
+const (
+	DisabledFederationDomainCertificateBinding = FederationDomainCertificateBinding("Disabled")
+	OptionalFederationDomainCertificateBinding = FederationDomainCertificateBinding("Optional")
+	RequiredFederationDomainCertificateBinding = FederationDomainCertificateBinding("Required")
+)
+
+// FederationDomainTokensSpec is a struct that describes the tokens issued by an OIDC Provider.
+type FederationDomainTokensSpec struct {
+	// CertificateBinding controls whether the refresh tokens, access tokens and ID tokens issued by this
+	// FederationDomain are bound to the TLS client certificate which the client presents to the token endpoint,
+	// as described in RFC 8705 section 3.
+	//
+	// - Disabled (the default) does not request client certificates and does not bind tokens.
+	//
+	// - Optional requests a client certificate during the TLS handshake. When the client presents one during the
+	// authorization code exchange, the tokens are bound to it. Refreshing those tokens, or exchanging them for
+	// cluster-scoped tokens, then requires the same client certificate.
+	//
+	// - Required is like Optional, but all token requests must present a client certificate, and tokens which are
+	// not bound to a client certificate cannot be refreshed or exchanged.
+	//
+	// The binding is only checked by the Supervisor when tokens are refreshed or exchanged. The issued tokens do not
+	// carry the thumbprint of the certificate, and the Concierge and the impersonation proxy do not check it, so a
+	// stolen cluster-scoped ID token can be used without the client certificate until it expires.
+	//
+	// Client certificates are never validated against any certificate authority, so self-signed certificates are
+	// allowed. The client certificate can only be seen by the Supervisor when TLS is not terminated in front of the
+	// Supervisor, e.g. by an Ingress.
+	// +optional
+	CertificateBinding FederationDomainCertificateBinding `json:"certificateBinding,omitempty"`
+
+	// TokenExchange restricts the RFC 8693 token exchanges which clients may perform to get cluster-scoped ID tokens
+	// for the Concierge or other workload cluster authenticators.
+	// +optional
+	TokenExchange *FederationDomainTokenExchangeSpec `json:"tokenExchange,omitempty"`
+}
+
+// FederationDomainTokenExchangeSpec is a struct that describes which audiences clients may request when they
+// exchange tokens of an OIDC Provider.
+type FederationDomainTokenExchangeSpec struct {
+	// Clients lists the audiences which each client may request. When tokenExchange is not configured, every client
+	// may request any audience. When it is configured, clients which are not listed may not exchange tokens.
+	// The Pinniped CLI is the client "pinniped-cli".
+	// +listType=map
+	// +listMapKey=clientID
+	// +optional
+	Clients []FederationDomainTokenExchangeClientSpec `json:"clients,omitempty"`
+}
+
+// FederationDomainTokenExchangeClientSpec is a struct that describes the audiences which a client may request.
+type FederationDomainTokenExchangeClientSpec struct {
+	// ClientID is the ID of the client.
+	// +kubebuilder:validation:MinLength=1
+	ClientID string `json:"clientID"`
+
+	// AllowedAudiences are patterns of the audiences which the client may request, e.g. "cluster-*". A "*" matches
+	// any sequence of characters, including none. Requests for other audiences are rejected with an invalid_target
+	// error.
+	// +kubebuilder:validation:MinItems=1
+	AllowedAudiences []string `json:"allowedAudiences"`
+}
+
 // FederationDomainSpec is a struct that describes an OIDC Provider.
 type FederationDomainSpec struct {
 	// Issuer is the OIDC Provider's issuer, per the OIDC Discovery Metadata document, as well as the
@@ -58,6 +194,18 @@ type FederationDomainSpec struct {
 	// TLS configures how this FederationDomain is served over Transport Layer Security (TLS).
 	// +optional
 	TLS *FederationDomainTLSSpec `json:"tls,omitempty"`
+
+	// Branding customizes the HTML pages which are shown to users by this FederationDomain.
+	// +optional
+	Branding *FederationDomainBrandingSpec `json:"branding,omitempty"`
+
+	// SecurityHeaders overrides the security-related response headers of this FederationDomain.
+	// +optional
+	SecurityHeaders *FederationDomainSecurityHeadersSpec `json:"securityHeaders,omitempty"`
+
+	// Tokens configures the tokens issued by this FederationDomain.
+	// +optional
+	Tokens *FederationDomainTokensSpec `json:"tokens,omitempty"`
 }
 
 // FederationDomainSecrets holds information about this OIDC Provider's secrets.
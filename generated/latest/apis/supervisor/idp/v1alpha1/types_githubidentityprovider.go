@@ -0,0 +1,195 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type GitHubIdentityProviderPhase string
+
+const (
+	// GitHubPhasePending is the default phase for newly-created GitHubIdentityProvider resources.
+	GitHubPhasePending GitHubIdentityProviderPhase = "Pending"
+
+	// GitHubPhaseReady is the phase for a GitHubIdentityProvider resource in a healthy state.
+	GitHubPhaseReady GitHubIdentityProviderPhase = "Ready"
+
+	// GitHubPhaseError is the phase for a GitHubIdentityProvider in an unhealthy state.
+	GitHubPhaseError GitHubIdentityProviderPhase = "Error"
+)
+
+// GitHubUsernameAttribute is the GitHub user attribute which will become the username of the user.
+// +kubebuilder:validation:Enum={"id","login","login:id"}
+type GitHubUsernameAttribute string
+
+const (
+	// GitHubUsernameID uses the numeric user ID, which never changes, as the username.
+	GitHubUsernameID GitHubUsernameAttribute = "id"
+
+	// GitHubUsernameLogin uses the login name as the username. Note that GitHub users may change their login
+	// name, and another user may later take a login name which was previously used by someone else.
+	GitHubUsernameLogin GitHubUsernameAttribute = "login"
+
+	// GitHubUsernameLoginAndID uses the login name and the numeric user ID joined by a colon as the username,
+	// e.g. "octocat:1234567". This is both human-readable and unique over time.
+	GitHubUsernameLoginAndID GitHubUsernameAttribute = "login:id"
+)
+
+// GitHubGroupNameAttribute is the GitHub team attribute which will be used to form the group names of the user.
+// +kubebuilder:validation:Enum=name;slug
+type GitHubGroupNameAttribute string
+
+const (
+	// GitHubGroupNameName uses the team's name, e.g. "my-org/My Team".
+	GitHubGroupNameName GitHubGroupNameAttribute = "name"
+
+	// GitHubGroupNameSlug uses the team's slug, e.g. "my-org/my-team".
+	GitHubGroupNameSlug GitHubGroupNameAttribute = "slug"
+)
+
+// GitHubAllowedAuthOrganizationsPolicy decides which GitHub users are allowed to authenticate.
+// +kubebuilder:validation:Enum=OnlyUsersFromAllowedOrganizations;AllGitHubUsers
+type GitHubAllowedAuthOrganizationsPolicy string
+
+const (
+	// GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations allows only the members of the
+	// organizations listed in the allowed list to authenticate.
+	GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations GitHubAllowedAuthOrganizationsPolicy = "OnlyUsersFromAllowedOrganizations"
+
+	// GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers allows any GitHub user to authenticate.
+	GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers GitHubAllowedAuthOrganizationsPolicy = "AllGitHubUsers"
+)
+
+// GitHubIdentityProviderStatus is the status of a GitHub identity provider.
+type GitHubIdentityProviderStatus struct {
+	// Phase summarizes the overall status of the GitHubIdentityProvider.
+	// +kubebuilder:default=Pending
+	// +kubebuilder:validation:Enum=Pending;Ready;Error
+	Phase GitHubIdentityProviderPhase `json:"phase,omitempty"`
+
+	// Represents the observations of an identity provider's current state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	Conditions []Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+}
+
+// GitHubAPIConfig allows configuration for GitHub Enterprise Server.
+type GitHubAPIConfig struct {
+	// Host is the hostname of the GitHub server, optionally followed by a port, e.g. "github.example.com".
+	// Only needs to be set for GitHub Enterprise Server. The Supervisor will use the API of the server at
+	// "https://<host>/api/v3". When set to "github.com", which is the default, the Supervisor will use
+	// the API at "https://api.github.com".
+	// +kubebuilder:default="github.com"
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Host *string `json:"host,omitempty"`
+
+	// TLS configuration for requests to GitHub Enterprise Server. Should not be needed for github.com.
+	// +optional
+	TLS *TLSSpec `json:"tls,omitempty"`
+}
+
+// GitHubClaims allows customization of the username and groups claims.
+type GitHubClaims struct {
+	// Username configures which GitHub user attribute will become the username of the user.
+	// Defaults to "login:id", which is both human-readable and unique over time.
+	// +kubebuilder:default="login:id"
+	// +optional
+	Username *GitHubUsernameAttribute `json:"username,omitempty"`
+
+	// Groups configures which GitHub team attribute will be used to form the group names of the user. The group
+	// names will be the login name of the team's organization and the chosen team attribute joined by a slash,
+	// e.g. "my-org/my-team". Defaults to "slug".
+	// +kubebuilder:default="slug"
+	// +optional
+	Groups *GitHubGroupNameAttribute `json:"groups,omitempty"`
+}
+
+// GitHubClientSpec contains information about the GitHub client that this identity provider will use
+// for web-based login flows.
+type GitHubClientSpec struct {
+	// SecretName contains the name of a namespace-local Secret object that provides the clientID and
+	// clientSecret for a GitHub App or GitHub OAuth App. The Secret must be of type
+	// "secrets.pinniped.dev/github-client" with keys "clientID" and "clientSecret".
+	// +kubebuilder:validation:MinLength=1
+	SecretName string `json:"secretName"`
+}
+
+// GitHubOrganizationsSpec configures which organizations' members are allowed to authenticate.
+type GitHubOrganizationsSpec struct {
+	// Policy decides which GitHub users are allowed to authenticate. When set to
+	// "OnlyUsersFromAllowedOrganizations", which is the default, only the members of the organizations listed
+	// in allowed may authenticate, and allowed must not be empty. When set to "AllGitHubUsers", any GitHub
+	// user may authenticate, and allowed must be empty. Note that the GitHub App or OAuth App must be allowed
+	// to read the organization memberships of the users by the organizations' settings.
+	// +kubebuilder:default=OnlyUsersFromAllowedOrganizations
+	// +optional
+	Policy *GitHubAllowedAuthOrganizationsPolicy `json:"policy,omitempty"`
+
+	// Allowed is a list of the login names of the GitHub organizations whose members may authenticate.
+	// Only teams which belong to these organizations will become groups of the user.
+	// When empty, the user's teams from all organizations will become groups of the user.
+	// +listType=set
+	// +optional
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+// GitHubAllowAuthenticationSpec configures which GitHub users are allowed to authenticate.
+type GitHubAllowAuthenticationSpec struct {
+	// Organizations configures which organizations' members are allowed to authenticate.
+	Organizations GitHubOrganizationsSpec `json:"organizations"`
+}
+
+// GitHubIdentityProviderSpec is the spec for configuring a GitHub identity provider.
+type GitHubIdentityProviderSpec struct {
+	// GitHubAPI allows configuration for GitHub Enterprise Server.
+	// +kubebuilder:default={}
+	// +optional
+	GitHubAPI GitHubAPIConfig `json:"githubAPI"`
+
+	// Claims allows customization of the username and groups claims.
+	// +kubebuilder:default={}
+	// +optional
+	Claims GitHubClaims `json:"claims"`
+
+	// AllowAuthentication configures which GitHub users are allowed to authenticate.
+	AllowAuthentication GitHubAllowAuthenticationSpec `json:"allowAuthentication"`
+
+	// Client identifies the GitHub App or GitHub OAuth App which the Supervisor will use for web-based login flows.
+	// Its callback URL must be set to the callback endpoint of the FederationDomain, e.g.
+	// "https://example.com/issuer/callback".
+	Client GitHubClientSpec `json:"client"`
+}
+
+// GitHubIdentityProvider describes the configuration of an upstream GitHub identity provider.
+// This upstream provider can be configured with either GitHub.com or GitHub Enterprise Server.
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+// +kubebuilder:resource:categories=pinniped;pinniped-idp;pinniped-idps
+// +kubebuilder:printcolumn:name="Host",type=string,JSONPath=`.spec.githubAPI.host`
+// +kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.phase`
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+// +kubebuilder:subresource:status
+type GitHubIdentityProvider struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Spec for configuring the identity provider.
+	Spec GitHubIdentityProviderSpec `json:"spec"`
+
+	// Status of the identity provider.
+	Status GitHubIdentityProviderStatus `json:"status,omitempty"`
+}
+
+// GitHubIdentityProviderList lists GitHubIdentityProvider objects.
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+type GitHubIdentityProviderList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+
+	Items []GitHubIdentityProvider `json:"items"`
+}
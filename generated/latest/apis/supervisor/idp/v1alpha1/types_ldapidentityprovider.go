@@ -36,11 +36,16 @@ type LDAPIdentityProviderStatus struct {
 }
 
 type LDAPIdentityProviderBind struct {
-	// SecretName contains the name of a namespace-local Secret object that provides the username and
-	// password for an LDAP bind user. This account will be used to perform LDAP searches. The Secret should be
+	// SecretName contains the name of a namespace-local Secret object that provides the credentials
+	// for an LDAP bind user. This account will be used to perform LDAP searches. The Secret should be
 	// of type "kubernetes.io/basic-auth" which includes "username" and "password" keys. The username value
 	// should be the full dn (distinguished name) of your bind account, e.g. "cn=bind-account,ou=users,dc=example,dc=com".
 	// The password must be non-empty.
+	// Alternatively, the Secret may be of type "kubernetes.io/tls" which includes "tls.crt" and "tls.key" keys,
+	// containing a client certificate and its private key. The client certificate will be presented during the TLS
+	// handshake with the server, and the bind will be performed using the SASL EXTERNAL mechanism, so the server
+	// must be configured to map the client certificate to the bind account.
+	// See https://datatracker.ietf.org/doc/html/rfc4422#appendix-A.
 	// +kubebuilder:validation:MinLength=1
 	SecretName string `json:"secretName"`
 }
@@ -107,7 +112,8 @@ type LDAPIdentityProviderGroupSearch struct {
 
 	// Filter is the LDAP search filter which should be applied when searching for groups for a user.
 	// The pattern "{}" must occur in the filter at least once and will be dynamically replaced by the
-	// dn (distinguished name) of the user entry found as a result of the user search. E.g. "member={}" or
+	// dn (distinguished name) of the user entry found as a result of the user search, or by the value of the
+	// UserAttributeForFilter of that entry when it is specified. E.g. "member={}" or
 	// "&(objectClass=groupOfNames)(member={})". For more information about LDAP filters, see
 	// https://ldap.com/ldap-filters.
 	// Note that the dn (distinguished name) is not an attribute of an entry, so "dn={}" cannot be used.
@@ -115,11 +121,48 @@ type LDAPIdentityProviderGroupSearch struct {
 	// +optional
 	Filter string `json:"filter,omitempty"`
 
+	// UserAttributeForFilter specifies which attribute of the user entry found as a result of the user search
+	// should replace the "{}" pattern in the Filter. This is useful for schemas in which groups list their members
+	// by something other than their dn (distinguished name). E.g. specifying "uid" as the UserAttributeForFilter and
+	// "&(objectClass=posixGroup)(memberUid={})" as the Filter would find the POSIX groups which list the user's uid
+	// as a memberUid. The user entry must have exactly one value for this attribute. Its value is escaped before it
+	// is put into the Filter, and it is remembered in the user's session to be used again when the user's groups are
+	// refreshed.
+	// It cannot be combined with ResolveNestedGroups, which finds the groups of groups using their dn.
+	// Optional. When not specified, the default will act as if "dn" were specified.
+	// +optional
+	UserAttributeForFilter string `json:"userAttributeForFilter,omitempty"`
+
 	// Attributes specifies how the group's information should be read from each LDAP entry which was found as
 	// the result of the group search.
 	// +optional
 	Attributes LDAPIdentityProviderGroupSearchAttributes `json:"attributes,omitempty"`
 
+	// ResolveNestedGroups, when set to true, means that users will also belong to the groups which contain their
+	// groups as members, transitively. After the user's groups are found, the Filter is applied again for each
+	// level of nesting with the dn (distinguished name) of each newly found group in place of "{}", so the Filter
+	// should also match groups which have groups as members. Each group is only searched for once, so cycles in
+	// the group memberships are harmless. At most 10 levels of nesting are resolved. Each level of nesting costs
+	// at least one more search during each login and each refresh.
+	// Because the groups are found by their dn, this cannot be used when the UserAttributeForFilter is set to any
+	// attribute other than "dn".
+	// This is not needed for Active Directory, where the LDAP_MATCHING_RULE_IN_CHAIN filter can be used to resolve
+	// nested groups on the server, which is the default for ActiveDirectoryIdentityProviders.
+	// Optional. When not specified, users only belong to the groups which have them as a member.
+	// +optional
+	ResolveNestedGroups bool `json:"resolveNestedGroups,omitempty"`
+
+	// CacheTTLSeconds, when greater than zero, is the number of seconds for which the groups which were found for
+	// a user are remembered by the Supervisor and reused when the user's session is refreshed, instead of searching
+	// for the user's groups again during every refresh. The user's entry is still searched for during every refresh.
+	// The user's groups are always searched for when the user logs in. Caching the groups reduces the load on the
+	// LDAP server caused by refreshes, at the cost of group membership changes taking up to this long to be
+	// reflected in the user's session. Unlike skipGroupRefresh, the groups are still refreshed after this time.
+	// Optional. When not specified or zero, the user's groups are searched for during every refresh.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	CacheTTLSeconds int32 `json:"cacheTTLSeconds,omitempty"`
+
 	// The user's group membership is refreshed as they interact with the supervisor
 	// to obtain new credentials (as their old credentials expire).  This allows group
 	// membership changes to be quickly reflected into Kubernetes clusters.  Since
@@ -152,6 +195,16 @@ type LDAPIdentityProviderSpec struct {
 	// +kubebuilder:validation:MinLength=1
 	Host string `json:"host"`
 
+	// AdditionalHosts are the hostnames of other servers of this LDAP identity provider, e.g. replicas which
+	// have the same users and groups as the Host. When the Host cannot be reached, the Supervisor will fail over
+	// to these servers in the order in which they are listed. Servers which recently could not be reached are tried
+	// last. Only ordered failover is supported: connections are not load balanced across the servers, so all
+	// connections are made to the Host while it can be reached. Each entry has the same format as the Host. The Host
+	// is still used to identify this identity provider, for example in the subject of the downstream ID tokens,
+	// regardless of which server was used.
+	// +optional
+	AdditionalHosts []string `json:"additionalHosts,omitempty"`
+
 	// TLS contains the connection settings for how to establish the connection to the Host.
 	TLS *TLSSpec `json:"tls,omitempty"`
 
@@ -0,0 +1,213 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package claimexpression compiles and evaluates CEL expressions which compute a username, a list of group names, or
+// a condition from the claims of an upstream identity.
+package claimexpression
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"google.golang.org/protobuf/proto"
+
+	"go.pinniped.dev/internal/constable"
+)
+
+const (
+	// ClaimsVariableName is the name of the variable which holds the upstream claims in every expression,
+	// e.g. `claims.email` or `claims.resource_access["my-client"].roles`.
+	ClaimsVariableName = "claims"
+
+	// ErrMissingClaim is returned when an expression refers to a claim or nested key that does not exist in the
+	// provided claims. Callers may choose to treat this the same as a missing claim.
+	ErrMissingClaim = constable.Error("expression refers to a claim which is not present")
+
+	// maxExpressionLength keeps expressions to a size which can be reasonably reviewed and evaluated.
+	maxExpressionLength = 4096
+)
+
+// UsernameExpression is a compiled expression which evaluates to a string.
+type UsernameExpression struct {
+	source  string
+	program cel.Program
+}
+
+// GroupsExpression is a compiled expression which evaluates to a list of strings, or to a single string.
+type GroupsExpression struct {
+	source  string
+	program cel.Program
+}
+
+// ConditionExpression is a compiled expression which evaluates to a bool.
+type ConditionExpression struct {
+	source  string
+	program cel.Program
+}
+
+// NewUsernameExpression compiles and type checks an expression which computes a username.
+func NewUsernameExpression(expression string) (*UsernameExpression, error) {
+	program, err := compile(expression, decls.String)
+	if err != nil {
+		return nil, err
+	}
+	return &UsernameExpression{source: expression, program: program}, nil
+}
+
+// NewGroupsExpression compiles and type checks an expression which computes a list of group names.
+func NewGroupsExpression(expression string) (*GroupsExpression, error) {
+	program, err := compile(expression, decls.NewListType(decls.String), decls.NewListType(decls.Dyn), decls.String)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupsExpression{source: expression, program: program}, nil
+}
+
+// NewConditionExpression compiles and type checks an expression which decides whether the claims are acceptable.
+func NewConditionExpression(expression string) (*ConditionExpression, error) {
+	program, err := compile(expression, decls.Bool)
+	if err != nil {
+		return nil, err
+	}
+	return &ConditionExpression{source: expression, program: program}, nil
+}
+
+// Source returns the original text of the expression.
+func (e *UsernameExpression) Source() string {
+	return e.source
+}
+
+// Source returns the original text of the expression.
+func (e *GroupsExpression) Source() string {
+	return e.source
+}
+
+// Source returns the original text of the expression.
+func (e *ConditionExpression) Source() string {
+	return e.source
+}
+
+// Evaluate computes the username from the provided claims.
+func (e *UsernameExpression) Evaluate(claims map[string]interface{}) (string, error) {
+	val, err := evaluate(e.program, claims)
+	if err != nil {
+		return "", err
+	}
+	username, ok := val.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("expression must evaluate to a string, but got %s", val.Type().TypeName())
+	}
+	return username, nil
+}
+
+// Evaluate computes the group names from the provided claims. Empty group names are removed from the result.
+func (e *GroupsExpression) Evaluate(claims map[string]interface{}) ([]string, error) {
+	val, err := evaluate(e.program, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if group, ok := val.Value().(string); ok {
+		if group == "" {
+			return []string{}, nil
+		}
+		return []string{group}, nil
+	}
+
+	native, err := val.ConvertToNative(reflect.TypeOf([]interface{}{}))
+	if err != nil {
+		return nil, fmt.Errorf("expression must evaluate to a list of strings, but got %s", val.Type().TypeName())
+	}
+	groups := []string{}
+	for _, item := range native.([]interface{}) {
+		group, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("expression must evaluate to a list of strings, but the list contained %T", item)
+		}
+		if group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// Evaluate decides whether the provided claims satisfy the condition.
+func (e *ConditionExpression) Evaluate(claims map[string]interface{}) (bool, error) {
+	val, err := evaluate(e.program, claims)
+	if err != nil {
+		return false, err
+	}
+	result, ok := val.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must evaluate to a bool, but got %s", val.Type().TypeName())
+	}
+	return result, nil
+}
+
+func compile(expression string, allowedResultTypes ...*exprpb.Type) (cel.Program, error) {
+	if strings.TrimSpace(expression) == "" {
+		return nil, fmt.Errorf("expression must not be empty")
+	}
+	if len(expression) > maxExpressionLength {
+		return nil, fmt.Errorf("expression must not be longer than %d characters", maxExpressionLength)
+	}
+
+	env, err := cel.NewEnv(cel.Declarations(
+		decls.NewVar(ClaimsVariableName, decls.NewMapType(decls.String, decls.Dyn)),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("could not create expression environment: %w", err)
+	}
+
+	ast, issues := env.Compile(expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("could not compile expression: %w", issues.Err())
+	}
+
+	// The claims are dynamically typed, so the checker will often only know that the result is "dyn". In that case
+	// the result type is checked again at evaluation time.
+	resultType := ast.ResultType()
+	if !proto.Equal(resultType, decls.Dyn) {
+		ok := false
+		for _, allowed := range allowedResultTypes {
+			if proto.Equal(allowed, resultType) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("expression has the wrong result type %s", cel.FormatType(resultType))
+		}
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("could not create expression program: %w", err)
+	}
+	return program, nil
+}
+
+func evaluate(program cel.Program, claims map[string]interface{}) (ref.Val, error) {
+	val, _, err := program.Eval(map[string]interface{}{ClaimsVariableName: claims})
+	if err != nil {
+		if isMissingKeyError(err) {
+			return nil, fmt.Errorf("%w: %s", ErrMissingClaim, err.Error())
+		}
+		return nil, fmt.Errorf("could not evaluate expression: %w", err)
+	}
+	if types.IsError(val) {
+		return nil, fmt.Errorf("could not evaluate expression: %v", val)
+	}
+	return val, nil
+}
+
+func isMissingKeyError(err error) bool {
+	msg := err.Error()
+	return strings.HasPrefix(msg, "no such key") || strings.HasPrefix(msg, "no such attribute")
+}
@@ -0,0 +1,274 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package claimexpression
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":         "some-subject",
+		"email":       "pinny@example.com",
+		"given_name":  "Pinny",
+		"family_name": "Seal",
+		"groups":      []interface{}{"group1", "", "group2"},
+		"resource_access": map[string]interface{}{
+			"my-client": map[string]interface{}{
+				"roles": []interface{}{"admin", "viewer"},
+			},
+		},
+		"not_a_string": 42,
+	}
+}
+
+func TestUsernameExpression(t *testing.T) {
+	tests := []struct {
+		name           string
+		expression     string
+		wantCompileErr string
+		wantUsername   string
+		wantEvalErr    string
+		wantMissingErr bool
+	}{
+		{
+			name:         "top level claim",
+			expression:   "claims.email",
+			wantUsername: "pinny@example.com",
+		},
+		{
+			name:         "concatenation",
+			expression:   `claims.given_name + "." + claims.family_name`,
+			wantUsername: "Pinny.Seal",
+		},
+		{
+			name:         "index syntax",
+			expression:   `claims["sub"]`,
+			wantUsername: "some-subject",
+		},
+		{
+			name:           "empty expression",
+			expression:     " ",
+			wantCompileErr: "expression must not be empty",
+		},
+		{
+			name:           "too long",
+			expression:     `"` + strings.Repeat("a", maxExpressionLength) + `"`,
+			wantCompileErr: "expression must not be longer than 4096 characters",
+		},
+		{
+			name:           "syntax error",
+			expression:     "claims.email +",
+			wantCompileErr: "could not compile expression: ERROR: <input>:1:15: Syntax error",
+		},
+		{
+			name:           "unknown variable",
+			expression:     "token.email",
+			wantCompileErr: "could not compile expression: ERROR: <input>:1:1: undeclared reference to 'token'",
+		},
+		{
+			name:           "statically known wrong result type",
+			expression:     "1 + 1",
+			wantCompileErr: "expression has the wrong result type int",
+		},
+		{
+			name:        "dynamically wrong result type",
+			expression:  "claims.not_a_string",
+			wantEvalErr: "expression must evaluate to a string, but got int",
+		},
+		{
+			name:           "missing claim",
+			expression:     "claims.nickname",
+			wantEvalErr:    "expression refers to a claim which is not present: no such key: nickname",
+			wantMissingErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := NewUsernameExpression(tt.expression)
+			if tt.wantCompileErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantCompileErr)
+				require.Nil(t, expr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expression, expr.Source())
+
+			username, err := expr.Evaluate(testClaims())
+			if tt.wantEvalErr != "" {
+				require.EqualError(t, err, tt.wantEvalErr)
+				require.Equal(t, tt.wantMissingErr, errors.Is(err, ErrMissingClaim))
+				require.Empty(t, username)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantUsername, username)
+		})
+	}
+}
+
+func TestGroupsExpression(t *testing.T) {
+	tests := []struct {
+		name           string
+		expression     string
+		wantCompileErr string
+		wantGroups     []string
+		wantEvalErr    string
+		wantMissingErr bool
+	}{
+		{
+			name:       "top level list claim removes empty names",
+			expression: "claims.groups",
+			wantGroups: []string{"group1", "group2"},
+		},
+		{
+			name:       "nested roles",
+			expression: `claims.resource_access["my-client"].roles`,
+			wantGroups: []string{"admin", "viewer"},
+		},
+		{
+			name:       "derived from role array",
+			expression: `claims.resource_access["my-client"].roles.map(r, "my-client:" + r)`,
+			wantGroups: []string{"my-client:admin", "my-client:viewer"},
+		},
+		{
+			name:       "combined lists",
+			expression: `claims.groups + claims.resource_access["my-client"].roles.filter(r, r == "admin")`,
+			wantGroups: []string{"group1", "group2", "admin"},
+		},
+		{
+			name:       "single string",
+			expression: "claims.email",
+			wantGroups: []string{"pinny@example.com"},
+		},
+		{
+			name:       "single empty string",
+			expression: `""`,
+			wantGroups: []string{},
+		},
+		{
+			name:           "statically known wrong result type",
+			expression:     "[1, 2]",
+			wantCompileErr: "expression has the wrong result type list(int)",
+		},
+		{
+			name:        "dynamically wrong result type",
+			expression:  "claims.not_a_string",
+			wantEvalErr: "expression must evaluate to a list of strings, but got int",
+		},
+		{
+			name:        "list with wrong item type",
+			expression:  `[claims.not_a_string, claims.email]`,
+			wantEvalErr: "expression must evaluate to a list of strings, but the list contained int64",
+		},
+		{
+			name:           "missing nested key",
+			expression:     `claims.resource_access["other-client"].roles`,
+			wantEvalErr:    "expression refers to a claim which is not present: no such key: other-client",
+			wantMissingErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := NewGroupsExpression(tt.expression)
+			if tt.wantCompileErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantCompileErr)
+				require.Nil(t, expr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expression, expr.Source())
+
+			groups, err := expr.Evaluate(testClaims())
+			if tt.wantEvalErr != "" {
+				require.EqualError(t, err, tt.wantEvalErr)
+				require.Equal(t, tt.wantMissingErr, errors.Is(err, ErrMissingClaim))
+				require.Nil(t, groups)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantGroups, groups)
+		})
+	}
+}
+
+func TestConditionExpression(t *testing.T) {
+	tests := []struct {
+		name           string
+		expression     string
+		wantCompileErr string
+		want           bool
+		wantEvalErr    string
+		wantMissingErr bool
+	}{
+		{
+			name:       "equality",
+			expression: `claims.sub == "some-subject"`,
+			want:       true,
+		},
+		{
+			name:       "inequality",
+			expression: `claims.sub == "other-subject"`,
+			want:       false,
+		},
+		{
+			name:       "list membership",
+			expression: `"admin" in claims.resource_access["my-client"].roles`,
+			want:       true,
+		},
+		{
+			name:       "existence check of missing claim",
+			expression: `has(claims.ref) && claims.ref == "refs/heads/main"`,
+			want:       false,
+		},
+		{
+			name:           "statically known wrong result type",
+			expression:     `"true"`,
+			wantCompileErr: "expression has the wrong result type string",
+		},
+		{
+			name:        "dynamically wrong result type",
+			expression:  "claims.email",
+			wantEvalErr: "expression must evaluate to a bool, but got string",
+		},
+		{
+			name:           "missing claim",
+			expression:     `claims.ref == "refs/heads/main"`,
+			wantEvalErr:    "expression refers to a claim which is not present: no such key: ref",
+			wantMissingErr: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := NewConditionExpression(tt.expression)
+			if tt.wantCompileErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantCompileErr)
+				require.Nil(t, expr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expression, expr.Source())
+
+			result, err := expr.Evaluate(testClaims())
+			if tt.wantEvalErr != "" {
+				require.EqualError(t, err, tt.wantEvalErr)
+				require.Equal(t, tt.wantMissingErr, errors.Is(err, ErrMissingClaim))
+				require.False(t, result)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, result)
+		})
+	}
+}
@@ -83,6 +83,10 @@ func FromPath(path string) (*Config, error) {
 		return nil, fmt.Errorf("validate endpoints: %w", err)
 	}
 
+	if err := config.SecurityHeaders.Validate(); err != nil {
+		return nil, fmt.Errorf("validate securityHeaders: %w", err)
+	}
+
 	return &config, nil
 }
 
@@ -6,6 +6,7 @@ package supervisor
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	"k8s.io/utils/pointer"
 
 	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/httputil/securityheader"
 )
 
 func TestFromPath(t *testing.T) {
@@ -40,6 +42,18 @@ func TestFromPath(t *testing.T) {
 				    network: tcp
 					address: 127.0.0.1:1234
 				insecureAcceptExternalUnencryptedHttpRequests: false
+				securityHeaders:
+				  strictTransportSecurity:
+				    maxAgeSeconds: 31536000
+				    includeSubDomains: true
+				    preload: true
+				  contentSecurityPolicy: upgrade-insecure-requests
+				  permissionsPolicy: camera=(), microphone=()
+				  crossOriginOpenerPolicy: same-origin
+				  crossOriginEmbedderPolicy: require-corp
+				trustedProxies:
+				  - 10.0.0.0/8
+				  - 2001:db8::/32
 			`),
 			wantConfig: &Config{
 				APIGroupSuffix: pointer.StringPtr("some.suffix.com"),
@@ -61,6 +75,21 @@ func TestFromPath(t *testing.T) {
 					},
 				},
 				AllowExternalHTTP: false,
+				SecurityHeaders: securityheader.Policy{
+					StrictTransportSecurity: &securityheader.StrictTransportSecurity{
+						MaxAgeSeconds:     31536000,
+						IncludeSubDomains: true,
+						Preload:           true,
+					},
+					ContentSecurityPolicy:     "upgrade-insecure-requests",
+					PermissionsPolicy:         "camera=(), microphone=()",
+					CrossOriginOpenerPolicy:   "same-origin",
+					CrossOriginEmbedderPolicy: "require-corp",
+				},
+				TrustedProxies: CIDRs{
+					{IP: net.IP{10, 0, 0, 0}, Mask: net.CIDRMask(8, 32)},
+					{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(32, 128)},
+				},
 			},
 		},
 		{
@@ -88,6 +117,41 @@ func TestFromPath(t *testing.T) {
 				AllowExternalHTTP: false,
 			},
 		},
+		{
+			name: "HSTS preload without includeSubDomains",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				securityHeaders:
+				  strictTransportSecurity:
+				    maxAgeSeconds: 31536000
+				    preload: true
+			`),
+			wantError: "validate securityHeaders: strictTransportSecurity.preload requires includeSubDomains and a maxAgeSeconds of at least 31536000",
+		},
+		{
+			name: "invalid Cross-Origin-Opener-Policy",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				securityHeaders:
+				  crossOriginOpenerPolicy: same-site
+			`),
+			wantError: "validate securityHeaders: crossOriginOpenerPolicy must be one of unsafe-none, same-origin-allow-popups, same-origin",
+		},
+		{
+			name: "invalid trusted proxy",
+			yaml: here.Doc(`
+				---
+				names:
+				  defaultTLSCertificateSecret: my-secret-name
+				trustedProxies:
+				  - 10.0.0.1
+			`),
+			wantError: `decode yaml: error unmarshaling JSON: while decoding JSON: invalid CIDR "10.0.0.1"`,
+		},
 		{
 			name: "all endpoints disabled",
 			yaml: here.Doc(`
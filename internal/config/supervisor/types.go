@@ -4,19 +4,25 @@
 package supervisor
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 
+	"go.pinniped.dev/internal/httputil/securityheader"
 	"go.pinniped.dev/internal/plog"
 )
 
 // Config contains knobs to setup an instance of the Pinniped Supervisor.
 type Config struct {
-	APIGroupSuffix    *string            `json:"apiGroupSuffix,omitempty"`
-	Labels            map[string]string  `json:"labels"`
-	NamesConfig       NamesConfigSpec    `json:"names"`
-	LogLevel          plog.LogLevel      `json:"logLevel"`
-	Endpoints         *Endpoints         `json:"endpoints"`
-	AllowExternalHTTP stringOrBoolAsBool `json:"insecureAcceptExternalUnencryptedHttpRequests"`
+	APIGroupSuffix    *string               `json:"apiGroupSuffix,omitempty"`
+	Labels            map[string]string     `json:"labels"`
+	NamesConfig       NamesConfigSpec       `json:"names"`
+	LogLevel          plog.LogLevel         `json:"logLevel"`
+	Endpoints         *Endpoints            `json:"endpoints"`
+	AllowExternalHTTP stringOrBoolAsBool    `json:"insecureAcceptExternalUnencryptedHttpRequests"`
+	SecurityHeaders   securityheader.Policy `json:"securityHeaders"`
+	TrustedProxies    CIDRs                 `json:"trustedProxies"`
 }
 
 // NamesConfigSpec configures the names of some Kubernetes resources for the Supervisor.
@@ -34,6 +40,25 @@ type Endpoint struct {
 	Address string `json:"address"`
 }
 
+// CIDRs is a list of IP address ranges, which are written in CIDR notation, e.g. "10.0.0.0/8".
+type CIDRs []*net.IPNet
+
+func (c *CIDRs) UnmarshalJSON(b []byte) error {
+	var cidrs []string
+	if err := json.Unmarshal(b, &cidrs); err != nil {
+		return err
+	}
+	*c = nil
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR %q", cidr)
+		}
+		*c = append(*c, ipNet)
+	}
+	return nil
+}
+
 type stringOrBoolAsBool bool
 
 func (sb *stringOrBoolAsBool) UnmarshalJSON(b []byte) error {
@@ -15,9 +15,11 @@ import (
 	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
 	"github.com/go-logr/logr"
 	"gopkg.in/square/go-jose.v2"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apiserver/pkg/authentication/authenticator"
 	"k8s.io/apiserver/plugin/pkg/authenticator/token/oidc"
+	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/klog/v2"
 
 	auth1alpha1 "go.pinniped.dev/generated/latest/apis/concierge/authentication/v1alpha1"
@@ -58,12 +60,17 @@ type tokenAuthenticatorCloser interface {
 type jwtAuthenticator struct {
 	tokenAuthenticatorCloser
 	spec *auth1alpha1.JWTAuthenticatorSpec
+	// proxyURL is the resolved proxy URL, including any credentials, so that we can notice when the credentials change.
+	proxyURL string
 }
 
 // New instantiates a new controllerlib.Controller which will populate the provided authncache.Cache.
+// Proxy credentials Secrets are read from the given namespace, which is where the Concierge is installed.
 func New(
 	cache *authncache.Cache,
 	jwtAuthenticators authinformers.JWTAuthenticatorInformer,
+	secretInformer corev1informers.SecretInformer,
+	namespace string,
 	log logr.Logger,
 ) controllerlib.Controller {
 	return controllerlib.New(
@@ -72,6 +79,8 @@ func New(
 			Syncer: &controller{
 				cache:             cache,
 				jwtAuthenticators: jwtAuthenticators,
+				secretInformer:    secretInformer,
+				namespace:         namespace,
 				log:               log.WithName("jwtcachefiller-controller"),
 			},
 		},
@@ -80,12 +89,21 @@ func New(
 			pinnipedcontroller.MatchAnythingFilter(nil), // nil parent func is fine because each event is distinct
 			controllerlib.InformerOption{},
 		),
+		// Changes to proxy credentials are picked up by the periodic resync of the JWTAuthenticators, so there is
+		// no need to watch for events on the Secrets.
+		controllerlib.WithInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnythingFilter(nil),
+			controllerlib.InformerOption{SkipEvents: true},
+		),
 	)
 }
 
 type controller struct {
 	cache             *authncache.Cache
 	jwtAuthenticators authinformers.JWTAuthenticatorInformer
+	secretInformer    corev1informers.SecretInformer
+	namespace         string
 	log               logr.Logger
 }
 
@@ -100,6 +118,15 @@ func (c *controller) Sync(ctx controllerlib.Context) error {
 		return fmt.Errorf("failed to get JWTAuthenticator %s/%s: %w", ctx.Key.Namespace, ctx.Key.Name, err)
 	}
 
+	proxyURL, err := c.getProxyURL(&obj.Spec)
+	if err != nil {
+		return fmt.Errorf("failed to build jwt authenticator: invalid proxy configuration: %w", err)
+	}
+	var proxyURLString string
+	if proxyURL != nil {
+		proxyURLString = proxyURL.String()
+	}
+
 	cacheKey := authncache.Key{
 		APIGroup: auth1alpha1.GroupName,
 		Kind:     "JWTAuthenticator",
@@ -114,7 +141,7 @@ func (c *controller) Sync(ctx controllerlib.Context) error {
 	if value := c.cache.Get(cacheKey); value != nil {
 		jwtAuthenticator := c.extractValueAsJWTAuthenticator(value)
 		if jwtAuthenticator != nil {
-			if reflect.DeepEqual(jwtAuthenticator.spec, &obj.Spec) {
+			if reflect.DeepEqual(jwtAuthenticator.spec, &obj.Spec) && jwtAuthenticator.proxyURL == proxyURLString {
 				c.log.WithValues("jwtAuthenticator", klog.KObj(obj), "issuer", obj.Spec.Issuer).Info("actual jwt authenticator and desired jwt authenticator are the same")
 				return nil
 			}
@@ -124,7 +151,7 @@ func (c *controller) Sync(ctx controllerlib.Context) error {
 
 	// Make a deep copy of the spec so we aren't storing pointers to something that the informer cache
 	// may mutate!
-	jwtAuthenticator, err := newJWTAuthenticator(obj.Spec.DeepCopy())
+	jwtAuthenticator, err := newJWTAuthenticator(obj.Spec.DeepCopy(), proxyURL)
 	if err != nil {
 		return fmt.Errorf("failed to build jwt authenticator: %w", err)
 	}
@@ -147,8 +174,34 @@ func (c *controller) extractValueAsJWTAuthenticator(value authncache.Value) *jwt
 	return jwtAuthenticator
 }
 
-// newJWTAuthenticator creates a jwt authenticator from the provided spec.
-func newJWTAuthenticator(spec *auth1alpha1.JWTAuthenticatorSpec) (*jwtAuthenticator, error) {
+// getProxyURL loads the proxy configured by the spec, including the credentials referenced by
+// spec.proxy.credentialsSecretName. It returns nil when no proxy is configured.
+func (c *controller) getProxyURL(spec *auth1alpha1.JWTAuthenticatorSpec) (*url.URL, error) {
+	if spec.Proxy == nil {
+		return nil, nil
+	}
+
+	var username, password string
+	if secretName := spec.Proxy.CredentialsSecretName; secretName != "" {
+		secret, err := c.secretInformer.Lister().Secrets(c.namespace).Get(secretName)
+		if err != nil {
+			return nil, fmt.Errorf("could not get proxy credentials: %w", err)
+		}
+		if secret.Type != corev1.SecretTypeBasicAuth {
+			return nil, fmt.Errorf("referenced Secret %q has wrong type %q (should be %q)", secretName, secret.Type, corev1.SecretTypeBasicAuth)
+		}
+		username = string(secret.Data[corev1.BasicAuthUsernameKey])
+		password = string(secret.Data[corev1.BasicAuthPasswordKey])
+		if username == "" {
+			return nil, fmt.Errorf("referenced Secret %q is missing required key %q", secretName, corev1.BasicAuthUsernameKey)
+		}
+	}
+
+	return phttp.ProxyURL(spec.Proxy.URL, username, password)
+}
+
+// newJWTAuthenticator creates a jwt authenticator from the provided spec and the optional proxy URL.
+func newJWTAuthenticator(spec *auth1alpha1.JWTAuthenticatorSpec, proxyURL *url.URL) (*jwtAuthenticator, error) {
 	rootCAs, _, err := pinnipedauthenticator.CABundle(spec.TLS)
 	if err != nil {
 		return nil, fmt.Errorf("invalid TLS configuration: %w", err)
@@ -172,7 +225,11 @@ func newJWTAuthenticator(spec *auth1alpha1.JWTAuthenticatorSpec) (*jwtAuthentica
 		return nil, fmt.Errorf("issuer (%q) has invalid scheme (%q), require 'https'", spec.Issuer, issuerURL.Scheme)
 	}
 
-	client := phttp.Default(rootCAs)
+	var opts []phttp.Option
+	if proxyURL != nil {
+		opts = append(opts, phttp.WithProxy(phttp.ProxyFunc(proxyURL, spec.Proxy.NoProxy)))
+	}
+	client := phttp.DefaultWithOptions(rootCAs, opts...)
 	client.Timeout = 30 * time.Second // copied from Kube OIDC code
 
 	ctx := coreosoidc.ClientContext(context.Background(), client)
@@ -203,8 +260,12 @@ func newJWTAuthenticator(spec *auth1alpha1.JWTAuthenticatorSpec) (*jwtAuthentica
 		return nil, fmt.Errorf("could not initialize authenticator: %w", err)
 	}
 
-	return &jwtAuthenticator{
+	result := &jwtAuthenticator{
 		tokenAuthenticatorCloser: oidcAuthenticator,
 		spec:                     spec,
-	}, nil
+	}
+	if proxyURL != nil {
+		result.proxyURL = proxyURL.String()
+	}
+	return result, nil
 }
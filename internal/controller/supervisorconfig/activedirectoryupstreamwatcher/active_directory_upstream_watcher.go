@@ -6,17 +6,23 @@ package activedirectoryupstreamwatcher
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/google/uuid"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	krb5types "github.com/jcmturner/gokrb5/v8/types"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/klog/v2/klogr"
 
@@ -58,6 +64,8 @@ const (
 	defaultActiveDirectoryGroupSearchFilter = "(&(objectClass=group)(member:1.2.840.113556.1.4.1941:={}))"
 
 	sAMAccountNameAttribute = "sAMAccountName"
+	// objectSIDAttribute is the binary security identifier of an entry, which can be used to name groups.
+	objectSIDAttribute = "objectSid"
 	// pwdLastSetAttribute is the date and time that the password for this account was last changed.
 	// https://docs.microsoft.com/en-us/windows/win32/adschema/a-pwdlastset
 	pwdLastSetAttribute = "pwdLastSet"
@@ -71,6 +79,11 @@ const (
 	accountDisabledBitmapValue = 2
 	// 0x0010 UF_LOCKOUT in msDS-User-Account-Control-Computed bitmap.
 	accountLockedBitmapValue = 16
+
+	kerberosKeytabSecretType    = corev1.SecretType("secrets.pinniped.dev/kerberos-keytab")
+	kerberosKeytabSecretDataKey = "keytab"
+	typeKerberosKeytabValid     = "KerberosKeytabValid"
+	reasonInvalidKeytab         = "InvalidKeytab"
 )
 
 type activeDirectoryUpstreamGenericLDAPImpl struct {
@@ -222,11 +235,14 @@ func (s *activeDirectoryUpstreamGenericLDAPStatus) Conditions() []v1alpha1.Condi
 // UpstreamActiveDirectoryIdentityProviderICache is a thread safe cache that holds a list of validated upstream LDAP IDP configurations.
 type UpstreamActiveDirectoryIdentityProviderICache interface {
 	SetActiveDirectoryIdentityProviders([]provider.UpstreamLDAPIdentityProviderI)
+	GetActiveDirectoryIdentityProviders() []provider.UpstreamLDAPIdentityProviderI
 }
 
 type activeDirectoryWatcherController struct {
 	cache                                   UpstreamActiveDirectoryIdentityProviderICache
 	validatedSettingsCache                  upstreamwatchers.ValidatedSettingsCacheI
+	hostHealthCache                         *upstreamwatchers.HostHealthCache
+	groupCaches                             *upstreamwatchers.GroupCaches
 	ldapDialer                              upstreamldap.LDAPDialer
 	client                                  pinnipedclientset.Interface
 	activeDirectoryIdentityProviderInformer idpinformers.ActiveDirectoryIdentityProviderInformer
@@ -267,6 +283,8 @@ func newInternal(
 	c := activeDirectoryWatcherController{
 		cache:                                   idpCache,
 		validatedSettingsCache:                  validatedSettingsCache,
+		hostHealthCache:                         upstreamwatchers.NewHostHealthCache(),
+		groupCaches:                             upstreamwatchers.NewGroupCaches(),
 		ldapDialer:                              ldapDialer,
 		client:                                  client,
 		activeDirectoryIdentityProviderInformer: activeDirectoryIdentityProviderInformer,
@@ -281,7 +299,14 @@ func newInternal(
 		),
 		withInformer(
 			secretInformer,
-			pinnipedcontroller.MatchAnySecretOfTypeFilter(upstreamwatchers.LDAPBindAccountSecretType, pinnipedcontroller.SingletonQueue()),
+			pinnipedcontroller.MatchAnySecretOfTypesFilter(
+				[]corev1.SecretType{
+					upstreamwatchers.LDAPBindAccountSecretType,
+					upstreamwatchers.LDAPBindClientCertificateSecretType,
+					kerberosKeytabSecretType,
+				},
+				pinnipedcontroller.SingletonQueue(),
+			),
 			controllerlib.InformerOption{},
 		),
 	)
@@ -295,8 +320,10 @@ func (c *activeDirectoryWatcherController) Sync(ctx controllerlib.Context) error
 	}
 
 	requeue := false
+	upstreamNames := sets.NewString()
 	validatedUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, 0, len(actualUpstreams))
 	for _, upstream := range actualUpstreams {
+		upstreamNames.Insert(upstream.Name)
 		valid, requestedRequeue := c.validateUpstream(ctx.Context, upstream)
 		if valid != nil {
 			validatedUpstreams = append(validatedUpstreams, valid)
@@ -306,7 +333,15 @@ func (c *activeDirectoryWatcherController) Sync(ctx controllerlib.Context) error
 		}
 	}
 
+	// Forget the health of the hosts of upstreams which were deleted.
+	c.hostHealthCache.Retain(upstreamNames)
+	// Forget the cached groups of upstreams which were deleted.
+	c.groupCaches.Retain(upstreamNames)
+
+	previousUpstreams := c.cache.GetActiveDirectoryIdentityProviders()
 	c.cache.SetActiveDirectoryIdentityProviders(validatedUpstreams)
+	// The previous providers will not be used for any new logins, so close their idle connections to the LDAP server.
+	upstreamwatchers.CloseIdleConnections(previousUpstreams)
 
 	if requeue {
 		return controllerlib.ErrSyntheticRequeue
@@ -320,9 +355,10 @@ func (c *activeDirectoryWatcherController) validateUpstream(ctx context.Context,
 	adUpstreamImpl := &activeDirectoryUpstreamGenericLDAPImpl{activeDirectoryIdentityProvider: *upstream}
 
 	config := &upstreamldap.ProviderConfig{
-		Name:        upstream.Name,
-		ResourceUID: upstream.UID,
-		Host:        spec.Host,
+		Name:            upstream.Name,
+		ResourceUID:     upstream.UID,
+		Host:            spec.Host,
+		AdditionalHosts: spec.AdditionalHosts,
 		UserSearch: upstreamldap.UserSearchConfig{
 			Base:              spec.UserSearch.Base,
 			Filter:            adUpstreamImpl.Spec().UserSearch().Filter(),
@@ -334,6 +370,8 @@ func (c *activeDirectoryWatcherController) validateUpstream(ctx context.Context,
 			Filter:             adUpstreamImpl.Spec().GroupSearch().Filter(),
 			GroupNameAttribute: adUpstreamImpl.Spec().GroupSearch().GroupNameAttribute(),
 			SkipGroupRefresh:   spec.GroupSearch.SkipGroupRefresh,
+			UseTokenGroups:     spec.GroupSearch.UseTokenGroups,
+			CacheTTL:           time.Duration(spec.GroupSearch.CacheTTLSeconds) * time.Second,
 		},
 		Dialer: c.ldapDialer,
 		UIDAttributeParsingOverrides: map[string]func(*ldap.Entry) (string, error){
@@ -346,19 +384,114 @@ func (c *activeDirectoryWatcherController) validateUpstream(ctx context.Context,
 		},
 	}
 
-	if spec.GroupSearch.Attributes.GroupName == "" {
+	switch spec.GroupSearch.Attributes.GroupName {
+	case "":
 		config.GroupAttributeParsingOverrides = map[string]func(*ldap.Entry) (string, error){
 			defaultActiveDirectoryGroupNameAttributeName: groupSAMAccountNameWithDomainSuffix,
 		}
+	case objectSIDAttribute:
+		config.GroupAttributeParsingOverrides = map[string]func(*ldap.Entry) (string, error){
+			objectSIDAttribute: microsoftSIDFromBinaryAttr(objectSIDAttribute),
+		}
+	}
+
+	if spec.DomainControllerDiscovery != nil {
+		config.SRVDomain = spec.DomainControllerDiscovery.Domain
+	}
+
+	if config.HasFailoverHosts() {
+		config.HostHealth = c.hostHealthCache.Get(upstream.Name, upstream.Generation)
+	}
+
+	if config.GroupSearch.CacheTTL > 0 {
+		config.GroupCache = c.groupCaches.Get(upstream.Name, upstream.Generation)
 	}
 
 	conditions := upstreamwatchers.ValidateGenericLDAP(ctx, adUpstreamImpl, c.secretInformer, c.validatedSettingsCache, config)
+	if spec.Kerberos != nil {
+		conditions.Append(c.validateKerberosKeytab(upstream, config), true)
+	}
 
 	c.updateStatus(ctx, upstream, conditions.Conditions())
 
 	return upstreamwatchers.EvaluateConditions(conditions, config)
 }
 
+func (c *activeDirectoryWatcherController) validateKerberosKeytab(upstream *v1alpha1.ActiveDirectoryIdentityProvider, config *upstreamldap.ProviderConfig) *v1alpha1.Condition {
+	secretName := upstream.Spec.Kerberos.KeytabSecretName
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeKerberosKeytabValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonNotFound,
+			Message: err.Error(),
+		}
+	}
+
+	if secret.Type != kerberosKeytabSecretType {
+		return &v1alpha1.Condition{
+			Type:   typeKerberosKeytabValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: upstreamwatchers.ReasonWrongType,
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)",
+				secretName, secret.Type, kerberosKeytabSecretType),
+		}
+	}
+
+	keytabBytes := secret.Data[kerberosKeytabSecretDataKey]
+	if len(keytabBytes) == 0 {
+		return &v1alpha1.Condition{
+			Type:   typeKerberosKeytabValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: upstreamwatchers.ReasonMissingKeys,
+			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q",
+				secretName, []string{kerberosKeytabSecretDataKey}),
+		}
+	}
+
+	kt := keytab.New()
+	if err := kt.Unmarshal(keytabBytes); err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeKerberosKeytabValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidKeytab,
+			Message: fmt.Sprintf("referenced Secret %q has an invalid keytab: %s", secretName, err.Error()),
+		}
+	}
+
+	servicePrincipalName := upstream.Spec.Kerberos.ServicePrincipalName
+	if !keytabHasPrincipal(kt, servicePrincipalName) {
+		return &v1alpha1.Condition{
+			Type:    typeKerberosKeytabValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidKeytab,
+			Message: fmt.Sprintf("referenced Secret %q has a keytab without keys for service principal %q", secretName, servicePrincipalName),
+		}
+	}
+
+	config.KerberosKeytab = kt
+	config.KerberosServicePrincipalName = servicePrincipalName
+	return &v1alpha1.Condition{
+		Type:    typeKerberosKeytabValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded kerberos keytab",
+	}
+}
+
+// keytabHasPrincipal returns true when the keytab contains a key for the named principal, or when the name is
+// empty and the keytab contains any key at all.
+func keytabHasPrincipal(kt *keytab.Keytab, principalName string) bool {
+	wantName, _ := krb5types.ParseSPNString(principalName)
+	for _, entry := range kt.Entries {
+		if principalName == "" || strings.Join(entry.Principal.Components, "/") == wantName.PrincipalNameString() {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *activeDirectoryWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.ActiveDirectoryIdentityProvider, conditions []*v1alpha1.Condition) {
 	log := klogr.New().WithValues("namespace", upstream.Namespace, "name", upstream.Name)
 	updated := upstream.DeepCopy()
@@ -404,6 +537,43 @@ func microsoftUUIDFromBinary(binaryUUID []byte) (string, error) {
 	return uuidVal.String(), nil
 }
 
+func microsoftSIDFromBinaryAttr(attributeName string) func(entry *ldap.Entry) (string, error) {
+	return func(entry *ldap.Entry) (string, error) {
+		binarySIDs := entry.GetRawAttributeValues(attributeName)
+		if len(binarySIDs) != 1 {
+			return "", fmt.Errorf(`found %d values for attribute %q, but expected 1 result`, len(binarySIDs), attributeName)
+		}
+		return microsoftSIDFromBinary(binarySIDs[0])
+	}
+}
+
+// microsoftSIDFromBinary converts a SID from its binary form to its string form, e.g. "S-1-5-21-...-512".
+// See https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-dtyp/f992ad60-0fe4-4b87-9fed-beb478836861.
+func microsoftSIDFromBinary(binarySID []byte) (string, error) {
+	if len(binarySID) < 8 {
+		return "", fmt.Errorf("SID is too short: %d bytes", len(binarySID))
+	}
+	revision := binarySID[0]
+	subAuthorityCount := int(binarySID[1])
+	if len(binarySID) != 8+4*subAuthorityCount {
+		return "", fmt.Errorf("SID has %d bytes, but expected %d bytes for %d sub-authorities",
+			len(binarySID), 8+4*subAuthorityCount, subAuthorityCount)
+	}
+
+	// The identifier authority is big-endian, while the sub-authorities are little-endian.
+	var authority uint64
+	for _, b := range binarySID[2:8] {
+		authority = authority<<8 | uint64(b)
+	}
+
+	var sid strings.Builder
+	fmt.Fprintf(&sid, "S-%d-%d", revision, authority)
+	for i := 0; i < subAuthorityCount; i++ {
+		fmt.Fprintf(&sid, "-%d", binary.LittleEndian.Uint32(binarySID[8+4*i:]))
+	}
+	return sid.String(), nil
+}
+
 func groupSAMAccountNameWithDomainSuffix(entry *ldap.Entry) (string, error) {
 	sAMAccountNameAttributeValues := entry.GetAttributeValues(sAMAccountNameAttribute)
 
@@ -15,6 +15,7 @@ import (
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/golang/mock/gomock"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -55,6 +56,26 @@ func TestActiveDirectoryUpstreamWatcherControllerFilterSecrets(t *testing.T) {
 			wantUpdate: true,
 			wantDelete: true,
 		},
+		{
+			name: "a client certificate secret",
+			secret: &corev1.Secret{
+				Type:       corev1.SecretTypeTLS,
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
+		{
+			name: "a kerberos keytab secret",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/kerberos-keytab",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
 		{
 			name: "a secret of the wrong type",
 			secret: &corev1.Secret{
@@ -163,6 +184,9 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 		testUsernameAttrName  = "test-username-attr"
 		testGroupNameAttrName = "test-group-name-attr"
 		testUIDAttrName       = "test-uid-attr"
+		testKeytabSecretName  = "test-keytab-secret"
+		testKerberosRealm     = "EXAMPLE.COM"
+		testKerberosSPN       = "HTTP/supervisor.example.com"
 	)
 
 	testValidSecretData := map[string][]byte{"username": []byte(testBindUsername), "password": []byte(testBindPassword)}
@@ -170,6 +194,11 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 	testCA, err := certauthority.New("test CA", time.Minute)
 	require.NoError(t, err)
 	testCABundle := testCA.Bundle()
+
+	testKeytab := testutil.NewTestKDC(t, testKerberosRealm, testKerberosSPN).Keytab(t)
+	testParsedKeytab := keytab.New()
+	require.NoError(t, testParsedKeytab.Unmarshal(testKeytab))
+	testKeytabForOtherPrincipal := testutil.NewTestKDC(t, testKerberosRealm, "HTTP/other.example.com").Keytab(t)
 	testCABundleBase64Encoded := base64.StdEncoding.EncodeToString(testCABundle)
 
 	validUpstream := &v1alpha1.ActiveDirectoryIdentityProvider{
@@ -322,6 +351,43 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 		}
 	}
 
+	kerberosKeytabValidTrueCondition := func(gen int64) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               "KerberosKeytabValid",
+			Status:             "True",
+			LastTransitionTime: now,
+			Reason:             "Success",
+			Message:            "loaded kerberos keytab",
+			ObservedGeneration: gen,
+		}
+	}
+
+	kerberosKeytabValidFalseCondition := func(gen int64, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               "KerberosKeytabValid",
+			Status:             "False",
+			LastTransitionTime: now,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: gen,
+		}
+	}
+
+	validUpstreamWithKerberos := editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+		upstream.Spec.Kerberos = &v1alpha1.ActiveDirectoryIdentityProviderKerberos{
+			KeytabSecretName:     testKeytabSecretName,
+			ServicePrincipalName: testKerberosSPN,
+		}
+	})
+
+	keytabSecret := func(secretType corev1.SecretType, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: testKeytabSecretName, Namespace: testNamespace},
+			Type:       secretType,
+			Data:       data,
+		}
+	}
+
 	validBindUserSecret := func(secretVersion string) *corev1.Secret {
 		return &corev1.Secret{
 			ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testNamespace, ResourceVersion: secretVersion},
@@ -401,6 +467,54 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
 			}},
 		},
+		{
+			name: "domain controller discovery is passed through to the provider, and the health of the hosts is reported",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.DomainControllerDiscovery = &v1alpha1.ActiveDirectoryIdentityProviderDomainControllerDiscovery{
+					Domain: "corp.example.com",
+				}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind, and then a health check dial of the host.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(2)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{func() *upstreamldap.ProviderConfig {
+				config := *providerConfigForValidUpstreamWithTLS
+				config.SRVDomain = "corp.example.com"
+				return &config
+			}()},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						{
+							Type:               "HostsHealthy",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "no recent errors connecting to any host",
+							ObservedGeneration: 1234,
+						},
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
 		{
 			name:               "missing secret",
 			inputUpstreams:     []runtime.Object{validUpstream},
@@ -445,7 +559,7 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 							Status:             "False",
 							LastTransitionTime: now,
 							Reason:             "SecretWrongType",
-							Message:            fmt.Sprintf(`referenced Secret "%s" has wrong type "some-other-type" (should be "kubernetes.io/basic-auth")`, testSecretName),
+							Message:            fmt.Sprintf(`referenced Secret "%s" has wrong type "some-other-type" (should be "kubernetes.io/basic-auth" or "kubernetes.io/tls")`, testSecretName),
 							ObservedGeneration: 1234,
 						},
 						tlsConfigurationValidLoadedTrueCondition(1234),
@@ -480,6 +594,222 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				},
 			}},
 		},
+		{
+			name:           "valid upstream with a valid kerberos keytab",
+			inputUpstreams: []runtime.Object{validUpstreamWithKerberos},
+			inputSecrets: []runtime.Object{
+				validBindUserSecret("4242"),
+				keytabSecret("secrets.pinniped.dev/kerberos-keytab", map[string][]byte{"keytab": testKeytab}),
+			},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{func() *upstreamldap.ProviderConfig {
+				config := *providerConfigForValidUpstreamWithTLS
+				config.KerberosKeytab = testParsedKeytab
+				config.KerberosServicePrincipalName = testKerberosSPN
+				return &config
+			}()},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						kerberosKeytabValidTrueCondition(1234),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
+		{
+			name:           "kerberos keytab secret is missing",
+			inputUpstreams: []runtime.Object{validUpstreamWithKerberos},
+			inputSecrets:   []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						kerberosKeytabValidFalseCondition(1234, "SecretNotFound",
+							fmt.Sprintf(`secret "%s" not found`, testKeytabSecretName)),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
+		{
+			name:           "kerberos keytab secret has wrong type",
+			inputUpstreams: []runtime.Object{validUpstreamWithKerberos},
+			inputSecrets:   []runtime.Object{validBindUserSecret("4242"), keytabSecret(corev1.SecretTypeOpaque, map[string][]byte{"keytab": testKeytab})},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						kerberosKeytabValidFalseCondition(1234, "SecretWrongType",
+							fmt.Sprintf(`referenced Secret "%s" has wrong type "Opaque" (should be "secrets.pinniped.dev/kerberos-keytab")`, testKeytabSecretName)),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
+		{
+			name:           "kerberos keytab secret is missing key",
+			inputUpstreams: []runtime.Object{validUpstreamWithKerberos},
+			inputSecrets:   []runtime.Object{validBindUserSecret("4242"), keytabSecret("secrets.pinniped.dev/kerberos-keytab", nil)},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						kerberosKeytabValidFalseCondition(1234, "SecretMissingKeys",
+							fmt.Sprintf(`referenced Secret "%s" is missing required keys ["keytab"]`, testKeytabSecretName)),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
+		{
+			name:           "kerberos keytab secret contains an invalid keytab",
+			inputUpstreams: []runtime.Object{validUpstreamWithKerberos},
+			inputSecrets:   []runtime.Object{validBindUserSecret("4242"), keytabSecret("secrets.pinniped.dev/kerberos-keytab", map[string][]byte{"keytab": []byte("not a keytab")})},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						kerberosKeytabValidFalseCondition(1234, "InvalidKeytab",
+							fmt.Sprintf(`referenced Secret "%s" has an invalid keytab: invalid keytab data. First byte does not equal 5`, testKeytabSecretName)),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
+		{
+			name:           "kerberos keytab secret contains a keytab for a different service principal",
+			inputUpstreams: []runtime.Object{validUpstreamWithKerberos},
+			inputSecrets:   []runtime.Object{validBindUserSecret("4242"), keytabSecret("secrets.pinniped.dev/kerberos-keytab", map[string][]byte{"keytab": testKeytabForOtherPrincipal})},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						kerberosKeytabValidFalseCondition(1234, "InvalidKeytab",
+							fmt.Sprintf(`referenced Secret "%s" has a keytab without keys for service principal "%s"`, testKeytabSecretName, testKerberosSPN)),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
 		{
 			name: "CertificateAuthorityData is not base64 encoded",
 			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
@@ -1507,6 +1837,65 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
 			}},
 		},
+		{
+			name: "when the input activedirectoryidentityprovider uses tokenGroups and names groups by objectSid, pass them through to the provider",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.GroupSearch.UseTokenGroups = true
+				upstream.Spec.GroupSearch.Attributes.GroupName = "objectSid"
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch: upstreamldap.UserSearchConfig{
+						Base:              testUserSearchBase,
+						Filter:            testUserSearchFilter,
+						UsernameAttribute: testUsernameAttrName,
+						UIDAttribute:      testUIDAttrName,
+					},
+					GroupSearch: upstreamldap.GroupSearchConfig{
+						Base:               testGroupSearchBase,
+						Filter:             testGroupSearchFilter,
+						GroupNameAttribute: "objectSid",
+						UseTokenGroups:     true,
+					},
+					UIDAttributeParsingOverrides:   map[string]func(*ldap.Entry) (string, error){"objectGUID": microsoftUUIDFromBinaryAttr("objectGUID")},
+					GroupAttributeParsingOverrides: map[string]func(*ldap.Entry) (string, error){"objectSid": microsoftSIDFromBinaryAttr("objectSid")},
+					RefreshAttributeChecks: map[string]func(*ldap.Entry, provider.StoredRefreshAttributes) error{
+						"pwdLastSet":                         upstreamldap.AttributeUnchangedSinceLogin("pwdLastSet"),
+						"userAccountControl":                 validUserAccountControl,
+						"msDS-User-Account-Control-Computed": validComputedUserAccountControl,
+					},
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: testResourceUID, Generation: 1234},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase:      "Ready",
+					Conditions: allConditionsTrue(1234, "4242"),
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
 		{
 			name: "when the input activedirectoryidentityprovider leaves user and group search base blank, query for defaultNamingContext",
 			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
@@ -1977,6 +2366,75 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
 			}},
 		},
+		{
+			name: "caching groups for refreshes is valid",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.ActiveDirectoryIdentityProvider) {
+				upstream.Spec.GroupSearch.CacheTTLSeconds = 300
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch: upstreamldap.UserSearchConfig{
+						Base:              testUserSearchBase,
+						Filter:            testUserSearchFilter,
+						UsernameAttribute: testUsernameAttrName,
+						UIDAttribute:      testUIDAttrName,
+					},
+					GroupSearch: upstreamldap.GroupSearchConfig{
+						Base:               testGroupSearchBase,
+						Filter:             testGroupSearchFilter,
+						GroupNameAttribute: testGroupNameAttrName,
+						CacheTTL:           5 * time.Minute,
+					},
+					UIDAttributeParsingOverrides: map[string]func(*ldap.Entry) (string, error){"objectGUID": microsoftUUIDFromBinaryAttr("objectGUID")},
+					RefreshAttributeChecks: map[string]func(*ldap.Entry, provider.StoredRefreshAttributes) error{
+						"pwdLastSet":                         upstreamldap.AttributeUnchangedSinceLogin("pwdLastSet"),
+						"userAccountControl":                 validUserAccountControl,
+						"msDS-User-Account-Control-Computed": validComputedUserAccountControl,
+					},
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.ActiveDirectoryIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.ActiveDirectoryIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						activeDirectoryConnectionValidTrueCondition(1234, "4242"),
+						searchBaseFoundInConfigCondition(1234),
+						{
+							Type:               "TLSConfigurationValid",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "loaded TLS configuration",
+							ObservedGeneration: 1234,
+						},
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(activeDirectoryConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+				SearchBaseFoundCondition:  condPtr(withoutTime(searchBaseFoundInConfigCondition(0))),
+			}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -2055,6 +2513,18 @@ func TestActiveDirectoryUpstreamWatcherControllerSync(t *testing.T) {
 				// The dialer that was passed in to the controller's constructor should always have been
 				// passed through to the provider.
 				copyOfExpectedValueForResultingCache.Dialer = dialer
+				// The health of the hosts is remembered by the controller, and it should have been passed through
+				// to providers which have failover hosts.
+				if copyOfExpectedValueForResultingCache.HasFailoverHosts() {
+					require.NotNil(t, actualIDP.GetConfig().HostHealth)
+					copyOfExpectedValueForResultingCache.HostHealth = actualIDP.GetConfig().HostHealth
+				}
+				// The cached groups are remembered by the controller, and they should have been passed through to
+				// providers which cache their groups.
+				if copyOfExpectedValueForResultingCache.GroupSearch.CacheTTL > 0 {
+					require.NotNil(t, actualIDP.GetConfig().GroupCache)
+					copyOfExpectedValueForResultingCache.GroupCache = actualIDP.GetConfig().GroupCache
+				}
 
 				// function equality is awkward. Do the check for equality separately from the rest of the config.
 				expectedUIDAttributeParsingOverrides := copyOfExpectedValueForResultingCache.UIDAttributeParsingOverrides
@@ -2234,6 +2704,49 @@ func TestGetMicrosoftFormattedUUID(t *testing.T) {
 	}
 }
 
+func TestGetMicrosoftFormattedSID(t *testing.T) {
+	tests := []struct {
+		name      string
+		binarySID []byte
+		wantSID   string
+		wantErr   string
+	}{
+		{
+			name:      "happy path",
+			binarySID: []byte("\x01\x05\x00\x00\x00\x00\x00\x05\x15\x00\x00\x00\xdc\xf4\xdc\x3b\x83\x3d\x2b\x46\x82\x8b\xa6\x28\x00\x02\x00\x00"),
+			wantSID:   "S-1-5-21-1004336348-1177238915-682003330-512",
+		},
+		{
+			name:      "no sub-authorities",
+			binarySID: []byte("\x01\x00\x00\x00\x00\x00\x00\x01"),
+			wantSID:   "S-1-1",
+		},
+		{
+			name:      "too short",
+			binarySID: []byte("\x01\x01\x00"),
+			wantErr:   "SID is too short: 3 bytes",
+		},
+		{
+			name:      "not the right length for the number of sub-authorities",
+			binarySID: []byte("\x01\x02\x00\x00\x00\x00\x00\x05\x15\x00\x00\x00"),
+			wantErr:   "SID has 12 bytes, but expected 16 bytes for 2 sub-authorities",
+		},
+	}
+
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			actualSID, err := microsoftSIDFromBinary(tt.binarySID)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.wantSID, actualSID)
+		})
+	}
+}
+
 func TestGetDomainFromDistinguishedName(t *testing.T) {
 	tests := []struct {
 		name              string
@@ -12,6 +12,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/errors"
+	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/util/retry"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/clock"
@@ -21,7 +22,11 @@ import (
 	configinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/config/v1alpha1"
 	pinnipedcontroller "go.pinniped.dev/internal/controller"
 	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc/certbinding"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/tokenexchange"
 	"go.pinniped.dev/internal/plog"
 )
 
@@ -37,15 +42,18 @@ type federationDomainWatcherController struct {
 	clock                    clock.Clock
 	client                   pinnipedclientset.Interface
 	federationDomainInformer configinformers.FederationDomainInformer
+	configMapInformer        corev1informers.ConfigMapInformer
 }
 
 // NewFederationDomainWatcherController creates a controllerlib.Controller that watches
 // FederationDomain objects and notifies a callback object of the collection of provider configs.
+// It also watches ConfigMaps because FederationDomains may refer to a ConfigMap for their branding.
 func NewFederationDomainWatcherController(
 	providerSetter ProvidersSetter,
 	clock clock.Clock,
 	client pinnipedclientset.Interface,
 	federationDomainInformer configinformers.FederationDomainInformer,
+	configMapInformer corev1informers.ConfigMapInformer,
 	withInformer pinnipedcontroller.WithInformerOptionFunc,
 ) controllerlib.Controller {
 	return controllerlib.New(
@@ -56,6 +64,7 @@ func NewFederationDomainWatcherController(
 				clock:                    clock,
 				client:                   client,
 				federationDomainInformer: federationDomainInformer,
+				configMapInformer:        configMapInformer,
 			},
 		},
 		withInformer(
@@ -63,6 +72,11 @@ func NewFederationDomainWatcherController(
 			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
 			controllerlib.InformerOption{},
 		),
+		withInformer(
+			configMapInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
 	)
 }
 
@@ -143,7 +157,55 @@ func (c *federationDomainWatcherController) Sync(ctx controllerlib.Context) erro
 			continue
 		}
 
-		federationDomainIssuer, err := provider.NewFederationDomainIssuer(federationDomain.Spec.Issuer) // This validates the Issuer URL.
+		brand, err := c.loadBranding(federationDomain)
+		if err != nil {
+			if err := c.updateStatus(
+				ctx.Context,
+				federationDomain.Namespace,
+				federationDomain.Name,
+				configv1alpha1.InvalidFederationDomainStatusCondition,
+				"Invalid: "+err.Error(),
+			); err != nil {
+				errs = append(errs, fmt.Errorf("could not update status: %w", err))
+			}
+			continue
+		}
+
+		securityHeaders, err := securityHeadersPolicy(federationDomain)
+		if err != nil {
+			if err := c.updateStatus(
+				ctx.Context,
+				federationDomain.Namespace,
+				federationDomain.Name,
+				configv1alpha1.InvalidFederationDomainStatusCondition,
+				"Invalid: "+err.Error(),
+			); err != nil {
+				errs = append(errs, fmt.Errorf("could not update status: %w", err))
+			}
+			continue
+		}
+
+		tokenExchange, err := tokenExchangePolicy(federationDomain)
+		if err != nil {
+			if err := c.updateStatus(
+				ctx.Context,
+				federationDomain.Namespace,
+				federationDomain.Name,
+				configv1alpha1.InvalidFederationDomainStatusCondition,
+				"Invalid: "+err.Error(),
+			); err != nil {
+				errs = append(errs, fmt.Errorf("could not update status: %w", err))
+			}
+			continue
+		}
+
+		federationDomainIssuer, err := provider.NewFederationDomainIssuer( // This validates the Issuer URL.
+			federationDomain.Spec.Issuer,
+			brand,
+			securityHeaders,
+			certificateBinding(federationDomain),
+			tokenExchange,
+		)
 		if err != nil {
 			if err := c.updateStatus(
 				ctx.Context,
@@ -176,6 +238,96 @@ func (c *federationDomainWatcherController) Sync(ctx controllerlib.Context) erro
 	return errors.NewAggregate(errs)
 }
 
+// loadBranding returns the validated branding of the FederationDomain, or nil when it does not have any branding.
+func (c *federationDomainWatcherController) loadBranding(federationDomain *configv1alpha1.FederationDomain) (*branding.Branding, error) {
+	if federationDomain.Spec.Branding == nil {
+		return nil, nil
+	}
+
+	configMapName := federationDomain.Spec.Branding.ConfigMapName
+	configMap, err := c.configMapInformer.Lister().ConfigMaps(federationDomain.Namespace).Get(configMapName)
+	if err != nil {
+		return nil, fmt.Errorf("could not get branding ConfigMap %q: %w", configMapName, err)
+	}
+
+	brand, err := branding.New(configMap.Data, configMap.BinaryData)
+	if err != nil {
+		return nil, fmt.Errorf("branding ConfigMap %q is not valid: %w", configMapName, err)
+	}
+
+	return brand, nil
+}
+
+// securityHeadersPolicy returns the validated overrides of the security headers of the FederationDomain, or nil
+// when it does not override any.
+func securityHeadersPolicy(federationDomain *configv1alpha1.FederationDomain) (*securityheader.Policy, error) {
+	spec := federationDomain.Spec.SecurityHeaders
+	if spec == nil {
+		return nil, nil
+	}
+
+	policy := securityheader.Policy{
+		ContentSecurityPolicy:     spec.ContentSecurityPolicy,
+		PermissionsPolicy:         spec.PermissionsPolicy,
+		CrossOriginOpenerPolicy:   spec.CrossOriginOpenerPolicy,
+		CrossOriginEmbedderPolicy: spec.CrossOriginEmbedderPolicy,
+	}
+	if hsts := spec.StrictTransportSecurity; hsts != nil {
+		policy.StrictTransportSecurity = &securityheader.StrictTransportSecurity{
+			MaxAgeSeconds:     hsts.MaxAgeSeconds,
+			IncludeSubDomains: hsts.IncludeSubDomains,
+			Preload:           hsts.Preload,
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("securityHeaders are not valid: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// certificateBinding returns whether the tokens of the FederationDomain are bound to client certificates.
+// Unknown values are rejected by the CRD validation.
+func certificateBinding(federationDomain *configv1alpha1.FederationDomain) certbinding.Mode {
+	if federationDomain.Spec.Tokens == nil {
+		return certbinding.Disabled
+	}
+	switch federationDomain.Spec.Tokens.CertificateBinding {
+	case configv1alpha1.OptionalFederationDomainCertificateBinding:
+		return certbinding.Optional
+	case configv1alpha1.RequiredFederationDomainCertificateBinding:
+		return certbinding.Required
+	case configv1alpha1.DisabledFederationDomainCertificateBinding:
+		return certbinding.Disabled
+	default:
+		return certbinding.Disabled
+	}
+}
+
+// tokenExchangePolicy returns the validated token exchange policy of the FederationDomain, or nil when any client
+// may request any audience.
+func tokenExchangePolicy(federationDomain *configv1alpha1.FederationDomain) (*tokenexchange.Policy, error) {
+	if federationDomain.Spec.Tokens == nil || federationDomain.Spec.Tokens.TokenExchange == nil {
+		return nil, nil
+	}
+
+	clients := make([]tokenexchange.ClientPolicy, 0, len(federationDomain.Spec.Tokens.TokenExchange.Clients))
+	for _, client := range federationDomain.Spec.Tokens.TokenExchange.Clients {
+		clients = append(clients, tokenexchange.ClientPolicy{
+			ClientID:         client.ClientID,
+			AllowedAudiences: client.AllowedAudiences,
+		})
+	}
+
+	policy, err := tokenexchange.NewPolicy(clients)
+	if err != nil {
+		return nil, fmt.Errorf("tokens.tokenExchange is not valid: %w", err)
+	}
+
+	return policy, nil
+}
+
 func (c *federationDomainWatcherController) updateStatus(
 	ctx context.Context,
 	namespace, name string,
@@ -16,10 +16,13 @@ import (
 	"github.com/sclevine/spec"
 	"github.com/sclevine/spec/report"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	kubeinformers "k8s.io/client-go/informers"
+	kubernetesfake "k8s.io/client-go/kubernetes/fake"
 	coretesting "k8s.io/client-go/testing"
 	clocktesting "k8s.io/utils/clock/testing"
 
@@ -28,7 +31,11 @@ import (
 	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
 	"go.pinniped.dev/internal/controllerlib"
 	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc/certbinding"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/tokenexchange"
 	"go.pinniped.dev/internal/testutil"
 )
 
@@ -37,19 +44,42 @@ func TestInformerFilters(t *testing.T) {
 		var r *require.Assertions
 		var observableWithInformerOption *testutil.ObservableWithInformerOption
 		var configMapInformerFilter controllerlib.Filter
+		var brandingConfigMapInformerFilter controllerlib.Filter
 
 		it.Before(func() {
 			r = require.New(t)
 			observableWithInformerOption = testutil.NewObservableWithInformerOption()
 			federationDomainInformer := pinnipedinformers.NewSharedInformerFactoryWithOptions(nil, 0).Config().V1alpha1().FederationDomains()
+			brandingConfigMapInformer := kubeinformers.NewSharedInformerFactoryWithOptions(nil, 0).Core().V1().ConfigMaps()
 			_ = NewFederationDomainWatcherController(
 				nil,
 				nil,
 				nil,
 				federationDomainInformer,
+				brandingConfigMapInformer,
 				observableWithInformerOption.WithInformer, // make it possible to observe the behavior of the Filters
 			)
 			configMapInformerFilter = observableWithInformerOption.GetFilterForInformer(federationDomainInformer)
+			brandingConfigMapInformerFilter = observableWithInformerOption.GetFilterForInformer(brandingConfigMapInformer)
+		})
+
+		when("watching ConfigMap objects", func() {
+			var subject controllerlib.Filter
+			var target, otherName *corev1.ConfigMap
+
+			it.Before(func() {
+				subject = brandingConfigMapInformerFilter
+				target = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"}}
+				otherName = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other-name", Namespace: "some-namespace"}}
+			})
+
+			when("any ConfigMap changes", func() {
+				it("returns true to trigger the sync method", func() {
+					r.True(subject.Add(target))
+					r.True(subject.Update(target, otherName))
+					r.True(subject.Delete(target))
+				})
+			})
 		})
 
 		when("watching FederationDomain objects", func() {
@@ -102,6 +132,8 @@ func TestSync(t *testing.T) {
 		var subject controllerlib.Controller
 		var federationDomainInformerClient *pinnipedfake.Clientset
 		var federationDomainInformers pinnipedinformers.SharedInformerFactory
+		var kubeInformerClient *kubernetesfake.Clientset
+		var kubeInformers kubeinformers.SharedInformerFactory
 		var pinnipedAPIClient *pinnipedfake.Clientset
 		var cancelContext context.Context
 		var cancelContextCancelFunc context.CancelFunc
@@ -119,6 +151,7 @@ func TestSync(t *testing.T) {
 				clocktesting.NewFakeClock(frozenNow),
 				pinnipedAPIClient,
 				federationDomainInformers.Config().V1alpha1().FederationDomains(),
+				kubeInformers.Core().V1().ConfigMaps(),
 				controllerlib.WithInformer,
 			)
 
@@ -134,6 +167,7 @@ func TestSync(t *testing.T) {
 
 			// Must start informers before calling TestRunSynchronously()
 			federationDomainInformers.Start(cancelContext.Done())
+			kubeInformers.Start(cancelContext.Done())
 			controllerlib.TestRunSynchronously(t, subject)
 		}
 
@@ -147,6 +181,8 @@ func TestSync(t *testing.T) {
 
 			federationDomainInformerClient = pinnipedfake.NewSimpleClientset()
 			federationDomainInformers = pinnipedinformers.NewSharedInformerFactory(federationDomainInformerClient, 0)
+			kubeInformerClient = kubernetesfake.NewSimpleClientset()
+			kubeInformers = kubeinformers.NewSharedInformerFactory(kubeInformerClient, 0)
 			pinnipedAPIClient = pinnipedfake.NewSimpleClientset()
 
 			federationDomainGVR = schema.GroupVersionResource{
@@ -187,10 +223,10 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer)
+				provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 
-				provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer)
+				provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -288,10 +324,10 @@ func TestSync(t *testing.T) {
 					err := controllerlib.TestSync(t, subject, *syncContext)
 					r.NoError(err)
 
-					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer)
+					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 					r.NoError(err)
 
-					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer)
+					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 					r.NoError(err)
 
 					r.True(providersSetter.SetProvidersWasCalled)
@@ -326,10 +362,10 @@ func TestSync(t *testing.T) {
 					err := controllerlib.TestSync(t, subject, *syncContext)
 					r.EqualError(err, "could not update status: some update error")
 
-					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer)
+					provider1, err := provider.NewFederationDomainIssuer(federationDomain1.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 					r.NoError(err)
 
-					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer)
+					provider2, err := provider.NewFederationDomainIssuer(federationDomain2.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 					r.NoError(err)
 
 					r.True(providersSetter.SetProvidersWasCalled)
@@ -518,6 +554,346 @@ func TestSync(t *testing.T) {
 			})
 		})
 
+		when("there are FederationDomains with branding in the informer", func() {
+			var (
+				brandedFederationDomain         *v1alpha1.FederationDomain
+				missingBrandingFederationDomain *v1alpha1.FederationDomain
+				invalidBrandingFederationDomain *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				r.NoError(kubeInformerClient.Tracker().Add(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "branding", Namespace: namespace},
+					Data:       map[string]string{"style.css": "body { color: red; }"},
+				}))
+				r.NoError(kubeInformerClient.Tracker().Add(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "invalid-branding", Namespace: namespace},
+					Data:       map[string]string{"header.gohtml": "<script>alert(1)</script>"},
+				}))
+
+				brandedFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "branded-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer:   "https://branded-issuer.com",
+						Branding: &v1alpha1.FederationDomainBrandingSpec{ConfigMapName: "branding"},
+					},
+				}
+				missingBrandingFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "missing-branding-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer:   "https://missing-branding-issuer.com",
+						Branding: &v1alpha1.FederationDomainBrandingSpec{ConfigMapName: "does-not-exist"},
+					},
+				}
+				invalidBrandingFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "invalid-branding-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer:   "https://invalid-branding-issuer.com",
+						Branding: &v1alpha1.FederationDomainBrandingSpec{ConfigMapName: "invalid-branding"},
+					},
+				}
+				for _, federationDomain := range []*v1alpha1.FederationDomain{brandedFederationDomain, missingBrandingFederationDomain, invalidBrandingFederationDomain} {
+					r.NoError(pinnipedAPIClient.Tracker().Add(federationDomain))
+					r.NoError(federationDomainInformerClient.Tracker().Add(federationDomain))
+				}
+			})
+
+			it("calls the ProvidersSetter with the provider whose branding is valid", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				brand, err := branding.New(map[string]string{"style.css": "body { color: red; }"}, nil)
+				r.NoError(err)
+				brandedProvider, err := provider.NewFederationDomainIssuer(brandedFederationDomain.Spec.Issuer, brand, nil, certbinding.Disabled, nil)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.Equal(
+					[]*provider.FederationDomainIssuer{
+						brandedProvider,
+					},
+					providersSetter.FederationDomainsReceived,
+				)
+			})
+
+			it("updates the status to success/invalid in the FederationDomains", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				brandedFederationDomain.Status.Status = v1alpha1.SuccessFederationDomainStatusCondition
+				brandedFederationDomain.Status.Message = "Provider successfully created"
+				brandedFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				missingBrandingFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+				missingBrandingFederationDomain.Status.Message = `Invalid: could not get branding ConfigMap "does-not-exist": configmap "does-not-exist" not found`
+				missingBrandingFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				invalidBrandingFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+				invalidBrandingFederationDomain.Status.Message = `Invalid: branding ConfigMap "invalid-branding" is not valid: key "header.gohtml" is not allowed: element "script" is not allowed`
+				invalidBrandingFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				var expectedActions []coretesting.Action
+				for _, federationDomain := range []*v1alpha1.FederationDomain{brandedFederationDomain, missingBrandingFederationDomain, invalidBrandingFederationDomain} {
+					expectedActions = append(expectedActions,
+						coretesting.NewGetAction(
+							federationDomainGVR,
+							federationDomain.Namespace,
+							federationDomain.Name,
+						),
+						coretesting.NewUpdateSubresourceAction(
+							federationDomainGVR,
+							"status",
+							federationDomain.Namespace,
+							federationDomain,
+						),
+					)
+				}
+				r.ElementsMatch(expectedActions, pinnipedAPIClient.Actions())
+			})
+		})
+
+		when("there are FederationDomains with security headers in the informer", func() {
+			var (
+				securityHeadersFederationDomain        *v1alpha1.FederationDomain
+				invalidSecurityHeadersFederationDomain *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				securityHeadersFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "security-headers-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://security-headers-issuer.com",
+						SecurityHeaders: &v1alpha1.FederationDomainSecurityHeadersSpec{
+							StrictTransportSecurity: &v1alpha1.FederationDomainStrictTransportSecuritySpec{MaxAgeSeconds: 60, IncludeSubDomains: true},
+							PermissionsPolicy:       "camera=()",
+							CrossOriginOpenerPolicy: "same-origin",
+						},
+					},
+				}
+				invalidSecurityHeadersFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "invalid-security-headers-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://invalid-security-headers-issuer.com",
+						SecurityHeaders: &v1alpha1.FederationDomainSecurityHeadersSpec{
+							StrictTransportSecurity: &v1alpha1.FederationDomainStrictTransportSecuritySpec{MaxAgeSeconds: 60, Preload: true},
+						},
+					},
+				}
+				for _, federationDomain := range []*v1alpha1.FederationDomain{securityHeadersFederationDomain, invalidSecurityHeadersFederationDomain} {
+					r.NoError(pinnipedAPIClient.Tracker().Add(federationDomain))
+					r.NoError(federationDomainInformerClient.Tracker().Add(federationDomain))
+				}
+			})
+
+			it("calls the ProvidersSetter with the provider whose security headers are valid", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				securityHeadersProvider, err := provider.NewFederationDomainIssuer(securityHeadersFederationDomain.Spec.Issuer, nil, &securityheader.Policy{
+					StrictTransportSecurity: &securityheader.StrictTransportSecurity{MaxAgeSeconds: 60, IncludeSubDomains: true},
+					PermissionsPolicy:       "camera=()",
+					CrossOriginOpenerPolicy: "same-origin",
+				}, certbinding.Disabled, nil)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.Equal(
+					[]*provider.FederationDomainIssuer{
+						securityHeadersProvider,
+					},
+					providersSetter.FederationDomainsReceived,
+				)
+			})
+
+			it("updates the status to success/invalid in the FederationDomains", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				securityHeadersFederationDomain.Status.Status = v1alpha1.SuccessFederationDomainStatusCondition
+				securityHeadersFederationDomain.Status.Message = "Provider successfully created"
+				securityHeadersFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				invalidSecurityHeadersFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+				invalidSecurityHeadersFederationDomain.Status.Message = "Invalid: securityHeaders are not valid: strictTransportSecurity.preload requires includeSubDomains and a maxAgeSeconds of at least 31536000"
+				invalidSecurityHeadersFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				var expectedActions []coretesting.Action
+				for _, federationDomain := range []*v1alpha1.FederationDomain{securityHeadersFederationDomain, invalidSecurityHeadersFederationDomain} {
+					expectedActions = append(expectedActions,
+						coretesting.NewGetAction(
+							federationDomainGVR,
+							federationDomain.Namespace,
+							federationDomain.Name,
+						),
+						coretesting.NewUpdateSubresourceAction(
+							federationDomainGVR,
+							"status",
+							federationDomain.Namespace,
+							federationDomain,
+						),
+					)
+				}
+				r.ElementsMatch(expectedActions, pinnipedAPIClient.Actions())
+			})
+		})
+
+		when("there are FederationDomains which bind tokens to client certificates in the informer", func() {
+			var (
+				optionalFederationDomain *v1alpha1.FederationDomain
+				requiredFederationDomain *v1alpha1.FederationDomain
+				defaultFederationDomain  *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				optionalFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "optional-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://optional-issuer.com",
+						Tokens: &v1alpha1.FederationDomainTokensSpec{CertificateBinding: v1alpha1.OptionalFederationDomainCertificateBinding},
+					},
+				}
+				requiredFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "required-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://required-issuer.com",
+						Tokens: &v1alpha1.FederationDomainTokensSpec{CertificateBinding: v1alpha1.RequiredFederationDomainCertificateBinding},
+					},
+				}
+				defaultFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "default-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://default-issuer.com",
+						Tokens: &v1alpha1.FederationDomainTokensSpec{},
+					},
+				}
+				for _, federationDomain := range []*v1alpha1.FederationDomain{optionalFederationDomain, requiredFederationDomain, defaultFederationDomain} {
+					r.NoError(pinnipedAPIClient.Tracker().Add(federationDomain))
+					r.NoError(federationDomainInformerClient.Tracker().Add(federationDomain))
+				}
+			})
+
+			it("calls the ProvidersSetter with the certificate binding of each provider", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				optionalProvider, err := provider.NewFederationDomainIssuer(optionalFederationDomain.Spec.Issuer, nil, nil, certbinding.Optional, nil)
+				r.NoError(err)
+				requiredProvider, err := provider.NewFederationDomainIssuer(requiredFederationDomain.Spec.Issuer, nil, nil, certbinding.Required, nil)
+				r.NoError(err)
+				defaultProvider, err := provider.NewFederationDomainIssuer(defaultFederationDomain.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.ElementsMatch(
+					[]*provider.FederationDomainIssuer{
+						optionalProvider,
+						requiredProvider,
+						defaultProvider,
+					},
+					providersSetter.FederationDomainsReceived,
+				)
+			})
+		})
+
+		when("there are FederationDomains with token exchange policies in the informer", func() {
+			var (
+				tokenExchangeFederationDomain        *v1alpha1.FederationDomain
+				invalidTokenExchangeFederationDomain *v1alpha1.FederationDomain
+			)
+
+			it.Before(func() {
+				tokenExchangeFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "token-exchange-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://token-exchange-issuer.com",
+						Tokens: &v1alpha1.FederationDomainTokensSpec{
+							TokenExchange: &v1alpha1.FederationDomainTokenExchangeSpec{
+								Clients: []v1alpha1.FederationDomainTokenExchangeClientSpec{
+									{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*"}},
+								},
+							},
+						},
+					},
+				}
+				invalidTokenExchangeFederationDomain = &v1alpha1.FederationDomain{
+					ObjectMeta: metav1.ObjectMeta{Name: "invalid-token-exchange-config", Namespace: namespace},
+					Spec: v1alpha1.FederationDomainSpec{
+						Issuer: "https://invalid-token-exchange-issuer.com",
+						Tokens: &v1alpha1.FederationDomainTokensSpec{
+							TokenExchange: &v1alpha1.FederationDomainTokenExchangeSpec{
+								Clients: []v1alpha1.FederationDomainTokenExchangeClientSpec{
+									{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*"}},
+									{ClientID: "pinniped-cli", AllowedAudiences: []string{"other-*"}},
+								},
+							},
+						},
+					},
+				}
+				for _, federationDomain := range []*v1alpha1.FederationDomain{tokenExchangeFederationDomain, invalidTokenExchangeFederationDomain} {
+					r.NoError(pinnipedAPIClient.Tracker().Add(federationDomain))
+					r.NoError(federationDomainInformerClient.Tracker().Add(federationDomain))
+				}
+			})
+
+			it("calls the ProvidersSetter with the provider whose token exchange policy is valid", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				policy, err := tokenexchange.NewPolicy([]tokenexchange.ClientPolicy{
+					{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*"}},
+				})
+				r.NoError(err)
+				tokenExchangeProvider, err := provider.NewFederationDomainIssuer(tokenExchangeFederationDomain.Spec.Issuer, nil, nil, certbinding.Disabled, policy)
+				r.NoError(err)
+
+				r.True(providersSetter.SetProvidersWasCalled)
+				r.Equal(
+					[]*provider.FederationDomainIssuer{
+						tokenExchangeProvider,
+					},
+					providersSetter.FederationDomainsReceived,
+				)
+			})
+
+			it("updates the status to success/invalid in the FederationDomains", func() {
+				startInformersAndController()
+				err := controllerlib.TestSync(t, subject, *syncContext)
+				r.NoError(err)
+
+				tokenExchangeFederationDomain.Status.Status = v1alpha1.SuccessFederationDomainStatusCondition
+				tokenExchangeFederationDomain.Status.Message = "Provider successfully created"
+				tokenExchangeFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				invalidTokenExchangeFederationDomain.Status.Status = v1alpha1.InvalidFederationDomainStatusCondition
+				invalidTokenExchangeFederationDomain.Status.Message = `Invalid: tokens.tokenExchange is not valid: client "pinniped-cli" is listed more than once`
+				invalidTokenExchangeFederationDomain.Status.LastUpdateTime = timePtr(metav1.NewTime(frozenNow))
+
+				var expectedActions []coretesting.Action
+				for _, federationDomain := range []*v1alpha1.FederationDomain{tokenExchangeFederationDomain, invalidTokenExchangeFederationDomain} {
+					expectedActions = append(expectedActions,
+						coretesting.NewGetAction(
+							federationDomainGVR,
+							federationDomain.Namespace,
+							federationDomain.Name,
+						),
+						coretesting.NewUpdateSubresourceAction(
+							federationDomainGVR,
+							"status",
+							federationDomain.Namespace,
+							federationDomain,
+						),
+					)
+				}
+				r.ElementsMatch(expectedActions, pinnipedAPIClient.Actions())
+			})
+		})
+
 		when("there are both valid and invalid FederationDomains in the informer", func() {
 			var (
 				validFederationDomain   *v1alpha1.FederationDomain
@@ -545,7 +921,7 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer)
+				validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -619,7 +995,7 @@ func TestSync(t *testing.T) {
 					err := controllerlib.TestSync(t, subject, *syncContext)
 					r.EqualError(err, "could not update status: some update error")
 
-					validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer)
+					validProvider, err := provider.NewFederationDomainIssuer(validFederationDomain.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 					r.NoError(err)
 
 					r.True(providersSetter.SetProvidersWasCalled)
@@ -709,7 +1085,7 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomain.Spec.Issuer)
+				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomain.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -882,7 +1258,7 @@ func TestSync(t *testing.T) {
 				err := controllerlib.TestSync(t, subject, *syncContext)
 				r.NoError(err)
 
-				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomainDifferentIssuerAddress.Spec.Issuer)
+				nonDuplicateProvider, err := provider.NewFederationDomainIssuer(federationDomainDifferentIssuerAddress.Spec.Issuer, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 
 				r.True(providersSetter.SetProvidersWasCalled)
@@ -0,0 +1,370 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package githubupstreamwatcher implements a controller which watches GitHubIdentityProviders.
+package githubupstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/constable"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/upstreamgithub"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	githubControllerName = "github-upstream-observer"
+
+	// Constants related to the client credentials Secret.
+	githubClientSecretType corev1.SecretType = "secrets.pinniped.dev/github-client"
+
+	clientIDDataKey     = "clientID"
+	clientSecretDataKey = "clientSecret"
+
+	// The default host, which uses different URLs than GitHub Enterprise Server.
+	githubDotComHost = "github.com"
+
+	// Constants related to conditions.
+	typeClientCredentialsValid   = "ClientCredentialsValid" //nolint:gosec // this is not a credential
+	typeHostValid                = "HostValid"
+	typeTLSConfigurationValid    = "TLSConfigurationValid"
+	typeOrganizationsPolicyValid = "OrganizationsPolicyValid"
+
+	reasonInvalidHost   = "InvalidHost"
+	reasonInvalidPolicy = "InvalidPolicy"
+
+	// Errors that are generated by our reconcile process.
+	errGitHubFailureStatus = constable.Error("GitHubIdentityProvider has a failing condition")
+)
+
+// UpstreamGitHubIdentityProviderICache is a thread safe cache that holds a list of validated upstream GitHub IDP configurations.
+type UpstreamGitHubIdentityProviderICache interface {
+	SetGitHubIdentityProviders([]provider.UpstreamGitHubIdentityProviderI)
+}
+
+type githubWatcherController struct {
+	cache                          UpstreamGitHubIdentityProviderICache
+	log                            logr.Logger
+	client                         pinnipedclientset.Interface
+	githubIdentityProviderInformer idpinformers.GitHubIdentityProviderInformer
+	secretInformer                 corev1informers.SecretInformer
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamGitHubIdentityProviderICache.
+func New(
+	idpCache UpstreamGitHubIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	githubIdentityProviderInformer idpinformers.GitHubIdentityProviderInformer,
+	secretInformer corev1informers.SecretInformer,
+	log logr.Logger,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := githubWatcherController{
+		cache:                          idpCache,
+		log:                            log.WithName(githubControllerName),
+		client:                         client,
+		githubIdentityProviderInformer: githubIdentityProviderInformer,
+		secretInformer:                 secretInformer,
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: githubControllerName, Syncer: &c},
+		withInformer(
+			githubIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnySecretOfTypeFilter(githubClientSecretType, pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *githubWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.githubIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list GitHubIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamGitHubIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, provider.UpstreamGitHubIdentityProviderI(valid))
+		}
+	}
+	c.cache.SetGitHubIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.GitHubIdentityProvider and returns the validated configuration as a
+// provider.UpstreamGitHubIdentityProvider. As a side effect, it also updates the status of the v1alpha1.GitHubIdentityProvider.
+func (c *githubWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.GitHubIdentityProvider) *upstreamgithub.ProviderConfig {
+	result := upstreamgithub.ProviderConfig{
+		Name:               upstream.Name,
+		ResourceUID:        upstream.UID,
+		UsernameAttribute:  v1alpha1.GitHubUsernameLoginAndID,
+		GroupNameAttribute: v1alpha1.GitHubGroupNameSlug,
+		OAuth2Config: &oauth2.Config{
+			// "read:user" allows reading the user's profile, and "read:org" allows reading their organization and
+			// team memberships.
+			Scopes: []string{"read:user", "read:org"},
+		},
+	}
+	if upstream.Spec.Claims.Username != nil {
+		result.UsernameAttribute = *upstream.Spec.Claims.Username
+	}
+	if upstream.Spec.Claims.Groups != nil {
+		result.GroupNameAttribute = *upstream.Spec.Claims.Groups
+	}
+
+	conditions := []*v1alpha1.Condition{
+		c.validateSecret(upstream, &result),
+		validateHost(upstream, &result),
+		validateTLS(upstream, &result),
+		validateOrganizationsPolicy(upstream, &result),
+	}
+
+	c.updateStatus(ctx, upstream, conditions)
+
+	valid := true
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	for _, condition := range conditions {
+		if condition.Status == v1alpha1.ConditionFalse {
+			valid = false
+			log.WithValues(
+				"type", condition.Type,
+				"reason", condition.Reason,
+				"message", condition.Message,
+			).Error(errGitHubFailureStatus, "found failing condition")
+		}
+	}
+	if valid {
+		return &result
+	}
+	return nil
+}
+
+// validateSecret validates the .spec.client.secretName field and returns the appropriate ClientCredentialsValid condition.
+func (c *githubWatcherController) validateSecret(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	secretName := upstream.Spec.Client.SecretName
+
+	// Fetch the Secret from informer cache.
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonNotFound,
+			Message: err.Error(),
+		}
+	}
+
+	// Validate the secret .type field.
+	if secret.Type != githubClientSecretType {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonWrongType,
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)", secretName, secret.Type, githubClientSecretType),
+		}
+	}
+
+	// Validate the secret .data field.
+	clientID := secret.Data[clientIDDataKey]
+	clientSecret := secret.Data[clientSecretDataKey]
+	if len(clientID) == 0 || len(clientSecret) == 0 {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonMissingKeys,
+			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q", secretName, []string{clientIDDataKey, clientSecretDataKey}),
+		}
+	}
+
+	// If everything is valid, update the result and set the condition to true.
+	result.OAuth2Config.ClientID = string(clientID)
+	result.OAuth2Config.ClientSecret = string(clientSecret)
+	return &v1alpha1.Condition{
+		Type:    typeClientCredentialsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded client credentials",
+	}
+}
+
+// validateHost validates the .spec.githubAPI.host field, computes the URLs of the GitHub API and OAuth endpoints,
+// and returns the appropriate HostValid condition.
+func validateHost(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	host := githubDotComHost
+	if upstream.Spec.GitHubAPI.Host != nil {
+		host = *upstream.Spec.GitHubAPI.Host
+	}
+
+	hostURL, err := url.Parse("https://" + host)
+	if err != nil || hostURL.Host != host || hostURL.Hostname() == "" {
+		return &v1alpha1.Condition{
+			Type:    typeHostValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidHost,
+			Message: fmt.Sprintf("spec.githubAPI.host (%q) must be a hostname, optionally followed by a port, without a scheme or path", host),
+		}
+	}
+
+	// github.com uses a separate host for its API, while GitHub Enterprise Server serves it from a path.
+	apiURL := &url.URL{Scheme: "https", Host: host, Path: "/api/v3"}
+	if host == githubDotComHost {
+		apiURL = &url.URL{Scheme: "https", Host: "api." + githubDotComHost}
+	}
+	result.APIBaseURL = apiURL
+	result.OAuth2Config.Endpoint = oauth2.Endpoint{
+		AuthURL:   hostURL.String() + "/login/oauth/authorize",
+		TokenURL:  hostURL.String() + "/login/oauth/access_token",
+		AuthStyle: oauth2.AuthStyleInParams,
+	}
+	return &v1alpha1.Condition{
+		Type:    typeHostValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: fmt.Sprintf("spec.githubAPI.host (%q) is valid", host),
+	}
+}
+
+// validateTLS validates the .spec.githubAPI.tls field, creates the HTTP client, and returns the appropriate
+// TLSConfigurationValid condition.
+func validateTLS(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	tlsSpec := upstream.Spec.GitHubAPI.TLS
+	if tlsSpec == nil || tlsSpec.CertificateAuthorityData == "" {
+		result.HTTPClient = defaultClientShortTimeout(nil)
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  upstreamwatchers.ReasonSuccess,
+			Message: "no TLS configuration provided",
+		}
+	}
+
+	bundle, err := base64.StdEncoding.DecodeString(tlsSpec.CertificateAuthorityData)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: fmt.Sprintf("spec.githubAPI.tls.certificateAuthorityData is invalid: %s", err.Error()),
+		}
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(bundle) {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: fmt.Sprintf("spec.githubAPI.tls.certificateAuthorityData is invalid: %s", upstreamwatchers.ErrNoCertificates),
+		}
+	}
+
+	result.HTTPClient = defaultClientShortTimeout(rootCAs)
+	return &v1alpha1.Condition{
+		Type:    typeTLSConfigurationValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded TLS configuration",
+	}
+}
+
+// validateOrganizationsPolicy validates the .spec.allowAuthentication.organizations field and returns the appropriate
+// OrganizationsPolicyValid condition.
+func validateOrganizationsPolicy(upstream *v1alpha1.GitHubIdentityProvider, result *upstreamgithub.ProviderConfig) *v1alpha1.Condition {
+	organizations := upstream.Spec.AllowAuthentication.Organizations
+
+	policy := v1alpha1.GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations
+	if organizations.Policy != nil {
+		policy = *organizations.Policy
+	}
+
+	switch {
+	case policy == v1alpha1.GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations && len(organizations.Allowed) == 0:
+		return &v1alpha1.Condition{
+			Type:    typeOrganizationsPolicyValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidPolicy,
+			Message: fmt.Sprintf("spec.allowAuthentication.organizations.policy is %q, so spec.allowAuthentication.organizations.allowed must not be empty", policy),
+		}
+	case policy == v1alpha1.GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers && len(organizations.Allowed) != 0:
+		return &v1alpha1.Condition{
+			Type:    typeOrganizationsPolicyValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidPolicy,
+			Message: fmt.Sprintf("spec.allowAuthentication.organizations.policy is %q, so spec.allowAuthentication.organizations.allowed must be empty", policy),
+		}
+	}
+
+	result.AllowedOrganizations = organizations.Allowed
+	return &v1alpha1.Condition{
+		Type:    typeOrganizationsPolicyValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: fmt.Sprintf("spec.allowAuthentication.organizations.policy (%q) is valid", policy),
+	}
+}
+
+func (c *githubWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.GitHubIdentityProvider, conditions []*v1alpha1.Condition) {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.Merge(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.GitHubPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.GitHubPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		GitHubIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "failed to update status")
+	}
+}
+
+func defaultClientShortTimeout(rootCAs *x509.CertPool) *http.Client {
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c
+}
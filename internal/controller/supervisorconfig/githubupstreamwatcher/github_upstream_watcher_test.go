@@ -0,0 +1,456 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package githubupstreamwatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/certauthority"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/testlogger"
+	"go.pinniped.dev/internal/upstreamgithub"
+)
+
+func TestGitHubUpstreamWatcherControllerFilterSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		secret     metav1.Object
+		wantAdd    bool
+		wantUpdate bool
+		wantDelete bool
+	}{
+		{
+			name: "a secret of the right type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/github-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
+		{
+			name: "a secret of the wrong type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/oidc-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+		{
+			name: "resource of wrong data type",
+			secret: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset()
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			secretInformer := kubeInformers.Core().V1().Secrets()
+			withInformer := testutil.NewObservableWithInformerOption()
+
+			New(
+				cache,
+				nil,
+				pinnipedInformers.IDP().V1alpha1().GitHubIdentityProviders(),
+				secretInformer,
+				testLog.Logger,
+				withInformer.WithInformer,
+			)
+
+			unrelated := corev1.Secret{}
+			filter := withInformer.GetFilterForInformer(secretInformer)
+			require.Equal(t, test.wantAdd, filter.Add(test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(&unrelated, test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(test.secret, &unrelated))
+			require.Equal(t, test.wantDelete, filter.Delete(test.secret))
+		})
+	}
+}
+
+func TestGitHubUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace    = "test-namespace"
+		testName         = "test-name"
+		testSecretName   = "test-client-secret"
+		testClientID     = "test-client-id"
+		testClientSecret = "test-client-secret"
+	)
+
+	ca, err := certauthority.New("test-ca", time.Hour)
+	require.NoError(t, err)
+	testCABase64 := base64.StdEncoding.EncodeToString(ca.Bundle())
+
+	ptr := func(s string) *string { return &s }
+	onlyAllowedOrgs := v1alpha1.GitHubAllowedAuthOrganizationsPolicyOnlyUsersFromAllowedOrganizations
+	allUsers := v1alpha1.GitHubAllowedAuthOrganizationsPolicyAllGitHubUsers
+	usernameLogin := v1alpha1.GitHubUsernameLogin
+	groupName := v1alpha1.GitHubGroupNameName
+
+	validSpec := func() v1alpha1.GitHubIdentityProviderSpec {
+		return v1alpha1.GitHubIdentityProviderSpec{
+			AllowAuthentication: v1alpha1.GitHubAllowAuthenticationSpec{
+				Organizations: v1alpha1.GitHubOrganizationsSpec{Policy: &onlyAllowedOrgs, Allowed: []string{"org-1"}},
+			},
+			Client: v1alpha1.GitHubClientSpec{SecretName: testSecretName},
+		}
+	}
+	validUpstream := func(editSpec func(*v1alpha1.GitHubIdentityProviderSpec)) *v1alpha1.GitHubIdentityProvider {
+		spec := validSpec()
+		if editSpec != nil {
+			editSpec(&spec)
+		}
+		return &v1alpha1.GitHubIdentityProvider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: "test-uid", Generation: 1234},
+			Spec:       spec,
+		}
+	}
+	validSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+		Type:       "secrets.pinniped.dev/github-client",
+		Data:       map[string][]byte{"clientID": []byte(testClientID), "clientSecret": []byte(testClientSecret)},
+	}
+
+	condition := func(typ string, status v1alpha1.ConditionStatus, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               typ,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+			LastTransitionTime: now,
+		}
+	}
+	clientCredentialsValid := condition("ClientCredentialsValid", "True", "Success", "loaded client credentials")
+	hostValid := func(host string) v1alpha1.Condition {
+		return condition("HostValid", "True", "Success", `spec.githubAPI.host ("`+host+`") is valid`)
+	}
+	organizationsPolicyValid := func(policy string) v1alpha1.Condition {
+		return condition("OrganizationsPolicyValid", "True", "Success", `spec.allowAuthentication.organizations.policy ("`+policy+`") is valid`)
+	}
+	tlsNotConfigured := condition("TLSConfigurationValid", "True", "Success", "no TLS configuration provided")
+
+	tests := []struct {
+		name                    string
+		inputUpstreams          []runtime.Object
+		inputSecrets            []runtime.Object
+		wantErr                 string
+		wantResultingCache      []*upstreamgithub.ProviderConfig
+		wantResultingPhase      v1alpha1.GitHubIdentityProviderPhase
+		wantResultingConditions []v1alpha1.Condition
+	}{
+		{
+			name:           "valid upstream for github.com",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets:   []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamgithub.ProviderConfig{{
+				Name:                 testName,
+				ResourceUID:          "test-uid",
+				UsernameAttribute:    v1alpha1.GitHubUsernameLoginAndID,
+				GroupNameAttribute:   v1alpha1.GitHubGroupNameSlug,
+				AllowedOrganizations: []string{"org-1"},
+				OAuth2Config: &oauth2.Config{
+					ClientID:     testClientID,
+					ClientSecret: testClientSecret,
+					Endpoint: oauth2.Endpoint{
+						AuthURL:   "https://github.com/login/oauth/authorize",
+						TokenURL:  "https://github.com/login/oauth/access_token",
+						AuthStyle: oauth2.AuthStyleInParams,
+					},
+					Scopes: []string{"read:user", "read:org"},
+				},
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				hostValid("github.com"),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "valid upstream for GitHub Enterprise Server with custom claims, CA bundle, and all users allowed",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.GitHubAPI = v1alpha1.GitHubAPIConfig{
+					Host: ptr("github.example.com:8443"),
+					TLS:  &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64},
+				}
+				spec.Claims = v1alpha1.GitHubClaims{Username: &usernameLogin, Groups: &groupName}
+				spec.AllowAuthentication.Organizations = v1alpha1.GitHubOrganizationsSpec{Policy: &allUsers}
+			})},
+			inputSecrets: []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamgithub.ProviderConfig{{
+				Name:               testName,
+				ResourceUID:        "test-uid",
+				UsernameAttribute:  v1alpha1.GitHubUsernameLogin,
+				GroupNameAttribute: v1alpha1.GitHubGroupNameName,
+				OAuth2Config: &oauth2.Config{
+					ClientID:     testClientID,
+					ClientSecret: testClientSecret,
+					Endpoint: oauth2.Endpoint{
+						AuthURL:   "https://github.example.com:8443/login/oauth/authorize",
+						TokenURL:  "https://github.example.com:8443/login/oauth/access_token",
+						AuthStyle: oauth2.AuthStyleInParams,
+					},
+					Scopes: []string{"read:user", "read:org"},
+				},
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				hostValid("github.example.com:8443"),
+				organizationsPolicyValid("AllGitHubUsers"),
+				condition("TLSConfigurationValid", "True", "Success", "loaded TLS configuration"),
+			},
+		},
+		{
+			name:               "missing secret",
+			inputUpstreams:     []runtime.Object{validUpstream(nil)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClientCredentialsValid", "False", "SecretNotFound", `secret "test-client-secret" not found`),
+				hostValid("github.com"),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name:           "secret has wrong type",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+				Type:       "secrets.pinniped.dev/oidc-client",
+				Data:       validSecret.Data,
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClientCredentialsValid", "False", "SecretWrongType",
+					`referenced Secret "test-client-secret" has wrong type "secrets.pinniped.dev/oidc-client" (should be "secrets.pinniped.dev/github-client")`),
+				hostValid("github.com"),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name:           "secret is missing the client secret",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+				Type:       "secrets.pinniped.dev/github-client",
+				Data:       map[string][]byte{"clientID": []byte(testClientID)},
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClientCredentialsValid", "False", "SecretMissingKeys",
+					`referenced Secret "test-client-secret" is missing required keys ["clientID" "clientSecret"]`),
+				hostValid("github.com"),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "host includes a scheme",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.GitHubAPI.Host = ptr("https://github.example.com")
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				condition("HostValid", "False", "InvalidHost",
+					`spec.githubAPI.host ("https://github.example.com") must be a hostname, optionally followed by a port, without a scheme or path`),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "host includes a path",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.GitHubAPI.Host = ptr("github.example.com/api/v3")
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				condition("HostValid", "False", "InvalidHost",
+					`spec.githubAPI.host ("github.example.com/api/v3") must be a hostname, optionally followed by a port, without a scheme or path`),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "CA bundle is not base64",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.GitHubAPI.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: "not-base64"}
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				hostValid("github.com"),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.githubAPI.tls.certificateAuthorityData is invalid: illegal base64 data at input byte 3"),
+			},
+		},
+		{
+			name: "CA bundle has no certificates",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.GitHubAPI.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not-a-cert"))}
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				hostValid("github.com"),
+				organizationsPolicyValid("OnlyUsersFromAllowedOrganizations"),
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.githubAPI.tls.certificateAuthorityData is invalid: no certificates found"),
+			},
+		},
+		{
+			name: "only users from allowed organizations, but no allowed organizations",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.AllowAuthentication.Organizations = v1alpha1.GitHubOrganizationsSpec{}
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				hostValid("github.com"),
+				condition("OrganizationsPolicyValid", "False", "InvalidPolicy",
+					`spec.allowAuthentication.organizations.policy is "OnlyUsersFromAllowedOrganizations", so spec.allowAuthentication.organizations.allowed must not be empty`),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "all users allowed, but with allowed organizations",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.GitHubIdentityProviderSpec) {
+				spec.AllowAuthentication.Organizations.Policy = &allUsers
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				hostValid("github.com"),
+				condition("OrganizationsPolicyValid", "False", "InvalidPolicy",
+					`spec.allowAuthentication.organizations.policy is "AllGitHubUsers", so spec.allowAuthentication.organizations.allowed must be empty`),
+				tlsNotConfigured,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset(tt.inputSecrets...)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetGitHubIdentityProviders([]provider.UpstreamGitHubIdentityProviderI{
+				&upstreamgithub.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().GitHubIdentityProviders(),
+				kubeInformers.Core().V1().Secrets(),
+				testLog.Logger,
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			kubeInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetGitHubIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamgithub.ProviderConfig)
+				require.NotNil(t, actualIDP.HTTPClient)
+				require.Equal(t, time.Minute, actualIDP.HTTPClient.Timeout)
+				require.NotNil(t, actualIDP.APIBaseURL)
+
+				// The HTTP client and API URL are asserted separately.
+				wantAPIBaseURL := "https://api.github.com"
+				if actualIDP.OAuth2Config.Endpoint.AuthURL != "https://github.com/login/oauth/authorize" {
+					wantAPIBaseURL = "https://github.example.com:8443/api/v3"
+				}
+				require.Equal(t, wantAPIBaseURL, actualIDP.APIBaseURL.String())
+				actualIDP.HTTPClient = nil
+				actualIDP.APIBaseURL = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstream, err := fakePinnipedClient.IDPV1alpha1().GitHubIdentityProviders(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResultingPhase, actualUpstream.Status.Phase)
+			for i := range actualUpstream.Status.Conditions {
+				if time.Since(actualUpstream.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+					actualUpstream.Status.Conditions[i].LastTransitionTime = now
+				}
+			}
+			require.Equal(t, tt.wantResultingConditions, actualUpstream.Status.Conditions)
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
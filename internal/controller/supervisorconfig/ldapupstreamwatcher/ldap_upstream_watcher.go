@@ -7,10 +7,13 @@ package ldapupstreamwatcher
 import (
 	"context"
 	"fmt"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 	"k8s.io/klog/v2/klogr"
 
@@ -27,6 +30,9 @@ import (
 
 const (
 	ldapControllerName = "ldap-upstream-observer"
+
+	typeGroupSearchValid      = "GroupSearchValid"
+	reasonConflictingSettings = "ConflictingSettings"
 )
 
 type ldapUpstreamGenericLDAPImpl struct {
@@ -130,11 +136,14 @@ func (s *ldapUpstreamGenericLDAPStatus) Conditions() []v1alpha1.Condition {
 // UpstreamLDAPIdentityProviderICache is a thread safe cache that holds a list of validated upstream LDAP IDP configurations.
 type UpstreamLDAPIdentityProviderICache interface {
 	SetLDAPIdentityProviders([]provider.UpstreamLDAPIdentityProviderI)
+	GetLDAPIdentityProviders() []provider.UpstreamLDAPIdentityProviderI
 }
 
 type ldapWatcherController struct {
 	cache                        UpstreamLDAPIdentityProviderICache
 	validatedSettingsCache       upstreamwatchers.ValidatedSettingsCacheI
+	hostHealthCache              *upstreamwatchers.HostHealthCache
+	groupCaches                  *upstreamwatchers.GroupCaches
 	ldapDialer                   upstreamldap.LDAPDialer
 	client                       pinnipedclientset.Interface
 	ldapIdentityProviderInformer idpinformers.LDAPIdentityProviderInformer
@@ -175,6 +184,8 @@ func newInternal(
 	c := ldapWatcherController{
 		cache:                        idpCache,
 		validatedSettingsCache:       validatedSettingsCache,
+		hostHealthCache:              upstreamwatchers.NewHostHealthCache(),
+		groupCaches:                  upstreamwatchers.NewGroupCaches(),
 		ldapDialer:                   ldapDialer,
 		client:                       client,
 		ldapIdentityProviderInformer: ldapIdentityProviderInformer,
@@ -189,7 +200,10 @@ func newInternal(
 		),
 		withInformer(
 			secretInformer,
-			pinnipedcontroller.MatchAnySecretOfTypeFilter(upstreamwatchers.LDAPBindAccountSecretType, pinnipedcontroller.SingletonQueue()),
+			pinnipedcontroller.MatchAnySecretOfTypesFilter(
+				[]corev1.SecretType{upstreamwatchers.LDAPBindAccountSecretType, upstreamwatchers.LDAPBindClientCertificateSecretType},
+				pinnipedcontroller.SingletonQueue(),
+			),
 			controllerlib.InformerOption{},
 		),
 	)
@@ -203,8 +217,10 @@ func (c *ldapWatcherController) Sync(ctx controllerlib.Context) error {
 	}
 
 	requeue := false
+	upstreamNames := sets.NewString()
 	validatedUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, 0, len(actualUpstreams))
 	for _, upstream := range actualUpstreams {
+		upstreamNames.Insert(upstream.Name)
 		valid, requestedRequeue := c.validateUpstream(ctx.Context, upstream)
 		if valid != nil {
 			validatedUpstreams = append(validatedUpstreams, valid)
@@ -214,7 +230,15 @@ func (c *ldapWatcherController) Sync(ctx controllerlib.Context) error {
 		}
 	}
 
+	// Forget the health of the hosts of upstreams which were deleted.
+	c.hostHealthCache.Retain(upstreamNames)
+	// Forget the cached groups of upstreams which were deleted.
+	c.groupCaches.Retain(upstreamNames)
+
+	previousUpstreams := c.cache.GetLDAPIdentityProviders()
 	c.cache.SetLDAPIdentityProviders(validatedUpstreams)
+	// The previous providers will not be used for any new logins, so close their idle connections to the LDAP server.
+	upstreamwatchers.CloseIdleConnections(previousUpstreams)
 
 	if requeue {
 		return controllerlib.ErrSyntheticRequeue
@@ -226,9 +250,10 @@ func (c *ldapWatcherController) validateUpstream(ctx context.Context, upstream *
 	spec := upstream.Spec
 
 	config := &upstreamldap.ProviderConfig{
-		Name:        upstream.Name,
-		ResourceUID: upstream.UID,
-		Host:        spec.Host,
+		Name:            upstream.Name,
+		ResourceUID:     upstream.UID,
+		Host:            spec.Host,
+		AdditionalHosts: spec.AdditionalHosts,
 		UserSearch: upstreamldap.UserSearchConfig{
 			Base:              spec.UserSearch.Base,
 			Filter:            spec.UserSearch.Filter,
@@ -236,21 +261,53 @@ func (c *ldapWatcherController) validateUpstream(ctx context.Context, upstream *
 			UIDAttribute:      spec.UserSearch.Attributes.UID,
 		},
 		GroupSearch: upstreamldap.GroupSearchConfig{
-			Base:               spec.GroupSearch.Base,
-			Filter:             spec.GroupSearch.Filter,
-			GroupNameAttribute: spec.GroupSearch.Attributes.GroupName,
-			SkipGroupRefresh:   spec.GroupSearch.SkipGroupRefresh,
+			Base:                   spec.GroupSearch.Base,
+			Filter:                 spec.GroupSearch.Filter,
+			UserAttributeForFilter: spec.GroupSearch.UserAttributeForFilter,
+			GroupNameAttribute:     spec.GroupSearch.Attributes.GroupName,
+			SkipGroupRefresh:       spec.GroupSearch.SkipGroupRefresh,
+			ResolveNestedGroups:    spec.GroupSearch.ResolveNestedGroups,
+			CacheTTL:               time.Duration(spec.GroupSearch.CacheTTLSeconds) * time.Second,
 		},
 		Dialer: c.ldapDialer,
 	}
 
+	if config.HasFailoverHosts() {
+		config.HostHealth = c.hostHealthCache.Get(upstream.Name, upstream.Generation)
+	}
+
+	if config.GroupSearch.CacheTTL > 0 {
+		config.GroupCache = c.groupCaches.Get(upstream.Name, upstream.Generation)
+	}
+
 	conditions := upstreamwatchers.ValidateGenericLDAP(ctx, &ldapUpstreamGenericLDAPImpl{*upstream}, c.secretInformer, c.validatedSettingsCache, config)
+	conditions.Append(validateGroupSearch(&spec.GroupSearch), true)
 
 	c.updateStatus(ctx, upstream, conditions.Conditions())
 
 	return upstreamwatchers.EvaluateConditions(conditions, config)
 }
 
+// validateGroupSearch rejects settings which would silently find fewer groups than intended. Nested groups are found
+// by putting the dn of each group into the Filter, which can only match groups which list their members by dn.
+func validateGroupSearch(groupSearch *v1alpha1.LDAPIdentityProviderGroupSearch) *v1alpha1.Condition {
+	if groupSearch.ResolveNestedGroups && groupSearch.UserAttributeForFilter != "" && groupSearch.UserAttributeForFilter != "dn" {
+		return &v1alpha1.Condition{
+			Type:   typeGroupSearchValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: reasonConflictingSettings,
+			Message: fmt.Sprintf(`spec.groupSearch.resolveNestedGroups cannot be used with spec.groupSearch.userAttributeForFilter %q, `+
+				`because nested groups are found using the dn of each group`, groupSearch.UserAttributeForFilter),
+		}
+	}
+	return &v1alpha1.Condition{
+		Type:    typeGroupSearchValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "group search configuration is valid",
+	}
+}
+
 func (c *ldapWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.LDAPIdentityProvider, conditions []*v1alpha1.Condition) {
 	log := klogr.New().WithValues("namespace", upstream.Namespace, "name", upstream.Name)
 	updated := upstream.DeepCopy()
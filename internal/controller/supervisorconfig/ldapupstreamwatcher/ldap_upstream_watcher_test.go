@@ -5,6 +5,7 @@ package ldapupstreamwatcher
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -54,6 +55,16 @@ func TestLDAPUpstreamWatcherControllerFilterSecrets(t *testing.T) {
 			wantUpdate: true,
 			wantDelete: true,
 		},
+		{
+			name: "a client certificate secret",
+			secret: &corev1.Secret{
+				Type:       corev1.SecretTypeTLS,
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
 		{
 			name: "a secret of the wrong type",
 			secret: &corev1.Secret{
@@ -171,6 +182,11 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 	testCABundle := testCA.Bundle()
 	testCABundleBase64Encoded := base64.StdEncoding.EncodeToString(testCABundle)
 
+	testClientCertPEM, testClientKeyPEM, err := testCA.IssueClientCertPEM("test-bind-client", nil, time.Minute)
+	require.NoError(t, err)
+	testClientCert, err := tls.X509KeyPair(testClientCertPEM, testClientKeyPEM)
+	require.NoError(t, err)
+
 	validUpstream := &v1alpha1.LDAPIdentityProvider{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:       testName,
@@ -272,9 +288,20 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 			ObservedGeneration: gen,
 		}
 	}
+	groupSearchValidTrueCondition := func(gen int64) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               "GroupSearchValid",
+			Status:             "True",
+			LastTransitionTime: now,
+			Reason:             "Success",
+			Message:            "group search configuration is valid",
+			ObservedGeneration: gen,
+		}
+	}
 	allConditionsTrue := func(gen int64, secretVersion string) []v1alpha1.Condition {
 		return []v1alpha1.Condition{
 			bindSecretValidTrueCondition(gen),
+			groupSearchValidTrueCondition(gen),
 			ldapConnectionValidTrueCondition(gen, secretVersion),
 			tlsConfigurationValidLoadedTrueCondition(gen),
 		}
@@ -349,6 +376,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 							Message:            fmt.Sprintf(`secret "%s" not found`, testSecretName),
 							ObservedGeneration: 1234,
 						},
+						groupSearchValidTrueCondition(1234),
 						tlsConfigurationValidLoadedTrueCondition(1234),
 					},
 				},
@@ -374,9 +402,109 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 							Status:             "False",
 							LastTransitionTime: now,
 							Reason:             "SecretWrongType",
-							Message:            fmt.Sprintf(`referenced Secret "%s" has wrong type "some-other-type" (should be "kubernetes.io/basic-auth")`, testSecretName),
+							Message:            fmt.Sprintf(`referenced Secret "%s" has wrong type "some-other-type" (should be "kubernetes.io/basic-auth" or "kubernetes.io/tls")`, testSecretName),
 							ObservedGeneration: 1234,
 						},
+						groupSearchValidTrueCondition(1234),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+		},
+		{
+			name:           "secret contains a client certificate, so it binds using SASL EXTERNAL",
+			inputUpstreams: []runtime.Object{validUpstream},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testNamespace, ResourceVersion: "4242"},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{"tls.crt": testClientCertPEM, "tls.key": testClientKeyPEM},
+			}},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().ExternalBind().Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:                  testName,
+					ResourceUID:           testResourceUID,
+					Host:                  testHost,
+					ConnectionProtocol:    upstreamldap.TLS,
+					CABundle:              testCABundle,
+					BindClientCertificate: &testClientCert,
+					UserSearch:            providerConfigForValidUpstreamWithTLS.UserSearch,
+					GroupSearch:           providerConfigForValidUpstreamWithTLS.GroupSearch,
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						{
+							Type:               "BindSecretValid",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "loaded bind client certificate",
+							ObservedGeneration: 1234,
+						},
+						groupSearchValidTrueCondition(1234),
+						{
+							Type:               "LDAPConnectionValid",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message: fmt.Sprintf(
+								`successfully able to connect to "%s" and bind with client certificate using SASL EXTERNAL [validated with Secret "%s" at version "%s"]`,
+								testHost, testSecretName, "4242"),
+							ObservedGeneration: 1234,
+						},
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition: &v1alpha1.Condition{
+					Type:   "LDAPConnectionValid",
+					Status: "True",
+					Reason: "Success",
+					Message: fmt.Sprintf(
+						`successfully able to connect to "%s" and bind with client certificate using SASL EXTERNAL [validated with Secret "%s" at version "%s"]`,
+						testHost, testSecretName, "4242"),
+				},
+			}},
+		},
+		{
+			name:           "secret contains an invalid client certificate",
+			inputUpstreams: []runtime.Object{validUpstream},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: testSecretName, Namespace: testNamespace},
+				Type:       corev1.SecretTypeTLS,
+				Data:       map[string][]byte{"tls.crt": testClientCertPEM, "tls.key": []byte("not a key")},
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						{
+							Type:               "BindSecretValid",
+							Status:             "False",
+							LastTransitionTime: now,
+							Reason:             "SecretInvalidData",
+							Message: fmt.Sprintf(`referenced Secret "%s" does not contain a valid certificate and key: `+
+								`tls: failed to find any PEM data in key input`, testSecretName),
+							ObservedGeneration: 1234,
+						},
+						groupSearchValidTrueCondition(1234),
 						tlsConfigurationValidLoadedTrueCondition(1234),
 					},
 				},
@@ -404,6 +532,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 							Message:            fmt.Sprintf(`referenced Secret "%s" is missing required keys ["username" "password"]`, testSecretName),
 							ObservedGeneration: 1234,
 						},
+						groupSearchValidTrueCondition(1234),
 						tlsConfigurationValidLoadedTrueCondition(1234),
 					},
 				},
@@ -423,6 +552,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						{
 							Type:               "TLSConfigurationValid",
 							Status:             "False",
@@ -449,6 +579,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						{
 							Type:               "TLSConfigurationValid",
 							Status:             "False",
@@ -500,6 +631,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						ldapConnectionValidTrueCondition(1234, "4242"),
 						{
 							Type:               "TLSConfigurationValid",
@@ -564,6 +696,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						{
 							Type:               "LDAPConnectionValid",
 							Status:             "True",
@@ -636,6 +769,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						{
 							Type:               "LDAPConnectionValid",
 							Status:             "False",
@@ -731,6 +865,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 								Message:            fmt.Sprintf(`secret "%s" not found`, "non-existent-secret"),
 								ObservedGeneration: 42,
 							},
+							groupSearchValidTrueCondition(42),
 							tlsConfigurationValidLoadedTrueCondition(42),
 						},
 					},
@@ -770,6 +905,7 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Error",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						{
 							Type:               "LDAPConnectionValid",
 							Status:             "False",
@@ -1094,6 +1230,237 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 					Phase: "Ready",
 					Conditions: []v1alpha1.Condition{
 						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
+						ldapConnectionValidTrueCondition(1234, "4242"),
+						{
+							Type:               "TLSConfigurationValid",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "loaded TLS configuration",
+							ObservedGeneration: 1234,
+						},
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+		},
+		{
+			name: "caching groups for refreshes is valid",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.GroupSearch.CacheTTLSeconds = 300
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch: upstreamldap.UserSearchConfig{
+						Base:              testUserSearchBase,
+						Filter:            testUserSearchFilter,
+						UsernameAttribute: testUsernameAttrName,
+						UIDAttribute:      testUIDAttrName,
+					},
+					GroupSearch: upstreamldap.GroupSearchConfig{
+						Base:               testGroupSearchBase,
+						Filter:             testGroupSearchFilter,
+						GroupNameAttribute: testGroupNameAttrName,
+						CacheTTL:           5 * time.Minute,
+					},
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
+						ldapConnectionValidTrueCondition(1234, "4242"),
+						{
+							Type:               "TLSConfigurationValid",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "loaded TLS configuration",
+							ObservedGeneration: 1234,
+						},
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+		},
+		{
+			name: "resolving nested groups is passed through to the provider",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.GroupSearch.ResolveNestedGroups = true
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch: upstreamldap.UserSearchConfig{
+						Base:              testUserSearchBase,
+						Filter:            testUserSearchFilter,
+						UsernameAttribute: testUsernameAttrName,
+						UIDAttribute:      testUIDAttrName,
+					},
+					GroupSearch: upstreamldap.GroupSearchConfig{
+						Base:                testGroupSearchBase,
+						Filter:              testGroupSearchFilter,
+						GroupNameAttribute:  testGroupNameAttrName,
+						ResolveNestedGroups: true,
+					},
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
+						ldapConnectionValidTrueCondition(1234, "4242"),
+						{
+							Type:               "TLSConfigurationValid",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "loaded TLS configuration",
+							ObservedGeneration: 1234,
+						},
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+		},
+		{
+			name: "resolving nested groups cannot be combined with a user attribute for the group search filter",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.GroupSearch.Filter = "&(objectClass=posixGroup)(memberUid={})"
+				upstream.Spec.GroupSearch.UserAttributeForFilter = "uid"
+				upstream.Spec.GroupSearch.ResolveNestedGroups = true
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						{
+							Type:               "GroupSearchValid",
+							Status:             "False",
+							LastTransitionTime: now,
+							Reason:             "ConflictingSettings",
+							Message:            `spec.groupSearch.resolveNestedGroups cannot be used with spec.groupSearch.userAttributeForFilter "uid", because nested groups are found using the dn of each group`,
+							ObservedGeneration: 1234,
+						},
+						ldapConnectionValidTrueCondition(1234, "4242"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+		},
+		{
+			name: "the user attribute for the group search filter is passed through to the provider",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.GroupSearch.Filter = "&(objectClass=posixGroup)(memberUid={})"
+				upstream.Spec.GroupSearch.UserAttributeForFilter = "uid"
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch: upstreamldap.UserSearchConfig{
+						Base:              testUserSearchBase,
+						Filter:            testUserSearchFilter,
+						UsernameAttribute: testUsernameAttrName,
+						UIDAttribute:      testUIDAttrName,
+					},
+					GroupSearch: upstreamldap.GroupSearchConfig{
+						Base:                   testGroupSearchBase,
+						Filter:                 "&(objectClass=posixGroup)(memberUid={})",
+						UserAttributeForFilter: "uid",
+						GroupNameAttribute:     testGroupNameAttrName,
+					},
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
 						ldapConnectionValidTrueCondition(1234, "4242"),
 						{
 							Type:               "TLSConfigurationValid",
@@ -1115,6 +1482,118 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
 			}},
 		},
+		{
+			name: "additional hosts are used when the host cannot be reached, and the unreachable host is reported",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.AdditionalHosts = []string{"ldap2.example.com:123"}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			dialErrors: map[string]error{
+				testHost: errors.New("some dial error"),
+			},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind using the additional host, and then a health check dial of each host.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(2)
+			},
+			wantErr: controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					AdditionalHosts:    []string{"ldap2.example.com:123"},
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch:         providerConfigForValidUpstreamWithTLS.UserSearch,
+					GroupSearch:        providerConfigForValidUpstreamWithTLS.GroupSearch,
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Error",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
+						{
+							Type:               "HostsHealthy",
+							Status:             "False",
+							LastTransitionTime: now,
+							Reason:             "HostsUnreachable",
+							Message:            `could not connect to some hosts, so other hosts will be used instead: "ldap.example.com:123": some dial error`,
+							ObservedGeneration: 1234,
+						},
+						ldapConnectionValidTrueCondition(1234, "4242"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+		},
+		{
+			name: "when all of the hosts can be reached, then the hosts are reported as healthy",
+			inputUpstreams: []runtime.Object{editedValidUpstream(func(upstream *v1alpha1.LDAPIdentityProvider) {
+				upstream.Spec.AdditionalHosts = []string{"ldap2.example.com:123"}
+			})},
+			inputSecrets: []runtime.Object{validBindUserSecret("4242")},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				// Should perform a test dial and bind, and then a health check dial of each host.
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Close().Times(3)
+			},
+			wantResultingCache: []*upstreamldap.ProviderConfig{
+				{
+					Name:               testName,
+					ResourceUID:        testResourceUID,
+					Host:               testHost,
+					AdditionalHosts:    []string{"ldap2.example.com:123"},
+					ConnectionProtocol: upstreamldap.TLS,
+					CABundle:           testCABundle,
+					BindUsername:       testBindUsername,
+					BindPassword:       testBindPassword,
+					UserSearch:         providerConfigForValidUpstreamWithTLS.UserSearch,
+					GroupSearch:        providerConfigForValidUpstreamWithTLS.GroupSearch,
+				},
+			},
+			wantResultingUpstreams: []v1alpha1.LDAPIdentityProvider{{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, Generation: 1234, UID: testResourceUID},
+				Status: v1alpha1.LDAPIdentityProviderStatus{
+					Phase: "Ready",
+					Conditions: []v1alpha1.Condition{
+						bindSecretValidTrueCondition(1234),
+						groupSearchValidTrueCondition(1234),
+						{
+							Type:               "HostsHealthy",
+							Status:             "True",
+							LastTransitionTime: now,
+							Reason:             "Success",
+							Message:            "no recent errors connecting to any host",
+							ObservedGeneration: 1234,
+						},
+						ldapConnectionValidTrueCondition(1234, "4242"),
+						tlsConfigurationValidLoadedTrueCondition(1234),
+					},
+				},
+			}},
+			wantValidatedSettings: map[string]upstreamwatchers.ValidatedSettings{testName: {
+				BindSecretResourceVersion: "4242",
+				LDAPConnectionProtocol:    upstreamldap.TLS,
+				UserSearchBase:            testUserSearchBase,
+				GroupSearchBase:           testGroupSearchBase,
+				IDPSpecGeneration:         1234,
+				ConnectionValidCondition:  condPtr(ldapConnectionValidTrueConditionWithoutTimeOrGeneration("4242")),
+			}},
+		},
 	}
 
 	for _, tt := range tests {
@@ -1193,6 +1672,18 @@ func TestLDAPUpstreamWatcherControllerSync(t *testing.T) {
 				// The dialer that was passed in to the controller's constructor should always have been
 				// passed through to the provider.
 				copyOfExpectedValueForResultingCache.Dialer = dialer
+				// The health of the hosts is remembered by the controller, and it should have been passed through
+				// to providers which have failover hosts.
+				if copyOfExpectedValueForResultingCache.HasFailoverHosts() {
+					require.NotNil(t, actualIDP.GetConfig().HostHealth)
+					copyOfExpectedValueForResultingCache.HostHealth = actualIDP.GetConfig().HostHealth
+				}
+				// The cached groups are remembered by the controller, and they should have been passed through to
+				// providers which cache their groups.
+				if copyOfExpectedValueForResultingCache.GroupSearch.CacheTTL > 0 {
+					require.NotNil(t, actualIDP.GetConfig().GroupCache)
+					copyOfExpectedValueForResultingCache.GroupCache = actualIDP.GetConfig().GroupCache
+				}
 				require.Equal(t, copyOfExpectedValueForResultingCache, actualIDP.GetConfig())
 			}
 
@@ -0,0 +1,247 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package localupstreamwatcher implements a controller which watches LocalIdentityProviders.
+package localupstreamwatcher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/utils/clock"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/constable"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/upstreamlocal"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	localControllerName = "local-upstream-observer"
+
+	// Constants related to conditions.
+	typeSecretSelectorValid = "SecretSelectorValid"
+	typeUsersValid          = "UsersValid"
+
+	reasonInvalidSelector  = "InvalidSelector"
+	reasonListFailed       = "ListFailed"
+	reasonUnableToValidate = "UnableToValidate"
+
+	// Errors that are generated by our reconcile process.
+	errLocalFailureStatus = constable.Error("LocalIdentityProvider has a failing condition")
+)
+
+// UpstreamLocalIdentityProviderICache is a thread safe cache that holds a list of validated local IDP configurations.
+type UpstreamLocalIdentityProviderICache interface {
+	SetLocalIdentityProviders([]provider.UpstreamLDAPIdentityProviderI)
+}
+
+type localWatcherController struct {
+	cache                         UpstreamLocalIdentityProviderICache
+	log                           logr.Logger
+	client                        pinnipedclientset.Interface
+	localIdentityProviderInformer idpinformers.LocalIdentityProviderInformer
+	secretInformer                corev1informers.SecretInformer
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamLocalIdentityProviderICache.
+func New(
+	idpCache UpstreamLocalIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	localIdentityProviderInformer idpinformers.LocalIdentityProviderInformer,
+	secretInformer corev1informers.SecretInformer,
+	log logr.Logger,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := localWatcherController{
+		cache:                         idpCache,
+		log:                           log.WithName(localControllerName),
+		client:                        client,
+		localIdentityProviderInformer: localIdentityProviderInformer,
+		secretInformer:                secretInformer,
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: localControllerName, Syncer: &c},
+		withInformer(
+			localIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnySecretOfTypeFilter(upstreamlocal.UserSecretType, pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *localWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.localIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list LocalIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, provider.UpstreamLDAPIdentityProviderI(valid))
+		}
+	}
+	c.cache.SetLocalIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.LocalIdentityProvider and returns the validated configuration as an
+// upstreamlocal.ProviderConfig. As a side effect, it also updates the status of the v1alpha1.LocalIdentityProvider.
+//
+// Invalid user Secrets are reported in the status, but they do not prevent the other users from logging in.
+func (c *localWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.LocalIdentityProvider) *upstreamlocal.ProviderConfig {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+
+	selector, selectorCondition := validateSecretSelector(upstream)
+	conditions := []*v1alpha1.Condition{
+		selectorCondition,
+		c.validateUsers(upstream, selector),
+	}
+
+	c.updateStatus(ctx, upstream, conditions)
+
+	for _, condition := range conditions {
+		if condition.Status == v1alpha1.ConditionFalse {
+			log.WithValues(
+				"type", condition.Type,
+				"reason", condition.Reason,
+				"message", condition.Message,
+			).Error(errLocalFailureStatus, "found failing condition")
+		}
+	}
+	if selector == nil {
+		return nil
+	}
+	return &upstreamlocal.ProviderConfig{
+		Name:           upstream.Name,
+		ResourceUID:    upstream.UID,
+		Namespace:      upstream.Namespace,
+		SecretSelector: selector,
+		Secrets:        c.secretInformer.Lister(),
+		Clock:          clock.RealClock{},
+	}
+}
+
+// validateSecretSelector validates the .spec.users.secretSelector field and returns the appropriate
+// SecretSelectorValid condition.
+func validateSecretSelector(upstream *v1alpha1.LocalIdentityProvider) (labels.Selector, *v1alpha1.Condition) {
+	selector, err := metav1.LabelSelectorAsSelector(&upstream.Spec.Users.SecretSelector)
+	if err != nil {
+		return nil, &v1alpha1.Condition{
+			Type:    typeSecretSelectorValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidSelector,
+			Message: fmt.Sprintf("spec.users.secretSelector is invalid: %s", err.Error()),
+		}
+	}
+	return selector, &v1alpha1.Condition{
+		Type:    typeSecretSelectorValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "spec.users.secretSelector is valid",
+	}
+}
+
+// validateUsers validates the user Secrets which are selected by the provider and returns the appropriate
+// UsersValid condition.
+func (c *localWatcherController) validateUsers(upstream *v1alpha1.LocalIdentityProvider, selector labels.Selector) *v1alpha1.Condition {
+	if selector == nil {
+		return &v1alpha1.Condition{
+			Type:    typeUsersValid,
+			Status:  v1alpha1.ConditionUnknown,
+			Reason:  reasonUnableToValidate,
+			Message: "unable to validate; see other conditions for details",
+		}
+	}
+
+	secrets, err := c.secretInformer.Lister().Secrets(upstream.Namespace).List(selector)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeUsersValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonListFailed,
+			Message: fmt.Sprintf("failed to list user Secrets: %s", err.Error()),
+		}
+	}
+
+	validUsers := 0
+	var invalidUsers []string
+	for _, secret := range secrets {
+		if secret.Type != upstreamlocal.UserSecretType {
+			continue
+		}
+		if err := upstreamlocal.ValidateUserSecret(secret); err != nil {
+			invalidUsers = append(invalidUsers, err.Error())
+			continue
+		}
+		validUsers++
+	}
+
+	if len(invalidUsers) > 0 {
+		sort.Strings(invalidUsers)
+		return &v1alpha1.Condition{
+			Type:    typeUsersValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidData,
+			Message: fmt.Sprintf("loaded %d valid users, but some user Secrets are invalid: %s", validUsers, strings.Join(invalidUsers, "; ")),
+		}
+	}
+	return &v1alpha1.Condition{
+		Type:    typeUsersValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: fmt.Sprintf("loaded %d valid users", validUsers),
+	}
+}
+
+func (c *localWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.LocalIdentityProvider, conditions []*v1alpha1.Condition) {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.Merge(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.LocalPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.LocalPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		LocalIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "failed to update status")
+	}
+}
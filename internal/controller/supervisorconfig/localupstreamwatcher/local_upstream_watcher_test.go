@@ -0,0 +1,293 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package localupstreamwatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/testlogger"
+	"go.pinniped.dev/internal/upstreamlocal"
+)
+
+func TestLocalUpstreamWatcherControllerFilterSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		secret     metav1.Object
+		wantAdd    bool
+		wantUpdate bool
+		wantDelete bool
+	}{
+		{
+			name: "a secret of the right type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/local-user",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
+		{
+			name: "a secret of the wrong type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/webhook-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+		{
+			name: "resource of wrong data type",
+			secret: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset()
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			secretInformer := kubeInformers.Core().V1().Secrets()
+			withInformer := testutil.NewObservableWithInformerOption()
+
+			New(
+				cache,
+				nil,
+				pinnipedInformers.IDP().V1alpha1().LocalIdentityProviders(),
+				secretInformer,
+				testLog.Logger,
+				withInformer.WithInformer,
+			)
+
+			unrelated := corev1.Secret{}
+			filter := withInformer.GetFilterForInformer(secretInformer)
+			require.Equal(t, test.wantAdd, filter.Add(test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(&unrelated, test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(test.secret, &unrelated))
+			require.Equal(t, test.wantDelete, filter.Delete(test.secret))
+		})
+	}
+}
+
+func TestLocalUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace = "test-namespace"
+		testName      = "test-name"
+	)
+
+	validUpstream := func(editSpec func(*v1alpha1.LocalIdentityProviderSpec)) *v1alpha1.LocalIdentityProvider {
+		spec := v1alpha1.LocalIdentityProviderSpec{}
+		if editSpec != nil {
+			editSpec(&spec)
+		}
+		return &v1alpha1.LocalIdentityProvider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: "test-uid", Generation: 1234},
+			Spec:       spec,
+		}
+	}
+	userSecret := func(name string, secretLabels map[string]string, data map[string][]byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: name, Labels: secretLabels},
+			Type:       "secrets.pinniped.dev/local-user",
+			Data:       data,
+		}
+	}
+	validUserData := map[string][]byte{"passwordHash": []byte("$2y$10$some-hash")}
+
+	condition := func(typ string, status v1alpha1.ConditionStatus, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               typ,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+			LastTransitionTime: now,
+		}
+	}
+	selectorValid := condition("SecretSelectorValid", "True", "Success", "spec.users.secretSelector is valid")
+
+	tests := []struct {
+		name                    string
+		inputUpstreams          []runtime.Object
+		inputSecrets            []runtime.Object
+		wantErr                 string
+		wantResultingCache      []*upstreamlocal.ProviderConfig
+		wantSelector            string
+		wantResultingPhase      v1alpha1.LocalIdentityProviderPhase
+		wantResultingConditions []v1alpha1.Condition
+	}{
+		{
+			name:           "valid upstream without any users",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			wantResultingCache: []*upstreamlocal.ProviderConfig{{
+				Name:        testName,
+				ResourceUID: "test-uid",
+				Namespace:   testNamespace,
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				selectorValid,
+				condition("UsersValid", "True", "Success", "loaded 0 valid users"),
+			},
+		},
+		{
+			name: "valid upstream which selects some of the users",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.LocalIdentityProviderSpec) {
+				spec.Users.SecretSelector = metav1.LabelSelector{MatchLabels: map[string]string{"team": "admins"}}
+			})},
+			inputSecrets: []runtime.Object{
+				userSecret("user-1", map[string]string{"team": "admins"}, validUserData),
+				userSecret("user-2", map[string]string{"team": "admins"}, validUserData),
+				userSecret("user-3", map[string]string{"team": "others"}, validUserData),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: "not-a-user", Labels: map[string]string{"team": "admins"}},
+					Type:       corev1.SecretTypeOpaque,
+				},
+			},
+			wantResultingCache: []*upstreamlocal.ProviderConfig{{
+				Name:        testName,
+				ResourceUID: "test-uid",
+				Namespace:   testNamespace,
+			}},
+			wantSelector:       "team=admins",
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				selectorValid,
+				condition("UsersValid", "True", "Success", "loaded 2 valid users"),
+			},
+		},
+		{
+			name:           "invalid user Secrets are reported but do not prevent the other users from logging in",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets: []runtime.Object{
+				userSecret("user-1", nil, validUserData),
+				userSecret("user-2", nil, map[string][]byte{}),
+				userSecret("user-3", nil, map[string][]byte{"passwordHash": []byte("$2y$10$some-hash"), "disabled": []byte("maybe")}),
+			},
+			wantResultingCache: []*upstreamlocal.ProviderConfig{{
+				Name:        testName,
+				ResourceUID: "test-uid",
+				Namespace:   testNamespace,
+			}},
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				selectorValid,
+				condition("UsersValid", "False", "SecretInvalidData",
+					`loaded 1 valid users, but some user Secrets are invalid: user Secret "user-2" is missing required key "passwordHash"; user Secret "user-3" has invalid "disabled": must be "true" or "false"`),
+			},
+		},
+		{
+			name: "invalid selector",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.LocalIdentityProviderSpec) {
+				spec.Users.SecretSelector = metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "team", Operator: "Bogus"},
+				}}
+			})},
+			inputSecrets:       []runtime.Object{userSecret("user-1", nil, validUserData)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("SecretSelectorValid", "False", "InvalidSelector",
+					`spec.users.secretSelector is invalid: "Bogus" is not a valid pod selector operator`),
+				condition("UsersValid", "Unknown", "UnableToValidate", "unable to validate; see other conditions for details"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset(tt.inputSecrets...)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetLocalIdentityProviders([]provider.UpstreamLDAPIdentityProviderI{
+				&upstreamlocal.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().LocalIdentityProviders(),
+				kubeInformers.Core().V1().Secrets(),
+				testLog.Logger,
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			kubeInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetLocalIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamlocal.ProviderConfig)
+				require.NotNil(t, actualIDP.Secrets)
+				require.NotNil(t, actualIDP.Clock)
+				require.Equal(t, tt.wantSelector, actualIDP.SecretSelector.String())
+
+				// The Secret lister, clock, and selector are asserted separately.
+				actualIDP.Secrets = nil
+				actualIDP.Clock = nil
+				actualIDP.SecretSelector = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstream, err := fakePinnipedClient.IDPV1alpha1().LocalIdentityProviders(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResultingPhase, actualUpstream.Status.Phase)
+			for i := range actualUpstream.Status.Conditions {
+				if time.Since(actualUpstream.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+					actualUpstream.Status.Conditions[i].LastTransitionTime = now
+				}
+			}
+			require.Equal(t, tt.wantResultingConditions, actualUpstream.Status.Conditions)
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package oauth2upstreamwatcher implements a controller which watches OAuth2IdentityProviders.
+package oauth2upstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/constable"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/upstreamoauth2"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	oauth2ControllerName = "oauth2-upstream-observer"
+
+	// Constants related to the client credentials Secret.
+	oauth2ClientSecretType corev1.SecretType = "secrets.pinniped.dev/oauth2-client"
+
+	clientIDDataKey     = "clientID"
+	clientSecretDataKey = "clientSecret"
+
+	// Constants related to conditions.
+	typeClientCredentialsValid = "ClientCredentialsValid" //nolint:gosec // this is not a credential
+	typeEndpointsValid         = "EndpointsValid"
+	typeTLSConfigurationValid  = "TLSConfigurationValid"
+	typeClaimsValid            = "ClaimsValid"
+	typeAdditionalParamsValid  = "AdditionalAuthorizeParametersValid"
+
+	reasonInvalidEndpoint = "InvalidEndpoint"
+	reasonInvalidClaims   = "InvalidClaims"
+	reasonDisallowedParam = "DisallowedParameterName"
+
+	// Errors that are generated by our reconcile process.
+	errOAuth2FailureStatus = constable.Error("OAuth2IdentityProvider has a failing condition")
+)
+
+// These parameters are always set by the Supervisor, so they may not be overridden by additionalAuthorizeParameters.
+var disallowedAdditionalAuthorizeParameters = sets.NewString( //nolint: gochecknoglobals
+	"response_type",
+	"scope",
+	"client_id",
+	"state",
+	"code_challenge",
+	"code_challenge_method",
+	"redirect_uri",
+)
+
+// UpstreamOAuth2IdentityProviderICache is a thread safe cache that holds a list of validated upstream OAuth2 IDP configurations.
+type UpstreamOAuth2IdentityProviderICache interface {
+	SetOAuth2IdentityProviders([]provider.UpstreamOAuth2IdentityProviderI)
+}
+
+type oauth2WatcherController struct {
+	cache                          UpstreamOAuth2IdentityProviderICache
+	log                            logr.Logger
+	client                         pinnipedclientset.Interface
+	oauth2IdentityProviderInformer idpinformers.OAuth2IdentityProviderInformer
+	secretInformer                 corev1informers.SecretInformer
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamOAuth2IdentityProviderICache.
+func New(
+	idpCache UpstreamOAuth2IdentityProviderICache,
+	client pinnipedclientset.Interface,
+	oauth2IdentityProviderInformer idpinformers.OAuth2IdentityProviderInformer,
+	secretInformer corev1informers.SecretInformer,
+	log logr.Logger,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := oauth2WatcherController{
+		cache:                          idpCache,
+		log:                            log.WithName(oauth2ControllerName),
+		client:                         client,
+		oauth2IdentityProviderInformer: oauth2IdentityProviderInformer,
+		secretInformer:                 secretInformer,
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: oauth2ControllerName, Syncer: &c},
+		withInformer(
+			oauth2IdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnySecretOfTypeFilter(oauth2ClientSecretType, pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *oauth2WatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.oauth2IdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list OAuth2IdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamOAuth2IdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, provider.UpstreamOAuth2IdentityProviderI(valid))
+		}
+	}
+	c.cache.SetOAuth2IdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.OAuth2IdentityProvider and returns the validated configuration as a
+// provider.UpstreamOAuth2IdentityProvider. As a side effect, it also updates the status of the v1alpha1.OAuth2IdentityProvider.
+func (c *oauth2WatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.OAuth2IdentityProvider) *upstreamoauth2.ProviderConfig {
+	result := upstreamoauth2.ProviderConfig{
+		Name:        upstream.Name,
+		ResourceUID: upstream.UID,
+		OAuth2Config: &oauth2.Config{
+			Scopes: upstream.Spec.AuthorizationConfig.Scopes,
+		},
+	}
+
+	conditions := []*v1alpha1.Condition{
+		c.validateSecret(upstream, &result),
+		validateEndpoints(upstream, &result),
+		validateTLS(upstream, &result),
+		validateClaims(upstream, &result),
+		validateAdditionalAuthorizeParameters(upstream, &result),
+	}
+
+	c.updateStatus(ctx, upstream, conditions)
+
+	valid := true
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	for _, condition := range conditions {
+		if condition.Status == v1alpha1.ConditionFalse {
+			valid = false
+			log.WithValues(
+				"type", condition.Type,
+				"reason", condition.Reason,
+				"message", condition.Message,
+			).Error(errOAuth2FailureStatus, "found failing condition")
+		}
+	}
+	if valid {
+		return &result
+	}
+	return nil
+}
+
+// validateSecret validates the .spec.client.secretName field and returns the appropriate ClientCredentialsValid condition.
+func (c *oauth2WatcherController) validateSecret(upstream *v1alpha1.OAuth2IdentityProvider, result *upstreamoauth2.ProviderConfig) *v1alpha1.Condition {
+	secretName := upstream.Spec.Client.SecretName
+
+	// Fetch the Secret from informer cache.
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonNotFound,
+			Message: err.Error(),
+		}
+	}
+
+	// Validate the secret .type field.
+	if secret.Type != oauth2ClientSecretType {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonWrongType,
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)", secretName, secret.Type, oauth2ClientSecretType),
+		}
+	}
+
+	// Validate the secret .data field.
+	clientID := secret.Data[clientIDDataKey]
+	clientSecret := secret.Data[clientSecretDataKey]
+	if len(clientID) == 0 || len(clientSecret) == 0 {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonMissingKeys,
+			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q", secretName, []string{clientIDDataKey, clientSecretDataKey}),
+		}
+	}
+
+	// If everything is valid, update the result and set the condition to true.
+	result.OAuth2Config.ClientID = string(clientID)
+	result.OAuth2Config.ClientSecret = string(clientSecret)
+	return &v1alpha1.Condition{
+		Type:    typeClientCredentialsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded client credentials",
+	}
+}
+
+// validateEndpoints validates the .spec.endpoints field and returns the appropriate EndpointsValid condition.
+func validateEndpoints(upstream *v1alpha1.OAuth2IdentityProvider, result *upstreamoauth2.ProviderConfig) *v1alpha1.Condition {
+	endpoints := []struct {
+		field string
+		value string
+	}{
+		{field: "authorizationURL", value: upstream.Spec.Endpoints.AuthorizationURL},
+		{field: "tokenURL", value: upstream.Spec.Endpoints.TokenURL},
+		{field: "profileURL", value: upstream.Spec.Endpoints.ProfileURL},
+	}
+	parsed := make([]*url.URL, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		u, err := url.Parse(endpoint.value)
+		if err != nil || u.Scheme != "https" || u.Host == "" || u.Fragment != "" {
+			return &v1alpha1.Condition{
+				Type:    typeEndpointsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidEndpoint,
+				Message: fmt.Sprintf("spec.endpoints.%s (%q) must be an https URL without a fragment", endpoint.field, endpoint.value),
+			}
+		}
+		parsed = append(parsed, u)
+	}
+
+	result.OAuth2Config.Endpoint = oauth2.Endpoint{
+		AuthURL:  parsed[0].String(),
+		TokenURL: parsed[1].String(),
+	}
+	result.ProfileURL = parsed[2]
+	return &v1alpha1.Condition{
+		Type:    typeEndpointsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "spec.endpoints are valid",
+	}
+}
+
+// validateTLS validates the .spec.tls field, creates the HTTP client, and returns the appropriate
+// TLSConfigurationValid condition.
+func validateTLS(upstream *v1alpha1.OAuth2IdentityProvider, result *upstreamoauth2.ProviderConfig) *v1alpha1.Condition {
+	tlsSpec := upstream.Spec.TLS
+	if tlsSpec == nil || tlsSpec.CertificateAuthorityData == "" {
+		result.HTTPClient = defaultClientShortTimeout(nil)
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  upstreamwatchers.ReasonSuccess,
+			Message: "no TLS configuration provided",
+		}
+	}
+
+	bundle, err := base64.StdEncoding.DecodeString(tlsSpec.CertificateAuthorityData)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: fmt.Sprintf("spec.tls.certificateAuthorityData is invalid: %s", err.Error()),
+		}
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(bundle) {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: fmt.Sprintf("spec.tls.certificateAuthorityData is invalid: %s", upstreamwatchers.ErrNoCertificates),
+		}
+	}
+
+	result.HTTPClient = defaultClientShortTimeout(rootCAs)
+	return &v1alpha1.Condition{
+		Type:    typeTLSConfigurationValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded TLS configuration",
+	}
+}
+
+// validateClaims validates the JSONPath expressions in the .spec.claims field and returns the appropriate
+// ClaimsValid condition.
+func validateClaims(upstream *v1alpha1.OAuth2IdentityProvider, result *upstreamoauth2.ProviderConfig) *v1alpha1.Condition {
+	claims := upstream.Spec.Claims
+	expressions := []struct {
+		field      string
+		expression string
+	}{
+		{field: "username", expression: claims.Username},
+		{field: "groups", expression: claims.Groups},
+		{field: "userID", expression: claims.UserID},
+	}
+	for _, e := range expressions {
+		if e.expression == "" && e.field != "username" {
+			continue
+		}
+		if _, err := upstreamoauth2.ParseJSONPath(e.expression); err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClaimsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidClaims,
+				Message: fmt.Sprintf("spec.claims.%s is invalid: %s", e.field, err.Error()),
+			}
+		}
+	}
+
+	result.UsernameExpression = claims.Username
+	result.GroupsExpression = claims.Groups
+	result.UserIDExpression = claims.UserID
+	return &v1alpha1.Condition{
+		Type:    typeClaimsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "spec.claims are valid",
+	}
+}
+
+// validateAdditionalAuthorizeParameters validates the .spec.authorizationConfig.additionalAuthorizeParameters field
+// and returns the appropriate AdditionalAuthorizeParametersValid condition.
+func validateAdditionalAuthorizeParameters(upstream *v1alpha1.OAuth2IdentityProvider, result *upstreamoauth2.ProviderConfig) *v1alpha1.Condition {
+	params := map[string]string{}
+	var rejectedNames []string
+	for _, param := range upstream.Spec.AuthorizationConfig.AdditionalAuthorizeParameters {
+		if disallowedAdditionalAuthorizeParameters.Has(param.Name) {
+			rejectedNames = append(rejectedNames, param.Name)
+			continue
+		}
+		params[param.Name] = param.Value
+	}
+	if len(rejectedNames) > 0 {
+		return &v1alpha1.Condition{
+			Type:   typeAdditionalParamsValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: reasonDisallowedParam,
+			Message: fmt.Sprintf("the following additionalAuthorizeParameters are not allowed: %s",
+				strings.Join(rejectedNames, ",")),
+		}
+	}
+
+	result.AdditionalAuthcodeParams = params
+	return &v1alpha1.Condition{
+		Type:    typeAdditionalParamsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "additionalAuthorizeParameters parameter names are allowed",
+	}
+}
+
+func (c *oauth2WatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.OAuth2IdentityProvider, conditions []*v1alpha1.Condition) {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.Merge(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.OAuth2PhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.OAuth2PhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		OAuth2IdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "failed to update status")
+	}
+}
+
+func defaultClientShortTimeout(rootCAs *x509.CertPool) *http.Client {
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c
+}
@@ -0,0 +1,459 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oauth2upstreamwatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/certauthority"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/testlogger"
+	"go.pinniped.dev/internal/upstreamoauth2"
+)
+
+func TestOAuth2UpstreamWatcherControllerFilterSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		secret     metav1.Object
+		wantAdd    bool
+		wantUpdate bool
+		wantDelete bool
+	}{
+		{
+			name: "a secret of the right type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/oauth2-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
+		{
+			name: "a secret of the wrong type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/oidc-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+		{
+			name: "resource of wrong data type",
+			secret: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset()
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			secretInformer := kubeInformers.Core().V1().Secrets()
+			withInformer := testutil.NewObservableWithInformerOption()
+
+			New(
+				cache,
+				nil,
+				pinnipedInformers.IDP().V1alpha1().OAuth2IdentityProviders(),
+				secretInformer,
+				testLog.Logger,
+				withInformer.WithInformer,
+			)
+
+			unrelated := corev1.Secret{}
+			filter := withInformer.GetFilterForInformer(secretInformer)
+			require.Equal(t, test.wantAdd, filter.Add(test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(&unrelated, test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(test.secret, &unrelated))
+			require.Equal(t, test.wantDelete, filter.Delete(test.secret))
+		})
+	}
+}
+
+func TestOAuth2UpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace    = "test-namespace"
+		testName         = "test-name"
+		testSecretName   = "test-client-secret"
+		testClientID     = "test-client-id"
+		testClientSecret = "test-client-secret"
+		testAuthURL      = "https://oauth2.example.com/authorize"
+		testTokenURL     = "https://oauth2.example.com/token"
+		testProfileURL   = "https://api.example.com/v1/me"
+	)
+
+	ca, err := certauthority.New("test-ca", time.Hour)
+	require.NoError(t, err)
+	testCABase64 := base64.StdEncoding.EncodeToString(ca.Bundle())
+
+	validSpec := func() v1alpha1.OAuth2IdentityProviderSpec {
+		return v1alpha1.OAuth2IdentityProviderSpec{
+			Endpoints: v1alpha1.OAuth2Endpoints{
+				AuthorizationURL: testAuthURL,
+				TokenURL:         testTokenURL,
+				ProfileURL:       testProfileURL,
+			},
+			Claims: v1alpha1.OAuth2Claims{Username: "{.login}"},
+			Client: v1alpha1.OAuth2Client{SecretName: testSecretName},
+		}
+	}
+	validUpstream := func(editSpec func(*v1alpha1.OAuth2IdentityProviderSpec)) *v1alpha1.OAuth2IdentityProvider {
+		spec := validSpec()
+		if editSpec != nil {
+			editSpec(&spec)
+		}
+		return &v1alpha1.OAuth2IdentityProvider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: "test-uid", Generation: 1234},
+			Spec:       spec,
+		}
+	}
+	validSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+		Type:       "secrets.pinniped.dev/oauth2-client",
+		Data:       map[string][]byte{"clientID": []byte(testClientID), "clientSecret": []byte(testClientSecret)},
+	}
+
+	condition := func(typ string, status v1alpha1.ConditionStatus, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               typ,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+			LastTransitionTime: now,
+		}
+	}
+	additionalParamsValid := condition("AdditionalAuthorizeParametersValid", "True", "Success", "additionalAuthorizeParameters parameter names are allowed")
+	claimsValid := condition("ClaimsValid", "True", "Success", "spec.claims are valid")
+	clientCredentialsValid := condition("ClientCredentialsValid", "True", "Success", "loaded client credentials")
+	endpointsValid := condition("EndpointsValid", "True", "Success", "spec.endpoints are valid")
+	tlsNotConfigured := condition("TLSConfigurationValid", "True", "Success", "no TLS configuration provided")
+
+	validOAuth2Config := func() *oauth2.Config {
+		return &oauth2.Config{
+			ClientID:     testClientID,
+			ClientSecret: testClientSecret,
+			Endpoint:     oauth2.Endpoint{AuthURL: testAuthURL, TokenURL: testTokenURL},
+		}
+	}
+
+	tests := []struct {
+		name                    string
+		inputUpstreams          []runtime.Object
+		inputSecrets            []runtime.Object
+		wantErr                 string
+		wantResultingCache      []*upstreamoauth2.ProviderConfig
+		wantResultingPhase      v1alpha1.OAuth2IdentityProviderPhase
+		wantResultingConditions []v1alpha1.Condition
+	}{
+		{
+			name:           "valid upstream with minimal configuration",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets:   []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamoauth2.ProviderConfig{{
+				Name:                     testName,
+				ResourceUID:              "test-uid",
+				UsernameExpression:       "{.login}",
+				AdditionalAuthcodeParams: map[string]string{},
+				OAuth2Config:             validOAuth2Config(),
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				clientCredentialsValid,
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "valid upstream with all settings",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64}
+				spec.AuthorizationConfig = v1alpha1.OAuth2AuthorizationConfig{
+					Scopes:                        []string{"profile", "offline"},
+					AdditionalAuthorizeParameters: []v1alpha1.Parameter{{Name: "prompt", Value: "consent"}},
+				}
+				spec.Claims = v1alpha1.OAuth2Claims{Username: "{.login}", Groups: "{.teams[*].name}", UserID: "{.id}"}
+			})},
+			inputSecrets: []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamoauth2.ProviderConfig{{
+				Name:                     testName,
+				ResourceUID:              "test-uid",
+				UsernameExpression:       "{.login}",
+				GroupsExpression:         "{.teams[*].name}",
+				UserIDExpression:         "{.id}",
+				AdditionalAuthcodeParams: map[string]string{"prompt": "consent"},
+				OAuth2Config: func() *oauth2.Config {
+					c := validOAuth2Config()
+					c.Scopes = []string{"profile", "offline"}
+					return c
+				}(),
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				clientCredentialsValid,
+				endpointsValid,
+				condition("TLSConfigurationValid", "True", "Success", "loaded TLS configuration"),
+			},
+		},
+		{
+			name:               "missing secret",
+			inputUpstreams:     []runtime.Object{validUpstream(nil)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				condition("ClientCredentialsValid", "False", "SecretNotFound", `secret "test-client-secret" not found`),
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name:           "secret has wrong type",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+				Type:       "secrets.pinniped.dev/oidc-client",
+				Data:       validSecret.Data,
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				condition("ClientCredentialsValid", "False", "SecretWrongType",
+					`referenced Secret "test-client-secret" has wrong type "secrets.pinniped.dev/oidc-client" (should be "secrets.pinniped.dev/oauth2-client")`),
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name:           "secret is missing the client secret",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+				Type:       "secrets.pinniped.dev/oauth2-client",
+				Data:       map[string][]byte{"clientID": []byte(testClientID)},
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				condition("ClientCredentialsValid", "False", "SecretMissingKeys",
+					`referenced Secret "test-client-secret" is missing required keys ["clientID" "clientSecret"]`),
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "profile URL is not https",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.Endpoints.ProfileURL = "http://api.example.com/v1/me"
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				clientCredentialsValid,
+				condition("EndpointsValid", "False", "InvalidEndpoint",
+					`spec.endpoints.profileURL ("http://api.example.com/v1/me") must be an https URL without a fragment`),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "CA bundle is not base64",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: "not-base64"}
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				clientCredentialsValid,
+				endpointsValid,
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.tls.certificateAuthorityData is invalid: illegal base64 data at input byte 3"),
+			},
+		},
+		{
+			name: "CA bundle has no certificates",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not-a-cert"))}
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				claimsValid,
+				clientCredentialsValid,
+				endpointsValid,
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.tls.certificateAuthorityData is invalid: no certificates found"),
+			},
+		},
+		{
+			name: "username expression is not enclosed in curly braces",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.Claims.Username = ".login"
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				condition("ClaimsValid", "False", "InvalidClaims",
+					`spec.claims.username is invalid: JSONPath expression ".login" must be enclosed in curly braces, e.g. "{.login}"`),
+				clientCredentialsValid,
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "groups expression cannot be parsed",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.Claims.Groups = "{.teams[}"
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				additionalParamsValid,
+				condition("ClaimsValid", "False", "InvalidClaims",
+					`spec.claims.groups is invalid: invalid JSONPath expression "{.teams[}": unterminated array`),
+				clientCredentialsValid,
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "disallowed additional authorize parameters",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.OAuth2IdentityProviderSpec) {
+				spec.AuthorizationConfig.AdditionalAuthorizeParameters = []v1alpha1.Parameter{
+					{Name: "prompt", Value: "consent"},
+					{Name: "client_id", Value: "other-client"},
+					{Name: "state", Value: "some-state"},
+				}
+			})},
+			inputSecrets:       []runtime.Object{validSecret},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("AdditionalAuthorizeParametersValid", "False", "DisallowedParameterName",
+					"the following additionalAuthorizeParameters are not allowed: client_id,state"),
+				claimsValid,
+				clientCredentialsValid,
+				endpointsValid,
+				tlsNotConfigured,
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset(tt.inputSecrets...)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetOAuth2IdentityProviders([]provider.UpstreamOAuth2IdentityProviderI{
+				&upstreamoauth2.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().OAuth2IdentityProviders(),
+				kubeInformers.Core().V1().Secrets(),
+				testLog.Logger,
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			kubeInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetOAuth2IdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamoauth2.ProviderConfig)
+				require.NotNil(t, actualIDP.HTTPClient)
+				require.Equal(t, time.Minute, actualIDP.HTTPClient.Timeout)
+				require.NotNil(t, actualIDP.ProfileURL)
+				require.Equal(t, testProfileURL, actualIDP.ProfileURL.String())
+
+				// The HTTP client and profile URL are asserted separately.
+				actualIDP.HTTPClient = nil
+				actualIDP.ProfileURL = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstream, err := fakePinnipedClient.IDPV1alpha1().OAuth2IdentityProviders(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResultingPhase, actualUpstream.Status.Phase)
+			for i := range actualUpstream.Status.Conditions {
+				if time.Since(actualUpstream.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+					actualUpstream.Status.Conditions[i].LastTransitionTime = now
+				}
+			}
+			require.Equal(t, tt.wantResultingConditions, actualUpstream.Status.Conditions)
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -5,7 +5,9 @@
 package oidcupstreamwatcher
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
@@ -29,6 +31,7 @@ import (
 	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
 	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
 	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/claimexpression"
 	"go.pinniped.dev/internal/constable"
 	pinnipedcontroller "go.pinniped.dev/internal/controller"
 	"go.pinniped.dev/internal/controller/conditionsutil"
@@ -48,6 +51,8 @@ const (
 
 	clientIDDataKey     = "clientID"
 	clientSecretDataKey = "clientSecret"
+	privateKeyDataKey   = "privateKey"
+	privateKeyIDDataKey = "privateKeyID"
 
 	// Constants related to the OIDC provider discovery cache. These do not affect the cache of JWKS.
 	oidcValidatorCacheTTL = 15 * time.Minute
@@ -56,11 +61,17 @@ const (
 	typeClientCredentialsValid             = "ClientCredentialsValid" //nolint:gosec // this is not a credential
 	typeAdditionalAuthorizeParametersValid = "AdditionalAuthorizeParametersValid"
 	typeOIDCDiscoverySucceeded             = "OIDCDiscoverySucceeded"
+	typeClaimsValid                        = "ClaimsValid"
 
 	reasonUnreachable             = "Unreachable"
 	reasonInvalidResponse         = "InvalidResponse"
 	reasonDisallowedParameterName = "DisallowedParameterName"
+	reasonInvalidExpression       = "InvalidExpression"
+	reasonConflictingSettings     = "ConflictingSettings"
+	reasonInvalidPrivateKey       = "InvalidPrivateKey"
+	reasonInvalidProxyConfig      = "InvalidProxyConfig"
 	allParamNamesAllowedMsg       = "additionalAuthorizeParameters parameter names are allowed"
+	claimsValidMsg                = "claims configuration is valid"
 
 	// Errors that are generated by our reconcile process.
 	errOIDCFailureStatus = constable.Error("OIDCIdentityProvider has a failing condition")
@@ -101,24 +112,40 @@ type lruValidatorCacheEntry struct {
 	client   *http.Client
 }
 
-func (c *lruValidatorCache) getProvider(spec *v1alpha1.OIDCIdentityProviderSpec) (*oidc.Provider, *http.Client) {
-	if result, ok := c.cache.Get(c.cacheKey(spec)); ok {
+// httpClientSecrets holds the settings for the HTTP client which are loaded from Secrets, rather than from the spec.
+type httpClientSecrets struct {
+	clientCert *tls.Certificate
+	proxyURL   *url.URL // includes the proxy credentials, if any
+}
+
+func (c *lruValidatorCache) getProvider(spec *v1alpha1.OIDCIdentityProviderSpec, secrets *httpClientSecrets) (*oidc.Provider, *http.Client) {
+	if result, ok := c.cache.Get(c.cacheKey(spec, secrets)); ok {
 		entry := result.(*lruValidatorCacheEntry)
 		return entry.provider, entry.client
 	}
 	return nil, nil
 }
 
-func (c *lruValidatorCache) putProvider(spec *v1alpha1.OIDCIdentityProviderSpec, provider *oidc.Provider, client *http.Client) {
-	c.cache.Set(c.cacheKey(spec), &lruValidatorCacheEntry{provider: provider, client: client}, oidcValidatorCacheTTL)
+func (c *lruValidatorCache) putProvider(spec *v1alpha1.OIDCIdentityProviderSpec, secrets *httpClientSecrets, provider *oidc.Provider, client *http.Client) {
+	c.cache.Set(c.cacheKey(spec, secrets), &lruValidatorCacheEntry{provider: provider, client: client}, oidcValidatorCacheTTL)
 }
 
-func (c *lruValidatorCache) cacheKey(spec *v1alpha1.OIDCIdentityProviderSpec) interface{} {
-	var key struct{ issuer, caBundle string }
+func (c *lruValidatorCache) cacheKey(spec *v1alpha1.OIDCIdentityProviderSpec, secrets *httpClientSecrets) interface{} {
+	var key struct{ issuer, caBundle, clientCert, proxyURL, noProxy string }
 	key.issuer = spec.Issuer
 	if spec.TLS != nil {
 		key.caBundle = spec.TLS.CertificateAuthorityData
 	}
+	if secrets.clientCert != nil {
+		// The certificate chain is enough to notice rotation, since a new key always comes with a new certificate.
+		key.clientCert = string(bytes.Join(secrets.clientCert.Certificate, nil))
+	}
+	if secrets.proxyURL != nil {
+		key.proxyURL = secrets.proxyURL.String()
+	}
+	if spec.Proxy != nil {
+		key.noProxy = spec.Proxy.NoProxy
+	}
 	return key
 }
 
@@ -129,8 +156,8 @@ type oidcWatcherController struct {
 	oidcIdentityProviderInformer idpinformers.OIDCIdentityProviderInformer
 	secretInformer               corev1informers.SecretInformer
 	validatorCache               interface {
-		getProvider(*v1alpha1.OIDCIdentityProviderSpec) (*oidc.Provider, *http.Client)
-		putProvider(*v1alpha1.OIDCIdentityProviderSpec, *oidc.Provider, *http.Client)
+		getProvider(*v1alpha1.OIDCIdentityProviderSpec, *httpClientSecrets) (*oidc.Provider, *http.Client)
+		putProvider(*v1alpha1.OIDCIdentityProviderSpec, *httpClientSecrets, *oidc.Provider, *http.Client)
 	}
 }
 
@@ -160,7 +187,10 @@ func New(
 		),
 		withInformer(
 			secretInformer,
-			pinnipedcontroller.MatchAnySecretOfTypeFilter(oidcClientSecretType, pinnipedcontroller.SingletonQueue()),
+			pinnipedcontroller.MatchAnySecretOfTypesFilter(
+				[]corev1.SecretType{oidcClientSecretType, corev1.SecretTypeTLS, corev1.SecretTypeBasicAuth},
+				pinnipedcontroller.SingletonQueue(),
+			),
 			controllerlib.InformerOption{},
 		),
 	)
@@ -237,6 +267,7 @@ func (c *oidcWatcherController) validateUpstream(ctx controllerlib.Context, upst
 			Message: allParamNamesAllowedMsg,
 		})
 	}
+	conditions = append(conditions, validateClaims(upstream, &result))
 
 	c.updateStatus(ctx.Context, upstream, conditions)
 
@@ -283,21 +314,51 @@ func (c *oidcWatcherController) validateSecret(upstream *v1alpha1.OIDCIdentityPr
 		}
 	}
 
-	// Validate the secret .data field.
+	// Validate the secret .data field. The client authenticates using either a client secret or a private key, or
+	// using only its TLS client certificate when one is configured.
 	clientID := secret.Data[clientIDDataKey]
 	clientSecret := secret.Data[clientSecretDataKey]
-	if len(clientID) == 0 || len(clientSecret) == 0 {
+	privateKey := secret.Data[privateKeyDataKey]
+	usesTLSClientAuth := upstream.Spec.TLS != nil && upstream.Spec.TLS.ClientCertificateSecretName != ""
+	if len(clientID) == 0 || (len(clientSecret) == 0 && len(privateKey) == 0 && !usesTLSClientAuth) {
+		message := fmt.Sprintf("referenced Secret %q is missing required keys %q or %q", secretName,
+			[]string{clientIDDataKey, clientSecretDataKey}, []string{clientIDDataKey, privateKeyDataKey})
+		if usesTLSClientAuth {
+			message = fmt.Sprintf("referenced Secret %q is missing required keys %q", secretName, []string{clientIDDataKey})
+		}
 		return &v1alpha1.Condition{
 			Type:    typeClientCredentialsValid,
 			Status:  v1alpha1.ConditionFalse,
 			Reason:  upstreamwatchers.ReasonMissingKeys,
-			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q", secretName, []string{clientIDDataKey, clientSecretDataKey}),
+			Message: message,
+		}
+	}
+	if len(clientSecret) > 0 && len(privateKey) > 0 {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonConflictingSettings,
+			Message: fmt.Sprintf("referenced Secret %q must not contain both of the keys %q", secretName, []string{clientSecretDataKey, privateKeyDataKey}),
+		}
+	}
+
+	var privateKeyJWT *upstreamoidc.PrivateKeyJWT
+	if len(privateKey) > 0 {
+		privateKeyJWT, err = upstreamoidc.NewPrivateKeyJWT(privateKey, string(secret.Data[privateKeyIDDataKey]))
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClientCredentialsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidPrivateKey,
+				Message: fmt.Sprintf("referenced Secret %q has invalid key %q: %s", secretName, privateKeyDataKey, err.Error()),
+			}
 		}
 	}
 
 	// If everything is valid, update the result and set the condition to true.
 	result.Config.ClientID = string(clientID)
 	result.Config.ClientSecret = string(clientSecret)
+	result.PrivateKeyJWT = privateKeyJWT
 	return &v1alpha1.Condition{
 		Type:    typeClientCredentialsValid,
 		Status:  v1alpha1.ConditionTrue,
@@ -306,15 +367,90 @@ func (c *oidcWatcherController) validateSecret(upstream *v1alpha1.OIDCIdentityPr
 	}
 }
 
+// validateClaims validates the .spec.claims field, compiles any expressions, and returns the appropriate ClaimsValid
+// condition.
+func validateClaims(upstream *v1alpha1.OIDCIdentityProvider, result *upstreamoidc.ProviderConfig) *v1alpha1.Condition {
+	claims := upstream.Spec.Claims
+
+	if claims.Username != "" && claims.UsernameExpression != "" {
+		return &v1alpha1.Condition{
+			Type:    typeClaimsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonConflictingSettings,
+			Message: "claims.username and claims.usernameExpression cannot both be set",
+		}
+	}
+	if claims.Groups != "" && claims.GroupsExpression != "" {
+		return &v1alpha1.Condition{
+			Type:    typeClaimsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonConflictingSettings,
+			Message: "claims.groups and claims.groupsExpression cannot both be set",
+		}
+	}
+
+	if claims.UsernameExpression != "" {
+		usernameExpression, err := claimexpression.NewUsernameExpression(claims.UsernameExpression)
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClaimsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidExpression,
+				Message: fmt.Sprintf("claims.usernameExpression is invalid: %s", err.Error()),
+			}
+		}
+		result.UsernameExpression = usernameExpression
+	}
+	if claims.GroupsExpression != "" {
+		groupsExpression, err := claimexpression.NewGroupsExpression(claims.GroupsExpression)
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClaimsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidExpression,
+				Message: fmt.Sprintf("claims.groupsExpression is invalid: %s", err.Error()),
+			}
+		}
+		result.GroupsExpression = groupsExpression
+	}
+
+	return &v1alpha1.Condition{
+		Type:    typeClaimsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: claimsValidMsg,
+	}
+}
+
 // validateIssuer validates the .spec.issuer field, performs OIDC discovery, and returns the appropriate OIDCDiscoverySucceeded condition.
 func (c *oidcWatcherController) validateIssuer(ctx context.Context, upstream *v1alpha1.OIDCIdentityProvider, result *upstreamoidc.ProviderConfig) *v1alpha1.Condition {
+	// Load the client certificate and proxy settings first, if there are any, because they are part of the cache key.
+	clientCert, err := c.getClientCertificate(upstream)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeOIDCDiscoverySucceeded,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: err.Error(),
+		}
+	}
+	proxyURL, err := c.getProxyURL(upstream)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeOIDCDiscoverySucceeded,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidProxyConfig,
+			Message: err.Error(),
+		}
+	}
+	secrets := &httpClientSecrets{clientCert: clientCert, proxyURL: proxyURL}
+
 	// Get the provider and HTTP Client from cache if possible.
-	discoveredProvider, httpClient := c.validatorCache.getProvider(&upstream.Spec)
+	discoveredProvider, httpClient := c.validatorCache.getProvider(&upstream.Spec, secrets)
 
 	// If the provider does not exist in the cache, do a fresh discovery lookup and save to the cache.
 	if discoveredProvider == nil {
-		var err error
-		httpClient, err = getClient(upstream)
+		httpClient, err = getClient(upstream, secrets)
 		if err != nil {
 			return &v1alpha1.Condition{
 				Type:    typeOIDCDiscoverySucceeded,
@@ -346,7 +482,7 @@ func (c *oidcWatcherController) validateIssuer(ctx context.Context, upstream *v1
 		}
 
 		// Update the cache with the newly discovered value.
-		c.validatorCache.putProvider(&upstream.Spec, discoveredProvider, httpClient)
+		c.validatorCache.putProvider(&upstream.Spec, secrets, discoveredProvider, httpClient)
 	}
 
 	// Get the revocation endpoint, if there is one. Many providers do not offer a revocation endpoint.
@@ -397,6 +533,11 @@ func (c *oidcWatcherController) validateIssuer(ctx context.Context, upstream *v1
 
 	// If everything is valid, update the result and set the condition to true.
 	result.Config.Endpoint = discoveredProvider.Endpoint()
+	if result.Config.ClientSecret == "" {
+		// Without a client secret, the client ID must be sent in the request params rather than using basic auth.
+		// This relies on validateSecret having already been called.
+		result.Config.Endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
 	result.Provider = discoveredProvider
 	result.Client = httpClient
 	return &v1alpha1.Condition{
@@ -431,9 +572,74 @@ func (c *oidcWatcherController) updateStatus(ctx context.Context, upstream *v1al
 	}
 }
 
-func getClient(upstream *v1alpha1.OIDCIdentityProvider) (*http.Client, error) {
+// getClientCertificate loads the client certificate referenced by .spec.tls.clientCertificateSecretName. It returns
+// nil when no client certificate is configured.
+func (c *oidcWatcherController) getClientCertificate(upstream *v1alpha1.OIDCIdentityProvider) (*tls.Certificate, error) {
+	if upstream.Spec.TLS == nil || upstream.Spec.TLS.ClientCertificateSecretName == "" {
+		return nil, nil
+	}
+	secretName := upstream.Spec.TLS.ClientCertificateSecretName
+
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return nil, fmt.Errorf("spec.tls.clientCertificateSecretName is invalid: %w", err)
+	}
+	if secret.Type != corev1.SecretTypeTLS {
+		return nil, fmt.Errorf("spec.tls.clientCertificateSecretName is invalid: referenced Secret %q has wrong type %q (should be %q)",
+			secretName, secret.Type, corev1.SecretTypeTLS)
+	}
+
+	clientCert, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return nil, fmt.Errorf("spec.tls.clientCertificateSecretName is invalid: referenced Secret %q does not contain a valid certificate and key: %w",
+			secretName, err)
+	}
+	return &clientCert, nil
+}
+
+// getProxyURL loads the proxy configured by .spec.proxy, including the credentials referenced by
+// .spec.proxy.credentialsSecretName. It returns nil when no proxy is configured.
+func (c *oidcWatcherController) getProxyURL(upstream *v1alpha1.OIDCIdentityProvider) (*url.URL, error) {
+	if upstream.Spec.Proxy == nil {
+		return nil, nil
+	}
+
+	var username, password string
+	if secretName := upstream.Spec.Proxy.CredentialsSecretName; secretName != "" {
+		secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+		if err != nil {
+			return nil, fmt.Errorf("spec.proxy.credentialsSecretName is invalid: %w", err)
+		}
+		if secret.Type != corev1.SecretTypeBasicAuth {
+			return nil, fmt.Errorf("spec.proxy.credentialsSecretName is invalid: referenced Secret %q has wrong type %q (should be %q)",
+				secretName, secret.Type, corev1.SecretTypeBasicAuth)
+		}
+		username = string(secret.Data[corev1.BasicAuthUsernameKey])
+		password = string(secret.Data[corev1.BasicAuthPasswordKey])
+		if username == "" {
+			return nil, fmt.Errorf("spec.proxy.credentialsSecretName is invalid: referenced Secret %q is missing required key %q",
+				secretName, corev1.BasicAuthUsernameKey)
+		}
+	}
+
+	proxyURL, err := phttp.ProxyURL(upstream.Spec.Proxy.URL, username, password)
+	if err != nil {
+		return nil, fmt.Errorf("spec.proxy.url is invalid: %w", err)
+	}
+	return proxyURL, nil
+}
+
+func getClient(upstream *v1alpha1.OIDCIdentityProvider, secrets *httpClientSecrets) (*http.Client, error) {
+	var opts []phttp.Option
+	if secrets.clientCert != nil {
+		opts = append(opts, phttp.WithClientCertificate(*secrets.clientCert))
+	}
+	if secrets.proxyURL != nil {
+		opts = append(opts, phttp.WithProxy(phttp.ProxyFunc(secrets.proxyURL, upstream.Spec.Proxy.NoProxy)))
+	}
+
 	if upstream.Spec.TLS == nil || upstream.Spec.TLS.CertificateAuthorityData == "" {
-		return defaultClientShortTimeout(nil), nil
+		return defaultClientShortTimeout(nil, opts...), nil
 	}
 
 	bundle, err := base64.StdEncoding.DecodeString(upstream.Spec.TLS.CertificateAuthorityData)
@@ -446,11 +652,11 @@ func getClient(upstream *v1alpha1.OIDCIdentityProvider) (*http.Client, error) {
 		return nil, fmt.Errorf("spec.certificateAuthorityData is invalid: %w", upstreamwatchers.ErrNoCertificates)
 	}
 
-	return defaultClientShortTimeout(rootCAs), nil
+	return defaultClientShortTimeout(rootCAs, opts...), nil
 }
 
-func defaultClientShortTimeout(rootCAs *x509.CertPool) *http.Client {
-	c := phttp.Default(rootCAs)
+func defaultClientShortTimeout(rootCAs *x509.CertPool, opts ...phttp.Option) *http.Client {
+	c := phttp.DefaultWithOptions(rootCAs, opts...)
 	c.Timeout = time.Minute
 	return c
 }
@@ -0,0 +1,371 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package samlupstreamwatcher implements a controller which watches SAMLIdentityProviders.
+package samlupstreamwatcher
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/crewjam/saml/samlsp"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/cache"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/constable"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/upstreamsaml"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	samlControllerName = "saml-upstream-observer"
+
+	// Constants related to conditions.
+	typeIDPMetadataValid            = "IDPMetadataValid"
+	typeServiceProviderKeyPairValid = "ServiceProviderKeyPairValid"
+
+	reasonInvalidMetadata = "InvalidMetadata"
+	reasonInvalidKeyPair  = "InvalidKeyPair"
+
+	// Downloaded metadata is cached, so that the metadata is not downloaded on every sync. The cache entries expire,
+	// so that rotated signing certificates of the identity provider are eventually noticed.
+	metadataCacheTTL = 15 * time.Minute
+
+	// Errors that are generated by our reconcile process.
+	errSAMLFailureStatus = constable.Error("SAMLIdentityProvider has a failing condition")
+)
+
+// UpstreamSAMLIdentityProviderICache is a thread safe cache that holds a list of validated upstream SAML IDP configurations.
+type UpstreamSAMLIdentityProviderICache interface {
+	SetSAMLIdentityProviders([]provider.UpstreamSAMLIdentityProviderI)
+}
+
+// metadataCacheKey identifies downloaded metadata by where and how it was downloaded.
+type metadataCacheKey struct {
+	url                      string
+	certificateAuthorityData string
+}
+
+type samlWatcherController struct {
+	cache                        UpstreamSAMLIdentityProviderICache
+	log                          logr.Logger
+	client                       pinnipedclientset.Interface
+	samlIdentityProviderInformer idpinformers.SAMLIdentityProviderInformer
+	secretInformer               corev1informers.SecretInformer
+	metadataCache                *cache.Expiring
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamSAMLIdentityProviderICache.
+func New(
+	idpCache UpstreamSAMLIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	samlIdentityProviderInformer idpinformers.SAMLIdentityProviderInformer,
+	secretInformer corev1informers.SecretInformer,
+	log logr.Logger,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := samlWatcherController{
+		cache:                        idpCache,
+		log:                          log.WithName(samlControllerName),
+		client:                       client,
+		samlIdentityProviderInformer: samlIdentityProviderInformer,
+		secretInformer:               secretInformer,
+		metadataCache:                cache.NewExpiring(),
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: samlControllerName, Syncer: &c},
+		withInformer(
+			samlIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnySecretOfTypeFilter(corev1.SecretTypeTLS, pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *samlWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.samlIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list SAMLIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamSAMLIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, provider.UpstreamSAMLIdentityProviderI(valid))
+		}
+	}
+	c.cache.SetSAMLIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.SAMLIdentityProvider and returns the validated configuration as a
+// provider.UpstreamSAMLIdentityProvider. As a side effect, it also updates the status of the v1alpha1.SAMLIdentityProvider.
+func (c *samlWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.SAMLIdentityProvider) *upstreamsaml.ProviderConfig {
+	result := upstreamsaml.ProviderConfig{
+		Name:              upstream.Name,
+		ResourceUID:       upstream.UID,
+		UsernameAttribute: upstream.Spec.Claims.Username,
+		GroupsAttribute:   upstream.Spec.Claims.Groups,
+	}
+
+	conditions := []*v1alpha1.Condition{
+		c.validateMetadata(ctx, upstream, &result),
+		c.validateKeyPair(upstream, &result),
+	}
+
+	c.updateStatus(ctx, upstream, conditions)
+
+	valid := true
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	for _, condition := range conditions {
+		if condition.Status == v1alpha1.ConditionFalse {
+			valid = false
+			log.WithValues(
+				"type", condition.Type,
+				"reason", condition.Reason,
+				"message", condition.Message,
+			).Error(errSAMLFailureStatus, "found failing condition")
+		}
+	}
+	if valid {
+		return &result
+	}
+	return nil
+}
+
+// validateMetadata validates the .spec.idpMetadata field, downloads the metadata if needed, and returns the
+// appropriate IDPMetadataValid condition.
+func (c *samlWatcherController) validateMetadata(ctx context.Context, upstream *v1alpha1.SAMLIdentityProvider, result *upstreamsaml.ProviderConfig) *v1alpha1.Condition {
+	spec := upstream.Spec.IDPMetadata
+	invalid := func(format string, a ...interface{}) *v1alpha1.Condition {
+		return &v1alpha1.Condition{
+			Type:    typeIDPMetadataValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidMetadata,
+			Message: fmt.Sprintf(format, a...),
+		}
+	}
+
+	var metadata *saml.EntityDescriptor
+	var source string
+	switch {
+	case spec.URL != "" && spec.XML != "":
+		return invalid("exactly one of spec.idpMetadata.url and spec.idpMetadata.xml must be set, but both are set")
+	case spec.XML != "":
+		var err error
+		metadata, err = samlsp.ParseMetadata([]byte(spec.XML))
+		if err != nil {
+			return invalid("failed to parse spec.idpMetadata.xml: %s", err.Error())
+		}
+		source = "spec.idpMetadata.xml"
+	case spec.URL != "":
+		metadataURL, err := url.Parse(spec.URL)
+		if err != nil || metadataURL.Scheme != "https" || metadataURL.Host == "" {
+			return invalid("spec.idpMetadata.url (%q) must be an https URL", spec.URL)
+		}
+		key := metadataCacheKey{url: spec.URL}
+		if spec.TLS != nil {
+			key.certificateAuthorityData = spec.TLS.CertificateAuthorityData
+		}
+		if cached, ok := c.metadataCache.Get(key); ok {
+			metadata = cached.(*saml.EntityDescriptor)
+		} else {
+			rootCAs, err := rootCAsFromTLSSpec(spec.TLS)
+			if err != nil {
+				return &v1alpha1.Condition{
+					Type:    typeIDPMetadataValid,
+					Status:  v1alpha1.ConditionFalse,
+					Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+					Message: fmt.Sprintf("spec.idpMetadata.tls.certificateAuthorityData is invalid: %s", err.Error()),
+				}
+			}
+			fetchCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			defer cancel()
+			metadata, err = samlsp.FetchMetadata(fetchCtx, defaultClientShortTimeout(rootCAs), *metadataURL)
+			if err != nil {
+				return invalid("failed to fetch metadata from spec.idpMetadata.url (%q): %s", spec.URL, err.Error())
+			}
+			c.metadataCache.Set(key, metadata, metadataCacheTTL)
+		}
+		source = fmt.Sprintf("spec.idpMetadata.url (%q)", spec.URL)
+	default:
+		return invalid("exactly one of spec.idpMetadata.url and spec.idpMetadata.xml must be set, but neither is set")
+	}
+
+	if !hasRedirectBindingSSOService(metadata) {
+		return invalid("metadata from %s does not contain a single sign-on service with the HTTP-Redirect binding", source)
+	}
+
+	result.IDPMetadata = metadata
+	return &v1alpha1.Condition{
+		Type:    typeIDPMetadataValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: fmt.Sprintf("loaded metadata for entity %q from %s", metadata.EntityID, source),
+	}
+}
+
+// validateKeyPair validates the .spec.serviceProvider.keyPairSecretName field and returns the appropriate
+// ServiceProviderKeyPairValid condition.
+func (c *samlWatcherController) validateKeyPair(upstream *v1alpha1.SAMLIdentityProvider, result *upstreamsaml.ProviderConfig) *v1alpha1.Condition {
+	secretName := upstream.Spec.ServiceProvider.KeyPairSecretName
+	if secretName == "" {
+		return &v1alpha1.Condition{
+			Type:    typeServiceProviderKeyPairValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  upstreamwatchers.ReasonSuccess,
+			Message: "no key pair configured, so authentication requests will not be signed",
+		}
+	}
+
+	// Fetch the Secret from informer cache.
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeServiceProviderKeyPairValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonNotFound,
+			Message: err.Error(),
+		}
+	}
+
+	// Validate the secret .type field.
+	if secret.Type != corev1.SecretTypeTLS {
+		return &v1alpha1.Condition{
+			Type:    typeServiceProviderKeyPairValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonWrongType,
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)", secretName, secret.Type, corev1.SecretTypeTLS),
+		}
+	}
+
+	// Validate the secret .data field.
+	keyPair, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeServiceProviderKeyPairValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidKeyPair,
+			Message: fmt.Sprintf("referenced Secret %q does not contain a valid key pair: %s", secretName, err.Error()),
+		}
+	}
+	key, ok := keyPair.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return &v1alpha1.Condition{
+			Type:    typeServiceProviderKeyPairValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidKeyPair,
+			Message: fmt.Sprintf("referenced Secret %q does not contain an RSA private key", secretName),
+		}
+	}
+	cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeServiceProviderKeyPairValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidKeyPair,
+			Message: fmt.Sprintf("referenced Secret %q does not contain a valid key pair: %s", secretName, err.Error()),
+		}
+	}
+
+	// If everything is valid, update the result and set the condition to true.
+	result.Key = key
+	result.Certificate = cert
+	return &v1alpha1.Condition{
+		Type:    typeServiceProviderKeyPairValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded key pair",
+	}
+}
+
+func (c *samlWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.SAMLIdentityProvider, conditions []*v1alpha1.Condition) {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.Merge(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.SAMLPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.SAMLPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		SAMLIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "failed to update status")
+	}
+}
+
+func hasRedirectBindingSSOService(metadata *saml.EntityDescriptor) bool {
+	for _, idpSSODescriptor := range metadata.IDPSSODescriptors {
+		for _, ssoService := range idpSSODescriptor.SingleSignOnServices {
+			if ssoService.Binding == saml.HTTPRedirectBinding {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func rootCAsFromTLSSpec(tlsSpec *v1alpha1.TLSSpec) (*x509.CertPool, error) {
+	if tlsSpec == nil || tlsSpec.CertificateAuthorityData == "" {
+		return nil, nil
+	}
+	bundle, err := base64.StdEncoding.DecodeString(tlsSpec.CertificateAuthorityData)
+	if err != nil {
+		return nil, err
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(bundle) {
+		return nil, upstreamwatchers.ErrNoCertificates
+	}
+	return rootCAs, nil
+}
+
+func defaultClientShortTimeout(rootCAs *x509.CertPool) *http.Client {
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c
+}
@@ -0,0 +1,521 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package samlupstreamwatcher
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/certauthority"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/testlogger"
+	"go.pinniped.dev/internal/upstreamsaml"
+)
+
+func TestSAMLUpstreamWatcherControllerFilterSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		secret     metav1.Object
+		wantAdd    bool
+		wantUpdate bool
+		wantDelete bool
+	}{
+		{
+			name: "a secret of the right type",
+			secret: &corev1.Secret{
+				Type:       corev1.SecretTypeTLS,
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
+		{
+			name: "a secret of the wrong type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/oidc-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+		{
+			name: "resource of wrong data type",
+			secret: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset()
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			secretInformer := kubeInformers.Core().V1().Secrets()
+			withInformer := testutil.NewObservableWithInformerOption()
+
+			New(
+				cache,
+				nil,
+				pinnipedInformers.IDP().V1alpha1().SAMLIdentityProviders(),
+				secretInformer,
+				testLog.Logger,
+				withInformer.WithInformer,
+			)
+
+			unrelated := corev1.Secret{}
+			filter := withInformer.GetFilterForInformer(secretInformer)
+			require.Equal(t, test.wantAdd, filter.Add(test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(&unrelated, test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(test.secret, &unrelated))
+			require.Equal(t, test.wantDelete, filter.Delete(test.secret))
+		})
+	}
+}
+
+func newRSAKeyPairPEM(t *testing.T) (*rsa.PrivateKey, []byte, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return key, certPEM, keyPEM
+}
+
+func TestSAMLUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace     = "test-namespace"
+		testName          = "test-name"
+		testSecretName    = "test-key-pair"
+		testIDPEntityID   = "https://idp.example.com/metadata"
+		testIDPSSOURL     = "https://idp.example.com/sso"
+		testUsernameClaim = "uid"
+		testGroupsClaim   = "groups"
+	)
+
+	idpKey, idpCertPEM, _ := newRSAKeyPairPEM(t)
+	idpCertBlock, _ := pem.Decode(idpCertPEM)
+	idpCert, err := x509.ParseCertificate(idpCertBlock.Bytes)
+	require.NoError(t, err)
+	metadataURL, err := url.Parse(testIDPEntityID)
+	require.NoError(t, err)
+	ssoURL, err := url.Parse(testIDPSSOURL)
+	require.NoError(t, err)
+	idpMetadata := (&saml.IdentityProvider{Key: idpKey, Certificate: idpCert, MetadataURL: *metadataURL, SSOURL: *ssoURL}).Metadata()
+	idpMetadataXML, err := xml.Marshal(idpMetadata)
+	require.NoError(t, err)
+
+	postOnlyMetadata := *idpMetadata
+	postOnlyMetadata.IDPSSODescriptors = []saml.IDPSSODescriptor{idpMetadata.IDPSSODescriptors[0]}
+	postOnlyMetadata.IDPSSODescriptors[0].SingleSignOnServices = []saml.Endpoint{{Binding: saml.HTTPPostBinding, Location: testIDPSSOURL}}
+	postOnlyMetadataXML, err := xml.Marshal(&postOnlyMetadata)
+	require.NoError(t, err)
+
+	metadataServerCA, metadataServerURL := testutil.TLSTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/metadata":
+			_, _ = w.Write(idpMetadataXML)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	metadataServerCABase64 := base64.StdEncoding.EncodeToString([]byte(metadataServerCA))
+
+	spKey, spCertPEM, spKeyPEM := newRSAKeyPairPEM(t)
+	ca, err := certauthority.New("test-ca", time.Hour)
+	require.NoError(t, err)
+	ecdsaCertPEM, ecdsaKeyPEM, err := ca.IssueServerCertPEM([]string{"example.com"}, nil, time.Hour)
+	require.NoError(t, err)
+
+	validSpec := func() v1alpha1.SAMLIdentityProviderSpec {
+		return v1alpha1.SAMLIdentityProviderSpec{
+			IDPMetadata: v1alpha1.SAMLIDPMetadataSpec{XML: string(idpMetadataXML)},
+			Claims:      v1alpha1.SAMLClaims{Username: testUsernameClaim, Groups: testGroupsClaim},
+		}
+	}
+	validUpstream := func(editSpec func(*v1alpha1.SAMLIdentityProviderSpec)) *v1alpha1.SAMLIdentityProvider {
+		spec := validSpec()
+		if editSpec != nil {
+			editSpec(&spec)
+		}
+		return &v1alpha1.SAMLIdentityProvider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: "test-uid", Generation: 1234},
+			Spec:       spec,
+		}
+	}
+	keyPairSecret := func(secretType corev1.SecretType, certPEM, keyPEM []byte) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+			Type:       secretType,
+			Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM},
+		}
+	}
+	withKeyPair := func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+		spec.ServiceProvider.KeyPairSecretName = testSecretName
+	}
+
+	condition := func(conditionType, status, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               conditionType,
+			Status:             v1alpha1.ConditionStatus(status),
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+			LastTransitionTime: now,
+		}
+	}
+	metadataValid := func(source string) v1alpha1.Condition {
+		return condition("IDPMetadataValid", "True", "Success",
+			`loaded metadata for entity "https://idp.example.com/metadata" from `+source)
+	}
+	noKeyPair := condition("ServiceProviderKeyPairValid", "True", "Success",
+		"no key pair configured, so authentication requests will not be signed")
+	keyPairLoaded := condition("ServiceProviderKeyPairValid", "True", "Success", "loaded key pair")
+
+	validProviderConfig := func(withKeyPair bool) *upstreamsaml.ProviderConfig {
+		p := &upstreamsaml.ProviderConfig{
+			Name:              testName,
+			ResourceUID:       "test-uid",
+			UsernameAttribute: testUsernameClaim,
+			GroupsAttribute:   testGroupsClaim,
+		}
+		if withKeyPair {
+			p.Key = spKey
+		}
+		return p
+	}
+
+	tests := []struct {
+		name                    string
+		inputUpstreams          []runtime.Object
+		inputSecrets            []runtime.Object
+		wantErr                 string
+		wantResultingCache      []*upstreamsaml.ProviderConfig
+		wantResultingPhase      v1alpha1.SAMLIdentityProviderPhase
+		wantResultingConditions []v1alpha1.Condition
+	}{
+		{
+			name:                    "metadata from XML without key pair",
+			inputUpstreams:          []runtime.Object{validUpstream(nil)},
+			wantResultingCache:      []*upstreamsaml.ProviderConfig{validProviderConfig(false)},
+			wantResultingPhase:      "Ready",
+			wantResultingConditions: []v1alpha1.Condition{metadataValid("spec.idpMetadata.xml"), noKeyPair},
+		},
+		{
+			name: "metadata from URL with key pair",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata = v1alpha1.SAMLIDPMetadataSpec{
+					URL: metadataServerURL + "/metadata",
+					TLS: &v1alpha1.TLSSpec{CertificateAuthorityData: metadataServerCABase64},
+				}
+				withKeyPair(spec)
+			})},
+			inputSecrets:       []runtime.Object{keyPairSecret(corev1.SecretTypeTLS, spCertPEM, spKeyPEM)},
+			wantResultingCache: []*upstreamsaml.ProviderConfig{validProviderConfig(true)},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				metadataValid(`spec.idpMetadata.url ("` + metadataServerURL + `/metadata")`),
+				keyPairLoaded,
+			},
+		},
+		{
+			name: "both URL and XML",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata.URL = metadataServerURL + "/metadata"
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("IDPMetadataValid", "False", "InvalidMetadata",
+					"exactly one of spec.idpMetadata.url and spec.idpMetadata.xml must be set, but both are set"),
+				noKeyPair,
+			},
+		},
+		{
+			name: "neither URL nor XML",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata = v1alpha1.SAMLIDPMetadataSpec{}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("IDPMetadataValid", "False", "InvalidMetadata",
+					"exactly one of spec.idpMetadata.url and spec.idpMetadata.xml must be set, but neither is set"),
+				noKeyPair,
+			},
+		},
+		{
+			name: "invalid XML",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata.XML = "<not-metadata/>"
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("IDPMetadataValid", "False", "InvalidMetadata",
+					"failed to parse spec.idpMetadata.xml: expected element type <EntityDescriptor> but have <not-metadata>"),
+				noKeyPair,
+			},
+		},
+		{
+			name: "metadata without HTTP-Redirect binding",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata.XML = string(postOnlyMetadataXML)
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("IDPMetadataValid", "False", "InvalidMetadata",
+					"metadata from spec.idpMetadata.xml does not contain a single sign-on service with the HTTP-Redirect binding"),
+				noKeyPair,
+			},
+		},
+		{
+			name: "metadata URL is not found",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata = v1alpha1.SAMLIDPMetadataSpec{
+					URL: metadataServerURL + "/not-found",
+					TLS: &v1alpha1.TLSSpec{CertificateAuthorityData: metadataServerCABase64},
+				}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("IDPMetadataValid", "False", "InvalidMetadata",
+					`failed to fetch metadata from spec.idpMetadata.url ("`+metadataServerURL+`/not-found"): 404 Not Found`),
+				noKeyPair,
+			},
+		},
+		{
+			name: "metadata URL with invalid CA bundle",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.SAMLIdentityProviderSpec) {
+				spec.IDPMetadata = v1alpha1.SAMLIDPMetadataSpec{
+					URL: metadataServerURL + "/metadata",
+					TLS: &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not-a-cert"))},
+				}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("IDPMetadataValid", "False", "InvalidTLSConfig",
+					"spec.idpMetadata.tls.certificateAuthorityData is invalid: no certificates found"),
+				noKeyPair,
+			},
+		},
+		{
+			name:               "key pair secret not found",
+			inputUpstreams:     []runtime.Object{validUpstream(withKeyPair)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				metadataValid("spec.idpMetadata.xml"),
+				condition("ServiceProviderKeyPairValid", "False", "SecretNotFound", `secret "test-key-pair" not found`),
+			},
+		},
+		{
+			name:               "key pair secret has wrong type",
+			inputUpstreams:     []runtime.Object{validUpstream(withKeyPair)},
+			inputSecrets:       []runtime.Object{keyPairSecret(corev1.SecretTypeOpaque, spCertPEM, spKeyPEM)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				metadataValid("spec.idpMetadata.xml"),
+				condition("ServiceProviderKeyPairValid", "False", "SecretWrongType",
+					`referenced Secret "test-key-pair" has wrong type "Opaque" (should be "kubernetes.io/tls")`),
+			},
+		},
+		{
+			name:               "key pair secret has mismatched key",
+			inputUpstreams:     []runtime.Object{validUpstream(withKeyPair)},
+			inputSecrets:       []runtime.Object{keyPairSecret(corev1.SecretTypeTLS, spCertPEM, ecdsaKeyPEM)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				metadataValid("spec.idpMetadata.xml"),
+				condition("ServiceProviderKeyPairValid", "False", "InvalidKeyPair",
+					`referenced Secret "test-key-pair" does not contain a valid key pair: tls: private key type does not match public key type`),
+			},
+		},
+		{
+			name:               "key pair secret has non-RSA key",
+			inputUpstreams:     []runtime.Object{validUpstream(withKeyPair)},
+			inputSecrets:       []runtime.Object{keyPairSecret(corev1.SecretTypeTLS, ecdsaCertPEM, ecdsaKeyPEM)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				metadataValid("spec.idpMetadata.xml"),
+				condition("ServiceProviderKeyPairValid", "False", "InvalidKeyPair",
+					`referenced Secret "test-key-pair" does not contain an RSA private key`),
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset(tt.inputSecrets...)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetSAMLIdentityProviders([]provider.UpstreamSAMLIdentityProviderI{
+				&upstreamsaml.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().SAMLIdentityProviders(),
+				kubeInformers.Core().V1().Secrets(),
+				testLog.Logger,
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			kubeInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetSAMLIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamsaml.ProviderConfig)
+				// The metadata and certificate are asserted separately.
+				require.NotNil(t, actualIDP.IDPMetadata)
+				require.Equal(t, testIDPEntityID, actualIDP.IDPMetadata.EntityID)
+				actualIDP.IDPMetadata = nil
+				if actualIDP.Key != nil {
+					require.NotNil(t, actualIDP.Certificate)
+					require.Equal(t, actualIDP.Key.Public(), actualIDP.Certificate.PublicKey)
+				}
+				actualIDP.Certificate = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstream, err := fakePinnipedClient.IDPV1alpha1().SAMLIdentityProviders(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResultingPhase, actualUpstream.Status.Phase)
+			for i := range actualUpstream.Status.Conditions {
+				if time.Since(actualUpstream.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+					actualUpstream.Status.Conditions[i].LastTransitionTime = now
+				}
+			}
+			require.Equal(t, tt.wantResultingConditions, actualUpstream.Status.Conditions)
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestSAMLUpstreamWatcherControllerCachesDownloadedMetadata(t *testing.T) {
+	t.Parallel()
+
+	idpKey, idpCertPEM, _ := newRSAKeyPairPEM(t)
+	idpCertBlock, _ := pem.Decode(idpCertPEM)
+	idpCert, err := x509.ParseCertificate(idpCertBlock.Bytes)
+	require.NoError(t, err)
+	metadataURL, err := url.Parse("https://idp.example.com/metadata")
+	require.NoError(t, err)
+	idpMetadataXML, err := xml.Marshal((&saml.IdentityProvider{Key: idpKey, Certificate: idpCert, MetadataURL: *metadataURL, SSOURL: *metadataURL}).Metadata())
+	require.NoError(t, err)
+
+	var metadataRequests int32
+	metadataServerCA, metadataServerURL := testutil.TLSTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&metadataRequests, 1)
+		_, _ = w.Write(idpMetadataXML)
+	})
+
+	upstream := &v1alpha1.SAMLIdentityProvider{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "test-namespace", Name: "test-name", UID: "test-uid"},
+		Spec: v1alpha1.SAMLIdentityProviderSpec{IDPMetadata: v1alpha1.SAMLIDPMetadataSpec{
+			URL: metadataServerURL,
+			TLS: &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(metadataServerCA))},
+		}},
+	}
+	fakePinnipedClient := pinnipedfake.NewSimpleClientset(upstream)
+	pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+	kubeInformers := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0)
+	cache := provider.NewDynamicUpstreamIDPProvider()
+
+	controller := New(
+		cache,
+		fakePinnipedClient,
+		pinnipedInformers.IDP().V1alpha1().SAMLIdentityProviders(),
+		kubeInformers.Core().V1().Secrets(),
+		testlogger.New(t).Logger,
+		controllerlib.WithInformer,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pinnipedInformers.Start(ctx.Done())
+	kubeInformers.Start(ctx.Done())
+	controllerlib.TestRunSynchronously(t, controller)
+
+	syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+	require.NoError(t, controllerlib.TestSync(t, controller, syncCtx))
+	require.NoError(t, controllerlib.TestSync(t, controller, syncCtx))
+	require.Len(t, cache.GetSAMLIdentityProviders(), 1)
+	require.Equal(t, int32(1), atomic.LoadInt32(&metadataRequests))
+}
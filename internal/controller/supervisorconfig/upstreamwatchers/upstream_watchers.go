@@ -5,12 +5,15 @@ package upstreamwatchers
 
 import (
 	"context"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	corev1informers "k8s.io/client-go/informers/core/v1"
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
@@ -24,20 +27,24 @@ const (
 	ReasonNotFound         = "SecretNotFound"
 	ReasonWrongType        = "SecretWrongType"
 	ReasonMissingKeys      = "SecretMissingKeys"
+	ReasonInvalidData      = "SecretInvalidData"
 	ReasonSuccess          = "Success"
 	ReasonInvalidTLSConfig = "InvalidTLSConfig"
 
 	ErrNoCertificates = constable.Error("no certificates found")
 
-	LDAPBindAccountSecretType = corev1.SecretTypeBasicAuth
-	probeLDAPTimeout          = 90 * time.Second
+	LDAPBindAccountSecretType           = corev1.SecretTypeBasicAuth
+	LDAPBindClientCertificateSecretType = corev1.SecretTypeTLS
+	probeLDAPTimeout                    = 90 * time.Second
 
 	// Constants related to conditions.
 	typeBindSecretValid              = "BindSecretValid"
 	typeTLSConfigurationValid        = "TLSConfigurationValid"
 	typeLDAPConnectionValid          = "LDAPConnectionValid"
+	typeHostsHealthy                 = "HostsHealthy"
 	TypeSearchBaseFound              = "SearchBaseFound"
 	reasonLDAPConnectionError        = "LDAPConnectionError"
+	reasonHostsUnreachable           = "HostsUnreachable"
 	noTLSConfigurationMessage        = "no TLS configuration provided"
 	loadedTLSConfigurationMessage    = "loaded TLS configuration"
 	ReasonUsingConfigurationFromSpec = "UsingConfigurationFromSpec"
@@ -98,6 +105,77 @@ func (s *ValidatedSettingsCache) Set(upstreamName string, settings ValidatedSett
 	s.ValidatedSettingsByName[upstreamName] = settings
 }
 
+// HostHealthCache remembers the health of the hosts of each upstream which has failover hosts. The providers are
+// replaced during every sync, so the health of their hosts needs to be remembered outside of them.
+type HostHealthCache struct {
+	hostHealthByName map[string]hostHealthForGeneration
+}
+
+type hostHealthForGeneration struct {
+	generation int64
+	hostHealth *upstreamldap.HostHealth
+}
+
+func NewHostHealthCache() *HostHealthCache {
+	return &HostHealthCache{hostHealthByName: map[string]hostHealthForGeneration{}}
+}
+
+// Get returns the HostHealth for an upstream at a given generation. The health is forgotten when the generation
+// changes, since the hosts may have changed.
+func (c *HostHealthCache) Get(upstreamName string, idpSpecGeneration int64) *upstreamldap.HostHealth {
+	cached, found := c.hostHealthByName[upstreamName]
+	if !found || cached.generation != idpSpecGeneration {
+		cached = hostHealthForGeneration{generation: idpSpecGeneration, hostHealth: upstreamldap.NewHostHealth()}
+		c.hostHealthByName[upstreamName] = cached
+	}
+	return cached.hostHealth
+}
+
+// Retain forgets the health of the hosts of all upstreams except for the named ones.
+func (c *HostHealthCache) Retain(upstreamNames sets.String) {
+	for name := range c.hostHealthByName {
+		if !upstreamNames.Has(name) {
+			delete(c.hostHealthByName, name)
+		}
+	}
+}
+
+// GroupCaches remembers the cached group memberships of the users of each upstream which caches the results of its
+// group searches. The providers are replaced during every sync, so the cached groups need to be remembered outside
+// of them.
+type GroupCaches struct {
+	groupCacheByName map[string]groupCacheForGeneration
+}
+
+type groupCacheForGeneration struct {
+	generation int64
+	groupCache *upstreamldap.GroupCache
+}
+
+func NewGroupCaches() *GroupCaches {
+	return &GroupCaches{groupCacheByName: map[string]groupCacheForGeneration{}}
+}
+
+// Get returns the GroupCache for an upstream at a given generation. The cached groups are forgotten when the
+// generation changes, since the group search settings may have changed.
+func (c *GroupCaches) Get(upstreamName string, idpSpecGeneration int64) *upstreamldap.GroupCache {
+	cached, found := c.groupCacheByName[upstreamName]
+	if !found || cached.generation != idpSpecGeneration {
+		cached = groupCacheForGeneration{generation: idpSpecGeneration, groupCache: upstreamldap.NewGroupCache()}
+		c.groupCacheByName[upstreamName] = cached
+	}
+	return cached.groupCache
+}
+
+// Retain forgets the cached groups of all upstreams except for the named ones.
+func (c *GroupCaches) Retain(upstreamNames sets.String) {
+	for name := range c.groupCacheByName {
+		if !upstreamNames.Has(name) {
+			delete(c.groupCacheByName, name)
+		}
+	}
+}
+
 // UpstreamGenericLDAPIDP is a read-only interface for abstracting the differences between LDAP and Active Directory IDP types.
 type UpstreamGenericLDAPIDP interface {
 	Spec() UpstreamGenericLDAPSpec
@@ -162,15 +240,22 @@ func TestConnection(
 	config *upstreamldap.ProviderConfig,
 	currentSecretVersion string,
 ) *v1alpha1.Condition {
+	// The probes do not share the health of the hosts with the provider, since failing to connect to a host
+	// using the wrong protocol does not mean that the host is unhealthy.
+	probeConfig := *config
+	probeConfig.HostHealth = nil
+
 	// First try using TLS.
 	config.ConnectionProtocol = upstreamldap.TLS
-	tlsLDAPProvider := upstreamldap.New(*config)
+	probeConfig.ConnectionProtocol = upstreamldap.TLS
+	tlsLDAPProvider := upstreamldap.New(probeConfig)
 	err := tlsLDAPProvider.TestConnection(ctx)
 	if err != nil {
 		plog.InfoErr("testing LDAP connection using TLS failed, so trying again with StartTLS", err, "host", config.Host)
 		// If there was any error, try again with StartTLS instead.
 		config.ConnectionProtocol = upstreamldap.StartTLS
-		startTLSLDAPProvider := upstreamldap.New(*config)
+		probeConfig.ConnectionProtocol = upstreamldap.StartTLS
+		startTLSLDAPProvider := upstreamldap.New(probeConfig)
 		startTLSErr := startTLSLDAPProvider.TestConnection(ctx)
 		if startTLSErr == nil {
 			plog.Info("testing LDAP connection using StartTLS succeeded", "host", config.Host)
@@ -185,13 +270,18 @@ func TestConnection(
 		}
 	}
 
+	bindDescription := fmt.Sprintf(`bind as user "%s"`, config.BindUsername)
+	if config.BindClientCertificate != nil {
+		bindDescription = "bind with client certificate using SASL EXTERNAL"
+	}
+
 	if err != nil {
 		return &v1alpha1.Condition{
 			Type:   typeLDAPConnectionValid,
 			Status: v1alpha1.ConditionFalse,
 			Reason: reasonLDAPConnectionError,
-			Message: fmt.Sprintf(`could not successfully connect to "%s" and bind as user "%s": %s`,
-				config.Host, config.BindUsername, err.Error()),
+			Message: fmt.Sprintf(`could not successfully connect to "%s" and %s: %s`,
+				config.Host, bindDescription, err.Error()),
 		}
 	}
 
@@ -199,8 +289,8 @@ func TestConnection(
 		Type:   typeLDAPConnectionValid,
 		Status: v1alpha1.ConditionTrue,
 		Reason: ReasonSuccess,
-		Message: fmt.Sprintf(`successfully able to connect to "%s" and bind as user "%s" [validated with Secret "%s" at version "%s"]`,
-			config.Host, config.BindUsername, bindSecretName, currentSecretVersion),
+		Message: fmt.Sprintf(`successfully able to connect to "%s" and %s [validated with Secret "%s" at version "%s"]`,
+			config.Host, bindDescription, bindSecretName, currentSecretVersion),
 	}
 }
 
@@ -233,13 +323,17 @@ func ValidateSecret(secretInformer corev1informers.SecretInformer, secretName st
 		}, ""
 	}
 
-	if secret.Type != corev1.SecretTypeBasicAuth {
+	if secret.Type == LDAPBindClientCertificateSecretType {
+		return validateClientCertificateSecret(secret, config), secret.ResourceVersion
+	}
+
+	if secret.Type != LDAPBindAccountSecretType {
 		return &v1alpha1.Condition{
 			Type:   typeBindSecretValid,
 			Status: v1alpha1.ConditionFalse,
 			Reason: ReasonWrongType,
-			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)",
-				secretName, secret.Type, corev1.SecretTypeBasicAuth),
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q or %q)",
+				secretName, secret.Type, LDAPBindAccountSecretType, LDAPBindClientCertificateSecretType),
 		}, secret.ResourceVersion
 	}
 
@@ -263,6 +357,40 @@ func ValidateSecret(secretInformer corev1informers.SecretInformer, secretName st
 	}, secret.ResourceVersion
 }
 
+// validateClientCertificateSecret loads the client certificate and private key from a bind Secret, which are used
+// to bind using SASL EXTERNAL instead of using a username and password.
+func validateClientCertificateSecret(secret *corev1.Secret, config *upstreamldap.ProviderConfig) *v1alpha1.Condition {
+	certPEM, keyPEM := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(certPEM) == 0 || len(keyPEM) == 0 {
+		return &v1alpha1.Condition{
+			Type:   typeBindSecretValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: ReasonMissingKeys,
+			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q",
+				secret.Name, []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey}),
+		}
+	}
+
+	clientCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:   typeBindSecretValid,
+			Status: v1alpha1.ConditionFalse,
+			Reason: ReasonInvalidData,
+			Message: fmt.Sprintf("referenced Secret %q does not contain a valid certificate and key: %s",
+				secret.Name, err.Error()),
+		}
+	}
+
+	config.BindClientCertificate = &clientCert
+	return &v1alpha1.Condition{
+		Type:    typeBindSecretValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  ReasonSuccess,
+		Message: "loaded bind client certificate",
+	}
+}
+
 // gradatedCondition is a condition and a boolean that tells you whether the condition is fatal or just a warning.
 type gradatedCondition struct {
 	condition *v1alpha1.Condition
@@ -309,10 +437,46 @@ func ValidateGenericLDAP(
 		if searchBaseFoundCondition != nil { // currently, only used for AD, so may be nil
 			conditions.Append(searchBaseFoundCondition, true)
 		}
+		if ldapConnectionValidCondition.Status == v1alpha1.ConditionTrue && config.HasFailoverHosts() {
+			conditions.Append(validateHostHealth(ctx, config), false)
+		}
 	}
 	return conditions
 }
 
+// validateHostHealth checks which hosts can be reached, and reports those which could not be reached during their most
+// recent connection attempts.
+func validateHostHealth(ctx context.Context, config *upstreamldap.ProviderConfig) *v1alpha1.Condition {
+	var unhealthyHosts []upstreamldap.UnhealthyHost
+	if config.HostHealth != nil {
+		checkTimeout, cancelFunc := context.WithTimeout(ctx, probeLDAPTimeout)
+		defer cancelFunc()
+		upstreamldap.New(*config).CheckHostHealth(checkTimeout)
+		unhealthyHosts = config.HostHealth.UnhealthyHosts()
+	}
+
+	if len(unhealthyHosts) > 0 {
+		messages := make([]string, 0, len(unhealthyHosts))
+		for _, unhealthy := range unhealthyHosts {
+			messages = append(messages, fmt.Sprintf("%q: %s", unhealthy.Host, unhealthy.Err.Error()))
+		}
+		return &v1alpha1.Condition{
+			Type:   typeHostsHealthy,
+			Status: v1alpha1.ConditionFalse,
+			Reason: reasonHostsUnreachable,
+			Message: fmt.Sprintf("could not connect to some hosts, so other hosts will be used instead: %s",
+				strings.Join(messages, "; ")),
+		}
+	}
+
+	return &v1alpha1.Condition{
+		Type:    typeHostsHealthy,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  ReasonSuccess,
+		Message: "no recent errors connecting to any host",
+	}
+}
+
 func validateAndSetLDAPServerConnectivityAndSearchBase(
 	ctx context.Context,
 	validatedSettingsCache ValidatedSettingsCacheI,
@@ -381,3 +545,12 @@ func EvaluateConditions(conditions GradatedConditions, config *upstreamldap.Prov
 	// Fully validated provider, so load it into the cache.
 	return upstreamldap.New(*config), false
 }
+
+// CloseIdleConnections closes the pooled LDAP connections of providers which are being replaced.
+func CloseIdleConnections(providers []provider.UpstreamLDAPIdentityProviderI) {
+	for _, p := range providers {
+		if closer, ok := p.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	}
+}
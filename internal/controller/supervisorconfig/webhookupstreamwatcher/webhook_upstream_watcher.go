@@ -0,0 +1,304 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package webhookupstreamwatcher implements a controller which watches WebhookIdentityProviders.
+package webhookupstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corev1informers "k8s.io/client-go/informers/core/v1"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/constable"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/upstreamwebhook"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	webhookControllerName = "webhook-upstream-observer"
+
+	// Constants related to the client credentials Secret.
+	webhookClientSecretType corev1.SecretType = "secrets.pinniped.dev/webhook-client"
+
+	tokenDataKey = "token"
+
+	// Constants related to conditions.
+	typeClientCredentialsValid = "ClientCredentialsValid" //nolint:gosec // this is not a credential
+	typeEndpointValid          = "EndpointValid"
+	typeTLSConfigurationValid  = "TLSConfigurationValid"
+
+	reasonInvalidEndpoint = "InvalidEndpoint"
+
+	// Errors that are generated by our reconcile process.
+	errWebhookFailureStatus = constable.Error("WebhookIdentityProvider has a failing condition")
+)
+
+// UpstreamWebhookIdentityProviderICache is a thread safe cache that holds a list of validated upstream webhook IDP configurations.
+type UpstreamWebhookIdentityProviderICache interface {
+	SetWebhookIdentityProviders([]provider.UpstreamLDAPIdentityProviderI)
+}
+
+type webhookWatcherController struct {
+	cache                           UpstreamWebhookIdentityProviderICache
+	log                             logr.Logger
+	client                          pinnipedclientset.Interface
+	webhookIdentityProviderInformer idpinformers.WebhookIdentityProviderInformer
+	secretInformer                  corev1informers.SecretInformer
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided UpstreamWebhookIdentityProviderICache.
+func New(
+	idpCache UpstreamWebhookIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	webhookIdentityProviderInformer idpinformers.WebhookIdentityProviderInformer,
+	secretInformer corev1informers.SecretInformer,
+	log logr.Logger,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := webhookWatcherController{
+		cache:                           idpCache,
+		log:                             log.WithName(webhookControllerName),
+		client:                          client,
+		webhookIdentityProviderInformer: webhookIdentityProviderInformer,
+		secretInformer:                  secretInformer,
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: webhookControllerName, Syncer: &c},
+		withInformer(
+			webhookIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+		withInformer(
+			secretInformer,
+			pinnipedcontroller.MatchAnySecretOfTypeFilter(webhookClientSecretType, pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *webhookWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.webhookIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list WebhookIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, provider.UpstreamLDAPIdentityProviderI(valid))
+		}
+	}
+	c.cache.SetWebhookIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.WebhookIdentityProvider and returns the validated configuration as an
+// upstreamwebhook.ProviderConfig. As a side effect, it also updates the status of the v1alpha1.WebhookIdentityProvider.
+func (c *webhookWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.WebhookIdentityProvider) *upstreamwebhook.ProviderConfig {
+	result := upstreamwebhook.ProviderConfig{
+		Name:        upstream.Name,
+		ResourceUID: upstream.UID,
+	}
+
+	conditions := []*v1alpha1.Condition{
+		c.validateSecret(upstream, &result),
+		validateEndpoint(upstream, &result),
+		validateTLS(upstream, &result),
+	}
+
+	c.updateStatus(ctx, upstream, conditions)
+
+	valid := true
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	for _, condition := range conditions {
+		if condition.Status == v1alpha1.ConditionFalse {
+			valid = false
+			log.WithValues(
+				"type", condition.Type,
+				"reason", condition.Reason,
+				"message", condition.Message,
+			).Error(errWebhookFailureStatus, "found failing condition")
+		}
+	}
+	if valid {
+		return &result
+	}
+	return nil
+}
+
+// validateSecret validates the .spec.client.secretName field and returns the appropriate ClientCredentialsValid condition.
+func (c *webhookWatcherController) validateSecret(upstream *v1alpha1.WebhookIdentityProvider, result *upstreamwebhook.ProviderConfig) *v1alpha1.Condition {
+	if upstream.Spec.Client == nil {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  upstreamwatchers.ReasonSuccess,
+			Message: "no client credentials configured",
+		}
+	}
+	secretName := upstream.Spec.Client.SecretName
+
+	// Fetch the Secret from informer cache.
+	secret, err := c.secretInformer.Lister().Secrets(upstream.Namespace).Get(secretName)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonNotFound,
+			Message: err.Error(),
+		}
+	}
+
+	// Validate the secret .type field.
+	if secret.Type != webhookClientSecretType {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonWrongType,
+			Message: fmt.Sprintf("referenced Secret %q has wrong type %q (should be %q)", secretName, secret.Type, webhookClientSecretType),
+		}
+	}
+
+	// Validate the secret .data field.
+	token := secret.Data[tokenDataKey]
+	if len(token) == 0 {
+		return &v1alpha1.Condition{
+			Type:    typeClientCredentialsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonMissingKeys,
+			Message: fmt.Sprintf("referenced Secret %q is missing required keys %q", secretName, []string{tokenDataKey}),
+		}
+	}
+
+	// If everything is valid, update the result and set the condition to true.
+	result.BearerToken = string(token)
+	return &v1alpha1.Condition{
+		Type:    typeClientCredentialsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded client credentials",
+	}
+}
+
+// validateEndpoint validates the .spec.endpoint field and returns the appropriate EndpointValid condition.
+func validateEndpoint(upstream *v1alpha1.WebhookIdentityProvider, result *upstreamwebhook.ProviderConfig) *v1alpha1.Condition {
+	endpoint := upstream.Spec.Endpoint
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.Fragment != "" {
+		return &v1alpha1.Condition{
+			Type:    typeEndpointValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonInvalidEndpoint,
+			Message: fmt.Sprintf("spec.endpoint (%q) must be an https URL without a fragment", endpoint),
+		}
+	}
+
+	result.Endpoint = u
+	return &v1alpha1.Condition{
+		Type:    typeEndpointValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "spec.endpoint is valid",
+	}
+}
+
+// validateTLS validates the .spec.tls field, creates the HTTP client, and returns the appropriate
+// TLSConfigurationValid condition.
+func validateTLS(upstream *v1alpha1.WebhookIdentityProvider, result *upstreamwebhook.ProviderConfig) *v1alpha1.Condition {
+	tlsSpec := upstream.Spec.TLS
+	if tlsSpec == nil || tlsSpec.CertificateAuthorityData == "" {
+		result.HTTPClient = defaultClientShortTimeout(nil)
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionTrue,
+			Reason:  upstreamwatchers.ReasonSuccess,
+			Message: "no TLS configuration provided",
+		}
+	}
+
+	bundle, err := base64.StdEncoding.DecodeString(tlsSpec.CertificateAuthorityData)
+	if err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: fmt.Sprintf("spec.tls.certificateAuthorityData is invalid: %s", err.Error()),
+		}
+	}
+	rootCAs := x509.NewCertPool()
+	if !rootCAs.AppendCertsFromPEM(bundle) {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: fmt.Sprintf("spec.tls.certificateAuthorityData is invalid: %s", upstreamwatchers.ErrNoCertificates),
+		}
+	}
+
+	result.HTTPClient = defaultClientShortTimeout(rootCAs)
+	return &v1alpha1.Condition{
+		Type:    typeTLSConfigurationValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "loaded TLS configuration",
+	}
+}
+
+func (c *webhookWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.WebhookIdentityProvider, conditions []*v1alpha1.Condition) {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.Merge(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.WebhookPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.WebhookPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		WebhookIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "failed to update status")
+	}
+}
+
+func defaultClientShortTimeout(rootCAs *x509.CertPool) *http.Client {
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c
+}
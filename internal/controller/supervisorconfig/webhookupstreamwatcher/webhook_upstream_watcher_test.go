@@ -0,0 +1,362 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package webhookupstreamwatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/certauthority"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/testlogger"
+	"go.pinniped.dev/internal/upstreamwebhook"
+)
+
+func TestWebhookUpstreamWatcherControllerFilterSecret(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		secret     metav1.Object
+		wantAdd    bool
+		wantUpdate bool
+		wantDelete bool
+	}{
+		{
+			name: "a secret of the right type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/webhook-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+			wantAdd:    true,
+			wantUpdate: true,
+			wantDelete: true,
+		},
+		{
+			name: "a secret of the wrong type",
+			secret: &corev1.Secret{
+				Type:       "secrets.pinniped.dev/oauth2-client",
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+		{
+			name: "resource of wrong data type",
+			secret: &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: "some-name", Namespace: "some-namespace"},
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset()
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset()
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			secretInformer := kubeInformers.Core().V1().Secrets()
+			withInformer := testutil.NewObservableWithInformerOption()
+
+			New(
+				cache,
+				nil,
+				pinnipedInformers.IDP().V1alpha1().WebhookIdentityProviders(),
+				secretInformer,
+				testLog.Logger,
+				withInformer.WithInformer,
+			)
+
+			unrelated := corev1.Secret{}
+			filter := withInformer.GetFilterForInformer(secretInformer)
+			require.Equal(t, test.wantAdd, filter.Add(test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(&unrelated, test.secret))
+			require.Equal(t, test.wantUpdate, filter.Update(test.secret, &unrelated))
+			require.Equal(t, test.wantDelete, filter.Delete(test.secret))
+		})
+	}
+}
+
+func TestWebhookUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace  = "test-namespace"
+		testName       = "test-name"
+		testSecretName = "test-client-secret"
+		testToken      = "test-token"
+		testEndpoint   = "https://webhook.example.com/authenticate"
+	)
+
+	ca, err := certauthority.New("test-ca", time.Hour)
+	require.NoError(t, err)
+	testCABase64 := base64.StdEncoding.EncodeToString(ca.Bundle())
+
+	validUpstream := func(editSpec func(*v1alpha1.WebhookIdentityProviderSpec)) *v1alpha1.WebhookIdentityProvider {
+		spec := v1alpha1.WebhookIdentityProviderSpec{Endpoint: testEndpoint}
+		if editSpec != nil {
+			editSpec(&spec)
+		}
+		return &v1alpha1.WebhookIdentityProvider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: "test-uid", Generation: 1234},
+			Spec:       spec,
+		}
+	}
+	withClient := func(spec *v1alpha1.WebhookIdentityProviderSpec) {
+		spec.Client = &v1alpha1.WebhookClient{SecretName: testSecretName}
+	}
+	validSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+		Type:       "secrets.pinniped.dev/webhook-client",
+		Data:       map[string][]byte{"token": []byte(testToken)},
+	}
+
+	condition := func(typ string, status v1alpha1.ConditionStatus, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               typ,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+			LastTransitionTime: now,
+		}
+	}
+	noClientCredentials := condition("ClientCredentialsValid", "True", "Success", "no client credentials configured")
+	clientCredentialsValid := condition("ClientCredentialsValid", "True", "Success", "loaded client credentials")
+	endpointValid := condition("EndpointValid", "True", "Success", "spec.endpoint is valid")
+	tlsNotConfigured := condition("TLSConfigurationValid", "True", "Success", "no TLS configuration provided")
+
+	tests := []struct {
+		name                    string
+		inputUpstreams          []runtime.Object
+		inputSecrets            []runtime.Object
+		wantErr                 string
+		wantResultingCache      []*upstreamwebhook.ProviderConfig
+		wantResultingPhase      v1alpha1.WebhookIdentityProviderPhase
+		wantResultingConditions []v1alpha1.Condition
+	}{
+		{
+			name:           "valid upstream with minimal configuration",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			wantResultingCache: []*upstreamwebhook.ProviderConfig{{
+				Name:        testName,
+				ResourceUID: "test-uid",
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				noClientCredentials,
+				endpointValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "valid upstream with all settings",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WebhookIdentityProviderSpec) {
+				withClient(spec)
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64}
+			})},
+			inputSecrets: []runtime.Object{validSecret},
+			wantResultingCache: []*upstreamwebhook.ProviderConfig{{
+				Name:        testName,
+				ResourceUID: "test-uid",
+				BearerToken: testToken,
+			}},
+			wantResultingPhase: "Ready",
+			wantResultingConditions: []v1alpha1.Condition{
+				clientCredentialsValid,
+				endpointValid,
+				condition("TLSConfigurationValid", "True", "Success", "loaded TLS configuration"),
+			},
+		},
+		{
+			name:               "missing secret",
+			inputUpstreams:     []runtime.Object{validUpstream(withClient)},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClientCredentialsValid", "False", "SecretNotFound", `secret "test-client-secret" not found`),
+				endpointValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name:           "secret has wrong type",
+			inputUpstreams: []runtime.Object{validUpstream(withClient)},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+				Type:       "secrets.pinniped.dev/oauth2-client",
+				Data:       validSecret.Data,
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClientCredentialsValid", "False", "SecretWrongType",
+					`referenced Secret "test-client-secret" has wrong type "secrets.pinniped.dev/oauth2-client" (should be "secrets.pinniped.dev/webhook-client")`),
+				endpointValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name:           "secret is missing the token",
+			inputUpstreams: []runtime.Object{validUpstream(withClient)},
+			inputSecrets: []runtime.Object{&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecretName},
+				Type:       "secrets.pinniped.dev/webhook-client",
+				Data:       map[string][]byte{"other": []byte("value")},
+			}},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClientCredentialsValid", "False", "SecretMissingKeys",
+					`referenced Secret "test-client-secret" is missing required keys ["token"]`),
+				endpointValid,
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "endpoint is not https",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WebhookIdentityProviderSpec) {
+				spec.Endpoint = "http://webhook.example.com/authenticate"
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				noClientCredentials,
+				condition("EndpointValid", "False", "InvalidEndpoint",
+					`spec.endpoint ("http://webhook.example.com/authenticate") must be an https URL without a fragment`),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "endpoint has a fragment",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WebhookIdentityProviderSpec) {
+				spec.Endpoint = "https://webhook.example.com/authenticate#foo"
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				noClientCredentials,
+				condition("EndpointValid", "False", "InvalidEndpoint",
+					`spec.endpoint ("https://webhook.example.com/authenticate#foo") must be an https URL without a fragment`),
+				tlsNotConfigured,
+			},
+		},
+		{
+			name: "CA bundle is not base64",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WebhookIdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: "not-base64"}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				noClientCredentials,
+				endpointValid,
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.tls.certificateAuthorityData is invalid: illegal base64 data at input byte 3"),
+			},
+		},
+		{
+			name: "CA bundle has no certificates",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WebhookIdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not-a-cert"))}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				noClientCredentials,
+				endpointValid,
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.tls.certificateAuthorityData is invalid: no certificates found"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			fakeKubeClient := fake.NewSimpleClientset(tt.inputSecrets...)
+			kubeInformers := informers.NewSharedInformerFactory(fakeKubeClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetWebhookIdentityProviders([]provider.UpstreamLDAPIdentityProviderI{
+				&upstreamwebhook.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().WebhookIdentityProviders(),
+				kubeInformers.Core().V1().Secrets(),
+				testLog.Logger,
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			kubeInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetWebhookIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamwebhook.ProviderConfig)
+				require.NotNil(t, actualIDP.HTTPClient)
+				require.Equal(t, time.Minute, actualIDP.HTTPClient.Timeout)
+				require.NotNil(t, actualIDP.Endpoint)
+				require.Equal(t, testEndpoint, actualIDP.Endpoint.String())
+
+				// The HTTP client and endpoint URL are asserted separately.
+				actualIDP.HTTPClient = nil
+				actualIDP.Endpoint = nil
+				require.Equal(t, tt.wantResultingCache[i], actualIDP)
+			}
+
+			actualUpstream, err := fakePinnipedClient.IDPV1alpha1().WebhookIdentityProviders(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResultingPhase, actualUpstream.Status.Phase)
+			for i := range actualUpstream.Status.Conditions {
+				if time.Since(actualUpstream.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+					actualUpstream.Status.Conditions[i].LastTransitionTime = now
+				}
+			}
+			require.Equal(t, tt.wantResultingConditions, actualUpstream.Status.Conditions)
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
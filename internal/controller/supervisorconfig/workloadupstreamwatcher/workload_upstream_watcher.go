@@ -0,0 +1,392 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package workloadupstreamwatcher implements a controller which watches WorkloadIdentityProviders.
+package workloadupstreamwatcher
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedclientset "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned"
+	idpinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions/idp/v1alpha1"
+	"go.pinniped.dev/internal/claimexpression"
+	"go.pinniped.dev/internal/constable"
+	pinnipedcontroller "go.pinniped.dev/internal/controller"
+	"go.pinniped.dev/internal/controller/conditionsutil"
+	"go.pinniped.dev/internal/controller/supervisorconfig/upstreamwatchers"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/net/phttp"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/upstreamworkload"
+)
+
+const (
+	// Setup for the name of our controller in logs.
+	workloadControllerName = "workload-upstream-observer"
+
+	// Constants related to the OIDC provider discovery cache. These do not affect the cache of JWKS.
+	workloadValidatorCacheTTL = 15 * time.Minute
+
+	// Constants related to conditions.
+	typeTLSConfigurationValid  = "TLSConfigurationValid"
+	typeClaimsValid            = "ClaimsValid"
+	typeOIDCDiscoverySucceeded = "OIDCDiscoverySucceeded"
+
+	reasonUnreachable         = "Unreachable"
+	reasonInvalidExpression   = "InvalidExpression"
+	reasonConflictingSettings = "ConflictingSettings"
+
+	// Errors that are generated by our reconcile process.
+	errWorkloadFailureStatus = constable.Error("WorkloadIdentityProvider has a failing condition")
+)
+
+// WorkloadIdentityProviderICache is a thread safe cache that holds a list of validated workload IDP configurations.
+type WorkloadIdentityProviderICache interface {
+	SetWorkloadIdentityProviders([]provider.WorkloadIdentityProviderI)
+}
+
+// lruValidatorCache caches the *oidc.Provider associated with a particular issuer/TLS configuration.
+type lruValidatorCache struct{ cache *cache.Expiring }
+
+type lruValidatorCacheEntry struct {
+	provider *oidc.Provider
+	client   *http.Client
+}
+
+func (c *lruValidatorCache) getProvider(spec *v1alpha1.WorkloadIdentityProviderSpec) (*oidc.Provider, *http.Client) {
+	if result, ok := c.cache.Get(c.cacheKey(spec)); ok {
+		entry := result.(*lruValidatorCacheEntry)
+		return entry.provider, entry.client
+	}
+	return nil, nil
+}
+
+func (c *lruValidatorCache) putProvider(spec *v1alpha1.WorkloadIdentityProviderSpec, provider *oidc.Provider, client *http.Client) {
+	c.cache.Set(c.cacheKey(spec), &lruValidatorCacheEntry{provider: provider, client: client}, workloadValidatorCacheTTL)
+}
+
+func (c *lruValidatorCache) cacheKey(spec *v1alpha1.WorkloadIdentityProviderSpec) interface{} {
+	var key struct{ issuer, caBundle string }
+	key.issuer = spec.Issuer
+	if spec.TLS != nil {
+		key.caBundle = spec.TLS.CertificateAuthorityData
+	}
+	return key
+}
+
+type workloadWatcherController struct {
+	cache                            WorkloadIdentityProviderICache
+	log                              logr.Logger
+	client                           pinnipedclientset.Interface
+	workloadIdentityProviderInformer idpinformers.WorkloadIdentityProviderInformer
+	validatorCache                   interface {
+		getProvider(*v1alpha1.WorkloadIdentityProviderSpec) (*oidc.Provider, *http.Client)
+		putProvider(*v1alpha1.WorkloadIdentityProviderSpec, *oidc.Provider, *http.Client)
+	}
+}
+
+// New instantiates a new controllerlib.Controller which will populate the provided WorkloadIdentityProviderICache.
+func New(
+	idpCache WorkloadIdentityProviderICache,
+	client pinnipedclientset.Interface,
+	workloadIdentityProviderInformer idpinformers.WorkloadIdentityProviderInformer,
+	log logr.Logger,
+	withInformer pinnipedcontroller.WithInformerOptionFunc,
+) controllerlib.Controller {
+	c := workloadWatcherController{
+		cache:                            idpCache,
+		log:                              log.WithName(workloadControllerName),
+		client:                           client,
+		workloadIdentityProviderInformer: workloadIdentityProviderInformer,
+		validatorCache:                   &lruValidatorCache{cache: cache.NewExpiring()},
+	}
+	return controllerlib.New(
+		controllerlib.Config{Name: workloadControllerName, Syncer: &c},
+		withInformer(
+			workloadIdentityProviderInformer,
+			pinnipedcontroller.MatchAnythingFilter(pinnipedcontroller.SingletonQueue()),
+			controllerlib.InformerOption{},
+		),
+	)
+}
+
+// Sync implements controllerlib.Syncer.
+func (c *workloadWatcherController) Sync(ctx controllerlib.Context) error {
+	actualUpstreams, err := c.workloadIdentityProviderInformer.Lister().List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list WorkloadIdentityProviders: %w", err)
+	}
+
+	requeue := false
+	validatedUpstreams := make([]provider.WorkloadIdentityProviderI, 0, len(actualUpstreams))
+	for _, upstream := range actualUpstreams {
+		valid := c.validateUpstream(ctx.Context, upstream)
+		if valid == nil {
+			requeue = true
+		} else {
+			validatedUpstreams = append(validatedUpstreams, provider.WorkloadIdentityProviderI(valid))
+		}
+	}
+	c.cache.SetWorkloadIdentityProviders(validatedUpstreams)
+	if requeue {
+		return controllerlib.ErrSyntheticRequeue
+	}
+	return nil
+}
+
+// validateUpstream validates the provided v1alpha1.WorkloadIdentityProvider and returns the validated configuration as an
+// upstreamworkload.ProviderConfig. As a side effect, it also updates the status of the v1alpha1.WorkloadIdentityProvider.
+func (c *workloadWatcherController) validateUpstream(ctx context.Context, upstream *v1alpha1.WorkloadIdentityProvider) *upstreamworkload.ProviderConfig {
+	result := upstreamworkload.ProviderConfig{
+		Name:          upstream.Name,
+		ResourceUID:   upstream.UID,
+		Issuer:        upstream.Spec.Issuer,
+		Audience:      upstream.Spec.Audience,
+		UsernameClaim: upstream.Spec.Claims.Username,
+		GroupsClaim:   upstream.Spec.Claims.Groups,
+	}
+
+	conditions := []*v1alpha1.Condition{
+		validateClaims(upstream, &result),
+	}
+	tlsCondition := validateTLS(upstream)
+	conditions = append(conditions, tlsCondition)
+	if tlsCondition.Status == v1alpha1.ConditionTrue {
+		// Discovery would fail without a valid CA bundle, so only report its condition when it could succeed.
+		conditions = append(conditions, c.validateIssuer(ctx, upstream, &result))
+	}
+
+	c.updateStatus(ctx, upstream, conditions)
+
+	valid := true
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	for _, condition := range conditions {
+		if condition.Status == v1alpha1.ConditionFalse {
+			valid = false
+			log.WithValues(
+				"type", condition.Type,
+				"reason", condition.Reason,
+				"message", condition.Message,
+			).Error(errWorkloadFailureStatus, "found failing condition")
+		}
+	}
+	if valid {
+		return &result
+	}
+	return nil
+}
+
+// validateClaims validates the .spec.claims field, compiles any expressions, and returns the appropriate ClaimsValid
+// condition.
+func validateClaims(upstream *v1alpha1.WorkloadIdentityProvider, result *upstreamworkload.ProviderConfig) *v1alpha1.Condition {
+	claims := upstream.Spec.Claims
+
+	if claims.Username != "" && claims.UsernameExpression != "" {
+		return &v1alpha1.Condition{
+			Type:    typeClaimsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonConflictingSettings,
+			Message: "claims.username and claims.usernameExpression cannot both be set",
+		}
+	}
+	if claims.Groups != "" && claims.GroupsExpression != "" {
+		return &v1alpha1.Condition{
+			Type:    typeClaimsValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  reasonConflictingSettings,
+			Message: "claims.groups and claims.groupsExpression cannot both be set",
+		}
+	}
+
+	if claims.UsernameExpression != "" {
+		usernameExpression, err := claimexpression.NewUsernameExpression(claims.UsernameExpression)
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClaimsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidExpression,
+				Message: fmt.Sprintf("claims.usernameExpression is invalid: %s", err.Error()),
+			}
+		}
+		result.UsernameExpression = usernameExpression
+	}
+	if claims.GroupsExpression != "" {
+		groupsExpression, err := claimexpression.NewGroupsExpression(claims.GroupsExpression)
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClaimsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidExpression,
+				Message: fmt.Sprintf("claims.groupsExpression is invalid: %s", err.Error()),
+			}
+		}
+		result.GroupsExpression = groupsExpression
+	}
+	for i, expression := range claims.Conditions {
+		condition, err := claimexpression.NewConditionExpression(expression)
+		if err != nil {
+			return &v1alpha1.Condition{
+				Type:    typeClaimsValid,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonInvalidExpression,
+				Message: fmt.Sprintf("claims.conditions[%d] is invalid: %s", i, err.Error()),
+			}
+		}
+		result.Conditions = append(result.Conditions, condition)
+	}
+
+	return &v1alpha1.Condition{
+		Type:    typeClaimsValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "claims configuration is valid",
+	}
+}
+
+// validateTLS validates the .spec.tls field and returns the appropriate TLSConfigurationValid condition.
+func validateTLS(upstream *v1alpha1.WorkloadIdentityProvider) *v1alpha1.Condition {
+	if _, err := rootCAs(upstream); err != nil {
+		return &v1alpha1.Condition{
+			Type:    typeTLSConfigurationValid,
+			Status:  v1alpha1.ConditionFalse,
+			Reason:  upstreamwatchers.ReasonInvalidTLSConfig,
+			Message: err.Error(),
+		}
+	}
+	message := "loaded TLS configuration"
+	if upstream.Spec.TLS == nil || upstream.Spec.TLS.CertificateAuthorityData == "" {
+		message = "no TLS configuration provided"
+	}
+	return &v1alpha1.Condition{
+		Type:    typeTLSConfigurationValid,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: message,
+	}
+}
+
+// validateIssuer validates the .spec.issuer field, performs OIDC discovery, and returns the appropriate
+// OIDCDiscoverySucceeded condition.
+func (c *workloadWatcherController) validateIssuer(ctx context.Context, upstream *v1alpha1.WorkloadIdentityProvider, result *upstreamworkload.ProviderConfig) *v1alpha1.Condition {
+	// Get the provider and HTTP Client from cache if possible.
+	discoveredProvider, httpClient := c.validatorCache.getProvider(&upstream.Spec)
+
+	// If the provider does not exist in the cache, do a fresh discovery lookup and save to the cache.
+	if discoveredProvider == nil {
+		issuerURL, err := url.Parse(upstream.Spec.Issuer)
+		if err != nil || issuerURL.Scheme != "https" || issuerURL.Host == "" || len(issuerURL.Query()) != 0 || issuerURL.Fragment != "" {
+			return &v1alpha1.Condition{
+				Type:    typeOIDCDiscoverySucceeded,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonUnreachable,
+				Message: fmt.Sprintf("spec.issuer (%q) must be an https URL without a query or fragment", upstream.Spec.Issuer),
+			}
+		}
+
+		roots, _ := rootCAs(upstream) // already validated by validateTLS
+		httpClient = defaultClientShortTimeout(roots)
+
+		discoveredProvider, err = oidc.NewProvider(oidc.ClientContext(ctx, httpClient), upstream.Spec.Issuer)
+		if err != nil {
+			const klogLevelTrace = 6
+			c.log.V(klogLevelTrace).WithValues(
+				"namespace", upstream.Namespace,
+				"name", upstream.Name,
+				"issuer", upstream.Spec.Issuer,
+			).Error(err, "failed to perform OIDC discovery")
+			return &v1alpha1.Condition{
+				Type:    typeOIDCDiscoverySucceeded,
+				Status:  v1alpha1.ConditionFalse,
+				Reason:  reasonUnreachable,
+				Message: fmt.Sprintf("failed to perform OIDC discovery against %q:\n%s", upstream.Spec.Issuer, truncateMostLongErr(err)),
+			}
+		}
+
+		// Update the cache with the newly discovered value.
+		c.validatorCache.putProvider(&upstream.Spec, discoveredProvider, httpClient)
+	}
+
+	result.Provider = discoveredProvider
+	result.Client = httpClient
+	return &v1alpha1.Condition{
+		Type:    typeOIDCDiscoverySucceeded,
+		Status:  v1alpha1.ConditionTrue,
+		Reason:  upstreamwatchers.ReasonSuccess,
+		Message: "discovered issuer configuration",
+	}
+}
+
+func (c *workloadWatcherController) updateStatus(ctx context.Context, upstream *v1alpha1.WorkloadIdentityProvider, conditions []*v1alpha1.Condition) {
+	log := c.log.WithValues("namespace", upstream.Namespace, "name", upstream.Name)
+	updated := upstream.DeepCopy()
+
+	hadErrorCondition := conditionsutil.Merge(conditions, upstream.Generation, &updated.Status.Conditions, log)
+
+	updated.Status.Phase = v1alpha1.WorkloadPhaseReady
+	if hadErrorCondition {
+		updated.Status.Phase = v1alpha1.WorkloadPhaseError
+	}
+
+	if equality.Semantic.DeepEqual(upstream, updated) {
+		return
+	}
+
+	_, err := c.client.
+		IDPV1alpha1().
+		WorkloadIdentityProviders(upstream.Namespace).
+		UpdateStatus(ctx, updated, metav1.UpdateOptions{})
+	if err != nil {
+		log.Error(err, "failed to update status")
+	}
+}
+
+// rootCAs returns the CA bundle of the .spec.tls field, or nil to trust the system roots.
+func rootCAs(upstream *v1alpha1.WorkloadIdentityProvider) (*x509.CertPool, error) {
+	if upstream.Spec.TLS == nil || upstream.Spec.TLS.CertificateAuthorityData == "" {
+		return nil, nil
+	}
+
+	bundle, err := base64.StdEncoding.DecodeString(upstream.Spec.TLS.CertificateAuthorityData)
+	if err != nil {
+		return nil, fmt.Errorf("spec.tls.certificateAuthorityData is invalid: %w", err)
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("spec.tls.certificateAuthorityData is invalid: %w", upstreamwatchers.ErrNoCertificates)
+	}
+	return roots, nil
+}
+
+func defaultClientShortTimeout(rootCAs *x509.CertPool) *http.Client {
+	c := phttp.Default(rootCAs)
+	c.Timeout = time.Minute
+	return c
+}
+
+func truncateMostLongErr(err error) string {
+	const max = 300
+	msg := err.Error()
+
+	// always log oidc and x509 errors completely
+	if len(msg) <= max || strings.Contains(msg, "oidc:") || strings.Contains(msg, "x509:") {
+		return msg
+	}
+
+	return msg[:max] + fmt.Sprintf(" [truncated %d chars]", len(msg)-max)
+}
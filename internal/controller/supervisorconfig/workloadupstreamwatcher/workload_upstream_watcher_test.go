@@ -0,0 +1,344 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package workloadupstreamwatcher
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	pinnipedfake "go.pinniped.dev/generated/latest/client/supervisor/clientset/versioned/fake"
+	pinnipedinformers "go.pinniped.dev/generated/latest/client/supervisor/informers/externalversions"
+	"go.pinniped.dev/internal/claimexpression"
+	"go.pinniped.dev/internal/controllerlib"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/testlogger"
+	"go.pinniped.dev/internal/upstreamworkload"
+)
+
+func TestWorkloadUpstreamWatcherControllerSync(t *testing.T) {
+	t.Parallel()
+	now := metav1.NewTime(time.Now().UTC())
+
+	const (
+		testNamespace = "test-namespace"
+		testName      = "test-name"
+		testAudience  = "test-audience"
+	)
+
+	var testIssuer string
+	testCA, testIssuer := testutil.TLSTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   testIssuer,
+			"jwks_uri": testIssuer + "/jwks.json",
+		})
+	})
+	testCABase64 := base64.StdEncoding.EncodeToString([]byte(testCA))
+
+	validUpstream := func(editSpec func(*v1alpha1.WorkloadIdentityProviderSpec)) *v1alpha1.WorkloadIdentityProvider {
+		spec := v1alpha1.WorkloadIdentityProviderSpec{
+			Issuer:   testIssuer,
+			Audience: testAudience,
+			TLS:      &v1alpha1.TLSSpec{CertificateAuthorityData: testCABase64},
+		}
+		if editSpec != nil {
+			editSpec(&spec)
+		}
+		return &v1alpha1.WorkloadIdentityProvider{
+			ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testName, UID: "test-uid", Generation: 1234},
+			Spec:       spec,
+		}
+	}
+
+	condition := func(typ string, status v1alpha1.ConditionStatus, reason, message string) v1alpha1.Condition {
+		return v1alpha1.Condition{
+			Type:               typ,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			ObservedGeneration: 1234,
+			LastTransitionTime: now,
+		}
+	}
+	claimsValid := condition("ClaimsValid", "True", "Success", "claims configuration is valid")
+	discoverySucceeded := condition("OIDCDiscoverySucceeded", "True", "Success", "discovered issuer configuration")
+	tlsValid := condition("TLSConfigurationValid", "True", "Success", "loaded TLS configuration")
+
+	usernameExpression, err := claimexpression.NewUsernameExpression(`"repo:" + claims.repository`)
+	require.NoError(t, err)
+	groupsExpression, err := claimexpression.NewGroupsExpression(`["workloads"]`)
+	require.NoError(t, err)
+	conditionExpression, err := claimexpression.NewConditionExpression(`claims.ref == "refs/heads/main"`)
+	require.NoError(t, err)
+	_, invalidExpressionErr := claimexpression.NewUsernameExpression(`claims.sub +`)
+	require.Error(t, invalidExpressionErr)
+	_, invalidConditionErr := claimexpression.NewConditionExpression(`"not-a-bool"`)
+	require.Error(t, invalidConditionErr)
+
+	tests := []struct {
+		name                    string
+		inputUpstreams          []runtime.Object
+		wantErr                 string
+		wantResultingCache      []*upstreamworkload.ProviderConfig
+		wantResultingPhase      v1alpha1.WorkloadIdentityProviderPhase
+		wantResultingConditions []v1alpha1.Condition
+	}{
+		{
+			name:           "valid upstream with minimal configuration",
+			inputUpstreams: []runtime.Object{validUpstream(nil)},
+			wantResultingCache: []*upstreamworkload.ProviderConfig{{
+				Name:        testName,
+				ResourceUID: "test-uid",
+				Issuer:      testIssuer,
+				Audience:    testAudience,
+			}},
+			wantResultingPhase:      "Ready",
+			wantResultingConditions: []v1alpha1.Condition{claimsValid, discoverySucceeded, tlsValid},
+		},
+		{
+			name: "valid upstream with claim names",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Claims = v1alpha1.WorkloadClaims{Username: "email", Groups: "groups"}
+			})},
+			wantResultingCache: []*upstreamworkload.ProviderConfig{{
+				Name:          testName,
+				ResourceUID:   "test-uid",
+				Issuer:        testIssuer,
+				Audience:      testAudience,
+				UsernameClaim: "email",
+				GroupsClaim:   "groups",
+			}},
+			wantResultingPhase:      "Ready",
+			wantResultingConditions: []v1alpha1.Condition{claimsValid, discoverySucceeded, tlsValid},
+		},
+		{
+			name: "valid upstream with expressions and conditions",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Claims = v1alpha1.WorkloadClaims{
+					UsernameExpression: `"repo:" + claims.repository`,
+					GroupsExpression:   `["workloads"]`,
+					Conditions:         []string{`claims.ref == "refs/heads/main"`},
+				}
+			})},
+			wantResultingCache: []*upstreamworkload.ProviderConfig{{
+				Name:               testName,
+				ResourceUID:        "test-uid",
+				Issuer:             testIssuer,
+				Audience:           testAudience,
+				UsernameExpression: usernameExpression,
+				GroupsExpression:   groupsExpression,
+				Conditions:         []*claimexpression.ConditionExpression{conditionExpression},
+			}},
+			wantResultingPhase:      "Ready",
+			wantResultingConditions: []v1alpha1.Condition{claimsValid, discoverySucceeded, tlsValid},
+		},
+		{
+			name: "username claim and expression are both set",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Claims = v1alpha1.WorkloadClaims{Username: "sub", UsernameExpression: "claims.sub"}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClaimsValid", "False", "ConflictingSettings", "claims.username and claims.usernameExpression cannot both be set"),
+				discoverySucceeded,
+				tlsValid,
+			},
+		},
+		{
+			name: "groups claim and expression are both set",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Claims = v1alpha1.WorkloadClaims{Groups: "groups", GroupsExpression: "claims.groups"}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClaimsValid", "False", "ConflictingSettings", "claims.groups and claims.groupsExpression cannot both be set"),
+				discoverySucceeded,
+				tlsValid,
+			},
+		},
+		{
+			name: "invalid username expression",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Claims = v1alpha1.WorkloadClaims{UsernameExpression: `claims.sub +`}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClaimsValid", "False", "InvalidExpression", "claims.usernameExpression is invalid: "+invalidExpressionErr.Error()),
+				discoverySucceeded,
+				tlsValid,
+			},
+		},
+		{
+			name: "condition which is not a bool",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Claims = v1alpha1.WorkloadClaims{Conditions: []string{`claims.ref == "refs/heads/main"`, `"not-a-bool"`}}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				condition("ClaimsValid", "False", "InvalidExpression", "claims.conditions[1] is invalid: "+invalidConditionErr.Error()),
+				discoverySucceeded,
+				tlsValid,
+			},
+		},
+		{
+			name: "issuer is not https",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Issuer = "http://issuer.example.com"
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				claimsValid,
+				condition("OIDCDiscoverySucceeded", "False", "Unreachable", `spec.issuer ("http://issuer.example.com") must be an https URL without a query or fragment`),
+				tlsValid,
+			},
+		},
+		{
+			name: "issuer does not serve discovery",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.Issuer = testIssuer + "/not-found"
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				claimsValid,
+				condition("OIDCDiscoverySucceeded", "False", "Unreachable",
+					`failed to perform OIDC discovery against "`+testIssuer+`/not-found":`+"\n"+`404 Not Found: 404 page not found`+"\n"),
+				tlsValid,
+			},
+		},
+		{
+			name: "CA bundle is not base64",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: "not-base64"}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				claimsValid,
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.tls.certificateAuthorityData is invalid: illegal base64 data at input byte 3"),
+			},
+		},
+		{
+			name: "CA bundle has no certificates",
+			inputUpstreams: []runtime.Object{validUpstream(func(spec *v1alpha1.WorkloadIdentityProviderSpec) {
+				spec.TLS = &v1alpha1.TLSSpec{CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte("not-a-cert"))}
+			})},
+			wantErr:            controllerlib.ErrSyntheticRequeue.Error(),
+			wantResultingPhase: "Error",
+			wantResultingConditions: []v1alpha1.Condition{
+				claimsValid,
+				condition("TLSConfigurationValid", "False", "InvalidTLSConfig",
+					"spec.tls.certificateAuthorityData is invalid: no certificates found"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			fakePinnipedClient := pinnipedfake.NewSimpleClientset(tt.inputUpstreams...)
+			pinnipedInformers := pinnipedinformers.NewSharedInformerFactory(fakePinnipedClient, 0)
+			testLog := testlogger.New(t)
+			cache := provider.NewDynamicUpstreamIDPProvider()
+			cache.SetWorkloadIdentityProviders([]provider.WorkloadIdentityProviderI{
+				&upstreamworkload.ProviderConfig{Name: "initial-entry"},
+			})
+
+			controller := New(
+				cache,
+				fakePinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().WorkloadIdentityProviders(),
+				testLog.Logger,
+				controllerlib.WithInformer,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pinnipedInformers.Start(ctx.Done())
+			controllerlib.TestRunSynchronously(t, controller)
+
+			syncCtx := controllerlib.Context{Context: ctx, Key: controllerlib.Key{}}
+
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			actualIDPList := cache.GetWorkloadIdentityProviders()
+			require.Len(t, actualIDPList, len(tt.wantResultingCache))
+			for i := range actualIDPList {
+				actualIDP := actualIDPList[i].(*upstreamworkload.ProviderConfig)
+				require.NotNil(t, actualIDP.Client)
+				require.Equal(t, time.Minute, actualIDP.Client.Timeout)
+				require.NotNil(t, actualIDP.Provider)
+
+				// The compiled expressions are compared by their sources.
+				wantIDP := *tt.wantResultingCache[i]
+				require.Equal(t, expressionSources(&wantIDP), expressionSources(actualIDP))
+
+				// The HTTP client and discovered provider are asserted separately.
+				actualIDP.Client = nil
+				actualIDP.Provider = nil
+				require.Equal(t, &wantIDP, actualIDP)
+			}
+
+			actualUpstream, err := fakePinnipedClient.IDPV1alpha1().WorkloadIdentityProviders(testNamespace).Get(ctx, testName, metav1.GetOptions{})
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResultingPhase, actualUpstream.Status.Phase)
+			for i := range actualUpstream.Status.Conditions {
+				if time.Since(actualUpstream.Status.Conditions[i].LastTransitionTime.Time) < 5*time.Second {
+					actualUpstream.Status.Conditions[i].LastTransitionTime = now
+				}
+			}
+			require.Equal(t, tt.wantResultingConditions, actualUpstream.Status.Conditions)
+
+			// Running the sync() a second time should be idempotent, and should return the same error.
+			if err := controllerlib.TestSync(t, controller, syncCtx); tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+// expressionSources returns the sources of the compiled expressions of the config and removes the expressions.
+func expressionSources(config *upstreamworkload.ProviderConfig) []string {
+	var sources []string
+	if config.UsernameExpression != nil {
+		sources = append(sources, "username: "+config.UsernameExpression.Source())
+	}
+	if config.GroupsExpression != nil {
+		sources = append(sources, "groups: "+config.GroupsExpression.Source())
+	}
+	for _, condition := range config.Conditions {
+		sources = append(sources, "condition: "+condition.Source())
+	}
+	config.UsernameExpression = nil
+	config.GroupsExpression = nil
+	config.Conditions = nil
+	return sources
+}
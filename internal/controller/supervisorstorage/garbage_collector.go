@@ -27,6 +27,7 @@ import (
 	"go.pinniped.dev/internal/fositestorage/openidconnect"
 	"go.pinniped.dev/internal/fositestorage/pkce"
 	"go.pinniped.dev/internal/fositestorage/refreshtoken"
+	"go.pinniped.dev/internal/oidc/loginattempts"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/psession"
@@ -232,6 +233,10 @@ func (c *garbageCollectorController) maybeRevokeUpstreamOIDCToken(ctx context.Co
 		// be revoked by one of the other cases above.
 		return nil
 
+	case loginattempts.TypeLabelValue:
+		// Failed login attempt counters are not downstream sessions, so they do not hold any upstream tokens.
+		return nil
+
 	default:
 		// There are no other storage types, so this should never happen in practice.
 		return errors.New("garbage collector saw invalid label on Secret when trying to determine if upstream revocation was needed")
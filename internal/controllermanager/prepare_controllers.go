@@ -240,6 +240,8 @@ func PrepareControllers(c *Config) (controllerinit.RunnerBuilder, error) {
 			jwtcachefiller.New(
 				c.AuthenticatorCache,
 				informers.pinniped.Authentication().V1alpha1().JWTAuthenticators(),
+				informers.installationNamespaceK8s.Core().V1().Secrets(),
+				c.ServerInstallationInfo.Namespace,
 				klogr.New(),
 			),
 			singletonWorker,
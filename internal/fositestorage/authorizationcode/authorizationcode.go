@@ -30,7 +30,14 @@ const (
 
 	// Version 1 was the initial release of storage.
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
-	authorizeCodeStorageVersion = "2"
+	// Version 3 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 4 is when we added the SAML field to psession.CustomSessionData.
+	// Version 5 is when we added the OAuth2 field to psession.CustomSessionData.
+	// Version 6 is when we added the Webhook field to psession.CustomSessionData.
+	// Version 7 is when we added the Local field to psession.CustomSessionData.
+	// Version 8 is when we added the CertificateThumbprint field to psession.CustomSessionData.
+	// Version 9 is when we added the DPoPKeyThumbprint field to psession.CustomSessionData.
+	authorizeCodeStorageVersion = "9"
 )
 
 var _ oauth2.AuthorizeCodeStorage = &authorizeCodeStorage{}
@@ -373,38 +380,51 @@ const ExpectedAuthorizeCodeSessionJSONFromFuzzing = `{
 					"掘ʃƸ澺淗a紽ǒ|鰽ŋ猊",
 					"毇妬\u003e6鉢緋uƴŤȱʀļÂ?"
 				],
+				"certificateThumbprint": "27就伒犘c钡ɏȫ",
+				"dpopKeyThumbprint": "鬌",
 				"oidc": {
-					"upstreamRefreshToken": "\u003cƬb",
-					"upstreamAccessToken": "犘c钡ɏȫ",
-					"upstreamSubject": "鬌",
-					"upstreamIssuer": "%OpKȱ藚ɏ¬Ê蒭堜"
+					"upstreamRefreshToken": "蜚蠣麹概÷驣7Ʀ澉1æɽ誮rʨ鷞aŚB",
+					"upstreamAccessToken": "k9帴",
+					"upstreamSubject": "磊ůď逳鞪?3)藵睋邔\u0026Ű惫蜀Ģ",
+					"upstreamIssuer": "4İ"
 				},
 				"ldap": {
-					"userDN": "ȗ韚ʫ繕ȫ碰+",
+					"userDN": "×",
 					"extraRefreshAttributes": {
-						"+î艔垎0": "ĝ",
-						"4İ": "墀jMʥ",
-						"k9帴": "磊ůď逳鞪?3)藵睋邔\u0026Ű惫蜀Ģ"
+						"ʥ笿0D": "s"
 					}
 				},
 				"activedirectory": {
-					"userDN": "%Ä摱ìÓȐĨf跞@)¿,ɭS隑i",
+					"userDN": "ĝ",
 					"extraRefreshAttributes": {
-						" 皦pSǬŝ社Vƅȭǝ*擦28ǅ": "vư",
-						"艱iYn面@yȝƋ鬯犦獢9c5¤.岵": "浛a齙\\蹼偦歛"
+						"IȽ齤士bEǎ": "跞@)¿,ɭS隑ip偶宾儮猷V麹",
+						"ȝƋ鬯犦獢9c5¤.岵": "浛a齙\\蹼偦歛"
 					}
+				},
+				"github": {
+					"upstreamAccessToken": " 皦pSǬŝ社Vƅȭǝ*擦28ǅ"
+				},
+				"saml": {
+					"sessionNotOnOrAfter": "2052-08-25T07:47:15.829273251Z"
+				},
+				"oauth2": {
+					"upstreamRefreshToken": "ã置bņ抰蛖",
+					"upstreamAccessToken": "\u0026錝D肁Ŷɽ蔒PR}Ųʓ"
+				},
+				"webhook": {
+					"userUID": "{鼐"
+				},
+				"local": {
+					"userUID": "Ã轘屔挝ʌ鼂"
 				}
 			}
 		},
 		"requestedAudience": [
-			"置b",
-			"筫MN\u0026錝D肁Ŷɽ蔒PR}Ųʓl{"
+			"诼消P姧骦"
 		],
 		"grantedAudience": [
-			"jÃ轘屔挝",
-			"Œų崓ļ憽-蹐È_¸]fś",
-			"ɵʮGɃɫ囤1+,Ȳ"
+			"駝重EȫʆɵʮGɃɫ囤"
 		]
 	},
-	"version": "2"
+	"version": "9"
 }`
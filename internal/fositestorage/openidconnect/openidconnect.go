@@ -30,7 +30,14 @@ const (
 
 	// Version 1 was the initial release of storage.
 	// Version 2 is when we switched to storing psession.PinnipedSession inside the fosite request.
-	oidcStorageVersion = "2"
+	// Version 3 is when we added the GitHub field to psession.CustomSessionData.
+	// Version 4 is when we added the SAML field to psession.CustomSessionData.
+	// Version 5 is when we added the OAuth2 field to psession.CustomSessionData.
+	// Version 6 is when we added the Webhook field to psession.CustomSessionData.
+	// Version 7 is when we added the Local field to psession.CustomSessionData.
+	// Version 8 is when we added the CertificateThumbprint field to psession.CustomSessionData.
+	// Version 9 is when we added the DPoPKeyThumbprint field to psession.CustomSessionData.
+	oidcStorageVersion = "9"
 )
 
 var _ openid.OpenIDConnectRequestStorage = &openIDConnectRequestStorage{}
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package httperr contains some helpers for nicer error handling in http.Handler implementations.
@@ -7,6 +7,7 @@ package httperr
 import (
 	"fmt"
 	"net/http"
+	"strings"
 )
 
 // Responder represents an error that can emit a useful HTTP error response to an http.ResponseWriter.
@@ -65,3 +66,27 @@ func (f HandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 	}
 }
+
+// PageWriter writes an error response which is meant to be shown to a human, e.g. as an HTML page.
+type PageWriter func(w http.ResponseWriter, code int, msg string)
+
+// WithErrorPage returns an http.Handler which is like f, except that errors are written using writePage when the
+// client accepts HTML responses, e.g. when the request was made by a web browser. Otherwise, errors are written
+// as plain text, the same as f.
+func (f HandlerFunc) WithErrorPage(writePage PageWriter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err := f(w, r)
+		if err == nil {
+			return
+		}
+		if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+			HandlerFunc(func(http.ResponseWriter, *http.Request) error { return err }).ServeHTTP(w, r)
+			return
+		}
+		if e, ok := err.(httpErr); ok {
+			writePage(w, e.code, http.StatusText(e.code)+": "+e.msg)
+			return
+		}
+		writePage(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	})
+}
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package httperr
@@ -50,3 +50,74 @@ func TestHandlerFunc(t *testing.T) {
 
 	})
 }
+
+func TestWithErrorPage(t *testing.T) {
+	writePage := func(w http.ResponseWriter, code int, msg string) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte("<p>" + msg + "</p>"))
+	}
+
+	tests := []struct {
+		name            string
+		err             error
+		accept          string
+		wantCode        int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:     "no error",
+			accept:   "text/html",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:            "error for a client which accepts HTML",
+			err:             Wrap(http.StatusForbidden, "boring public bits", fmt.Errorf("some secret internal bits")),
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			wantCode:        http.StatusForbidden,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>Forbidden: boring public bits</p>",
+		},
+		{
+			name:            "unexpected error for a client which accepts HTML",
+			err:             fmt.Errorf("some secret internal bits"),
+			accept:          "text/html",
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<p>Internal Server Error</p>",
+		},
+		{
+			name:            "error for a client which does not accept HTML",
+			err:             New(http.StatusBadRequest, "bad request error"),
+			wantCode:        http.StatusBadRequest,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Bad Request: bad request error\n",
+		},
+		{
+			name:            "unexpected error for a client which does not accept HTML",
+			err:             fmt.Errorf("some secret internal bits"),
+			accept:          "application/json",
+			wantCode:        http.StatusInternalServerError,
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "Internal Server Error\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			handler := HandlerFunc(func(http.ResponseWriter, *http.Request) error { return tt.err }).WithErrorPage(writePage)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			require.Equal(t, tt.wantCode, rec.Code)
+			require.Equal(t, tt.wantContentType, rec.Header().Get("Content-Type"))
+			require.Equal(t, tt.wantBody, rec.Body.String())
+		})
+	}
+}
@@ -1,11 +1,18 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package securityheader implements an HTTP middleware for setting security-related response headers.
 package securityheader
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/http/httpguts"
+
+	"go.pinniped.dev/internal/constable"
 )
 
 // Wrap the provided http.Handler so it sets appropriate security-related response headers.
@@ -28,3 +35,161 @@ func WrapWithCustomCSP(wrapped http.Handler, cspHeader string) http.Handler {
 		wrapped.ServeHTTP(w, r)
 	})
 }
+
+// minHSTSPreloadMaxAgeSeconds is the smallest max-age which is accepted by browser HSTS preload lists.
+const minHSTSPreloadMaxAgeSeconds = 31536000
+
+// Policy configures additional security-related response headers, on top of the headers which are always set
+// by Wrap and WrapWithCustomCSP. The zero value does not set any additional headers.
+type Policy struct {
+	// StrictTransportSecurity enables the Strict-Transport-Security header when it is not nil.
+	StrictTransportSecurity *StrictTransportSecurity `json:"strictTransportSecurity,omitempty"`
+
+	// ContentSecurityPolicy is sent as an additional Content-Security-Policy header. Browsers enforce every
+	// Content-Security-Policy header of a response, so this can only make the built-in policy of each endpoint
+	// stricter, e.g. by adding "upgrade-insecure-requests" or a "report-uri" directive.
+	ContentSecurityPolicy string `json:"contentSecurityPolicy,omitempty"`
+
+	// PermissionsPolicy is the value of the Permissions-Policy header, e.g. "camera=(), microphone=()".
+	PermissionsPolicy string `json:"permissionsPolicy,omitempty"`
+
+	// CrossOriginOpenerPolicy is the value of the Cross-Origin-Opener-Policy header.
+	CrossOriginOpenerPolicy string `json:"crossOriginOpenerPolicy,omitempty"`
+
+	// CrossOriginEmbedderPolicy is the value of the Cross-Origin-Embedder-Policy header.
+	CrossOriginEmbedderPolicy string `json:"crossOriginEmbedderPolicy,omitempty"`
+}
+
+// StrictTransportSecurity configures the Strict-Transport-Security header.
+type StrictTransportSecurity struct {
+	// MaxAgeSeconds is how long browsers should only use HTTPS to connect. Zero tells browsers to forget
+	// a previous Strict-Transport-Security header.
+	MaxAgeSeconds int64 `json:"maxAgeSeconds"`
+
+	// IncludeSubDomains applies the header to all subdomains of the host too.
+	IncludeSubDomains bool `json:"includeSubDomains,omitempty"`
+
+	// Preload allows the host to be included in the HSTS preload lists of browsers.
+	Preload bool `json:"preload,omitempty"`
+}
+
+// Validate returns an error when the Policy would result in headers which are not valid.
+func (p *Policy) Validate() error {
+	if hsts := p.StrictTransportSecurity; hsts != nil {
+		if hsts.MaxAgeSeconds < 0 {
+			return constable.Error("strictTransportSecurity.maxAgeSeconds must not be negative")
+		}
+		if hsts.Preload && (!hsts.IncludeSubDomains || hsts.MaxAgeSeconds < minHSTSPreloadMaxAgeSeconds) {
+			return fmt.Errorf("strictTransportSecurity.preload requires includeSubDomains and a maxAgeSeconds of at least %d", minHSTSPreloadMaxAgeSeconds)
+		}
+	}
+
+	if !httpguts.ValidHeaderFieldValue(p.ContentSecurityPolicy) {
+		return constable.Error("contentSecurityPolicy must be a valid header value")
+	}
+	if !httpguts.ValidHeaderFieldValue(p.PermissionsPolicy) {
+		return constable.Error("permissionsPolicy must be a valid header value")
+	}
+
+	if err := validateOneOf("crossOriginOpenerPolicy", p.CrossOriginOpenerPolicy,
+		"", "unsafe-none", "same-origin-allow-popups", "same-origin"); err != nil {
+		return err
+	}
+	return validateOneOf("crossOriginEmbedderPolicy", p.CrossOriginEmbedderPolicy,
+		"", "unsafe-none", "require-corp", "credentialless")
+}
+
+// Merge returns a copy of the Policy in which each setting that is configured by the override replaces
+// the setting of the Policy.
+func (p Policy) Merge(override *Policy) Policy {
+	if override == nil {
+		return p
+	}
+	if override.StrictTransportSecurity != nil {
+		p.StrictTransportSecurity = override.StrictTransportSecurity
+	}
+	if override.ContentSecurityPolicy != "" {
+		p.ContentSecurityPolicy = override.ContentSecurityPolicy
+	}
+	if override.PermissionsPolicy != "" {
+		p.PermissionsPolicy = override.PermissionsPolicy
+	}
+	if override.CrossOriginOpenerPolicy != "" {
+		p.CrossOriginOpenerPolicy = override.CrossOriginOpenerPolicy
+	}
+	if override.CrossOriginEmbedderPolicy != "" {
+		p.CrossOriginEmbedderPolicy = override.CrossOriginEmbedderPolicy
+	}
+	return p
+}
+
+// WrapWithPolicy wraps the provided http.Handler so it also sets the headers configured by the Policy.
+// The headers are set just before the response is written, so they are set even when the wrapped
+// handler sets its own security-related headers, e.g. by using Wrap.
+func WrapWithPolicy(wrapped http.Handler, policy Policy) http.Handler {
+	if policy == (Policy{}) {
+		return wrapped
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &policyResponseWriter{ResponseWriter: w, policy: &policy}
+		wrapped.ServeHTTP(pw, r)
+		// The wrapped handler might not have written anything, in which case the response is written after it returns.
+		pw.setHeaders()
+	})
+}
+
+type policyResponseWriter struct {
+	http.ResponseWriter
+	policy     *Policy
+	headersSet bool
+}
+
+func (w *policyResponseWriter) WriteHeader(statusCode int) {
+	w.setHeaders()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *policyResponseWriter) Write(b []byte) (int, error) {
+	w.setHeaders()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *policyResponseWriter) setHeaders() {
+	if w.headersSet {
+		return
+	}
+	w.headersSet = true
+
+	h := w.Header()
+	if hsts := w.policy.StrictTransportSecurity; hsts != nil {
+		value := "max-age=" + strconv.FormatInt(hsts.MaxAgeSeconds, 10)
+		if hsts.IncludeSubDomains {
+			value += "; includeSubDomains"
+		}
+		if hsts.Preload {
+			value += "; preload"
+		}
+		h.Set("Strict-Transport-Security", value)
+	}
+	if w.policy.ContentSecurityPolicy != "" {
+		h.Add("Content-Security-Policy", w.policy.ContentSecurityPolicy)
+	}
+	if w.policy.PermissionsPolicy != "" {
+		h.Set("Permissions-Policy", w.policy.PermissionsPolicy)
+	}
+	if w.policy.CrossOriginOpenerPolicy != "" {
+		h.Set("Cross-Origin-Opener-Policy", w.policy.CrossOriginOpenerPolicy)
+	}
+	if w.policy.CrossOriginEmbedderPolicy != "" {
+		h.Set("Cross-Origin-Embedder-Policy", w.policy.CrossOriginEmbedderPolicy)
+	}
+}
+
+func validateOneOf(name, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s must be one of %s", name, strings.Join(allowed[1:], ", "))
+}
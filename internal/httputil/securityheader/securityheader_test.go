@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package securityheader
@@ -84,3 +84,156 @@ func TestWrap(t *testing.T) {
 		})
 	}
 }
+
+func TestWrapWithPolicy(t *testing.T) {
+	for _, tt := range []struct {
+		name          string
+		policy        Policy
+		expectHeaders http.Header
+	}{
+		{
+			name:   "empty policy",
+			policy: Policy{},
+			expectHeaders: http.Header{
+				"Content-Security-Policy":      []string{"default-src 'none'; frame-ancestors 'none'"},
+				"Strict-Transport-Security":    nil,
+				"Permissions-Policy":           nil,
+				"Cross-Origin-Opener-Policy":   nil,
+				"Cross-Origin-Embedder-Policy": nil,
+			},
+		},
+		{
+			name: "HSTS",
+			policy: Policy{
+				StrictTransportSecurity: &StrictTransportSecurity{MaxAgeSeconds: 31536000, IncludeSubDomains: true, Preload: true},
+			},
+			expectHeaders: http.Header{
+				"Strict-Transport-Security": []string{"max-age=31536000; includeSubDomains; preload"},
+			},
+		},
+		{
+			name: "all headers",
+			policy: Policy{
+				StrictTransportSecurity:   &StrictTransportSecurity{MaxAgeSeconds: 0},
+				ContentSecurityPolicy:     "upgrade-insecure-requests",
+				PermissionsPolicy:         "camera=(), microphone=()",
+				CrossOriginOpenerPolicy:   "same-origin",
+				CrossOriginEmbedderPolicy: "require-corp",
+			},
+			expectHeaders: http.Header{
+				"X-Test-Header":                []string{"test value"},
+				"Content-Security-Policy":      []string{"default-src 'none'; frame-ancestors 'none'", "upgrade-insecure-requests"},
+				"Strict-Transport-Security":    []string{"max-age=0"},
+				"Permissions-Policy":           []string{"camera=(), microphone=()"},
+				"Cross-Origin-Opener-Policy":   []string{"same-origin"},
+				"Cross-Origin-Embedder-Policy": []string{"require-corp"},
+				"X-Frame-Options":              []string{"DENY"},
+			},
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for _, handler := range []http.HandlerFunc{
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("X-Test-Header", "test value")
+					w.WriteHeader(http.StatusOK)
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("X-Test-Header", "test value")
+					_, _ = w.Write([]byte("hello world"))
+				},
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("X-Test-Header", "test value")
+				},
+			} {
+				rsp := httptest.NewRecorder()
+				WrapWithPolicy(Wrap(handler), tt.policy).ServeHTTP(rsp, httptest.NewRequest(http.MethodGet, "/", nil))
+				require.Equal(t, http.StatusOK, rsp.Code)
+				for key, values := range tt.expectHeaders {
+					assert.Equalf(t, values, rsp.Header().Values(key), "unexpected values for header %s", key)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		policy  Policy
+		wantErr string
+	}{
+		{
+			name:   "empty policy",
+			policy: Policy{},
+		},
+		{
+			name: "valid policy",
+			policy: Policy{
+				StrictTransportSecurity:   &StrictTransportSecurity{MaxAgeSeconds: 31536000, IncludeSubDomains: true, Preload: true},
+				ContentSecurityPolicy:     "upgrade-insecure-requests",
+				PermissionsPolicy:         "camera=()",
+				CrossOriginOpenerPolicy:   "same-origin-allow-popups",
+				CrossOriginEmbedderPolicy: "credentialless",
+			},
+		},
+		{
+			name:    "negative HSTS max age",
+			policy:  Policy{StrictTransportSecurity: &StrictTransportSecurity{MaxAgeSeconds: -1}},
+			wantErr: "strictTransportSecurity.maxAgeSeconds must not be negative",
+		},
+		{
+			name:    "HSTS preload with a short max age",
+			policy:  Policy{StrictTransportSecurity: &StrictTransportSecurity{MaxAgeSeconds: 60, IncludeSubDomains: true, Preload: true}},
+			wantErr: "strictTransportSecurity.preload requires includeSubDomains and a maxAgeSeconds of at least 31536000",
+		},
+		{
+			name:    "CSP with a newline",
+			policy:  Policy{ContentSecurityPolicy: "default-src 'self'\r\nSet-Cookie: a=b"},
+			wantErr: "contentSecurityPolicy must be a valid header value",
+		},
+		{
+			name:    "Permissions-Policy with a newline",
+			policy:  Policy{PermissionsPolicy: "camera=()\n"},
+			wantErr: "permissionsPolicy must be a valid header value",
+		},
+		{
+			name:    "unknown Cross-Origin-Embedder-Policy",
+			policy:  Policy{CrossOriginEmbedderPolicy: "require-everything"},
+			wantErr: "crossOriginEmbedderPolicy must be one of unsafe-none, require-corp, credentialless",
+		},
+	} {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPolicyMerge(t *testing.T) {
+	base := Policy{
+		StrictTransportSecurity: &StrictTransportSecurity{MaxAgeSeconds: 60},
+		ContentSecurityPolicy:   "upgrade-insecure-requests",
+		PermissionsPolicy:       "camera=()",
+	}
+
+	require.Equal(t, base, base.Merge(nil))
+	require.Equal(t, base, base.Merge(&Policy{}))
+	require.Equal(t, Policy{
+		StrictTransportSecurity:   &StrictTransportSecurity{MaxAgeSeconds: 120, IncludeSubDomains: true},
+		ContentSecurityPolicy:     "upgrade-insecure-requests",
+		PermissionsPolicy:         "microphone=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+	}, base.Merge(&Policy{
+		StrictTransportSecurity:   &StrictTransportSecurity{MaxAgeSeconds: 120, IncludeSubDomains: true},
+		PermissionsPolicy:         "microphone=()",
+		CrossOriginOpenerPolicy:   "same-origin",
+		CrossOriginEmbedderPolicy: "require-corp",
+	}))
+}
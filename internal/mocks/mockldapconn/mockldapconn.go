@@ -64,6 +64,20 @@ func (mr *MockConnMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConn)(nil).Close))
 }
 
+// ExternalBind mocks base method.
+func (m *MockConn) ExternalBind() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExternalBind")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExternalBind indicates an expected call of ExternalBind.
+func (mr *MockConnMockRecorder) ExternalBind() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExternalBind", reflect.TypeOf((*MockConn)(nil).ExternalBind))
+}
+
 // Search mocks base method.
 func (m *MockConn) Search(arg0 *ldap.SearchRequest) (*ldap.SearchResult, error) {
 	m.ctrl.T.Helper()
@@ -4,8 +4,10 @@
 package phttp
 
 import (
+	"crypto/tls"
 	"crypto/x509"
 	"net/http"
+	"net/url"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/net"
@@ -20,13 +22,39 @@ func Default(rootCAs *x509.CertPool) *http.Client {
 	return buildClient(ptls.Default, rootCAs)
 }
 
+// Option customizes the transport of a client returned by DefaultWithOptions.
+type Option func(*http.Transport)
+
+// WithClientCertificate causes the client to present the given certificate when the server requests a client
+// certificate.
+func WithClientCertificate(clientCert tls.Certificate) Option {
+	return func(rt *http.Transport) {
+		rt.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	}
+}
+
+// WithProxy causes the client to use the given proxy func instead of the proxy settings from the environment.
+func WithProxy(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(rt *http.Transport) {
+		rt.Proxy = proxy
+	}
+}
+
+// DefaultWithOptions is like Default, but the client's transport is further customized by the given options.
+func DefaultWithOptions(rootCAs *x509.CertPool, opts ...Option) *http.Client {
+	return buildClient(ptls.Default, rootCAs, opts...)
+}
+
 func Secure(rootCAs *x509.CertPool) *http.Client {
 	return buildClient(ptls.Secure, rootCAs)
 }
 
-func buildClient(tlsConfigFunc ptls.ConfigFunc, rootCAs *x509.CertPool) *http.Client {
+func buildClient(tlsConfigFunc ptls.ConfigFunc, rootCAs *x509.CertPool, opts ...Option) *http.Client {
 	baseRT := defaultTransport()
 	baseRT.TLSClientConfig = tlsConfigFunc(rootCAs)
+	for _, opt := range opts {
+		opt(baseRT)
+	}
 
 	return &http.Client{
 		Transport: defaultWrap(baseRT),
@@ -8,13 +8,16 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/client-go/util/cert"
 
+	"go.pinniped.dev/internal/certauthority"
 	"go.pinniped.dev/internal/crypto/ptls"
 	"go.pinniped.dev/internal/testutil/tlsserver"
 )
@@ -106,6 +109,39 @@ func TestClient(t *testing.T) {
 	}
 }
 
+func TestDefaultWithOptions(t *testing.T) {
+	t.Parallel()
+
+	clientCA, err := certauthority.New("client-ca", time.Hour)
+	require.NoError(t, err)
+	clientCert, err := clientCA.IssueClientCert("some-client", nil, time.Hour)
+	require.NoError(t, err)
+
+	var sawRequest bool
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		assert.Len(t, r.TLS.VerifiedChains, 1)
+		assert.Equal(t, "some-client", r.TLS.PeerCertificates[0].Subject.CommonName)
+		sawRequest = true
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCA.Pool()} //nolint:gosec // test server
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(server.Certificate())
+
+	c := DefaultWithOptions(rootCAs, WithClientCertificate(*clientCert))
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	require.True(t, sawRequest)
+}
+
 func assertUserAgent(t *testing.T, r *http.Request) {
 	t.Helper()
 
@@ -0,0 +1,49 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package phttp
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyURL parses the URL of an HTTP or HTTPS proxy. When a username is provided, the username and password are
+// added to the URL so that they will be sent to the proxy using basic auth.
+func ProxyURL(rawURL, username, password string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http or https", rawURL)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: host must not be empty", rawURL)
+	}
+	if proxyURL.User != nil {
+		// Credentials in the URL would be visible to anyone who can read the resource which configures the proxy.
+		return nil, fmt.Errorf("invalid proxy URL %q: credentials must not be included in the URL", rawURL)
+	}
+	if username != "" {
+		proxyURL.User = url.UserPassword(username, password)
+	}
+	return proxyURL, nil
+}
+
+// ProxyFunc returns a func for use with WithProxy which sends all requests to the given proxy, except for requests to
+// hosts which match noProxy. The format of noProxy is the same as the NO_PROXY environment variable. Requests to
+// localhost and loopback addresses are never sent to the proxy.
+func ProxyFunc(proxyURL *url.URL, noProxy string) func(*http.Request) (*url.URL, error) {
+	proxy := (&httpproxy.Config{
+		HTTPProxy:  proxyURL.String(),
+		HTTPSProxy: proxyURL.String(),
+		NoProxy:    noProxy,
+	}).ProxyFunc()
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
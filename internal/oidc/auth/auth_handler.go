@@ -5,8 +5,13 @@
 package auth
 
 import (
+	"encoding/base64"
 	"fmt"
+	"html/template"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
@@ -17,6 +22,7 @@ import (
 	"github.com/pkg/errors"
 	"golang.org/x/oauth2"
 
+	idpdiscoveryv1alpha1 "go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	supervisoroidc "go.pinniped.dev/generated/latest/apis/supervisor/oidc"
 	"go.pinniped.dev/internal/authenticators"
 	"go.pinniped.dev/internal/httputil/httperr"
@@ -24,7 +30,11 @@ import (
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/idpdiscovery"
+	"go.pinniped.dev/internal/oidc/loginattempts"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/chooseidphtml"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/pkg/oidcclient/nonce"
@@ -46,7 +56,13 @@ func NewHandler(
 	generateNonce func() (nonce.Nonce, error),
 	upstreamStateEncoder oidc.Encoder,
 	cookieCodec oidc.Codec,
+	loginLimiter loginattempts.Limiter,
+	trustedProxies []*net.IPNet,
+	brand *branding.Branding,
 ) http.Handler {
+	chooseIDPTemplate := chooseidphtml.Template(brand)
+	chooseIDPContentSecurityPolicy := chooseidphtml.ContentSecurityPolicy(brand)
+
 	return securityheader.Wrap(httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		if r.Method != http.MethodPost && r.Method != http.MethodGet {
 			// https://openid.net/specs/openid-connect-core-1_0.html#AuthRequest
@@ -55,16 +71,63 @@ func NewHandler(
 			return httperr.Newf(http.StatusMethodNotAllowed, "%s (try GET or POST)", r.Method)
 		}
 
-		oidcUpstream, ldapUpstream, idpType, err := chooseUpstreamIDP(idpLister)
+		if err := r.ParseForm(); err != nil {
+			return httperr.Wrap(http.StatusBadRequest, "error parsing request params", err)
+		}
+		requestedIDPName := r.Form.Get(supervisoroidc.AuthorizeUpstreamIDPNameParamName)
+		requestedIDPType := r.Form.Get(supervisoroidc.AuthorizeUpstreamIDPTypeParamName)
+		isBrowserFlow := len(r.Header.Values(supervisoroidc.AuthorizeUsernameHeaderName)) == 0 &&
+			len(r.Header.Values(supervisoroidc.AuthorizePasswordHeaderName)) == 0
+		if requestedIDPName == "" && isBrowserFlow && len(listUpstreamIDPs(idpLister)) > 1 {
+			// The client did not choose one of the upstream IDPs, e.g. because it is a web application which does
+			// not know about Pinniped's custom params, so let the user choose one. Clients which send the username
+			// and password headers cannot show the page, so they get an error asking them to choose one instead.
+			return handleAuthRequestByShowingChooseIDPPage(r, w, oauthHelperWithoutStorage, idpLister, chooseIDPTemplate, chooseIDPContentSecurityPolicy)
+		}
+
+		oidcUpstream, gitHubUpstream, samlUpstream, oauth2Upstream, ldapUpstream, idpType, err := chooseUpstreamIDP(idpLister, requestedIDPName, requestedIDPType)
 		if err != nil {
 			plog.WarningErr("authorize upstream config", err)
 			return err
 		}
 
+		if idpType == psession.ProviderTypeGitHub {
+			return handleAuthRequestForGitHubUpstream(r, w,
+				oauthHelperWithoutStorage,
+				generateCSRF, generateNonce, generatePKCE,
+				gitHubUpstream,
+				downstreamIssuer,
+				upstreamStateEncoder,
+				cookieCodec,
+			)
+		}
+
+		if idpType == psession.ProviderTypeSAML {
+			return handleAuthRequestForSAMLUpstream(r, w,
+				oauthHelperWithoutStorage,
+				generateCSRF, generateNonce, generatePKCE,
+				samlUpstream,
+				downstreamIssuer,
+				upstreamStateEncoder,
+				cookieCodec,
+			)
+		}
+
+		if idpType == psession.ProviderTypeOAuth2 {
+			return handleAuthRequestForOAuth2Upstream(r, w,
+				oauthHelperWithoutStorage,
+				generateCSRF, generateNonce, generatePKCE,
+				oauth2Upstream,
+				downstreamIssuer,
+				upstreamStateEncoder,
+				cookieCodec,
+			)
+		}
+
 		if idpType == psession.ProviderTypeOIDC {
 			if len(r.Header.Values(supervisoroidc.AuthorizeUsernameHeaderName)) > 0 {
 				// The client set a username header, so they are trying to log in with a username/password.
-				return handleAuthRequestForOIDCUpstreamPasswordGrant(r, w, oauthHelperWithStorage, oidcUpstream)
+				return handleAuthRequestForOIDCUpstreamPasswordGrant(r, w, oauthHelperWithStorage, oidcUpstream, loginLimiter, trustedProxies)
 			}
 			return handleAuthRequestForOIDCUpstreamAuthcodeGrant(r, w,
 				oauthHelperWithoutStorage,
@@ -79,39 +142,126 @@ func NewHandler(
 			oauthHelperWithStorage,
 			ldapUpstream,
 			idpType,
+			loginLimiter,
+			trustedProxies,
 		)
 	}))
 }
 
+// handleAuthRequestByShowingChooseIDPPage validates the authorize request and then renders a page which lets the user
+// choose an upstream IDP. Each choice continues the authorize request with the same params, plus the params which
+// select that IDP.
+func handleAuthRequestByShowingChooseIDPPage(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	idpLister oidc.UpstreamIdentityProvidersLister,
+	chooseIDPTemplate *template.Template,
+	chooseIDPContentSecurityPolicy string,
+) error {
+	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, false)
+	if !created {
+		return nil
+	}
+
+	promptParam := r.Form.Get(promptParamName)
+	if promptParam == promptParamNone && oidc.ScopeWasRequested(authorizeRequester, coreosoidc.ScopeOpenID) {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, fosite.ErrLoginRequired, false)
+	}
+
+	pageData := chooseidphtml.PageData{}
+	for _, idp := range idpdiscovery.PinnipedIDPs(idpLister) {
+		choice := chooseidphtml.IdentityProvider{Name: idp.Name, Type: idp.Type.String()}
+		for _, flow := range idp.Flows {
+			if flow == idpdiscoveryv1alpha1.IDPFlowBrowserAuthcode {
+				params := url.Values{}
+				for k, v := range r.Form {
+					params[k] = v
+				}
+				params.Set(supervisoroidc.AuthorizeUpstreamIDPNameParamName, idp.Name)
+				params.Set(supervisoroidc.AuthorizeUpstreamIDPTypeParamName, idp.Type.String())
+				// A relative URL which has only a query resolves to the path of this authorize endpoint.
+				choice.LoginURL = "?" + params.Encode()
+			}
+		}
+		pageData.IdentityProviders = append(pageData.IdentityProviders, choice)
+	}
+
+	w.Header().Set("Content-Security-Policy", chooseIDPContentSecurityPolicy)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	return chooseIDPTemplate.Execute(w, &pageData)
+}
+
 func handleAuthRequestForLDAPUpstream(
 	r *http.Request,
 	w http.ResponseWriter,
 	oauthHelper fosite.OAuth2Provider,
 	ldapUpstream provider.UpstreamLDAPIdentityProviderI,
 	idpType psession.ProviderType,
+	loginLimiter loginattempts.Limiter,
+	trustedProxies []*net.IPNet,
 ) error {
 	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
 	if !created {
 		return nil
 	}
 
-	username, password, hadUsernamePasswordValues := requireNonEmptyUsernameAndPasswordHeaders(r, w, oauthHelper, authorizeRequester)
-	if !hadUsernamePasswordValues {
-		return nil
+	var authenticateResponse *authenticators.Response
+	var authenticated bool
+	var err error
+	var notAcceptedHint string
+	if negotiateToken, hadNegotiateToken := negotiateTokenFromHeader(r); hadNegotiateToken {
+		// The client sent a Kerberos ticket, so they are trying to log in with Kerberos.
+		kerberosUpstream, ok := ldapUpstream.(provider.UpstreamKerberosIdentityProviderI)
+		if !ok || !kerberosUpstream.AllowsKerberos() {
+			return writeAuthorizeError(w, oauthHelper, authorizeRequester,
+				fosite.ErrAccessDenied.WithHintf("Kerberos authentication is not allowed by this identity provider."), true)
+		}
+		decodedNegotiateToken, decodeErr := base64.StdEncoding.DecodeString(negotiateToken)
+		if decodeErr != nil {
+			return writeAuthorizeError(w, oauthHelper, authorizeRequester,
+				fosite.ErrInvalidRequest.WithHintf("Negotiate token is not valid base64."), true)
+		}
+		authenticateResponse, authenticated, err = kerberosUpstream.AuthenticateKerberosUser(r.Context(), decodedNegotiateToken)
+		notAcceptedHint = "Kerberos ticket not accepted by LDAP provider."
+	} else {
+		username, password, hadUsernamePasswordValues := requireNonEmptyUsernameAndPasswordHeaders(r, w, oauthHelper, authorizeRequester)
+		if !hadUsernamePasswordValues {
+			return nil
+		}
+		reservation, rejectedFor := loginLimiter.Reserve(r.Context(), newLoginAttempt(r, trustedProxies, ldapUpstream.GetName(), idpType, username))
+		if rejectedFor > 0 {
+			return writeTooManyFailedLoginAttemptsError(w, oauthHelper, authorizeRequester, rejectedFor)
+		}
+		authenticateResponse, authenticated, err = ldapUpstream.AuthenticateUser(r.Context(), username, password)
+		switch {
+		case err != nil:
+			// Don't count errors such as network failures, which are not the fault of the user.
+			reservation.Release(r.Context())
+		case authenticated:
+			reservation.Succeeded(r.Context())
+		default:
+			reservation.Failed(r.Context())
+		}
+		notAcceptedHint = "Username/password not accepted by LDAP provider."
+		if idpType == psession.ProviderTypeWebhook {
+			notAcceptedHint = "Username/password not accepted by webhook provider."
+		} else if idpType == psession.ProviderTypeLocal {
+			notAcceptedHint = "Username/password not accepted by local provider."
+		}
 	}
-
-	authenticateResponse, authenticated, err := ldapUpstream.AuthenticateUser(r.Context(), username, password)
 	if err != nil {
 		plog.WarningErr("unexpected error during upstream LDAP authentication", err, "upstreamName", ldapUpstream.GetName())
 		return httperr.New(http.StatusBadGateway, "unexpected error during upstream authentication")
 	}
 	if !authenticated {
 		return writeAuthorizeError(w, oauthHelper, authorizeRequester,
-			fosite.ErrAccessDenied.WithHintf("Username/password not accepted by LDAP provider."), true)
+			fosite.ErrAccessDenied.WithHint(notAcceptedHint), true)
 	}
 
 	subject := downstreamSubjectFromUpstreamLDAP(ldapUpstream, authenticateResponse)
-	username = authenticateResponse.User.GetName()
+	username := authenticateResponse.User.GetName()
 	groups := authenticateResponse.User.GetGroups()
 	dn := authenticateResponse.DN
 
@@ -133,6 +283,15 @@ func handleAuthRequestForLDAPUpstream(
 			ExtraRefreshAttributes: authenticateResponse.ExtraRefreshAttributes,
 		}
 	}
+	if idpType == psession.ProviderTypeWebhook {
+		customSessionData.Webhook = &psession.WebhookSessionData{
+			UserUID: authenticateResponse.User.GetUID(),
+		}
+	} else if idpType == psession.ProviderTypeLocal {
+		customSessionData.Local = &psession.LocalSessionData{
+			UserUID: authenticateResponse.User.GetUID(),
+		}
+	}
 
 	return makeDownstreamSessionAndReturnAuthcodeRedirect(r, w,
 		oauthHelper, authorizeRequester, subject, username, groups, customSessionData)
@@ -143,6 +302,8 @@ func handleAuthRequestForOIDCUpstreamPasswordGrant(
 	w http.ResponseWriter,
 	oauthHelper fosite.OAuth2Provider,
 	oidcUpstream provider.UpstreamOIDCIdentityProviderI,
+	loginLimiter loginattempts.Limiter,
+	trustedProxies []*net.IPNet,
 ) error {
 	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
 	if !created {
@@ -161,7 +322,24 @@ func handleAuthRequestForOIDCUpstreamPasswordGrant(
 				"Resource owner password credentials grant is not allowed for this upstream provider according to its configuration."), true)
 	}
 
+	reservation, rejectedFor := loginLimiter.Reserve(r.Context(), newLoginAttempt(r, trustedProxies, oidcUpstream.GetName(), psession.ProviderTypeOIDC, username))
+	if rejectedFor > 0 {
+		return writeTooManyFailedLoginAttemptsError(w, oauthHelper, authorizeRequester, rejectedFor)
+	}
+
 	token, err := oidcUpstream.PasswordCredentialsGrantAndValidateTokens(r.Context(), username, password)
+	var retrieveErr *oauth2.RetrieveError
+	switch {
+	case err == nil:
+		reservation.Succeeded(r.Context())
+	case errors.As(err, &retrieveErr) && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < http.StatusInternalServerError:
+		// The upstream server rejected the request, probably because of bad credentials, so the attempt counts as
+		// a failure.
+		reservation.Failed(r.Context())
+	default:
+		// Don't count other errors such as network failures, which are not the fault of the user.
+		reservation.Release(r.Context())
+	}
 	if err != nil {
 		// Upstream password grant errors can be generic errors (e.g. a network failure) or can be oauth2.RetrieveError errors
 		// which represent the http response from the upstream server. These could be a 5XX or some other unexpected error,
@@ -192,6 +370,26 @@ func handleAuthRequestForOIDCUpstreamPasswordGrant(
 	return makeDownstreamSessionAndReturnAuthcodeRedirect(r, w, oauthHelper, authorizeRequester, subject, username, groups, customSessionData)
 }
 
+// newLoginAttempt describes a password-based login attempt for the loginattempts.Limiter.
+func newLoginAttempt(r *http.Request, trustedProxies []*net.IPNet, idpName string, idpType psession.ProviderType, username string) loginattempts.Attempt {
+	return loginattempts.Attempt{
+		IDPName:  idpName,
+		IDPType:  string(idpType),
+		Username: username,
+		SourceIP: loginattempts.SourceIP(r, trustedProxies),
+	}
+}
+
+func writeTooManyFailedLoginAttemptsError(
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	authorizeRequester fosite.AuthorizeRequester,
+	rejectedFor time.Duration,
+) error {
+	return writeAuthorizeError(w, oauthHelper, authorizeRequester,
+		fosite.ErrAccessDenied.WithHintf("Too many failed login attempts. Try again in %s.", (rejectedFor+time.Second-1).Truncate(time.Second)), true)
+}
+
 func handleAuthRequestForOIDCUpstreamAuthcodeGrant(
 	r *http.Request,
 	w http.ResponseWriter,
@@ -273,7 +471,7 @@ func handleAuthRequestForOIDCUpstreamAuthcodeGrant(
 
 	if csrfFromCookie == "" {
 		// We did not receive an incoming CSRF cookie, so write a new one.
-		err := addCSRFSetCookieHeader(w, csrfValue, cookieCodec)
+		err := addCSRFSetCookieHeader(w, csrfValue, cookieCodec, http.SameSiteLaxMode)
 		if err != nil {
 			plog.Error("error setting CSRF cookie", err)
 			return err
@@ -291,6 +489,309 @@ func handleAuthRequestForOIDCUpstreamAuthcodeGrant(
 	return nil
 }
 
+func handleAuthRequestForGitHubUpstream(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	generateCSRF func() (csrftoken.CSRFToken, error),
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+	gitHubUpstream provider.UpstreamGitHubIdentityProviderI,
+	downstreamIssuer string,
+	upstreamStateEncoder oidc.Encoder,
+	cookieCodec oidc.Codec,
+) error {
+	if len(r.Header.Values(supervisoroidc.AuthorizeUsernameHeaderName)) > 0 {
+		authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
+		if !created {
+			return nil
+		}
+		// GitHub only supports web-based login flows.
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester,
+			fosite.ErrAccessDenied.WithHint(
+				"Resource owner password credentials grant is not supported by GitHub identity providers."), true)
+	}
+
+	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, false)
+	if !created {
+		return nil
+	}
+
+	now := time.Now()
+	_, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, &psession.PinnipedSession{
+		Fosite: &openid.DefaultSession{
+			Claims: &jwt.IDTokenClaims{
+				// Temporary claim values to allow `NewAuthorizeResponse` to perform other OIDC validations.
+				Subject:     "none",
+				AuthTime:    now,
+				RequestedAt: now,
+			},
+		},
+	})
+	if err != nil {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, err, false)
+	}
+
+	promptParam := r.Form.Get(promptParamName)
+	if promptParam == promptParamNone && oidc.ScopeWasRequested(authorizeRequester, coreosoidc.ScopeOpenID) {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, fosite.ErrLoginRequired, false)
+	}
+
+	// GitHub does not use the nonce or PKCE values, but they are still part of the state param format.
+	csrfValue, nonceValue, pkceValue, err := generateValues(generateCSRF, generateNonce, generatePKCE)
+	if err != nil {
+		plog.Error("authorize generate error", err)
+		return err
+	}
+	csrfFromCookie := readCSRFCookie(r, cookieCodec)
+	if csrfFromCookie != "" {
+		csrfValue = csrfFromCookie
+	}
+
+	encodedStateParamValue, err := upstreamStateParam(
+		authorizeRequester,
+		gitHubUpstream.GetName(),
+		nonceValue,
+		csrfValue,
+		pkceValue,
+		upstreamStateEncoder,
+	)
+	if err != nil {
+		plog.Error("authorize upstream state param error", err)
+		return err
+	}
+
+	if csrfFromCookie == "" {
+		// We did not receive an incoming CSRF cookie, so write a new one.
+		err := addCSRFSetCookieHeader(w, csrfValue, cookieCodec, http.SameSiteLaxMode)
+		if err != nil {
+			plog.Error("error setting CSRF cookie", err)
+			return err
+		}
+	}
+
+	upstreamOAuthConfig := oauth2.Config{
+		ClientID: gitHubUpstream.GetClientID(),
+		Endpoint: oauth2.Endpoint{
+			AuthURL: gitHubUpstream.GetAuthorizationURL(),
+		},
+		RedirectURL: fmt.Sprintf("%s/callback", downstreamIssuer),
+		Scopes:      gitHubUpstream.GetScopes(),
+	}
+
+	http.Redirect(w, r,
+		upstreamOAuthConfig.AuthCodeURL(encodedStateParamValue),
+		http.StatusSeeOther, // match fosite and https://tools.ietf.org/id/draft-ietf-oauth-security-topics-18.html#section-4.11
+	)
+
+	return nil
+}
+
+func handleAuthRequestForOAuth2Upstream(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	generateCSRF func() (csrftoken.CSRFToken, error),
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+	oauth2Upstream provider.UpstreamOAuth2IdentityProviderI,
+	downstreamIssuer string,
+	upstreamStateEncoder oidc.Encoder,
+	cookieCodec oidc.Codec,
+) error {
+	if len(r.Header.Values(supervisoroidc.AuthorizeUsernameHeaderName)) > 0 {
+		authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
+		if !created {
+			return nil
+		}
+		// OAuth2 identity providers only support web-based login flows.
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester,
+			fosite.ErrAccessDenied.WithHint(
+				"Resource owner password credentials grant is not supported by OAuth2 identity providers."), true)
+	}
+
+	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, false)
+	if !created {
+		return nil
+	}
+
+	now := time.Now()
+	_, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, &psession.PinnipedSession{
+		Fosite: &openid.DefaultSession{
+			Claims: &jwt.IDTokenClaims{
+				// Temporary claim values to allow `NewAuthorizeResponse` to perform other OIDC validations.
+				Subject:     "none",
+				AuthTime:    now,
+				RequestedAt: now,
+			},
+		},
+	})
+	if err != nil {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, err, false)
+	}
+
+	promptParam := r.Form.Get(promptParamName)
+	if promptParam == promptParamNone && oidc.ScopeWasRequested(authorizeRequester, coreosoidc.ScopeOpenID) {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, fosite.ErrLoginRequired, false)
+	}
+
+	// OAuth2 does not use the nonce value, but it is still part of the state param format.
+	csrfValue, nonceValue, pkceValue, err := generateValues(generateCSRF, generateNonce, generatePKCE)
+	if err != nil {
+		plog.Error("authorize generate error", err)
+		return err
+	}
+	csrfFromCookie := readCSRFCookie(r, cookieCodec)
+	if csrfFromCookie != "" {
+		csrfValue = csrfFromCookie
+	}
+
+	encodedStateParamValue, err := upstreamStateParam(
+		authorizeRequester,
+		oauth2Upstream.GetName(),
+		nonceValue,
+		csrfValue,
+		pkceValue,
+		upstreamStateEncoder,
+	)
+	if err != nil {
+		plog.Error("authorize upstream state param error", err)
+		return err
+	}
+
+	authCodeOptions := []oauth2.AuthCodeOption{
+		pkceValue.Challenge(),
+		pkceValue.Method(),
+	}
+	for key, val := range oauth2Upstream.GetAdditionalAuthcodeParams() {
+		authCodeOptions = append(authCodeOptions, oauth2.SetAuthURLParam(key, val))
+	}
+
+	if csrfFromCookie == "" {
+		// We did not receive an incoming CSRF cookie, so write a new one.
+		err := addCSRFSetCookieHeader(w, csrfValue, cookieCodec, http.SameSiteLaxMode)
+		if err != nil {
+			plog.Error("error setting CSRF cookie", err)
+			return err
+		}
+	}
+
+	upstreamOAuthConfig := oauth2.Config{
+		ClientID: oauth2Upstream.GetClientID(),
+		Endpoint: oauth2.Endpoint{
+			AuthURL: oauth2Upstream.GetAuthorizationURL(),
+		},
+		RedirectURL: fmt.Sprintf("%s/callback", downstreamIssuer),
+		Scopes:      oauth2Upstream.GetScopes(),
+	}
+
+	http.Redirect(w, r,
+		upstreamOAuthConfig.AuthCodeURL(encodedStateParamValue, authCodeOptions...),
+		http.StatusSeeOther, // match fosite and https://tools.ietf.org/id/draft-ietf-oauth-security-topics-18.html#section-4.11
+	)
+
+	return nil
+}
+
+func handleAuthRequestForSAMLUpstream(
+	r *http.Request,
+	w http.ResponseWriter,
+	oauthHelper fosite.OAuth2Provider,
+	generateCSRF func() (csrftoken.CSRFToken, error),
+	generateNonce func() (nonce.Nonce, error),
+	generatePKCE func() (pkce.Code, error),
+	samlUpstream provider.UpstreamSAMLIdentityProviderI,
+	downstreamIssuer string,
+	upstreamStateEncoder oidc.Encoder,
+	cookieCodec oidc.Codec,
+) error {
+	if len(r.Header.Values(supervisoroidc.AuthorizeUsernameHeaderName)) > 0 {
+		authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, true)
+		if !created {
+			return nil
+		}
+		// SAML only supports web-based login flows.
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester,
+			fosite.ErrAccessDenied.WithHint(
+				"Resource owner password credentials grant is not supported by SAML identity providers."), true)
+	}
+
+	authorizeRequester, created := newAuthorizeRequest(r, w, oauthHelper, false)
+	if !created {
+		return nil
+	}
+
+	now := time.Now()
+	_, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, &psession.PinnipedSession{
+		Fosite: &openid.DefaultSession{
+			Claims: &jwt.IDTokenClaims{
+				// Temporary claim values to allow `NewAuthorizeResponse` to perform other OIDC validations.
+				Subject:     "none",
+				AuthTime:    now,
+				RequestedAt: now,
+			},
+		},
+	})
+	if err != nil {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, err, false)
+	}
+
+	promptParam := r.Form.Get(promptParamName)
+	if promptParam == promptParamNone && oidc.ScopeWasRequested(authorizeRequester, coreosoidc.ScopeOpenID) {
+		return writeAuthorizeError(w, oauthHelper, authorizeRequester, fosite.ErrLoginRequired, false)
+	}
+
+	// SAML does not use the PKCE value, but it is still part of the state param format.
+	// The nonce value is used to derive the ID of the SAML authentication request.
+	csrfValue, nonceValue, pkceValue, err := generateValues(generateCSRF, generateNonce, generatePKCE)
+	if err != nil {
+		plog.Error("authorize generate error", err)
+		return err
+	}
+	csrfFromCookie := readCSRFCookie(r, cookieCodec)
+	if csrfFromCookie != "" {
+		csrfValue = csrfFromCookie
+	}
+
+	encodedStateParamValue, err := upstreamStateParam(
+		authorizeRequester,
+		samlUpstream.GetName(),
+		nonceValue,
+		csrfValue,
+		pkceValue,
+		upstreamStateEncoder,
+	)
+	if err != nil {
+		plog.Error("authorize upstream state param error", err)
+		return err
+	}
+
+	// The SAML response will be sent to the assertion consumer service by a cross-site POST, so the CSRF cookie
+	// must always be written with SameSite=None, even when the browser already has a CSRF cookie.
+	err = addCSRFSetCookieHeader(w, csrfValue, cookieCodec, http.SameSiteNoneMode)
+	if err != nil {
+		plog.Error("error setting CSRF cookie", err)
+		return err
+	}
+
+	authnRequestURL, err := samlUpstream.AuthnRequestURL(
+		oidc.SAMLServiceProviderForIssuer(downstreamIssuer),
+		oidc.SAMLRequestID(nonceValue),
+		encodedStateParamValue,
+	)
+	if err != nil {
+		plog.WarningErr("error making SAML authentication request", err, "upstreamName", samlUpstream.GetName())
+		return httperr.Wrap(http.StatusUnprocessableEntity, "error making SAML authentication request", err)
+	}
+
+	http.Redirect(w, r,
+		authnRequestURL.String(),
+		http.StatusSeeOther, // match fosite and https://tools.ietf.org/id/draft-ietf-oauth-security-topics-18.html#section-4.11
+	)
+
+	return nil
+}
+
 func writeAuthorizeError(w http.ResponseWriter, oauthHelper fosite.OAuth2Provider, authorizeRequester fosite.AuthorizeRequester, err error, isBrowserless bool) error {
 	if plog.Enabled(plog.LevelTrace) {
 		// When trace level logging is enabled, include the stack trace in the log message.
@@ -358,6 +859,17 @@ func rewriteStatusSeeOtherToStatusFoundForBrowserless(w http.ResponseWriter) htt
 	})
 }
 
+// negotiateTokenFromHeader returns the token from an "Authorization: Negotiate <token>" header, as used by the
+// SPNEGO HTTP authentication scheme (see https://datatracker.ietf.org/doc/html/rfc4559).
+func negotiateTokenFromHeader(r *http.Request) (string, bool) {
+	const prefix = "Negotiate "
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) <= len(prefix) || !strings.EqualFold(authorization[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(authorization[len(prefix):]), true
+}
+
 func requireNonEmptyUsernameAndPasswordHeaders(r *http.Request, w http.ResponseWriter, oauthHelper fosite.OAuth2Provider, authorizeRequester fosite.AuthorizeRequester) (string, string, bool) {
 	username := r.Header.Get(supervisoroidc.AuthorizeUsernameHeaderName)
 	password := r.Header.Get(supervisoroidc.AuthorizePasswordHeaderName)
@@ -404,39 +916,98 @@ func readCSRFCookie(r *http.Request, codec oidc.Decoder) csrftoken.CSRFToken {
 	return csrfFromCookie
 }
 
-// Select either an OIDC, an LDAP or an AD IDP, or return an error.
-func chooseUpstreamIDP(idpLister oidc.UpstreamIdentityProvidersLister) (provider.UpstreamOIDCIdentityProviderI, provider.UpstreamLDAPIdentityProviderI, psession.ProviderType, error) {
-	oidcUpstreams := idpLister.GetOIDCIdentityProviders()
-	ldapUpstreams := idpLister.GetLDAPIdentityProviders()
-	adUpstreams := idpLister.GetActiveDirectoryIdentityProviders()
-	switch {
-	case len(oidcUpstreams)+len(ldapUpstreams)+len(adUpstreams) == 0:
-		return nil, nil, "", httperr.New(
+// upstreamIDP is one of the upstream IDPs which are configured for the FederationDomain. Only the field which
+// corresponds to its idpType is set.
+type upstreamIDP struct {
+	name    string
+	idpType psession.ProviderType
+	oidc    provider.UpstreamOIDCIdentityProviderI
+	gitHub  provider.UpstreamGitHubIdentityProviderI
+	saml    provider.UpstreamSAMLIdentityProviderI
+	oauth2  provider.UpstreamOAuth2IdentityProviderI
+	ldap    provider.UpstreamLDAPIdentityProviderI
+}
+
+func listUpstreamIDPs(idpLister oidc.UpstreamIdentityProvidersLister) []upstreamIDP {
+	var upstreams []upstreamIDP
+	for _, idp := range idpLister.GetOIDCIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeOIDC, oidc: idp})
+	}
+	for _, idp := range idpLister.GetLDAPIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeLDAP, ldap: idp})
+	}
+	for _, idp := range idpLister.GetActiveDirectoryIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeActiveDirectory, ldap: idp})
+	}
+	for _, idp := range idpLister.GetGitHubIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeGitHub, gitHub: idp})
+	}
+	for _, idp := range idpLister.GetSAMLIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeSAML, saml: idp})
+	}
+	for _, idp := range idpLister.GetOAuth2IdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeOAuth2, oauth2: idp})
+	}
+	for _, idp := range idpLister.GetWebhookIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeWebhook, ldap: idp})
+	}
+	for _, idp := range idpLister.GetLocalIdentityProviders() {
+		upstreams = append(upstreams, upstreamIDP{name: idp.GetName(), idpType: psession.ProviderTypeLocal, ldap: idp})
+	}
+	return upstreams
+}
+
+// Select either an OIDC, a GitHub, a SAML, an OAuth2, an LDAP, an AD, a webhook or a local IDP, or return an error.
+// When there is more than one upstream IDP, the requested IDP name (and optionally the requested IDP type) is used
+// to select one of them.
+func chooseUpstreamIDP(idpLister oidc.UpstreamIdentityProvidersLister, requestedName, requestedType string) (
+	provider.UpstreamOIDCIdentityProviderI,
+	provider.UpstreamGitHubIdentityProviderI,
+	provider.UpstreamSAMLIdentityProviderI,
+	provider.UpstreamOAuth2IdentityProviderI,
+	provider.UpstreamLDAPIdentityProviderI,
+	psession.ProviderType,
+	error,
+) {
+	upstreams := listUpstreamIDPs(idpLister)
+	if len(upstreams) == 0 {
+		return nil, nil, nil, nil, nil, "", httperr.New(
 			http.StatusUnprocessableEntity,
 			"No upstream providers are configured",
 		)
-	case len(oidcUpstreams)+len(ldapUpstreams)+len(adUpstreams) > 1:
-		var upstreamIDPNames []string
-		for _, idp := range oidcUpstreams {
-			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
-		}
-		for _, idp := range ldapUpstreams {
-			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
-		}
-		for _, idp := range adUpstreams {
-			upstreamIDPNames = append(upstreamIDPNames, idp.GetName())
+	}
+
+	candidates := upstreams
+	if requestedName != "" {
+		candidates = nil
+		for _, upstream := range upstreams {
+			if upstream.name == requestedName && (requestedType == "" || string(upstream.idpType) == requestedType) {
+				candidates = append(candidates, upstream)
+			}
 		}
-		plog.Warning("Too many upstream providers are configured (found: %s)", upstreamIDPNames)
-		return nil, nil, "", httperr.New(
+	}
+
+	switch len(candidates) {
+	case 0:
+		plog.Warning("requested upstream provider was not found", "name", requestedName, "type", requestedType)
+		return nil, nil, nil, nil, nil, "", httperr.Newf(
 			http.StatusUnprocessableEntity,
-			"Too many upstream providers are configured (support for multiple upstreams is not yet implemented)",
+			"Requested upstream provider was not found (name: %q, type: %q)", requestedName, requestedType,
 		)
-	case len(oidcUpstreams) == 1:
-		return oidcUpstreams[0], nil, psession.ProviderTypeOIDC, nil
-	case len(adUpstreams) == 1:
-		return nil, adUpstreams[0], psession.ProviderTypeActiveDirectory, nil
+	case 1:
+		c := candidates[0]
+		return c.oidc, c.gitHub, c.saml, c.oauth2, c.ldap, c.idpType, nil
 	default:
-		return nil, ldapUpstreams[0], psession.ProviderTypeLDAP, nil
+		var upstreamIDPNames []string
+		for _, idp := range candidates {
+			upstreamIDPNames = append(upstreamIDPNames, idp.name)
+		}
+		plog.Warning("too many upstream providers match the request", "names", upstreamIDPNames)
+		return nil, nil, nil, nil, nil, "", httperr.Newf(
+			http.StatusUnprocessableEntity,
+			"Too many upstream providers match the request (specify the %s and %s parameters)",
+			supervisoroidc.AuthorizeUpstreamIDPNameParamName, supervisoroidc.AuthorizeUpstreamIDPTypeParamName,
+		)
 	}
 }
 
@@ -483,7 +1054,7 @@ func upstreamStateParam(
 	return encodedStateParamValue, nil
 }
 
-func addCSRFSetCookieHeader(w http.ResponseWriter, csrfValue csrftoken.CSRFToken, codec oidc.Encoder) error {
+func addCSRFSetCookieHeader(w http.ResponseWriter, csrfValue csrftoken.CSRFToken, codec oidc.Encoder, sameSite http.SameSite) error {
 	encodedCSRFValue, err := codec.Encode(oidc.CSRFCookieEncodingName, csrfValue)
 	if err != nil {
 		return httperr.Wrap(http.StatusInternalServerError, "error encoding CSRF cookie", err)
@@ -493,7 +1064,7 @@ func addCSRFSetCookieHeader(w http.ResponseWriter, csrfValue csrftoken.CSRFToken
 		Name:     oidc.CSRFCookieName,
 		Value:    encodedCSRFValue,
 		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+		SameSite: sameSite,
 		Secure:   true,
 		Path:     "/",
 	})
@@ -5,6 +5,7 @@ package auth
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"html"
@@ -31,7 +32,9 @@ import (
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/loginattempts"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/chooseidphtml"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
@@ -49,6 +52,12 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		ldapUpstreamResourceUID              = "ldap-resource-uid"
 		activeDirectoryUpstreamName          = "some-active-directory-idp"
 		activeDirectoryUpstreamResourceUID   = "active-directory-resource-uid"
+		gitHubUpstreamName                   = "some-github-idp"
+		gitHubUpstreamResourceUID            = "github-resource-uid"
+		samlUpstreamName                     = "some-saml-idp"
+		samlUpstreamResourceUID              = "saml-resource-uid"
+		oauth2UpstreamName                   = "some-oauth2-idp"
+		oauth2UpstreamResourceUID            = "oauth2-resource-uid"
 
 		oidcUpstreamIssuer                    = "https://my-upstream-issuer.com"
 		oidcUpstreamSubject                   = "abc123-some guid" // has a space character which should get escaped in URL
@@ -151,6 +160,30 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			"state":             happyState,
 		}
 
+		fositeAccessDeniedWithTooManyFailedLoginAttemptsHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Too many failed login attempts. Try again in 2s.",
+			"state":             happyState,
+		}
+
+		fositeAccessDeniedWithBadKerberosTicketHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Kerberos ticket not accepted by LDAP provider.",
+			"state":             happyState,
+		}
+
+		fositeAccessDeniedWithKerberosDisallowedHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Kerberos authentication is not allowed by this identity provider.",
+			"state":             happyState,
+		}
+
+		fositeInvalidNegotiateTokenErrorQuery = map[string]string{
+			"error":             "invalid_request",
+			"error_description": "The request is missing a required parameter, includes an invalid parameter value, includes a parameter more than once, or is otherwise malformed. Negotiate token is not valid base64.",
+			"state":             happyState,
+		}
+
 		fositeAccessDeniedWithMissingUsernamePasswordHintErrorQuery = map[string]string{
 			"error":             "access_denied",
 			"error_description": "The resource owner or authorization server denied the request. Missing or blank username or password.",
@@ -175,6 +208,24 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			"state":             happyState,
 		}
 
+		fositeAccessDeniedWithGitHubPasswordGrantHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Resource owner password credentials grant is not supported by GitHub identity providers.",
+			"state":             happyState,
+		}
+
+		fositeAccessDeniedWithSAMLPasswordGrantHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Resource owner password credentials grant is not supported by SAML identity providers.",
+			"state":             happyState,
+		}
+
+		fositeAccessDeniedWithOAuth2PasswordGrantHintErrorQuery = map[string]string{
+			"error":             "access_denied",
+			"error_description": "The resource owner or authorization server denied the request. Resource owner password credentials grant is not supported by OAuth2 identity providers.",
+			"state":             happyState,
+		}
+
 		fositeAccessDeniedWithInvalidEmailVerifiedHintErrorQuery = map[string]string{
 			"error":             "access_denied",
 			"error_description": "The resource owner or authorization server denied the request. Reason: email_verified claim in upstream ID token has invalid format.",
@@ -243,6 +294,42 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			WithPasswordGrantError(errors.New("should not have used password grant on this instance"))
 	}
 
+	upstreamGitHubIdentityProvider := func() *oidctestutil.TestUpstreamGitHubIdentityProvider {
+		return &oidctestutil.TestUpstreamGitHubIdentityProvider{
+			Name:             gitHubUpstreamName,
+			ResourceUID:      gitHubUpstreamResourceUID,
+			ClientID:         "some-github-client-id",
+			AuthorizationURL: "https://github.com/login/oauth/authorize",
+			Scopes:           []string{"read:user", "read:org"},
+			ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, redirectURI string) (string, error) {
+				return "", errors.New("should not have exchanged an authcode during an authorization request")
+			},
+			GetUserFunc: func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+				return nil, errors.New("should not have looked up the user during an authorization request")
+			},
+		}
+	}
+
+	upstreamOAuth2IdentityProvider := func() *oidctestutil.TestUpstreamOAuth2IdentityProvider {
+		return &oidctestutil.TestUpstreamOAuth2IdentityProvider{
+			Name:                     oauth2UpstreamName,
+			ResourceUID:              oauth2UpstreamResourceUID,
+			ClientID:                 "some-oauth2-client-id",
+			AuthorizationURL:         "https://some-oauth2-idp.example.com/authorize",
+			Scopes:                   []string{"profile", "groups"},
+			AdditionalAuthcodeParams: map[string]string{"audience": "some-audience"},
+			ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, redirectURI string) (*oauth2.Token, error) {
+				return nil, errors.New("should not have exchanged an authcode during an authorization request")
+			},
+			PerformRefreshFunc: func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+				return nil, errors.New("should not have performed a refresh during an authorization request")
+			},
+			GetUserFunc: func(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+				return nil, errors.New("should not have looked up the user during an authorization request")
+			},
+		}
+	}
+
 	passwordGrantUpstreamOIDCIdentityProviderBuilder := func() *oidctestutil.TestUpstreamOIDCIdentityProviderBuilder {
 		return oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
 			WithName(oidcPasswordGrantUpstreamName).
@@ -318,6 +405,22 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		AuthenticateFunc: ldapAuthenticateFunc,
 	}
 
+	happyKerberosTicket := "happy-kerberos-ticket"
+	upstreamKerberosActiveDirectoryIdentityProvider := oidctestutil.TestUpstreamLDAPIdentityProvider{
+		Name:             activeDirectoryUpstreamName,
+		ResourceUID:      activeDirectoryUpstreamResourceUID,
+		URL:              parsedUpstreamLDAPURL,
+		AuthenticateFunc: ldapAuthenticateFunc,
+		AllowKerberos:    true,
+		KerberosAuthenticateFunc: func(ctx context.Context, negotiateToken []byte) (*authenticators.Response, bool, error) {
+			if string(negotiateToken) != happyKerberosTicket {
+				return nil, false, nil
+			}
+			// The Kerberos ticket identifies the same user as the happy username and password.
+			return ldapAuthenticateFunc(ctx, happyLDAPUsername, happyLDAPPassword)
+		},
+	}
+
 	erroringUpstreamLDAPIdentityProvider := oidctestutil.TestUpstreamLDAPIdentityProvider{
 		Name:        ldapUpstreamName,
 		ResourceUID: ldapUpstreamResourceUID,
@@ -409,6 +512,22 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		return pathWithQuery("/some/path", modifiedHappyGetRequestQueryMap(queryOverrides))
 	}
 
+	chooseIDPLoginURL := func(idpName, idpType string) string {
+		params := url.Values{}
+		for k, v := range happyGetRequestQueryMap {
+			params.Set(k, v)
+		}
+		params.Set("pinniped_idp_name", idpName)
+		params.Set("pinniped_idp_type", idpType)
+		return "?" + params.Encode()
+	}
+
+	expectedChooseIDPPageBody := func(idps ...chooseidphtml.IdentityProvider) string {
+		var b strings.Builder
+		require.NoError(t, chooseidphtml.Template(nil).Execute(&b, &chooseidphtml.PageData{IdentityProviders: idps}))
+		return b.String()
+	}
+
 	expectedUpstreamStateParam := func(queryOverrides map[string]string, csrfValueOverride, upstreamNameOverride string) string {
 		csrf := happyCSRF
 		if csrfValueOverride != "" {
@@ -449,6 +568,40 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		return urlWithQuery(upstreamAuthURL.String(), query)
 	}
 
+	expectedRedirectLocationForUpstreamGitHub := func(expectedUpstreamState string) string {
+		// GitHub does not support PKCE or nonces, so they are not sent.
+		return urlWithQuery("https://github.com/login/oauth/authorize", map[string]string{
+			"response_type": "code",
+			"scope":         "read:user read:org",
+			"client_id":     "some-github-client-id",
+			"state":         expectedUpstreamState,
+			"redirect_uri":  downstreamIssuer + "/callback",
+		})
+	}
+
+	expectedRedirectLocationForUpstreamSAML := func(expectedUpstreamState string) string {
+		// The test double encodes the SAML authentication request as a readable string. The ID of the request is
+		// derived from the nonce, and the state param is sent as the relay state.
+		return urlWithQuery("https://saml-idp.example.com/sso", map[string]string{
+			"SAMLRequest": "request-id:id-" + happyNonce + ",entity-id:" + downstreamIssuer + ",acs-url:" + downstreamIssuer + "/saml/acs",
+			"RelayState":  expectedUpstreamState,
+		})
+	}
+
+	expectedRedirectLocationForUpstreamOAuth2 := func(expectedUpstreamState string) string {
+		// Unlike OIDC, there is no nonce, but PKCE and the additional authcode params are sent.
+		return urlWithQuery("https://some-oauth2-idp.example.com/authorize", map[string]string{
+			"response_type":         "code",
+			"scope":                 "profile groups",
+			"client_id":             "some-oauth2-client-id",
+			"state":                 expectedUpstreamState,
+			"code_challenge":        expectedUpstreamCodeChallenge,
+			"code_challenge_method": downstreamPKCEChallengeMethod,
+			"redirect_uri":          downstreamIssuer + "/callback",
+			"audience":              "some-audience",
+		})
+	}
+
 	expectedHappyActiveDirectoryUpstreamCustomSession := &psession.CustomSessionData{
 		ProviderUID:  activeDirectoryUpstreamResourceUID,
 		ProviderName: activeDirectoryUpstreamName,
@@ -518,6 +671,8 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		csrfCookie           string
 		customUsernameHeader *string // nil means do not send header, empty means send header with empty value
 		customPasswordHeader *string // nil means do not send header, empty means send header with empty value
+		authorizationHeader  string
+		loginRejectedFor     time.Duration
 
 		wantStatus                             int
 		wantContentType                        string
@@ -527,6 +682,8 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		wantBodyStringWithLocationInHref       bool
 		wantLocationHeader                     string
 		wantUpstreamStateParamInLocationHeader bool
+		wantUpstreamStateParamName             string // the query param of the location which holds the upstream state param, defaults to "state"
+		wantCSRFCookieSameSite                 string // defaults to "Lax"
 
 		// Assertions for when an authcode should be returned, i.e. the request was authenticated by an
 		// upstream LDAP provider or an upstream OIDC password grant flow.
@@ -543,6 +700,9 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		wantUnnecessaryStoredRecords      int
 		wantPasswordGrantCall             *expectedPasswordGrant
 		wantDownstreamCustomSessionData   *psession.CustomSessionData
+
+		// Assertions for the failed password-based login attempts which should be recorded.
+		wantLoginFailure *loginattempts.Attempt
 	}
 	tests := []testCase{
 		{
@@ -626,6 +786,26 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
 			wantDownstreamCustomSessionData:   expectedHappyActiveDirectoryUpstreamCustomSession,
 		},
+		{
+			name:                              "ActiveDirectory upstream happy path using GET with a Kerberos ticket",
+			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamKerberosActiveDirectoryIdentityProvider),
+			method:                            http.MethodGet,
+			path:                              happyGetRequestPath,
+			authorizationHeader:               "Negotiate " + base64.StdEncoding.EncodeToString([]byte(happyKerberosTicket)),
+			wantStatus:                        http.StatusFound,
+			wantContentType:                   htmlContentType,
+			wantRedirectLocationRegexp:        happyAuthcodeDownstreamRedirectLocationRegexp,
+			wantDownstreamIDTokenSubject:      upstreamLDAPURL + "&sub=" + happyLDAPUID,
+			wantDownstreamIDTokenUsername:     happyLDAPUsernameFromAuthenticator,
+			wantDownstreamIDTokenGroups:       happyLDAPGroups,
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamRedirectURI:         downstreamRedirectURI,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData:   expectedHappyActiveDirectoryUpstreamCustomSession,
+		},
 		{
 			name:                                   "OIDC upstream browser flow happy path using GET with a CSRF cookie",
 			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()),
@@ -662,6 +842,152 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantLocationHeader:                     expectedRedirectLocationForUpstreamOIDC(expectedUpstreamStateParam(nil, "", ""), nil),
 			wantUpstreamStateParamInLocationHeader: true,
 		},
+		{
+			name:                                   "GitHub upstream browser flow happy path using GET without a CSRF cookie",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(upstreamGitHubIdentityProvider()),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   happyGetRequestPath,
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamGitHub(expectedUpstreamStateParam(nil, "", gitHubUpstreamName)),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantBodyStringWithLocationInHref:       true,
+		},
+		{
+			name:                                   "GitHub upstream browser flow happy path using GET with a CSRF cookie",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(upstreamGitHubIdentityProvider()),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   happyGetRequestPath,
+			csrfCookie:                             "__Host-pinniped-csrf=" + encodedIncomingCookieCSRFValue + " ",
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamGitHub(expectedUpstreamStateParam(nil, incomingCookieCSRFValue, gitHubUpstreamName)),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantBodyStringWithLocationInHref:       true,
+		},
+		{
+			name:                 "GitHub upstream does not support the custom username and password headers",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(upstreamGitHubIdentityProvider()),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.StringPtr("some-github-user"),
+			customPasswordHeader: pointer.StringPtr("some-password"),
+			wantStatus:           http.StatusFound,
+			wantContentType:      "application/json; charset=utf-8",
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithGitHubPasswordGrantHintErrorQuery),
+			wantBodyString:       "",
+		},
+		{
+			name:                                   "SAML upstream browser flow happy path using GET without a CSRF cookie",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{Name: samlUpstreamName, ResourceUID: samlUpstreamResourceUID}),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   happyGetRequestPath,
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantCSRFCookieSameSite:                 "None",
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamSAML(expectedUpstreamStateParam(nil, "", samlUpstreamName)),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantUpstreamStateParamName:             "RelayState",
+			wantBodyStringWithLocationInHref:       true,
+		},
+		{
+			// The SAML response is posted cross-site, so the CSRF cookie is written again with SameSite=None.
+			name:                                   "SAML upstream browser flow happy path using GET with a CSRF cookie",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{Name: samlUpstreamName, ResourceUID: samlUpstreamResourceUID}),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   happyGetRequestPath,
+			csrfCookie:                             "__Host-pinniped-csrf=" + encodedIncomingCookieCSRFValue + " ",
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantCSRFValueInCookieHeader:            incomingCookieCSRFValue,
+			wantCSRFCookieSameSite:                 "None",
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamSAML(expectedUpstreamStateParam(nil, incomingCookieCSRFValue, samlUpstreamName)),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantUpstreamStateParamName:             "RelayState",
+			wantBodyStringWithLocationInHref:       true,
+		},
+		{
+			name:                 "SAML upstream does not support the custom username and password headers",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{Name: samlUpstreamName, ResourceUID: samlUpstreamResourceUID}),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.StringPtr("some-saml-user"),
+			customPasswordHeader: pointer.StringPtr("some-password"),
+			wantStatus:           http.StatusFound,
+			wantContentType:      "application/json; charset=utf-8",
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithSAMLPasswordGrantHintErrorQuery),
+			wantBodyString:       "",
+		},
+		{
+			name:                                   "OAuth2 upstream browser flow happy path using GET without a CSRF cookie",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(upstreamOAuth2IdentityProvider()),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   happyGetRequestPath,
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamOAuth2(expectedUpstreamStateParam(nil, "", oauth2UpstreamName)),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantBodyStringWithLocationInHref:       true,
+		},
+		{
+			name:                                   "OAuth2 upstream browser flow happy path using POST with a CSRF cookie",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(upstreamOAuth2IdentityProvider()),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodPost,
+			path:                                   "/some/path",
+			contentType:                            "application/x-www-form-urlencoded",
+			body:                                   encodeQuery(happyGetRequestQueryMap),
+			csrfCookie:                             "__Host-pinniped-csrf=" + encodedIncomingCookieCSRFValue + " ",
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        "",
+			wantBodyString:                         "",
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamOAuth2(expectedUpstreamStateParam(nil, incomingCookieCSRFValue, oauth2UpstreamName)),
+			wantUpstreamStateParamInLocationHeader: true,
+		},
+		{
+			name:                 "OAuth2 upstream does not support the custom username and password headers",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(upstreamOAuth2IdentityProvider()),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.StringPtr("some-oauth2-user"),
+			customPasswordHeader: pointer.StringPtr("some-password"),
+			wantStatus:           http.StatusFound,
+			wantContentType:      "application/json; charset=utf-8",
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithOAuth2PasswordGrantHintErrorQuery),
+			wantBodyString:       "",
+		},
 		{
 			name:                              "OIDC upstream password grant happy path using POST",
 			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().Build()),
@@ -1013,6 +1339,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantContentType:    "application/json; charset=utf-8",
 			wantLocationHeader: urlWithQuery(downstreamRedirectURI, fositeAccessDeniedErrorQuery),
 			wantBodyString:     "",
+			wantLoginFailure:   &loginattempts.Attempt{IDPName: oidcPasswordGrantUpstreamName, IDPType: "oidc", Username: oidcUpstreamUsername, SourceIP: "192.0.2.1"},
 		},
 		{
 			name:                 "wrong upstream password for LDAP authentication",
@@ -1025,6 +1352,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantContentType:      "application/json; charset=utf-8",
 			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithBadUsernamePasswordHintErrorQuery),
 			wantBodyString:       "",
+			wantLoginFailure:     &loginattempts.Attempt{IDPName: ldapUpstreamName, IDPType: "ldap", Username: happyLDAPUsername, SourceIP: "192.0.2.1"},
 		},
 		{
 			name:                 "wrong upstream password for Active Directory authentication",
@@ -1037,6 +1365,66 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantContentType:      "application/json; charset=utf-8",
 			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithBadUsernamePasswordHintErrorQuery),
 			wantBodyString:       "",
+			wantLoginFailure:     &loginattempts.Attempt{IDPName: activeDirectoryUpstreamName, IDPType: "activedirectory", Username: happyLDAPUsername, SourceIP: "192.0.2.1"},
+		},
+		{
+			name:                 "too many failed login attempts for LDAP authentication",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.StringPtr(happyLDAPUsername),
+			customPasswordHeader: pointer.StringPtr(happyLDAPPassword),
+			loginRejectedFor:     1500 * time.Millisecond,
+			wantStatus:           http.StatusFound,
+			wantContentType:      "application/json; charset=utf-8",
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithTooManyFailedLoginAttemptsHintErrorQuery),
+			wantBodyString:       "",
+		},
+		{
+			name:                 "too many failed login attempts for OIDC password grant authentication",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(passwordGrantUpstreamOIDCIdentityProviderBuilder().Build()),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.StringPtr(oidcUpstreamUsername),
+			customPasswordHeader: pointer.StringPtr(oidcUpstreamPassword),
+			loginRejectedFor:     1500 * time.Millisecond,
+			wantStatus:           http.StatusFound,
+			wantContentType:      "application/json; charset=utf-8",
+			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithTooManyFailedLoginAttemptsHintErrorQuery),
+			wantBodyString:       "",
+		},
+		{
+			name:                "wrong Kerberos ticket for Active Directory authentication",
+			idps:                oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamKerberosActiveDirectoryIdentityProvider),
+			method:              http.MethodGet,
+			path:                happyGetRequestPath,
+			authorizationHeader: "Negotiate " + base64.StdEncoding.EncodeToString([]byte("wrong-kerberos-ticket")),
+			wantStatus:          http.StatusFound,
+			wantContentType:     "application/json; charset=utf-8",
+			wantLocationHeader:  urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithBadKerberosTicketHintErrorQuery),
+			wantBodyString:      "",
+		},
+		{
+			name:                "Kerberos ticket which is not valid base64 for Active Directory authentication",
+			idps:                oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamKerberosActiveDirectoryIdentityProvider),
+			method:              http.MethodGet,
+			path:                happyGetRequestPath,
+			authorizationHeader: "Negotiate not-base64!",
+			wantStatus:          http.StatusFound,
+			wantContentType:     "application/json; charset=utf-8",
+			wantLocationHeader:  urlWithQuery(downstreamRedirectURI, fositeInvalidNegotiateTokenErrorQuery),
+			wantBodyString:      "",
+		},
+		{
+			name:                "Kerberos ticket for Active Directory upstream which does not allow Kerberos",
+			idps:                oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
+			method:              http.MethodGet,
+			path:                happyGetRequestPath,
+			authorizationHeader: "Negotiate " + base64.StdEncoding.EncodeToString([]byte(happyKerberosTicket)),
+			wantStatus:          http.StatusFound,
+			wantContentType:     "application/json; charset=utf-8",
+			wantLocationHeader:  urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithKerberosDisallowedHintErrorQuery),
+			wantBodyString:      "",
 		},
 		{
 			name:                 "wrong upstream username for LDAP authentication",
@@ -1049,6 +1437,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantContentType:      "application/json; charset=utf-8",
 			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithBadUsernamePasswordHintErrorQuery),
 			wantBodyString:       "",
+			wantLoginFailure:     &loginattempts.Attempt{IDPName: ldapUpstreamName, IDPType: "ldap", Username: "wrong-username", SourceIP: "192.0.2.1"},
 		},
 		{
 			name:                 "wrong upstream username for Active Directory authentication",
@@ -1061,6 +1450,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantContentType:      "application/json; charset=utf-8",
 			wantLocationHeader:   urlWithQuery(downstreamRedirectURI, fositeAccessDeniedWithBadUsernamePasswordHintErrorQuery),
 			wantBodyString:       "",
+			wantLoginFailure:     &loginattempts.Attempt{IDPName: activeDirectoryUpstreamName, IDPType: "activedirectory", Username: "wrong-username", SourceIP: "192.0.2.1"},
 		},
 		{
 			name:                 "missing upstream username on request for LDAP authentication",
@@ -2308,49 +2698,104 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			wantBodyString:  "Unprocessable Entity: No upstream providers are configured\n",
 		},
 		{
-			name:            "too many upstream providers are configured: multiple OIDC",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build(), upstreamOIDCIdentityProviderBuilder().Build()), // more than one not allowed
+			name:            "multiple upstream providers are configured: shows a page for choosing between OIDC providers",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build(), upstreamOIDCIdentityProviderBuilder().WithName("some-other-oidc-idp").Build()),
 			method:          http.MethodGet,
 			path:            happyGetRequestPath,
-			wantStatus:      http.StatusUnprocessableEntity,
-			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantStatus:      http.StatusOK,
+			wantContentType: htmlContentType,
+			wantBodyString: expectedChooseIDPPageBody(
+				chooseidphtml.IdentityProvider{Name: "some-oidc-idp", Type: "oidc", LoginURL: chooseIDPLoginURL("some-oidc-idp", "oidc")},
+				chooseidphtml.IdentityProvider{Name: "some-other-oidc-idp", Type: "oidc", LoginURL: chooseIDPLoginURL("some-other-oidc-idp", "oidc")},
+			),
 		},
 		{
-			name:            "too many upstream providers are configured: multiple LDAP",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider), // more than one not allowed
+			name:            "multiple upstream providers are configured: shows providers which do not support browser logins as unavailable",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider),
 			method:          http.MethodGet,
 			path:            happyGetRequestPath,
-			wantStatus:      http.StatusUnprocessableEntity,
-			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantStatus:      http.StatusOK,
+			wantContentType: htmlContentType,
+			wantBodyString: expectedChooseIDPPageBody(
+				chooseidphtml.IdentityProvider{Name: "some-active-directory-idp", Type: "activedirectory"},
+				chooseidphtml.IdentityProvider{Name: "some-ldap-idp", Type: "ldap"},
+				chooseidphtml.IdentityProvider{Name: "some-oidc-idp", Type: "oidc", LoginURL: chooseIDPLoginURL("some-oidc-idp", "oidc")},
+			),
+		},
+		{
+			name:                 "multiple upstream providers are configured: does not show a page for choosing when the username and password headers are sent",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customUsernameHeader: pointer.StringPtr(happyLDAPUsername),
+			customPasswordHeader: pointer.StringPtr(happyLDAPPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers match the request (specify the pinniped_idp_name and pinniped_idp_type parameters)\n",
+		},
+		{
+			name:                 "multiple upstream providers are configured: does not show a page for choosing when only the password header is sent",
+			idps:                 oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method:               http.MethodGet,
+			path:                 happyGetRequestPath,
+			customPasswordHeader: pointer.StringPtr(happyLDAPPassword),
+			wantStatus:           http.StatusUnprocessableEntity,
+			wantContentType:      "text/plain; charset=utf-8",
+			wantBodyString:       "Unprocessable Entity: Too many upstream providers match the request (specify the pinniped_idp_name and pinniped_idp_type parameters)\n",
+		},
+		{
+			name:               "multiple upstream providers are configured: does not show a page for choosing when prompt=none",
+			idps:               oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			method:             http.MethodGet,
+			path:               modifiedHappyGetRequestPath(map[string]string{"prompt": "none"}),
+			wantStatus:         http.StatusSeeOther,
+			wantContentType:    "application/json; charset=utf-8",
+			wantLocationHeader: urlWithQuery(downstreamRedirectURI, fositeLoginRequiredErrorQuery),
+			wantBodyString:     "",
+		},
+		{
+			name:                                   "multiple upstream providers are configured: the provider is chosen using the name param",
+			idps:                                   oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
+			generateCSRF:                           happyCSRFGenerator,
+			generatePKCE:                           happyPKCEGenerator,
+			generateNonce:                          happyNonceGenerator,
+			stateEncoder:                           happyStateEncoder,
+			cookieEncoder:                          happyCookieEncoder,
+			method:                                 http.MethodGet,
+			path:                                   modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": oidcUpstreamName}),
+			wantStatus:                             http.StatusSeeOther,
+			wantContentType:                        htmlContentType,
+			wantCSRFValueInCookieHeader:            happyCSRF,
+			wantLocationHeader:                     expectedRedirectLocationForUpstreamOIDC(expectedUpstreamStateParam(map[string]string{"pinniped_idp_name": oidcUpstreamName}, "", ""), nil),
+			wantUpstreamStateParamInLocationHeader: true,
+			wantBodyStringWithLocationInHref:       true,
 		},
 		{
-			name:            "too many upstream providers are configured: multiple Active Directory",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&upstreamLDAPIdentityProvider, &upstreamLDAPIdentityProvider), // more than one not allowed
+			name:            "multiple upstream providers are configured: the requested name is not found",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
 			method:          http.MethodGet,
-			path:            happyGetRequestPath,
+			path:            modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": "does-not-exist"}),
 			wantStatus:      http.StatusUnprocessableEntity,
 			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantBodyString:  "Unprocessable Entity: Requested upstream provider was not found (name: \"does-not-exist\", type: \"\")\n",
 		},
 		{
-			name:            "too many upstream providers are configured: both OIDC and LDAP",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider), // more than one not allowed
+			name:            "multiple upstream providers are configured: the requested name and type are not found",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider),
 			method:          http.MethodGet,
-			path:            happyGetRequestPath,
+			path:            modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": oidcUpstreamName, "pinniped_idp_type": "ldap"}),
 			wantStatus:      http.StatusUnprocessableEntity,
 			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantBodyString:  "Unprocessable Entity: Requested upstream provider was not found (name: \"some-oidc-idp\", type: \"ldap\")\n",
 		},
 		{
-			name:            "too many upstream providers are configured: OIDC, LDAP and AD",
-			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()).WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamActiveDirectoryIdentityProvider), // more than one not allowed
+			name:            "multiple upstream providers are configured: the requested name matches providers of different types",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&upstreamLDAPIdentityProvider).WithActiveDirectory(&upstreamLDAPIdentityProvider),
 			method:          http.MethodGet,
-			path:            happyGetRequestPath,
+			path:            modifiedHappyGetRequestPath(map[string]string{"pinniped_idp_name": ldapUpstreamName}),
 			wantStatus:      http.StatusUnprocessableEntity,
 			wantContentType: "text/plain; charset=utf-8",
-			wantBodyString:  "Unprocessable Entity: Too many upstream providers are configured (support for multiple upstreams is not yet implemented)\n",
+			wantBodyString:  "Unprocessable Entity: Too many upstream providers match the request (specify the pinniped_idp_name and pinniped_idp_type parameters)\n",
 		},
 		{
 			name:            "PUT is a bad method",
@@ -2381,7 +2826,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		},
 	}
 
-	runOneTestCase := func(t *testing.T, test testCase, subject http.Handler, kubeOauthStore *oidc.KubeStorage, kubeClient *fake.Clientset, secretsClient v1.SecretInterface) {
+	runOneTestCase := func(t *testing.T, test testCase, subject http.Handler, loginLimiter *fakeLoginLimiter, kubeOauthStore *oidc.KubeStorage, kubeClient *fake.Clientset, secretsClient v1.SecretInterface) {
 		reqContext := context.WithValue(context.Background(), struct{ name string }{name: "test"}, "request-context")
 		req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body)).WithContext(reqContext)
 		req.Header.Set("Content-Type", test.contentType)
@@ -2394,6 +2839,9 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		if test.customPasswordHeader != nil {
 			req.Header.Set("Pinniped-Password", *test.customPasswordHeader)
 		}
+		if test.authorizationHeader != "" {
+			req.Header.Set("Authorization", test.authorizationHeader)
+		}
 		rsp := httptest.NewRecorder()
 		subject.ServeHTTP(rsp, req)
 		t.Logf("response: %#v", rsp)
@@ -2412,16 +2860,21 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			test.idps.RequireExactlyZeroCallsToPasswordCredentialsGrantAndValidateTokens(t)
 		}
 
+		upstreamStateParamName := "state"
+		if test.wantUpstreamStateParamName != "" {
+			upstreamStateParamName = test.wantUpstreamStateParamName
+		}
+
 		actualLocation := rsp.Header().Get("Location")
 		switch {
 		case test.wantLocationHeader != "":
 			if test.wantUpstreamStateParamInLocationHeader {
-				requireEqualDecodedStateParams(t, actualLocation, test.wantLocationHeader, test.stateEncoder)
+				requireEqualDecodedStateParams(t, actualLocation, test.wantLocationHeader, upstreamStateParamName, test.stateEncoder)
 			}
 			// The upstream state param is encoded using a timestamp at the beginning so we don't want to
 			// compare those states since they may be different, but we do want to compare the downstream
 			// state param that should be exactly the same.
-			requireEqualURLs(t, actualLocation, test.wantLocationHeader, test.wantUpstreamStateParamInLocationHeader)
+			requireEqualURLs(t, actualLocation, test.wantLocationHeader, test.wantUpstreamStateParamInLocationHeader, upstreamStateParamName)
 
 			// Authorization requests for either a successful OIDC upstream or for an error with any upstream
 			// should never use Kube storage. There is only one exception to this rule, which is that certain
@@ -2475,7 +2928,11 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		if test.wantCSRFValueInCookieHeader != "" {
 			require.Len(t, rsp.Header().Values("Set-Cookie"), 1)
 			actualCookie := rsp.Header().Get("Set-Cookie")
-			regex := regexp.MustCompile("__Host-pinniped-csrf=([^;]+); Path=/; HttpOnly; Secure; SameSite=Lax")
+			sameSite := "Lax"
+			if test.wantCSRFCookieSameSite != "" {
+				sameSite = test.wantCSRFCookieSameSite
+			}
+			regex := regexp.MustCompile("__Host-pinniped-csrf=([^;]+); Path=/; HttpOnly; Secure; SameSite=" + sameSite)
 			submatches := regex.FindStringSubmatch(actualCookie)
 			require.Len(t, submatches, 2)
 			captured := submatches[1]
@@ -2486,6 +2943,12 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		} else {
 			require.Empty(t, rsp.Header().Values("Set-Cookie"))
 		}
+
+		if test.wantLoginFailure != nil {
+			require.Equal(t, []loginattempts.Attempt{*test.wantLoginFailure}, loginLimiter.failures())
+		} else {
+			require.Empty(t, loginLimiter.failures())
+		}
 	}
 
 	for _, test := range tests {
@@ -2494,14 +2957,18 @@ func TestAuthorizationEndpoint(t *testing.T) {
 			kubeClient := fake.NewSimpleClientset()
 			secretsClient := kubeClient.CoreV1().Secrets("some-namespace")
 			oauthHelperWithRealStorage, kubeOauthStore := createOauthHelperWithRealStorage(secretsClient)
+			loginLimiter := &fakeLoginLimiter{rejectedFor: test.loginRejectedFor}
 			subject := NewHandler(
 				downstreamIssuer,
 				test.idps.Build(),
 				oauthHelperWithNullStorage, oauthHelperWithRealStorage,
 				test.generateCSRF, test.generatePKCE, test.generateNonce,
 				test.stateEncoder, test.cookieEncoder,
+				loginLimiter,
+				nil,
+				nil,
 			)
-			runOneTestCase(t, test, subject, kubeOauthStore, kubeClient, secretsClient)
+			runOneTestCase(t, test, subject, loginLimiter, kubeOauthStore, kubeClient, secretsClient)
 		})
 	}
 
@@ -2514,15 +2981,19 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		secretsClient := kubeClient.CoreV1().Secrets("some-namespace")
 		oauthHelperWithRealStorage, kubeOauthStore := createOauthHelperWithRealStorage(secretsClient)
 		idpLister := test.idps.Build()
+		loginLimiter := &fakeLoginLimiter{}
 		subject := NewHandler(
 			downstreamIssuer,
 			idpLister,
 			oauthHelperWithNullStorage, oauthHelperWithRealStorage,
 			test.generateCSRF, test.generatePKCE, test.generateNonce,
 			test.stateEncoder, test.cookieEncoder,
+			loginLimiter,
+			nil,
+			nil,
 		)
 
-		runOneTestCase(t, test, subject, kubeOauthStore, kubeClient, secretsClient)
+		runOneTestCase(t, test, subject, loginLimiter, kubeOauthStore, kubeClient, secretsClient)
 
 		// Call the idpLister's setter to change the upstream IDP settings.
 		newProviderSettings := oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
@@ -2560,7 +3031,7 @@ func TestAuthorizationEndpoint(t *testing.T) {
 		// modified expectations. This should ensure that the implementation is using the in-memory cache
 		// of upstream IDP settings appropriately in terms of always getting the values from the cache
 		// on every request.
-		runOneTestCase(t, test, subject, kubeOauthStore, kubeClient, secretsClient)
+		runOneTestCase(t, test, subject, loginLimiter, kubeOauthStore, kubeClient, secretsClient)
 	})
 }
 
@@ -2572,25 +3043,62 @@ func (*errorReturningEncoder) Encode(_ string, _ interface{}) (string, error) {
 	return "", fmt.Errorf("some encoding error")
 }
 
+// fakeLoginLimiter rejects every attempt for rejectedFor, and remembers which reservations failed.
+type fakeLoginLimiter struct {
+	rejectedFor  time.Duration
+	reservations []*fakeLoginReservation
+}
+
+func (l *fakeLoginLimiter) Reserve(_ context.Context, attempt loginattempts.Attempt) (loginattempts.Reservation, time.Duration) {
+	if l.rejectedFor > 0 {
+		return nil, l.rejectedFor
+	}
+	reservation := &fakeLoginReservation{attempt: attempt}
+	l.reservations = append(l.reservations, reservation)
+	return reservation, 0
+}
+
+// failures returns the attempts which counted as failures.
+func (l *fakeLoginLimiter) failures() []loginattempts.Attempt {
+	var failures []loginattempts.Attempt
+	for _, reservation := range l.reservations {
+		if reservation.failed {
+			failures = append(failures, reservation.attempt)
+		}
+	}
+	return failures
+}
+
+type fakeLoginReservation struct {
+	attempt loginattempts.Attempt
+	failed  bool
+}
+
+func (r *fakeLoginReservation) Succeeded(_ context.Context) {}
+
+func (r *fakeLoginReservation) Failed(_ context.Context) { r.failed = true }
+
+func (r *fakeLoginReservation) Release(_ context.Context) {}
+
 type expectedPasswordGrant struct {
 	performedByUpstreamName string
 	args                    *oidctestutil.PasswordCredentialsGrantAndValidateTokensArgs
 }
 
-func requireEqualDecodedStateParams(t *testing.T, actualURL string, expectedURL string, stateParamDecoder oidc.Codec) {
+func requireEqualDecodedStateParams(t *testing.T, actualURL string, expectedURL string, stateParamName string, stateParamDecoder oidc.Codec) {
 	t.Helper()
 	actualLocationURL, err := url.Parse(actualURL)
 	require.NoError(t, err)
 	expectedLocationURL, err := url.Parse(expectedURL)
 	require.NoError(t, err)
 
-	expectedQueryStateParam := expectedLocationURL.Query().Get("state")
+	expectedQueryStateParam := expectedLocationURL.Query().Get(stateParamName)
 	require.NotEmpty(t, expectedQueryStateParam)
 	var expectedDecodedStateParam oidctestutil.ExpectedUpstreamStateParamFormat
 	err = stateParamDecoder.Decode("s", expectedQueryStateParam, &expectedDecodedStateParam)
 	require.NoError(t, err)
 
-	actualQueryStateParam := actualLocationURL.Query().Get("state")
+	actualQueryStateParam := actualLocationURL.Query().Get(stateParamName)
 	require.NotEmpty(t, actualQueryStateParam)
 	var actualDecodedStateParam oidctestutil.ExpectedUpstreamStateParamFormat
 	err = stateParamDecoder.Decode("s", actualQueryStateParam, &actualDecodedStateParam)
@@ -2599,7 +3107,7 @@ func requireEqualDecodedStateParams(t *testing.T, actualURL string, expectedURL
 	require.Equal(t, expectedDecodedStateParam, actualDecodedStateParam)
 }
 
-func requireEqualURLs(t *testing.T, actualURL string, expectedURL string, ignoreState bool) {
+func requireEqualURLs(t *testing.T, actualURL string, expectedURL string, ignoreState bool, stateParamName string) {
 	t.Helper()
 	actualLocationURL, err := url.Parse(actualURL)
 	require.NoError(t, err)
@@ -2625,8 +3133,8 @@ func requireEqualURLs(t *testing.T, actualURL string, expectedURL string, ignore
 	// Let the caller ignore the state, since it may contain a digest at the end that is difficult to
 	// predict because it depends on a time.Now() timestamp.
 	if ignoreState {
-		expectedLocationQuery.Del("state")
-		actualLocationQuery.Del("state")
+		expectedLocationQuery.Del(stateParamName)
+		actualLocationQuery.Del(stateParamName)
 	}
 	require.Equal(t, expectedLocationQuery, actualLocationQuery)
 }
@@ -6,6 +6,7 @@ package callback
 
 import (
 	"crypto/subtle"
+	"errors"
 	"net/http"
 	"net/url"
 
@@ -17,15 +18,20 @@ import (
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/downstreamsession"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/errorhtml"
 	"go.pinniped.dev/internal/oidc/provider/formposthtml"
 	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/upstreamgithub"
 )
 
 func NewHandler(
-	upstreamIDPs oidc.UpstreamOIDCIdentityProvidersLister,
+	upstreamIDPs oidc.UpstreamIdentityProvidersLister,
 	oauthHelper fosite.OAuth2Provider,
 	stateDecoder, cookieDecoder oidc.Decoder,
 	redirectURI string,
+	brand *branding.Branding,
 ) http.Handler {
 	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
 		state, err := validateRequest(r, stateDecoder, cookieDecoder)
@@ -34,7 +40,9 @@ func NewHandler(
 		}
 
 		upstreamIDPConfig := findUpstreamIDPConfig(state.UpstreamName, upstreamIDPs)
-		if upstreamIDPConfig == nil {
+		gitHubIDPConfig := findUpstreamGitHubIDPConfig(state.UpstreamName, upstreamIDPs)
+		oauth2IDPConfig := findUpstreamOAuth2IDPConfig(state.UpstreamName, upstreamIDPs)
+		if upstreamIDPConfig == nil && gitHubIDPConfig == nil && oauth2IDPConfig == nil {
 			plog.Warning("upstream provider not found")
 			return httperr.New(http.StatusUnprocessableEntity, "upstream provider not found")
 		}
@@ -56,6 +64,34 @@ func NewHandler(
 		// Automatically grant the openid, offline_access, and pinniped:request-audience scopes, but only if they were requested.
 		downstreamsession.GrantScopesIfRequested(authorizeRequester)
 
+		if gitHubIDPConfig != nil {
+			openIDSession, err := makeDownstreamSessionForGitHub(r, gitHubIDPConfig, redirectURI)
+			if err != nil {
+				return err
+			}
+			authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
+			if err != nil {
+				plog.WarningErr("error while generating and saving authcode", err, "upstreamName", gitHubIDPConfig.GetName())
+				return httperr.Wrap(http.StatusInternalServerError, "error while generating and saving authcode", err)
+			}
+			oauthHelper.WriteAuthorizeResponse(w, authorizeRequester, authorizeResponder)
+			return nil
+		}
+
+		if oauth2IDPConfig != nil {
+			openIDSession, err := makeDownstreamSessionForOAuth2(r, oauth2IDPConfig, state, redirectURI)
+			if err != nil {
+				return err
+			}
+			authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
+			if err != nil {
+				plog.WarningErr("error while generating and saving authcode", err, "upstreamName", oauth2IDPConfig.GetName())
+				return httperr.Wrap(http.StatusInternalServerError, "error while generating and saving authcode", err)
+			}
+			oauthHelper.WriteAuthorizeResponse(w, authorizeRequester, authorizeResponder)
+			return nil
+		}
+
 		token, err := upstreamIDPConfig.ExchangeAuthcodeAndValidateTokens(
 			r.Context(),
 			authcode(r),
@@ -90,7 +126,69 @@ func NewHandler(
 
 		return nil
 	})
-	return securityheader.WrapWithCustomCSP(handler, formposthtml.ContentSecurityPolicy())
+	return securityheader.WrapWithCustomCSP(handler.WithErrorPage(errorhtml.NewPageWriter(brand)), formposthtml.ContentSecurityPolicy(brand))
+}
+
+func makeDownstreamSessionForGitHub(
+	r *http.Request,
+	gitHubIDPConfig provider.UpstreamGitHubIdentityProviderI,
+	redirectURI string,
+) (*psession.PinnipedSession, error) {
+	accessToken, err := gitHubIDPConfig.ExchangeAuthcode(r.Context(), authcode(r), redirectURI)
+	if err != nil {
+		plog.WarningErr("error exchanging upstream authcode", err, "upstreamName", gitHubIDPConfig.GetName())
+		return nil, httperr.New(http.StatusBadGateway, "error exchanging upstream authcode")
+	}
+
+	user, err := gitHubIDPConfig.GetUser(r.Context(), accessToken)
+	if errors.Is(err, upstreamgithub.ErrUserNotAllowed) {
+		plog.InfoErr("user is not allowed to log in", err, "upstreamName", gitHubIDPConfig.GetName())
+		return nil, httperr.Wrap(http.StatusForbidden, err.Error(), err)
+	}
+	if err != nil {
+		plog.WarningErr("error fetching upstream user", err, "upstreamName", gitHubIDPConfig.GetName())
+		return nil, httperr.New(http.StatusBadGateway, "error fetching upstream user")
+	}
+
+	customSessionData := &psession.CustomSessionData{
+		ProviderUID:  gitHubIDPConfig.GetResourceUID(),
+		ProviderName: gitHubIDPConfig.GetName(),
+		ProviderType: psession.ProviderTypeGitHub,
+		GitHub:       &psession.GitHubSessionData{UpstreamAccessToken: accessToken},
+	}
+	return downstreamsession.MakeDownstreamSession(user.DownstreamSubject, user.Username, user.Groups, customSessionData), nil
+}
+
+func makeDownstreamSessionForOAuth2(
+	r *http.Request,
+	oauth2IDPConfig provider.UpstreamOAuth2IdentityProviderI,
+	state *oidc.UpstreamStateParamData,
+	redirectURI string,
+) (*psession.PinnipedSession, error) {
+	token, err := oauth2IDPConfig.ExchangeAuthcode(r.Context(), authcode(r), state.PKCECode, redirectURI)
+	if err != nil {
+		plog.WarningErr("error exchanging upstream authcode", err, "upstreamName", oauth2IDPConfig.GetName())
+		return nil, httperr.New(http.StatusBadGateway, "error exchanging upstream authcode")
+	}
+
+	user, err := oauth2IDPConfig.GetUser(r.Context(), token.AccessToken)
+	if err != nil {
+		plog.WarningErr("error fetching upstream user", err, "upstreamName", oauth2IDPConfig.GetName())
+		return nil, httperr.New(http.StatusBadGateway, "error fetching upstream user")
+	}
+
+	// Like for OIDC upstreams, only store the access token when there is no refresh token.
+	sessionData := &psession.OAuth2SessionData{UpstreamRefreshToken: token.RefreshToken}
+	if token.RefreshToken == "" {
+		sessionData.UpstreamAccessToken = token.AccessToken
+	}
+	customSessionData := &psession.CustomSessionData{
+		ProviderUID:  oauth2IDPConfig.GetResourceUID(),
+		ProviderName: oauth2IDPConfig.GetName(),
+		ProviderType: psession.ProviderTypeOAuth2,
+		OAuth2:       sessionData,
+	}
+	return downstreamsession.MakeDownstreamSession(user.DownstreamSubject, user.Username, user.Groups, customSessionData), nil
 }
 
 func authcode(r *http.Request) string {
@@ -118,7 +216,7 @@ func validateRequest(r *http.Request, stateDecoder, cookieDecoder oidc.Decoder)
 		return nil, httperr.New(http.StatusBadRequest, "state param not found")
 	}
 
-	state, err := readState(r, stateDecoder)
+	state, err := readState(r.FormValue("state"), stateDecoder)
 	if err != nil {
 		plog.InfoErr("error reading state", err)
 		return nil, err
@@ -141,6 +239,24 @@ func findUpstreamIDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamOIDCId
 	return nil
 }
 
+func findUpstreamGitHubIDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamGitHubIdentityProvidersLister) provider.UpstreamGitHubIdentityProviderI {
+	for _, p := range upstreamIDPs.GetGitHubIdentityProviders() {
+		if p.GetName() == upstreamName {
+			return p
+		}
+	}
+	return nil
+}
+
+func findUpstreamOAuth2IDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamOAuth2IdentityProvidersLister) provider.UpstreamOAuth2IdentityProviderI {
+	for _, p := range upstreamIDPs.GetOAuth2IdentityProviders() {
+		if p.GetName() == upstreamName {
+			return p
+		}
+	}
+	return nil
+}
+
 func readCSRFCookie(r *http.Request, cookieDecoder oidc.Decoder) (csrftoken.CSRFToken, error) {
 	receivedCSRFCookie, err := r.Cookie(oidc.CSRFCookieName)
 	if err != nil {
@@ -157,11 +273,11 @@ func readCSRFCookie(r *http.Request, cookieDecoder oidc.Decoder) (csrftoken.CSRF
 	return csrfFromCookie, nil
 }
 
-func readState(r *http.Request, stateDecoder oidc.Decoder) (*oidc.UpstreamStateParamData, error) {
+func readState(encodedState string, stateDecoder oidc.Decoder) (*oidc.UpstreamStateParamData, error) {
 	var state oidc.UpstreamStateParamData
 	if err := stateDecoder.Decode(
 		oidc.UpstreamStateParamEncodingName,
-		r.FormValue("state"),
+		encodedState,
 		&state,
 	); err != nil {
 		return nil, httperr.New(http.StatusBadRequest, "error reading state")
@@ -15,14 +15,18 @@ import (
 
 	"github.com/gorilla/securecookie"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/errorhtml"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
+	"go.pinniped.dev/internal/upstreamgithub"
 	"go.pinniped.dev/pkg/oidcclient/nonce"
 	oidcpkce "go.pinniped.dev/pkg/oidcclient/pkce"
 )
@@ -38,6 +42,15 @@ const (
 	oidcUpstreamSubjectQueryEscaped = "abc123-some+guid"
 	oidcUpstreamUsername            = "test-pinniped-username"
 
+	gitHubUpstreamAccessToken = "test-github-access-token"
+	gitHubUpstreamUsername    = "test-github-login"
+	gitHubUpstreamSubject     = "https://github.com?id=1234"
+
+	oauth2UpstreamAccessToken  = "test-oauth2-access-token"
+	oauth2UpstreamRefreshToken = "test-oauth2-refresh-token"
+	oauth2UpstreamUsername     = "test-oauth2-username"
+	oauth2UpstreamSubject      = "https://oauth2.example.com/profile?sub=5678"
+
 	oidcUpstreamUsernameClaim = "the-user-claim"
 	oidcUpstreamGroupsClaim   = "the-groups-claim"
 
@@ -62,6 +75,8 @@ const (
 
 var (
 	oidcUpstreamGroupMembership    = []string{"test-pinniped-group-0", "test-pinniped-group-1"}
+	gitHubUpstreamGroupMembership  = []string{"test-org/test-team"}
+	oauth2UpstreamGroupMembership  = []string{"test-oauth2-group-0", "test-oauth2-group-1"}
 	happyDownstreamScopesRequested = []string{"openid"}
 	happyDownstreamScopesGranted   = []string{"openid"}
 
@@ -132,9 +147,26 @@ func TestCallbackEndpoint(t *testing.T) {
 		RedirectURI:          happyUpstreamRedirectURI,
 	}
 
+	happyGitHubExchangeAuthcodeArgs := &oidctestutil.ExchangeAuthcodeArgs{
+		Authcode:    happyUpstreamAuthcode,
+		RedirectURI: happyUpstreamRedirectURI,
+	}
+
+	happyOAuth2ExchangeAuthcodeArgs := &oidctestutil.ExchangeAuthcodeArgs{
+		Authcode:         happyUpstreamAuthcode,
+		PKCECodeVerifier: oidcpkce.Code(happyDownstreamPKCE),
+		RedirectURI:      happyUpstreamRedirectURI,
+	}
+
 	// Note that fosite puts the granted scopes as a param in the redirect URI even though the spec doesn't seem to require it
 	happyDownstreamRedirectLocationRegexp := downstreamRedirectURI + `\?code=([^&]+)&scope=openid&state=` + happyDownstreamState
 
+	expectedErrorPage := func(msg string) string {
+		var b strings.Builder
+		require.NoError(t, errorhtml.Template(nil).Execute(&b, &errorhtml.PageData{Message: msg}))
+		return b.String()
+	}
+
 	tests := []struct {
 		name string
 
@@ -142,6 +174,7 @@ func TestCallbackEndpoint(t *testing.T) {
 		method     string
 		path       string
 		csrfCookie string
+		accept     string
 
 		wantStatus                        int
 		wantContentType                   string
@@ -158,7 +191,8 @@ func TestCallbackEndpoint(t *testing.T) {
 		wantDownstreamPKCEChallengeMethod string
 		wantDownstreamCustomSessionData   *psession.CustomSessionData
 
-		wantAuthcodeExchangeCall *expectedAuthcodeExchange
+		wantAuthcodeExchangeCall         *expectedAuthcodeExchange
+		wantUpstreamAuthcodeExchangeCall *expectedUpstreamAuthcodeExchange
 	}{
 		{
 			name:   "GET with good state and cookie and successful upstream token exchange with response_mode=form_post returns 200 with HTML+JS form",
@@ -556,6 +590,184 @@ func TestCallbackEndpoint(t *testing.T) {
 		},
 
 		// Pre-upstream-exchange verification
+		{
+			name:                              "GitHub upstream: GET with good state and cookie and successful upstream authcode exchange returns 303 to downstream client callback with its state and code",
+			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(happyGitHubUpstream()),
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyState).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      gitHubUpstreamSubject,
+			wantDownstreamIDTokenUsername:     gitHubUpstreamUsername,
+			wantDownstreamIDTokenGroups:       gitHubUpstreamGroupMembership,
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData: &psession.CustomSessionData{
+				ProviderUID:  happyUpstreamIDPResourceUID,
+				ProviderName: happyUpstreamIDPName,
+				ProviderType: psession.ProviderTypeGitHub,
+				GitHub:       &psession.GitHubSessionData{UpstreamAccessToken: gitHubUpstreamAccessToken},
+			},
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyGitHubExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name: "GitHub upstream: user is not a member of any of the allowed organizations",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(
+				happyGitHubUpstreamWithGetUserFunc(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return nil, upstreamgithub.ErrUserNotAllowed
+				}),
+			),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusForbidden,
+			wantBody:        "Forbidden: user is not a member of any of the allowed organizations\n",
+			wantContentType: htmlContentType,
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyGitHubExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name: "GitHub upstream: looking up the user fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(
+				happyGitHubUpstreamWithGetUserFunc(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return nil, errors.New("some error")
+				}),
+			),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadGateway,
+			wantBody:        "Bad Gateway: error fetching upstream user\n",
+			wantContentType: htmlContentType,
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyGitHubExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name: "GitHub upstream: authcode exchange fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(&oidctestutil.TestUpstreamGitHubIdentityProvider{
+				Name:        happyUpstreamIDPName,
+				ResourceUID: happyUpstreamIDPResourceUID,
+				ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, redirectURI string) (string, error) {
+					return "", errors.New("some error")
+				},
+			}),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadGateway,
+			wantBody:        "Bad Gateway: error exchanging upstream authcode\n",
+			wantContentType: htmlContentType,
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyGitHubExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name:                              "OAuth2 upstream: GET with good state and cookie and successful upstream authcode exchange returns 303 to downstream client callback with its state and code",
+			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(happyOAuth2Upstream(oauth2UpstreamRefreshToken)),
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyState).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      oauth2UpstreamSubject,
+			wantDownstreamIDTokenUsername:     oauth2UpstreamUsername,
+			wantDownstreamIDTokenGroups:       oauth2UpstreamGroupMembership,
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData: &psession.CustomSessionData{
+				ProviderUID:  happyUpstreamIDPResourceUID,
+				ProviderName: happyUpstreamIDPName,
+				ProviderType: psession.ProviderTypeOAuth2,
+				OAuth2:       &psession.OAuth2SessionData{UpstreamRefreshToken: oauth2UpstreamRefreshToken},
+			},
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyOAuth2ExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name:                              "OAuth2 upstream: authcode exchange that returns an access token but no refresh token stores the access token",
+			idps:                              oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(happyOAuth2Upstream("")),
+			method:                            http.MethodGet,
+			path:                              newRequestPath().WithState(happyState).String(),
+			csrfCookie:                        happyCSRFCookie,
+			wantStatus:                        http.StatusSeeOther,
+			wantRedirectLocationRegexp:        happyDownstreamRedirectLocationRegexp,
+			wantBody:                          "",
+			wantDownstreamIDTokenSubject:      oauth2UpstreamSubject,
+			wantDownstreamIDTokenUsername:     oauth2UpstreamUsername,
+			wantDownstreamIDTokenGroups:       oauth2UpstreamGroupMembership,
+			wantDownstreamRequestedScopes:     happyDownstreamScopesRequested,
+			wantDownstreamGrantedScopes:       happyDownstreamScopesGranted,
+			wantDownstreamNonce:               downstreamNonce,
+			wantDownstreamPKCEChallenge:       downstreamPKCEChallenge,
+			wantDownstreamPKCEChallengeMethod: downstreamPKCEChallengeMethod,
+			wantDownstreamCustomSessionData: &psession.CustomSessionData{
+				ProviderUID:  happyUpstreamIDPResourceUID,
+				ProviderName: happyUpstreamIDPName,
+				ProviderType: psession.ProviderTypeOAuth2,
+				OAuth2:       &psession.OAuth2SessionData{UpstreamAccessToken: oauth2UpstreamAccessToken},
+			},
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyOAuth2ExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name: "OAuth2 upstream: looking up the user's profile fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(
+				happyOAuth2UpstreamWithGetUserFunc(oauth2UpstreamRefreshToken, func(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+					return nil, errors.New("some error")
+				}),
+			),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadGateway,
+			wantBody:        "Bad Gateway: error fetching upstream user\n",
+			wantContentType: htmlContentType,
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyOAuth2ExchangeAuthcodeArgs,
+			},
+		},
+		{
+			name: "OAuth2 upstream: authcode exchange fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(&oidctestutil.TestUpstreamOAuth2IdentityProvider{
+				Name:        happyUpstreamIDPName,
+				ResourceUID: happyUpstreamIDPResourceUID,
+				ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, pkceCodeVerifier oidcpkce.Code, redirectURI string) (*oauth2.Token, error) {
+					return nil, errors.New("some error")
+				},
+			}),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithState(happyState).String(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadGateway,
+			wantBody:        "Bad Gateway: error exchanging upstream authcode\n",
+			wantContentType: htmlContentType,
+			wantUpstreamAuthcodeExchangeCall: &expectedUpstreamAuthcodeExchange{
+				performedByUpstreamName: happyUpstreamIDPName,
+				args:                    happyOAuth2ExchangeAuthcodeArgs,
+			},
+		},
 		{
 			name:            "PUT method is invalid",
 			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
@@ -612,6 +824,17 @@ func TestCallbackEndpoint(t *testing.T) {
 			wantContentType: htmlContentType,
 			wantBody:        "Bad Request: state param not found\n",
 		},
+		{
+			name:            "state param was not included on request from a web browser",
+			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
+			method:          http.MethodGet,
+			path:            newRequestPath().WithoutState().String(),
+			csrfCookie:      happyCSRFCookie,
+			accept:          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        expectedErrorPage("Bad Request: state param not found"),
+		},
 		{
 			name:            "state param was not signed correctly, has expired, or otherwise cannot be decoded for any reason",
 			idps:            oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(happyUpstream().Build()),
@@ -1023,12 +1246,15 @@ func TestCallbackEndpoint(t *testing.T) {
 			jwksProviderIsUnused := jwks.NewDynamicJWKSProvider()
 			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, jwksProviderIsUnused, timeoutsConfiguration)
 
-			subject := NewHandler(test.idps.Build(), oauthHelper, happyStateCodec, happyCookieCodec, happyUpstreamRedirectURI)
+			subject := NewHandler(test.idps.Build(), oauthHelper, happyStateCodec, happyCookieCodec, happyUpstreamRedirectURI, nil)
 			reqContext := context.WithValue(context.Background(), struct{ name string }{name: "test"}, "request-context")
 			req := httptest.NewRequest(test.method, test.path, nil).WithContext(reqContext)
 			if test.csrfCookie != "" {
 				req.Header.Set("Cookie", test.csrfCookie)
 			}
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
 			rsp := httptest.NewRecorder()
 			subject.ServeHTTP(rsp, req)
 			t.Logf("response: %#v", rsp)
@@ -1045,6 +1271,15 @@ func TestCallbackEndpoint(t *testing.T) {
 				test.idps.RequireExactlyZeroCallsToExchangeAuthcodeAndValidateTokens(t)
 			}
 
+			if test.wantUpstreamAuthcodeExchangeCall != nil {
+				test.wantUpstreamAuthcodeExchangeCall.args.Ctx = reqContext
+				test.idps.RequireExactlyOneCallToExchangeAuthcode(t,
+					test.wantUpstreamAuthcodeExchangeCall.performedByUpstreamName, test.wantUpstreamAuthcodeExchangeCall.args,
+				)
+			} else {
+				test.idps.RequireExactlyZeroCallsToExchangeAuthcode(t)
+			}
+
 			require.Equal(t, test.wantStatus, rsp.Code)
 			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), test.wantContentType)
 
@@ -1111,6 +1346,11 @@ type expectedAuthcodeExchange struct {
 	args                    *oidctestutil.ExchangeAuthcodeAndValidateTokenArgs
 }
 
+type expectedUpstreamAuthcodeExchange struct {
+	performedByUpstreamName string
+	args                    *oidctestutil.ExchangeAuthcodeArgs
+}
+
 type requestPath struct {
 	code, state *string
 }
@@ -1218,6 +1458,58 @@ func happyUpstream() *oidctestutil.TestUpstreamOIDCIdentityProviderBuilder {
 		WithPasswordGrantError(errors.New("the callback endpoint should not use password grants"))
 }
 
+func happyGitHubUpstream() *oidctestutil.TestUpstreamGitHubIdentityProvider {
+	return happyGitHubUpstreamWithGetUserFunc(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+		if accessToken != gitHubUpstreamAccessToken {
+			return nil, errors.New("unexpected access token")
+		}
+		return &provider.GitHubUser{
+			Username:          gitHubUpstreamUsername,
+			Groups:            gitHubUpstreamGroupMembership,
+			DownstreamSubject: gitHubUpstreamSubject,
+		}, nil
+	})
+}
+
+func happyGitHubUpstreamWithGetUserFunc(getUserFunc func(ctx context.Context, accessToken string) (*provider.GitHubUser, error)) *oidctestutil.TestUpstreamGitHubIdentityProvider {
+	return &oidctestutil.TestUpstreamGitHubIdentityProvider{
+		Name:        happyUpstreamIDPName,
+		ResourceUID: happyUpstreamIDPResourceUID,
+		ClientID:    "some-github-client-id",
+		Scopes:      []string{"read:user", "read:org"},
+		ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, redirectURI string) (string, error) {
+			return gitHubUpstreamAccessToken, nil
+		},
+		GetUserFunc: getUserFunc,
+	}
+}
+
+func happyOAuth2Upstream(refreshToken string) *oidctestutil.TestUpstreamOAuth2IdentityProvider {
+	return happyOAuth2UpstreamWithGetUserFunc(refreshToken, func(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+		if accessToken != oauth2UpstreamAccessToken {
+			return nil, errors.New("unexpected access token")
+		}
+		return &provider.OAuth2User{
+			Username:          oauth2UpstreamUsername,
+			Groups:            oauth2UpstreamGroupMembership,
+			DownstreamSubject: oauth2UpstreamSubject,
+		}, nil
+	})
+}
+
+func happyOAuth2UpstreamWithGetUserFunc(refreshToken string, getUserFunc func(ctx context.Context, accessToken string) (*provider.OAuth2User, error)) *oidctestutil.TestUpstreamOAuth2IdentityProvider {
+	return &oidctestutil.TestUpstreamOAuth2IdentityProvider{
+		Name:        happyUpstreamIDPName,
+		ResourceUID: happyUpstreamIDPResourceUID,
+		ClientID:    "some-oauth2-client-id",
+		Scopes:      []string{"profile", "groups"},
+		ExchangeAuthcodeFunc: func(ctx context.Context, authcode string, pkceCodeVerifier oidcpkce.Code, redirectURI string) (*oauth2.Token, error) {
+			return &oauth2.Token{AccessToken: oauth2UpstreamAccessToken, RefreshToken: refreshToken}, nil
+		},
+		GetUserFunc: getUserFunc,
+	}
+}
+
 func shallowCopyAndModifyQuery(query url.Values, modifications map[string]string) url.Values {
 	copied := url.Values{}
 	for key, value := range query {
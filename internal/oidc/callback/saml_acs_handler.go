@@ -0,0 +1,134 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package callback
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+
+	"github.com/ory/fosite"
+
+	"go.pinniped.dev/internal/httputil/httperr"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/provider/errorhtml"
+	"go.pinniped.dev/internal/oidc/provider/formposthtml"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
+)
+
+// NewSAMLACSHandler returns a handler for the SAML assertion consumer service endpoint, which receives the SAML
+// responses of upstream SAML identity providers using the HTTP-POST binding. It plays the same role for SAML
+// identity providers that the callback endpoint plays for OIDC and GitHub identity providers.
+func NewSAMLACSHandler(
+	upstreamIDPs oidc.UpstreamSAMLIdentityProvidersLister,
+	oauthHelper fosite.OAuth2Provider,
+	stateDecoder, cookieDecoder oidc.Decoder,
+	downstreamIssuer string,
+	brand *branding.Branding,
+) http.Handler {
+	handler := httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		state, err := validateSAMLACSRequest(r, stateDecoder, cookieDecoder)
+		if err != nil {
+			return err
+		}
+
+		samlIDPConfig := findUpstreamSAMLIDPConfig(state.UpstreamName, upstreamIDPs)
+		if samlIDPConfig == nil {
+			plog.Warning("upstream provider not found")
+			return httperr.New(http.StatusUnprocessableEntity, "upstream provider not found")
+		}
+
+		downstreamAuthParams, err := url.ParseQuery(state.AuthParams)
+		if err != nil {
+			plog.Error("error reading state downstream auth params", err)
+			return httperr.New(http.StatusBadRequest, "error reading state downstream auth params")
+		}
+
+		// Recreate enough of the original authorize request so we can pass it to NewAuthorizeRequest().
+		reconstitutedAuthRequest := &http.Request{Form: downstreamAuthParams}
+		authorizeRequester, err := oauthHelper.NewAuthorizeRequest(r.Context(), reconstitutedAuthRequest)
+		if err != nil {
+			plog.Error("error using state downstream auth params", err)
+			return httperr.New(http.StatusBadRequest, "error using state downstream auth params")
+		}
+
+		// Automatically grant the openid, offline_access, and pinniped:request-audience scopes, but only if they were requested.
+		downstreamsession.GrantScopesIfRequested(authorizeRequester)
+
+		user, err := samlIDPConfig.ParseResponse(r, oidc.SAMLServiceProviderForIssuer(downstreamIssuer), oidc.SAMLRequestID(state.Nonce))
+		if err != nil {
+			plog.WarningErr("error validating SAML response", err, "upstreamName", samlIDPConfig.GetName())
+			return httperr.New(http.StatusForbidden, "error validating SAML response")
+		}
+
+		customSessionData := &psession.CustomSessionData{
+			ProviderUID:  samlIDPConfig.GetResourceUID(),
+			ProviderName: samlIDPConfig.GetName(),
+			ProviderType: psession.ProviderTypeSAML,
+			SAML:         &psession.SAMLSessionData{SessionNotOnOrAfter: user.SessionNotOnOrAfter},
+		}
+		openIDSession := downstreamsession.MakeDownstreamSession(user.DownstreamSubject, user.Username, user.Groups, customSessionData)
+
+		authorizeResponder, err := oauthHelper.NewAuthorizeResponse(r.Context(), authorizeRequester, openIDSession)
+		if err != nil {
+			plog.WarningErr("error while generating and saving authcode", err, "upstreamName", samlIDPConfig.GetName())
+			return httperr.Wrap(http.StatusInternalServerError, "error while generating and saving authcode", err)
+		}
+
+		oauthHelper.WriteAuthorizeResponse(w, authorizeRequester, authorizeResponder)
+
+		return nil
+	})
+	return securityheader.WrapWithCustomCSP(handler.WithErrorPage(errorhtml.NewPageWriter(brand)), formposthtml.ContentSecurityPolicy(brand))
+}
+
+func validateSAMLACSRequest(r *http.Request, stateDecoder, cookieDecoder oidc.Decoder) (*oidc.UpstreamStateParamData, error) {
+	if r.Method != http.MethodPost {
+		return nil, httperr.Newf(http.StatusMethodNotAllowed, "%s (try POST)", r.Method)
+	}
+
+	csrfValue, err := readCSRFCookie(r, cookieDecoder)
+	if err != nil {
+		plog.InfoErr("error reading CSRF cookie", err)
+		return nil, err
+	}
+
+	if r.PostFormValue("SAMLResponse") == "" {
+		plog.Info("SAMLResponse param not found")
+		return nil, httperr.New(http.StatusBadRequest, "SAMLResponse param not found")
+	}
+
+	// The relay state holds the same encoded state param which is used by the OIDC and GitHub callback endpoint.
+	if r.PostFormValue("RelayState") == "" {
+		plog.Info("RelayState param not found")
+		return nil, httperr.New(http.StatusBadRequest, "RelayState param not found")
+	}
+
+	state, err := readState(r.PostFormValue("RelayState"), stateDecoder)
+	if err != nil {
+		plog.InfoErr("error reading state", err)
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(state.CSRFToken), []byte(csrfValue)) != 1 {
+		plog.InfoErr("CSRF value does not match", err)
+		return nil, httperr.Wrap(http.StatusForbidden, "CSRF value does not match", err)
+	}
+
+	return state, nil
+}
+
+func findUpstreamSAMLIDPConfig(upstreamName string, upstreamIDPs oidc.UpstreamSAMLIdentityProvidersLister) provider.UpstreamSAMLIdentityProviderI {
+	for _, p := range upstreamIDPs.GetSAMLIdentityProviders() {
+		if p.GetName() == upstreamName {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package callback
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/psession"
+	"go.pinniped.dev/internal/testutil"
+	"go.pinniped.dev/internal/testutil/oidctestutil"
+)
+
+func TestSAMLACSEndpoint(t *testing.T) {
+	const (
+		samlUpstreamEntityID = "https://saml-idp.example.com/metadata"
+		samlUpstreamNameID   = "some name id"
+		samlUpstreamUsername = "test-saml-username"
+	)
+
+	var stateEncoderHashKey = []byte("fake-hash-secret")
+	var stateEncoderBlockKey = []byte("0123456789ABCDEF") // block encryption requires 16/24/32 bytes for AES
+	var cookieEncoderHashKey = []byte("fake-hash-secret2")
+	var cookieEncoderBlockKey = []byte("0123456789ABCDE2") // block encryption requires 16/24/32 bytes for AES
+
+	var happyStateCodec = securecookie.New(stateEncoderHashKey, stateEncoderBlockKey)
+	happyStateCodec.SetSerializer(securecookie.JSONEncoder{})
+	var happyCookieCodec = securecookie.New(cookieEncoderHashKey, cookieEncoderBlockKey)
+	happyCookieCodec.SetSerializer(securecookie.JSONEncoder{})
+
+	happyState := happyUpstreamStateParam().Build(t, happyStateCodec)
+
+	encodedIncomingCookieCSRFValue, err := happyCookieCodec.Encode("csrf", happyDownstreamCSRF)
+	require.NoError(t, err)
+	happyCSRFCookie := "__Host-pinniped-csrf=" + encodedIncomingCookieCSRFValue
+
+	happyDownstreamRedirectLocationRegexp := downstreamRedirectURI + `\?code=([^&]+)&scope=openid&state=` + happyDownstreamState
+
+	sessionNotOnOrAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	happySAMLUser := &provider.SAMLUser{
+		Username:            samlUpstreamUsername,
+		Groups:              []string{"group-1", "group-2"},
+		DownstreamSubject:   samlUpstreamEntityID + "?sub=" + url.QueryEscape(samlUpstreamNameID),
+		SessionNotOnOrAfter: sessionNotOnOrAfter,
+	}
+
+	acsURL, err := url.Parse(downstreamIssuer + "/saml/acs")
+	require.NoError(t, err)
+	wantParseResponseArgs := &oidctestutil.ParseSAMLResponseArgs{
+		ServiceProvider: provider.SAMLServiceProvider{EntityID: downstreamIssuer, ACSURL: *acsURL},
+		RequestID:       "id-" + happyDownstreamNonce,
+	}
+
+	happyForm := func() url.Values {
+		return url.Values{"SAMLResponse": {"some-saml-response"}, "RelayState": {happyState}}
+	}
+
+	tests := []struct {
+		name string
+
+		parseResponseUser *provider.SAMLUser
+		parseResponseErr  error
+		upstreamName      string
+		method            string
+		form              url.Values
+		csrfCookie        string
+
+		wantStatus                 int
+		wantContentType            string
+		wantBody                   string
+		wantRedirectLocationRegexp string
+		wantParseResponseCall      bool
+	}{
+		{
+			name:                       "POST with good relay state and cookie and valid SAML response returns 303 to downstream client callback",
+			parseResponseUser:          happySAMLUser,
+			method:                     http.MethodPost,
+			form:                       happyForm(),
+			csrfCookie:                 happyCSRFCookie,
+			wantStatus:                 http.StatusSeeOther,
+			wantRedirectLocationRegexp: happyDownstreamRedirectLocationRegexp,
+			wantParseResponseCall:      true,
+		},
+		{
+			name:            "GET is not allowed",
+			method:          http.MethodGet,
+			form:            happyForm(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusMethodNotAllowed,
+			wantContentType: htmlContentType,
+			wantBody:        "Method Not Allowed: GET (try POST)\n",
+		},
+		{
+			name:            "CSRF cookie is missing",
+			method:          http.MethodPost,
+			form:            happyForm(),
+			wantStatus:      http.StatusForbidden,
+			wantContentType: htmlContentType,
+			wantBody:        "Forbidden: CSRF cookie is missing\n",
+		},
+		{
+			name:            "SAMLResponse param is missing",
+			method:          http.MethodPost,
+			form:            url.Values{"RelayState": {happyState}},
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Request: SAMLResponse param not found\n",
+		},
+		{
+			name:            "RelayState param is missing",
+			method:          http.MethodPost,
+			form:            url.Values{"SAMLResponse": {"some-saml-response"}},
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusBadRequest,
+			wantContentType: htmlContentType,
+			wantBody:        "Bad Request: RelayState param not found\n",
+		},
+		{
+			name:   "RelayState does not match CSRF cookie",
+			method: http.MethodPost,
+			form: url.Values{
+				"SAMLResponse": {"some-saml-response"},
+				"RelayState":   {happyUpstreamStateParam().WithCSRF("wrong-csrf-value").Build(t, happyStateCodec)},
+			},
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusForbidden,
+			wantContentType: htmlContentType,
+			wantBody:        "Forbidden: CSRF value does not match\n",
+		},
+		{
+			name:            "upstream provider is not found",
+			upstreamName:    "other-upstream-idp-name",
+			method:          http.MethodPost,
+			form:            happyForm(),
+			csrfCookie:      happyCSRFCookie,
+			wantStatus:      http.StatusUnprocessableEntity,
+			wantContentType: htmlContentType,
+			wantBody:        "Unprocessable Entity: upstream provider not found\n",
+		},
+		{
+			name:                  "SAML response is invalid",
+			parseResponseErr:      errors.New("some validation error"),
+			method:                http.MethodPost,
+			form:                  happyForm(),
+			csrfCookie:            happyCSRFCookie,
+			wantStatus:            http.StatusForbidden,
+			wantContentType:       htmlContentType,
+			wantBody:              "Forbidden: error validating SAML response\n",
+			wantParseResponseCall: true,
+		},
+	}
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			secrets := client.CoreV1().Secrets("some-namespace")
+
+			// Configure fosite the same way that the production code would.
+			timeoutsConfiguration := oidc.DefaultOIDCTimeoutsConfiguration()
+			oauthStore := oidc.NewKubeStorage(secrets, timeoutsConfiguration)
+			hmacSecretFunc := func() []byte { return []byte("some secret - must have at least 32 bytes") }
+			jwksProviderIsUnused := jwks.NewDynamicJWKSProvider()
+			oauthHelper := oidc.FositeOauth2Helper(oauthStore, downstreamIssuer, hmacSecretFunc, jwksProviderIsUnused, timeoutsConfiguration)
+
+			upstreamName := happyUpstreamIDPName
+			if test.upstreamName != "" {
+				upstreamName = test.upstreamName
+			}
+			samlUpstream := &oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:        upstreamName,
+				ResourceUID: happyUpstreamIDPResourceUID,
+				ParseResponseFunc: func(r *http.Request, _ provider.SAMLServiceProvider, _ string) (*provider.SAMLUser, error) {
+					require.Equal(t, "some-saml-response", r.PostFormValue("SAMLResponse"))
+					return test.parseResponseUser, test.parseResponseErr
+				},
+			}
+			idps := oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(samlUpstream)
+
+			subject := NewSAMLACSHandler(idps.Build(), oauthHelper, happyStateCodec, happyCookieCodec, downstreamIssuer, nil)
+			req := httptest.NewRequest(test.method, "/downstream-provider-name/saml/acs", strings.NewReader(test.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.csrfCookie != "" {
+				req.Header.Set("Cookie", test.csrfCookie)
+			}
+			rsp := httptest.NewRecorder()
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			testutil.RequireSecurityHeaders(t, rsp)
+
+			if test.wantParseResponseCall {
+				require.Equal(t, 1, samlUpstream.ParseResponseCallCount())
+				require.Equal(t, wantParseResponseArgs, samlUpstream.ParseResponseArgs(0))
+			} else {
+				require.Equal(t, 0, samlUpstream.ParseResponseCallCount())
+			}
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+
+			if test.wantRedirectLocationRegexp == "" {
+				testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), test.wantContentType)
+				require.Equal(t, test.wantBody, rsp.Body.String())
+				return
+			}
+
+			oidctestutil.RequireAuthCodeRegexpMatch(
+				t,
+				rsp.Header().Get("Location"),
+				test.wantRedirectLocationRegexp,
+				client,
+				secrets,
+				oauthStore,
+				happyDownstreamScopesGranted,
+				happySAMLUser.DownstreamSubject,
+				samlUpstreamUsername,
+				happySAMLUser.Groups,
+				happyDownstreamScopesRequested,
+				downstreamPKCEChallenge,
+				downstreamPKCEChallengeMethod,
+				downstreamNonce,
+				downstreamClientID,
+				downstreamRedirectURI,
+				&psession.CustomSessionData{
+					ProviderUID:  happyUpstreamIDPResourceUID,
+					ProviderName: happyUpstreamIDPName,
+					ProviderType: psession.ProviderTypeSAML,
+					SAML:         &psession.SAMLSessionData{SessionNotOnOrAfter: sessionNotOnOrAfter},
+				},
+			)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package certbinding implements the binding of tokens to TLS client certificates, as described in
+// RFC 8705 section 3. The binding is only enforced by the token endpoint of the Supervisor, when the tokens are
+// refreshed or exchanged. The issued tokens do not have a confirmation claim, because the Concierge and other
+// workload cluster authenticators cannot see the client certificate of the client which presents them.
+package certbinding
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+)
+
+// Mode controls whether tokens are bound to TLS client certificates.
+type Mode string
+
+const (
+	// Disabled does not request client certificates and does not bind tokens.
+	Disabled = Mode("Disabled")
+
+	// Optional binds tokens when the client presents a client certificate.
+	Optional = Mode("Optional")
+
+	// Required rejects token requests which do not present a client certificate.
+	Required = Mode("Required")
+)
+
+type contextKey int
+
+const (
+	requestThumbprintKey contextKey = iota
+	modeKey
+)
+
+// Thumbprint returns the base64url-encoded SHA-256 hash of the DER encoding of the certificate.
+func Thumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// FromRequest returns the thumbprint of the client certificate which was presented during the TLS handshake
+// of the request, or an empty string when the client did not present a certificate.
+func FromRequest(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return Thumbprint(r.TLS.PeerCertificates[0])
+}
+
+// WithRequestThumbprint returns a copy of the context which holds the certificate binding mode of the issuer and
+// the thumbprint of the client certificate which was presented by the client.
+func WithRequestThumbprint(ctx context.Context, mode Mode, thumbprint string) context.Context {
+	ctx = context.WithValue(ctx, modeKey, mode)
+	return context.WithValue(ctx, requestThumbprintKey, thumbprint)
+}
+
+// RequestThumbprint returns the thumbprint and the mode which were added to the context by WithRequestThumbprint.
+// The mode is Disabled when they were not added.
+func RequestThumbprint(ctx context.Context) (string, Mode) {
+	mode, ok := ctx.Value(modeKey).(Mode)
+	if !ok {
+		return "", Disabled
+	}
+	thumbprint, _ := ctx.Value(requestThumbprintKey).(string)
+	return thumbprint, mode
+}
@@ -0,0 +1,43 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package certbinding
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromRequest(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("some-certificate")}
+
+	require.Empty(t, FromRequest(&http.Request{}))
+	require.Empty(t, FromRequest(&http.Request{TLS: &tls.ConnectionState{}}))
+	require.Equal(t,
+		"KjIhtFf8aMktuYNeI6DD6L3n6Tf-dOHiELcSfxVtDHE",
+		FromRequest(&http.Request{TLS: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}}),
+	)
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+
+	thumbprint, mode := RequestThumbprint(ctx)
+	require.Empty(t, thumbprint)
+	require.Equal(t, Disabled, mode)
+
+	ctx = WithRequestThumbprint(ctx, Optional, "")
+	thumbprint, mode = RequestThumbprint(ctx)
+	require.Empty(t, thumbprint)
+	require.Equal(t, Optional, mode)
+
+	ctx = WithRequestThumbprint(ctx, Required, "some-thumbprint")
+	thumbprint, mode = RequestThumbprint(ctx)
+	require.Equal(t, "some-thumbprint", thumbprint)
+	require.Equal(t, Required, mode)
+}
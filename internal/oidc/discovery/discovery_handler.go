@@ -11,6 +11,7 @@ import (
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/dpop"
 )
 
 // Metadata holds all fields (that we care about) from the OpenID Provider Metadata section in the
@@ -41,6 +42,12 @@ type Metadata struct {
 	// https://datatracker.ietf.org/doc/html/rfc8414#section-2 says, “If omitted, the authorization server does not support PKCE.”
 	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
 
+	// https://datatracker.ietf.org/doc/html/rfc8705#section-3.3
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+
+	// https://datatracker.ietf.org/doc/html/rfc9449#section-5.1
+	DPoPSigningAlgValuesSupported []string `json:"dpop_signing_alg_values_supported"`
+
 	// ^^^ Optional ^^^
 
 	// vvv Custom vvv
@@ -50,8 +57,9 @@ type Metadata struct {
 	// ^^^ Custom ^^^
 }
 
-// NewHandler returns an http.Handler that serves an OIDC discovery endpoint.
-func NewHandler(issuerURL string) http.Handler {
+// NewHandler returns an http.Handler that serves an OIDC discovery endpoint. When certificateBoundTokens is true,
+// the metadata advertises that tokens are bound to the client certificates of clients.
+func NewHandler(issuerURL string, certificateBoundTokens bool) http.Handler {
 	oidcConfig := Metadata{
 		Issuer:                issuerURL,
 		AuthorizationEndpoint: issuerURL + oidc.AuthorizationEndpointPath,
@@ -70,6 +78,9 @@ func NewHandler(issuerURL string) http.Handler {
 		CodeChallengeMethodsSupported:     []string{"S256"},
 		ScopesSupported:                   []string{"openid", "offline"},
 		ClaimsSupported:                   []string{"groups"},
+
+		TLSClientCertificateBoundAccessTokens: certificateBoundTokens,
+		DPoPSigningAlgValuesSupported:         dpop.SupportedSigningAlgorithms,
 	}
 
 	var b bytes.Buffer
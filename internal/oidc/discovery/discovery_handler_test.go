@@ -18,9 +18,10 @@ func TestDiscovery(t *testing.T) {
 	tests := []struct {
 		name string
 
-		issuer string
-		method string
-		path   string
+		issuer                 string
+		certificateBoundTokens bool
+		method                 string
+		path                   string
 
 		wantStatus      int
 		wantContentType string
@@ -48,6 +49,37 @@ func TestDiscovery(t *testing.T) {
 				"scopes_supported": ["openid", "offline"],
 				"code_challenge_methods_supported": ["S256"],
 				"claims_supported": ["groups"],
+				"dpop_signing_alg_values_supported": ["ES256", "ES384", "ES512", "RS256", "PS256", "EdDSA"],
+				"discovery.supervisor.pinniped.dev/v1alpha1": {
+					"pinniped_identity_providers_endpoint": "https://some-issuer.com/some/path/v1alpha1/pinniped_identity_providers"
+				}
+			}
+			`),
+		},
+		{
+			name:                   "tokens are bound to client certificates",
+			issuer:                 "https://some-issuer.com/some/path",
+			certificateBoundTokens: true,
+			method:                 http.MethodGet,
+			path:                   "/some/path" + oidc.WellKnownEndpointPath,
+			wantStatus:             http.StatusOK,
+			wantContentType:        "application/json",
+			wantBodyJSON: here.Doc(`
+			{
+				"issuer": "https://some-issuer.com/some/path",
+				"authorization_endpoint": "https://some-issuer.com/some/path/oauth2/authorize",
+				"token_endpoint": "https://some-issuer.com/some/path/oauth2/token",
+				"jwks_uri": "https://some-issuer.com/some/path/jwks.json",
+				"response_types_supported": ["code"],
+				"response_modes_supported": ["query", "form_post"],
+				"subject_types_supported": ["public"],
+				"id_token_signing_alg_values_supported": ["ES256"],
+				"token_endpoint_auth_methods_supported": ["client_secret_basic"],
+				"scopes_supported": ["openid", "offline"],
+				"code_challenge_methods_supported": ["S256"],
+				"claims_supported": ["groups"],
+				"dpop_signing_alg_values_supported": ["ES256", "ES384", "ES512", "RS256", "PS256", "EdDSA"],
+				"tls_client_certificate_bound_access_tokens": true,
 				"discovery.supervisor.pinniped.dev/v1alpha1": {
 					"pinniped_identity_providers_endpoint": "https://some-issuer.com/some/path/v1alpha1/pinniped_identity_providers"
 				}
@@ -67,7 +99,7 @@ func TestDiscovery(t *testing.T) {
 	for _, test := range tests {
 		test := test
 		t.Run(test.name, func(t *testing.T) {
-			handler := NewHandler(test.issuer)
+			handler := NewHandler(test.issuer, test.certificateBoundTokens)
 			req := httptest.NewRequest(test.method, test.path, nil)
 			rsp := httptest.NewRecorder()
 			handler.ServeHTTP(rsp, req)
@@ -0,0 +1,186 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package dpop implements the binding of tokens to keys which are held by clients, using the proofs of possession
+// described in RFC 9449 (OAuth 2.0 Demonstrating Proof of Possession).
+package dpop
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const (
+	// HeaderName is the name of the HTTP header which holds a DPoP proof.
+	HeaderName = "DPoP"
+
+	// TokenType is the token_type of access tokens which are bound to a DPoP key.
+	TokenType = "DPoP"
+
+	// ConfirmationClaim is the name of the claim which holds the thumbprint of the DPoP key to which a token is bound.
+	ConfirmationClaim = "cnf"
+
+	// ConfirmationMethod is the member of the confirmation claim which holds the thumbprint of the DPoP key.
+	ConfirmationMethod = "jkt"
+
+	// proofType is the value of the typ header of DPoP proofs.
+	proofType = "dpop+jwt"
+
+	// maxProofAge is how long after it was issued a DPoP proof is accepted. Accepted proofs are remembered by the
+	// ReplayCache for this long, so it is kept short.
+	maxProofAge = 2 * time.Minute
+
+	// maxClockSkew is how far in the future the issue time of a DPoP proof can be.
+	maxClockSkew = 30 * time.Second
+)
+
+// SupportedSigningAlgorithms are the JWS algorithms which are accepted for DPoP proofs.
+var SupportedSigningAlgorithms = []string{ //nolint:gochecknoglobals
+	string(jose.ES256),
+	string(jose.ES384),
+	string(jose.ES512),
+	string(jose.RS256),
+	string(jose.PS256),
+	string(jose.EdDSA),
+}
+
+type contextKey int
+
+const (
+	requestThumbprintKey contextKey = iota
+	boundThumbprintKey
+)
+
+type proofClaims struct {
+	jwt.Claims
+	HTTPMethod string `json:"htm"`
+	HTTPURL    string `json:"htu"`
+}
+
+// ValidateProof validates the DPoP proof of the request, which must be made to the URL, and returns the
+// base64url-encoded RFC 7638 thumbprint of the public key which signed it. It returns an empty string when the
+// request does not include a DPoP proof. Proofs whose jti was already seen by the ReplayCache are rejected.
+//
+// The URL is passed in rather than derived from the request, so proofs are accepted when the Supervisor is
+// behind a load balancer which terminates TLS.
+func ValidateProof(r *http.Request, expectedURL string, now time.Time, replays *ReplayCache) (string, error) {
+	proofs := r.Header.Values(HeaderName)
+	switch len(proofs) {
+	case 0:
+		return "", nil
+	case 1:
+	default:
+		return "", errors.New("more than one DPoP proof was provided")
+	}
+
+	token, err := jwt.ParseSigned(proofs[0])
+	if err != nil {
+		return "", fmt.Errorf("could not parse DPoP proof: %w", err)
+	}
+	if len(token.Headers) != 1 {
+		return "", errors.New("DPoP proof must have exactly one signature")
+	}
+
+	header := token.Headers[0]
+	if typ, _ := header.ExtraHeaders[jose.HeaderType].(string); typ != proofType {
+		return "", fmt.Errorf("DPoP proof must have typ %q", proofType)
+	}
+	if !supportedSigningAlgorithm(header.Algorithm) {
+		return "", fmt.Errorf("DPoP proof has unsupported alg %q", header.Algorithm)
+	}
+	if header.JSONWebKey == nil || !header.JSONWebKey.Valid() || !header.JSONWebKey.IsPublic() {
+		return "", errors.New("DPoP proof must have a public jwk")
+	}
+
+	var claims proofClaims
+	if err := token.Claims(header.JSONWebKey, &claims); err != nil {
+		return "", fmt.Errorf("could not verify DPoP proof: %w", err)
+	}
+	if claims.ID == "" {
+		return "", errors.New("DPoP proof must have a jti")
+	}
+	if claims.HTTPMethod != r.Method {
+		return "", fmt.Errorf("DPoP proof has htm %q, but the request has method %q", claims.HTTPMethod, r.Method)
+	}
+	if !sameURL(claims.HTTPURL, expectedURL) {
+		return "", fmt.Errorf("DPoP proof has htu %q, but the request was made to %q", claims.HTTPURL, expectedURL)
+	}
+	if claims.IssuedAt == nil {
+		return "", errors.New("DPoP proof must have an iat")
+	}
+	issuedAt := claims.IssuedAt.Time()
+	if issuedAt.After(now.Add(maxClockSkew)) || issuedAt.Before(now.Add(-maxProofAge)) {
+		return "", errors.New("DPoP proof is expired or not yet valid")
+	}
+
+	thumbprint, err := header.JSONWebKey.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", fmt.Errorf("could not compute thumbprint of DPoP key: %w", err)
+	}
+	encodedThumbprint := base64.RawURLEncoding.EncodeToString(thumbprint)
+	if !replays.remember(encodedThumbprint, claims.ID) {
+		return "", errors.New("DPoP proof has already been used")
+	}
+	return encodedThumbprint, nil
+}
+
+func supportedSigningAlgorithm(alg string) bool {
+	for _, supported := range SupportedSigningAlgorithms {
+		if alg == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// sameURL compares the URLs without their query and fragment, and ignoring the case of their scheme and host,
+// as described in RFC 9449 section 4.3.
+func sameURL(proofURL, expectedURL string) bool {
+	normalize := func(u string) (string, bool) {
+		parsed, err := url.Parse(u)
+		if err != nil || !parsed.IsAbs() {
+			return "", false
+		}
+		return strings.ToLower(parsed.Scheme) + "://" + strings.ToLower(parsed.Host) + parsed.EscapedPath(), true
+	}
+	proof, ok := normalize(proofURL)
+	if !ok {
+		return false
+	}
+	expected, ok := normalize(expectedURL)
+	return ok && proof == expected
+}
+
+// WithRequestThumbprint returns a copy of the context which holds the thumbprint of the DPoP key which was
+// proven by the request.
+func WithRequestThumbprint(ctx context.Context, thumbprint string) context.Context {
+	return context.WithValue(ctx, requestThumbprintKey, thumbprint)
+}
+
+// RequestThumbprint returns the thumbprint which was added to the context by WithRequestThumbprint.
+func RequestThumbprint(ctx context.Context) string {
+	thumbprint, _ := ctx.Value(requestThumbprintKey).(string)
+	return thumbprint
+}
+
+// WithBoundThumbprint returns a copy of the context which holds the thumbprint of the DPoP key to which the tokens
+// which are issued using the context are bound.
+func WithBoundThumbprint(ctx context.Context, thumbprint string) context.Context {
+	return context.WithValue(ctx, boundThumbprintKey, thumbprint)
+}
+
+// BoundThumbprint returns the thumbprint which was added to the context by WithBoundThumbprint.
+func BoundThumbprint(ctx context.Context) string {
+	thumbprint, _ := ctx.Value(boundThumbprintKey).(string)
+	return thumbprint
+}
@@ -0,0 +1,271 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package dpop
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+const tokenURL = "https://some-issuer.com/some/path/oauth2/token"
+
+func TestValidateProof(t *testing.T) {
+	now := time.Date(2022, 5, 6, 7, 8, 9, 0, time.UTC)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	thumbprintBytes, err := (&jose.JSONWebKey{Key: &key.PublicKey}).Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+	thumbprint := base64.RawURLEncoding.EncodeToString(thumbprintBytes)
+
+	goodClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"jti": "some-jti",
+			"htm": http.MethodPost,
+			"htu": tokenURL,
+			"iat": now.Unix(),
+		}
+	}
+
+	sign := func(t *testing.T, key *ecdsa.PrivateKey, typ string, claims map[string]interface{}) string {
+		t.Helper()
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			(&jose.SignerOptions{EmbedJWK: true}).WithType(jose.ContentType(typ)),
+		)
+		require.NoError(t, err)
+		proof, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return proof
+	}
+
+	// unsigned returns a proof with the header and claims and a signature which is never checked.
+	unsigned := func(t *testing.T, header map[string]interface{}, claims map[string]interface{}) string {
+		t.Helper()
+		encode := func(v interface{}) string {
+			b, err := json.Marshal(v)
+			require.NoError(t, err)
+			return base64.RawURLEncoding.EncodeToString(b)
+		}
+		return encode(header) + "." + encode(claims) + "." + base64.RawURLEncoding.EncodeToString([]byte("some-signature"))
+	}
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := goodClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		proofs         func(t *testing.T) []string
+		wantThumbprint string
+		wantErr        string
+	}{
+		{
+			name:   "no proof",
+			proofs: func(t *testing.T) []string { return nil },
+		},
+		{
+			name:           "valid proof",
+			proofs:         func(t *testing.T) []string { return []string{sign(t, key, "dpop+jwt", goodClaims())} },
+			wantThumbprint: thumbprint,
+		},
+		{
+			name: "valid proof with a URL which differs only in case, query and fragment",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("htu", "HTTPS://Some-Issuer.com/some/path/oauth2/token?foo=bar#baz"))}
+			},
+			wantThumbprint: thumbprint,
+		},
+		{
+			name: "valid proof issued slightly in the future",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("iat", now.Add(20*time.Second).Unix()))}
+			},
+			wantThumbprint: thumbprint,
+		},
+		{
+			name: "more than one proof",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", goodClaims()), sign(t, key, "dpop+jwt", goodClaims())}
+			},
+			wantErr: "more than one DPoP proof was provided",
+		},
+		{
+			name:    "proof is not a JWT",
+			proofs:  func(t *testing.T) []string { return []string{"some-proof"} },
+			wantErr: "could not parse DPoP proof: square/go-jose: compact JWS format must have three parts",
+		},
+		{
+			name:    "wrong typ",
+			proofs:  func(t *testing.T) []string { return []string{sign(t, key, "JWT", goodClaims())} },
+			wantErr: `DPoP proof must have typ "dpop+jwt"`,
+		},
+		{
+			name: "unsupported alg",
+			proofs: func(t *testing.T) []string {
+				return []string{unsigned(t, map[string]interface{}{"typ": "dpop+jwt", "alg": "HS256"}, goodClaims())}
+			},
+			wantErr: `DPoP proof has unsupported alg "HS256"`,
+		},
+		{
+			name: "no jwk",
+			proofs: func(t *testing.T) []string {
+				return []string{unsigned(t, map[string]interface{}{"typ": "dpop+jwt", "alg": "ES256"}, goodClaims())}
+			},
+			wantErr: "DPoP proof must have a public jwk",
+		},
+		{
+			name: "signed by a different key than the jwk",
+			proofs: func(t *testing.T) []string {
+				proof := strings.Split(sign(t, key, "dpop+jwt", goodClaims()), ".")
+				otherProof := strings.Split(sign(t, otherKey, "dpop+jwt", goodClaims()), ".")
+				return []string{otherProof[0] + "." + proof[1] + "." + proof[2]}
+			},
+			wantErr: "could not verify DPoP proof: square/go-jose: error in cryptographic primitive",
+		},
+		{
+			name:    "no jti",
+			proofs:  func(t *testing.T) []string { return []string{sign(t, key, "dpop+jwt", withClaim("jti", nil))} },
+			wantErr: "DPoP proof must have a jti",
+		},
+		{
+			name: "wrong htm",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("htm", http.MethodGet))}
+			},
+			wantErr: `DPoP proof has htm "GET", but the request has method "POST"`,
+		},
+		{
+			name: "wrong htu",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("htu", "https://some-issuer.com/some/other/path/oauth2/token"))}
+			},
+			wantErr: `DPoP proof has htu "https://some-issuer.com/some/other/path/oauth2/token", but the request was made to "https://some-issuer.com/some/path/oauth2/token"`,
+		},
+		{
+			name: "relative htu",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("htu", "/some/path/oauth2/token"))}
+			},
+			wantErr: `DPoP proof has htu "/some/path/oauth2/token", but the request was made to "https://some-issuer.com/some/path/oauth2/token"`,
+		},
+		{
+			name:    "no iat",
+			proofs:  func(t *testing.T) []string { return []string{sign(t, key, "dpop+jwt", withClaim("iat", nil))} },
+			wantErr: "DPoP proof must have an iat",
+		},
+		{
+			name: "iat too far in the future",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("iat", now.Add(time.Minute).Unix()))}
+			},
+			wantErr: "DPoP proof is expired or not yet valid",
+		},
+		{
+			name: "iat too old",
+			proofs: func(t *testing.T) []string {
+				return []string{sign(t, key, "dpop+jwt", withClaim("iat", now.Add(-3*time.Minute).Unix()))}
+			},
+			wantErr: "DPoP proof is expired or not yet valid",
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			r, err := http.NewRequestWithContext(context.Background(), http.MethodPost, "http://some-load-balanced-address/oauth2/token", nil)
+			require.NoError(t, err)
+			for _, proof := range test.proofs(t) {
+				r.Header.Add(HeaderName, proof)
+			}
+
+			thumbprint, err := ValidateProof(r, tokenURL, now, NewReplayCache())
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				require.Empty(t, thumbprint)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantThumbprint, thumbprint)
+		})
+	}
+}
+
+func TestValidateProofRejectsReplays(t *testing.T) {
+	now := time.Now()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	sign := func(t *testing.T, jti string) string {
+		t.Helper()
+		signer, err := jose.NewSigner(
+			jose.SigningKey{Algorithm: jose.ES256, Key: key},
+			(&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt"),
+		)
+		require.NoError(t, err)
+		proof, err := jwt.Signed(signer).Claims(map[string]interface{}{
+			"jti": jti,
+			"htm": http.MethodPost,
+			"htu": tokenURL,
+			"iat": now.Unix(),
+		}).CompactSerialize()
+		require.NoError(t, err)
+		return proof
+	}
+
+	validate := func(t *testing.T, proof string, replays *ReplayCache) error {
+		t.Helper()
+		r, err := http.NewRequestWithContext(context.Background(), http.MethodPost, tokenURL, nil)
+		require.NoError(t, err)
+		r.Header.Set(HeaderName, proof)
+		_, err = ValidateProof(r, tokenURL, now, replays)
+		return err
+	}
+
+	replays := NewReplayCache()
+	proof := sign(t, "some-jti")
+	require.NoError(t, validate(t, proof, replays))
+	require.EqualError(t, validate(t, proof, replays), "DPoP proof has already been used")
+
+	// A new proof with the same jti is also a replay.
+	require.EqualError(t, validate(t, sign(t, "some-jti"), replays), "DPoP proof has already been used")
+
+	// Proofs with other jtis are still accepted, and other caches have not seen the proof.
+	require.NoError(t, validate(t, sign(t, "some-other-jti"), replays))
+	require.NoError(t, validate(t, proof, NewReplayCache()))
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	require.Empty(t, RequestThumbprint(ctx))
+	require.Empty(t, BoundThumbprint(ctx))
+
+	ctx = WithRequestThumbprint(ctx, "some-request-thumbprint")
+	ctx = WithBoundThumbprint(ctx, "some-bound-thumbprint")
+	require.Equal(t, "some-request-thumbprint", RequestThumbprint(ctx))
+	require.Equal(t, "some-bound-thumbprint", BoundThumbprint(ctx))
+}
@@ -0,0 +1,39 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package dpop
+
+import (
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// ReplayCache remembers the DPoP proofs which were accepted until they expire, so each proof can only be used once.
+// It is safe for concurrent use. It is only held in memory, so when the Supervisor has several replicas, a proof
+// could still be replayed once against each of the other replicas during its short lifetime.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen *cache.Expiring
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: cache.NewExpiring()}
+}
+
+// remember records the jti of a proof which was signed by the key with the thumbprint, and returns false when
+// a proof with the same jti was already recorded for the key.
+func (c *ReplayCache) remember(thumbprint, jti string) bool {
+	key := thumbprint + ":" + jti
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, found := c.seen.Get(key); found {
+		return false
+	}
+	// Proofs are rejected once they are older than maxProofAge, and they could have been issued up to
+	// maxClockSkew in the future, so they only need to be remembered for that long.
+	c.seen.Set(key, struct{}{}, maxProofAge+maxClockSkew)
+	return true
+}
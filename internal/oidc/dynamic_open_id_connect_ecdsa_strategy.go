@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
@@ -13,6 +13,7 @@ import (
 	"github.com/ory/fosite/handler/openid"
 
 	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/oidc/dpop"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/plog"
 )
@@ -67,5 +68,20 @@ func (s *dynamicOpenIDConnectECDSAStrategy) GenerateIDToken(
 		return "", fosite.ErrServerError.WithWrap(constable.Error("JWK must be of type ecdsa"))
 	}
 
+	// When the tokens of this request are bound to a DPoP key, add the confirmation claim of RFC 9449 section 6.1
+	// to the ID token without changing the claims of the session itself.
+	if thumbprint := dpop.BoundThumbprint(ctx); thumbprint != "" {
+		if session, ok := requester.GetSession().(openid.Session); ok && session.IDTokenClaims() != nil {
+			claims := session.IDTokenClaims()
+			originalExtra := claims.Extra
+			claims.Extra = make(map[string]interface{}, len(originalExtra)+1)
+			for k, v := range originalExtra {
+				claims.Extra[k] = v
+			}
+			claims.Extra[dpop.ConfirmationClaim] = map[string]interface{}{dpop.ConfirmationMethod: thumbprint}
+			defer func() { claims.Extra = originalExtra }()
+		}
+	}
+
 	return compose.NewOpenIDConnectECDSAStrategy(s.fositeConfig, key).GenerateIDToken(ctx, requester)
 }
@@ -1,4 +1,4 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
@@ -20,6 +20,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"gopkg.in/square/go-jose.v2"
 
+	"go.pinniped.dev/internal/oidc/dpop"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
 )
@@ -40,12 +41,14 @@ func TestDynamicOpenIDConnectECDSAStrategy(t *testing.T) {
 	require.NoError(t, err)
 
 	tests := []struct {
-		name           string
-		issuer         string
-		jwksProvider   func(jwks.DynamicJWKSProvider)
-		wantErrorType  *fosite.RFC6749Error
-		wantErrorCause string
-		wantSigningJWK *jose.JSONWebKey
+		name                string
+		issuer              string
+		jwksProvider        func(jwks.DynamicJWKSProvider)
+		boundDPoPThumbprint string
+		wantConfirmation    map[string]interface{}
+		wantErrorType       *fosite.RFC6749Error
+		wantErrorCause      string
+		wantSigningJWK      *jose.JSONWebKey
 	}{
 		{
 			name:   "jwks provider does contain signing key for issuer",
@@ -64,6 +67,25 @@ func TestDynamicOpenIDConnectECDSAStrategy(t *testing.T) {
 				Key: ecPrivateKey,
 			},
 		},
+		{
+			name:   "tokens are bound to a DPoP key",
+			issuer: goodIssuer,
+			jwksProvider: func(provider jwks.DynamicJWKSProvider) {
+				provider.SetIssuerToJWKSMap(
+					nil,
+					map[string]*jose.JSONWebKey{
+						goodIssuer: {
+							Key: ecPrivateKey,
+						},
+					},
+				)
+			},
+			boundDPoPThumbprint: "some-dpop-thumbprint",
+			wantConfirmation:    map[string]interface{}{"jkt": "some-dpop-thumbprint"},
+			wantSigningJWK: &jose.JSONWebKey{
+				Key: ecPrivateKey,
+			},
+		},
 		{
 			name:           "jwks provider does not contain signing key for issuer",
 			issuer:         goodIssuer,
@@ -114,7 +136,11 @@ func TestDynamicOpenIDConnectECDSAStrategy(t *testing.T) {
 					"nonce": {goodNonce},
 				},
 			}
-			idToken, err := s.GenerateIDToken(context.Background(), requester)
+			ctx := context.Background()
+			if test.boundDPoPThumbprint != "" {
+				ctx = dpop.WithBoundThumbprint(ctx, test.boundDPoPThumbprint)
+			}
+			idToken, err := s.GenerateIDToken(ctx, requester)
 			if test.wantErrorType != nil {
 				require.True(t, errors.Is(err, test.wantErrorType))
 				require.EqualError(t, err.(*fosite.RFC6749Error).Cause(), test.wantErrorCause)
@@ -130,6 +156,16 @@ func TestDynamicOpenIDConnectECDSAStrategy(t *testing.T) {
 				token := oidctestutil.VerifyECDSAIDToken(t, goodIssuer, clientID, privateKey, idToken)
 				require.Equal(t, goodSubject, token.Subject)
 				require.Equal(t, goodNonce, token.Nonce)
+
+				var claims map[string]interface{}
+				require.NoError(t, token.Claims(&claims))
+				if test.wantConfirmation != nil {
+					require.Equal(t, test.wantConfirmation, claims["cnf"])
+				} else {
+					require.NotContains(t, claims, "cnf")
+				}
+				// The claims of the session are not changed.
+				require.Nil(t, requester.Session.(*openid.DefaultSession).Claims.Extra)
 			}
 		})
 	}
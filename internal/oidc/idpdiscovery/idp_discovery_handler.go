@@ -1,4 +1,4 @@
-// Copyright 2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2021-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package idpdiscovery provides a handler for the upstream IDP discovery endpoint.
@@ -12,6 +12,7 @@ import (
 
 	"go.pinniped.dev/generated/latest/apis/supervisor/idpdiscovery/v1alpha1"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
 )
 
 // NewHandler returns an http.Handler that serves the upstream IDP discovery endpoint.
@@ -37,20 +38,70 @@ func NewHandler(upstreamIDPs oidc.UpstreamIdentityProvidersLister) http.Handler
 }
 
 func responseAsJSON(upstreamIDPs oidc.UpstreamIdentityProvidersLister) ([]byte, error) {
-	r := v1alpha1.IDPDiscoveryResponse{PinnipedIDPs: []v1alpha1.PinnipedIDP{}}
-
 	// The cache of IDPs could change at any time, so always recalculate the list.
+	r := v1alpha1.IDPDiscoveryResponse{PinnipedIDPs: PinnipedIDPs(upstreamIDPs)}
+
+	var b bytes.Buffer
+	encodeErr := json.NewEncoder(&b).Encode(&r)
+	encodedMetadata := b.Bytes()
+
+	return encodedMetadata, encodeErr
+}
+
+// PinnipedIDPs returns the names, types, and supported flows of all the upstream IDPs, sorted by name.
+func PinnipedIDPs(upstreamIDPs oidc.UpstreamIdentityProvidersLister) []v1alpha1.PinnipedIDP {
+	idps := []v1alpha1.PinnipedIDP{}
+
 	for _, provider := range upstreamIDPs.GetLDAPIdentityProviders() {
-		r.PinnipedIDPs = append(r.PinnipedIDPs, v1alpha1.PinnipedIDP{
+		idps = append(idps, v1alpha1.PinnipedIDP{
 			Name:  provider.GetName(),
 			Type:  v1alpha1.IDPTypeLDAP,
 			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowCLIPassword},
 		})
 	}
-	for _, provider := range upstreamIDPs.GetActiveDirectoryIdentityProviders() {
-		r.PinnipedIDPs = append(r.PinnipedIDPs, v1alpha1.PinnipedIDP{
-			Name:  provider.GetName(),
+	for _, upstream := range upstreamIDPs.GetActiveDirectoryIdentityProviders() {
+		flows := []v1alpha1.IDPFlow{v1alpha1.IDPFlowCLIPassword}
+		if kerberosUpstream, ok := upstream.(provider.UpstreamKerberosIdentityProviderI); ok && kerberosUpstream.AllowsKerberos() {
+			flows = append(flows, v1alpha1.IDPFlowCLIKerberos)
+		}
+		idps = append(idps, v1alpha1.PinnipedIDP{
+			Name:  upstream.GetName(),
 			Type:  v1alpha1.IDPTypeActiveDirectory,
+			Flows: flows,
+		})
+	}
+	for _, provider := range upstreamIDPs.GetGitHubIdentityProviders() {
+		idps = append(idps, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeGitHub,
+			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowBrowserAuthcode},
+		})
+	}
+	for _, provider := range upstreamIDPs.GetSAMLIdentityProviders() {
+		idps = append(idps, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeSAML,
+			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowBrowserAuthcode},
+		})
+	}
+	for _, provider := range upstreamIDPs.GetOAuth2IdentityProviders() {
+		idps = append(idps, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeOAuth2,
+			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowBrowserAuthcode},
+		})
+	}
+	for _, provider := range upstreamIDPs.GetWebhookIdentityProviders() {
+		idps = append(idps, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeWebhook,
+			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowCLIPassword},
+		})
+	}
+	for _, provider := range upstreamIDPs.GetLocalIdentityProviders() {
+		idps = append(idps, v1alpha1.PinnipedIDP{
+			Name:  provider.GetName(),
+			Type:  v1alpha1.IDPTypeLocal,
 			Flows: []v1alpha1.IDPFlow{v1alpha1.IDPFlowCLIPassword},
 		})
 	}
@@ -59,7 +110,7 @@ func responseAsJSON(upstreamIDPs oidc.UpstreamIdentityProvidersLister) ([]byte,
 		if provider.AllowsPasswordGrant() {
 			flows = append(flows, v1alpha1.IDPFlowCLIPassword)
 		}
-		r.PinnipedIDPs = append(r.PinnipedIDPs, v1alpha1.PinnipedIDP{
+		idps = append(idps, v1alpha1.PinnipedIDP{
 			Name:  provider.GetName(),
 			Type:  v1alpha1.IDPTypeOIDC,
 			Flows: flows,
@@ -67,13 +118,9 @@ func responseAsJSON(upstreamIDPs oidc.UpstreamIdentityProvidersLister) ([]byte,
 	}
 
 	// Nobody like an API that changes the results unnecessarily. :)
-	sort.SliceStable(r.PinnipedIDPs, func(i, j int) bool {
-		return r.PinnipedIDPs[i].Name < r.PinnipedIDPs[j].Name
+	sort.SliceStable(idps, func(i, j int) bool {
+		return idps[i].Name < idps[j].Name
 	})
 
-	var b bytes.Buffer
-	encodeErr := json.NewEncoder(&b).Encode(&r)
-	encodedMetadata := b.Bytes()
-
-	return encodedMetadata, encodeErr
+	return idps
 }
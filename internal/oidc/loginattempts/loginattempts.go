@@ -0,0 +1,391 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package loginattempts limits how quickly passwords can be guessed using the password-based login flows.
+// Failed attempts are counted per username and per source IP address. Once there have been too many recent
+// failures, further attempts are rejected for an exponentially increasing amount of time. The counters are stored
+// in Secrets so that they are shared by all Supervisor pods.
+//
+// Counters are only stored after a failed attempt, so logins which succeed without earlier failures do not write
+// anything. Once a counter exists, each attempt is counted as a failure before the password is checked, so that
+// concurrent attempts cannot exceed the limits, and is uncounted when it succeeds. Only the first failures, which
+// create the counters, are counted after the password was checked. The Secrets are garbage collected once their
+// failures are forgotten. IPv6 addresses are counted per /64 prefix, since a client can easily use many of the
+// addresses of its prefix. The failures of a username are only counted once its source IP address has failed
+// before, so the first failure from each source IP address only stores the counter of that address.
+package loginattempts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/util/retry"
+
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/crud"
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	TypeLabelValue = "login-attempts"
+
+	ErrInvalidLoginAttemptsVersion = constable.Error("login attempts data has wrong version")
+
+	loginAttemptsStorageVersion = "1"
+)
+
+// Config controls how many failed login attempts are allowed and for how long attempts are rejected afterwards.
+type Config struct {
+	// UsernameFreeFailures is the number of failed attempts for a username which are allowed before further
+	// attempts for that username are rejected for a while.
+	UsernameFreeFailures int
+
+	// SourceIPFreeFailures is the number of failed attempts from a source IP address which are allowed before
+	// further attempts from that address are rejected for a while. It is usually larger than UsernameFreeFailures
+	// because many users may share an address.
+	SourceIPFreeFailures int
+
+	// InitialBackoff is how long attempts are rejected after the first failure beyond the free failures. It doubles
+	// with each further failure, up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// ResetAfter is how long after the most recent failure the failures are forgotten.
+	ResetAfter time.Duration
+}
+
+// DefaultConfig returns the Config used by the Supervisor. It rejects attempts well before typical Active Directory
+// account lockout policies would lock out an account.
+func DefaultConfig() Config {
+	return Config{
+		UsernameFreeFailures: 3,
+		SourceIPFreeFailures: 20,
+		InitialBackoff:       2 * time.Second,
+		MaxBackoff:           15 * time.Minute,
+		ResetAfter:           time.Hour,
+	}
+}
+
+// Attempt describes one password-based login attempt.
+type Attempt struct {
+	IDPName  string
+	IDPType  string
+	Username string
+	SourceIP string
+}
+
+// Limiter decides whether password-based login attempts are allowed.
+type Limiter interface {
+	// Reserve counts the attempt as a failure by the existing counters before the password is checked by the
+	// upstream identity provider, so that concurrent attempts cannot exceed the limits. It returns how much longer
+	// attempts will be rejected, or zero and a Reservation when the attempt is allowed. Rejected attempts are not
+	// counted.
+	Reserve(ctx context.Context, attempt Attempt) (Reservation, time.Duration)
+}
+
+// Reservation is an allowed attempt, which must be resolved by calling one of its methods.
+type Reservation interface {
+	// Succeeded is called after the attempt is accepted by the upstream identity provider.
+	Succeeded(ctx context.Context)
+
+	// Failed is called after the attempt is rejected by the upstream identity provider. It creates the counters
+	// which did not exist yet when the attempt was reserved.
+	Failed(ctx context.Context)
+
+	// Release is called when the upstream identity provider could not check the attempt, e.g. because of a
+	// network failure, which is not the fault of the user.
+	Release(ctx context.Context)
+}
+
+type failures struct {
+	Count         int       `json:"count"`
+	LastFailure   time.Time `json:"lastFailure"`
+	RejectedUntil time.Time `json:"rejectedUntil"`
+	Version       string    `json:"version"`
+}
+
+type kubeLimiter struct {
+	storage crud.Storage
+	clock   func() time.Time
+	config  Config
+}
+
+var _ Limiter = &kubeLimiter{}
+
+// New returns a Limiter which stores its counters in Secrets.
+func New(secrets corev1client.SecretInterface, clock func() time.Time, config Config) Limiter {
+	return &kubeLimiter{
+		storage: crud.New(TypeLabelValue, secrets, clock, config.ResetAfter),
+		clock:   clock,
+		config:  config,
+	}
+}
+
+// Reserve never rejects an attempt because of an error reading or writing the counters, since that would also
+// reject all legitimate logins. It logs a warning instead.
+func (l *kubeLimiter) Reserve(ctx context.Context, attempt Attempt) (Reservation, time.Duration) {
+	usernameKey, sourceIPKey := keys(attempt)
+	r := &reservation{limiter: l, attempt: attempt}
+
+	previousSourceIPFailures, sourceIPReserved, rejectedFor, err := l.reserve(ctx, sourceIPKey, l.config.SourceIPFreeFailures)
+	if err != nil {
+		plog.WarningErr("could not reserve login attempt", err, "upstreamName", attempt.IDPName)
+	}
+	if rejectedFor == 0 {
+		r.sourceIPReserved = sourceIPReserved
+		r.sourceIPFailedBefore = previousSourceIPFailures > 0
+		var usernameReserved bool
+		_, usernameReserved, rejectedFor, err = l.reserve(ctx, usernameKey, l.config.UsernameFreeFailures)
+		if err != nil {
+			plog.WarningErr("could not reserve login attempt", err, "upstreamName", attempt.IDPName)
+		}
+		r.usernameReserved = usernameReserved
+	}
+
+	if rejectedFor > 0 {
+		r.Release(ctx)
+		plog.Info("rejected login attempt because of too many failed login attempts",
+			"upstreamName", attempt.IDPName,
+			"upstreamType", attempt.IDPType,
+			"username", attempt.Username,
+			"sourceIP", attempt.SourceIP,
+			"rejectedFor", rejectedFor.String(),
+		)
+		return nil, rejectedFor
+	}
+	return r, 0
+}
+
+// reserve atomically checks whether attempts are currently rejected by an existing counter, and counts the attempt
+// as a failure when they are not. It returns the number of failures before the attempt, and whether the attempt was
+// counted. Counters which do not exist are not created, so the attempt is not counted by them.
+func (l *kubeLimiter) reserve(ctx context.Context, key string, freeFailures int) (int, bool, time.Duration, error) {
+	var previousFailures int
+	var reserved bool
+	var rejectedFor time.Duration
+	err := l.update(ctx, key, false, func(f *failures, now time.Time) bool {
+		previousFailures, reserved, rejectedFor = 0, false, 0
+		if now.Sub(f.LastFailure) > l.config.ResetAfter {
+			*f = failures{}
+		}
+		if remaining := f.RejectedUntil.Sub(now); remaining > 0 {
+			rejectedFor = remaining
+			return false
+		}
+		previousFailures, reserved = f.Count, true
+		l.countFailure(f, now, freeFailures)
+		return true
+	})
+	if err != nil {
+		return 0, false, 0, err
+	}
+	return previousFailures, reserved, rejectedFor, nil
+}
+
+// fail counts a failed attempt which was not reserved, creating the counter when it does not exist.
+func (l *kubeLimiter) fail(ctx context.Context, key string, freeFailures int) error {
+	return l.update(ctx, key, true, func(f *failures, now time.Time) bool {
+		if now.Sub(f.LastFailure) > l.config.ResetAfter {
+			*f = failures{}
+		}
+		l.countFailure(f, now, freeFailures)
+		return true
+	})
+}
+
+func (l *kubeLimiter) countFailure(f *failures, now time.Time, freeFailures int) {
+	f.Count++
+	f.LastFailure = now
+	f.RejectedUntil = now.Add(l.backoff(f.Count, freeFailures))
+}
+
+// release undoes the reservation of an attempt by the counter.
+func (l *kubeLimiter) release(ctx context.Context, key string, freeFailures int) error {
+	return l.update(ctx, key, false, func(f *failures, _ time.Time) bool {
+		if f.Count == 0 {
+			return false
+		}
+		f.Count--
+		f.RejectedUntil = f.LastFailure.Add(l.backoff(f.Count, freeFailures))
+		return true
+	})
+}
+
+// update reads the counter, lets modify change it, and writes it when modify returns true. A counter which does
+// not exist is only created when create is true. Other Supervisor pods may be updating the same counter, so the
+// whole update is retried on conflicts.
+func (l *kubeLimiter) update(ctx context.Context, key string, create bool, modify func(f *failures, now time.Time) bool) error {
+	return retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return errors.IsConflict(err) || errors.IsAlreadyExists(err)
+	}, func() error {
+		f, resourceVersion, err := l.get(ctx, key)
+		notFound := errors.IsNotFound(err)
+		if err != nil && !notFound {
+			return err
+		}
+		if notFound && !create {
+			return nil
+		}
+		if notFound {
+			f = &failures{}
+		}
+
+		if !modify(f, l.clock()) {
+			return nil
+		}
+		f.Version = loginAttemptsStorageVersion
+
+		if notFound {
+			_, err = l.storage.Create(ctx, key, f, nil)
+		} else {
+			_, err = l.storage.Update(ctx, key, resourceVersion, f)
+		}
+		return err
+	})
+}
+
+// backoff returns how long to reject attempts after the given number of failures.
+func (l *kubeLimiter) backoff(count int, freeFailures int) time.Duration {
+	if count <= freeFailures {
+		return 0
+	}
+	multiplier := math.Pow(2, float64(count-freeFailures-1))
+	backoff := time.Duration(float64(l.config.InitialBackoff) * multiplier)
+	if backoff > l.config.MaxBackoff || backoff <= 0 {
+		return l.config.MaxBackoff
+	}
+	return backoff
+}
+
+func (l *kubeLimiter) get(ctx context.Context, key string) (*failures, string, error) {
+	f := &failures{}
+	resourceVersion, err := l.storage.Get(ctx, key, f)
+	if err != nil {
+		return nil, "", err
+	}
+	if f.Version != loginAttemptsStorageVersion {
+		return nil, "", ErrInvalidLoginAttemptsVersion
+	}
+	return f, resourceVersion, nil
+}
+
+// SourceIP returns the IP address of the client which sent the request. When the request was sent by one of the
+// trusted proxies, the addresses in its X-Forwarded-For header are used instead, from right to left, skipping the
+// addresses of further trusted proxies. Addresses which were added by untrusted clients are never used, because
+// they could be chosen by the client to evade the limits.
+func SourceIP(r *http.Request, trustedProxies []*net.IPNet) string {
+	sourceIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		sourceIP = r.RemoteAddr
+	}
+
+	var forwardedFor []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwardedFor = append(forwardedFor, strings.Split(header, ",")...)
+	}
+	for i := len(forwardedFor) - 1; i >= 0 && isTrusted(sourceIP, trustedProxies); i-- {
+		forwardedIP := strings.TrimSpace(forwardedFor[i])
+		if net.ParseIP(forwardedIP) == nil {
+			// The trusted proxy did not forward a valid address, so the proxy is the best known source.
+			break
+		}
+		sourceIP = forwardedIP
+	}
+	return sourceIP
+}
+
+func isTrusted(sourceIP string, trustedProxies []*net.IPNet) bool {
+	ip := net.ParseIP(sourceIP)
+	if ip == nil {
+		return false
+	}
+	for _, trustedProxy := range trustedProxies {
+		if trustedProxy.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// keys returns the storage keys of the per-username counter and the per-source-IP counter. They are hashed to
+// make valid Secret names of a bounded length.
+func keys(attempt Attempt) (string, string) {
+	return hash("username", attempt.IDPType, attempt.IDPName, strings.ToLower(attempt.Username)),
+		hash("sourceIP", sourceIPBucket(attempt.SourceIP))
+}
+
+// sourceIPBucket returns the /64 prefix of IPv6 addresses, which are usually all assigned to the same client.
+// Other addresses are returned unchanged.
+func sourceIPBucket(sourceIP string) string {
+	ip := net.ParseIP(sourceIP)
+	if ip == nil || ip.To4() != nil {
+		return sourceIP
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+func hash(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type reservation struct {
+	limiter              *kubeLimiter
+	attempt              Attempt
+	usernameReserved     bool
+	sourceIPReserved     bool
+	sourceIPFailedBefore bool
+}
+
+var _ Reservation = &reservation{}
+
+func (r *reservation) Succeeded(ctx context.Context) {
+	// Forget the failures of the username, but only release the reservation of the source IP address, because
+	// other users might share it. A username which was not reserved has no counter to forget.
+	if r.usernameReserved {
+		usernameKey, _ := keys(r.attempt)
+		if err := r.limiter.storage.Delete(ctx, usernameKey); err != nil && !errors.IsNotFound(err) {
+			plog.WarningErr("could not reset failed login attempts", err, "upstreamName", r.attempt.IDPName)
+		}
+		r.usernameReserved = false
+	}
+	r.Release(ctx)
+}
+
+func (r *reservation) Failed(ctx context.Context) {
+	usernameKey, sourceIPKey := keys(r.attempt)
+	if !r.sourceIPReserved {
+		if err := r.limiter.fail(ctx, sourceIPKey, r.limiter.config.SourceIPFreeFailures); err != nil {
+			plog.WarningErr("could not count failed login attempt", err, "upstreamName", r.attempt.IDPName)
+		}
+	}
+	// Only create the counter of a username once its source IP address has failed before. This bounds the number
+	// of Secrets by the limit of each source IP address, instead of creating one for every username which is tried.
+	if !r.usernameReserved && r.sourceIPFailedBefore {
+		if err := r.limiter.fail(ctx, usernameKey, r.limiter.config.UsernameFreeFailures); err != nil {
+			plog.WarningErr("could not count failed login attempt", err, "upstreamName", r.attempt.IDPName)
+		}
+	}
+}
+
+func (r *reservation) Release(ctx context.Context) {
+	usernameKey, sourceIPKey := keys(r.attempt)
+	if r.usernameReserved {
+		if err := r.limiter.release(ctx, usernameKey, r.limiter.config.UsernameFreeFailures); err != nil {
+			plog.WarningErr("could not release login attempt", err, "upstreamName", r.attempt.IDPName)
+		}
+	}
+	if r.sourceIPReserved {
+		if err := r.limiter.release(ctx, sourceIPKey, r.limiter.config.SourceIPFreeFailures); err != nil {
+			plog.WarningErr("could not release login attempt", err, "upstreamName", r.attempt.IDPName)
+		}
+	}
+}
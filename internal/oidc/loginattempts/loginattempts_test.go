@@ -0,0 +1,400 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package loginattempts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	coretesting "k8s.io/client-go/testing"
+	clocktesting "k8s.io/utils/clock/testing"
+)
+
+const namespace = "test-ns"
+
+var fakeNow = time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC) //nolint:gochecknoglobals
+
+func testConfig() Config {
+	return Config{
+		UsernameFreeFailures: 2,
+		SourceIPFreeFailures: 4,
+		InitialBackoff:       time.Second,
+		MaxBackoff:           5 * time.Second,
+		ResetAfter:           time.Hour,
+	}
+}
+
+func newTestLimiter(t *testing.T) (Limiter, *fake.Clientset, *clocktesting.FakeClock) {
+	t.Helper()
+	return newTestLimiterWithConfig(t, testConfig())
+}
+
+func newTestLimiterWithConfig(t *testing.T, config Config) (Limiter, *fake.Clientset, *clocktesting.FakeClock) {
+	t.Helper()
+	client := fake.NewSimpleClientset()
+	clock := clocktesting.NewFakeClock(fakeNow)
+	return New(client.CoreV1().Secrets(namespace), clock.Now, config), client, clock
+}
+
+// reserveAndFail makes an attempt which is rejected by the upstream identity provider, and returns how long the
+// attempt was rejected for by the limiter instead.
+func reserveAndFail(ctx context.Context, limiter Limiter, attempt Attempt) time.Duration {
+	reservation, rejectedFor := limiter.Reserve(ctx, attempt)
+	if reservation != nil {
+		reservation.Failed(ctx)
+	}
+	return rejectedFor
+}
+
+func TestUsernameBackoff(t *testing.T) {
+	ctx := context.Background()
+	config := testConfig()
+	config.SourceIPFreeFailures = 100 // only the counter of the username rejects attempts
+	limiter, client, clock := newTestLimiterWithConfig(t, config)
+	attempt := Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "192.0.2.1"}
+
+	// The first failure of a source IP address is not counted for the username.
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+
+	// The free failures are not rejected.
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+
+	// Then the backoff doubles with each failure. Rejected attempts are not counted.
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+	clock.Step(time.Second)
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, 2*time.Second, reserveAndFail(ctx, limiter, attempt))
+	clock.Step(500 * time.Millisecond)
+	require.Equal(t, 1500*time.Millisecond, reserveAndFail(ctx, limiter, attempt))
+	clock.Step(1500 * time.Millisecond)
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, 4*time.Second, reserveAndFail(ctx, limiter, attempt))
+
+	// Until it reaches the max backoff.
+	clock.Step(4 * time.Second)
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, 5*time.Second, reserveAndFail(ctx, limiter, attempt))
+	clock.Step(5 * time.Second)
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, 5*time.Second, reserveAndFail(ctx, limiter, attempt))
+
+	// The counters are stored as Secrets which will be garbage collected after the most recent failure is forgotten.
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 2)
+	for _, secret := range secrets.Items {
+		require.Regexp(t, "^pinniped-storage-login-attempts-[a-z0-9]+$", secret.Name)
+		require.Equal(t, "login-attempts", secret.Labels["storage.pinniped.dev/type"])
+		require.Equal(t, fakeNow.Add(12*time.Second+time.Hour).Format(time.RFC3339),
+			secret.Annotations["storage.pinniped.dev/garbage-collect-after"])
+	}
+
+	// The failures are forgotten when there are no failures for a while.
+	clock.Step(time.Hour + time.Second)
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+}
+
+func TestUsernamesAreCountedSeparately(t *testing.T) {
+	ctx := context.Background()
+	limiter, _, _ := newTestLimiter(t)
+	attempt := Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "192.0.2.1"}
+
+	for i := 0; i < 4; i++ {
+		require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	}
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+
+	// The username is not case-sensitive.
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "PINNY", SourceIP: "192.0.2.1"}))
+
+	// The same username from another source IP is rejected.
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "198.51.100.1"}))
+
+	// Other usernames, or the same username of other identity providers, are allowed.
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "other-user", SourceIP: "198.51.100.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "other-idp", IDPType: "ldap", Username: "pinny", SourceIP: "198.51.100.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "activedirectory", Username: "pinny", SourceIP: "198.51.100.1"}))
+}
+
+func TestSourceIPBackoff(t *testing.T) {
+	ctx := context.Background()
+	limiter, _, _ := newTestLimiter(t)
+
+	// Guessing the passwords of many users from one source IP is rejected after the source IP free failures.
+	for _, username := range []string{"user-1", "user-2", "user-3", "user-4", "user-5"} {
+		require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: username, SourceIP: "192.0.2.1"}))
+	}
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-6", SourceIP: "192.0.2.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-6", SourceIP: "198.51.100.1"}))
+}
+
+func TestSucceeded(t *testing.T) {
+	ctx := context.Background()
+	limiter, _, _ := newTestLimiter(t)
+	attempt := Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "192.0.2.1"}
+
+	// Succeeding when there were no failures is fine.
+	reservation, rejectedFor := limiter.Reserve(ctx, attempt)
+	require.Zero(t, rejectedFor)
+	reservation.Succeeded(ctx)
+
+	for i := 0; i < 2; i++ {
+		require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "other-user", SourceIP: "192.0.2.1"}))
+	}
+	for i := 0; i < 2; i++ {
+		require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	}
+
+	// A success forgets the failures of the username, but not the failures of the source IP.
+	reservation, rejectedFor = limiter.Reserve(ctx, attempt)
+	require.Zero(t, rejectedFor)
+	reservation.Succeeded(ctx)
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "198.51.100.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "198.51.100.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "198.51.100.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "other-user-2", SourceIP: "192.0.2.1"}))
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "other-user-3", SourceIP: "192.0.2.1"}))
+}
+
+func TestSuccessesWithoutFailuresDoNotWriteCounters(t *testing.T) {
+	ctx := context.Background()
+	limiter, client, _ := newTestLimiter(t)
+
+	for _, sourceIP := range []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"} {
+		reservation, rejectedFor := limiter.Reserve(ctx, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: sourceIP})
+		require.Zero(t, rejectedFor)
+		reservation.Succeeded(ctx)
+	}
+
+	for _, action := range client.Actions() {
+		require.Equal(t, "get", action.GetVerb())
+	}
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, secrets.Items)
+}
+
+func TestIPv6SourceIPsAreCountedPerPrefix(t *testing.T) {
+	ctx := context.Background()
+	limiter, client, _ := newTestLimiter(t)
+
+	// Rotating through the addresses of a /64 prefix does not evade the limit of the source IP.
+	for i, sourceIP := range []string{"2001:db8:1:2::1", "2001:db8:1:2::2", "2001:db8:1:2:ffff::3", "2001:db8:1:2::4", "2001:db8:1:2::5"} {
+		require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: fmt.Sprintf("user-%d", i), SourceIP: sourceIP}))
+	}
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-6", SourceIP: "2001:db8:1:2::6"}))
+
+	// Other prefixes are counted separately.
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-6", SourceIP: "2001:db8:1:3::6"}))
+
+	// Only one counter is stored per prefix, besides the counters of the usernames which were tried once the
+	// prefix had failed before.
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 2+4)
+}
+
+func TestSourceIPBucket(t *testing.T) {
+	require.Equal(t, "192.0.2.1", sourceIPBucket("192.0.2.1"))
+	require.Equal(t, "2001:db8:1:2::/64", sourceIPBucket("2001:db8:1:2:3:4:5:6"))
+	require.Equal(t, "not-an-ip", sourceIPBucket("not-an-ip"))
+}
+
+func TestRelease(t *testing.T) {
+	ctx := context.Background()
+	limiter, _, _ := newTestLimiter(t)
+	attempt := Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "192.0.2.1"}
+
+	// Released attempts, e.g. because the upstream identity provider was unreachable, are never counted.
+	for i := 0; i < 10; i++ {
+		reservation, rejectedFor := limiter.Reserve(ctx, attempt)
+		require.Zero(t, rejectedFor)
+		reservation.Release(ctx)
+	}
+
+	for i := 0; i < 4; i++ {
+		require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	}
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+}
+
+func TestUsernameCountersAreOnlyStoredForFailingSourceIPs(t *testing.T) {
+	ctx := context.Background()
+	limiter, client, _ := newTestLimiter(t)
+
+	// Trying many usernames from many source IP addresses only stores the counters of the addresses.
+	for _, sourceIP := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-" + sourceIP, SourceIP: sourceIP}))
+	}
+	secrets, err := client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 3)
+
+	// Once a source IP address has failed, the counters of the usernames which it tries are stored too.
+	for _, username := range []string{"user-1", "user-2"} {
+		require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: username, SourceIP: "192.0.2.1"}))
+	}
+	secrets, err = client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, secrets.Items, 5)
+
+	// The counter of a username is updated from any source IP address once it has been stored.
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-1", SourceIP: "198.51.100.1"}))
+	require.Zero(t, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-1", SourceIP: "198.51.100.2"}))
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "user-1", SourceIP: "198.51.100.3"}))
+}
+
+func TestReserveRetriesConflicts(t *testing.T) {
+	ctx := context.Background()
+	limiter, client, _ := newTestLimiter(t)
+	attempt := Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "192.0.2.1"}
+
+	for i := 0; i < 3; i++ {
+		require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	}
+
+	// Another pod reserves the last free failure of the username at the same time. The counter of the source IP is
+	// updated first, so the second update is the counter of the username.
+	updates := 0
+	client.PrependReactor("update", "secrets", func(action coretesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates != 2 {
+			return false, nil, nil
+		}
+		secret := action.(coretesting.UpdateAction).GetObject()
+		require.NoError(t, client.Tracker().Update(schema.GroupVersionResource{Version: "v1", Resource: "secrets"}, secret, namespace))
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "secrets"}, "some-secret", nil)
+	})
+
+	// The attempt sees the reservation of the other pod, so it is rejected instead of exceeding the free failures.
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+	require.Equal(t, 3, updates) // the reservation of the source IP was also released
+
+	// The other pod's reservation is counted.
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+}
+
+func TestReserveAllowsAttemptsWhenCountersCannotBeRead(t *testing.T) {
+	ctx := context.Background()
+	limiter, client, _ := newTestLimiter(t)
+	attempt := Attempt{IDPName: "some-idp", IDPType: "ldap", Username: "pinny", SourceIP: "192.0.2.1"}
+
+	for i := 0; i < 4; i++ {
+		require.Zero(t, reserveAndFail(ctx, limiter, attempt))
+	}
+	require.Equal(t, time.Second, reserveAndFail(ctx, limiter, attempt))
+
+	client.PrependReactor("get", "secrets", func(action coretesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewServiceUnavailable("some get error")
+	})
+	reservation, rejectedFor := limiter.Reserve(ctx, attempt)
+	require.Zero(t, rejectedFor)
+	reservation.Release(ctx)
+}
+
+func TestSourceIP(t *testing.T) {
+	_, proxies, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+	_, ipv6Proxies, err := net.ParseCIDR("2001:db8::/32")
+	require.NoError(t, err)
+	trustedProxies := []*net.IPNet{proxies, ipv6Proxies}
+
+	tests := []struct {
+		name           string
+		remoteAddr     string
+		forwardedFor   []string
+		trustedProxies []*net.IPNet
+		want           string
+	}{
+		{
+			name:       "no trusted proxies",
+			remoteAddr: "192.0.2.1:1234",
+			want:       "192.0.2.1",
+		},
+		{
+			name:         "X-Forwarded-For is ignored without trusted proxies",
+			remoteAddr:   "10.0.0.1:1234",
+			forwardedFor: []string{"192.0.2.1"},
+			want:         "10.0.0.1",
+		},
+		{
+			name:           "X-Forwarded-For of an untrusted client is ignored",
+			remoteAddr:     "198.51.100.1:1234",
+			forwardedFor:   []string{"192.0.2.1"},
+			trustedProxies: trustedProxies,
+			want:           "198.51.100.1",
+		},
+		{
+			name:           "trusted proxy",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"192.0.2.1"},
+			trustedProxies: trustedProxies,
+			want:           "192.0.2.1",
+		},
+		{
+			name:           "trusted IPv6 proxy",
+			remoteAddr:     "[2001:db8::1]:1234",
+			forwardedFor:   []string{"2001:db9::1"},
+			trustedProxies: trustedProxies,
+			want:           "2001:db9::1",
+		},
+		{
+			name:           "addresses which were added by the client before the trusted proxies are ignored",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"203.0.113.1, 192.0.2.1", "10.0.0.2"},
+			trustedProxies: trustedProxies,
+			want:           "192.0.2.1",
+		},
+		{
+			name:           "every address is a trusted proxy",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"10.0.0.3, 10.0.0.2"},
+			trustedProxies: trustedProxies,
+			want:           "10.0.0.3",
+		},
+		{
+			name:           "trusted proxy without X-Forwarded-For",
+			remoteAddr:     "10.0.0.1:1234",
+			trustedProxies: trustedProxies,
+			want:           "10.0.0.1",
+		},
+		{
+			name:           "trusted proxy forwarded an invalid address",
+			remoteAddr:     "10.0.0.1:1234",
+			forwardedFor:   []string{"192.0.2.1, not-an-ip, 10.0.0.2"},
+			trustedProxies: trustedProxies,
+			want:           "10.0.0.2",
+		},
+		{
+			name:       "remote address without a port",
+			remoteAddr: "192.0.2.1",
+			want:       "192.0.2.1",
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			r := &http.Request{RemoteAddr: test.remoteAddr, Header: http.Header{}}
+			for _, forwardedFor := range test.forwardedFor {
+				r.Header.Add("X-Forwarded-For", forwardedFor)
+			}
+			require.Equal(t, test.want, SourceIP(r, test.trustedProxies))
+		})
+	}
+}
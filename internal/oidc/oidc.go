@@ -1,10 +1,11 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package oidc contains common OIDC functionality needed by Pinniped.
 package oidc
 
 import (
+	"net/url"
 	"time"
 
 	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
@@ -24,6 +25,7 @@ const (
 	AuthorizationEndpointPath = "/oauth2/authorize"
 	TokenEndpointPath         = "/oauth2/token" //nolint:gosec // ignore lint warning that this is a credential
 	CallbackEndpointPath      = "/callback"
+	SAMLACSEndpointPath       = "/saml/acs"
 	JWKSEndpointPath          = "/jwks.json"
 	PinnipedIDPsPathV1Alpha1  = "/v1alpha1/pinniped_identity_providers"
 )
@@ -232,7 +234,7 @@ func FositeOauth2Helper(
 		compose.OAuth2PKCEFactory,
 		TokenExchangeFactory, // handle the "urn:ietf:params:oauth:grant-type:token-exchange" grant type
 	)
-	provider.(*fosite.Fosite).FormPostHTMLTemplate = formposthtml.Template()
+	provider.(*fosite.Fosite).FormPostHTMLTemplate = formposthtml.Template(nil)
 	return provider
 }
 
@@ -275,10 +277,40 @@ type UpstreamActiveDirectoryIdentityProviderLister interface {
 	GetActiveDirectoryIdentityProviders() []provider.UpstreamLDAPIdentityProviderI
 }
 
+type UpstreamGitHubIdentityProvidersLister interface {
+	GetGitHubIdentityProviders() []provider.UpstreamGitHubIdentityProviderI
+}
+
+type UpstreamSAMLIdentityProvidersLister interface {
+	GetSAMLIdentityProviders() []provider.UpstreamSAMLIdentityProviderI
+}
+
+type UpstreamOAuth2IdentityProvidersLister interface {
+	GetOAuth2IdentityProviders() []provider.UpstreamOAuth2IdentityProviderI
+}
+
+type UpstreamWebhookIdentityProvidersLister interface {
+	GetWebhookIdentityProviders() []provider.UpstreamLDAPIdentityProviderI
+}
+
+type UpstreamLocalIdentityProvidersLister interface {
+	GetLocalIdentityProviders() []provider.UpstreamLDAPIdentityProviderI
+}
+
+type WorkloadIdentityProvidersLister interface {
+	GetWorkloadIdentityProviders() []provider.WorkloadIdentityProviderI
+}
+
 type UpstreamIdentityProvidersLister interface {
 	UpstreamOIDCIdentityProvidersLister
 	UpstreamLDAPIdentityProvidersLister
 	UpstreamActiveDirectoryIdentityProviderLister
+	UpstreamGitHubIdentityProvidersLister
+	UpstreamSAMLIdentityProvidersLister
+	UpstreamOAuth2IdentityProvidersLister
+	UpstreamWebhookIdentityProvidersLister
+	UpstreamLocalIdentityProvidersLister
+	WorkloadIdentityProvidersLister
 }
 
 func GrantScopeIfRequested(authorizeRequester fosite.AuthorizeRequester, scopeName string) {
@@ -295,3 +327,20 @@ func ScopeWasRequested(authorizeRequester fosite.AuthorizeRequester, scopeName s
 	}
 	return false
 }
+
+// SAMLServiceProviderForIssuer returns the SAML service provider of the Supervisor for the FederationDomain with
+// the given issuer. Its entity ID is the issuer, and its assertion consumer service is below the issuer.
+func SAMLServiceProviderForIssuer(downstreamIssuer string) provider.SAMLServiceProvider {
+	sp := provider.SAMLServiceProvider{EntityID: downstreamIssuer}
+	// The issuer was already validated as a URL when the FederationDomain was loaded.
+	if acsURL, err := url.Parse(downstreamIssuer + SAMLACSEndpointPath); err == nil {
+		sp.ACSURL = *acsURL
+	}
+	return sp
+}
+
+// SAMLRequestID returns the ID of the SAML authentication request which is made for an authorization request,
+// which is derived from its nonce. XML IDs must not start with a digit, so a prefix is added.
+func SAMLRequestID(nonceValue nonce.Nonce) string {
+	return "id-" + string(nonceValue)
+}
@@ -0,0 +1,268 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package branding validates the customizations which an admin may make to the HTML pages served by a FederationDomain.
+package branding
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/tdewolff/minify/v2/minify"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"go.pinniped.dev/internal/constable"
+)
+
+const (
+	StyleKey  = "style.css"
+	HeaderKey = "header.gohtml"
+	FooterKey = "footer.gohtml"
+)
+
+// logoContentTypes maps the allowed keys for a logo to the content type of the image.
+var logoContentTypes = map[string]string{ //nolint:gochecknoglobals
+	"logo.png": "image/png",
+	"logo.jpg": "image/jpeg",
+	"logo.svg": "image/svg+xml",
+}
+
+// allowedElements are the only HTML elements which may be used by the header and footer templates.
+var allowedElements = map[atom.Atom]bool{ //nolint:gochecknoglobals
+	atom.A: true, atom.B: true, atom.Br: true, atom.Div: true, atom.Em: true, atom.Footer: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.Header: true, atom.Hr: true,
+	atom.I: true, atom.Img: true, atom.Li: true, atom.Nav: true, atom.Ol: true, atom.P: true,
+	atom.Small: true, atom.Span: true, atom.Strong: true, atom.Ul: true,
+}
+
+// voidElements are the allowed elements which do not have an end tag.
+var voidElements = map[atom.Atom]bool{atom.Br: true, atom.Hr: true, atom.Img: true} //nolint:gochecknoglobals
+
+// allowedAttributes are the only HTML attributes which may be used by the header and footer templates.
+var allowedAttributes = map[string]bool{ //nolint:gochecknoglobals
+	"class": true, "id": true, "title": true, "alt": true, "href": true, "src": true,
+}
+
+// FragmentData is the data which is available to the header and footer templates.
+type FragmentData struct {
+	// LogoURL is a data URL of the logo, or empty when there is no logo.
+	LogoURL template.URL
+}
+
+// Branding is the validated customization of the HTML pages served by a FederationDomain.
+// A nil *Branding is valid and means that the pages should not be customized.
+type Branding struct {
+	css     string
+	cssHash string
+	header  template.HTML
+	footer  template.HTML
+}
+
+// New validates the contents of a branding ConfigMap and returns the resulting Branding.
+func New(data map[string]string, binaryData map[string][]byte) (*Branding, error) {
+	values := map[string][]byte{}
+	for k, v := range data {
+		values[k] = []byte(v)
+	}
+	for k, v := range binaryData {
+		if _, exists := values[k]; exists {
+			return nil, fmt.Errorf("key %q must not be in both data and binaryData", k)
+		}
+		values[k] = v
+	}
+
+	var logoKeys []string
+	for k := range values {
+		switch {
+		case k == StyleKey, k == HeaderKey, k == FooterKey:
+		case logoContentTypes[k] != "":
+			logoKeys = append(logoKeys, k)
+		default:
+			return nil, fmt.Errorf("key %q is not allowed", k)
+		}
+	}
+	if len(logoKeys) > 1 {
+		sort.Strings(logoKeys)
+		return nil, fmt.Errorf("only one logo is allowed but found keys %s", strings.Join(logoKeys, ", "))
+	}
+
+	b := Branding{}
+
+	if css, ok := values[StyleKey]; ok {
+		minified, err := minify.CSS(string(css))
+		if err != nil {
+			return nil, fmt.Errorf("key %q could not be parsed: %w", StyleKey, err)
+		}
+		// The stylesheet is rendered inside a style element, so it must not be able to close that element.
+		if strings.Contains(minified, "<") {
+			return nil, fmt.Errorf("key %q must not contain the character %q", StyleKey, "<")
+		}
+		b.css = minified
+		b.cssHash = cspHash(minified)
+	}
+
+	fragmentData := FragmentData{}
+	if len(logoKeys) == 1 {
+		fragmentData.LogoURL = template.URL( //nolint:gosec // the logo is only ever used as the src of an img element
+			"data:" + logoContentTypes[logoKeys[0]] + ";base64," + base64.StdEncoding.EncodeToString(values[logoKeys[0]]),
+		)
+	}
+
+	var err error
+	if headerTemplate, ok := values[HeaderKey]; ok {
+		if b.header, err = renderFragment(HeaderKey, string(headerTemplate), fragmentData); err != nil {
+			return nil, err
+		}
+	} else if fragmentData.LogoURL != "" {
+		b.header, err = renderFragment(HeaderKey, `<div class="branding-header"><img class="branding-logo" src="{{ .LogoURL }}" alt=""></div>`, fragmentData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if footerTemplate, ok := values[FooterKey]; ok {
+		if b.footer, err = renderFragment(FooterKey, string(footerTemplate), fragmentData); err != nil {
+			return nil, err
+		}
+	}
+
+	return &b, nil
+}
+
+// CSS returns the custom stylesheet, which is empty when there is none.
+func (b *Branding) CSS() template.CSS {
+	if b == nil {
+		return ""
+	}
+	return template.CSS(b.css) //nolint:gosec // the stylesheet was validated by New()
+}
+
+// Header returns the custom HTML to show at the top of each page, which is empty when there is none.
+func (b *Branding) Header() template.HTML {
+	if b == nil {
+		return ""
+	}
+	return b.header
+}
+
+// Footer returns the custom HTML to show at the bottom of each page, which is empty when there is none.
+func (b *Branding) Footer() template.HTML {
+	if b == nil {
+		return ""
+	}
+	return b.footer
+}
+
+// FuncMap returns the functions which a page template uses to render the Branding.
+func (b *Branding) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"brandingCSS":    b.CSS,
+		"brandingHeader": b.Header,
+		"brandingFooter": b.Footer,
+	}
+}
+
+// StyleSources returns the additional Content-Security-Policy style-src sources needed to render the Branding.
+func (b *Branding) StyleSources() []string {
+	if b == nil || b.cssHash == "" {
+		return nil
+	}
+	return []string{"'" + b.cssHash + "'"}
+}
+
+func renderFragment(key string, text string, data FragmentData) (template.HTML, error) {
+	tmpl, err := template.New(key).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("key %q could not be parsed: %w", key, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("key %q could not be rendered: %w", key, err)
+	}
+
+	if err := validateFragment(buf.String()); err != nil {
+		return "", fmt.Errorf("key %q is not allowed: %w", key, err)
+	}
+
+	return template.HTML(buf.String()), nil //nolint:gosec // the fragment was validated above
+}
+
+// validateFragment makes sure that the rendered HTML only uses allowed elements and attributes, so that
+// it cannot run scripts, load resources, or change the structure of the page around it.
+func validateFragment(rendered string) error {
+	var openElements []atom.Atom
+	tokenizer := html.NewTokenizer(strings.NewReader(rendered))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if tokenizer.Err() != io.EOF {
+				return tokenizer.Err()
+			}
+			if len(openElements) > 0 {
+				return fmt.Errorf("element %q is not closed", openElements[len(openElements)-1].String())
+			}
+			return nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if !allowedElements[token.DataAtom] {
+				return fmt.Errorf("element %q is not allowed", token.Data)
+			}
+			for _, attr := range token.Attr {
+				if err := validateAttribute(token, attr); err != nil {
+					return err
+				}
+			}
+			if !voidElements[token.DataAtom] {
+				openElements = append(openElements, token.DataAtom)
+			}
+		case html.EndTagToken:
+			token := tokenizer.Token()
+			if len(openElements) == 0 || openElements[len(openElements)-1] != token.DataAtom {
+				return fmt.Errorf("end tag %q does not match an open element", token.Data)
+			}
+			openElements = openElements[:len(openElements)-1]
+		case html.DoctypeToken:
+			return constable.Error("doctype is not allowed")
+		case html.TextToken, html.CommentToken:
+		}
+	}
+}
+
+func validateAttribute(token html.Token, attr html.Attribute) error {
+	if attr.Namespace != "" || !allowedAttributes[attr.Key] {
+		return fmt.Errorf("attribute %q is not allowed", attr.Key)
+	}
+	switch attr.Key {
+	case "href":
+		if token.DataAtom != atom.A || !hasAnyPrefix(attr.Val, "https://", "http://", "mailto:") {
+			return fmt.Errorf("attribute %q must be an https, http or mailto URL on an a element", attr.Key)
+		}
+	case "src":
+		if token.DataAtom != atom.Img || !strings.HasPrefix(attr.Val, "data:image/") {
+			return fmt.Errorf("attribute %q must be the logo URL on an img element", attr.Key)
+		}
+	}
+	return nil
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(strings.ToLower(s), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func cspHash(s string) string {
+	hashBytes := sha256.Sum256([]byte(s))
+	return "sha256-" + base64.StdEncoding.EncodeToString(hashBytes[:])
+}
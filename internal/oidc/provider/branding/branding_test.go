@@ -0,0 +1,147 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package branding
+
+import (
+	"html/template"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	pngLogo := []byte{0x89, 'P', 'N', 'G'}
+	pngLogoURL := "data:image/png;base64,iVBORw=="
+
+	tests := []struct {
+		name             string
+		data             map[string]string
+		binaryData       map[string][]byte
+		wantErr          string
+		wantCSS          template.CSS
+		wantStyleSources []string
+		wantHeader       template.HTML
+		wantFooter       template.HTML
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:             "stylesheet",
+			data:             map[string]string{"style.css": "body {\n  color: #ff0000;\n}\n"},
+			wantCSS:          "body{color:red}",
+			wantStyleSources: []string{"'sha256-FcQqt3aNlV7AZnGV4zkQRVeCeJOxbMPnQSx258L803E='"},
+		},
+		{
+			name:    "stylesheet which could close the style element",
+			data:    map[string]string{"style.css": `body { content: "</style><script>alert(1)</script>" }`},
+			wantErr: `key "style.css" must not contain the character "<"`,
+		},
+		{
+			name:       "logo without a header template uses a default header",
+			binaryData: map[string][]byte{"logo.png": pngLogo},
+			wantHeader: template.HTML(`<div class="branding-header"><img class="branding-logo" src="` + pngLogoURL + `" alt=""></div>`),
+		},
+		{
+			name:       "header and footer templates",
+			binaryData: map[string][]byte{"logo.png": pngLogo},
+			data: map[string]string{
+				"header.gohtml": `<header class="top"><img src="{{ .LogoURL }}" alt="Example Corp"><h1>Example Corp</h1></header>`,
+				"footer.gohtml": `<p>Need help? <a href="https://help.example.com">Contact us</a> or <a href="mailto:help@example.com">email us</a>.</p>`,
+			},
+			wantHeader: template.HTML(`<header class="top"><img src="` + pngLogoURL + `" alt="Example Corp"><h1>Example Corp</h1></header>`),
+			wantFooter: `<p>Need help? <a href="https://help.example.com">Contact us</a> or <a href="mailto:help@example.com">email us</a>.</p>`,
+		},
+		{
+			name:    "unknown key",
+			data:    map[string]string{"script.js": "alert(1)"},
+			wantErr: `key "script.js" is not allowed`,
+		},
+		{
+			name:       "key in both data and binaryData",
+			data:       map[string]string{"logo.svg": "<svg/>"},
+			binaryData: map[string][]byte{"logo.svg": []byte("<svg/>")},
+			wantErr:    `key "logo.svg" must not be in both data and binaryData`,
+		},
+		{
+			name:       "more than one logo",
+			data:       map[string]string{"logo.svg": "<svg/>"},
+			binaryData: map[string][]byte{"logo.png": pngLogo},
+			wantErr:    "only one logo is allowed but found keys logo.png, logo.svg",
+		},
+		{
+			name:    "header template which cannot be parsed",
+			data:    map[string]string{"header.gohtml": `<p>{{ .LogoURL </p>`},
+			wantErr: `key "header.gohtml" could not be parsed: template: header.gohtml:1: unexpected "<" in operand`,
+		},
+		{
+			name:    "header template which cannot be rendered",
+			data:    map[string]string{"header.gohtml": `<p>{{ .Secrets }}</p>`},
+			wantErr: `key "header.gohtml" could not be rendered: template: header.gohtml:1:6: executing "header.gohtml" at <.Secrets>: can't evaluate field Secrets in type branding.FragmentData`,
+		},
+		{
+			name:    "header with a script",
+			data:    map[string]string{"header.gohtml": `<div><script>alert(1)</script></div>`},
+			wantErr: `key "header.gohtml" is not allowed: element "script" is not allowed`,
+		},
+		{
+			name:    "header with an event handler",
+			data:    map[string]string{"header.gohtml": `<div onclick="alert(1)">hi</div>`},
+			wantErr: `key "header.gohtml" is not allowed: attribute "onclick" is not allowed`,
+		},
+		{
+			name:    "header with a style attribute",
+			data:    map[string]string{"header.gohtml": `<div style="display:none">hi</div>`},
+			wantErr: `key "header.gohtml" is not allowed: attribute "style" is not allowed`,
+		},
+		{
+			name:    "footer with a javascript link",
+			data:    map[string]string{"footer.gohtml": `<a href="javascript:alert(1)">hi</a>`},
+			wantErr: `key "footer.gohtml" is not allowed: attribute "href" must be an https, http or mailto URL on an a element`,
+		},
+		{
+			name:    "footer with an image which is not the logo",
+			data:    map[string]string{"footer.gohtml": `<img src="https://example.com/tracker.png">`},
+			wantErr: `key "footer.gohtml" is not allowed: attribute "src" must be the logo URL on an img element`,
+		},
+		{
+			name:    "footer which leaves an element open",
+			data:    map[string]string{"footer.gohtml": `<div><p>hi</p>`},
+			wantErr: `key "footer.gohtml" is not allowed: element "div" is not closed`,
+		},
+		{
+			name:    "footer which closes an element that it did not open",
+			data:    map[string]string{"footer.gohtml": `</div><p>hi</p>`},
+			wantErr: `key "footer.gohtml" is not allowed: end tag "div" does not match an open element`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(tt.data, tt.binaryData)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, b)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantCSS, b.CSS())
+			require.Equal(t, tt.wantStyleSources, b.StyleSources())
+			require.Equal(t, tt.wantHeader, b.Header())
+			require.Equal(t, tt.wantFooter, b.Footer())
+		})
+	}
+}
+
+func TestNilBranding(t *testing.T) {
+	var b *Branding
+	require.Empty(t, b.CSS())
+	require.Empty(t, b.Header())
+	require.Empty(t, b.Footer())
+	require.Nil(t, b.StyleSources())
+
+	funcs := b.FuncMap()
+	require.Len(t, funcs, 3)
+	require.Empty(t, funcs["brandingCSS"].(func() template.CSS)())
+}
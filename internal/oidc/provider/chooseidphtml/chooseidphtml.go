@@ -0,0 +1,95 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package chooseidphtml defines the HTML template for the page which lets a user choose an upstream identity provider.
+//nolint: gochecknoglobals // This package uses globals to ensure that all parsing and minifying happens at init.
+package chooseidphtml
+
+import (
+	"crypto/sha256"
+	_ "embed" // Needed to trigger //go:embed directives below.
+	"encoding/base64"
+	"html/template"
+	"strings"
+
+	"github.com/tdewolff/minify/v2/minify"
+
+	"go.pinniped.dev/internal/oidc/provider/branding"
+)
+
+var (
+	//go:embed choose_idp.css
+	rawCSS      string
+	minifiedCSS = mustMinify(minify.CSS(rawCSS))
+
+	//go:embed choose_idp.gohtml
+	rawHTMLTemplate string
+)
+
+// Parse the unbranded template and generate its CSP header value once since they are effectively constant.
+var (
+	parsedHTMLTemplate = parseTemplate(nil)
+	cspValue           = contentSecurityPolicy(nil)
+)
+
+// Parse the Go templated HTML and inject functions providing the minified inline CSS and the branding.
+func parseTemplate(b *branding.Branding) *template.Template {
+	return template.Must(template.New("choose_idp.gohtml").Funcs(b.FuncMap()).Funcs(template.FuncMap{
+		"minifiedCSS": func() template.CSS { return template.CSS(minifiedCSS) },
+	}).Parse(rawHTMLTemplate))
+}
+
+// The page has no scripts. Images are only allowed for the logo from the branding.
+func contentSecurityPolicy(b *branding.Branding) string {
+	return strings.Join([]string{
+		`default-src 'none'`,
+		strings.Join(append([]string{`style-src '` + cspHash(minifiedCSS) + `'`}, b.StyleSources()...), " "),
+		`img-src data:`,
+		`frame-ancestors 'none'`,
+	}, "; ")
+}
+
+// PageData is the data used to render the Template().
+type PageData struct {
+	IdentityProviders []IdentityProvider
+}
+
+// IdentityProvider is one of the choices on the page.
+type IdentityProvider struct {
+	Name string
+	Type string
+
+	// LoginURL continues the authorization request using this identity provider. It is empty when the identity
+	// provider does not support logging in using a web browser.
+	LoginURL string
+}
+
+func mustMinify(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func cspHash(s string) string {
+	hashBytes := sha256.Sum256([]byte(s))
+	return "sha256-" + base64.StdEncoding.EncodeToString(hashBytes[:])
+}
+
+// ContentSecurityPolicy returns the Content-Security-Policy header value to make the Template() operate correctly.
+// The branding may be nil.
+func ContentSecurityPolicy(b *branding.Branding) string {
+	if b == nil {
+		return cspValue
+	}
+	return contentSecurityPolicy(b)
+}
+
+// Template returns the html/template.Template for rendering the page which lets a user choose an identity provider.
+// The branding may be nil. A branded template is parsed on each call, so callers should keep the result.
+func Template(b *branding.Branding) *template.Template {
+	if b == nil {
+		return parsedHTMLTemplate
+	}
+	return parseTemplate(b)
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package chooseidphtml
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+)
+
+var (
+	testPageData = PageData{
+		IdentityProviders: []IdentityProvider{
+			{Name: "some-ldap-idp", Type: "ldap"},
+			{Name: "some-oidc-idp", Type: "oidc", LoginURL: "?client_id=pinniped-cli&pinniped_idp_name=some-oidc-idp&pinniped_idp_type=oidc&scope=openid+offline_access"},
+		},
+	}
+
+	testExpectedOutput = here.Doc(`
+        <!DOCTYPE html>
+        <html lang="en">
+        <head>
+            <meta charset="UTF-8">
+            <title>Choose an identity provider</title>
+            <style>body{font-family:metropolis-light,Helvetica,sans-serif}h1{font-size:20px}.box{position:absolute;top:100px;left:50%;width:400px;margin-left:-200px;font-size:14px;line-height:24px}ul{padding:0;list-style:none}li{margin:10px 0}a,.unavailable{display:block;padding:10px;border:1px solid #ddd;color:#1b3951;text-decoration:none}a:hover{background-color:#eee}.unavailable{color:#777}.type{float:right;color:#777}</style>
+        </head>
+        <body>
+        <div class="box">
+            <h1>Choose an identity provider</h1>
+            <p>Choose how you would like to log in:</p>
+            <ul>
+                <li>
+                    <span class="unavailable">some-ldap-idp (only available from the command line)<span class="type">ldap</span></span>
+                </li>
+                <li>
+                    <a href="?client_id=pinniped-cli&amp;pinniped_idp_name=some-oidc-idp&amp;pinniped_idp_type=oidc&amp;scope=openid&#43;offline_access">some-oidc-idp<span class="type">oidc</span></a>
+                </li>
+            </ul>
+        </div>
+        </body>
+        </html>
+	`)
+
+	// It's okay if this changes in the future, but this gives us a chance to eyeball the formatting.
+	testExpectedCSP = `default-src 'none'; ` +
+		`style-src 'sha256-fHRVOcctuW6lqLVgx0oJmkOnHLsWyLZd1MFKd864TqU='; ` +
+		`img-src data:; ` +
+		`frame-ancestors 'none'`
+)
+
+func TestTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Template(nil).Execute(&buf, &testPageData))
+
+	// t.Logf("actual value:\n%s", buf.String()) // useful when updating minify library causes new output
+	require.Equal(t, testExpectedOutput, buf.String())
+}
+
+func TestContentSecurityPolicyHashes(t *testing.T) {
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicy(nil))
+}
+
+func TestBrandedTemplate(t *testing.T) {
+	b, err := branding.New(map[string]string{
+		"style.css":     "body { color: red; }",
+		"header.gohtml": `<div class="header">Example Corp</div>`,
+		"footer.gohtml": `<p class="footer">Need help?</p>`,
+	}, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, Template(b).Execute(&buf, &testPageData))
+	require.Contains(t, buf.String(), "</style><style>body{color:red}</style>\n")
+	require.Contains(t, buf.String(), "<body><div class=\"header\">Example Corp</div>\n")
+	require.Contains(t, buf.String(), "</div><p class=\"footer\">Need help?</p>\n</body>")
+
+	// The stylesheet must be allowed by the CSP, which should otherwise be unchanged.
+	require.Equal(t,
+		strings.Replace(testExpectedCSP, "; img-src", " 'sha256-FcQqt3aNlV7AZnGV4zkQRVeCeJOxbMPnQSx258L803E='; img-src", 1),
+		ContentSecurityPolicy(b),
+	)
+}
+
+func TestHelpers(t *testing.T) {
+	// These are silly tests but it's easy to we might as well have them.
+	require.Equal(t, "test", mustMinify("test", nil))
+	require.PanicsWithError(t, "some error", func() { mustMinify("", fmt.Errorf("some error")) })
+
+	// Example test vector from https://content-security-policy.com/hash/.
+	require.Equal(t, "sha256-RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc=", cspHash("doSomething();"))
+}
@@ -6,8 +6,10 @@ package provider
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
 	"k8s.io/apimachinery/pkg/types"
@@ -111,12 +113,152 @@ type UpstreamLDAPIdentityProviderI interface {
 	PerformRefresh(ctx context.Context, storedRefreshAttributes StoredRefreshAttributes) (groups []string, err error)
 }
 
+// UpstreamKerberosIdentityProviderI is optionally implemented by an UpstreamLDAPIdentityProviderI which can also
+// authenticate users using Kerberos tickets.
+type UpstreamKerberosIdentityProviderI interface {
+	// AllowsKerberos returns true when users may authenticate using Kerberos tickets.
+	AllowsKerberos() bool
+
+	// AuthenticateKerberosUser validates the Kerberos ticket in a SPNEGO token and looks up the user who owns it.
+	// Returns false when the ticket is not valid.
+	AuthenticateKerberosUser(ctx context.Context, negotiateToken []byte) (*authenticators.Response, bool, error)
+}
+
+type UpstreamGitHubIdentityProviderI interface {
+	// GetName returns a name for this upstream provider, which will be used as a component of the path for the
+	// callback endpoint hosted by the Supervisor.
+	GetName() string
+
+	// GetResourceUID returns the Kubernetes resource ID
+	GetResourceUID() types.UID
+
+	// GetClientID returns the OAuth client ID registered with GitHub to be used in the authorization code flow.
+	GetClientID() string
+
+	// GetAuthorizationURL returns the authorization endpoint of GitHub.
+	GetAuthorizationURL() string
+
+	// GetScopes returns the scopes to request in the authorization code flow.
+	GetScopes() []string
+
+	// ExchangeAuthcode performs the upstream OAuth2 authorization code exchange and returns the GitHub access token.
+	ExchangeAuthcode(ctx context.Context, authcode string, redirectURI string) (string, error)
+
+	// GetUser uses the GitHub API to look up the user who owns the access token, including their team memberships.
+	// It returns an error when the user is not allowed to authenticate according to the configuration of this provider.
+	GetUser(ctx context.Context, accessToken string) (*GitHubUser, error)
+}
+
+// GitHubUser is the identity of a GitHub user, as determined by an UpstreamGitHubIdentityProviderI.
+type GitHubUser struct {
+	Username          string
+	Groups            []string
+	DownstreamSubject string
+}
+
+type UpstreamSAMLIdentityProviderI interface {
+	// GetName returns a name for this upstream provider.
+	GetName() string
+
+	// GetResourceUID returns the Kubernetes resource ID
+	GetResourceUID() types.UID
+
+	// AuthnRequestURL returns the URL of the single sign-on service of the identity provider, including a SAML
+	// authentication request with the given ID using the HTTP-Redirect binding, and the given relay state.
+	AuthnRequestURL(sp SAMLServiceProvider, requestID string, relayState string) (*url.URL, error)
+
+	// ParseResponse validates the SAML response which was posted to the assertion consumer service by the
+	// identity provider in response to the authentication request with the given ID, and returns the identity
+	// of the user from its assertion.
+	ParseResponse(r *http.Request, sp SAMLServiceProvider, requestID string) (*SAMLUser, error)
+}
+
+// SAMLServiceProvider describes the Supervisor in its role as a SAML service provider for a FederationDomain.
+type SAMLServiceProvider struct {
+	EntityID string
+	ACSURL   url.URL
+}
+
+// SAMLUser is the identity of a user, as determined by an UpstreamSAMLIdentityProviderI.
+type SAMLUser struct {
+	Username          string
+	Groups            []string
+	DownstreamSubject string
+
+	// SessionNotOnOrAfter is the time after which the identity provider wants the session to end, or the zero time
+	// when the identity provider did not specify one.
+	SessionNotOnOrAfter time.Time
+}
+
+type UpstreamOAuth2IdentityProviderI interface {
+	// GetName returns a name for this upstream provider, which will be used as a component of the path for the
+	// callback endpoint hosted by the Supervisor.
+	GetName() string
+
+	// GetResourceUID returns the Kubernetes resource ID
+	GetResourceUID() types.UID
+
+	// GetClientID returns the OAuth client ID registered with the upstream provider to be used in the authorization code flow.
+	GetClientID() string
+
+	// GetAuthorizationURL returns the authorization endpoint of the upstream provider.
+	GetAuthorizationURL() string
+
+	// GetScopes returns the scopes to request in the authorization code flow.
+	GetScopes() []string
+
+	// GetAdditionalAuthcodeParams returns additional params to be sent on authcode requests.
+	GetAdditionalAuthcodeParams() map[string]string
+
+	// ExchangeAuthcode performs the upstream OAuth2 authorization code exchange using the PKCE code verifier,
+	// and returns the tokens from the token endpoint.
+	ExchangeAuthcode(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, redirectURI string) (*oauth2.Token, error)
+
+	// PerformRefresh uses the upstream refresh token to get new tokens from the token endpoint.
+	PerformRefresh(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+
+	// GetUser uses the profile endpoint to look up the user who owns the access token.
+	GetUser(ctx context.Context, accessToken string) (*OAuth2User, error)
+}
+
+// OAuth2User is the identity of a user, as determined by an UpstreamOAuth2IdentityProviderI.
+type OAuth2User struct {
+	Username          string
+	Groups            []string
+	DownstreamSubject string
+}
+
+type WorkloadIdentityProviderI interface {
+	// GetName returns a name for this workload identity provider.
+	GetName() string
+
+	// GetResourceUID returns the Kubernetes resource ID
+	GetResourceUID() types.UID
+
+	// GetIssuer returns the issuer of the JWTs which this provider accepts.
+	GetIssuer() string
+
+	// AuthenticateToken validates a JWT which was issued to a workload and maps its claims to a downstream identity.
+	// It returns an error when the JWT is not valid or is not acceptable.
+	AuthenticateToken(ctx context.Context, token string) (*WorkloadIdentity, error)
+}
+
+// WorkloadIdentity is the identity of a workload, as determined by a WorkloadIdentityProviderI.
+type WorkloadIdentity struct {
+	Username          string
+	Groups            []string
+	DownstreamSubject string
+}
+
 type StoredRefreshAttributes struct {
 	Username             string
 	Subject              string
 	DN                   string
 	Groups               []string
 	AdditionalAttributes map[string]string
+
+	// UID is the user's UID from providers which do not identify their users by DN, e.g. webhook and local providers.
+	UID string
 }
 
 type DynamicUpstreamIDPProvider interface {
@@ -126,12 +268,30 @@ type DynamicUpstreamIDPProvider interface {
 	GetLDAPIdentityProviders() []UpstreamLDAPIdentityProviderI
 	SetActiveDirectoryIdentityProviders(adIDPs []UpstreamLDAPIdentityProviderI)
 	GetActiveDirectoryIdentityProviders() []UpstreamLDAPIdentityProviderI
+	SetGitHubIdentityProviders(gitHubIDPs []UpstreamGitHubIdentityProviderI)
+	GetGitHubIdentityProviders() []UpstreamGitHubIdentityProviderI
+	SetSAMLIdentityProviders(samlIDPs []UpstreamSAMLIdentityProviderI)
+	GetSAMLIdentityProviders() []UpstreamSAMLIdentityProviderI
+	SetOAuth2IdentityProviders(oauth2IDPs []UpstreamOAuth2IdentityProviderI)
+	GetOAuth2IdentityProviders() []UpstreamOAuth2IdentityProviderI
+	SetWebhookIdentityProviders(webhookIDPs []UpstreamLDAPIdentityProviderI)
+	GetWebhookIdentityProviders() []UpstreamLDAPIdentityProviderI
+	SetLocalIdentityProviders(localIDPs []UpstreamLDAPIdentityProviderI)
+	GetLocalIdentityProviders() []UpstreamLDAPIdentityProviderI
+	SetWorkloadIdentityProviders(workloadIDPs []WorkloadIdentityProviderI)
+	GetWorkloadIdentityProviders() []WorkloadIdentityProviderI
 }
 
 type dynamicUpstreamIDPProvider struct {
 	oidcUpstreams            []UpstreamOIDCIdentityProviderI
 	ldapUpstreams            []UpstreamLDAPIdentityProviderI
 	activeDirectoryUpstreams []UpstreamLDAPIdentityProviderI
+	gitHubUpstreams          []UpstreamGitHubIdentityProviderI
+	samlUpstreams            []UpstreamSAMLIdentityProviderI
+	oauth2Upstreams          []UpstreamOAuth2IdentityProviderI
+	webhookUpstreams         []UpstreamLDAPIdentityProviderI
+	localUpstreams           []UpstreamLDAPIdentityProviderI
+	workloadProviders        []WorkloadIdentityProviderI
 	mutex                    sync.RWMutex
 }
 
@@ -140,6 +300,12 @@ func NewDynamicUpstreamIDPProvider() DynamicUpstreamIDPProvider {
 		oidcUpstreams:            []UpstreamOIDCIdentityProviderI{},
 		ldapUpstreams:            []UpstreamLDAPIdentityProviderI{},
 		activeDirectoryUpstreams: []UpstreamLDAPIdentityProviderI{},
+		gitHubUpstreams:          []UpstreamGitHubIdentityProviderI{},
+		samlUpstreams:            []UpstreamSAMLIdentityProviderI{},
+		oauth2Upstreams:          []UpstreamOAuth2IdentityProviderI{},
+		webhookUpstreams:         []UpstreamLDAPIdentityProviderI{},
+		localUpstreams:           []UpstreamLDAPIdentityProviderI{},
+		workloadProviders:        []WorkloadIdentityProviderI{},
 	}
 }
 
@@ -179,6 +345,18 @@ func (p *dynamicUpstreamIDPProvider) GetActiveDirectoryIdentityProviders() []Ups
 	return p.activeDirectoryUpstreams
 }
 
+func (p *dynamicUpstreamIDPProvider) SetGitHubIdentityProviders(gitHubIDPs []UpstreamGitHubIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.gitHubUpstreams = gitHubIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetGitHubIdentityProviders() []UpstreamGitHubIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.gitHubUpstreams
+}
+
 type RetryableRevocationError struct {
 	wrapped error
 }
@@ -194,3 +372,63 @@ func (e RetryableRevocationError) Error() string {
 func (e RetryableRevocationError) Unwrap() error {
 	return e.wrapped
 }
+
+func (p *dynamicUpstreamIDPProvider) SetSAMLIdentityProviders(samlIDPs []UpstreamSAMLIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.samlUpstreams = samlIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetSAMLIdentityProviders() []UpstreamSAMLIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.samlUpstreams
+}
+
+func (p *dynamicUpstreamIDPProvider) SetOAuth2IdentityProviders(oauth2IDPs []UpstreamOAuth2IdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.oauth2Upstreams = oauth2IDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetOAuth2IdentityProviders() []UpstreamOAuth2IdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.oauth2Upstreams
+}
+
+func (p *dynamicUpstreamIDPProvider) SetWebhookIdentityProviders(webhookIDPs []UpstreamLDAPIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.webhookUpstreams = webhookIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetWebhookIdentityProviders() []UpstreamLDAPIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.webhookUpstreams
+}
+
+func (p *dynamicUpstreamIDPProvider) SetLocalIdentityProviders(localIDPs []UpstreamLDAPIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.localUpstreams = localIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetLocalIdentityProviders() []UpstreamLDAPIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.localUpstreams
+}
+
+func (p *dynamicUpstreamIDPProvider) SetWorkloadIdentityProviders(workloadIDPs []WorkloadIdentityProviderI) {
+	p.mutex.Lock() // acquire a write lock
+	defer p.mutex.Unlock()
+	p.workloadProviders = workloadIDPs
+}
+
+func (p *dynamicUpstreamIDPProvider) GetWorkloadIdentityProviders() []WorkloadIdentityProviderI {
+	p.mutex.RLock() // acquire a read lock
+	defer p.mutex.RUnlock()
+	return p.workloadProviders
+}
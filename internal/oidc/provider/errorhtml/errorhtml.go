@@ -0,0 +1,103 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package errorhtml defines the HTML template for the page which is shown to a user when a browser-based login fails.
+//nolint: gochecknoglobals // This package uses globals to ensure that all parsing and minifying happens at init.
+package errorhtml
+
+import (
+	"crypto/sha256"
+	_ "embed" // Needed to trigger //go:embed directives below.
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/tdewolff/minify/v2/minify"
+
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/plog"
+)
+
+var (
+	//go:embed error.css
+	rawCSS      string
+	minifiedCSS = mustMinify(minify.CSS(rawCSS))
+
+	//go:embed error.gohtml
+	rawHTMLTemplate string
+)
+
+// Parse the unbranded template and generate its CSP header value once since they are effectively constant.
+var (
+	parsedHTMLTemplate = parseTemplate(nil)
+	cspValue           = contentSecurityPolicy(nil)
+)
+
+// Parse the Go templated HTML and inject functions providing the minified inline CSS and the branding.
+func parseTemplate(b *branding.Branding) *template.Template {
+	return template.Must(template.New("error.gohtml").Funcs(b.FuncMap()).Funcs(template.FuncMap{
+		"minifiedCSS": func() template.CSS { return template.CSS(minifiedCSS) },
+	}).Parse(rawHTMLTemplate))
+}
+
+// The page has no scripts. Images are only allowed for the logo from the branding.
+func contentSecurityPolicy(b *branding.Branding) string {
+	return strings.Join([]string{
+		`default-src 'none'`,
+		strings.Join(append([]string{`style-src '` + cspHash(minifiedCSS) + `'`}, b.StyleSources()...), " "),
+		`img-src data:`,
+		`frame-ancestors 'none'`,
+	}, "; ")
+}
+
+// PageData is the data used to render the Template().
+type PageData struct {
+	// Message describes the error. It is shown to the user, so it must not contain any secrets.
+	Message string
+}
+
+func mustMinify(s string, err error) string {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func cspHash(s string) string {
+	hashBytes := sha256.Sum256([]byte(s))
+	return "sha256-" + base64.StdEncoding.EncodeToString(hashBytes[:])
+}
+
+// ContentSecurityPolicy returns the Content-Security-Policy header value to make the Template() operate correctly.
+// The branding may be nil.
+func ContentSecurityPolicy(b *branding.Branding) string {
+	if b == nil {
+		return cspValue
+	}
+	return contentSecurityPolicy(b)
+}
+
+// Template returns the html/template.Template for rendering the page which is shown when a login fails.
+// The branding may be nil. A branded template is parsed on each call, so callers should keep the result.
+func Template(b *branding.Branding) *template.Template {
+	if b == nil {
+		return parsedHTMLTemplate
+	}
+	return parseTemplate(b)
+}
+
+// NewPageWriter returns a function which writes the error page using the given branding, which may be nil.
+// It can be used with httperr.HandlerFunc.WithErrorPage.
+func NewPageWriter(b *branding.Branding) func(w http.ResponseWriter, code int, msg string) {
+	tmpl := Template(b)
+	csp := ContentSecurityPolicy(b)
+	return func(w http.ResponseWriter, code int, msg string) {
+		w.Header().Set("Content-Security-Policy", csp)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(code)
+		if err := tmpl.Execute(w, &PageData{Message: msg}); err != nil {
+			plog.Error("failed to render error page", err)
+		}
+	}
+}
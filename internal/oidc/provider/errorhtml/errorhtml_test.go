@@ -0,0 +1,85 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package errorhtml
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+)
+
+var (
+	testPageData = PageData{Message: "Bad Request: state param not found <script>"}
+
+	testExpectedOutput = here.Doc(`
+        <!DOCTYPE html>
+        <html lang="en">
+        <head>
+            <meta charset="UTF-8">
+            <title>Unable to log in</title>
+            <style>body{font-family:metropolis-light,Helvetica,sans-serif}h1{font-size:20px}.box{position:absolute;top:100px;left:50%;width:400px;margin-left:-200px;font-size:14px;line-height:24px}code{display:block;word-wrap:break-word;word-break:break-all;font-size:12px;font-family:monospace;color:#333}</style>
+        </head>
+        <body>
+        <div class="box">
+            <h1>Unable to log in</h1>
+            <p>An error occurred while logging in. You may close this tab and try logging in again.</p>
+            <code>Bad Request: state param not found &lt;script&gt;</code>
+        </div>
+        </body>
+        </html>
+	`)
+
+	// It's okay if this changes in the future, but this gives us a chance to eyeball the formatting.
+	testExpectedCSP = `default-src 'none'; ` +
+		`style-src 'sha256-rpRSfItH6jCsyM+Rmw62ZSnr/9FZ03Uq+gE/duXl3dY='; ` +
+		`img-src data:; ` +
+		`frame-ancestors 'none'`
+)
+
+func TestTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Template(nil).Execute(&buf, &testPageData))
+
+	// t.Logf("actual value:\n%s", buf.String()) // useful when updating minify library causes new output
+	require.Equal(t, testExpectedOutput, buf.String())
+}
+
+func TestContentSecurityPolicyHashes(t *testing.T) {
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicy(nil))
+}
+
+func TestNewPageWriter(t *testing.T) {
+	b, err := branding.New(map[string]string{
+		"style.css":     "body { color: red; }",
+		"header.gohtml": `<div class="header">Example Corp</div>`,
+	}, nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	NewPageWriter(b)(rec, http.StatusBadRequest, testPageData.Message)
+
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Equal(t, ContentSecurityPolicy(b), rec.Header().Get("Content-Security-Policy"))
+	require.Contains(t, rec.Header().Get("Content-Security-Policy"), "'sha256-FcQqt3aNlV7AZnGV4zkQRVeCeJOxbMPnQSx258L803E='")
+	require.Contains(t, rec.Body.String(), "<style>body{color:red}</style>")
+	require.Contains(t, rec.Body.String(), `<body><div class="header">Example Corp</div>`)
+	require.Contains(t, rec.Body.String(), "<code>Bad Request: state param not found &lt;script&gt;</code>")
+}
+
+func TestHelpers(t *testing.T) {
+	// These are silly tests but it's easy to we might as well have them.
+	require.Equal(t, "test", mustMinify("test", nil))
+	require.PanicsWithError(t, "some error", func() { mustMinify("", fmt.Errorf("some error")) })
+
+	// Example test vector from https://content-security-policy.com/hash/.
+	require.Equal(t, "sha256-RFWPLDbv2BY+rCkDzsE+0fr8ylGr2R2faWMhq4lfEQc=", cspHash("doSomething();"))
+}
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package provider
@@ -9,6 +9,10 @@ import (
 	"strings"
 
 	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/httputil/securityheader"
+	"go.pinniped.dev/internal/oidc/certbinding"
+	"go.pinniped.dev/internal/oidc/provider/branding"
+	"go.pinniped.dev/internal/oidc/tokenexchange"
 )
 
 // FederationDomainIssuer represents all of the settings and state for a downstream OIDC provider
@@ -17,10 +21,29 @@ type FederationDomainIssuer struct {
 	issuer     string
 	issuerHost string
 	issuerPath string
+	branding   *branding.Branding
+
+	securityHeaders     *securityheader.Policy
+	certificateBinding  certbinding.Mode
+	tokenExchangePolicy *tokenexchange.Policy
 }
 
-func NewFederationDomainIssuer(issuer string) (*FederationDomainIssuer, error) {
-	p := FederationDomainIssuer{issuer: issuer}
+// NewFederationDomainIssuer validates the issuer and returns a FederationDomainIssuer. The branding, the
+// security headers and the token exchange policy may be nil.
+func NewFederationDomainIssuer(
+	issuer string,
+	brand *branding.Branding,
+	securityHeaders *securityheader.Policy,
+	certificateBinding certbinding.Mode,
+	tokenExchangePolicy *tokenexchange.Policy,
+) (*FederationDomainIssuer, error) {
+	p := FederationDomainIssuer{
+		issuer:              issuer,
+		branding:            brand,
+		securityHeaders:     securityHeaders,
+		certificateBinding:  certificateBinding,
+		tokenExchangePolicy: tokenExchangePolicy,
+	}
 	err := p.validate()
 	if err != nil {
 		return nil, err
@@ -75,3 +98,23 @@ func (p *FederationDomainIssuer) IssuerHost() string {
 func (p *FederationDomainIssuer) IssuerPath() string {
 	return p.issuerPath
 }
+
+// Branding returns the customization of the HTML pages, which may be nil.
+func (p *FederationDomainIssuer) Branding() *branding.Branding {
+	return p.branding
+}
+
+// SecurityHeaders returns the overrides of the Supervisor's security header policy, which may be nil.
+func (p *FederationDomainIssuer) SecurityHeaders() *securityheader.Policy {
+	return p.securityHeaders
+}
+
+// CertificateBinding returns whether the tokens are bound to the client certificates of clients.
+func (p *FederationDomainIssuer) CertificateBinding() certbinding.Mode {
+	return p.certificateBinding
+}
+
+// TokenExchangePolicy returns the policy which restricts the audiences of token exchanges, which may be nil.
+func (p *FederationDomainIssuer) TokenExchangePolicy() *tokenexchange.Policy {
+	return p.tokenExchangePolicy
+}
@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package provider
@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/certbinding"
 )
 
 func TestFederationDomainIssuerValidations(t *testing.T) {
@@ -72,7 +74,7 @@ func TestFederationDomainIssuerValidations(t *testing.T) {
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := NewFederationDomainIssuer(tt.issuer)
+			_, err := NewFederationDomainIssuer(tt.issuer, nil, nil, certbinding.Disabled, nil)
 			if tt.wantError != "" {
 				require.EqualError(t, err, tt.wantError)
 			} else {
@@ -13,6 +13,8 @@ import (
 	"strings"
 
 	"github.com/tdewolff/minify/v2/minify"
+
+	"go.pinniped.dev/internal/oidc/provider/branding"
 )
 
 var (
@@ -28,21 +30,30 @@ var (
 	rawHTMLTemplate string
 )
 
-// Parse the Go templated HTML and inject functions providing the minified inline CSS and JS.
-var parsedHTMLTemplate = template.Must(template.New("form_post.gohtml").Funcs(template.FuncMap{
-	"minifiedCSS": func() template.CSS { return template.CSS(minifiedCSS) },
-	"minifiedJS":  func() template.JS { return template.JS(minifiedJS) }, //nolint:gosec // This is 100% static input, not attacker-controlled.
-}).Parse(rawHTMLTemplate))
+// Parse the unbranded template and generate its CSP header value once since they are effectively constant.
+var (
+	parsedHTMLTemplate = parseTemplate(nil)
+	cspValue           = contentSecurityPolicy(nil)
+)
+
+// Parse the Go templated HTML and inject functions providing the minified inline CSS and JS and the branding.
+func parseTemplate(b *branding.Branding) *template.Template {
+	return template.Must(template.New("form_post.gohtml").Funcs(b.FuncMap()).Funcs(template.FuncMap{
+		"minifiedCSS": func() template.CSS { return template.CSS(minifiedCSS) },
+		"minifiedJS":  func() template.JS { return template.JS(minifiedJS) }, //nolint:gosec // This is 100% static input, not attacker-controlled.
+	}).Parse(rawHTMLTemplate))
+}
 
-// Generate the CSP header value once since it's effectively constant.
-var cspValue = strings.Join([]string{
-	`default-src 'none'`,
-	`script-src '` + cspHash(minifiedJS) + `'`,
-	`style-src '` + cspHash(minifiedCSS) + `'`,
-	`img-src data:`,
-	`connect-src *`,
-	`frame-ancestors 'none'`,
-}, "; ")
+func contentSecurityPolicy(b *branding.Branding) string {
+	return strings.Join([]string{
+		`default-src 'none'`,
+		`script-src '` + cspHash(minifiedJS) + `'`,
+		strings.Join(append([]string{`style-src '` + cspHash(minifiedCSS) + `'`}, b.StyleSources()...), " "),
+		`img-src data:`,
+		`connect-src *`,
+		`frame-ancestors 'none'`,
+	}, "; ")
+}
 
 func mustMinify(s string, err error) string {
 	if err != nil {
@@ -57,9 +68,21 @@ func cspHash(s string) string {
 }
 
 // ContentSecurityPolicy returns the Content-Security-Policy header value to make the Template() operate correctly.
+// The branding may be nil.
 //
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Security-Policy/default-src#:~:text=%27%3Chash-algorithm%3E-%3Cbase64-value%3E%27.
-func ContentSecurityPolicy() string { return cspValue }
+func ContentSecurityPolicy(b *branding.Branding) string {
+	if b == nil {
+		return cspValue
+	}
+	return contentSecurityPolicy(b)
+}
 
 // Template returns the html/template.Template for rendering the response_type=form_post response page.
-func Template() *template.Template { return parsedHTMLTemplate }
+// The branding may be nil. A branded template is parsed on each call, so callers should keep the result.
+func Template(b *branding.Branding) *template.Template {
+	if b == nil {
+		return parsedHTMLTemplate
+	}
+	return parseTemplate(b)
+}
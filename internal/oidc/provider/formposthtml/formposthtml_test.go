@@ -7,12 +7,14 @@ import (
 	"bytes"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/ory/fosite"
 	"github.com/stretchr/testify/require"
 
 	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/oidc/provider/branding"
 )
 
 var (
@@ -71,11 +73,11 @@ var (
 func TestTemplate(t *testing.T) {
 	// Use the Fosite helper to render the form, ensuring that the parameters all have the same names + types.
 	var buf bytes.Buffer
-	fosite.WriteAuthorizeFormPostResponse(testRedirectURL, testResponseParams, Template(), &buf)
+	fosite.WriteAuthorizeFormPostResponse(testRedirectURL, testResponseParams, Template(nil), &buf)
 
 	// Render again so we can confirm that there is no error returned (Fosite ignores any error).
 	var buf2 bytes.Buffer
-	require.NoError(t, Template().Execute(&buf2, struct {
+	require.NoError(t, Template(nil).Execute(&buf2, struct {
 		RedirURL   string
 		Parameters url.Values
 	}{
@@ -89,7 +91,28 @@ func TestTemplate(t *testing.T) {
 }
 
 func TestContentSecurityPolicyHashes(t *testing.T) {
-	require.Equal(t, testExpectedCSP, ContentSecurityPolicy())
+	require.Equal(t, testExpectedCSP, ContentSecurityPolicy(nil))
+}
+
+func TestBrandedTemplate(t *testing.T) {
+	b, err := branding.New(map[string]string{
+		"style.css":     "body { color: red; }",
+		"header.gohtml": `<div class="header">Example Corp</div>`,
+		"footer.gohtml": `<p class="footer">Need help?</p>`,
+	}, nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	fosite.WriteAuthorizeFormPostResponse(testRedirectURL, testResponseParams, Template(b), &buf)
+	require.Contains(t, buf.String(), "</style><style>body{color:red}</style>\n")
+	require.Contains(t, buf.String(), "<body><div class=\"header\">Example Corp</div>\n")
+	require.Contains(t, buf.String(), "</div><p class=\"footer\">Need help?</p>\n</body>")
+
+	// The stylesheet must be allowed by the CSP, which should otherwise be unchanged.
+	require.Equal(t,
+		strings.Replace(testExpectedCSP, "; img-src", " 'sha256-FcQqt3aNlV7AZnGV4zkQRVeCeJOxbMPnQSx258L803E='; img-src", 1),
+		ContentSecurityPolicy(b),
+	)
 }
 
 func TestHelpers(t *testing.T) {
@@ -1,24 +1,32 @@
-// Copyright 2020-2021 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package manager
 
 import (
+	"net"
 	"net/http"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/ory/fosite"
 	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 
+	"go.pinniped.dev/internal/httputil/securityheader"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/auth"
 	"go.pinniped.dev/internal/oidc/callback"
+	"go.pinniped.dev/internal/oidc/certbinding"
 	"go.pinniped.dev/internal/oidc/csrftoken"
 	"go.pinniped.dev/internal/oidc/discovery"
+	"go.pinniped.dev/internal/oidc/dpop"
 	"go.pinniped.dev/internal/oidc/dynamiccodec"
 	"go.pinniped.dev/internal/oidc/idpdiscovery"
 	"go.pinniped.dev/internal/oidc/jwks"
+	"go.pinniped.dev/internal/oidc/loginattempts"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/provider/formposthtml"
 	"go.pinniped.dev/internal/oidc/token"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/secret"
@@ -38,18 +46,27 @@ type Manager struct {
 	upstreamIDPs        oidc.UpstreamIdentityProvidersLister // in-memory cache of upstream IDPs
 	secretCache         *secret.Cache                        // in-memory cache of cryptographic material
 	secretsClient       corev1client.SecretInterface
+	securityHeaders     securityheader.Policy // security-related response headers for all providers, unless overridden by a provider
+	trustedProxies      []*net.IPNet          // proxies whose X-Forwarded-For headers identify the source IPs of login attempts
+	dpopReplays         *dpop.ReplayCache     // DPoP proofs which were already used, shared by all providers
+
+	clientCertificateHosts map[string]bool // lowercase hosts of the providers which bind tokens to client certificates
 }
 
 // NewManager returns an empty Manager.
 // nextHandler will be invoked for any requests that could not be handled by this manager's providers.
 // dynamicJWKSProvider will be used as an in-memory cache for per-issuer JWKS data.
 // upstreamIDPs will be used as an in-memory cache of currently configured upstream IDPs.
+// securityHeaders will be set on the responses of all providers, merged with the overrides of each provider.
+// trustedProxies are the proxies whose X-Forwarded-For headers are trusted to identify the source IPs of login attempts.
 func NewManager(
 	nextHandler http.Handler,
 	dynamicJWKSProvider jwks.DynamicJWKSProvider,
 	upstreamIDPs oidc.UpstreamIdentityProvidersLister,
 	secretCache *secret.Cache,
 	secretsClient corev1client.SecretInterface,
+	securityHeaders securityheader.Policy,
+	trustedProxies []*net.IPNet,
 ) *Manager {
 	return &Manager{
 		providerHandlers:    make(map[string]http.Handler),
@@ -58,6 +75,9 @@ func NewManager(
 		upstreamIDPs:        upstreamIDPs,
 		secretCache:         secretCache,
 		secretsClient:       secretsClient,
+		securityHeaders:     securityHeaders,
+		trustedProxies:      trustedProxies,
+		dpopReplays:         dpop.NewReplayCache(),
 	}
 }
 
@@ -75,6 +95,7 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 
 	m.providers = federationDomains
 	m.providerHandlers = make(map[string]http.Handler)
+	m.clientCertificateHosts = make(map[string]bool)
 
 	var csrfCookieEncoder = dynamiccodec.New(
 		oidc.CSRFCookieLifespan,
@@ -97,19 +118,37 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 		// For all the other endpoints, make another oauth helper with exactly the same settings except use real storage.
 		oauthHelperWithKubeStorage := oidc.FositeOauth2Helper(oidc.NewKubeStorage(m.secretsClient, timeoutsConfiguration), issuer, tokenHMACKeyGetter, m.dynamicJWKSProvider, timeoutsConfiguration)
 
+		// Customize the HTML pages shown to users of this FederationDomain, including the response_type=form_post page.
+		brand := incomingProvider.Branding()
+		if brand != nil {
+			formPostHTMLTemplate := formposthtml.Template(brand)
+			oauthHelperWithNullStorage.(*fosite.Fosite).FormPostHTMLTemplate = formPostHTMLTemplate
+			oauthHelperWithKubeStorage.(*fosite.Fosite).FormPostHTMLTemplate = formPostHTMLTemplate
+		}
+
 		var upstreamStateEncoder = dynamiccodec.New(
 			timeoutsConfiguration.UpstreamStateParamLifespan,
 			wrapGetter(incomingProvider.Issuer(), m.secretCache.GetStateEncoderHashKey),
 			wrapGetter(incomingProvider.Issuer(), m.secretCache.GetStateEncoderBlockKey),
 		)
 
-		m.providerHandlers[(issuerHostWithPath + oidc.WellKnownEndpointPath)] = discovery.NewHandler(issuer)
+		securityHeaders := m.securityHeaders.Merge(incomingProvider.SecurityHeaders())
+		addHandler := func(path string, handler http.Handler) {
+			m.providerHandlers[(issuerHostWithPath + path)] = securityheader.WrapWithPolicy(handler, securityHeaders)
+		}
+
+		certificateBinding := incomingProvider.CertificateBinding()
+		if certificateBinding != certbinding.Disabled {
+			m.clientCertificateHosts[hostWithoutPort(incomingProvider.IssuerHost())] = true
+		}
 
-		m.providerHandlers[(issuerHostWithPath + oidc.JWKSEndpointPath)] = jwks.NewHandler(issuer, m.dynamicJWKSProvider)
+		addHandler(oidc.WellKnownEndpointPath, discovery.NewHandler(issuer, certificateBinding != certbinding.Disabled))
 
-		m.providerHandlers[(issuerHostWithPath + oidc.PinnipedIDPsPathV1Alpha1)] = idpdiscovery.NewHandler(m.upstreamIDPs)
+		addHandler(oidc.JWKSEndpointPath, jwks.NewHandler(issuer, m.dynamicJWKSProvider))
 
-		m.providerHandlers[(issuerHostWithPath + oidc.AuthorizationEndpointPath)] = auth.NewHandler(
+		addHandler(oidc.PinnipedIDPsPathV1Alpha1, idpdiscovery.NewHandler(m.upstreamIDPs))
+
+		addHandler(oidc.AuthorizationEndpointPath, auth.NewHandler(
 			issuer,
 			m.upstreamIDPs,
 			oauthHelperWithNullStorage,
@@ -119,20 +158,37 @@ func (m *Manager) SetProviders(federationDomains ...*provider.FederationDomainIs
 			nonce.Generate,
 			upstreamStateEncoder,
 			csrfCookieEncoder,
-		)
+			loginattempts.New(m.secretsClient, time.Now, loginattempts.DefaultConfig()),
+			m.trustedProxies,
+			brand,
+		))
 
-		m.providerHandlers[(issuerHostWithPath + oidc.CallbackEndpointPath)] = callback.NewHandler(
+		addHandler(oidc.CallbackEndpointPath, callback.NewHandler(
 			m.upstreamIDPs,
 			oauthHelperWithKubeStorage,
 			upstreamStateEncoder,
 			csrfCookieEncoder,
 			issuer+oidc.CallbackEndpointPath,
-		)
+			brand,
+		))
 
-		m.providerHandlers[(issuerHostWithPath + oidc.TokenEndpointPath)] = token.NewHandler(
+		addHandler(oidc.SAMLACSEndpointPath, callback.NewSAMLACSHandler(
 			m.upstreamIDPs,
 			oauthHelperWithKubeStorage,
-		)
+			upstreamStateEncoder,
+			csrfCookieEncoder,
+			issuer,
+			brand,
+		))
+
+		addHandler(oidc.TokenEndpointPath, token.NewHandler(
+			m.upstreamIDPs,
+			oauthHelperWithKubeStorage,
+			certificateBinding,
+			issuer+oidc.TokenEndpointPath,
+			incomingProvider.TokenExchangePolicy(),
+			m.dpopReplays,
+		))
 
 		plog.Debug("oidc provider manager added or updated issuer", "issuer", issuer)
 	}
@@ -156,6 +212,16 @@ func (m *Manager) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
 	requestHandler.ServeHTTP(resp, req)
 }
 
+// RequestsClientCertificate returns true when the TLS server should request a client certificate during the handshake
+// of a connection for the server name, because a provider of that host binds tokens to client certificates. Other
+// hosts do not request client certificates, so browsers do not ask users to choose one.
+func (m *Manager) RequestsClientCertificate(serverName string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.clientCertificateHosts[strings.ToLower(serverName)]
+}
+
 func (m *Manager) findHandler(req *http.Request) http.Handler {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -168,3 +234,10 @@ func wrapGetter(issuer string, getter func(string) []byte) func() []byte {
 		return getter(issuer)
 	}
 }
+
+func hostWithoutPort(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
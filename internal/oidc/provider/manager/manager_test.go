@@ -23,7 +23,9 @@ import (
 	"k8s.io/client-go/kubernetes/fake"
 
 	"go.pinniped.dev/internal/here"
+	"go.pinniped.dev/internal/httputil/securityheader"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/certbinding"
 	"go.pinniped.dev/internal/oidc/discovery"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/provider"
@@ -283,7 +285,11 @@ func TestManager(t *testing.T) {
 			cache.SetStateEncoderHashKey(issuer2, []byte("some-state-encoder-hash-key-2"))
 			cache.SetStateEncoderBlockKey(issuer2, []byte("16-bytes-STATE02"))
 
-			subject = NewManager(nextHandler, dynamicJWKSProvider, idpLister, &cache, secretsClient)
+			securityHeaders := securityheader.Policy{
+				StrictTransportSecurity: &securityheader.StrictTransportSecurity{MaxAgeSeconds: 60, IncludeSubDomains: true},
+				PermissionsPolicy:       "camera=()",
+			}
+			subject = NewManager(nextHandler, dynamicJWKSProvider, idpLister, &cache, secretsClient, securityHeaders, nil)
 		})
 
 		when("given no providers via SetProviders()", func() {
@@ -386,9 +392,9 @@ func TestManager(t *testing.T) {
 
 		when("given some valid providers via SetProviders()", func() {
 			it.Before(func() {
-				p1, err := provider.NewFederationDomainIssuer(issuer1)
+				p1, err := provider.NewFederationDomainIssuer(issuer1, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
-				p2, err := provider.NewFederationDomainIssuer(issuer2)
+				p2, err := provider.NewFederationDomainIssuer(issuer2, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 				subject.SetProviders(p1, p2)
 
@@ -429,9 +435,9 @@ func TestManager(t *testing.T) {
 
 		when("given the same valid providers as arguments to SetProviders() in reverse order", func() {
 			it.Before(func() {
-				p1, err := provider.NewFederationDomainIssuer(issuer1)
+				p1, err := provider.NewFederationDomainIssuer(issuer1, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
-				p2, err := provider.NewFederationDomainIssuer(issuer2)
+				p2, err := provider.NewFederationDomainIssuer(issuer2, nil, nil, certbinding.Disabled, nil)
 				r.NoError(err)
 				subject.SetProviders(p2, p1)
 
@@ -450,5 +456,68 @@ func TestManager(t *testing.T) {
 				requireRoutesMatchingRequestsToAppropriateProvider()
 			})
 		})
+
+		when("given providers which override the security headers via SetProviders()", func() {
+			it.Before(func() {
+				p1, err := provider.NewFederationDomainIssuer(issuer1, nil, nil, certbinding.Disabled, nil)
+				r.NoError(err)
+				p2, err := provider.NewFederationDomainIssuer(issuer2, nil, &securityheader.Policy{
+					StrictTransportSecurity: &securityheader.StrictTransportSecurity{MaxAgeSeconds: 0},
+					CrossOriginOpenerPolicy: "same-origin",
+				}, certbinding.Disabled, nil)
+				r.NoError(err)
+				subject.SetProviders(p1, p2)
+			})
+
+			it("sets the security headers of each provider on all of its responses", func() {
+				recorder := httptest.NewRecorder()
+				subject.ServeHTTP(recorder, newGetRequest(issuer1+oidc.WellKnownEndpointPath))
+				r.Equal(http.StatusOK, recorder.Code)
+				r.Equal("max-age=60; includeSubDomains", recorder.Header().Get("Strict-Transport-Security"))
+				r.Equal("camera=()", recorder.Header().Get("Permissions-Policy"))
+				r.Empty(recorder.Header().Values("Cross-Origin-Opener-Policy"))
+
+				recorder = httptest.NewRecorder()
+				subject.ServeHTTP(recorder, newGetRequest(issuer2+oidc.AuthorizationEndpointPath))
+				r.Equal("max-age=0", recorder.Header().Get("Strict-Transport-Security"))
+				r.Equal("camera=()", recorder.Header().Get("Permissions-Policy"))
+				r.Equal("same-origin", recorder.Header().Get("Cross-Origin-Opener-Policy"))
+				r.Equal("default-src 'none'; frame-ancestors 'none'", recorder.Header().Get("Content-Security-Policy"))
+			})
+
+			it("does not set the security headers on requests which do not match any provider", func() {
+				recorder := httptest.NewRecorder()
+				subject.ServeHTTP(recorder, newGetRequest("https://example.com/path-does-not-match-any-provider"))
+				r.True(fallbackHandlerWasCalled)
+				r.Empty(recorder.Header().Values("Strict-Transport-Security"))
+			})
+		})
+
+		when("given providers which bind tokens to client certificates via SetProviders()", func() {
+			it.Before(func() {
+				p1, err := provider.NewFederationDomainIssuer(issuer1, nil, nil, certbinding.Optional, nil)
+				r.NoError(err)
+				p2, err := provider.NewFederationDomainIssuer("https://other-host.example.com:8443/path", nil, nil, certbinding.Disabled, nil)
+				r.NoError(err)
+				subject.SetProviders(p1, p2)
+			})
+
+			it("requests client certificates only for the hosts of those providers", func() {
+				r.True(subject.RequestsClientCertificate("example.com"))
+				r.True(subject.RequestsClientCertificate("EXAMPLE.com"))
+				r.False(subject.RequestsClientCertificate("other-host.example.com"))
+				r.False(subject.RequestsClientCertificate(""))
+
+				subject.SetProviders()
+				r.False(subject.RequestsClientCertificate("example.com"))
+			})
+
+			it("advertises certificate-bound tokens in the discovery document", func() {
+				recorder := httptest.NewRecorder()
+				subject.ServeHTTP(recorder, newGetRequest(issuer1+oidc.WellKnownEndpointPath))
+				r.Equal(http.StatusOK, recorder.Code)
+				r.Contains(recorder.Body.String(), `"tls_client_certificate_bound_access_tokens":true`)
+			})
+		})
 	})
 }
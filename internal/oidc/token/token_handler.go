@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/ory/fosite"
 	errorsx "github.com/pkg/errors"
@@ -18,8 +19,11 @@ import (
 
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/certbinding"
 	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/dpop"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/tokenexchange"
 	"go.pinniped.dev/internal/plog"
 	"go.pinniped.dev/internal/psession"
 )
@@ -27,10 +31,57 @@ import (
 func NewHandler(
 	idpLister oidc.UpstreamIdentityProvidersLister,
 	oauthHelper fosite.OAuth2Provider,
+	certificateBinding certbinding.Mode,
+	tokenEndpointURL string,
+	tokenExchangePolicy *tokenexchange.Policy,
+	dpopReplays *dpop.ReplayCache,
 ) http.Handler {
 	return httperr.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+		// The token exchange handler can only see the context, so it gets its policy and the workload identity
+		// providers from there.
+		ctx := tokenexchange.WithPolicy(r.Context(), tokenExchangePolicy)
+		ctx = oidc.WithWorkloadIdentityProviders(ctx, idpLister)
+
+		// Remember the client certificate for the token exchange handler, which can only see the context.
+		var thumbprint string
+		if certificateBinding != certbinding.Disabled {
+			thumbprint = certbinding.FromRequest(r)
+			ctx = certbinding.WithRequestThumbprint(ctx, certificateBinding, thumbprint)
+		}
+
+		// Likewise for the DPoP key, which is only checked once the request has been parsed by fosite.
+		dpopThumbprint, dpopErr := dpop.ValidateProof(r, tokenEndpointURL, time.Now(), dpopReplays)
+		ctx = dpop.WithRequestThumbprint(ctx, dpopThumbprint)
+
 		session := psession.NewPinnipedSession()
-		accessRequest, err := oauthHelper.NewAccessRequest(r.Context(), r, session)
+		accessRequest, err := oauthHelper.NewAccessRequest(ctx, r, session)
+		if err != nil {
+			plog.Info("token request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteAccessError(w, accessRequest, err)
+			return nil
+		}
+
+		if certificateBinding == certbinding.Required && thumbprint == "" {
+			err = errorsx.WithStack(fosite.ErrInvalidRequest.WithHint("A client certificate is required to request tokens from this issuer."))
+			plog.Info("token request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteAccessError(w, accessRequest, err)
+			return nil
+		}
+
+		if err := bindToClientCertificate(accessRequest, certificateBinding, thumbprint); err != nil {
+			plog.Info("token request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteAccessError(w, accessRequest, err)
+			return nil
+		}
+
+		if dpopErr != nil {
+			err = errorsx.WithStack(errInvalidDPoPProof(dpopErr))
+			plog.Info("token request error", oidc.FositeErrorForLog(err)...)
+			oauthHelper.WriteAccessError(w, accessRequest, err)
+			return nil
+		}
+
+		ctx, err = bindToDPoPKey(ctx, accessRequest, dpopThumbprint)
 		if err != nil {
 			plog.Info("token request error", oidc.FositeErrorForLog(err)...)
 			oauthHelper.WriteAccessError(w, accessRequest, err)
@@ -63,19 +114,94 @@ func NewHandler(
 			}
 		}
 
-		accessResponse, err := oauthHelper.NewAccessResponse(r.Context(), accessRequest)
+		accessResponse, err := oauthHelper.NewAccessResponse(ctx, accessRequest)
 		if err != nil {
 			plog.Info("token response error", oidc.FositeErrorForLog(err)...)
 			oauthHelper.WriteAccessError(w, accessRequest, err)
 			return nil
 		}
 
+		// Tell the client that the access token is bound to its DPoP key, as described in RFC 9449 section 5.
+		// A token exchange sets the token_type of the token which it returns itself.
+		if dpop.BoundThumbprint(ctx) != "" && !accessRequest.GetGrantTypes().ExactOne("urn:ietf:params:oauth:grant-type:token-exchange") {
+			accessResponse.SetTokenType(dpop.TokenType)
+		}
+
 		oauthHelper.WriteAccessResponse(w, accessRequest, accessResponse)
 
 		return nil
 	})
 }
 
+// bindToClientCertificate binds the tokens of an authorization code grant to the client certificate of the request,
+// and checks that the tokens of a refresh grant are bound to the client certificate of the request.
+func bindToClientCertificate(
+	accessRequest fosite.AccessRequester,
+	certificateBinding certbinding.Mode,
+	thumbprint string,
+) error {
+	if certificateBinding == certbinding.Disabled {
+		return nil
+	}
+
+	session := accessRequest.GetSession().(*psession.PinnipedSession)
+	if session.Custom == nil {
+		// This is reported as an error by the upstream refresh.
+		return nil
+	}
+
+	// A token exchange checks the binding of its subject_token itself, because its session is only loaded later.
+	switch {
+	case accessRequest.GetGrantTypes().ExactOne("authorization_code"):
+		// The session is stored with the new access and refresh tokens, so they are bound too.
+		session.Custom.CertificateThumbprint = thumbprint
+	case accessRequest.GetGrantTypes().ExactOne("refresh_token"):
+		if session.Custom.CertificateThumbprint == "" && certificateBinding == certbinding.Required {
+			return errorsx.WithStack(fosite.ErrInvalidGrant.WithHint(
+				"The refresh token is not bound to a client certificate, which is required by this issuer."))
+		}
+		if session.Custom.CertificateThumbprint != "" && session.Custom.CertificateThumbprint != thumbprint {
+			return errorsx.WithStack(fosite.ErrInvalidGrant.WithHint(
+				"The refresh token is bound to a different client certificate."))
+		}
+	}
+
+	return nil
+}
+
+// bindToDPoPKey binds the tokens of an authorization code grant to the DPoP key of the request, if any, and checks
+// that the request of a refresh grant proves possession of the DPoP key to which its refresh token is bound. It
+// returns a copy of the context which holds the thumbprint to which the issued tokens are bound.
+func bindToDPoPKey(ctx context.Context, accessRequest fosite.AccessRequester, thumbprint string) (context.Context, error) {
+	session := accessRequest.GetSession().(*psession.PinnipedSession)
+	if session.Custom == nil {
+		// This is reported as an error by the upstream refresh.
+		return ctx, nil
+	}
+
+	// A token exchange checks the binding of its subject_token itself, because its session is only loaded later.
+	switch {
+	case accessRequest.GetGrantTypes().ExactOne("authorization_code"):
+		session.Custom.DPoPKeyThumbprint = thumbprint
+	case accessRequest.GetGrantTypes().ExactOne("refresh_token"):
+		if session.Custom.DPoPKeyThumbprint != "" && session.Custom.DPoPKeyThumbprint != thumbprint {
+			return nil, errorsx.WithStack(fosite.ErrInvalidGrant.WithHint(
+				"The refresh token is bound to a DPoP key, which the request did not prove possession of."))
+		}
+	}
+
+	return dpop.WithBoundThumbprint(ctx, session.Custom.DPoPKeyThumbprint), nil
+}
+
+func errInvalidDPoPProof(err error) *fosite.RFC6749Error {
+	return &fosite.RFC6749Error{
+		ErrorField:       "invalid_dpop_proof",
+		DescriptionField: "The DPoP proof is invalid.",
+		HintField:        err.Error(),
+		CodeField:        http.StatusBadRequest,
+	}
+}
+
 func errMissingUpstreamSessionInternalError() *fosite.RFC6749Error {
 	return &fosite.RFC6749Error{
 		ErrorField:       "error",
@@ -113,6 +239,16 @@ func upstreamRefresh(ctx context.Context, accessRequest fosite.AccessRequester,
 		return upstreamLDAPRefresh(ctx, providerCache, session)
 	case psession.ProviderTypeActiveDirectory:
 		return upstreamLDAPRefresh(ctx, providerCache, session)
+	case psession.ProviderTypeWebhook:
+		return upstreamLDAPRefresh(ctx, providerCache, session)
+	case psession.ProviderTypeLocal:
+		return upstreamLDAPRefresh(ctx, providerCache, session)
+	case psession.ProviderTypeGitHub:
+		return upstreamGitHubRefresh(ctx, providerCache, session)
+	case psession.ProviderTypeSAML:
+		return upstreamSAMLRefresh(providerCache, session)
+	case psession.ProviderTypeOAuth2:
+		return upstreamOAuth2Refresh(ctx, providerCache, session)
 	default:
 		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
 	}
@@ -304,21 +440,28 @@ func upstreamLDAPRefresh(ctx context.Context, providerCache oidc.UpstreamIdentit
 
 	s := session.Custom
 
-	// if you have neither a valid ldap session config nor a valid active directory session config
+	// if you have neither a valid ldap, active directory, webhook, nor local session config
 	validLDAP := s.ProviderType == psession.ProviderTypeLDAP && s.LDAP != nil && s.LDAP.UserDN != ""
 	validAD := s.ProviderType == psession.ProviderTypeActiveDirectory && s.ActiveDirectory != nil && s.ActiveDirectory.UserDN != ""
-	if !(validLDAP || validAD) {
+	validWebhook := s.ProviderType == psession.ProviderTypeWebhook && s.Webhook != nil && s.Webhook.UserUID != ""
+	validLocal := s.ProviderType == psession.ProviderTypeLocal && s.Local != nil && s.Local.UserUID != ""
+	if !(validLDAP || validAD || validWebhook || validLocal) {
 		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
 	}
 
 	var additionalAttributes map[string]string
+	var uid string
 	if s.ProviderType == psession.ProviderTypeLDAP {
 		additionalAttributes = s.LDAP.ExtraRefreshAttributes
-	} else {
+	} else if s.ProviderType == psession.ProviderTypeActiveDirectory {
 		additionalAttributes = s.ActiveDirectory.ExtraRefreshAttributes
+	} else if s.ProviderType == psession.ProviderTypeWebhook {
+		uid = s.Webhook.UserUID
+	} else {
+		uid = s.Local.UserUID
 	}
 
-	// get ldap/ad provider out of cache
+	// get ldap/ad/webhook/local provider out of cache
 	p, dn, err := findLDAPProviderByNameAndValidateUID(s, providerCache)
 	if err != nil {
 		return err
@@ -333,6 +476,7 @@ func upstreamLDAPRefresh(ctx context.Context, providerCache oidc.UpstreamIdentit
 		DN:                   dn,
 		Groups:               oldGroups,
 		AdditionalAttributes: additionalAttributes,
+		UID:                  uid,
 	})
 	if err != nil {
 		return errUpstreamRefreshError().WithHint(
@@ -359,6 +503,10 @@ func findLDAPProviderByNameAndValidateUID(
 	} else if s.ProviderType == psession.ProviderTypeActiveDirectory {
 		providers = providerCache.GetActiveDirectoryIdentityProviders()
 		dn = s.ActiveDirectory.UserDN
+	} else if s.ProviderType == psession.ProviderTypeWebhook {
+		providers = providerCache.GetWebhookIdentityProviders()
+	} else if s.ProviderType == psession.ProviderTypeLocal {
+		providers = providerCache.GetLocalIdentityProviders()
 	}
 
 	for _, p := range providers {
@@ -377,6 +525,202 @@ func findLDAPProviderByNameAndValidateUID(
 		WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
 }
 
+func upstreamGitHubRefresh(ctx context.Context, providerCache oidc.UpstreamIdentityProvidersLister, session *psession.PinnipedSession) error {
+	s := session.Custom
+	if s.GitHub == nil || s.GitHub.UpstreamAccessToken == "" {
+		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
+	}
+
+	username, err := getDownstreamUsernameFromPinnipedSession(session)
+	if err != nil {
+		return err
+	}
+	oldGroups, err := getDownstreamGroupsFromPinnipedSession(session)
+	if err != nil {
+		return err
+	}
+
+	p, err := findGitHubProviderByNameAndValidateUID(s, providerCache)
+	if err != nil {
+		return err
+	}
+
+	plog.Debug("attempting upstream refresh request",
+		"providerName", s.ProviderName, "providerType", s.ProviderType, "providerUID", s.ProviderUID)
+
+	// GitHub does not issue refresh tokens to OAuth Apps, so look up the user again using the stored access token.
+	// This fails when the user has revoked the authorization, or when they are no longer allowed to log in.
+	user, err := p.GetUser(ctx, s.GitHub.UpstreamAccessToken)
+	if err != nil {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(err).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+
+	if user.DownstreamSubject != session.Fosite.Claims.Subject {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(errors.New("subject in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if user.Username != username {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(errors.New("username in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+
+	warnIfGroupsChanged(ctx, oldGroups, user.Groups, username)
+	session.Fosite.Claims.Extra[oidc.DownstreamGroupsClaim] = user.Groups
+
+	return nil
+}
+
+func findGitHubProviderByNameAndValidateUID(
+	s *psession.CustomSessionData,
+	providerCache oidc.UpstreamIdentityProvidersLister,
+) (provider.UpstreamGitHubIdentityProviderI, error) {
+	for _, p := range providerCache.GetGitHubIdentityProviders() {
+		if p.GetName() == s.ProviderName {
+			if p.GetResourceUID() != s.ProviderUID {
+				return nil, errorsx.WithStack(errUpstreamRefreshError().WithHint(
+					"Provider from upstream session data has changed its resource UID since authentication.").
+					WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+			}
+			return p, nil
+		}
+	}
+	return nil, errorsx.WithStack(errUpstreamRefreshError().
+		WithHint("Provider from upstream session data was not found.").
+		WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+}
+
+func upstreamSAMLRefresh(providerCache oidc.UpstreamIdentityProvidersLister, session *psession.PinnipedSession) error {
+	s := session.Custom
+	if s.SAML == nil {
+		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
+	}
+
+	if _, err := findSAMLProviderByNameAndValidateUID(s, providerCache); err != nil {
+		return err
+	}
+
+	// SAML does not have a way to refresh the user's identity without sending the user's browser to the identity
+	// provider, so the username and groups stay the same. The session ends when the identity provider said it ends.
+	if !s.SAML.SessionNotOnOrAfter.IsZero() && !time.Now().Before(s.SAML.SessionNotOnOrAfter) {
+		return errorsx.WithStack(errUpstreamRefreshError().WithHint(
+			"Upstream session has expired.").
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+	}
+
+	return nil
+}
+
+func findSAMLProviderByNameAndValidateUID(
+	s *psession.CustomSessionData,
+	providerCache oidc.UpstreamIdentityProvidersLister,
+) (provider.UpstreamSAMLIdentityProviderI, error) {
+	for _, p := range providerCache.GetSAMLIdentityProviders() {
+		if p.GetName() == s.ProviderName {
+			if p.GetResourceUID() != s.ProviderUID {
+				return nil, errorsx.WithStack(errUpstreamRefreshError().WithHint(
+					"Provider from upstream session data has changed its resource UID since authentication.").
+					WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+			}
+			return p, nil
+		}
+	}
+	return nil, errorsx.WithStack(errUpstreamRefreshError().
+		WithHint("Provider from upstream session data was not found.").
+		WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+}
+
+func upstreamOAuth2Refresh(ctx context.Context, providerCache oidc.UpstreamIdentityProvidersLister, session *psession.PinnipedSession) error {
+	s := session.Custom
+	if s.OAuth2 == nil || (s.OAuth2.UpstreamRefreshToken == "" && s.OAuth2.UpstreamAccessToken == "") {
+		return errorsx.WithStack(errMissingUpstreamSessionInternalError())
+	}
+
+	username, err := getDownstreamUsernameFromPinnipedSession(session)
+	if err != nil {
+		return err
+	}
+	oldGroups, err := getDownstreamGroupsFromPinnipedSession(session)
+	if err != nil {
+		return err
+	}
+
+	p, err := findOAuth2ProviderByNameAndValidateUID(s, providerCache)
+	if err != nil {
+		return err
+	}
+
+	plog.Debug("attempting upstream refresh request",
+		"providerName", s.ProviderName, "providerType", s.ProviderType, "providerUID", s.ProviderUID)
+
+	// Use the refresh token to get a new access token when there is one. Otherwise, use the stored access token,
+	// which will stop working when it expires.
+	accessToken := s.OAuth2.UpstreamAccessToken
+	var newRefreshToken string
+	if s.OAuth2.UpstreamRefreshToken != "" {
+		tokens, err := p.PerformRefresh(ctx, s.OAuth2.UpstreamRefreshToken)
+		if err != nil {
+			return errUpstreamRefreshError().WithHint(
+				"Upstream refresh failed.").WithTrace(err).
+				WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+		}
+		accessToken = tokens.AccessToken
+		newRefreshToken = tokens.RefreshToken
+	}
+
+	user, err := p.GetUser(ctx, accessToken)
+	if err != nil {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(err).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+
+	if user.DownstreamSubject != session.Fosite.Claims.Subject {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(errors.New("subject in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+	if user.Username != username {
+		return errUpstreamRefreshError().WithHint(
+			"Upstream refresh failed.").WithTrace(errors.New("username in upstream refresh does not match previous value")).
+			WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType)
+	}
+
+	warnIfGroupsChanged(ctx, oldGroups, user.Groups, username)
+	session.Fosite.Claims.Extra[oidc.DownstreamGroupsClaim] = user.Groups
+
+	// Upstream providers may rotate refresh tokens, so always keep the most recent one.
+	if newRefreshToken != "" {
+		plog.Debug("upstream refresh request returned a new refresh token",
+			"providerName", s.ProviderName, "providerType", s.ProviderType, "providerUID", s.ProviderUID)
+		s.OAuth2.UpstreamRefreshToken = newRefreshToken
+	}
+
+	return nil
+}
+
+func findOAuth2ProviderByNameAndValidateUID(
+	s *psession.CustomSessionData,
+	providerCache oidc.UpstreamIdentityProvidersLister,
+) (provider.UpstreamOAuth2IdentityProviderI, error) {
+	for _, p := range providerCache.GetOAuth2IdentityProviders() {
+		if p.GetName() == s.ProviderName {
+			if p.GetResourceUID() != s.ProviderUID {
+				return nil, errorsx.WithStack(errUpstreamRefreshError().WithHint(
+					"Provider from upstream session data has changed its resource UID since authentication.").
+					WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+			}
+			return p, nil
+		}
+	}
+	return nil, errorsx.WithStack(errUpstreamRefreshError().
+		WithHint("Provider from upstream session data was not found.").
+		WithDebugf("provider name: %q, provider type: %q", s.ProviderName, s.ProviderType))
+}
+
 func getDownstreamUsernameFromPinnipedSession(session *psession.PinnipedSession) (string, error) {
 	extra := session.Fosite.Claims.Extra
 	if extra == nil {
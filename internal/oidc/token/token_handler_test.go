@@ -5,10 +5,13 @@ package token
 
 import (
 	"context"
+	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/base32"
 	"encoding/base64"
 	"encoding/json"
@@ -47,11 +50,15 @@ import (
 	"go.pinniped.dev/internal/here"
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/certbinding"
+	"go.pinniped.dev/internal/oidc/dpop"
 	"go.pinniped.dev/internal/oidc/jwks"
 	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/tokenexchange"
 	"go.pinniped.dev/internal/psession"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/oidctestutil"
+	"go.pinniped.dev/internal/upstreamgithub"
 	"go.pinniped.dev/pkg/oidcclient/oidctypes"
 )
 
@@ -197,6 +204,34 @@ var (
 		}
 	`)
 
+	fositeClientCertificateRequiredErrorBody = here.Doc(`
+		{
+			"error":             "invalid_request",
+			"error_description": "The request is missing a required parameter, includes an invalid parameter value, includes a parameter more than once, or is otherwise malformed. A client certificate is required to request tokens from this issuer."
+		}
+	`)
+
+	fositeRefreshTokenBoundToDifferentClientCertificateErrorBody = here.Doc(`
+		{
+			"error":             "invalid_grant",
+			"error_description": "The provided authorization grant (e.g., authorization code, resource owner credentials) or refresh token is invalid, expired, revoked, does not match the redirection URI used in the authorization request, or was issued to another client. The refresh token is bound to a different client certificate."
+		}
+	`)
+
+	fositeRefreshTokenBoundToDifferentDPoPKeyErrorBody = here.Doc(`
+		{
+			"error":             "invalid_grant",
+			"error_description": "The provided authorization grant (e.g., authorization code, resource owner credentials) or refresh token is invalid, expired, revoked, does not match the redirection URI used in the authorization request, or was issued to another client. The refresh token is bound to a DPoP key, which the request did not prove possession of."
+		}
+	`)
+
+	goodClientCertificate  = &x509.Certificate{Raw: []byte("some-client-certificate")}
+	otherClientCertificate = &x509.Certificate{Raw: []byte("some-other-client-certificate")}
+
+	presentClientCertificate = func(r *http.Request, certificate *x509.Certificate) {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{certificate}}
+	}
+
 	happyAuthRequest = &http.Request{
 		Form: url.Values{
 			"response_type":         {"code"},
@@ -234,6 +269,11 @@ type expectedUpstreamValidateTokens struct {
 	args                    *oidctestutil.ValidateTokenAndMergeWithUserInfoArgs
 }
 
+type expectedUpstreamGetUser struct {
+	performedByUpstreamName string
+	args                    *oidctestutil.GetUserArgs
+}
+
 type tokenEndpointResponseExpectedValues struct {
 	wantStatus                        int
 	wantSuccessBodyFields             []string
@@ -243,7 +283,9 @@ type tokenEndpointResponseExpectedValues struct {
 	wantGroups                        []string
 	wantUpstreamRefreshCall           *expectedUpstreamRefresh
 	wantUpstreamOIDCValidateTokenCall *expectedUpstreamValidateTokens
+	wantUpstreamGetUserCall           *expectedUpstreamGetUser
 	wantCustomSessionDataStored       *psession.CustomSessionData
+	wantConfirmation                  map[string]interface{} // the cnf claim of the ID token, when the tokens are bound
 }
 
 type authcodeExchangeInputs struct {
@@ -254,12 +296,27 @@ type authcodeExchangeInputs struct {
 		s fositestoragei.AllFositeStorage,
 		authCode string,
 	)
-	makeOathHelper    OauthHelperFactoryFunc
-	customSessionData *psession.CustomSessionData
-	want              tokenEndpointResponseExpectedValues
+	makeOathHelper      OauthHelperFactoryFunc
+	customSessionData   *psession.CustomSessionData
+	certificateBinding  certbinding.Mode // defaults to certbinding.Disabled
+	tokenExchangePolicy *tokenexchange.Policy
+	want                tokenEndpointResponseExpectedValues
 }
 
 func TestTokenEndpointAuthcodeExchange(t *testing.T) {
+	customSessionData := func(certificateThumbprint string) *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			ProviderUID:           "some-uid",
+			ProviderName:          "some-idp",
+			ProviderType:          psession.ProviderTypeOIDC,
+			CertificateThumbprint: certificateThumbprint,
+			OIDC:                  &psession.OIDCSessionData{UpstreamRefreshToken: "some-upstream-refresh-token"},
+		}
+	}
+	dpopKey := generateDPoPKey(t)
+	dpopBoundCustomSessionData := customSessionData("")
+	dpopBoundCustomSessionData.DPoPKeyThumbprint = dpopKeyThumbprint(t, dpopKey)
+
 	tests := []struct {
 		name             string
 		authcodeExchange authcodeExchangeInputs
@@ -316,8 +373,118 @@ func TestTokenEndpointAuthcodeExchange(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "tokens are bound to the client certificate when certificate binding is optional",
+			authcodeExchange: authcodeExchangeInputs{
+				modifyTokenRequest: func(r *http.Request, authCode string) { presentClientCertificate(r, goodClientCertificate) },
+				customSessionData:  customSessionData(""),
+				certificateBinding: certbinding.Optional,
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:                  http.StatusOK,
+					wantSuccessBodyFields:       []string{"id_token", "access_token", "token_type", "scope", "expires_in"},
+					wantRequestedScopes:         []string{"openid", "profile", "email"},
+					wantGrantedScopes:           []string{"openid"},
+					wantGroups:                  goodGroups,
+					wantCustomSessionDataStored: customSessionData(certbinding.Thumbprint(goodClientCertificate)),
+				},
+			},
+		},
+		{
+			name: "tokens are not bound when certificate binding is optional and no client certificate is presented",
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData:  customSessionData(""),
+				certificateBinding: certbinding.Optional,
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:                  http.StatusOK,
+					wantSuccessBodyFields:       []string{"id_token", "access_token", "token_type", "scope", "expires_in"},
+					wantRequestedScopes:         []string{"openid", "profile", "email"},
+					wantGrantedScopes:           []string{"openid"},
+					wantGroups:                  goodGroups,
+					wantCustomSessionDataStored: customSessionData(""),
+				},
+			},
+		},
+		{
+			name: "tokens are not bound when certificate binding is disabled",
+			authcodeExchange: authcodeExchangeInputs{
+				modifyTokenRequest: func(r *http.Request, authCode string) { presentClientCertificate(r, goodClientCertificate) },
+				customSessionData:  customSessionData(""),
+				certificateBinding: certbinding.Disabled,
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:                  http.StatusOK,
+					wantSuccessBodyFields:       []string{"id_token", "access_token", "token_type", "scope", "expires_in"},
+					wantRequestedScopes:         []string{"openid", "profile", "email"},
+					wantGrantedScopes:           []string{"openid"},
+					wantGroups:                  goodGroups,
+					wantCustomSessionDataStored: customSessionData(""),
+				},
+			},
+		},
+		{
+			name: "tokens are bound to the DPoP key of the proof",
+			authcodeExchange: authcodeExchangeInputs{
+				modifyTokenRequest: func(r *http.Request, authCode string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+				},
+				customSessionData: customSessionData(""),
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:                  http.StatusOK,
+					wantSuccessBodyFields:       []string{"id_token", "access_token", "token_type", "scope", "expires_in"},
+					wantRequestedScopes:         []string{"openid", "profile", "email"},
+					wantGrantedScopes:           []string{"openid"},
+					wantGroups:                  goodGroups,
+					wantCustomSessionDataStored: dpopBoundCustomSessionData,
+					wantConfirmation:            map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)},
+				},
+			},
+		},
 
 		// sad path
+		{
+			name: "no client certificate is presented when certificate binding is required",
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData:  customSessionData(""),
+				certificateBinding: certbinding.Required,
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusBadRequest,
+					wantErrorResponseBody: fositeClientCertificateRequiredErrorBody,
+				},
+			},
+		},
+		{
+			name: "DPoP proof is expired",
+			authcodeExchange: authcodeExchangeInputs{
+				modifyTokenRequest: func(r *http.Request, authCode string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now().Add(-time.Hour)))
+				},
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusBadRequest,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "invalid_dpop_proof",
+							"error_description": "The DPoP proof is invalid. DPoP proof is expired or not yet valid"
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "DPoP proof is for a different URL",
+			authcodeExchange: authcodeExchangeInputs{
+				modifyTokenRequest: func(r *http.Request, authCode string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, "https://some-other-issuer.com/oauth2/token", time.Now()))
+				},
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusBadRequest,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "invalid_dpop_proof",
+							"error_description": "The DPoP proof is invalid. DPoP proof has htu 'https://some-other-issuer.com/oauth2/token', but the request was made to 'https://some-issuer.com/oauth2/token'"
+						}
+					`),
+				},
+			},
+		},
 		{
 			name: "GET method is wrong",
 			authcodeExchange: authcodeExchangeInputs{
@@ -642,16 +809,88 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 		want: successfulAuthCodeExchange,
 	}
 
+	boundCustomSessionData := func(certificateThumbprint string) *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			ProviderUID:           "some-uid",
+			ProviderName:          "some-idp",
+			ProviderType:          psession.ProviderTypeOIDC,
+			CertificateThumbprint: certificateThumbprint,
+			OIDC:                  &psession.OIDCSessionData{UpstreamRefreshToken: "some-upstream-refresh-token"},
+		}
+	}
+
+	doValidAuthCodeExchangeBoundToClientCertificate := authcodeExchangeInputs{
+		modifyAuthRequest: func(authRequest *http.Request) {
+			authRequest.Form.Set("scope", "openid pinniped:request-audience")
+		},
+		modifyTokenRequest: func(r *http.Request, authCode string) { presentClientCertificate(r, goodClientCertificate) },
+		customSessionData:  boundCustomSessionData(""),
+		certificateBinding: certbinding.Optional,
+		want: tokenEndpointResponseExpectedValues{
+			wantStatus:                  http.StatusOK,
+			wantSuccessBodyFields:       []string{"id_token", "access_token", "token_type", "expires_in", "scope"},
+			wantRequestedScopes:         []string{"openid", "pinniped:request-audience"},
+			wantGrantedScopes:           []string{"openid", "pinniped:request-audience"},
+			wantGroups:                  goodGroups,
+			wantCustomSessionDataStored: boundCustomSessionData(certbinding.Thumbprint(goodClientCertificate)),
+		},
+	}
+
+	// The client does not present a certificate, so the tokens are not bound to one.
+	doValidAuthCodeExchangeNotBoundToClientCertificate := doValidAuthCodeExchangeBoundToClientCertificate
+	doValidAuthCodeExchangeNotBoundToClientCertificate.modifyTokenRequest = nil
+	doValidAuthCodeExchangeNotBoundToClientCertificate.want.wantCustomSessionDataStored = boundCustomSessionData("")
+
+	doValidAuthCodeExchangeRequiringClientCertificate := doValidAuthCodeExchangeBoundToClientCertificate
+	doValidAuthCodeExchangeRequiringClientCertificate.certificateBinding = certbinding.Required
+
+	dpopKey := generateDPoPKey(t)
+	dpopBoundCustomSessionData := boundCustomSessionData("")
+	dpopBoundCustomSessionData.DPoPKeyThumbprint = dpopKeyThumbprint(t, dpopKey)
+	doValidAuthCodeExchangeBoundToDPoPKey := authcodeExchangeInputs{
+		modifyAuthRequest: func(authRequest *http.Request) {
+			authRequest.Form.Set("scope", "openid pinniped:request-audience")
+		},
+		modifyTokenRequest: func(r *http.Request, authCode string) {
+			r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+		},
+		customSessionData: boundCustomSessionData(""),
+		want: tokenEndpointResponseExpectedValues{
+			wantStatus:                  http.StatusOK,
+			wantSuccessBodyFields:       []string{"id_token", "access_token", "token_type", "expires_in", "scope"},
+			wantRequestedScopes:         []string{"openid", "pinniped:request-audience"},
+			wantGrantedScopes:           []string{"openid", "pinniped:request-audience"},
+			wantGroups:                  goodGroups,
+			wantCustomSessionDataStored: dpopBoundCustomSessionData,
+			wantConfirmation:            map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)},
+		},
+	}
+
+	withTokenExchangePolicy := func(t *testing.T, inputs authcodeExchangeInputs, clients ...tokenexchange.ClientPolicy) authcodeExchangeInputs {
+		policy, err := tokenexchange.NewPolicy(clients)
+		require.NoError(t, err)
+		inputs.tokenExchangePolicy = policy
+		return inputs
+	}
+
+	requestAccessToken := func(t *testing.T, params url.Values) {
+		params.Set("requested_token_type", "urn:ietf:params:oauth:token-type:access_token")
+	}
+
 	tests := []struct {
 		name string
 
 		authcodeExchange    authcodeExchangeInputs
 		modifyRequestParams func(t *testing.T, params url.Values)
 		modifyStorage       func(t *testing.T, storage *oidc.KubeStorage, pendingRequest *http.Request)
+		modifyTokenRequest  func(r *http.Request)
 		requestedAudience   string
 
 		wantStatus               int
 		wantResponseBodyContains string
+		wantConfirmation         map[string]interface{}
+		wantTokenType            string // defaults to "N_A"
+		wantIssuedTokenType      string // defaults to "urn:ietf:params:oauth:token-type:jwt"
 	}{
 		{
 			name:              "happy path",
@@ -659,6 +898,128 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 			requestedAudience: "some-workload-cluster",
 			wantStatus:        http.StatusOK,
 		},
+		{
+			name:               "access token is bound to the client certificate",
+			authcodeExchange:   doValidAuthCodeExchangeBoundToClientCertificate,
+			modifyTokenRequest: func(r *http.Request) { presentClientCertificate(r, goodClientCertificate) },
+			requestedAudience:  "some-workload-cluster",
+			wantStatus:         http.StatusOK,
+		},
+		{
+			name:                     "access token is bound to a different client certificate",
+			authcodeExchange:         doValidAuthCodeExchangeBoundToClientCertificate,
+			modifyTokenRequest:       func(r *http.Request) { presentClientCertificate(r, otherClientCertificate) },
+			requestedAudience:        "some-workload-cluster",
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "subject_token is bound to a different client certificate",
+		},
+		{
+			name:                     "access token is bound to a client certificate which is not presented",
+			authcodeExchange:         doValidAuthCodeExchangeBoundToClientCertificate,
+			requestedAudience:        "some-workload-cluster",
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "subject_token is bound to a different client certificate",
+		},
+		{
+			name:               "access token is not bound to a client certificate when certificate binding is optional",
+			authcodeExchange:   doValidAuthCodeExchangeNotBoundToClientCertificate,
+			modifyTokenRequest: func(r *http.Request) { presentClientCertificate(r, goodClientCertificate) },
+			requestedAudience:  "some-workload-cluster",
+			wantStatus:         http.StatusOK,
+		},
+		{
+			name:             "access token is not bound to a client certificate when certificate binding is required",
+			authcodeExchange: doValidAuthCodeExchangeRequiringClientCertificate,
+			modifyStorage: func(t *testing.T, storage *oidc.KubeStorage, pendingRequest *http.Request) {
+				// Simulate an access token which was issued before certificate binding was required.
+				parts := strings.Split(pendingRequest.Form.Get("subject_token"), ".")
+				require.Len(t, parts, 2)
+				requester, err := storage.GetAccessTokenSession(context.Background(), parts[1], nil)
+				require.NoError(t, err)
+				requester.GetSession().(*psession.PinnipedSession).Custom.CertificateThumbprint = ""
+				require.NoError(t, storage.DeleteAccessTokenSession(context.Background(), parts[1]))
+				require.NoError(t, storage.CreateAccessTokenSession(context.Background(), parts[1], requester))
+			},
+			modifyTokenRequest:       func(r *http.Request) { presentClientCertificate(r, goodClientCertificate) },
+			requestedAudience:        "some-workload-cluster",
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "subject_token is not bound to a client certificate, which is required by this issuer",
+		},
+		{
+			name:             "access token is bound to the DPoP key",
+			authcodeExchange: doValidAuthCodeExchangeBoundToDPoPKey,
+			modifyTokenRequest: func(r *http.Request) {
+				r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+			},
+			requestedAudience: "some-workload-cluster",
+			wantStatus:        http.StatusOK,
+			wantConfirmation:  map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)},
+		},
+		{
+			name:             "access token is bound to a different DPoP key",
+			authcodeExchange: doValidAuthCodeExchangeBoundToDPoPKey,
+			modifyTokenRequest: func(r *http.Request) {
+				r.Header.Set("DPoP", makeDPoPProof(t, generateDPoPKey(t), goodIssuer+oidc.TokenEndpointPath, time.Now()))
+			},
+			requestedAudience:        "some-workload-cluster",
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "subject_token is bound to a DPoP key, which the request did not prove possession of",
+		},
+		{
+			name:                     "access token is bound to a DPoP key without a DPoP proof",
+			authcodeExchange:         doValidAuthCodeExchangeBoundToDPoPKey,
+			requestedAudience:        "some-workload-cluster",
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "subject_token is bound to a DPoP key, which the request did not prove possession of",
+		},
+		{
+			name:                "access token is requested",
+			authcodeExchange:    doValidAuthCodeExchange,
+			modifyRequestParams: requestAccessToken,
+			requestedAudience:   "some-workload-cluster",
+			wantStatus:          http.StatusOK,
+			wantTokenType:       "Bearer",
+			wantIssuedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		},
+		{
+			name:             "access token is requested with a subject_token which is bound to the DPoP key",
+			authcodeExchange: doValidAuthCodeExchangeBoundToDPoPKey,
+			modifyTokenRequest: func(r *http.Request) {
+				r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+			},
+			modifyRequestParams: requestAccessToken,
+			requestedAudience:   "some-workload-cluster",
+			wantStatus:          http.StatusOK,
+			wantConfirmation:    map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)},
+			wantTokenType:       "DPoP",
+			wantIssuedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+		},
+		{
+			name: "audience is allowed by the token exchange policy",
+			authcodeExchange: withTokenExchangePolicy(t, doValidAuthCodeExchange,
+				tokenexchange.ClientPolicy{ClientID: goodClient, AllowedAudiences: []string{"other-audience", "cluster-*"}},
+			),
+			requestedAudience: "cluster-1",
+			wantStatus:        http.StatusOK,
+		},
+		{
+			name: "audience is not allowed by the token exchange policy",
+			authcodeExchange: withTokenExchangePolicy(t, doValidAuthCodeExchange,
+				tokenexchange.ClientPolicy{ClientID: goodClient, AllowedAudiences: []string{"cluster-*"}},
+			),
+			requestedAudience:        "some-workload-cluster",
+			wantStatus:               http.StatusBadRequest,
+			wantResponseBodyContains: `"error":"invalid_target","error_description":"The requested audience is invalid, unknown, or malformed. client 'pinniped-cli' may not request the audience 'some-workload-cluster'"`,
+		},
+		{
+			name: "client is not listed by the token exchange policy",
+			authcodeExchange: withTokenExchangePolicy(t, doValidAuthCodeExchange,
+				tokenexchange.ClientPolicy{ClientID: "some-other-client", AllowedAudiences: []string{"*"}},
+			),
+			requestedAudience:        "cluster-1",
+			wantStatus:               http.StatusBadRequest,
+			wantResponseBodyContains: `"error":"invalid_target","error_description":"The requested audience is invalid, unknown, or malformed. client 'pinniped-cli' may not request the audience 'cluster-1'"`,
+		},
 		{
 			name:                     "missing audience",
 			authcodeExchange:         doValidAuthCodeExchange,
@@ -800,6 +1161,9 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 
 			req := httptest.NewRequest("POST", "/path/shouldn't/matter", body(request.Form).ReadCloser())
 			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.modifyTokenRequest != nil {
+				test.modifyTokenRequest(req)
+			}
 			rsp = httptest.NewRecorder()
 
 			// Measure the secrets in storage after the auth code flow.
@@ -834,9 +1198,18 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 			var responseBody map[string]interface{}
 			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &responseBody))
 
+			wantTokenType := test.wantTokenType
+			if wantTokenType == "" {
+				wantTokenType = "N_A"
+			}
+			wantIssuedTokenType := test.wantIssuedTokenType
+			if wantIssuedTokenType == "" {
+				wantIssuedTokenType = "urn:ietf:params:oauth:token-type:jwt"
+			}
+
 			require.Contains(t, responseBody, "access_token")
-			require.Equal(t, "N_A", responseBody["token_type"])
-			require.Equal(t, "urn:ietf:params:oauth:token-type:jwt", responseBody["issued_token_type"])
+			require.Equal(t, wantTokenType, responseBody["token_type"])
+			require.Equal(t, wantIssuedTokenType, responseBody["issued_token_type"])
 
 			// Parse the returned token.
 			parsedJWT, err := jose.ParseSigned(responseBody["access_token"].(string))
@@ -846,6 +1219,10 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 
 			// Make sure that these are the only fields in the token.
 			idTokenFields := []string{"sub", "aud", "iss", "jti", "auth_time", "exp", "iat", "rat", "groups", "username"}
+			if test.wantConfirmation != nil {
+				idTokenFields = append(idTokenFields, "cnf")
+				require.Equal(t, test.wantConfirmation, tokenClaims["cnf"])
+			}
 			require.ElementsMatch(t, idTokenFields, getMapKeys(tokenClaims))
 
 			// Assert that the returned token has expected claims values.
@@ -883,94 +1260,408 @@ func TestTokenEndpointTokenExchange(t *testing.T) { // tests for grant_type "urn
 	}
 }
 
-type refreshRequestInputs struct {
-	modifyTokenRequest func(tokenRequest *http.Request, refreshToken string, accessToken string)
-	want               tokenEndpointResponseExpectedValues
-}
-
-func TestRefreshGrant(t *testing.T) {
+func TestTokenEndpointWorkloadTokenExchange(t *testing.T) { // tests for token exchanges of JWTs from workload identity providers
 	const (
-		oidcUpstreamName                  = "some-oidc-idp"
-		oidcUpstreamResourceUID           = "oidc-resource-uid"
-		oidcUpstreamType                  = "oidc"
-		oidcUpstreamInitialRefreshToken   = "initial-upstream-refresh-token"
-		oidcUpstreamRefreshedIDToken      = "fake-refreshed-id-token"
-		oidcUpstreamRefreshedRefreshToken = "fake-refreshed-refresh-token"
-		oidcUpstreamAccessToken           = "fake-upstream-access-token" //nolint:gosec
-
-		ldapUpstreamName        = "some-ldap-idp"
-		ldapUpstreamResourceUID = "ldap-resource-uid"
-		ldapUpstreamType        = "ldap"
-		ldapUpstreamDN          = "some-ldap-user-dn"
-
-		activeDirectoryUpstreamName        = "some-ad-idp"
-		activeDirectoryUpstreamResourceUID = "ad-resource-uid"
-		activeDirectoryUpstreamType        = "activedirectory"
-		activeDirectoryUpstreamDN          = "some-ad-user-dn"
+		workloadIssuer   = "https://token.actions.example.com"
+		workloadSubject  = "https://token.actions.example.com?sub=repo%3Amy-org%2Fmy-repo"
+		workloadUsername = "github:my-org/my-repo"
 	)
+	workloadGroups := []string{"github:my-org"}
 
-	ldapUpstreamURL, _ := url.Parse("some-url")
-
-	// The below values are funcs so every test can have its own copy of the objects, to avoid data races
-	// in these parallel tests.
-
-	upstreamOIDCIdentityProviderBuilder := func() *oidctestutil.TestUpstreamOIDCIdentityProviderBuilder {
-		return oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
-			WithName(oidcUpstreamName).
-			WithResourceUID(oidcUpstreamResourceUID)
+	makeWorkloadJWT := func(t *testing.T, issuer string) string {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+		require.NoError(t, err)
+		token, err := josejwt.Signed(signer).Claims(josejwt.Claims{Issuer: issuer, Subject: "repo:my-org/my-repo"}).CompactSerialize()
+		require.NoError(t, err)
+		return token
 	}
-
-	initialUpstreamOIDCRefreshTokenCustomSessionData := func() *psession.CustomSessionData {
-		return &psession.CustomSessionData{
-			ProviderName: oidcUpstreamName,
-			ProviderUID:  oidcUpstreamResourceUID,
-			ProviderType: oidcUpstreamType,
-			OIDC: &psession.OIDCSessionData{
-				UpstreamRefreshToken: oidcUpstreamInitialRefreshToken,
-				UpstreamSubject:      goodUpstreamSubject,
-				UpstreamIssuer:       goodIssuer,
+	goodWorkloadJWT := makeWorkloadJWT(t, workloadIssuer)
+
+	acceptingProvider := func(name string) *oidctestutil.TestWorkloadIdentityProvider {
+		return &oidctestutil.TestWorkloadIdentityProvider{
+			Name:   name,
+			Issuer: workloadIssuer,
+			AuthenticateTokenFunc: func(ctx context.Context, token string) (*provider.WorkloadIdentity, error) {
+				if token != goodWorkloadJWT {
+					return nil, errors.New("some verification error")
+				}
+				return &provider.WorkloadIdentity{Username: workloadUsername, Groups: workloadGroups, DownstreamSubject: workloadSubject}, nil
 			},
 		}
 	}
-
-	initialUpstreamOIDCAccessTokenCustomSessionData := func() *psession.CustomSessionData {
-		return &psession.CustomSessionData{
-			ProviderName: oidcUpstreamName,
-			ProviderUID:  oidcUpstreamResourceUID,
-			ProviderType: oidcUpstreamType,
-			OIDC: &psession.OIDCSessionData{
-				UpstreamAccessToken: oidcUpstreamAccessToken,
-				UpstreamSubject:     goodUpstreamSubject,
-				UpstreamIssuer:      goodIssuer,
+	rejectingProvider := func(name string) *oidctestutil.TestWorkloadIdentityProvider {
+		return &oidctestutil.TestWorkloadIdentityProvider{
+			Name:   name,
+			Issuer: workloadIssuer,
+			AuthenticateTokenFunc: func(ctx context.Context, token string) (*provider.WorkloadIdentity, error) {
+				return nil, errors.New("some condition is false")
 			},
 		}
 	}
 
-	upstreamOIDCCustomSessionDataWithNewRefreshToken := func(newRefreshToken string) *psession.CustomSessionData {
-		sessionData := initialUpstreamOIDCRefreshTokenCustomSessionData()
-		sessionData.OIDC.UpstreamRefreshToken = newRefreshToken
-		return sessionData
+	doValidAuthCodeExchange := authcodeExchangeInputs{
+		modifyAuthRequest: func(authRequest *http.Request) {
+			authRequest.Form.Set("scope", "openid pinniped:request-audience")
+		},
+		want: tokenEndpointResponseExpectedValues{
+			wantStatus:            http.StatusOK,
+			wantSuccessBodyFields: []string{"id_token", "access_token", "token_type", "expires_in", "scope"},
+			wantRequestedScopes:   []string{"openid", "pinniped:request-audience"},
+			wantGrantedScopes:     []string{"openid", "pinniped:request-audience"},
+			wantGroups:            goodGroups,
+		},
 	}
-
-	happyOIDCUpstreamRefreshCall := func() *expectedUpstreamRefresh {
-		return &expectedUpstreamRefresh{
-			performedByUpstreamName: oidcUpstreamName,
-			args: &oidctestutil.PerformRefreshArgs{
-				Ctx:          nil, // this will be filled in with the actual request context by the test below
-				RefreshToken: oidcUpstreamInitialRefreshToken,
-			},
-		}
+	doValidAuthCodeExchangeWithCertificateBinding := doValidAuthCodeExchange
+	doValidAuthCodeExchangeWithCertificateBinding.certificateBinding = certbinding.Optional
+	doValidAuthCodeExchangeRequiringClientCertificate := doValidAuthCodeExchange
+	doValidAuthCodeExchangeRequiringClientCertificate.certificateBinding = certbinding.Required
+	doValidAuthCodeExchangeRequiringClientCertificate.modifyTokenRequest = func(r *http.Request, authCode string) {
+		presentClientCertificate(r, goodClientCertificate)
 	}
 
-	happyLDAPUpstreamRefreshCall := func() *expectedUpstreamRefresh {
-		return &expectedUpstreamRefresh{
-			performedByUpstreamName: ldapUpstreamName,
-			args: &oidctestutil.PerformRefreshArgs{
-				Ctx:              nil,
-				DN:               ldapUpstreamDN,
-				ExpectedSubject:  goodSubject,
-				ExpectedUsername: goodUsername,
-			},
+	dpopKey := generateDPoPKey(t)
+
+	tests := []struct {
+		name string
+
+		authcodeExchange   authcodeExchangeInputs
+		workloadProviders  []*oidctestutil.TestWorkloadIdentityProvider
+		subjectToken       string
+		requestedTokenType string
+		modifyTokenRequest func(r *http.Request)
+		policy             []tokenexchange.ClientPolicy
+
+		wantStatus               int
+		wantResponseBodyContains string
+		wantConfirmation         map[string]interface{}
+		wantTokenType            string
+	}{
+		{
+			name:              "happy path",
+			workloadProviders: []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:      goodWorkloadJWT,
+			wantStatus:        http.StatusOK,
+			wantTokenType:     "N_A",
+		},
+		{
+			name: "the second provider of the issuer accepts the JWT",
+			workloadProviders: []*oidctestutil.TestWorkloadIdentityProvider{
+				rejectingProvider("some-workload-idp"),
+				acceptingProvider("other-workload-idp"),
+			},
+			subjectToken:  goodWorkloadJWT,
+			wantStatus:    http.StatusOK,
+			wantTokenType: "N_A",
+		},
+		{
+			name:               "access token is requested with a DPoP proof",
+			workloadProviders:  []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:       goodWorkloadJWT,
+			requestedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+			modifyTokenRequest: func(r *http.Request) {
+				r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+			},
+			wantStatus:       http.StatusOK,
+			wantConfirmation: map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)},
+			wantTokenType:    "DPoP",
+		},
+		{
+			name:               "access token is requested without a DPoP proof",
+			workloadProviders:  []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:       goodWorkloadJWT,
+			requestedTokenType: "urn:ietf:params:oauth:token-type:access_token",
+			wantStatus:         http.StatusOK,
+			wantTokenType:      "Bearer",
+		},
+		{
+			name:               "request presents a client certificate",
+			authcodeExchange:   doValidAuthCodeExchangeWithCertificateBinding,
+			workloadProviders:  []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:       goodWorkloadJWT,
+			modifyTokenRequest: func(r *http.Request) { presentClientCertificate(r, goodClientCertificate) },
+			wantStatus:         http.StatusOK,
+			wantTokenType:      "N_A",
+		},
+		{
+			name:               "request presents a client certificate when certificate binding is required",
+			authcodeExchange:   doValidAuthCodeExchangeRequiringClientCertificate,
+			workloadProviders:  []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:       goodWorkloadJWT,
+			modifyTokenRequest: func(r *http.Request) { presentClientCertificate(r, goodClientCertificate) },
+			wantStatus:         http.StatusOK,
+			wantTokenType:      "N_A",
+		},
+		{
+			name:                     "request does not present a client certificate when certificate binding is required",
+			authcodeExchange:         doValidAuthCodeExchangeRequiringClientCertificate,
+			workloadProviders:        []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:             goodWorkloadJWT,
+			wantStatus:               http.StatusBadRequest,
+			wantResponseBodyContains: "A client certificate is required to request tokens from this issuer.",
+		},
+		{
+			name:              "audience is allowed by the token exchange policy",
+			workloadProviders: []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:      goodWorkloadJWT,
+			policy:            []tokenexchange.ClientPolicy{{ClientID: goodClient, AllowedAudiences: []string{"some-workload-*"}}},
+			wantStatus:        http.StatusOK,
+			wantTokenType:     "N_A",
+		},
+		{
+			name:                     "audience is not allowed by the token exchange policy",
+			workloadProviders:        []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:             goodWorkloadJWT,
+			policy:                   []tokenexchange.ClientPolicy{{ClientID: goodClient, AllowedAudiences: []string{"other-*"}}},
+			wantStatus:               http.StatusBadRequest,
+			wantResponseBodyContains: `"error":"invalid_target"`,
+		},
+		{
+			name:                     "no provider trusts the issuer",
+			workloadProviders:        []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:             makeWorkloadJWT(t, "https://other-issuer.example.com"),
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "invalid subject_token",
+		},
+		{
+			name:                     "no providers",
+			subjectToken:             goodWorkloadJWT,
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "invalid subject_token",
+		},
+		{
+			name: "every provider of the issuer rejects the JWT",
+			workloadProviders: []*oidctestutil.TestWorkloadIdentityProvider{
+				rejectingProvider("some-workload-idp"),
+				rejectingProvider("other-workload-idp"),
+			},
+			subjectToken:             goodWorkloadJWT,
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "invalid subject_token",
+		},
+		{
+			name:                     "JWT is not valid for the provider",
+			workloadProviders:        []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:             makeWorkloadJWT(t, workloadIssuer),
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "invalid subject_token",
+		},
+		{
+			name:                     "subject_token is not a JWT",
+			workloadProviders:        []*oidctestutil.TestWorkloadIdentityProvider{acceptingProvider("some-workload-idp")},
+			subjectToken:             "not-a-jwt",
+			wantStatus:               http.StatusUnauthorized,
+			wantResponseBodyContains: "invalid subject_token",
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			t.Parallel()
+
+			authcodeExchange := test.authcodeExchange
+			if authcodeExchange.modifyAuthRequest == nil {
+				authcodeExchange = doValidAuthCodeExchange
+			}
+			if test.policy != nil {
+				policy, err := tokenexchange.NewPolicy(test.policy)
+				require.NoError(t, err)
+				authcodeExchange.tokenExchangePolicy = policy
+			}
+
+			// The authcode exchange only creates the token endpoint, whose tokens are not used by these tests.
+			subject, _, _, _, secrets, _ := exchangeAuthcodeForTokens(t,
+				authcodeExchange, oidctestutil.NewUpstreamIDPListerBuilder().WithWorkload(test.workloadProviders...).Build())
+
+			const requestedAudience = "some-workload-cluster"
+			request := happyTokenExchangeRequest(requestedAudience, test.subjectToken)
+			request.Form.Set("subject_token_type", "urn:ietf:params:oauth:token-type:jwt")
+			if test.requestedTokenType != "" {
+				request.Form.Set("requested_token_type", test.requestedTokenType)
+			}
+
+			req := httptest.NewRequest("POST", "/path/shouldn't/matter", body(request.Form).ReadCloser())
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if test.modifyTokenRequest != nil {
+				test.modifyTokenRequest(req)
+			}
+			rsp := httptest.NewRecorder()
+
+			existingSecrets, err := secrets.List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+
+			subject.ServeHTTP(rsp, req)
+			t.Logf("response: %#v", rsp)
+			t.Logf("response body: %q", rsp.Body.String())
+
+			require.Equal(t, test.wantStatus, rsp.Code)
+			testutil.RequireEqualContentType(t, rsp.Header().Get("Content-Type"), "application/json")
+			if test.wantResponseBodyContains != "" {
+				require.Contains(t, rsp.Body.String(), test.wantResponseBodyContains)
+			}
+
+			// Nothing is stored for workloads, whose tokens cannot be refreshed.
+			newSecrets, err := secrets.List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+			require.ElementsMatch(t, existingSecrets.Items, newSecrets.Items)
+
+			if rsp.Code != http.StatusOK {
+				return
+			}
+
+			var responseBody map[string]interface{}
+			require.NoError(t, json.Unmarshal(rsp.Body.Bytes(), &responseBody))
+			require.Equal(t, test.wantTokenType, responseBody["token_type"])
+
+			parsedJWT, err := jose.ParseSigned(responseBody["access_token"].(string))
+			require.NoError(t, err)
+			var tokenClaims map[string]interface{}
+			require.NoError(t, json.Unmarshal(parsedJWT.UnsafePayloadWithoutVerification(), &tokenClaims))
+
+			idTokenFields := []string{"sub", "aud", "iss", "jti", "auth_time", "exp", "iat", "rat", "groups", "username"}
+			if test.wantConfirmation != nil {
+				idTokenFields = append(idTokenFields, "cnf")
+				require.Equal(t, test.wantConfirmation, tokenClaims["cnf"])
+			}
+			require.ElementsMatch(t, idTokenFields, getMapKeys(tokenClaims))
+
+			require.Equal(t, []interface{}{requestedAudience}, tokenClaims["aud"])
+			require.Equal(t, goodIssuer, tokenClaims["iss"])
+			require.Equal(t, workloadSubject, tokenClaims["sub"])
+			require.Equal(t, workloadUsername, tokenClaims["username"])
+			require.Equal(t, toSliceOfInterface(workloadGroups), tokenClaims["groups"])
+		})
+	}
+}
+
+type refreshRequestInputs struct {
+	modifyTokenRequest func(tokenRequest *http.Request, refreshToken string, accessToken string)
+	want               tokenEndpointResponseExpectedValues
+}
+
+func TestRefreshGrant(t *testing.T) {
+	const (
+		oidcUpstreamName                  = "some-oidc-idp"
+		oidcUpstreamResourceUID           = "oidc-resource-uid"
+		oidcUpstreamType                  = "oidc"
+		oidcUpstreamInitialRefreshToken   = "initial-upstream-refresh-token"
+		oidcUpstreamRefreshedIDToken      = "fake-refreshed-id-token"
+		oidcUpstreamRefreshedRefreshToken = "fake-refreshed-refresh-token"
+		oidcUpstreamAccessToken           = "fake-upstream-access-token" //nolint:gosec
+
+		ldapUpstreamName        = "some-ldap-idp"
+		ldapUpstreamResourceUID = "ldap-resource-uid"
+		ldapUpstreamType        = "ldap"
+		ldapUpstreamDN          = "some-ldap-user-dn"
+
+		activeDirectoryUpstreamName        = "some-ad-idp"
+		activeDirectoryUpstreamResourceUID = "ad-resource-uid"
+		activeDirectoryUpstreamType        = "activedirectory"
+		activeDirectoryUpstreamDN          = "some-ad-user-dn"
+
+		webhookUpstreamName        = "some-webhook-idp"
+		webhookUpstreamResourceUID = "webhook-resource-uid"
+		webhookUpstreamType        = "webhook"
+		webhookUpstreamUserUID     = "some-webhook-user-uid"
+
+		localUpstreamName        = "some-local-idp"
+		localUpstreamResourceUID = "local-resource-uid"
+		localUpstreamType        = "local"
+		localUpstreamUserUID     = "some-local-user-uid"
+
+		gitHubUpstreamName        = "some-github-idp"
+		gitHubUpstreamResourceUID = "github-resource-uid"
+		gitHubUpstreamType        = "github"
+		gitHubUpstreamAccessToken = "some-github-access-token" //nolint:gosec
+
+		samlUpstreamName        = "some-saml-idp"
+		samlUpstreamResourceUID = "saml-resource-uid"
+		samlUpstreamType        = "saml"
+
+		oauth2UpstreamName                  = "some-oauth2-idp"
+		oauth2UpstreamResourceUID           = "oauth2-resource-uid"
+		oauth2UpstreamType                  = "oauth2"
+		oauth2UpstreamInitialRefreshToken   = "initial-oauth2-refresh-token"
+		oauth2UpstreamAccessToken           = "some-oauth2-access-token" //nolint:gosec
+		oauth2UpstreamRefreshedAccessToken  = "refreshed-oauth2-access-token"
+		oauth2UpstreamRefreshedRefreshToken = "refreshed-oauth2-refresh-token"
+	)
+
+	ldapUpstreamURL, _ := url.Parse("some-url")
+
+	// The below values are funcs so every test can have its own copy of the objects, to avoid data races
+	// in these parallel tests.
+
+	upstreamOIDCIdentityProviderBuilder := func() *oidctestutil.TestUpstreamOIDCIdentityProviderBuilder {
+		return oidctestutil.NewTestUpstreamOIDCIdentityProviderBuilder().
+			WithName(oidcUpstreamName).
+			WithResourceUID(oidcUpstreamResourceUID)
+	}
+
+	initialUpstreamOIDCRefreshTokenCustomSessionData := func() *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			ProviderName: oidcUpstreamName,
+			ProviderUID:  oidcUpstreamResourceUID,
+			ProviderType: oidcUpstreamType,
+			OIDC: &psession.OIDCSessionData{
+				UpstreamRefreshToken: oidcUpstreamInitialRefreshToken,
+				UpstreamSubject:      goodUpstreamSubject,
+				UpstreamIssuer:       goodIssuer,
+			},
+		}
+	}
+
+	initialUpstreamOIDCAccessTokenCustomSessionData := func() *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			ProviderName: oidcUpstreamName,
+			ProviderUID:  oidcUpstreamResourceUID,
+			ProviderType: oidcUpstreamType,
+			OIDC: &psession.OIDCSessionData{
+				UpstreamAccessToken: oidcUpstreamAccessToken,
+				UpstreamSubject:     goodUpstreamSubject,
+				UpstreamIssuer:      goodIssuer,
+			},
+		}
+	}
+
+	upstreamOIDCCustomSessionDataWithNewRefreshToken := func(newRefreshToken string) *psession.CustomSessionData {
+		sessionData := initialUpstreamOIDCRefreshTokenCustomSessionData()
+		sessionData.OIDC.UpstreamRefreshToken = newRefreshToken
+		return sessionData
+	}
+
+	withCertificateThumbprint := func(sessionData *psession.CustomSessionData, certificate *x509.Certificate) *psession.CustomSessionData {
+		sessionData.CertificateThumbprint = certbinding.Thumbprint(certificate)
+		return sessionData
+	}
+
+	dpopKey := generateDPoPKey(t)
+	withDPoPKeyThumbprint := func(sessionData *psession.CustomSessionData) *psession.CustomSessionData {
+		sessionData.DPoPKeyThumbprint = dpopKeyThumbprint(t, dpopKey)
+		return sessionData
+	}
+
+	happyOIDCUpstreamRefreshCall := func() *expectedUpstreamRefresh {
+		return &expectedUpstreamRefresh{
+			performedByUpstreamName: oidcUpstreamName,
+			args: &oidctestutil.PerformRefreshArgs{
+				Ctx:          nil, // this will be filled in with the actual request context by the test below
+				RefreshToken: oidcUpstreamInitialRefreshToken,
+			},
+		}
+	}
+
+	happyLDAPUpstreamRefreshCall := func() *expectedUpstreamRefresh {
+		return &expectedUpstreamRefresh{
+			performedByUpstreamName: ldapUpstreamName,
+			args: &oidctestutil.PerformRefreshArgs{
+				Ctx:              nil,
+				DN:               ldapUpstreamDN,
+				ExpectedSubject:  goodSubject,
+				ExpectedUsername: goodUsername,
+			},
 		}
 	}
 
@@ -986,6 +1677,40 @@ func TestRefreshGrant(t *testing.T) {
 		}
 	}
 
+	happyWebhookUpstreamRefreshCall := func() *expectedUpstreamRefresh {
+		return &expectedUpstreamRefresh{
+			performedByUpstreamName: webhookUpstreamName,
+			args: &oidctestutil.PerformRefreshArgs{
+				Ctx:              nil,
+				UID:              webhookUpstreamUserUID,
+				ExpectedSubject:  goodSubject,
+				ExpectedUsername: goodUsername,
+			},
+		}
+	}
+
+	happyLocalUpstreamRefreshCall := func() *expectedUpstreamRefresh {
+		return &expectedUpstreamRefresh{
+			performedByUpstreamName: localUpstreamName,
+			args: &oidctestutil.PerformRefreshArgs{
+				Ctx:              nil,
+				UID:              localUpstreamUserUID,
+				ExpectedSubject:  goodSubject,
+				ExpectedUsername: goodUsername,
+			},
+		}
+	}
+
+	happyGitHubUpstreamGetUserCall := func() *expectedUpstreamGetUser {
+		return &expectedUpstreamGetUser{
+			performedByUpstreamName: gitHubUpstreamName,
+			args: &oidctestutil.GetUserArgs{
+				Ctx:         nil,
+				AccessToken: gitHubUpstreamAccessToken,
+			},
+		}
+	}
+
 	happyUpstreamValidateTokenCall := func(expectedTokens *oauth2.Token, requireIDToken bool) *expectedUpstreamValidateTokens {
 		return &expectedUpstreamValidateTokens{
 			performedByUpstreamName: oidcUpstreamName,
@@ -1035,6 +1760,24 @@ func TestRefreshGrant(t *testing.T) {
 		return want
 	}
 
+	happyRefreshTokenResponseForWebhook := func(wantCustomSessionDataStored *psession.CustomSessionData) tokenEndpointResponseExpectedValues {
+		want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(wantCustomSessionDataStored)
+		want.wantUpstreamRefreshCall = happyWebhookUpstreamRefreshCall()
+		return want
+	}
+
+	happyRefreshTokenResponseForLocal := func(wantCustomSessionDataStored *psession.CustomSessionData) tokenEndpointResponseExpectedValues {
+		want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(wantCustomSessionDataStored)
+		want.wantUpstreamRefreshCall = happyLocalUpstreamRefreshCall()
+		return want
+	}
+
+	happyRefreshTokenResponseForGitHub := func(wantCustomSessionDataStored *psession.CustomSessionData) tokenEndpointResponseExpectedValues {
+		want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(wantCustomSessionDataStored)
+		want.wantUpstreamGetUserCall = happyGitHubUpstreamGetUserCall()
+		return want
+	}
+
 	refreshedUpstreamTokensWithRefreshTokenWithoutIDToken := func() *oauth2.Token {
 		return &oauth2.Token{
 			AccessToken:  "fake-refreshed-access-token",
@@ -1071,35 +1814,260 @@ func TestRefreshGrant(t *testing.T) {
 			UserDN: ldapUpstreamDN,
 		},
 	}
-	tests := []struct {
-		name                      string
-		idps                      *oidctestutil.UpstreamIDPListerBuilder
-		authcodeExchange          authcodeExchangeInputs
-		refreshRequest            refreshRequestInputs
-		modifyRefreshTokenStorage func(t *testing.T, oauthStore *oidc.KubeStorage, refreshToken string)
-	}{
-		{
-			name: "happy path refresh grant with openid scope granted (id token returned)",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
-				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
-					IDToken: &oidctypes.IDToken{
-						Claims: map[string]interface{}{
-							"sub": goodUpstreamSubject,
-						},
-					},
-				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
-			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
-				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
-			},
-			refreshRequest: refreshRequestInputs{
-				want: happyRefreshTokenResponseForOpenIDAndOfflineAccess(
-					upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
+	happyWebhookCustomSessionData := &psession.CustomSessionData{
+		ProviderUID:  webhookUpstreamResourceUID,
+		ProviderName: webhookUpstreamName,
+		ProviderType: webhookUpstreamType,
+		Webhook: &psession.WebhookSessionData{
+			UserUID: webhookUpstreamUserUID,
+		},
+	}
+	happyLocalCustomSessionData := &psession.CustomSessionData{
+		ProviderUID:  localUpstreamResourceUID,
+		ProviderName: localUpstreamName,
+		ProviderType: localUpstreamType,
+		Local: &psession.LocalSessionData{
+			UserUID: localUpstreamUserUID,
+		},
+	}
+	happyGitHubCustomSessionData := &psession.CustomSessionData{
+		ProviderUID:  gitHubUpstreamResourceUID,
+		ProviderName: gitHubUpstreamName,
+		ProviderType: gitHubUpstreamType,
+		GitHub: &psession.GitHubSessionData{
+			UpstreamAccessToken: gitHubUpstreamAccessToken,
+		},
+	}
+	samlCustomSessionData := func(sessionNotOnOrAfter time.Time) *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			ProviderUID:  samlUpstreamResourceUID,
+			ProviderName: samlUpstreamName,
+			ProviderType: samlUpstreamType,
+			SAML: &psession.SAMLSessionData{
+				SessionNotOnOrAfter: sessionNotOnOrAfter,
+			},
+		}
+	}
+	oauth2CustomSessionData := func(refreshToken, accessToken string) *psession.CustomSessionData {
+		return &psession.CustomSessionData{
+			ProviderUID:  oauth2UpstreamResourceUID,
+			ProviderName: oauth2UpstreamName,
+			ProviderType: oauth2UpstreamType,
+			OAuth2: &psession.OAuth2SessionData{
+				UpstreamRefreshToken: refreshToken,
+				UpstreamAccessToken:  accessToken,
+			},
+		}
+	}
+	upstreamOAuth2IdentityProvider := func(
+		performRefreshFunc func(ctx context.Context, refreshToken string) (*oauth2.Token, error),
+		getUserFunc func(ctx context.Context, accessToken string) (*provider.OAuth2User, error),
+	) *oidctestutil.TestUpstreamOAuth2IdentityProvider {
+		return &oidctestutil.TestUpstreamOAuth2IdentityProvider{
+			Name:               oauth2UpstreamName,
+			ResourceUID:        oauth2UpstreamResourceUID,
+			PerformRefreshFunc: performRefreshFunc,
+			GetUserFunc:        getUserFunc,
+		}
+	}
+	happyOAuth2PerformRefresh := func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+		return &oauth2.Token{AccessToken: oauth2UpstreamRefreshedAccessToken, RefreshToken: oauth2UpstreamRefreshedRefreshToken}, nil
+	}
+	happyOAuth2GetUser := func(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+		return &provider.OAuth2User{Username: goodUsername, Groups: goodGroups, DownstreamSubject: goodSubject}, nil
+	}
+	oauth2UpstreamRefreshCall := func() *expectedUpstreamRefresh {
+		return &expectedUpstreamRefresh{
+			performedByUpstreamName: oauth2UpstreamName,
+			args: &oidctestutil.PerformRefreshArgs{
+				Ctx:          nil,
+				RefreshToken: oauth2UpstreamInitialRefreshToken,
+			},
+		}
+	}
+	oauth2UpstreamGetUserCall := func(accessToken string) *expectedUpstreamGetUser {
+		return &expectedUpstreamGetUser{
+			performedByUpstreamName: oauth2UpstreamName,
+			args: &oidctestutil.GetUserArgs{
+				Ctx:         nil,
+				AccessToken: accessToken,
+			},
+		}
+	}
+	upstreamGitHubIdentityProvider := func(getUserFunc func(ctx context.Context, accessToken string) (*provider.GitHubUser, error)) *oidctestutil.TestUpstreamGitHubIdentityProvider {
+		return &oidctestutil.TestUpstreamGitHubIdentityProvider{
+			Name:        gitHubUpstreamName,
+			ResourceUID: gitHubUpstreamResourceUID,
+			GetUserFunc: getUserFunc,
+		}
+	}
+	tests := []struct {
+		name                      string
+		idps                      *oidctestutil.UpstreamIDPListerBuilder
+		authcodeExchange          authcodeExchangeInputs
+		refreshRequest            refreshRequestInputs
+		modifyRefreshTokenStorage func(t *testing.T, oauthStore *oidc.KubeStorage, refreshToken string)
+	}{
+		{
+			name: "happy path refresh grant with openid scope granted (id token returned)",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"sub": goodUpstreamSubject,
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyRefreshTokenResponseForOpenIDAndOfflineAccess(
+					upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken),
 					refreshedUpstreamTokensWithIDAndRefreshTokens(),
 				),
 			},
 		},
+		{
+			name: "refresh grant with the client certificate to which the tokens are bound",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"sub": goodUpstreamSubject,
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData:  initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				certificateBinding: certbinding.Optional,
+				modifyAuthRequest:  func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				modifyTokenRequest: func(r *http.Request, authCode string) { presentClientCertificate(r, goodClientCertificate) },
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					withCertificateThumbprint(initialUpstreamOIDCRefreshTokenCustomSessionData(), goodClientCertificate),
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				modifyTokenRequest: func(r *http.Request, refreshToken string, accessToken string) {
+					presentClientCertificate(r, goodClientCertificate)
+				},
+				want: happyRefreshTokenResponseForOpenIDAndOfflineAccess(
+					withCertificateThumbprint(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken), goodClientCertificate),
+					refreshedUpstreamTokensWithIDAndRefreshTokens(),
+				),
+			},
+		},
+		{
+			name: "refresh grant with a different client certificate than the one to which the tokens are bound",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData:  initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				certificateBinding: certbinding.Optional,
+				modifyAuthRequest:  func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				modifyTokenRequest: func(r *http.Request, authCode string) { presentClientCertificate(r, goodClientCertificate) },
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					withCertificateThumbprint(initialUpstreamOIDCRefreshTokenCustomSessionData(), goodClientCertificate),
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				modifyTokenRequest: func(r *http.Request, refreshToken string, accessToken string) {
+					presentClientCertificate(r, otherClientCertificate)
+				},
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusBadRequest,
+					wantErrorResponseBody: fositeRefreshTokenBoundToDifferentClientCertificateErrorBody,
+				},
+			},
+		},
+		{
+			name: "refresh grant without the client certificate to which the tokens are bound",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData:  initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				certificateBinding: certbinding.Optional,
+				modifyAuthRequest:  func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				modifyTokenRequest: func(r *http.Request, authCode string) { presentClientCertificate(r, goodClientCertificate) },
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					withCertificateThumbprint(initialUpstreamOIDCRefreshTokenCustomSessionData(), goodClientCertificate),
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusBadRequest,
+					wantErrorResponseBody: fositeRefreshTokenBoundToDifferentClientCertificateErrorBody,
+				},
+			},
+		},
+		{
+			name: "refresh grant with a proof of possession of the DPoP key to which the tokens are bound",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"sub": goodUpstreamSubject,
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				modifyTokenRequest: func(r *http.Request, authCode string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+				},
+				want: func() tokenEndpointResponseExpectedValues {
+					want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+						withDPoPKeyThumbprint(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+					)
+					want.wantConfirmation = map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)}
+					return want
+				}(),
+			},
+			refreshRequest: refreshRequestInputs{
+				modifyTokenRequest: func(r *http.Request, refreshToken string, accessToken string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+				},
+				want: func() tokenEndpointResponseExpectedValues {
+					want := happyRefreshTokenResponseForOpenIDAndOfflineAccess(
+						withDPoPKeyThumbprint(upstreamOIDCCustomSessionDataWithNewRefreshToken(oidcUpstreamRefreshedRefreshToken)),
+						refreshedUpstreamTokensWithIDAndRefreshTokens(),
+					)
+					want.wantConfirmation = map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)}
+					return want
+				}(),
+			},
+		},
+		{
+			name: "refresh grant without a proof of possession of the DPoP key to which the tokens are bound",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				modifyTokenRequest: func(r *http.Request, authCode string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, dpopKey, goodIssuer+oidc.TokenEndpointPath, time.Now()))
+				},
+				want: func() tokenEndpointResponseExpectedValues {
+					want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+						withDPoPKeyThumbprint(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+					)
+					want.wantConfirmation = map[string]interface{}{"jkt": dpopKeyThumbprint(t, dpopKey)}
+					return want
+				}(),
+			},
+			refreshRequest: refreshRequestInputs{
+				modifyTokenRequest: func(r *http.Request, refreshToken string, accessToken string) {
+					r.Header.Set("DPoP", makeDPoPProof(t, generateDPoPKey(t), goodIssuer+oidc.TokenEndpointPath, time.Now()))
+				},
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus:            http.StatusBadRequest,
+					wantErrorResponseBody: fositeRefreshTokenBoundToDifferentDPoPKeyErrorBody,
+				},
+			},
+		},
 		{
 			name: "refresh grant with unchanged username claim",
 			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
@@ -1804,61 +2772,368 @@ func TestRefreshGrant(t *testing.T) {
 				),
 			},
 			refreshRequest: refreshRequestInputs{
-				want: tokenEndpointResponseExpectedValues{
-					wantStatus: http.StatusUnauthorized,
-					wantErrorResponseBody: here.Doc(`
-						{
-							"error":             "error",
-							"error_description": "Error during upstream refresh. Provider from upstream session data was not found."
-						}
-					`),
-				},
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Provider from upstream session data was not found."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "when the provider in the session storage is found but has the wrong resource UID during the refresh request",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: &psession.CustomSessionData{
+					ProviderName: oidcUpstreamName,
+					ProviderUID:  "this is the wrong uid", // this could happen if the OIDCIdentityProvider was deleted and recreated at the same name since original login
+					ProviderType: oidcUpstreamType,
+					OIDC:         &psession.OIDCSessionData{UpstreamRefreshToken: oidcUpstreamInitialRefreshToken},
+				},
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					&psession.CustomSessionData{ // want the initial customSessionData to be unmodified
+						ProviderName: oidcUpstreamName,
+						ProviderUID:  "this is the wrong uid", // this could happen if the OIDCIdentityProvider was deleted and recreated at the same name since original login
+						ProviderType: oidcUpstreamType,
+						OIDC:         &psession.OIDCSessionData{UpstreamRefreshToken: oidcUpstreamInitialRefreshToken},
+					},
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Provider from upstream session data has changed its resource UID since authentication."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "when the upstream refresh fails during the refresh request",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().
+				WithPerformRefreshError(errors.New("some upstream refresh error")).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall: happyOIDCUpstreamRefreshCall(),
+					wantStatus:              http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "when the upstream refresh returns an invalid ID token during the refresh request",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().
+				WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).
+				// This is the current format of the errors returned by the production code version of ValidateTokenAndMergeWithUserInfo, see ValidateTokenAndMergeWithUserInfo in upstreamoidc.go
+				WithValidateTokenAndMergeWithUserInfoError(httperr.Wrap(http.StatusBadRequest, "some validate error", errors.New("some validate cause"))).
+				Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
+					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
+					wantStatus:                        http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh returned an invalid ID token or UserInfo response."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "when the upstream refresh returns an ID token with a different subject than the original",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().
+				WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).
+				// This is the current format of the errors returned by the production code version of ValidateTokenAndMergeWithUserInfo, see ValidateTokenAndMergeWithUserInfo in upstreamoidc.go
+				WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"sub": "something-different",
+						},
+					},
+				}).
+				Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
+					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
+					wantStatus:                        http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "refresh grant with claims but not the subject claim",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"some-claim": "some-value",
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
+					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
+					wantStatus:                        http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "refresh grant with changed username claim",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithUsernameClaim("username-claim").WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"some-claim":     "some-value",
+							"sub":            goodUpstreamSubject,
+							"username-claim": "some-changed-username",
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
+					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
+					wantStatus:                        http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "refresh grant with changed issuer claim",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
+				upstreamOIDCIdentityProviderBuilder().WithUsernameClaim("username-claim").WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
+					IDToken: &oidctypes.IDToken{
+						Claims: map[string]interface{}{
+							"some-claim": "some-value",
+							"sub":        goodUpstreamSubject,
+							"iss":        "some-changed-issuer",
+						},
+					},
+				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			authcodeExchange: authcodeExchangeInputs{
+				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
+					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
+					wantStatus:                        http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
+			},
+		},
+		{
+			name: "upstream ldap refresh happy path",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 ldapUpstreamName,
+				ResourceUID:          ldapUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: goodGroups,
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: happyLDAPCustomSessionData,
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					happyLDAPCustomSessionData,
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyRefreshTokenResponseForLDAP(
+					happyLDAPCustomSessionData,
+				),
+			},
+		},
+		{
+			name: "upstream active directory refresh happy path",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 activeDirectoryUpstreamName,
+				ResourceUID:          activeDirectoryUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: goodGroups,
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: happyActiveDirectoryCustomSessionData,
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					happyActiveDirectoryCustomSessionData,
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyRefreshTokenResponseForActiveDirectory(
+					happyActiveDirectoryCustomSessionData,
+				),
+			},
+		},
+		{
+			name: "upstream webhook refresh happy path",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithWebhook(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 webhookUpstreamName,
+				ResourceUID:          webhookUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: goodGroups,
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: happyWebhookCustomSessionData,
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					happyWebhookCustomSessionData,
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyRefreshTokenResponseForWebhook(
+					happyWebhookCustomSessionData,
+				),
+			},
+		},
+		{
+			name: "upstream local refresh happy path",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLocal(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:                 localUpstreamName,
+				ResourceUID:          localUpstreamResourceUID,
+				URL:                  ldapUpstreamURL,
+				PerformRefreshGroups: goodGroups,
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: happyLocalCustomSessionData,
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					happyLocalCustomSessionData,
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyRefreshTokenResponseForLocal(
+					happyLocalCustomSessionData,
+				),
+			},
+		},
+		{
+			name: "upstream github refresh happy path",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(
+				upstreamGitHubIdentityProvider(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return &provider.GitHubUser{Username: goodUsername, Groups: goodGroups, DownstreamSubject: goodSubject}, nil
+				}),
+			),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: happyGitHubCustomSessionData,
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					happyGitHubCustomSessionData,
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyRefreshTokenResponseForGitHub(
+					happyGitHubCustomSessionData,
+				),
 			},
 		},
 		{
-			name: "when the provider in the session storage is found but has the wrong resource UID during the refresh request",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().Build()),
+			name: "upstream github refresh when the user is no longer a member of any of the allowed organizations",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(
+				upstreamGitHubIdentityProvider(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return nil, upstreamgithub.ErrUserNotAllowed
+				}),
+			),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: &psession.CustomSessionData{
-					ProviderName: oidcUpstreamName,
-					ProviderUID:  "this is the wrong uid", // this could happen if the OIDCIdentityProvider was deleted and recreated at the same name since original login
-					ProviderType: oidcUpstreamType,
-					OIDC:         &psession.OIDCSessionData{UpstreamRefreshToken: oidcUpstreamInitialRefreshToken},
-				},
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: happyGitHubCustomSessionData,
 				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
-					&psession.CustomSessionData{ // want the initial customSessionData to be unmodified
-						ProviderName: oidcUpstreamName,
-						ProviderUID:  "this is the wrong uid", // this could happen if the OIDCIdentityProvider was deleted and recreated at the same name since original login
-						ProviderType: oidcUpstreamType,
-						OIDC:         &psession.OIDCSessionData{UpstreamRefreshToken: oidcUpstreamInitialRefreshToken},
-					},
+					happyGitHubCustomSessionData,
 				),
 			},
 			refreshRequest: refreshRequestInputs{
 				want: tokenEndpointResponseExpectedValues{
-					wantStatus: http.StatusUnauthorized,
+					wantUpstreamGetUserCall: happyGitHubUpstreamGetUserCall(),
+					wantStatus:              http.StatusUnauthorized,
 					wantErrorResponseBody: here.Doc(`
 						{
 							"error":             "error",
-							"error_description": "Error during upstream refresh. Provider from upstream session data has changed its resource UID since authentication."
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
 						}
 					`),
 				},
 			},
 		},
 		{
-			name: "when the upstream refresh fails during the refresh request",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().
-				WithPerformRefreshError(errors.New("some upstream refresh error")).Build()),
+			name: "upstream github refresh when the user has a different username than before",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(
+				upstreamGitHubIdentityProvider(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return &provider.GitHubUser{Username: "some-other-username", Groups: goodGroups, DownstreamSubject: goodSubject}, nil
+				}),
+			),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+				customSessionData: happyGitHubCustomSessionData,
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					happyGitHubCustomSessionData,
+				),
 			},
 			refreshRequest: refreshRequestInputs{
 				want: tokenEndpointResponseExpectedValues{
-					wantUpstreamRefreshCall: happyOIDCUpstreamRefreshCall(),
+					wantUpstreamGetUserCall: happyGitHubUpstreamGetUserCall(),
 					wantStatus:              http.StatusUnauthorized,
 					wantErrorResponseBody: here.Doc(`
 						{
@@ -1870,145 +3145,203 @@ func TestRefreshGrant(t *testing.T) {
 			},
 		},
 		{
-			name: "when the upstream refresh returns an invalid ID token during the refresh request",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().
-				WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).
-				// This is the current format of the errors returned by the production code version of ValidateTokenAndMergeWithUserInfo, see ValidateTokenAndMergeWithUserInfo in upstreamoidc.go
-				WithValidateTokenAndMergeWithUserInfoError(httperr.Wrap(http.StatusBadRequest, "some validate error", errors.New("some validate cause"))).
-				Build()),
+			name: "upstream github refresh when the github session data is nil",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithGitHub(
+				upstreamGitHubIdentityProvider(func(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+					return nil, errors.New("should not have looked up the user")
+				}),
+			),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+				customSessionData: &psession.CustomSessionData{
+					ProviderUID:  gitHubUpstreamResourceUID,
+					ProviderName: gitHubUpstreamName,
+					ProviderType: gitHubUpstreamType,
+					GitHub:       nil,
+				},
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					&psession.CustomSessionData{
+						ProviderUID:  gitHubUpstreamResourceUID,
+						ProviderName: gitHubUpstreamName,
+						ProviderType: gitHubUpstreamType,
+						GitHub:       nil,
+					},
+				),
 			},
 			refreshRequest: refreshRequestInputs{
 				want: tokenEndpointResponseExpectedValues{
-					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
-					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantStatus:                        http.StatusUnauthorized,
+					wantStatus: http.StatusInternalServerError,
 					wantErrorResponseBody: here.Doc(`
 						{
 							"error":             "error",
-							"error_description": "Error during upstream refresh. Upstream refresh returned an invalid ID token or UserInfo response."
+							"error_description": "There was an internal server error. Required upstream data not found in session."
 						}
 					`),
 				},
 			},
 		},
 		{
-			name: "when the upstream refresh returns an ID token with a different subject than the original",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(upstreamOIDCIdentityProviderBuilder().
-				WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).
-				// This is the current format of the errors returned by the production code version of ValidateTokenAndMergeWithUserInfo, see ValidateTokenAndMergeWithUserInfo in upstreamoidc.go
-				WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
-					IDToken: &oidctypes.IDToken{
-						Claims: map[string]interface{}{
-							"sub": "something-different",
-						},
-					},
-				}).
-				Build()),
+			name: "upstream saml refresh before the end of the upstream session",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:        samlUpstreamName,
+				ResourceUID: samlUpstreamResourceUID,
+			}),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+				customSessionData: samlCustomSessionData(time.Date(2050, 1, 1, 1, 1, 1, 0, time.UTC)),
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					samlCustomSessionData(time.Date(2050, 1, 1, 1, 1, 1, 0, time.UTC)),
+				),
 			},
 			refreshRequest: refreshRequestInputs{
-				want: tokenEndpointResponseExpectedValues{
-					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
-					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantStatus:                        http.StatusUnauthorized,
-					wantErrorResponseBody: here.Doc(`
-						{
-							"error":             "error",
-							"error_description": "Error during upstream refresh. Upstream refresh failed."
-						}
-					`),
-				},
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					samlCustomSessionData(time.Date(2050, 1, 1, 1, 1, 1, 0, time.UTC)),
+				),
 			},
 		},
 		{
-			name: "refresh grant with claims but not the subject claim",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
-				upstreamOIDCIdentityProviderBuilder().WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
-					IDToken: &oidctypes.IDToken{
-						Claims: map[string]interface{}{
-							"some-claim": "some-value",
-						},
-					},
-				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			name: "upstream saml refresh when the upstream did not say when its session ends",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:        samlUpstreamName,
+				ResourceUID: samlUpstreamResourceUID,
+			}),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+				customSessionData: samlCustomSessionData(time.Time{}),
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					samlCustomSessionData(time.Time{}),
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					samlCustomSessionData(time.Time{}),
+				),
+			},
+		},
+		{
+			name: "upstream saml refresh after the end of the upstream session",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:        samlUpstreamName,
+				ResourceUID: samlUpstreamResourceUID,
+			}),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: samlCustomSessionData(time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)),
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					samlCustomSessionData(time.Date(2000, 1, 1, 1, 1, 1, 0, time.UTC)),
+				),
 			},
 			refreshRequest: refreshRequestInputs{
 				want: tokenEndpointResponseExpectedValues{
-					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
-					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantStatus:                        http.StatusUnauthorized,
+					wantStatus: http.StatusUnauthorized,
 					wantErrorResponseBody: here.Doc(`
 						{
 							"error":             "error",
-							"error_description": "Error during upstream refresh. Upstream refresh failed."
+							"error_description": "Error during upstream refresh. Upstream session has expired."
 						}
 					`),
 				},
 			},
 		},
 		{
-			name: "refresh grant with changed username claim",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
-				upstreamOIDCIdentityProviderBuilder().WithUsernameClaim("username-claim").WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
-					IDToken: &oidctypes.IDToken{
-						Claims: map[string]interface{}{
-							"some-claim":     "some-value",
-							"sub":            goodUpstreamSubject,
-							"username-claim": "some-changed-username",
-						},
-					},
-				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			name: "upstream saml refresh when the saml session data is nil",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithSAML(&oidctestutil.TestUpstreamSAMLIdentityProvider{
+				Name:        samlUpstreamName,
+				ResourceUID: samlUpstreamResourceUID,
+			}),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+				customSessionData: &psession.CustomSessionData{
+					ProviderUID:  samlUpstreamResourceUID,
+					ProviderName: samlUpstreamName,
+					ProviderType: samlUpstreamType,
+					SAML:         nil,
+				},
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					&psession.CustomSessionData{
+						ProviderUID:  samlUpstreamResourceUID,
+						ProviderName: samlUpstreamName,
+						ProviderType: samlUpstreamType,
+						SAML:         nil,
+					},
+				),
 			},
 			refreshRequest: refreshRequestInputs{
 				want: tokenEndpointResponseExpectedValues{
-					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
-					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantStatus:                        http.StatusUnauthorized,
+					wantStatus: http.StatusInternalServerError,
 					wantErrorResponseBody: here.Doc(`
 						{
 							"error":             "error",
-							"error_description": "Error during upstream refresh. Upstream refresh failed."
+							"error_description": "There was an internal server error. Required upstream data not found in session."
 						}
 					`),
 				},
 			},
 		},
 		{
-			name: "refresh grant with changed issuer claim",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOIDC(
-				upstreamOIDCIdentityProviderBuilder().WithUsernameClaim("username-claim").WithValidatedAndMergedWithUserInfoTokens(&oidctypes.Token{
-					IDToken: &oidctypes.IDToken{
-						Claims: map[string]interface{}{
-							"some-claim": "some-value",
-							"sub":        goodUpstreamSubject,
-							"iss":        "some-changed-issuer",
-						},
-					},
-				}).WithRefreshedTokens(refreshedUpstreamTokensWithIDAndRefreshTokens()).Build()),
+			name: "upstream oauth2 refresh happy path using the upstream refresh token",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(
+				upstreamOAuth2IdentityProvider(happyOAuth2PerformRefresh, happyOAuth2GetUser),
+			),
 			authcodeExchange: authcodeExchangeInputs{
-				customSessionData: initialUpstreamOIDCRefreshTokenCustomSessionData(),
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				want:              happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(initialUpstreamOIDCRefreshTokenCustomSessionData()),
+				customSessionData: oauth2CustomSessionData(oauth2UpstreamInitialRefreshToken, ""),
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					oauth2CustomSessionData(oauth2UpstreamInitialRefreshToken, ""),
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: func() tokenEndpointResponseExpectedValues {
+					// The upstream rotated its refresh token, so the new one is stored.
+					want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+						oauth2CustomSessionData(oauth2UpstreamRefreshedRefreshToken, ""),
+					)
+					want.wantUpstreamRefreshCall = oauth2UpstreamRefreshCall()
+					want.wantUpstreamGetUserCall = oauth2UpstreamGetUserCall(oauth2UpstreamRefreshedAccessToken)
+					return want
+				}(),
+			},
+		},
+		{
+			name: "upstream oauth2 refresh happy path using the upstream access token when there is no upstream refresh token",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(
+				upstreamOAuth2IdentityProvider(happyOAuth2PerformRefresh, happyOAuth2GetUser),
+			),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: oauth2CustomSessionData("", oauth2UpstreamAccessToken),
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					oauth2CustomSessionData("", oauth2UpstreamAccessToken),
+				),
+			},
+			refreshRequest: refreshRequestInputs{
+				want: func() tokenEndpointResponseExpectedValues {
+					want := happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+						oauth2CustomSessionData("", oauth2UpstreamAccessToken),
+					)
+					want.wantUpstreamGetUserCall = oauth2UpstreamGetUserCall(oauth2UpstreamAccessToken)
+					return want
+				}(),
+			},
+		},
+		{
+			name: "upstream oauth2 refresh when the upstream refresh fails",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(
+				upstreamOAuth2IdentityProvider(func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+					return nil, errors.New("some upstream refresh error")
+				}, happyOAuth2GetUser),
+			),
+			authcodeExchange: authcodeExchangeInputs{
+				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
+				customSessionData: oauth2CustomSessionData(oauth2UpstreamInitialRefreshToken, ""),
+				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
+					oauth2CustomSessionData(oauth2UpstreamInitialRefreshToken, ""),
+				),
 			},
 			refreshRequest: refreshRequestInputs{
 				want: tokenEndpointResponseExpectedValues{
-					wantUpstreamRefreshCall:           happyOIDCUpstreamRefreshCall(),
-					wantUpstreamOIDCValidateTokenCall: happyUpstreamValidateTokenCall(refreshedUpstreamTokensWithIDAndRefreshTokens(), true),
-					wantStatus:                        http.StatusUnauthorized,
+					wantUpstreamRefreshCall: oauth2UpstreamRefreshCall(),
+					wantStatus:              http.StatusUnauthorized,
 					wantErrorResponseBody: here.Doc(`
 						{
 							"error":             "error",
@@ -2019,45 +3352,67 @@ func TestRefreshGrant(t *testing.T) {
 			},
 		},
 		{
-			name: "upstream ldap refresh happy path",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithLDAP(&oidctestutil.TestUpstreamLDAPIdentityProvider{
-				Name:                 ldapUpstreamName,
-				ResourceUID:          ldapUpstreamResourceUID,
-				URL:                  ldapUpstreamURL,
-				PerformRefreshGroups: goodGroups,
-			}),
+			name: "upstream oauth2 refresh when the profile of the user has a different subject than before",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithOAuth2(
+				upstreamOAuth2IdentityProvider(happyOAuth2PerformRefresh, func(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+					return &provider.OAuth2User{Username: goodUsername, Groups: goodGroups, DownstreamSubject: "some-other-subject"}, nil
+				}),
+			),
 			authcodeExchange: authcodeExchangeInputs{
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				customSessionData: happyLDAPCustomSessionData,
+				customSessionData: oauth2CustomSessionData(oauth2UpstreamInitialRefreshToken, ""),
 				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
-					happyLDAPCustomSessionData,
+					oauth2CustomSessionData(oauth2UpstreamInitialRefreshToken, ""),
 				),
 			},
 			refreshRequest: refreshRequestInputs{
-				want: happyRefreshTokenResponseForLDAP(
-					happyLDAPCustomSessionData,
-				),
+				want: tokenEndpointResponseExpectedValues{
+					wantUpstreamRefreshCall: oauth2UpstreamRefreshCall(),
+					wantUpstreamGetUserCall: oauth2UpstreamGetUserCall(oauth2UpstreamRefreshedAccessToken),
+					wantStatus:              http.StatusUnauthorized,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "Error during upstream refresh. Upstream refresh failed."
+						}
+					`),
+				},
 			},
 		},
 		{
-			name: "upstream active directory refresh happy path",
-			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithActiveDirectory(&oidctestutil.TestUpstreamLDAPIdentityProvider{
-				Name:                 activeDirectoryUpstreamName,
-				ResourceUID:          activeDirectoryUpstreamResourceUID,
-				URL:                  ldapUpstreamURL,
-				PerformRefreshGroups: goodGroups,
+			name: "upstream webhook refresh when the webhook session data is nil",
+			idps: oidctestutil.NewUpstreamIDPListerBuilder().WithWebhook(&oidctestutil.TestUpstreamLDAPIdentityProvider{
+				Name:        webhookUpstreamName,
+				ResourceUID: webhookUpstreamResourceUID,
+				URL:         ldapUpstreamURL,
 			}),
 			authcodeExchange: authcodeExchangeInputs{
 				modifyAuthRequest: func(r *http.Request) { r.Form.Set("scope", "openid offline_access") },
-				customSessionData: happyActiveDirectoryCustomSessionData,
+				customSessionData: &psession.CustomSessionData{
+					ProviderUID:  webhookUpstreamResourceUID,
+					ProviderName: webhookUpstreamName,
+					ProviderType: webhookUpstreamType,
+					Webhook:      nil,
+				},
 				want: happyAuthcodeExchangeTokenResponseForOpenIDAndOfflineAccess(
-					happyActiveDirectoryCustomSessionData,
+					&psession.CustomSessionData{
+						ProviderUID:  webhookUpstreamResourceUID,
+						ProviderName: webhookUpstreamName,
+						ProviderType: webhookUpstreamType,
+						Webhook:      nil,
+					},
 				),
 			},
 			refreshRequest: refreshRequestInputs{
-				want: happyRefreshTokenResponseForActiveDirectory(
-					happyActiveDirectoryCustomSessionData,
-				),
+				want: tokenEndpointResponseExpectedValues{
+					wantStatus: http.StatusInternalServerError,
+					wantErrorResponseBody: here.Doc(`
+						{
+							"error":             "error",
+							"error_description": "There was an internal server error. Required upstream data not found in session."
+						}
+					`),
+				},
 			},
 		},
 		{
@@ -2807,6 +4162,17 @@ func TestRefreshGrant(t *testing.T) {
 				test.idps.RequireExactlyZeroCallsToValidateToken(t)
 			}
 
+			// Test that we did or did not look up the user again using an upstream GitHub or OAuth2 access token.
+			if test.refreshRequest.want.wantUpstreamGetUserCall != nil {
+				test.refreshRequest.want.wantUpstreamGetUserCall.args.Ctx = reqContext
+				test.idps.RequireExactlyOneCallToGetUser(t,
+					test.refreshRequest.want.wantUpstreamGetUserCall.performedByUpstreamName,
+					test.refreshRequest.want.wantUpstreamGetUserCall.args,
+				)
+			} else {
+				test.idps.RequireExactlyZeroCallsToGetUser(t)
+			}
+
 			// The bug in fosite that prevents at_hash from appearing in the initial ID token does not impact the refreshed ID token
 			wantAtHashClaimInIDToken := true
 			// Refreshed ID tokens do not include the nonce from the original auth request
@@ -2913,7 +4279,11 @@ func exchangeAuthcodeForTokens(t *testing.T, test authcodeExchangeInputs, idps p
 		test.modifyStorage(t, oauthStore, authCode)
 	}
 
-	subject = NewHandler(idps, oauthHelper)
+	certificateBinding := test.certificateBinding
+	if certificateBinding == "" {
+		certificateBinding = certbinding.Disabled
+	}
+	subject = NewHandler(idps, oauthHelper, certificateBinding, goodIssuer+oidc.TokenEndpointPath, test.tokenExchangePolicy, dpop.NewReplayCache())
 
 	authorizeEndpointGrantedOpenIDScope := strings.Contains(authRequest.Form.Get("scope"), "openid")
 	expectedNumberOfIDSessionsStored := 0
@@ -2995,7 +4365,7 @@ func requireTokenEndpointBehavior(
 		expectedNumberOfIDSessionsStored := 0
 		if wantIDToken {
 			expectedNumberOfIDSessionsStored = 1
-			requireValidIDToken(t, parsedResponseBody, jwtSigningKey, wantAtHashClaimInIDToken, wantNonceValueInIDToken, test.wantGroups, parsedResponseBody["access_token"].(string))
+			requireValidIDToken(t, parsedResponseBody, jwtSigningKey, wantAtHashClaimInIDToken, wantNonceValueInIDToken, test.wantGroups, test.wantConfirmation, parsedResponseBody["access_token"].(string))
 		}
 		if wantRefreshToken {
 			requireValidRefreshTokenStorage(t, parsedResponseBody, oauthStore, test.wantRequestedScopes, test.wantGrantedScopes, test.wantGroups, test.wantCustomSessionDataStored, secrets)
@@ -3298,7 +4668,11 @@ func requireValidAccessTokenStorage(
 	require.True(t, ok)
 	tokenTypeString, ok := tokenType.(string)
 	require.Truef(t, ok, "wanted token_type to be a string, but got %T", tokenType)
-	require.Equal(t, "bearer", tokenTypeString)
+	if wantCustomSessionData != nil && wantCustomSessionData.DPoPKeyThumbprint != "" {
+		require.Equal(t, "DPoP", tokenTypeString)
+	} else {
+		require.Equal(t, "bearer", tokenTypeString)
+	}
 
 	expiresIn, ok := body["expires_in"]
 	require.True(t, ok)
@@ -3521,6 +4895,7 @@ func requireValidIDToken(
 	wantAtHashClaimInIDToken bool,
 	wantNonceValueInIDToken bool,
 	wantGroupsInIDToken []string,
+	wantConfirmation map[string]interface{},
 	actualAccessToken string,
 ) {
 	t.Helper()
@@ -3558,6 +4933,9 @@ func requireValidIDToken(
 	if wantNonceValueInIDToken {
 		idTokenFields = append(idTokenFields, "nonce")
 	}
+	if wantConfirmation != nil {
+		idTokenFields = append(idTokenFields, "cnf")
+	}
 
 	// make sure that these are the only fields in the token
 	var m map[string]interface{}
@@ -3590,6 +4968,10 @@ func requireValidIDToken(
 	testutil.RequireTimeInDelta(t, goodRequestedAtTime, requestedAt, timeComparisonFudgeSeconds*time.Second)
 	testutil.RequireTimeInDelta(t, goodAuthTime, authTime, timeComparisonFudgeSeconds*time.Second)
 
+	if wantConfirmation != nil {
+		require.Equal(t, wantConfirmation, m["cnf"])
+	}
+
 	if wantAtHashClaimInIDToken {
 		require.NotEmpty(t, actualAccessToken)
 		require.Equal(t, hashAccessToken(actualAccessToken), claims.AccessTokenHash)
@@ -3606,6 +4988,38 @@ func deepCopyRequestForm(r *http.Request) *http.Request {
 	return &http.Request{Form: copied}
 }
 
+func generateDPoPKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
+
+// makeDPoPProof returns a proof of possession of the key, as a client would send it to the token endpoint.
+func makeDPoPProof(t *testing.T, key *ecdsa.PrivateKey, url string, issuedAt time.Time) string {
+	t.Helper()
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: key},
+		(&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt"),
+	)
+	require.NoError(t, err)
+	proof, err := josejwt.Signed(signer).Claims(map[string]interface{}{
+		"jti": fmt.Sprintf("some-jti-%d", issuedAt.UnixNano()),
+		"htm": http.MethodPost,
+		"htu": url,
+		"iat": issuedAt.Unix(),
+	}).CompactSerialize()
+	require.NoError(t, err)
+	return proof
+}
+
+func dpopKeyThumbprint(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	thumbprint, err := (&jose.JSONWebKey{Key: &key.PublicKey}).Thumbprint(crypto.SHA256)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(thumbprint)
+}
+
 func getMapKeys(m map[string]interface{}) []string {
 	keys := make([]string, 0)
 	for key := range m {
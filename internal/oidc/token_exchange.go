@@ -1,18 +1,29 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 package oidc
 
 import (
 	"context"
+	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/ory/fosite"
 	"github.com/ory/fosite/compose"
 	"github.com/ory/fosite/handler/oauth2"
 	"github.com/ory/fosite/handler/openid"
+	fositejwt "github.com/ory/fosite/token/jwt"
 	"github.com/pkg/errors"
+	josejwt "gopkg.in/square/go-jose.v2/jwt"
+
+	"go.pinniped.dev/internal/oidc/certbinding"
+	"go.pinniped.dev/internal/oidc/dpop"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/oidc/tokenexchange"
+	"go.pinniped.dev/internal/plog"
+	"go.pinniped.dev/internal/psession"
 )
 
 const (
@@ -21,9 +32,40 @@ const (
 	pinnipedTokenExchangeScope = "pinniped:request-audience"                     //nolint: gosec
 )
 
+type contextKey int
+
+const workloadIdentityProvidersKey contextKey = iota
+
 type stsParams struct {
-	subjectAccessToken string
+	subjectToken       string
+	subjectTokenType   string
 	requestedAudience  string
+	requestedTokenType string
+}
+
+// exchangeSubject is the identity of a validated subject_token.
+type exchangeSubject struct {
+	requester fosite.Requester
+
+	// boundCertificateThumbprint identifies the client certificate to which the subject_token is bound, if any.
+	boundCertificateThumbprint string
+
+	// boundDPoPThumbprint identifies the DPoP key to which the minted JWT is bound, if any.
+	boundDPoPThumbprint string
+}
+
+// WithWorkloadIdentityProviders returns a copy of the context which holds the workload identity providers, which
+// the token exchange handler needs to validate JWTs from external issuers.
+func WithWorkloadIdentityProviders(ctx context.Context, lister WorkloadIdentityProvidersLister) context.Context {
+	return context.WithValue(ctx, workloadIdentityProvidersKey, lister)
+}
+
+func workloadIdentityProvidersFromContext(ctx context.Context) []provider.WorkloadIdentityProviderI {
+	lister, _ := ctx.Value(workloadIdentityProvidersKey).(WorkloadIdentityProvidersLister)
+	if lister == nil {
+		return nil
+	}
+	return lister.GetWorkloadIdentityProviders()
 }
 
 func TokenExchangeFactory(config *compose.Config, storage interface{}, strategy interface{}) interface{} {
@@ -61,36 +103,172 @@ func (t *TokenExchangeHandler) PopulateTokenEndpointResponse(ctx context.Context
 		return errors.WithStack(err)
 	}
 
-	// Validate the incoming access token and lookup the information about the original authorize request.
-	originalRequester, err := t.validateAccessToken(ctx, requester, params.subjectAccessToken)
+	// Validate the subject token. An access token was issued by this FederationDomain to a user, while a JWT was
+	// issued to a workload by an external issuer which is trusted by a WorkloadIdentityProvider. Either way, the
+	// request must present the client certificate to which the subject is bound, or any one when the issuer requires it.
+	var subject *exchangeSubject
+	if params.subjectTokenType == tokenTypeJWT {
+		subject, err = t.validateWorkloadJWT(ctx, params.subjectToken)
+	} else {
+		subject, err = t.validateAccessTokenSubject(ctx, requester, params.subjectToken)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	err = checkCertificateBinding(ctx, subject.boundCertificateThumbprint)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ctx = dpop.WithBoundThumbprint(ctx, subject.boundDPoPThumbprint)
+
+	// Require that the client is allowed to request the audience by the token exchange policy of the FederationDomain.
+	clientID := requester.GetClient().GetID()
+	if !tokenexchange.PolicyFromContext(ctx).AllowsAudience(clientID, params.requestedAudience) {
+		return errors.WithStack(errInvalidTarget().WithHintf("client %q may not request the audience %q", clientID, params.requestedAudience))
+	}
+
+	// Use the identity of the subject, along with the requested audience, to mint a new JWT. The JWT does not have
+	// the act claim of RFC 8693 section 4.1, because the only client is the public pinniped-cli client, which cannot
+	// be authenticated as an actor.
+	responseToken, err := t.mintJWT(ctx, subject.requester, params.requestedAudience)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	// Format the response parameters according to RFC8693. Both token types are the same JWT, but an access token
+	// is returned with the token_type which tells the client how to send it.
+	responder.SetAccessToken(responseToken)
+	responder.SetExtra("issued_token_type", params.requestedTokenType)
+	switch {
+	case params.requestedTokenType == tokenTypeJWT:
+		responder.SetTokenType("N_A")
+	case subject.boundDPoPThumbprint != "":
+		responder.SetTokenType(dpop.TokenType)
+	default:
+		responder.SetTokenType("Bearer")
+	}
+	return nil
+}
+
+// validateAccessTokenSubject looks up the original authorize request of an access token which was issued by this
+// FederationDomain.
+func (t *TokenExchangeHandler) validateAccessTokenSubject(ctx context.Context, requester fosite.AccessRequester, accessToken string) (*exchangeSubject, error) {
+	// Validate the incoming access token and lookup the information about the original authorize request.
+	originalRequester, err := t.validateAccessToken(ctx, requester, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
 	// Require that the incoming access token has the pinniped:request-audience and OpenID scopes.
 	if !originalRequester.GetGrantedScopes().Has(pinnipedTokenExchangeScope) {
-		return errors.WithStack(fosite.ErrAccessDenied.WithHintf("missing the %q scope", pinnipedTokenExchangeScope))
+		return nil, fosite.ErrAccessDenied.WithHintf("missing the %q scope", pinnipedTokenExchangeScope)
 	}
 	if !originalRequester.GetGrantedScopes().Has(oidc.ScopeOpenID) {
-		return errors.WithStack(fosite.ErrAccessDenied.WithHintf("missing the %q scope", oidc.ScopeOpenID))
+		return nil, fosite.ErrAccessDenied.WithHintf("missing the %q scope", oidc.ScopeOpenID)
+	}
+
+	// Require the DPoP key to which the incoming access token is bound, if any. The minted JWT is bound to the same
+	// DPoP key. The client certificate to which it is bound, if any, is checked by the caller.
+	subject := exchangeSubject{requester: originalRequester}
+	if session, ok := originalRequester.GetSession().(*psession.PinnipedSession); ok && session.Custom != nil {
+		subject.boundCertificateThumbprint = session.Custom.CertificateThumbprint
+		subject.boundDPoPThumbprint = session.Custom.DPoPKeyThumbprint
+	}
+	if subject.boundDPoPThumbprint != "" && subject.boundDPoPThumbprint != dpop.RequestThumbprint(ctx) {
+		return nil, fosite.ErrRequestUnauthorized.WithHint("subject_token is bound to a DPoP key, which the request did not prove possession of")
 	}
+	return &subject, nil
+}
+
+// checkCertificateBinding checks that the request presented the client certificate to which the subject_token is
+// bound. Tokens which are not bound to a client certificate are only rejected when the issuer requires the binding.
+func checkCertificateBinding(ctx context.Context, boundThumbprint string) error {
+	thumbprint, mode := certbinding.RequestThumbprint(ctx)
+	switch {
+	case mode == certbinding.Disabled:
+		return nil
+	case boundThumbprint == "" && mode == certbinding.Required:
+		return fosite.ErrRequestUnauthorized.WithHint("subject_token is not bound to a client certificate, which is required by this issuer")
+	case boundThumbprint != "" && boundThumbprint != thumbprint:
+		return fosite.ErrRequestUnauthorized.WithHint("subject_token is bound to a different client certificate")
+	default:
+		return nil
+	}
+}
 
-	// Use the original authorize request information, along with the requested audience, to mint a new JWT.
-	responseToken, err := t.mintJWT(ctx, originalRequester, params.requestedAudience)
+// validateWorkloadJWT authenticates a JWT which was issued to a workload using the WorkloadIdentityProviders which
+// trust its issuer, and returns the downstream identity of the first one which accepts it. The external JWT is not
+// bound to a client certificate or a DPoP key, so it is treated as bound to those of the request, if any.
+func (t *TokenExchangeHandler) validateWorkloadJWT(ctx context.Context, token string) (*exchangeSubject, error) {
+	// The issuer is read before the signature is verified only to find the providers which can verify it.
+	parsed, err := josejwt.ParseSigned(token)
 	if err != nil {
-		return errors.WithStack(err)
+		return nil, fosite.ErrRequestUnauthorized.WithWrap(err).WithHint("invalid subject_token")
+	}
+	var unverifiedClaims josejwt.Claims
+	if err := parsed.UnsafeClaimsWithoutVerification(&unverifiedClaims); err != nil {
+		return nil, fosite.ErrRequestUnauthorized.WithWrap(err).WithHint("invalid subject_token")
 	}
 
-	// Format the response parameters according to RFC8693.
-	responder.SetAccessToken(responseToken)
-	responder.SetTokenType("N_A")
-	responder.SetExtra("issued_token_type", tokenTypeJWT)
-	return nil
+	identity, err := authenticateWorkload(ctx, unverifiedClaims.Issuer, token)
+	if err != nil {
+		return nil, fosite.ErrRequestUnauthorized.WithWrap(err).WithHint("invalid subject_token")
+	}
+
+	groups := identity.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	now := time.Now().UTC()
+	session := &psession.PinnipedSession{
+		Fosite: &openid.DefaultSession{
+			Claims: &fositejwt.IDTokenClaims{
+				Subject:     identity.DownstreamSubject,
+				RequestedAt: now,
+				AuthTime:    now,
+				Extra: map[string]interface{}{
+					DownstreamUsernameClaim: identity.Username,
+					DownstreamGroupsClaim:   groups,
+				},
+			},
+		},
+	}
+	workloadRequester := fosite.NewRequest()
+	workloadRequester.SetSession(session)
+
+	requestCertificateThumbprint, _ := certbinding.RequestThumbprint(ctx)
+	return &exchangeSubject{
+		requester:                  workloadRequester,
+		boundCertificateThumbprint: requestCertificateThumbprint,
+		boundDPoPThumbprint:        dpop.RequestThumbprint(ctx),
+	}, nil
+}
+
+// authenticateWorkload tries each WorkloadIdentityProvider of the issuer in turn, so several providers may trust
+// the same issuer with different audiences, conditions, or claim mappings.
+func authenticateWorkload(ctx context.Context, issuer string, token string) (*provider.WorkloadIdentity, error) {
+	err := errors.Errorf("no WorkloadIdentityProvider trusts the issuer %q", issuer)
+	for _, workloadIDP := range workloadIdentityProvidersFromContext(ctx) {
+		if workloadIDP.GetIssuer() != issuer {
+			continue
+		}
+		var identity *provider.WorkloadIdentity
+		identity, err = workloadIDP.AuthenticateToken(ctx, token)
+		if err == nil {
+			plog.Debug("token exchange authenticated a workload",
+				"workloadIdentityProviderName", workloadIDP.GetName(), "username", identity.Username)
+			return identity, nil
+		}
+		plog.Debug("token exchange could not authenticate a workload",
+			"workloadIdentityProviderName", workloadIDP.GetName(), "error", err.Error())
+	}
+	return nil, err
 }
 
 func (t *TokenExchangeHandler) mintJWT(ctx context.Context, requester fosite.Requester, audience string) (string, error) {
 	downscoped := fosite.NewAccessRequest(requester.GetSession())
 	downscoped.Client.(*fosite.DefaultClient).ID = audience
+
 	return t.idTokenStrategy.GenerateIDToken(ctx, downscoped)
 }
 
@@ -102,17 +280,19 @@ func (t *TokenExchangeHandler) validateParams(params url.Values) (*stsParams, er
 	if result.requestedAudience == "" {
 		return nil, fosite.ErrInvalidRequest.WithHint("missing audience parameter")
 	}
-	result.subjectAccessToken = params.Get("subject_token")
-	if result.subjectAccessToken == "" {
+	result.subjectToken = params.Get("subject_token")
+	if result.subjectToken == "" {
 		return nil, fosite.ErrInvalidRequest.WithHint("missing subject_token parameter")
 	}
 
 	// Validate some parameters with hardcoded values we support.
-	if params.Get("subject_token_type") != tokenTypeAccessToken {
-		return nil, fosite.ErrInvalidRequest.WithHintf("unsupported subject_token_type parameter value, must be %q", tokenTypeAccessToken)
+	result.subjectTokenType = params.Get("subject_token_type")
+	if result.subjectTokenType != tokenTypeAccessToken && result.subjectTokenType != tokenTypeJWT {
+		return nil, fosite.ErrInvalidRequest.WithHintf("unsupported subject_token_type parameter value, must be %q or %q", tokenTypeAccessToken, tokenTypeJWT)
 	}
-	if params.Get("requested_token_type") != tokenTypeJWT {
-		return nil, fosite.ErrInvalidRequest.WithHintf("unsupported requested_token_type parameter value, must be %q", tokenTypeJWT)
+	result.requestedTokenType = params.Get("requested_token_type")
+	if result.requestedTokenType != tokenTypeJWT && result.requestedTokenType != tokenTypeAccessToken {
+		return nil, fosite.ErrInvalidRequest.WithHintf("unsupported requested_token_type parameter value, must be %q or %q", tokenTypeJWT, tokenTypeAccessToken)
 	}
 
 	// Validate that none of these unsupported parameters were sent. These are optional and we do not currently support them.
@@ -142,6 +322,15 @@ func (t *TokenExchangeHandler) validateAccessToken(ctx context.Context, requeste
 	return originalRequester, nil
 }
 
+// errInvalidTarget is the error of RFC 8693 section 2.2.2 for an audience which the client may not request.
+func errInvalidTarget() *fosite.RFC6749Error {
+	return &fosite.RFC6749Error{
+		ErrorField:       "invalid_target",
+		DescriptionField: "The requested audience is invalid, unknown, or malformed.",
+		CodeField:        http.StatusBadRequest,
+	}
+}
+
 func (t *TokenExchangeHandler) CanSkipClientAuth(_ fosite.AccessRequester) bool {
 	return false
 }
@@ -0,0 +1,107 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tokenexchange implements the policy which restricts the RFC 8693 token exchanges of clients.
+package tokenexchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type contextKey int
+
+const policyKey contextKey = iota
+
+// ClientPolicy lists the audiences which a client may request.
+type ClientPolicy struct {
+	// ClientID is the ID of the client.
+	ClientID string
+
+	// AllowedAudiences are patterns of the audiences which the client may request. A "*" in a pattern matches any
+	// sequence of characters, including none.
+	AllowedAudiences []string
+}
+
+// Policy restricts which audiences each client may request in a token exchange. A nil Policy allows every
+// client to request any audience.
+type Policy struct {
+	allowedAudiences map[string][]string
+}
+
+// NewPolicy validates the client policies and returns a Policy. Clients which are not listed may not exchange
+// tokens at all.
+func NewPolicy(clients []ClientPolicy) (*Policy, error) {
+	p := Policy{allowedAudiences: make(map[string][]string, len(clients))}
+	for _, client := range clients {
+		if client.ClientID == "" {
+			return nil, errors.New("client ID must not be empty")
+		}
+		if _, ok := p.allowedAudiences[client.ClientID]; ok {
+			return nil, fmt.Errorf("client %q is listed more than once", client.ClientID)
+		}
+		if len(client.AllowedAudiences) == 0 {
+			return nil, fmt.Errorf("client %q must have at least one allowed audience", client.ClientID)
+		}
+		for _, pattern := range client.AllowedAudiences {
+			if pattern == "" {
+				return nil, fmt.Errorf("client %q has an empty allowed audience", client.ClientID)
+			}
+		}
+		p.allowedAudiences[client.ClientID] = client.AllowedAudiences
+	}
+	return &p, nil
+}
+
+// AllowsAudience returns true when the client may request the audience.
+func (p *Policy) AllowsAudience(clientID, audience string) bool {
+	if p == nil {
+		return true
+	}
+	for _, pattern := range p.allowedAudiences[clientID] {
+		if matches(pattern, audience) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true when the pattern matches the whole string. Each "*" in the pattern matches any sequence of
+// characters, including none.
+func matches(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+
+	// The first part must be a prefix and the last part must be a suffix, which must not overlap.
+	first, last := parts[0], parts[len(parts)-1]
+	if len(s) < len(first)+len(last) || !strings.HasPrefix(s, first) || !strings.HasSuffix(s, last) {
+		return false
+	}
+	s = s[len(first) : len(s)-len(last)]
+
+	// The parts in between must appear in order. Matching each one as early as possible leaves the most room for
+	// the rest.
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return true
+}
+
+// WithPolicy returns a copy of the context which holds the token exchange policy.
+func WithPolicy(ctx context.Context, policy *Policy) context.Context {
+	return context.WithValue(ctx, policyKey, policy)
+}
+
+// PolicyFromContext returns the policy which was added to the context by WithPolicy, or nil.
+func PolicyFromContext(ctx context.Context) *Policy {
+	policy, _ := ctx.Value(policyKey).(*Policy)
+	return policy
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package tokenexchange
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		clients []ClientPolicy
+		wantErr string
+	}{
+		{
+			name: "valid",
+			clients: []ClientPolicy{
+				{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*", "other-audience"}},
+				{ClientID: "some-other-client", AllowedAudiences: []string{"*"}},
+			},
+		},
+		{
+			name: "no clients",
+		},
+		{
+			name:    "empty client ID",
+			clients: []ClientPolicy{{AllowedAudiences: []string{"cluster-*"}}},
+			wantErr: "client ID must not be empty",
+		},
+		{
+			name: "duplicate client ID",
+			clients: []ClientPolicy{
+				{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*"}},
+				{ClientID: "pinniped-cli", AllowedAudiences: []string{"other-audience"}},
+			},
+			wantErr: `client "pinniped-cli" is listed more than once`,
+		},
+		{
+			name:    "no allowed audiences",
+			clients: []ClientPolicy{{ClientID: "pinniped-cli"}},
+			wantErr: `client "pinniped-cli" must have at least one allowed audience`,
+		},
+		{
+			name:    "empty allowed audience",
+			clients: []ClientPolicy{{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*", ""}}},
+			wantErr: `client "pinniped-cli" has an empty allowed audience`,
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			policy, err := NewPolicy(test.clients)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				require.Nil(t, policy)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, policy)
+		})
+	}
+}
+
+func TestAllowsAudience(t *testing.T) {
+	policy, err := NewPolicy([]ClientPolicy{
+		{ClientID: "pinniped-cli", AllowedAudiences: []string{"cluster-*", "https://*.example.com/*/api", "exact-audience"}},
+		{ClientID: "some-other-client", AllowedAudiences: []string{"*"}},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		clientID string
+		audience string
+		want     bool
+	}{
+		{name: "nil policy", clientID: "pinniped-cli", audience: "anything", want: true},
+		{name: "prefix pattern", policy: policy, clientID: "pinniped-cli", audience: "cluster-1", want: true},
+		{name: "prefix pattern with empty remainder", policy: policy, clientID: "pinniped-cli", audience: "cluster-", want: true},
+		{name: "prefix pattern without the prefix", policy: policy, clientID: "pinniped-cli", audience: "my-cluster-1", want: false},
+		{name: "exact pattern", policy: policy, clientID: "pinniped-cli", audience: "exact-audience", want: true},
+		{name: "exact pattern with a suffix", policy: policy, clientID: "pinniped-cli", audience: "exact-audience-2", want: false},
+		{name: "several wildcards", policy: policy, clientID: "pinniped-cli", audience: "https://a.b.example.com/v1/api", want: true},
+		{name: "several wildcards without the middle", policy: policy, clientID: "pinniped-cli", audience: "https://a.example.org/v1/api", want: false},
+		{name: "several wildcards with overlapping prefix and suffix", policy: policy, clientID: "pinniped-cli", audience: "https://.example.com/api", want: false},
+		{name: "wildcard only", policy: policy, clientID: "some-other-client", audience: "anything", want: true},
+		{name: "unlisted client", policy: policy, clientID: "unlisted-client", audience: "cluster-1", want: false},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.want, test.policy.AllowsAudience(test.clientID, test.audience))
+		})
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	require.Nil(t, PolicyFromContext(ctx))
+
+	policy, err := NewPolicy(nil)
+	require.NoError(t, err)
+	require.Same(t, policy, PolicyFromContext(WithPolicy(ctx, policy)))
+}
@@ -47,12 +47,35 @@ type CustomSessionData struct {
 	// These will be RFC 2616-formatted errors with error code 299.
 	Warnings []string `json:"warnings"`
 
+	// The base64url-encoded SHA-256 thumbprint of the TLS client certificate to which the tokens of this session are
+	// bound, as described in RFC 8705 section 3. Empty when the tokens are not bound to a client certificate.
+	CertificateThumbprint string `json:"certificateThumbprint,omitempty"`
+
+	// The base64url-encoded RFC 7638 thumbprint of the DPoP key to which the tokens of this session are bound, as
+	// described in RFC 9449. Empty when the tokens are not bound to a DPoP key.
+	DPoPKeyThumbprint string `json:"dpopKeyThumbprint,omitempty"`
+
 	// Only used when ProviderType == "oidc".
 	OIDC *OIDCSessionData `json:"oidc,omitempty"`
 
 	LDAP *LDAPSessionData `json:"ldap,omitempty"`
 
 	ActiveDirectory *ActiveDirectorySessionData `json:"activedirectory,omitempty"`
+
+	// Only used when ProviderType == "github".
+	GitHub *GitHubSessionData `json:"github,omitempty"`
+
+	// Only used when ProviderType == "saml".
+	SAML *SAMLSessionData `json:"saml,omitempty"`
+
+	// Only used when ProviderType == "oauth2".
+	OAuth2 *OAuth2SessionData `json:"oauth2,omitempty"`
+
+	// Only used when ProviderType == "webhook".
+	Webhook *WebhookSessionData `json:"webhook,omitempty"`
+
+	// Only used when ProviderType == "local".
+	Local *LocalSessionData `json:"local,omitempty"`
 }
 
 type ProviderType string
@@ -61,6 +84,11 @@ const (
 	ProviderTypeOIDC            ProviderType = "oidc"
 	ProviderTypeLDAP            ProviderType = "ldap"
 	ProviderTypeActiveDirectory ProviderType = "activedirectory"
+	ProviderTypeGitHub          ProviderType = "github"
+	ProviderTypeSAML            ProviderType = "saml"
+	ProviderTypeOAuth2          ProviderType = "oauth2"
+	ProviderTypeWebhook         ProviderType = "webhook"
+	ProviderTypeLocal           ProviderType = "local"
 )
 
 // OIDCSessionData is the additional data needed by Pinniped when the upstream IDP is an OIDC provider.
@@ -100,6 +128,49 @@ type ActiveDirectorySessionData struct {
 	ExtraRefreshAttributes map[string]string `json:"extraRefreshAttributes,omitempty"`
 }
 
+// GitHubSessionData is the additional data needed by Pinniped when the upstream IDP is GitHub.
+type GitHubSessionData struct {
+	// UpstreamAccessToken is the access token returned by GitHub during initial authorization. GitHub does not
+	// issue refresh tokens to OAuth Apps, so the access token is used to look up the user again during a
+	// downstream refresh.
+	UpstreamAccessToken string `json:"upstreamAccessToken"`
+}
+
+// SAMLSessionData is the additional data needed by Pinniped when the upstream IDP is a SAML identity provider.
+type SAMLSessionData struct {
+	// SessionNotOnOrAfter is the time after which the SAML identity provider wants the session to end, or the zero
+	// time when it did not specify one. SAML does not offer a way to refresh a session without the user's
+	// interaction, so downstream refreshes are allowed until this time.
+	SessionNotOnOrAfter time.Time `json:"sessionNotOnOrAfter"`
+}
+
+// OAuth2SessionData is the additional data needed by Pinniped when the upstream IDP is an OAuth2 provider.
+type OAuth2SessionData struct {
+	// UpstreamRefreshToken will contain the refresh token from the upstream OAuth2 provider, if the upstream provider
+	// returned a refresh token during initial authorization. It is used to get a new access token during a
+	// downstream refresh.
+	UpstreamRefreshToken string `json:"upstreamRefreshToken"`
+
+	// UpstreamAccessToken will contain the access token returned by the upstream OAuth2 provider during initial
+	// authorization, but only when the provider did not also return a refresh token. It is used to look up the
+	// user again during a downstream refresh, which will fail once the access token has expired.
+	UpstreamAccessToken string `json:"upstreamAccessToken"`
+}
+
+// WebhookSessionData is the additional data needed by Pinniped when the upstream IDP is a webhook provider.
+type WebhookSessionData struct {
+	// UserUID is the UID of the user which was returned by the webhook during initial authentication. It is sent
+	// to the webhook to revalidate the user during a downstream refresh.
+	UserUID string `json:"userUID"`
+}
+
+// LocalSessionData is the additional data needed by Pinniped when the upstream IDP is a local provider.
+type LocalSessionData struct {
+	// UserUID is the UID of the user's Secret during initial authentication. It is used to detect when the user
+	// was deleted and recreated with the same username before a downstream refresh.
+	UserUID string `json:"userUID"`
+}
+
 // NewPinnipedSession returns a new empty session.
 func NewPinnipedSession() *PinnipedSession {
 	return &PinnipedSession{
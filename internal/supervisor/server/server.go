@@ -39,8 +39,14 @@ import (
 	"go.pinniped.dev/internal/controller/supervisorconfig"
 	"go.pinniped.dev/internal/controller/supervisorconfig/activedirectoryupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/generator"
+	"go.pinniped.dev/internal/controller/supervisorconfig/githubupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/ldapupstreamwatcher"
+	"go.pinniped.dev/internal/controller/supervisorconfig/localupstreamwatcher"
+	"go.pinniped.dev/internal/controller/supervisorconfig/oauth2upstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorconfig/oidcupstreamwatcher"
+	"go.pinniped.dev/internal/controller/supervisorconfig/samlupstreamwatcher"
+	"go.pinniped.dev/internal/controller/supervisorconfig/webhookupstreamwatcher"
+	"go.pinniped.dev/internal/controller/supervisorconfig/workloadupstreamwatcher"
 	"go.pinniped.dev/internal/controller/supervisorstorage"
 	"go.pinniped.dev/internal/controllerinit"
 	"go.pinniped.dev/internal/controllerlib"
@@ -148,6 +154,7 @@ func prepareControllers(
 				clock.RealClock{},
 				pinnipedClient,
 				federationDomainInformer,
+				kubeInformers.Core().V1().ConfigMaps(),
 				controllerlib.WithInformer,
 			),
 			singletonWorker,
@@ -293,6 +300,65 @@ func prepareControllers(
 				secretInformer,
 				controllerlib.WithInformer,
 			),
+			singletonWorker).
+		WithController(
+			githubupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().GitHubIdentityProviders(),
+				secretInformer,
+				klogr.New(),
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
+		WithController(
+			samlupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().SAMLIdentityProviders(),
+				secretInformer,
+				klogr.New(),
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
+		WithController(
+			oauth2upstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().OAuth2IdentityProviders(),
+				secretInformer,
+				klogr.New(),
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
+		WithController(
+			webhookupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().WebhookIdentityProviders(),
+				secretInformer,
+				klogr.New(),
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
+		WithController(
+			localupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().LocalIdentityProviders(),
+				secretInformer,
+				klogr.New(),
+				controllerlib.WithInformer,
+			),
+			singletonWorker).
+		WithController(
+			workloadupstreamwatcher.New(
+				dynamicUpstreamIDPProvider,
+				pinnipedClient,
+				pinnipedInformers.IDP().V1alpha1().WorkloadIdentityProviders(),
+				klogr.New(),
+				controllerlib.WithInformer,
+			),
 			singletonWorker)
 
 	return controllerinit.Prepare(controllerManager.Start, leaderElector, kubeInformers, pinnipedInformers)
@@ -372,6 +438,8 @@ func runSupervisor(podInfo *downward.PodInfo, cfg *supervisor.Config) error {
 		dynamicUpstreamIDPProvider,
 		&secretCache,
 		clientWithoutLeaderElection.Kubernetes.CoreV1().Secrets(serverInstallationNamespace), // writes to kube storage are allowed for non-leaders
+		cfg.SecurityHeaders,
+		cfg.TrustedProxies,
 	)
 
 	buildControllersFunc := prepareControllers(
@@ -451,6 +519,17 @@ func runSupervisor(podInfo *downward.PodInfo, cfg *supervisor.Config) error {
 			return cert, nil
 		}
 
+		// Only request client certificates for the hosts of FederationDomains which bind tokens to them, because
+		// browsers may ask their users to choose a client certificate when one is requested.
+		withClientCertificate := c.Clone()
+		withClientCertificate.ClientAuth = tls.RequestClientCert
+		c.GetConfigForClient = func(info *tls.ClientHelloInfo) (*tls.Config, error) {
+			if oidProvidersManager.RequestsClientCertificate(info.ServerName) {
+				return withClientCertificate, nil
+			}
+			return nil, nil
+		}
+
 		httpsListener, err := tls.Listen(e.Network, e.Address, c)
 		if err != nil {
 			return fmt.Errorf("cannot create https listener with network %q and address %q: %w", e.Network, e.Address, err)
@@ -0,0 +1,80 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package testutil
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testKDCKeyVersion = 1
+
+// TestKDC is an in-process stand-in for a Kerberos key distribution center. It knows the key of a single service
+// principal, and it can issue service tickets for that principal to any user without any network communication.
+type TestKDC struct {
+	Realm                string
+	ServicePrincipalName string
+	keytab               *keytab.Keytab
+}
+
+// NewTestKDC creates a TestKDC with a random key for the named service principal, e.g. "HTTP/example.com".
+func NewTestKDC(t *testing.T, realm, servicePrincipalName string) *TestKDC {
+	t.Helper()
+
+	randomBytes := make([]byte, 32)
+	_, err := rand.Read(randomBytes)
+	require.NoError(t, err)
+
+	kt := keytab.New()
+	err = kt.AddEntry(servicePrincipalName, realm, hex.EncodeToString(randomBytes), time.Now(), testKDCKeyVersion, etypeID.AES256_CTS_HMAC_SHA1_96)
+	require.NoError(t, err)
+
+	return &TestKDC{Realm: realm, ServicePrincipalName: servicePrincipalName, keytab: kt}
+}
+
+// Keytab returns the keytab of the service principal, in the binary keytab file format.
+func (k *TestKDC) Keytab(t *testing.T) []byte {
+	t.Helper()
+
+	b, err := k.keytab.Marshal()
+	require.NoError(t, err)
+	return b
+}
+
+// NegotiateToken issues a service ticket to the named user from the given realm, and returns it as a SPNEGO token
+// like a client would send on an "Authorization: Negotiate" header (before base64 encoding).
+func (k *TestKDC) NegotiateToken(t *testing.T, username, userRealm string) []byte {
+	t.Helper()
+
+	now := time.Now().UTC()
+	ticket, sessionKey, err := messages.NewTicket(
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, username), userRealm,
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, k.ServicePrincipalName), k.Realm,
+		types.NewKrbFlags(), k.keytab, etypeID.AES256_CTS_HMAC_SHA1_96, testKDCKeyVersion,
+		now, now, now.Add(time.Hour), now.Add(time.Hour),
+	)
+	require.NoError(t, err)
+
+	// The client is only used to provide the user's name for the authenticator, so it never talks to a KDC.
+	krb5Client := client.NewWithPassword(username, userRealm, "unused", config.New())
+	negTokenInit, err := spnego.NewNegTokenInitKRB5(krb5Client, ticket, sessionKey)
+	require.NoError(t, err)
+
+	token := spnego.SPNEGOToken{Init: true, NegTokenInit: negTokenInit}
+	b, err := token.Marshal()
+	require.NoError(t, err)
+	return b
+}
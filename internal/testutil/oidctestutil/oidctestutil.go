@@ -8,6 +8,7 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
@@ -65,6 +66,7 @@ type PerformRefreshArgs struct {
 	Ctx              context.Context
 	RefreshToken     string
 	DN               string
+	UID              string
 	ExpectedUsername string
 	ExpectedSubject  string
 }
@@ -94,14 +96,16 @@ type ValidateRefreshArgs struct {
 }
 
 type TestUpstreamLDAPIdentityProvider struct {
-	Name                    string
-	ResourceUID             types.UID
-	URL                     *url.URL
-	AuthenticateFunc        func(ctx context.Context, username, password string) (*authenticators.Response, bool, error)
-	performRefreshCallCount int
-	performRefreshArgs      []*PerformRefreshArgs
-	PerformRefreshErr       error
-	PerformRefreshGroups    []string
+	Name                     string
+	ResourceUID              types.UID
+	URL                      *url.URL
+	AuthenticateFunc         func(ctx context.Context, username, password string) (*authenticators.Response, bool, error)
+	AllowKerberos            bool
+	KerberosAuthenticateFunc func(ctx context.Context, negotiateToken []byte) (*authenticators.Response, bool, error)
+	performRefreshCallCount  int
+	performRefreshArgs       []*PerformRefreshArgs
+	PerformRefreshErr        error
+	PerformRefreshGroups     []string
 }
 
 var _ provider.UpstreamLDAPIdentityProviderI = &TestUpstreamLDAPIdentityProvider{}
@@ -118,6 +122,14 @@ func (u *TestUpstreamLDAPIdentityProvider) AuthenticateUser(ctx context.Context,
 	return u.AuthenticateFunc(ctx, username, password)
 }
 
+func (u *TestUpstreamLDAPIdentityProvider) AllowsKerberos() bool {
+	return u.AllowKerberos
+}
+
+func (u *TestUpstreamLDAPIdentityProvider) AuthenticateKerberosUser(ctx context.Context, negotiateToken []byte) (*authenticators.Response, bool, error) {
+	return u.KerberosAuthenticateFunc(ctx, negotiateToken)
+}
+
 func (u *TestUpstreamLDAPIdentityProvider) GetURL() *url.URL {
 	return u.URL
 }
@@ -130,6 +142,7 @@ func (u *TestUpstreamLDAPIdentityProvider) PerformRefresh(ctx context.Context, s
 	u.performRefreshArgs = append(u.performRefreshArgs, &PerformRefreshArgs{
 		Ctx:              ctx,
 		DN:               storedRefreshAttributes.DN,
+		UID:              storedRefreshAttributes.UID,
 		ExpectedUsername: storedRefreshAttributes.Username,
 		ExpectedSubject:  storedRefreshAttributes.Subject,
 	})
@@ -355,10 +368,251 @@ func (u *TestUpstreamOIDCIdentityProvider) ValidateTokenAndMergeWithUserInfoArgs
 	return u.validateTokenAndMergeWithUserInfoArgs[call]
 }
 
+// ParseSAMLResponseArgs is used to spy on calls to
+// TestUpstreamSAMLIdentityProvider.ParseResponseFunc().
+type ParseSAMLResponseArgs struct {
+	ServiceProvider provider.SAMLServiceProvider
+	RequestID       string
+}
+
+type TestUpstreamSAMLIdentityProvider struct {
+	Name              string
+	ResourceUID       types.UID
+	ParseResponseFunc func(r *http.Request, sp provider.SAMLServiceProvider, requestID string) (*provider.SAMLUser, error)
+
+	// Fields for tracking actual calls make to mock functions.
+	parseResponseCallCount int
+	parseResponseArgs      []*ParseSAMLResponseArgs
+}
+
+var _ provider.UpstreamSAMLIdentityProviderI = &TestUpstreamSAMLIdentityProvider{}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetName() string {
+	return u.Name
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) GetResourceUID() types.UID {
+	return u.ResourceUID
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) AuthnRequestURL(sp provider.SAMLServiceProvider, requestID string, relayState string) (*url.URL, error) {
+	return &url.URL{
+		Scheme: "https",
+		Host:   "saml-idp.example.com",
+		Path:   "/sso",
+		RawQuery: url.Values{
+			"SAMLRequest": []string{fmt.Sprintf("request-id:%s,entity-id:%s,acs-url:%s", requestID, sp.EntityID, sp.ACSURL.String())},
+			"RelayState":  []string{relayState},
+		}.Encode(),
+	}, nil
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) ParseResponse(r *http.Request, sp provider.SAMLServiceProvider, requestID string) (*provider.SAMLUser, error) {
+	if u.parseResponseArgs == nil {
+		u.parseResponseArgs = make([]*ParseSAMLResponseArgs, 0)
+	}
+	u.parseResponseCallCount++
+	u.parseResponseArgs = append(u.parseResponseArgs, &ParseSAMLResponseArgs{
+		ServiceProvider: sp,
+		RequestID:       requestID,
+	})
+	return u.ParseResponseFunc(r, sp, requestID)
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) ParseResponseCallCount() int {
+	return u.parseResponseCallCount
+}
+
+func (u *TestUpstreamSAMLIdentityProvider) ParseResponseArgs(call int) *ParseSAMLResponseArgs {
+	if u.parseResponseArgs == nil {
+		u.parseResponseArgs = make([]*ParseSAMLResponseArgs, 0)
+	}
+	return u.parseResponseArgs[call]
+}
+
+// ExchangeAuthcodeArgs is used to spy on calls to
+// TestUpstreamGitHubIdentityProvider.ExchangeAuthcodeFunc() and TestUpstreamOAuth2IdentityProvider.ExchangeAuthcodeFunc().
+type ExchangeAuthcodeArgs struct {
+	Ctx              context.Context
+	Authcode         string
+	PKCECodeVerifier pkce.Code
+	RedirectURI      string
+}
+
+// GetUserArgs is used to spy on calls to
+// TestUpstreamGitHubIdentityProvider.GetUserFunc() and TestUpstreamOAuth2IdentityProvider.GetUserFunc().
+type GetUserArgs struct {
+	Ctx         context.Context
+	AccessToken string
+}
+
+type TestUpstreamGitHubIdentityProvider struct {
+	Name                 string
+	ResourceUID          types.UID
+	ClientID             string
+	AuthorizationURL     string
+	Scopes               []string
+	ExchangeAuthcodeFunc func(ctx context.Context, authcode string, redirectURI string) (string, error)
+	GetUserFunc          func(ctx context.Context, accessToken string) (*provider.GitHubUser, error)
+
+	// Fields for tracking actual calls make to mock functions.
+	exchangeAuthcodeCallCount int
+	exchangeAuthcodeArgs      []*ExchangeAuthcodeArgs
+	getUserCallCount          int
+	getUserArgs               []*GetUserArgs
+}
+
+var _ provider.UpstreamGitHubIdentityProviderI = &TestUpstreamGitHubIdentityProvider{}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetName() string {
+	return u.Name
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetResourceUID() types.UID {
+	return u.ResourceUID
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetClientID() string {
+	return u.ClientID
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetAuthorizationURL() string {
+	return u.AuthorizationURL
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetScopes() []string {
+	return u.Scopes
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) ExchangeAuthcode(ctx context.Context, authcode string, redirectURI string) (string, error) {
+	u.exchangeAuthcodeCallCount++
+	u.exchangeAuthcodeArgs = append(u.exchangeAuthcodeArgs, &ExchangeAuthcodeArgs{
+		Ctx:         ctx,
+		Authcode:    authcode,
+		RedirectURI: redirectURI,
+	})
+	return u.ExchangeAuthcodeFunc(ctx, authcode, redirectURI)
+}
+
+func (u *TestUpstreamGitHubIdentityProvider) GetUser(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+	u.getUserCallCount++
+	u.getUserArgs = append(u.getUserArgs, &GetUserArgs{
+		Ctx:         ctx,
+		AccessToken: accessToken,
+	})
+	return u.GetUserFunc(ctx, accessToken)
+}
+
+type TestUpstreamOAuth2IdentityProvider struct {
+	Name                     string
+	ResourceUID              types.UID
+	ClientID                 string
+	AuthorizationURL         string
+	Scopes                   []string
+	AdditionalAuthcodeParams map[string]string
+	ExchangeAuthcodeFunc     func(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, redirectURI string) (*oauth2.Token, error)
+	PerformRefreshFunc       func(ctx context.Context, refreshToken string) (*oauth2.Token, error)
+	GetUserFunc              func(ctx context.Context, accessToken string) (*provider.OAuth2User, error)
+
+	// Fields for tracking actual calls make to mock functions.
+	exchangeAuthcodeCallCount int
+	exchangeAuthcodeArgs      []*ExchangeAuthcodeArgs
+	performRefreshCallCount   int
+	performRefreshArgs        []*PerformRefreshArgs
+	getUserCallCount          int
+	getUserArgs               []*GetUserArgs
+}
+
+var _ provider.UpstreamOAuth2IdentityProviderI = &TestUpstreamOAuth2IdentityProvider{}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetName() string {
+	return u.Name
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetResourceUID() types.UID {
+	return u.ResourceUID
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetClientID() string {
+	return u.ClientID
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetAuthorizationURL() string {
+	return u.AuthorizationURL
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetScopes() []string {
+	return u.Scopes
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetAdditionalAuthcodeParams() map[string]string {
+	return u.AdditionalAuthcodeParams
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) ExchangeAuthcode(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, redirectURI string) (*oauth2.Token, error) {
+	u.exchangeAuthcodeCallCount++
+	u.exchangeAuthcodeArgs = append(u.exchangeAuthcodeArgs, &ExchangeAuthcodeArgs{
+		Ctx:              ctx,
+		Authcode:         authcode,
+		PKCECodeVerifier: pkceCodeVerifier,
+		RedirectURI:      redirectURI,
+	})
+	return u.ExchangeAuthcodeFunc(ctx, authcode, pkceCodeVerifier, redirectURI)
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) PerformRefresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	u.performRefreshCallCount++
+	u.performRefreshArgs = append(u.performRefreshArgs, &PerformRefreshArgs{
+		Ctx:          ctx,
+		RefreshToken: refreshToken,
+	})
+	return u.PerformRefreshFunc(ctx, refreshToken)
+}
+
+func (u *TestUpstreamOAuth2IdentityProvider) GetUser(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+	u.getUserCallCount++
+	u.getUserArgs = append(u.getUserArgs, &GetUserArgs{
+		Ctx:         ctx,
+		AccessToken: accessToken,
+	})
+	return u.GetUserFunc(ctx, accessToken)
+}
+
+type TestWorkloadIdentityProvider struct {
+	Name                  string
+	ResourceUID           types.UID
+	Issuer                string
+	AuthenticateTokenFunc func(ctx context.Context, token string) (*provider.WorkloadIdentity, error)
+}
+
+var _ provider.WorkloadIdentityProviderI = &TestWorkloadIdentityProvider{}
+
+func (u *TestWorkloadIdentityProvider) GetName() string {
+	return u.Name
+}
+
+func (u *TestWorkloadIdentityProvider) GetResourceUID() types.UID {
+	return u.ResourceUID
+}
+
+func (u *TestWorkloadIdentityProvider) GetIssuer() string {
+	return u.Issuer
+}
+
+func (u *TestWorkloadIdentityProvider) AuthenticateToken(ctx context.Context, token string) (*provider.WorkloadIdentity, error) {
+	return u.AuthenticateTokenFunc(ctx, token)
+}
+
 type UpstreamIDPListerBuilder struct {
 	upstreamOIDCIdentityProviders            []*TestUpstreamOIDCIdentityProvider
 	upstreamLDAPIdentityProviders            []*TestUpstreamLDAPIdentityProvider
 	upstreamActiveDirectoryIdentityProviders []*TestUpstreamLDAPIdentityProvider
+	upstreamGitHubIdentityProviders          []*TestUpstreamGitHubIdentityProvider
+	upstreamSAMLIdentityProviders            []*TestUpstreamSAMLIdentityProvider
+	upstreamOAuth2IdentityProviders          []*TestUpstreamOAuth2IdentityProvider
+	upstreamWebhookIdentityProviders         []*TestUpstreamLDAPIdentityProvider
+	upstreamLocalIdentityProviders           []*TestUpstreamLDAPIdentityProvider
+	workloadIdentityProviders                []*TestWorkloadIdentityProvider
 }
 
 func (b *UpstreamIDPListerBuilder) WithOIDC(upstreamOIDCIdentityProviders ...*TestUpstreamOIDCIdentityProvider) *UpstreamIDPListerBuilder {
@@ -376,6 +630,36 @@ func (b *UpstreamIDPListerBuilder) WithActiveDirectory(upstreamActiveDirectoryId
 	return b
 }
 
+func (b *UpstreamIDPListerBuilder) WithGitHub(upstreamGitHubIdentityProviders ...*TestUpstreamGitHubIdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamGitHubIdentityProviders = append(b.upstreamGitHubIdentityProviders, upstreamGitHubIdentityProviders...)
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) WithSAML(upstreamSAMLIdentityProviders ...*TestUpstreamSAMLIdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamSAMLIdentityProviders = append(b.upstreamSAMLIdentityProviders, upstreamSAMLIdentityProviders...)
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) WithOAuth2(upstreamOAuth2IdentityProviders ...*TestUpstreamOAuth2IdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamOAuth2IdentityProviders = append(b.upstreamOAuth2IdentityProviders, upstreamOAuth2IdentityProviders...)
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) WithWebhook(upstreamWebhookIdentityProviders ...*TestUpstreamLDAPIdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamWebhookIdentityProviders = append(b.upstreamWebhookIdentityProviders, upstreamWebhookIdentityProviders...)
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) WithLocal(upstreamLocalIdentityProviders ...*TestUpstreamLDAPIdentityProvider) *UpstreamIDPListerBuilder {
+	b.upstreamLocalIdentityProviders = append(b.upstreamLocalIdentityProviders, upstreamLocalIdentityProviders...)
+	return b
+}
+
+func (b *UpstreamIDPListerBuilder) WithWorkload(workloadIdentityProviders ...*TestWorkloadIdentityProvider) *UpstreamIDPListerBuilder {
+	b.workloadIdentityProviders = append(b.workloadIdentityProviders, workloadIdentityProviders...)
+	return b
+}
+
 func (b *UpstreamIDPListerBuilder) Build() provider.DynamicUpstreamIDPProvider {
 	idpProvider := provider.NewDynamicUpstreamIDPProvider()
 
@@ -397,6 +681,42 @@ func (b *UpstreamIDPListerBuilder) Build() provider.DynamicUpstreamIDPProvider {
 	}
 	idpProvider.SetActiveDirectoryIdentityProviders(adUpstreams)
 
+	gitHubUpstreams := make([]provider.UpstreamGitHubIdentityProviderI, len(b.upstreamGitHubIdentityProviders))
+	for i := range b.upstreamGitHubIdentityProviders {
+		gitHubUpstreams[i] = provider.UpstreamGitHubIdentityProviderI(b.upstreamGitHubIdentityProviders[i])
+	}
+	idpProvider.SetGitHubIdentityProviders(gitHubUpstreams)
+
+	samlUpstreams := make([]provider.UpstreamSAMLIdentityProviderI, len(b.upstreamSAMLIdentityProviders))
+	for i := range b.upstreamSAMLIdentityProviders {
+		samlUpstreams[i] = provider.UpstreamSAMLIdentityProviderI(b.upstreamSAMLIdentityProviders[i])
+	}
+	idpProvider.SetSAMLIdentityProviders(samlUpstreams)
+
+	oauth2Upstreams := make([]provider.UpstreamOAuth2IdentityProviderI, len(b.upstreamOAuth2IdentityProviders))
+	for i := range b.upstreamOAuth2IdentityProviders {
+		oauth2Upstreams[i] = provider.UpstreamOAuth2IdentityProviderI(b.upstreamOAuth2IdentityProviders[i])
+	}
+	idpProvider.SetOAuth2IdentityProviders(oauth2Upstreams)
+
+	webhookUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, len(b.upstreamWebhookIdentityProviders))
+	for i := range b.upstreamWebhookIdentityProviders {
+		webhookUpstreams[i] = provider.UpstreamLDAPIdentityProviderI(b.upstreamWebhookIdentityProviders[i])
+	}
+	idpProvider.SetWebhookIdentityProviders(webhookUpstreams)
+
+	localUpstreams := make([]provider.UpstreamLDAPIdentityProviderI, len(b.upstreamLocalIdentityProviders))
+	for i := range b.upstreamLocalIdentityProviders {
+		localUpstreams[i] = provider.UpstreamLDAPIdentityProviderI(b.upstreamLocalIdentityProviders[i])
+	}
+	idpProvider.SetLocalIdentityProviders(localUpstreams)
+
+	workloadProviders := make([]provider.WorkloadIdentityProviderI, len(b.workloadIdentityProviders))
+	for i := range b.workloadIdentityProviders {
+		workloadProviders[i] = provider.WorkloadIdentityProviderI(b.workloadIdentityProviders[i])
+	}
+	idpProvider.SetWorkloadIdentityProviders(workloadProviders)
+
 	return idpProvider
 }
 
@@ -474,6 +794,102 @@ func (b *UpstreamIDPListerBuilder) RequireExactlyZeroCallsToExchangeAuthcodeAndV
 	)
 }
 
+func (b *UpstreamIDPListerBuilder) RequireExactlyOneCallToExchangeAuthcode(
+	t *testing.T,
+	expectedPerformedByUpstreamName string,
+	expectedArgs *ExchangeAuthcodeArgs,
+) {
+	t.Helper()
+	var actualArgs *ExchangeAuthcodeArgs
+	var actualNameOfUpstreamWhichMadeCall string
+	actualCallCountAcrossAllUpstreams := 0
+	for _, upstreamGitHub := range b.upstreamGitHubIdentityProviders {
+		callCountOnThisUpstream := upstreamGitHub.exchangeAuthcodeCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamGitHub.Name
+			actualArgs = upstreamGitHub.exchangeAuthcodeArgs[0]
+		}
+	}
+	for _, upstreamOAuth2 := range b.upstreamOAuth2IdentityProviders {
+		callCountOnThisUpstream := upstreamOAuth2.exchangeAuthcodeCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamOAuth2.Name
+			actualArgs = upstreamOAuth2.exchangeAuthcodeArgs[0]
+		}
+	}
+	require.Equal(t, 1, actualCallCountAcrossAllUpstreams,
+		"should have been exactly one call to ExchangeAuthcode() by all GitHub and OAuth2 upstreams",
+	)
+	require.Equal(t, expectedPerformedByUpstreamName, actualNameOfUpstreamWhichMadeCall,
+		"ExchangeAuthcode() was called on the wrong upstream",
+	)
+	require.Equal(t, expectedArgs, actualArgs)
+}
+
+func (b *UpstreamIDPListerBuilder) RequireExactlyZeroCallsToExchangeAuthcode(t *testing.T) {
+	t.Helper()
+	actualCallCountAcrossAllUpstreams := 0
+	for _, upstreamGitHub := range b.upstreamGitHubIdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamGitHub.exchangeAuthcodeCallCount
+	}
+	for _, upstreamOAuth2 := range b.upstreamOAuth2IdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamOAuth2.exchangeAuthcodeCallCount
+	}
+	require.Equal(t, 0, actualCallCountAcrossAllUpstreams,
+		"expected exactly zero calls to ExchangeAuthcode() by all GitHub and OAuth2 upstreams",
+	)
+}
+
+func (b *UpstreamIDPListerBuilder) RequireExactlyOneCallToGetUser(
+	t *testing.T,
+	expectedPerformedByUpstreamName string,
+	expectedArgs *GetUserArgs,
+) {
+	t.Helper()
+	var actualArgs *GetUserArgs
+	var actualNameOfUpstreamWhichMadeCall string
+	actualCallCountAcrossAllUpstreams := 0
+	for _, upstreamGitHub := range b.upstreamGitHubIdentityProviders {
+		callCountOnThisUpstream := upstreamGitHub.getUserCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamGitHub.Name
+			actualArgs = upstreamGitHub.getUserArgs[0]
+		}
+	}
+	for _, upstreamOAuth2 := range b.upstreamOAuth2IdentityProviders {
+		callCountOnThisUpstream := upstreamOAuth2.getUserCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamOAuth2.Name
+			actualArgs = upstreamOAuth2.getUserArgs[0]
+		}
+	}
+	require.Equal(t, 1, actualCallCountAcrossAllUpstreams,
+		"should have been exactly one call to GetUser() by all GitHub and OAuth2 upstreams",
+	)
+	require.Equal(t, expectedPerformedByUpstreamName, actualNameOfUpstreamWhichMadeCall,
+		"GetUser() was called on the wrong upstream",
+	)
+	require.Equal(t, expectedArgs, actualArgs)
+}
+
+func (b *UpstreamIDPListerBuilder) RequireExactlyZeroCallsToGetUser(t *testing.T) {
+	t.Helper()
+	actualCallCountAcrossAllUpstreams := 0
+	for _, upstreamGitHub := range b.upstreamGitHubIdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamGitHub.getUserCallCount
+	}
+	for _, upstreamOAuth2 := range b.upstreamOAuth2IdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamOAuth2.getUserCallCount
+	}
+	require.Equal(t, 0, actualCallCountAcrossAllUpstreams,
+		"expected exactly zero calls to GetUser() by all GitHub and OAuth2 upstreams",
+	)
+}
+
 func (b *UpstreamIDPListerBuilder) RequireExactlyOneCallToPerformRefresh(
 	t *testing.T,
 	expectedPerformedByUpstreamName string,
@@ -507,6 +923,30 @@ func (b *UpstreamIDPListerBuilder) RequireExactlyOneCallToPerformRefresh(
 			actualArgs = upstreamAD.performRefreshArgs[0]
 		}
 	}
+	for _, upstreamWebhook := range b.upstreamWebhookIdentityProviders {
+		callCountOnThisUpstream := upstreamWebhook.performRefreshCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamWebhook.Name
+			actualArgs = upstreamWebhook.performRefreshArgs[0]
+		}
+	}
+	for _, upstreamLocal := range b.upstreamLocalIdentityProviders {
+		callCountOnThisUpstream := upstreamLocal.performRefreshCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamLocal.Name
+			actualArgs = upstreamLocal.performRefreshArgs[0]
+		}
+	}
+	for _, upstreamOAuth2 := range b.upstreamOAuth2IdentityProviders {
+		callCountOnThisUpstream := upstreamOAuth2.performRefreshCallCount
+		actualCallCountAcrossAllUpstreams += callCountOnThisUpstream
+		if callCountOnThisUpstream == 1 {
+			actualNameOfUpstreamWhichMadeCall = upstreamOAuth2.Name
+			actualArgs = upstreamOAuth2.performRefreshArgs[0]
+		}
+	}
 	require.Equal(t, 1, actualCallCountAcrossAllUpstreams,
 		"should have been exactly one call to PerformRefresh() by all upstreams",
 	)
@@ -528,6 +968,15 @@ func (b *UpstreamIDPListerBuilder) RequireExactlyZeroCallsToPerformRefresh(t *te
 	for _, upstreamActiveDirectory := range b.upstreamActiveDirectoryIdentityProviders {
 		actualCallCountAcrossAllUpstreams += upstreamActiveDirectory.performRefreshCallCount
 	}
+	for _, upstreamWebhook := range b.upstreamWebhookIdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamWebhook.performRefreshCallCount
+	}
+	for _, upstreamLocal := range b.upstreamLocalIdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamLocal.performRefreshCallCount
+	}
+	for _, upstreamOAuth2 := range b.upstreamOAuth2IdentityProviders {
+		actualCallCountAcrossAllUpstreams += upstreamOAuth2.performRefreshCallCount
+	}
 
 	require.Equal(t, 0, actualCallCountAcrossAllUpstreams,
 		"expected exactly zero calls to PerformRefresh()",
@@ -0,0 +1,251 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamgithub implements an abstraction of upstream GitHub provider interactions.
+package upstreamgithub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	"go.pinniped.dev/internal/constable"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+const (
+	// ErrUserNotAllowed is returned by GetUser when the user is not a member of any of the allowed organizations.
+	ErrUserNotAllowed = constable.Error("user is not a member of any of the allowed organizations")
+
+	// Use the largest page size allowed by the GitHub API to minimize the number of requests.
+	pageSize = 100
+
+	// The maximum size of a response body from the GitHub API which we are willing to read.
+	maxResponseBodySize = 10 * 1024 * 1024
+)
+
+// nextPageLinkRegexp matches the URL of the next page in a Link header returned by the GitHub API.
+var nextPageLinkRegexp = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// ProviderConfig holds the active configuration of an upstream GitHub provider.
+type ProviderConfig struct {
+	Name        string
+	ResourceUID types.UID
+
+	// APIBaseURL is the base URL of the GitHub REST API, e.g. "https://api.github.com" for github.com or
+	// "https://github.example.com/api/v3" for GitHub Enterprise Server.
+	APIBaseURL *url.URL
+
+	UsernameAttribute  v1alpha1.GitHubUsernameAttribute
+	GroupNameAttribute v1alpha1.GitHubGroupNameAttribute
+
+	// AllowedOrganizations are the login names of the organizations whose members may authenticate. When empty,
+	// all GitHub users may authenticate, and teams from all organizations will become groups.
+	AllowedOrganizations []string
+
+	OAuth2Config *oauth2.Config
+	HTTPClient   *http.Client
+}
+
+var _ provider.UpstreamGitHubIdentityProviderI = (*ProviderConfig)(nil)
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+func (p *ProviderConfig) GetClientID() string {
+	return p.OAuth2Config.ClientID
+}
+
+func (p *ProviderConfig) GetAuthorizationURL() string {
+	return p.OAuth2Config.Endpoint.AuthURL
+}
+
+func (p *ProviderConfig) GetScopes() []string {
+	return p.OAuth2Config.Scopes
+}
+
+// ExchangeAuthcode performs the upstream OAuth2 authorization code exchange and returns the GitHub access token.
+func (p *ProviderConfig) ExchangeAuthcode(ctx context.Context, authcode string, redirectURI string) (string, error) {
+	tok, err := p.OAuth2Config.Exchange(
+		context.WithValue(ctx, oauth2.HTTPClient, p.HTTPClient),
+		authcode,
+		oauth2.SetAuthURLParam("redirect_uri", redirectURI),
+	)
+	if err != nil {
+		return "", err
+	}
+	return tok.AccessToken, nil
+}
+
+type githubUser struct {
+	Login string `json:"login"`
+	ID    int64  `json:"id"`
+}
+
+type githubOrganization struct {
+	Login string `json:"login"`
+}
+
+type githubTeam struct {
+	Name         string             `json:"name"`
+	Slug         string             `json:"slug"`
+	Organization githubOrganization `json:"organization"`
+}
+
+// GetUser uses the GitHub API to look up the user who owns the access token, including their team memberships.
+func (p *ProviderConfig) GetUser(ctx context.Context, accessToken string) (*provider.GitHubUser, error) {
+	var user githubUser
+	if _, err := p.get(ctx, accessToken, p.apiURL("user"), &user); err != nil {
+		return nil, fmt.Errorf("error fetching authenticated user: %w", err)
+	}
+	if user.Login == "" || user.ID == 0 {
+		return nil, fmt.Errorf("error fetching authenticated user: response is missing login or id")
+	}
+	id := strconv.FormatInt(user.ID, 10)
+
+	// GitHub login names are case-insensitive.
+	allowedOrgs := sets.NewString()
+	for _, org := range p.AllowedOrganizations {
+		allowedOrgs.Insert(strings.ToLower(org))
+	}
+
+	if allowedOrgs.Len() > 0 {
+		var orgs []githubOrganization
+		if err := p.getAllPages(ctx, accessToken, p.apiURL("user/orgs"), &orgs); err != nil {
+			return nil, fmt.Errorf("error fetching organizations for user %q: %w", user.Login, err)
+		}
+		allowed := false
+		for _, org := range orgs {
+			if allowedOrgs.Has(strings.ToLower(org.Login)) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, ErrUserNotAllowed
+		}
+	}
+
+	var teams []githubTeam
+	if err := p.getAllPages(ctx, accessToken, p.apiURL("user/teams"), &teams); err != nil {
+		return nil, fmt.Errorf("error fetching teams for user %q: %w", user.Login, err)
+	}
+	groups := sets.NewString()
+	for _, team := range teams {
+		if allowedOrgs.Len() > 0 && !allowedOrgs.Has(strings.ToLower(team.Organization.Login)) {
+			continue
+		}
+		teamName := team.Slug
+		if p.GroupNameAttribute == v1alpha1.GitHubGroupNameName {
+			teamName = team.Name
+		}
+		groups.Insert(team.Organization.Login + "/" + teamName)
+	}
+
+	var username string
+	switch p.UsernameAttribute {
+	case v1alpha1.GitHubUsernameID:
+		username = id
+	case v1alpha1.GitHubUsernameLogin:
+		username = user.Login
+	default:
+		username = user.Login + ":" + id
+	}
+
+	return &provider.GitHubUser{
+		Username:          username,
+		Groups:            groups.List(),
+		DownstreamSubject: p.downstreamSubject(id),
+	}, nil
+}
+
+// downstreamSubject returns a subject which is unique to this user across all upstream providers, because it is
+// formed from the API URL of this provider and the user's ID, which never changes.
+func (p *ProviderConfig) downstreamSubject(id string) string {
+	subjectURL := *p.APIBaseURL
+	q := subjectURL.Query()
+	q.Set(oidc.IDTokenSubjectClaim, id)
+	subjectURL.RawQuery = q.Encode()
+	return subjectURL.String()
+}
+
+func (p *ProviderConfig) apiURL(path string) string {
+	return strings.TrimSuffix(p.APIBaseURL.String(), "/") + "/" + path
+}
+
+// getAllPages follows the Link headers of the GitHub API to fetch all pages of a list, and decodes all of the
+// items into result, which must be a pointer to a slice.
+func (p *ProviderConfig) getAllPages(ctx context.Context, accessToken string, firstPageURL string, result interface{}) error {
+	var items []json.RawMessage
+	pageURL := fmt.Sprintf("%s?per_page=%d", firstPageURL, pageSize)
+	for pageURL != "" {
+		var page []json.RawMessage
+		nextPageURL, err := p.get(ctx, accessToken, pageURL, &page)
+		if err != nil {
+			return err
+		}
+		items = append(items, page...)
+		pageURL = nextPageURL
+	}
+
+	allItems, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(allItems, result)
+}
+
+// get performs an authenticated GET request to the GitHub API and decodes the JSON response into result.
+// It returns the URL of the next page of results, if there is one.
+func (p *ProviderConfig) get(ctx context.Context, accessToken string, requestURL string, result interface{}) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status %q from %s with body: %s", resp.Status, req.URL.Path, body)
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return "", fmt.Errorf("could not decode response from %s: %w", req.URL.Path, err)
+	}
+
+	if matches := nextPageLinkRegexp.FindStringSubmatch(resp.Header.Get("Link")); matches != nil {
+		// Never send the access token anywhere other than the GitHub API.
+		nextPageURL, err := url.Parse(matches[1])
+		if err != nil || nextPageURL.Scheme != req.URL.Scheme || nextPageURL.Host != req.URL.Host {
+			return "", fmt.Errorf("unexpected next page URL %q in response from %s", matches[1], req.URL.Path)
+		}
+		return nextPageURL.String(), nil
+	}
+	return "", nil
+}
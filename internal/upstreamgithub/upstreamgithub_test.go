@@ -0,0 +1,255 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamgithub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"go.pinniped.dev/generated/latest/apis/supervisor/idp/v1alpha1"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+func TestProviderConfig(t *testing.T) {
+	t.Run("getters get", func(t *testing.T) {
+		p := ProviderConfig{
+			Name:        "test-name",
+			ResourceUID: "test-uid",
+			OAuth2Config: &oauth2.Config{
+				ClientID: "test-client-id",
+				Endpoint: oauth2.Endpoint{AuthURL: "https://github.com/login/oauth/authorize"},
+				Scopes:   []string{"read:user", "read:org"},
+			},
+		}
+		require.Equal(t, "test-name", p.GetName())
+		require.Equal(t, "test-uid", string(p.GetResourceUID()))
+		require.Equal(t, "test-client-id", p.GetClientID())
+		require.Equal(t, "https://github.com/login/oauth/authorize", p.GetAuthorizationURL())
+		require.Equal(t, []string{"read:user", "read:org"}, p.GetScopes())
+	})
+
+	t.Run("ExchangeAuthcode", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/login/oauth/access_token", r.URL.Path)
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "test-client-id", r.Form.Get("client_id"))
+			require.Equal(t, "test-client-secret", r.Form.Get("client_secret"))
+			require.Equal(t, "authorization_code", r.Form.Get("grant_type"))
+			require.Equal(t, "https://example.com/callback", r.Form.Get("redirect_uri"))
+			switch r.Form.Get("code") {
+			case "good-code":
+				w.Header().Set("content-type", "application/json")
+				_, _ = fmt.Fprint(w, `{"access_token":"test-access-token","token_type":"bearer","scope":"read:org,read:user"}`)
+			default:
+				http.Error(w, `{"error":"bad_verification_code"}`, http.StatusBadRequest)
+			}
+		}))
+		t.Cleanup(server.Close)
+
+		p := ProviderConfig{
+			OAuth2Config: &oauth2.Config{
+				ClientID:     "test-client-id",
+				ClientSecret: "test-client-secret",
+				Endpoint: oauth2.Endpoint{
+					TokenURL:  server.URL + "/login/oauth/access_token",
+					AuthStyle: oauth2.AuthStyleInParams,
+				},
+			},
+			HTTPClient: server.Client(),
+		}
+
+		token, err := p.ExchangeAuthcode(context.Background(), "good-code", "https://example.com/callback")
+		require.NoError(t, err)
+		require.Equal(t, "test-access-token", token)
+
+		token, err = p.ExchangeAuthcode(context.Background(), "bad-code", "https://example.com/callback")
+		require.EqualError(t, err, "oauth2: cannot fetch token: 400 Bad Request\nResponse: {\"error\":\"bad_verification_code\"}\n")
+		require.Empty(t, token)
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	t.Parallel()
+
+	const accessToken = "test-access-token"
+
+	// fakeGitHubAPI serves the endpoints of the GitHub REST API which are used by GetUser. The second page of each
+	// list is served at the "page2" path to test pagination.
+	fakeGitHubAPI := func(t *testing.T, userJSON string, orgsStatus int) *httptest.Server {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, http.MethodGet, r.Method)
+			require.Equal(t, "Bearer "+accessToken, r.Header.Get("Authorization"))
+			require.Equal(t, "application/vnd.github+json", r.Header.Get("Accept"))
+
+			w.Header().Set("content-type", "application/json")
+			switch r.URL.Path {
+			case "/api/v3/user":
+				_, _ = fmt.Fprint(w, userJSON)
+			case "/api/v3/user/orgs":
+				if orgsStatus != http.StatusOK {
+					http.Error(w, `{"message":"some error"}`, orgsStatus)
+					return
+				}
+				require.Equal(t, "100", r.URL.Query().Get("per_page"))
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/user/orgs/page2>; rel="next", <%s/api/v3/user/orgs/page2>; rel="last"`, server.URL, server.URL))
+				_, _ = fmt.Fprint(w, `[{"login":"org-1"}]`)
+			case "/api/v3/user/orgs/page2":
+				_, _ = fmt.Fprint(w, `[{"login":"Org-2"}]`)
+			case "/api/v3/user/teams":
+				require.Equal(t, "100", r.URL.Query().Get("per_page"))
+				w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/user/teams/page2>; rel="next"`, server.URL))
+				_, _ = fmt.Fprint(w, `[
+					{"name":"Team 1","slug":"team-1","organization":{"login":"org-1"}},
+					{"name":"Team 2","slug":"team-2","organization":{"login":"Org-2"}}
+				]`)
+			case "/api/v3/user/teams/page2":
+				_, _ = fmt.Fprint(w, `[{"name":"Team 3","slug":"team-3","organization":{"login":"org-3"}}]`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	tests := []struct {
+		name                 string
+		userJSON             string
+		orgsStatus           int
+		usernameAttribute    v1alpha1.GitHubUsernameAttribute
+		groupNameAttribute   v1alpha1.GitHubGroupNameAttribute
+		allowedOrganizations []string
+		wantUser             *provider.GitHubUser
+		wantErr              string
+	}{
+		{
+			name:     "all users are allowed and teams from all organizations become groups",
+			userJSON: `{"login":"some-login","id":1234}`,
+			wantUser: &provider.GitHubUser{
+				Username:          "some-login:1234",
+				Groups:            []string{"Org-2/team-2", "org-1/team-1", "org-3/team-3"},
+				DownstreamSubject: "/api/v3?sub=1234",
+			},
+		},
+		{
+			name:                 "user is a member of an allowed organization, which is case-insensitive",
+			userJSON:             `{"login":"some-login","id":1234}`,
+			allowedOrganizations: []string{"org-2", "org-3"},
+			wantUser: &provider.GitHubUser{
+				Username:          "some-login:1234",
+				Groups:            []string{"Org-2/team-2", "org-3/team-3"},
+				DownstreamSubject: "/api/v3?sub=1234",
+			},
+		},
+		{
+			name:                 "user is not a member of any allowed organization",
+			userJSON:             `{"login":"some-login","id":1234}`,
+			allowedOrganizations: []string{"org-3", "org-4"},
+			wantErr:              "user is not a member of any of the allowed organizations",
+		},
+		{
+			name:               "username is the login and group names are team names",
+			userJSON:           `{"login":"some-login","id":1234}`,
+			usernameAttribute:  v1alpha1.GitHubUsernameLogin,
+			groupNameAttribute: v1alpha1.GitHubGroupNameName,
+			wantUser: &provider.GitHubUser{
+				Username:          "some-login",
+				Groups:            []string{"Org-2/Team 2", "org-1/Team 1", "org-3/Team 3"},
+				DownstreamSubject: "/api/v3?sub=1234",
+			},
+		},
+		{
+			name:              "username is the id",
+			userJSON:          `{"login":"some-login","id":1234}`,
+			usernameAttribute: v1alpha1.GitHubUsernameID,
+			wantUser: &provider.GitHubUser{
+				Username:          "1234",
+				Groups:            []string{"Org-2/team-2", "org-1/team-1", "org-3/team-3"},
+				DownstreamSubject: "/api/v3?sub=1234",
+			},
+		},
+		{
+			name:     "user response is missing the id",
+			userJSON: `{"login":"some-login"}`,
+			wantErr:  "error fetching authenticated user: response is missing login or id",
+		},
+		{
+			name:     "user response is not JSON",
+			userJSON: `not-json`,
+			wantErr:  "error fetching authenticated user: could not decode response from /api/v3/user: invalid character 'o' in literal null (expecting 'u')",
+		},
+		{
+			name:                 "error fetching organizations",
+			userJSON:             `{"login":"some-login","id":1234}`,
+			orgsStatus:           http.StatusForbidden,
+			allowedOrganizations: []string{"org-1"},
+			wantErr:              `error fetching organizations for user "some-login": unexpected response status "403 Forbidden" from /api/v3/user/orgs with body: {"message":"some error"}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			orgsStatus := tt.orgsStatus
+			if orgsStatus == 0 {
+				orgsStatus = http.StatusOK
+			}
+			server := fakeGitHubAPI(t, tt.userJSON, orgsStatus)
+			apiURL, err := url.Parse(server.URL + "/api/v3")
+			require.NoError(t, err)
+
+			p := ProviderConfig{
+				APIBaseURL:           apiURL,
+				UsernameAttribute:    tt.usernameAttribute,
+				GroupNameAttribute:   tt.groupNameAttribute,
+				AllowedOrganizations: tt.allowedOrganizations,
+				HTTPClient:           server.Client(),
+			}
+
+			user, err := p.GetUser(context.Background(), accessToken)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, user)
+				return
+			}
+			require.NoError(t, err)
+			tt.wantUser.DownstreamSubject = server.URL + tt.wantUser.DownstreamSubject
+			require.Equal(t, tt.wantUser, user)
+		})
+	}
+}
+
+func TestGetUserRejectsNextPageOnOtherHost(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		switch r.URL.Path {
+		case "/user":
+			_, _ = fmt.Fprint(w, `{"login":"some-login","id":1234}`)
+		case "/user/teams":
+			w.Header().Set("Link", `<https://attacker.example.com/user/teams?page=2>; rel="next"`)
+			_, _ = fmt.Fprint(w, `[]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	apiURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	p := ProviderConfig{APIBaseURL: apiURL, HTTPClient: server.Client()}
+	user, err := p.GetUser(context.Background(), "test-access-token")
+	require.EqualError(t, err, `error fetching teams for user "some-login": unexpected next page URL "https://attacker.example.com/user/teams?page=2" in response from /user/teams`)
+	require.Nil(t, user)
+}
@@ -0,0 +1,37 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// GroupCache remembers the groups which were found for each user for a limited time, so refreshes can skip the
+// group search while the groups are still fresh. It is safe for concurrent use, and it may be shared between
+// Providers which have the same group search settings, so the groups are remembered when a Provider is replaced
+// by another one.
+type GroupCache struct {
+	cache *cache.Expiring
+}
+
+func NewGroupCache() *GroupCache {
+	return &GroupCache{cache: cache.NewExpiring()}
+}
+
+// get returns the groups which were found for the user, unless they were found longer ago than the TTL.
+func (c *GroupCache) get(userDN string) ([]string, bool) {
+	cached, found := c.cache.Get(normalizeDN(userDN))
+	if !found {
+		return nil, false
+	}
+	// Return a copy, so callers cannot change the cached groups.
+	groups := cached.([]string)
+	return append(make([]string, 0, len(groups)), groups...), true
+}
+
+func (c *GroupCache) put(userDN string, groups []string, ttl time.Duration) {
+	c.cache.Set(normalizeDN(userDN), append(make([]string, 0, len(groups)), groups...), ttl)
+}
@@ -0,0 +1,272 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"go.pinniped.dev/internal/endpointaddr"
+	"go.pinniped.dev/internal/plog"
+)
+
+// Hosts which could not be reached are tried after the other hosts until this much time has passed since the failure,
+// to avoid waiting for the connection attempt to time out during every login while a server is down.
+const unhealthyHostRetryInterval = time.Minute
+
+// HostHealth remembers which LDAP servers recently could not be reached. It is safe for concurrent use, and it may
+// be shared between Providers which have the same hosts, so the health of the hosts is remembered when a Provider
+// is replaced by another one.
+type HostHealth struct {
+	lock     sync.Mutex
+	failures map[string]hostFailure
+}
+
+type hostFailure struct {
+	err error
+	at  time.Time
+}
+
+// UnhealthyHost is a host whose most recent connection attempt failed.
+type UnhealthyHost struct {
+	Host string
+	Err  error
+}
+
+func NewHostHealth() *HostHealth {
+	return &HostHealth{failures: map[string]hostFailure{}}
+}
+
+// UnhealthyHosts returns the hosts whose most recent connection attempt failed, sorted by host.
+func (h *HostHealth) UnhealthyHosts() []UnhealthyHost {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	unhealthy := make([]UnhealthyHost, 0, len(h.failures))
+	for host, failure := range h.failures {
+		unhealthy = append(unhealthy, UnhealthyHost{Host: host, Err: failure.err})
+	}
+	sort.Slice(unhealthy, func(i, j int) bool { return unhealthy[i].Host < unhealthy[j].Host })
+	return unhealthy
+}
+
+func (h *HostHealth) recordSuccess(host string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.failures, host)
+}
+
+func (h *HostHealth) recordFailure(host string, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.failures[host] = hostFailure{err: err, at: time.Now()}
+}
+
+// failedSince returns true when the most recent connection attempt to the host failed after the given time.
+func (h *HostHealth) failedSince(host string, since time.Time) bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	failure, failed := h.failures[host]
+	return failed && failure.at.After(since)
+}
+
+// partition splits the hosts into those which did not fail recently and those which did, keeping their order.
+func (h *HostHealth) partition(hosts []string) ([]string, []string) {
+	since := time.Now().Add(-unhealthyHostRetryInterval)
+	var healthy, recentlyFailed []string
+	for _, host := range hosts {
+		if h.failedSince(host, since) {
+			recentlyFailed = append(recentlyFailed, host)
+		} else {
+			healthy = append(healthy, host)
+		}
+	}
+	return healthy, recentlyFailed
+}
+
+// HasFailoverHosts returns true when there are other servers to try when the Host cannot be reached.
+func (c *ProviderConfig) HasFailoverHosts() bool {
+	return len(c.AdditionalHosts) > 0 || c.SRVDomain != ""
+}
+
+// dial connects to the first host which can be reached. The Host and the AdditionalHosts are tried first, in order,
+// followed by the hosts discovered from DNS SRV records, if any. Hosts which recently could not be reached are tried
+// after all the others. Only connection errors cause a failover. Errors which happen after connecting, such as bind
+// errors, are left to the caller.
+func (p *Provider) dial(ctx context.Context) (Conn, error) {
+	configuredHosts := append([]string{p.c.Host}, p.c.AdditionalHosts...)
+	healthy, recentlyFailed := p.hostHealth.partition(configuredHosts)
+
+	var errs []error
+	conn, err := p.dialHosts(ctx, healthy)
+	if conn != nil {
+		return conn, nil
+	}
+	errs = append(errs, err...)
+
+	if p.c.SRVDomain != "" && ctx.Err() == nil {
+		discoveredHosts, srvErr := p.discoverHosts(ctx, configuredHosts)
+		if srvErr != nil {
+			errs = append(errs, srvErr)
+		}
+		discoveredHealthy, discoveredRecentlyFailed := p.hostHealth.partition(discoveredHosts)
+		conn, err = p.dialHosts(ctx, discoveredHealthy)
+		if conn != nil {
+			return conn, nil
+		}
+		errs = append(errs, err...)
+		recentlyFailed = append(recentlyFailed, discoveredRecentlyFailed...)
+	}
+
+	conn, err = p.dialHosts(ctx, recentlyFailed)
+	if conn != nil {
+		return conn, nil
+	}
+	errs = append(errs, err...)
+
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, e.Error())
+	}
+	return nil, fmt.Errorf("could not connect to any host: %s", strings.Join(messages, "; "))
+}
+
+// dialHosts tries the hosts in order until one can be reached, and records the result for each host which was tried.
+// Connections are deliberately not spread across the hosts, so the first host which can be reached gets all of them.
+func (p *Provider) dialHosts(ctx context.Context, hosts []string) (Conn, []error) {
+	var errs []error
+	for _, host := range hosts {
+		conn, err := p.dialHost(ctx, host)
+		if err == nil {
+			p.hostHealth.recordSuccess(host)
+			return conn, nil
+		}
+		errs = append(errs, fmt.Errorf(`error dialing host %q: %w`, host, err))
+		if ctx.Err() != nil {
+			// Do not blame this host or the remaining hosts for running out of time.
+			break
+		}
+		p.hostHealth.recordFailure(host, err)
+		if p.c.HasFailoverHosts() {
+			plog.InfoErr("could not connect to LDAP host", err, "upstreamName", p.GetName(), "host", host)
+		}
+	}
+	return nil, errs
+}
+
+func (p *Provider) dialHost(ctx context.Context, host string) (Conn, error) {
+	tlsAddr, err := endpointaddr.Parse(host, defaultLDAPSPort)
+	if err != nil {
+		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	startTLSAddr, err := endpointaddr.Parse(host, defaultLDAPPort)
+	if err != nil {
+		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+	}
+
+	// Choose how and where to dial based on TLS vs. StartTLS config option.
+	var dialFunc LDAPDialerFunc
+	var addr endpointaddr.HostPort
+	switch {
+	case p.c.ConnectionProtocol == TLS:
+		dialFunc = p.dialTLS
+		addr = tlsAddr
+	case p.c.ConnectionProtocol == StartTLS:
+		dialFunc = p.dialStartTLS
+		addr = startTLSAddr
+	default:
+		return nil, ldap.NewError(ldap.ErrorNetwork, fmt.Errorf("did not specify valid ConnectionProtocol"))
+	}
+
+	// Override the real dialer for testing purposes sometimes.
+	if p.c.Dialer != nil {
+		dialFunc = p.c.Dialer.Dial
+	}
+
+	return dialFunc(ctx, addr)
+}
+
+// discoverHosts looks up the hosts in the "_ldap._tcp" SRV records of the SRVDomain, which are returned sorted
+// by priority and randomized by weight, excluding the hosts which are already configured. Each discovered host
+// includes the port from its SRV record, so a configured host is only excluded when it would use the same port.
+func (p *Provider) discoverHosts(ctx context.Context, configuredHosts []string) ([]string, error) {
+	lookupSRV := p.c.LookupSRV
+	if lookupSRV == nil {
+		lookupSRV = net.DefaultResolver.LookupSRV
+	}
+
+	_, records, err := lookupSRV(ctx, "ldap", "tcp", p.c.SRVDomain)
+	if err != nil {
+		return nil, fmt.Errorf(`error looking up SRV records for domain %q: %w`, p.c.SRVDomain, err)
+	}
+
+	seen := sets.NewString()
+	for _, host := range configuredHosts {
+		if addr, err := endpointaddr.Parse(host, p.defaultPort()); err == nil {
+			seen.Insert(addr.Endpoint())
+		}
+	}
+
+	var hosts []string
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+		// A target of "." means that the service is decidedly not available in the domain.
+		if target == "" {
+			continue
+		}
+		host := net.JoinHostPort(target, strconv.Itoa(int(record.Port)))
+		if seen.Has(host) {
+			continue
+		}
+		seen.Insert(host)
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// defaultPort returns the port which is used for hosts which do not specify a port.
+func (p *Provider) defaultPort() uint16 {
+	if p.c.ConnectionProtocol == StartTLS {
+		return defaultLDAPPort
+	}
+	return defaultLDAPSPort
+}
+
+// CheckHostHealth tries to connect to each of the Host and the AdditionalHosts, and to each other host which was
+// unhealthy, and records the results. Hosts which failed within the retry interval are not tried again, since they
+// are already known to be unhealthy. Otherwise, hosts which are only tried after other hosts could stay unknown or
+// unhealthy forever while the other hosts are healthy.
+func (p *Provider) CheckHostHealth(ctx context.Context) {
+	hosts := append([]string{p.c.Host}, p.c.AdditionalHosts...)
+	seen := sets.NewString(hosts...)
+	for _, unhealthy := range p.hostHealth.UnhealthyHosts() {
+		if !seen.Has(unhealthy.Host) {
+			hosts = append(hosts, unhealthy.Host)
+		}
+	}
+
+	since := time.Now().Add(-unhealthyHostRetryInterval)
+	for _, host := range hosts {
+		if p.hostHealth.failedSince(host, since) {
+			continue
+		}
+		conn, _ := p.dialHosts(ctx, []string{host})
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/endpointaddr"
+	"go.pinniped.dev/internal/mocks/mockldapconn"
+)
+
+func TestDialFailover(t *testing.T) {
+	// newProvider returns a provider whose dialer fails for the hosts in the down set, and which records the
+	// addresses that were dialed.
+	newProvider := func(t *testing.T, config ProviderConfig, down map[string]bool) (*Provider, *[]string) {
+		ctrl := gomock.NewController(t)
+		t.Cleanup(ctrl.Finish)
+
+		var dialed []string
+		config.ConnectionProtocol = TLS
+		config.BindUsername = testBindUsername
+		config.BindPassword = testBindPassword
+		config.Dialer = LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+			dialed = append(dialed, addr.Endpoint())
+			if down[addr.Host] {
+				return nil, errors.New("connection refused")
+			}
+			conn := mockldapconn.NewMockConn(ctrl)
+			conn.EXPECT().Bind(gomock.Any(), gomock.Any()).AnyTimes()
+			conn.EXPECT().Close().AnyTimes()
+			return conn, nil
+		})
+		return New(config), &dialed
+	}
+
+	t.Run("does not fail over when there are no failover hosts", func(t *testing.T) {
+		p, dialed := newProvider(t, ProviderConfig{Host: "ldap1.example.com"}, map[string]bool{"ldap1.example.com": true})
+
+		err := p.TestConnection(context.Background())
+		require.EqualError(t, err, `error dialing host "ldap1.example.com": connection refused`)
+		require.Equal(t, []string{"ldap1.example.com:636"}, *dialed)
+	})
+
+	t.Run("fails over to the additional hosts in order, and tries hosts which recently failed last", func(t *testing.T) {
+		down := map[string]bool{"ldap1.example.com": true}
+		p, dialed := newProvider(t, ProviderConfig{
+			Host:            "ldap1.example.com",
+			AdditionalHosts: []string{"ldap2.example.com:1234", "ldap3.example.com"},
+		}, down)
+
+		require.NoError(t, p.TestConnection(context.Background()))
+		require.Equal(t, []string{"ldap1.example.com:636", "ldap2.example.com:1234"}, *dialed)
+
+		// The first host recently failed, so it is tried after the others.
+		*dialed = nil
+		down["ldap2.example.com"] = true
+		require.NoError(t, p.TestConnection(context.Background()))
+		require.Equal(t, []string{"ldap2.example.com:1234", "ldap3.example.com:636"}, *dialed)
+
+		unhealthy := p.hostHealth.UnhealthyHosts()
+		require.Len(t, unhealthy, 2)
+		require.Equal(t, "ldap1.example.com", unhealthy[0].Host)
+		require.EqualError(t, unhealthy[0].Err, "connection refused")
+		require.Equal(t, "ldap2.example.com:1234", unhealthy[1].Host)
+
+		// When all hosts are down, the error includes all of them.
+		*dialed = nil
+		down["ldap3.example.com"] = true
+		err := p.TestConnection(context.Background())
+		require.EqualError(t, err, `could not connect to any host: `+
+			`error dialing host "ldap3.example.com": connection refused; `+
+			`error dialing host "ldap1.example.com": connection refused; `+
+			`error dialing host "ldap2.example.com:1234": connection refused`)
+		require.Equal(t, []string{"ldap3.example.com:636", "ldap1.example.com:636", "ldap2.example.com:1234"}, *dialed)
+	})
+
+	t.Run("does not fail over on bind errors", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		t.Cleanup(ctrl.Finish)
+
+		dialCount := 0
+		p := New(ProviderConfig{
+			Host:               "ldap1.example.com",
+			AdditionalHosts:    []string{"ldap2.example.com"},
+			ConnectionProtocol: StartTLS,
+			BindUsername:       testBindUsername,
+			BindPassword:       testBindPassword,
+			Dialer: LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+				dialCount++
+				require.Equal(t, "ldap1.example.com:389", addr.Endpoint())
+				conn := mockldapconn.NewMockConn(ctrl)
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Return(errors.New("some bind error")).Times(1)
+				conn.EXPECT().Close().Times(1)
+				return conn, nil
+			}),
+		})
+
+		err := p.TestConnection(context.Background())
+		require.EqualError(t, err, `error binding as "cn=some-bind-username,dc=pinniped,dc=dev": some bind error`)
+		require.Equal(t, 1, dialCount)
+		require.Empty(t, p.hostHealth.UnhealthyHosts())
+	})
+
+	t.Run("discovers more hosts using DNS SRV records when the configured hosts cannot be reached", func(t *testing.T) {
+		lookups := 0
+		p, dialed := newProvider(t, ProviderConfig{
+			Host:      "dc1.corp.example.com:389",
+			SRVDomain: "corp.example.com",
+			LookupSRV: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+				lookups++
+				require.Equal(t, "ldap", service)
+				require.Equal(t, "tcp", proto)
+				require.Equal(t, "corp.example.com", name)
+				return "_ldap._tcp.corp.example.com.", []*net.SRV{
+					{Target: "dc1.corp.example.com.", Port: 389},
+					{Target: "dc2.corp.example.com.", Port: 389},
+					{Target: "dc3.corp.example.com.", Port: 389},
+				}, nil
+			},
+		}, map[string]bool{"dc1.corp.example.com": true, "dc2.corp.example.com": true})
+
+		require.NoError(t, p.TestConnection(context.Background()))
+		require.Equal(t, []string{"dc1.corp.example.com:389", "dc2.corp.example.com:389", "dc3.corp.example.com:389"}, *dialed)
+		require.Equal(t, 1, lookups)
+	})
+
+	t.Run("uses the ports from the DNS SRV records, and only skips configured hosts which use the same port", func(t *testing.T) {
+		p, dialed := newProvider(t, ProviderConfig{
+			Host:      "dc1.corp.example.com",
+			SRVDomain: "corp.example.com",
+			LookupSRV: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+				return "_ldap._tcp.corp.example.com.", []*net.SRV{
+					{Target: "dc1.corp.example.com.", Port: 636},
+					{Target: "dc1.corp.example.com.", Port: 3269},
+					{Target: "dc2.corp.example.com.", Port: 3269},
+				}, nil
+			},
+		}, map[string]bool{"dc1.corp.example.com": true})
+
+		require.NoError(t, p.TestConnection(context.Background()))
+		require.Equal(t, []string{"dc1.corp.example.com:636", "dc1.corp.example.com:3269", "dc2.corp.example.com:3269"}, *dialed)
+	})
+
+	t.Run("does not look up DNS SRV records when the configured hosts can be reached", func(t *testing.T) {
+		p, dialed := newProvider(t, ProviderConfig{
+			Host:      "dc1.corp.example.com",
+			SRVDomain: "corp.example.com",
+			LookupSRV: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+				require.FailNow(t, "should not have looked up SRV records")
+				return "", nil, nil
+			},
+		}, nil)
+
+		require.NoError(t, p.TestConnection(context.Background()))
+		require.Equal(t, []string{"dc1.corp.example.com:636"}, *dialed)
+	})
+
+	t.Run("includes DNS SRV lookup errors when no host can be reached", func(t *testing.T) {
+		p, _ := newProvider(t, ProviderConfig{
+			Host:      "dc1.corp.example.com",
+			SRVDomain: "corp.example.com",
+			LookupSRV: func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+				return "", nil, errors.New("no such host")
+			},
+		}, map[string]bool{"dc1.corp.example.com": true})
+
+		err := p.TestConnection(context.Background())
+		require.EqualError(t, err, `could not connect to any host: `+
+			`error dialing host "dc1.corp.example.com": connection refused; `+
+			`error looking up SRV records for domain "corp.example.com": no such host`)
+	})
+
+	t.Run("shares host health between providers and checks the health of the hosts", func(t *testing.T) {
+		down := map[string]bool{"ldap1.example.com": true}
+		hostHealth := NewHostHealth()
+		config := ProviderConfig{
+			Host:            "ldap1.example.com",
+			AdditionalHosts: []string{"ldap2.example.com"},
+			HostHealth:      hostHealth,
+		}
+		p1, _ := newProvider(t, config, down)
+		require.NoError(t, p1.TestConnection(context.Background()))
+
+		// Another provider knows that the first host recently failed.
+		p2, dialed := newProvider(t, config, down)
+		require.NoError(t, p2.TestConnection(context.Background()))
+		require.Equal(t, []string{"ldap2.example.com:636"}, *dialed)
+
+		// Hosts which failed within the retry interval are not checked again.
+		*dialed = nil
+		p2.CheckHostHealth(context.Background())
+		require.Equal(t, []string{"ldap2.example.com:636"}, *dialed)
+
+		// Pretend that the failure happened longer ago than the retry interval.
+		hostHealth.failures["ldap1.example.com"] = hostFailure{
+			err: errors.New("connection refused"),
+			at:  time.Now().Add(-2 * unhealthyHostRetryInterval),
+		}
+		down["ldap1.example.com"] = false
+		*dialed = nil
+		p2.CheckHostHealth(context.Background())
+		require.Equal(t, []string{"ldap1.example.com:636", "ldap2.example.com:636"}, *dialed)
+		require.Empty(t, hostHealth.UnhealthyHosts())
+	})
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// The maximum number of open connections which are bound as the service account, per provider.
+	// When all of them are in use, callers wait for one to be returned to the pool, which limits the
+	// load on the LDAP server during bursts of logins.
+	maxPooledConnections = 10
+
+	// Pooled connections which have not been used for this long are closed. LDAP servers typically close
+	// idle connections themselves after some time (e.g. 15 minutes for Active Directory by default),
+	// so this should be shorter than that.
+	pooledConnectionIdleTimeout = time.Minute
+)
+
+type idleConn struct {
+	conn      Conn
+	idleSince time.Time
+}
+
+// connectionPool is a bounded pool of connections which were already bound as the service account.
+// Idle connections are closed by a timer after the idle timeout, so a pool which is no longer used
+// does not hold any connections open for longer than that.
+type connectionPool struct {
+	dial        func(ctx context.Context) (Conn, error)
+	idleTimeout time.Duration
+
+	// slots holds one element per open connection, whether it is idle or in use.
+	slots chan struct{}
+	// idle holds the connections which are not currently in use.
+	idle chan idleConn
+
+	lock      sync.Mutex
+	idleTimer *time.Timer
+}
+
+func newConnectionPool(dial func(ctx context.Context) (Conn, error), maxConnections int, idleTimeout time.Duration) *connectionPool {
+	return &connectionPool{
+		dial:        dial,
+		idleTimeout: idleTimeout,
+		slots:       make(chan struct{}, maxConnections),
+		idle:        make(chan idleConn, maxConnections),
+	}
+}
+
+// withConn calls f with a pooled connection, and returns the connection to the pool afterwards. When f fails
+// with a network error on a connection which was reused from the pool, the connection might have been closed
+// by the server while it was idle, so f is tried once more with a new connection.
+func (p *connectionPool) withConn(ctx context.Context, f func(conn Conn) error) error {
+	conn, reused, err := p.get(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	err = f(conn)
+	if err != nil && reused && isNetworkError(err) {
+		p.discard(conn)
+		conn, _, err = p.get(ctx, false)
+		if err != nil {
+			return err
+		}
+		err = f(conn)
+	}
+
+	if err != nil && isNetworkError(err) {
+		p.discard(conn)
+	} else {
+		p.put(conn)
+	}
+	return err
+}
+
+// get returns an idle connection from the pool when one is available and allowReuse is true, or else dials
+// a new connection when the pool is not full, or else waits for a connection to be returned to the pool.
+func (p *connectionPool) get(ctx context.Context, allowReuse bool) (Conn, bool, error) {
+	for {
+		if allowReuse {
+			select {
+			case ic := <-p.idle:
+				if conn := p.checkHealth(ic); conn != nil {
+					return conn, true, nil
+				}
+				continue
+			default:
+			}
+		}
+
+		select {
+		case p.slots <- struct{}{}:
+			return p.dialNew(ctx)
+		default:
+		}
+
+		// The pool is full, so wait for a connection to be returned to the pool or to be closed.
+		select {
+		case ic := <-p.idle:
+			if !allowReuse {
+				// Make room for a new connection.
+				p.discard(ic.conn)
+				continue
+			}
+			if conn := p.checkHealth(ic); conn != nil {
+				return conn, true, nil
+			}
+		case p.slots <- struct{}{}:
+			return p.dialNew(ctx)
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// dialNew dials a new connection after a slot in the pool was reserved for it.
+func (p *connectionPool) dialNew(ctx context.Context) (Conn, bool, error) {
+	conn, err := p.dial(ctx)
+	if err != nil {
+		<-p.slots
+		return nil, false, err
+	}
+	return conn, false, nil
+}
+
+// checkHealth returns the connection if it can be reused, or else closes it and returns nil.
+func (p *connectionPool) checkHealth(ic idleConn) Conn {
+	if time.Since(ic.idleSince) >= p.idleTimeout {
+		p.discard(ic.conn)
+		return nil
+	}
+	// The underlying connection of an ldap.Conn is closed when the server closes it or when it has an error.
+	if closer, ok := ic.conn.(interface{ IsClosing() bool }); ok && closer.IsClosing() {
+		p.discard(ic.conn)
+		return nil
+	}
+	return ic.conn
+}
+
+// put returns a healthy connection to the pool.
+func (p *connectionPool) put(conn Conn) {
+	p.idle <- idleConn{conn: conn, idleSince: time.Now()}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.idleTimer == nil {
+		p.idleTimer = time.AfterFunc(p.idleTimeout, p.closeExpiredConns)
+	}
+}
+
+// discard closes a connection which was taken from the pool, making room for another connection.
+func (p *connectionPool) discard(conn Conn) {
+	conn.Close()
+	<-p.slots
+}
+
+// closeExpiredConns closes the idle connections which have reached the idle timeout, and schedules itself
+// to run again when any idle connections remain.
+func (p *connectionPool) closeExpiredConns() {
+	var oldestRemaining time.Time
+	for i := len(p.idle); i > 0; i-- {
+		var ic idleConn
+		select {
+		case ic = <-p.idle:
+		default:
+			// Another goroutine took the remaining idle connections.
+		}
+		if ic.conn == nil {
+			break
+		}
+		if time.Since(ic.idleSince) >= p.idleTimeout {
+			p.discard(ic.conn)
+			continue
+		}
+		p.idle <- ic
+		if oldestRemaining.IsZero() || ic.idleSince.Before(oldestRemaining) {
+			oldestRemaining = ic.idleSince
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.idleTimer = nil
+	if len(p.idle) > 0 {
+		next := p.idleTimeout
+		if !oldestRemaining.IsZero() {
+			next = time.Until(oldestRemaining.Add(p.idleTimeout))
+		}
+		p.idleTimer = time.AfterFunc(next, p.closeExpiredConns)
+	}
+}
+
+// closeIdleConns closes all connections which are currently idle.
+func (p *connectionPool) closeIdleConns() {
+	for {
+		select {
+		case ic := <-p.idle:
+			p.discard(ic.conn)
+		default:
+			return
+		}
+	}
+}
+
+func isNetworkError(err error) bool {
+	ldapErr := &ldap.Error{}
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.ErrorNetwork
+}
@@ -0,0 +1,209 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamldap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/mocks/mockldapconn"
+)
+
+func TestConnectionPool(t *testing.T) {
+	// newPool returns a pool which dials the given connections in order.
+	newPool := func(t *testing.T, maxConnections int, idleTimeout time.Duration, conns ...Conn) (*connectionPool, *int) {
+		dialCount := 0
+		pool := newConnectionPool(func(ctx context.Context) (Conn, error) {
+			require.Less(t, dialCount, len(conns), "dialed too many connections")
+			conn := conns[dialCount]
+			dialCount++
+			return conn, nil
+		}, maxConnections, idleTimeout)
+		return pool, &dialCount
+	}
+
+	networkErr := fmt.Errorf("some wrapped error: %w", ldap.NewError(ldap.ErrorNetwork, errors.New("connection reset")))
+
+	t.Run("reuses idle connections", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		conn := mockldapconn.NewMockConn(ctrl)
+		pool, dialCount := newPool(t, 2, time.Minute, conn)
+
+		for i := 0; i < 3; i++ {
+			err := pool.withConn(context.Background(), func(c Conn) error {
+				require.Same(t, conn, c)
+				return nil
+			})
+			require.NoError(t, err)
+		}
+		require.Equal(t, 1, *dialCount)
+
+		conn.EXPECT().Close().Times(1)
+		pool.closeIdleConns()
+		ctrl.Finish()
+	})
+
+	t.Run("keeps connections after errors which are not network errors", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		conn := mockldapconn.NewMockConn(ctrl)
+		pool, dialCount := newPool(t, 2, time.Minute, conn)
+
+		err := pool.withConn(context.Background(), func(c Conn) error { return errors.New("some search error") })
+		require.EqualError(t, err, "some search error")
+		err = pool.withConn(context.Background(), func(c Conn) error { return nil })
+		require.NoError(t, err)
+		require.Equal(t, 1, *dialCount)
+
+		conn.EXPECT().Close().Times(1)
+		pool.closeIdleConns()
+		ctrl.Finish()
+	})
+
+	t.Run("closes new connections after network errors without retrying", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		conn := mockldapconn.NewMockConn(ctrl)
+		conn.EXPECT().Close().Times(1)
+		pool, dialCount := newPool(t, 2, time.Minute, conn)
+
+		calls := 0
+		err := pool.withConn(context.Background(), func(c Conn) error {
+			calls++
+			return networkErr
+		})
+		require.Equal(t, networkErr, err)
+		require.Equal(t, 1, calls)
+		require.Equal(t, 1, *dialCount)
+		require.Empty(t, pool.slots)
+		ctrl.Finish()
+	})
+
+	t.Run("retries with a new connection after a network error on a reused connection", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		staleConn := mockldapconn.NewMockConn(ctrl)
+		newConn := mockldapconn.NewMockConn(ctrl)
+		pool, dialCount := newPool(t, 2, time.Minute, staleConn, newConn)
+
+		err := pool.withConn(context.Background(), func(c Conn) error { return nil })
+		require.NoError(t, err)
+
+		staleConn.EXPECT().Close().Times(1)
+		var usedConns []Conn
+		err = pool.withConn(context.Background(), func(c Conn) error {
+			usedConns = append(usedConns, c)
+			if c == staleConn {
+				return networkErr
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []Conn{staleConn, newConn}, usedConns)
+		require.Equal(t, 2, *dialCount)
+
+		newConn.EXPECT().Close().Times(1)
+		pool.closeIdleConns()
+		require.Empty(t, pool.slots)
+		ctrl.Finish()
+	})
+
+	t.Run("closes idle connections which have reached the idle timeout instead of reusing them", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		expiredConn := mockldapconn.NewMockConn(ctrl)
+		newConn := mockldapconn.NewMockConn(ctrl)
+		pool, dialCount := newPool(t, 2, time.Minute, expiredConn, newConn)
+
+		err := pool.withConn(context.Background(), func(c Conn) error { return nil })
+		require.NoError(t, err)
+
+		// Pretend that the connection has been idle for longer than the idle timeout.
+		ic := <-pool.idle
+		ic.idleSince = time.Now().Add(-2 * time.Minute)
+		pool.idle <- ic
+
+		expiredConn.EXPECT().Close().Times(1)
+		err = pool.withConn(context.Background(), func(c Conn) error {
+			require.Same(t, newConn, c)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, *dialCount)
+
+		newConn.EXPECT().Close().Times(1)
+		pool.closeIdleConns()
+		ctrl.Finish()
+	})
+
+	t.Run("the idle timer closes idle connections", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		conn := mockldapconn.NewMockConn(ctrl)
+		closed := make(chan struct{})
+		conn.EXPECT().Close().Do(func() { close(closed) }).Times(1)
+		pool, _ := newPool(t, 2, 10*time.Millisecond, conn)
+
+		err := pool.withConn(context.Background(), func(c Conn) error { return nil })
+		require.NoError(t, err)
+
+		select {
+		case <-closed:
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "idle connection was not closed")
+		}
+		require.Eventually(t, func() bool { return len(pool.slots) == 0 }, 10*time.Second, 10*time.Millisecond)
+		ctrl.Finish()
+	})
+
+	t.Run("waits for a connection when the pool is full", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		conn := mockldapconn.NewMockConn(ctrl)
+		pool, dialCount := newPool(t, 1, time.Minute, conn)
+
+		inUse, reused, err := pool.get(context.Background(), true)
+		require.NoError(t, err)
+		require.False(t, reused)
+
+		// The pool is full, so this times out.
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, _, err = pool.get(ctx, true)
+		require.Equal(t, context.DeadlineExceeded, err)
+
+		// This gets the connection after it is returned to the pool.
+		gotConn := make(chan Conn)
+		gotErr := make(chan error)
+		go func() {
+			c, _, err := pool.get(context.Background(), true)
+			gotConn <- c
+			gotErr <- err
+		}()
+		pool.put(inUse)
+		require.Same(t, conn, <-gotConn)
+		require.NoError(t, <-gotErr)
+		require.Equal(t, 1, *dialCount)
+
+		conn.EXPECT().Close().Times(1)
+		pool.discard(conn)
+		ctrl.Finish()
+	})
+
+	t.Run("dial errors release the slot", func(t *testing.T) {
+		pool := newConnectionPool(func(ctx context.Context) (Conn, error) {
+			return nil, errors.New("some dial error")
+		}, 1, time.Minute)
+
+		for i := 0; i < 2; i++ {
+			err := pool.withConn(context.Background(), func(c Conn) error {
+				require.FailNow(t, "should not have been called")
+				return nil
+			})
+			require.EqualError(t, err, "some dial error")
+		}
+		require.Empty(t, pool.slots)
+	})
+}
@@ -13,10 +13,15 @@ import (
 	"fmt"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-ldap/ldap/v3"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/authentication/user"
@@ -33,16 +38,32 @@ import (
 const (
 	ldapsScheme                             = "ldaps"
 	distinguishedNameAttributeName          = "dn"
+	tokenGroupsAttributeName                = "tokenGroups"
+	objectSIDAttributeName                  = "objectSid"
 	searchFilterInterpolationLocationMarker = "{}"
 	groupSearchPageSize                     = uint32(250)
 	defaultLDAPPort                         = uint16(389)
 	defaultLDAPSPort                        = uint16(636)
+
+	// The maximum number of levels of nested groups which are resolved, which limits the number of searches.
+	maxNestedGroupDepth = 10
+	// The maximum number of groups whose containing groups are searched for at once.
+	nestedGroupSearchBatchSize = 50
+	// The maximum number of SIDs from a user's tokenGroups which are searched for at once. Typical users
+	// belong to fewer groups than this, so their groups are found using a single search.
+	tokenGroupsSearchBatchSize = 500
 )
 
+// The key in the ExtraRefreshAttributes under which the value of the GroupSearch.UserAttributeForFilter
+// is remembered, so the same value can be used in the group search filter during refreshes.
+const groupSearchUserAttributeForFilterRefreshKey = "groupSearchUserAttributeForFilter"
+
 // Conn abstracts the upstream LDAP communication protocol (mostly for testing).
 type Conn interface {
 	Bind(username, password string) error
 
+	ExternalBind() error
+
 	Search(searchRequest *ldap.SearchRequest) (*ldap.SearchResult, error)
 
 	SearchWithPaging(searchRequest *ldap.SearchRequest, pagingSize uint32) (*ldap.SearchResult, error)
@@ -85,9 +106,30 @@ type ProviderConfig struct {
 	ResourceUID types.UID
 
 	// Host is the hostname or "hostname:port" of the LDAP server. When the port is not specified,
-	// the default LDAP port will be used.
+	// the default LDAP port will be used. It is also used in the URL which identifies this provider,
+	// regardless of which server was used.
 	Host string
 
+	// AdditionalHosts are other LDAP servers with the same users and groups, in the same format as Host.
+	// They are tried in order when the Host cannot be reached.
+	AdditionalHosts []string
+
+	// SRVDomain, when not empty, is a DNS domain whose "_ldap._tcp" SRV records are looked up to discover more
+	// LDAP servers, which are tried when the Host and the AdditionalHosts cannot be reached.
+	SRVDomain string
+
+	// LookupSRV exists to enable testing. When nil, will use net.DefaultResolver.LookupSRV.
+	LookupSRV func(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+
+	// HostHealth remembers which hosts recently could not be reached, so they can be tried last. It can be shared
+	// between Providers for the same hosts. When nil, the Provider will remember the health of the hosts by itself.
+	HostHealth *HostHealth
+
+	// GroupCache remembers the groups which were found for each user when GroupSearch.CacheTTL is greater than
+	// zero. It can be shared between Providers with the same group search settings. When nil, the Provider will
+	// remember the groups by itself.
+	GroupCache *GroupCache
+
 	// ConnectionProtocol determines how to establish the connection to the server. Either StartTLS or TLS.
 	ConnectionProtocol LDAPConnectionProtocol
 
@@ -100,6 +142,10 @@ type ProviderConfig struct {
 	// BindPassword is the password to use when performing a bind with the upstream LDAP IDP.
 	BindPassword string
 
+	// BindClientCertificate, when not nil, is presented as the client certificate during the TLS handshake, and
+	// the bind is performed using SASL EXTERNAL instead of using the BindUsername and BindPassword.
+	BindClientCertificate *tls.Certificate
+
 	// UserSearch contains information about how to search for users in the upstream LDAP IDP.
 	UserSearch UserSearchConfig
 
@@ -119,6 +165,15 @@ type ProviderConfig struct {
 
 	// RefreshAttributeChecks are extra checks that attributes in a refresh response are as expected.
 	RefreshAttributeChecks map[string]func(*ldap.Entry, provider.StoredRefreshAttributes) error
+
+	// KerberosKeytab holds the keys of the Supervisor's Kerberos service principal, which are used to validate
+	// the Kerberos tickets of users who log in using SPNEGO. Nil means that Kerberos logins are not allowed.
+	KerberosKeytab *keytab.Keytab
+
+	// KerberosServicePrincipalName is the name of the service principal whose key from the KerberosKeytab
+	// should be used to validate tickets, e.g. "HTTP/supervisor.example.com". Empty means to use the key of
+	// whichever principal the ticket was issued for, as long as that principal is in the KerberosKeytab.
+	KerberosServicePrincipalName string
 }
 
 // UserSearchConfig contains information about how to search for users in the upstream LDAP IDP.
@@ -147,6 +202,10 @@ type GroupSearchConfig struct {
 	// Filter is the filter to use for the group search in the upstream LDAP IDP. Empty means to use `member={}`.
 	Filter string
 
+	// UserAttributeForFilter is the attribute of the user's entry whose value should replace the "{}" in the
+	// Filter. Empty means to use the user's DN.
+	UserAttributeForFilter string
+
 	// GroupNameAttribute is the attribute in the LDAP group entry from which the group name should be
 	// retrieved. Empty means to use 'cn'.
 	GroupNameAttribute string
@@ -155,19 +214,52 @@ type GroupSearchConfig struct {
 	// (every 5 minutes). This can be done if group search is very slow or resource intensive for the LDAP
 	// server.
 	SkipGroupRefresh bool
+
+	// ResolveNestedGroups causes the groups which contain the user's groups to be searched for transitively,
+	// by applying the Filter to the DNs of the groups which were found, up to maxNestedGroupDepth levels deep.
+	ResolveNestedGroups bool
+
+	// CacheTTL, when greater than zero, is how long the groups which were found for a user are reused during
+	// refreshes before searching for the user's groups again. The groups are always searched for during logins.
+	CacheTTL time.Duration
+
+	// UseTokenGroups causes the user's groups to be found by searching for the groups whose objectSid is one of the
+	// SIDs in the user's tokenGroups attribute, which Active Directory computes to include the SIDs of all of the
+	// user's security groups, including nested groups. When true, Filter and ResolveNestedGroups are ignored.
+	UseTokenGroups bool
 }
 
 type Provider struct {
 	c ProviderConfig
+
+	// pool holds connections which are bound as the service account, for performing searches.
+	pool *connectionPool
+
+	hostHealth *HostHealth
+
+	// groupCache is nil when the groups should not be cached.
+	groupCache *GroupCache
 }
 
 var _ provider.UpstreamLDAPIdentityProviderI = &Provider{}
+var _ provider.UpstreamKerberosIdentityProviderI = &Provider{}
 var _ authenticators.UserAuthenticator = &Provider{}
 
 // Create a Provider. The config is not a pointer to ensure that a copy of the config is created,
 // making the resulting Provider use an effectively read-only configuration.
 func New(config ProviderConfig) *Provider {
-	return &Provider{c: config}
+	p := &Provider{c: config, hostHealth: config.HostHealth}
+	if p.hostHealth == nil {
+		p.hostHealth = NewHostHealth()
+	}
+	if config.GroupSearch.CacheTTL > 0 {
+		p.groupCache = config.GroupCache
+		if p.groupCache == nil {
+			p.groupCache = NewGroupCache()
+		}
+	}
+	p.pool = newConnectionPool(p.dialAndBindServiceAccount, maxPooledConnections, pooledConnectionIdleTimeout)
+	return p
 }
 
 // A reader for the config. Returns a copy of the config to keep the underlying config read-only.
@@ -178,18 +270,21 @@ func (p *Provider) GetConfig() ProviderConfig {
 func (p *Provider) PerformRefresh(ctx context.Context, storedRefreshAttributes provider.StoredRefreshAttributes) ([]string, error) {
 	t := trace.FromContext(ctx).Nest("slow ldap refresh attempt", trace.Field{Key: "providerName", Value: p.GetName()})
 	defer t.LogIfLong(500 * time.Millisecond) // to help users debug slow LDAP searches
-	userDN := storedRefreshAttributes.DN
 
-	conn, err := p.dial(ctx)
+	var groups []string
+	err := p.pool.withConn(ctx, func(conn Conn) error {
+		var refreshErr error
+		groups, refreshErr = p.performRefreshWithConn(t, conn, storedRefreshAttributes)
+		return refreshErr
+	})
 	if err != nil {
-		return nil, fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return nil, err
 	}
-	defer conn.Close()
+	return groups, nil
+}
 
-	err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
-	if err != nil {
-		return nil, fmt.Errorf(`error binding as %q before user search: %w`, p.c.BindUsername, err)
-	}
+func (p *Provider) performRefreshWithConn(t *trace.Trace, conn Conn, storedRefreshAttributes provider.StoredRefreshAttributes) ([]string, error) {
+	userDN := storedRefreshAttributes.DN
 
 	searchResult, err := p.performUserRefreshSearch(conn, userDN)
 	if err != nil {
@@ -239,13 +334,36 @@ func (p *Provider) PerformRefresh(ctx context.Context, storedRefreshAttributes p
 		return storedRefreshAttributes.Groups, nil
 	}
 
-	mappedGroupNames, err := p.searchGroupsForUserDN(conn, userDN)
+	if p.groupCache != nil {
+		if cachedGroups, found := p.groupCache.get(userDN); found {
+			return cachedGroups, nil
+		}
+	}
+
+	groupSearchUserAttributeValue, found := storedRefreshAttributes.AdditionalAttributes[groupSearchUserAttributeForFilterRefreshKey]
+	if !found {
+		// Sessions which started before the UserAttributeForFilter was configured do not have a stored value.
+		groupSearchUserAttributeValue, err = p.groupSearchUserAttributeValue(userEntry, userDN)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	mappedGroupNames, err := p.searchGroupsForUserDN(conn, userDN, groupSearchUserAttributeValue)
 	if err != nil {
 		return nil, err
 	}
+	p.cacheGroups(userDN, mappedGroupNames)
 	return mappedGroupNames, nil
 }
 
+// cacheGroups remembers the user's groups for use during refreshes, when the groups should be cached.
+func (p *Provider) cacheGroups(userDN string, groups []string) {
+	if p.groupCache != nil {
+		p.groupCache.put(userDN, groups, p.c.GroupSearch.CacheTTL)
+	}
+}
+
 func (p *Provider) performUserRefreshSearch(conn Conn, userDN string) (*ldap.SearchResult, error) {
 	search := p.refreshUserSearchRequest(userDN)
 
@@ -257,37 +375,48 @@ func (p *Provider) performUserRefreshSearch(conn Conn, userDN string) (*ldap.Sea
 	return searchResult, nil
 }
 
-func (p *Provider) dial(ctx context.Context) (Conn, error) {
-	tlsAddr, err := endpointaddr.Parse(p.c.Host, defaultLDAPSPort)
+// dialAndBindServiceAccount dials a new connection and binds it as the service account, for the connection pool.
+func (p *Provider) dialAndBindServiceAccount(ctx context.Context) (Conn, error) {
+	conn, err := p.dial(ctx)
 	if err != nil {
-		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+		return nil, err
 	}
 
-	startTLSAddr, err := endpointaddr.Parse(p.c.Host, defaultLDAPPort)
+	err = p.bindAsServiceAccount(conn)
 	if err != nil {
-		return nil, ldap.NewError(ldap.ErrorNetwork, err)
+		conn.Close()
+		return nil, fmt.Errorf(`error binding as %s before user search: %w`, p.serviceAccountDescription(), err)
 	}
 
-	// Choose how and where to dial based on TLS vs. StartTLS config option.
-	var dialFunc LDAPDialerFunc
-	var addr endpointaddr.HostPort
-	switch {
-	case p.c.ConnectionProtocol == TLS:
-		dialFunc = p.dialTLS
-		addr = tlsAddr
-	case p.c.ConnectionProtocol == StartTLS:
-		dialFunc = p.dialStartTLS
-		addr = startTLSAddr
-	default:
-		return nil, ldap.NewError(ldap.ErrorNetwork, fmt.Errorf("did not specify valid ConnectionProtocol"))
+	return conn, nil
+}
+
+// bindAsServiceAccount binds the connection as the service account, either using SASL EXTERNAL when a client
+// certificate is configured, or using a simple bind with the BindUsername and BindPassword.
+func (p *Provider) bindAsServiceAccount(conn Conn) error {
+	if p.c.BindClientCertificate != nil {
+		return conn.ExternalBind()
 	}
+	return conn.Bind(p.c.BindUsername, p.c.BindPassword)
+}
 
-	// Override the real dialer for testing purposes sometimes.
-	if p.c.Dialer != nil {
-		dialFunc = p.c.Dialer.Dial
+// serviceAccountDescription describes the service account for error messages.
+func (p *Provider) serviceAccountDescription() string {
+	if p.c.BindClientCertificate == nil {
+		return strconv.Quote(p.c.BindUsername)
 	}
+	if len(p.c.BindClientCertificate.Certificate) > 0 {
+		if cert, err := x509.ParseCertificate(p.c.BindClientCertificate.Certificate[0]); err == nil {
+			return fmt.Sprintf("client certificate with subject %q using SASL EXTERNAL", cert.Subject.String())
+		}
+	}
+	return "client certificate using SASL EXTERNAL"
+}
 
-	return dialFunc(ctx, addr)
+// CloseIdleConnections closes the pooled connections which are not currently in use. It should be called when this
+// Provider is no longer going to be used. Connections which are in use will be closed by the idle timeout instead.
+func (p *Provider) CloseIdleConnections() {
+	p.pool.closeIdleConns()
 }
 
 // dialTLS is a default implementation of the Dialer, used when Dialer is nil and ConnectionProtocol is TLS.
@@ -349,7 +478,11 @@ func (p *Provider) tlsConfig() (*tls.Config, error) {
 			return nil, fmt.Errorf("could not parse CA bundle")
 		}
 	}
-	return ptls.DefaultLDAP(rootCAs), nil
+	tlsConfig := ptls.DefaultLDAP(rootCAs)
+	if p.c.BindClientCertificate != nil {
+		tlsConfig.Certificates = []tls.Certificate{*p.c.BindClientCertificate}
+	}
+	return tlsConfig, nil
 }
 
 // A name for this upstream provider.
@@ -382,13 +515,13 @@ func (p *Provider) TestConnection(ctx context.Context) error {
 
 	conn, err := p.dial(ctx)
 	if err != nil {
-		return fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return err
 	}
 	defer conn.Close()
 
-	err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
+	err = p.bindAsServiceAccount(conn)
 	if err != nil {
-		return fmt.Errorf(`error binding as %q: %w`, p.c.BindUsername, err)
+		return fmt.Errorf(`error binding as %s: %w`, p.serviceAccountDescription(), err)
 	}
 
 	return nil
@@ -399,7 +532,7 @@ func (p *Provider) TestConnection(ctx context.Context) error {
 // not bind as that user, so it does not test their password. It returns the same values that a real call to
 // AuthenticateUser with the correct password would return.
 func (p *Provider) DryRunAuthenticateUser(ctx context.Context, username string) (*authenticators.Response, bool, error) {
-	endUserBindFunc := func(conn Conn, foundUserDN string) error {
+	endUserBindFunc := func(ctx context.Context, foundUserDN string) error {
 		// Act as if the end user bind always succeeds.
 		return nil
 	}
@@ -408,13 +541,103 @@ func (p *Provider) DryRunAuthenticateUser(ctx context.Context, username string)
 
 // Authenticate an end user and return their mapped username, groups, and UID. Implements authenticators.UserAuthenticator.
 func (p *Provider) AuthenticateUser(ctx context.Context, username, password string) (*authenticators.Response, bool, error) {
-	endUserBindFunc := func(conn Conn, foundUserDN string) error {
-		return conn.Bind(foundUserDN, password)
+	endUserBindFunc := func(ctx context.Context, foundUserDN string) error {
+		return p.bindAsEndUser(ctx, foundUserDN, password)
 	}
 	return p.authenticateUserImpl(ctx, username, endUserBindFunc)
 }
 
-func (p *Provider) authenticateUserImpl(ctx context.Context, username string, bindFunc func(conn Conn, foundUserDN string) error) (*authenticators.Response, bool, error) {
+// bindAsEndUser checks the end user's password by binding as them on a new connection, which is closed
+// afterwards. The pooled connections are never bound as end users, so they always remain bound as the
+// service account.
+func (p *Provider) bindAsEndUser(ctx context.Context, userDN, password string) error {
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Bind(userDN, password)
+}
+
+// AllowsKerberos returns true when users may authenticate using Kerberos tickets.
+func (p *Provider) AllowsKerberos() bool {
+	return p.c.KerberosKeytab != nil
+}
+
+// AuthenticateKerberosUser validates the Kerberos ticket in a SPNEGO token, such as the token sent by a client
+// on an "Authorization: Negotiate" header, and then searches for the user and their groups in the same way as
+// AuthenticateUser. It does not bind as the user, since the ticket has already proven the user's identity.
+// Returns false when the ticket is not valid.
+func (p *Provider) AuthenticateKerberosUser(ctx context.Context, negotiateToken []byte) (*authenticators.Response, bool, error) {
+	if !p.AllowsKerberos() {
+		return nil, false, fmt.Errorf("kerberos logins are not allowed by this provider")
+	}
+
+	username, err := p.validateKerberosTicket(negotiateToken)
+	if err != nil {
+		plog.DebugErr("error validating kerberos ticket", err, "upstreamName", p.GetName())
+		return nil, false, nil
+	}
+
+	endUserBindFunc := func(ctx context.Context, foundUserDN string) error {
+		// The user already proved their identity with their ticket, so there is no need to bind as them.
+		return nil
+	}
+	return p.authenticateUserImpl(ctx, username, endUserBindFunc)
+}
+
+// validateKerberosTicket validates the AP-REQ in a SPNEGO token using the configured keytab, and returns the
+// username of the client principal without its realm.
+func (p *Provider) validateKerberosTicket(negotiateToken []byte) (string, error) {
+	var spnegoToken spnego.SPNEGOToken
+	if err := spnegoToken.Unmarshal(negotiateToken); err != nil {
+		return "", fmt.Errorf("could not parse SPNEGO token: %w", err)
+	}
+	if !spnegoToken.Init || len(spnegoToken.NegTokenInit.MechTypes) == 0 {
+		return "", fmt.Errorf("SPNEGO token is not an initial token")
+	}
+	mechType := spnegoToken.NegTokenInit.MechTypes[0]
+	if !mechType.Equal(gssapi.OIDKRB5.OID()) && !mechType.Equal(gssapi.OIDMSLegacyKRB5.OID()) {
+		return "", fmt.Errorf("SPNEGO token uses unsupported mechanism %s", mechType.String())
+	}
+
+	var krb5Token spnego.KRB5Token
+	if err := krb5Token.Unmarshal(spnegoToken.NegTokenInit.MechTokenBytes); err != nil {
+		return "", fmt.Errorf("could not parse Kerberos token: %w", err)
+	}
+	if !krb5Token.IsAPReq() {
+		return "", fmt.Errorf("kerberos token does not contain an AP-REQ")
+	}
+
+	// The PAC is not needed because groups are always looked up using the group search.
+	settings := []func(*service.Settings){service.DecodePAC(false)}
+	if p.c.KerberosServicePrincipalName != "" {
+		settings = append(settings, service.KeytabPrincipal(p.c.KerberosServicePrincipalName))
+	}
+	valid, _, err := service.VerifyAPREQ(&krb5Token.APReq, service.NewSettings(p.c.KerberosKeytab, settings...))
+	if err != nil {
+		return "", fmt.Errorf("invalid kerberos ticket: %w", err)
+	}
+	if !valid {
+		return "", fmt.Errorf("invalid kerberos ticket")
+	}
+
+	// Read the client's identity from the decrypted ticket, which was asserted by the KDC, rather than from the
+	// authenticator, which was created by the client.
+	ticket := krb5Token.APReq.Ticket
+	clientRealm := ticket.DecryptedEncPart.CRealm
+
+	// The user search is performed using the username without the realm, so only accept users from the realm of
+	// the service principal. Otherwise, a user from a trusted realm could log in as a user of the same name.
+	if !strings.EqualFold(clientRealm, ticket.Realm) {
+		return "", fmt.Errorf("client realm %q does not match service realm %q", clientRealm, ticket.Realm)
+	}
+
+	return ticket.DecryptedEncPart.CName.PrincipalNameString(), nil
+}
+
+func (p *Provider) authenticateUserImpl(ctx context.Context, username string, bindFunc func(ctx context.Context, foundUserDN string) error) (*authenticators.Response, bool, error) {
 	t := trace.FromContext(ctx).Nest("slow ldap authenticate user attempt", trace.Field{Key: "providerName", Value: p.GetName()})
 	defer t.LogIfLong(500 * time.Millisecond) // to help users debug slow LDAP searches
 
@@ -430,42 +653,66 @@ func (p *Provider) authenticateUserImpl(ctx context.Context, username string, bi
 		return nil, false, nil
 	}
 
-	conn, err := p.dial(ctx)
+	var response *authenticators.Response
+	err = p.pool.withConn(ctx, func(conn Conn) error {
+		var searchErr error
+		response, searchErr = p.searchForUser(conn, username)
+		return searchErr
+	})
 	if err != nil {
 		p.traceAuthFailure(t, err)
-		return nil, false, fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return nil, false, err
 	}
-	defer conn.Close()
-
-	err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
-	if err != nil {
-		p.traceAuthFailure(t, err)
-		return nil, false, fmt.Errorf(`error binding as %q before user search: %w`, p.c.BindUsername, err)
+	if response == nil {
+		p.traceAuthFailure(t, fmt.Errorf("bad username or password"))
+		return nil, false, nil
 	}
 
-	response, err := p.searchAndBindUser(conn, username, bindFunc)
+	authenticated, err := p.bindUser(ctx, username, response.DN, bindFunc)
 	if err != nil {
 		p.traceAuthFailure(t, err)
 		return nil, false, err
 	}
-	if response == nil {
+	if !authenticated {
 		p.traceAuthFailure(t, fmt.Errorf("bad username or password"))
 		return nil, false, nil
 	}
+	// Only remember the groups once the password was confirmed, so failed logins cannot fill the cache.
+	p.cacheGroups(response.DN, response.User.GetGroups())
 
 	p.traceAuthSuccess(t)
 	return response, true, nil
 }
 
-func (p *Provider) searchGroupsForUserDN(conn Conn, userDN string) ([]string, error) {
+// searchGroupsForUserDN searches for the groups of the user with the given DN. The groupSearchUserAttributeValue is
+// the value of the user's GroupSearch.UserAttributeForFilter, which is only used when that attribute is configured.
+func (p *Provider) searchGroupsForUserDN(conn Conn, userDN string, groupSearchUserAttributeValue string) ([]string, error) {
 	// If we do not have group search configured, skip this search.
 	if len(p.c.GroupSearch.Base) == 0 {
 		return []string{}, nil
 	}
 
-	searchResult, err := conn.SearchWithPaging(p.groupSearchRequest(userDN), groupSearchPageSize)
+	var groupEntries []*ldap.Entry
+	var err error
+	if p.c.GroupSearch.UseTokenGroups {
+		groupEntries, err = p.searchGroupEntriesUsingTokenGroups(conn, userDN)
+	} else {
+		filterValue := userDN
+		if p.usesGroupSearchUserAttributeForFilter() {
+			filterValue = ldap.EscapeFilter(groupSearchUserAttributeValue)
+		}
+		groupEntries, err = p.searchGroupEntries(conn, userDN, p.groupSearchFilter(filterValue))
+	}
 	if err != nil {
-		return nil, fmt.Errorf(`error searching for group memberships for user with DN %q: %w`, userDN, err)
+		return nil, err
+	}
+
+	if p.c.GroupSearch.ResolveNestedGroups && !p.c.GroupSearch.UseTokenGroups {
+		nestedGroupEntries, err := p.searchNestedGroupEntries(conn, userDN, groupEntries)
+		if err != nil {
+			return nil, err
+		}
+		groupEntries = append(groupEntries, nestedGroupEntries...)
 	}
 
 	groupAttributeName := p.c.GroupSearch.GroupNameAttribute
@@ -475,10 +722,7 @@ func (p *Provider) searchGroupsForUserDN(conn Conn, userDN string) ([]string, er
 
 	groups := []string{}
 entries:
-	for _, groupEntry := range searchResult.Entries {
-		if len(groupEntry.DN) == 0 {
-			return nil, fmt.Errorf(`searching for group memberships for user with DN %q resulted in search result without DN`, userDN)
-		}
+	for _, groupEntry := range groupEntries {
 		if overrideFunc := p.c.GroupAttributeParsingOverrides[groupAttributeName]; overrideFunc != nil {
 			overrideGroupName, err := overrideFunc(groupEntry)
 			if err != nil {
@@ -499,6 +743,122 @@ entries:
 	return sets.NewString(groups...).List(), nil
 }
 
+// searchGroupEntries performs a group search using the given filter, on behalf of the user with the given DN.
+func (p *Provider) searchGroupEntries(conn Conn, userDN string, filter string) ([]*ldap.Entry, error) {
+	searchResult, err := conn.SearchWithPaging(p.groupSearchRequest(filter), groupSearchPageSize)
+	if err != nil {
+		return nil, fmt.Errorf(`error searching for group memberships for user with DN %q: %w`, userDN, err)
+	}
+
+	for _, groupEntry := range searchResult.Entries {
+		if len(groupEntry.DN) == 0 {
+			return nil, fmt.Errorf(`searching for group memberships for user with DN %q resulted in search result without DN`, userDN)
+		}
+	}
+	return searchResult.Entries, nil
+}
+
+// searchGroupEntriesUsingTokenGroups reads the SIDs from the tokenGroups attribute of the user's entry, and then
+// searches for the groups which have those SIDs. This avoids asking the server to evaluate a membership filter
+// against every group, which can be slow in large Active Directory forests.
+func (p *Provider) searchGroupEntriesUsingTokenGroups(conn Conn, userDN string) ([]*ldap.Entry, error) {
+	searchResult, err := conn.Search(p.tokenGroupsSearchRequest(userDN))
+	if err != nil {
+		return nil, fmt.Errorf(`error searching for group memberships for user with DN %q: %w`, userDN, err)
+	}
+	if len(searchResult.Entries) != 1 {
+		return nil, fmt.Errorf(`searching for the %s of user with DN %q resulted in %d search results, but expected 1 result`,
+			tokenGroupsAttributeName, userDN, len(searchResult.Entries))
+	}
+
+	sids := searchResult.Entries[0].GetRawAttributeValues(tokenGroupsAttributeName)
+	groupEntries := []*ldap.Entry{}
+	for len(sids) > 0 {
+		batch := sids
+		if len(batch) > tokenGroupsSearchBatchSize {
+			batch = batch[:tokenGroupsSearchBatchSize]
+		}
+		sids = sids[len(batch):]
+
+		entries, err := p.searchGroupEntries(conn, userDN, objectSIDSearchFilter(batch))
+		if err != nil {
+			return nil, err
+		}
+		groupEntries = append(groupEntries, entries...)
+	}
+	return groupEntries, nil
+}
+
+// searchNestedGroupEntries searches for the groups which contain the given groups, then for the groups which contain
+// those groups, and so on, one level of nesting at a time. Each group is only searched for once, which prevents
+// cycles in the group memberships from causing endless searches.
+func (p *Provider) searchNestedGroupEntries(conn Conn, userDN string, groupEntries []*ldap.Entry) ([]*ldap.Entry, error) {
+	seenGroupDNs := sets.NewString()
+	var groupDNsToSearch []string
+	for _, groupEntry := range groupEntries {
+		if !seenGroupDNs.Has(normalizeDN(groupEntry.DN)) {
+			seenGroupDNs.Insert(normalizeDN(groupEntry.DN))
+			groupDNsToSearch = append(groupDNsToSearch, groupEntry.DN)
+		}
+	}
+
+	var nestedGroupEntries []*ldap.Entry
+	for depth := 1; len(groupDNsToSearch) > 0; depth++ {
+		if depth > maxNestedGroupDepth {
+			plog.Warning("stopped resolving nested groups because the maximum depth was reached",
+				"upstreamName", p.GetName(), "userDN", userDN, "maxDepth", maxNestedGroupDepth)
+			break
+		}
+
+		var nextGroupDNsToSearch []string
+		for len(groupDNsToSearch) > 0 {
+			batch := groupDNsToSearch
+			if len(batch) > nestedGroupSearchBatchSize {
+				batch = batch[:nestedGroupSearchBatchSize]
+			}
+			groupDNsToSearch = groupDNsToSearch[len(batch):]
+
+			entries, err := p.searchGroupEntries(conn, userDN, p.nestedGroupSearchFilter(batch))
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if seenGroupDNs.Has(normalizeDN(entry.DN)) {
+					continue
+				}
+				seenGroupDNs.Insert(normalizeDN(entry.DN))
+				nestedGroupEntries = append(nestedGroupEntries, entry)
+				nextGroupDNsToSearch = append(nextGroupDNsToSearch, entry.DN)
+			}
+		}
+		groupDNsToSearch = nextGroupDNsToSearch
+	}
+
+	return nestedGroupEntries, nil
+}
+
+// usesGroupSearchUserAttributeForFilter returns true when the group search filter should use the value of an attribute
+// of the user's entry instead of the user's DN.
+func (p *Provider) usesGroupSearchUserAttributeForFilter() bool {
+	attribute := p.c.GroupSearch.UserAttributeForFilter
+	return len(p.c.GroupSearch.Base) != 0 && attribute != "" && attribute != distinguishedNameAttributeName
+}
+
+// groupSearchUserAttributeValue returns the value of the GroupSearch.UserAttributeForFilter from the user's entry,
+// or an empty string when that attribute is not used.
+func (p *Provider) groupSearchUserAttributeValue(userEntry *ldap.Entry, username string) (string, error) {
+	if !p.usesGroupSearchUserAttributeForFilter() {
+		return "", nil
+	}
+	return p.getSearchResultAttributeValue(p.c.GroupSearch.UserAttributeForFilter, userEntry, username)
+}
+
+// normalizeDN returns a form of the DN for comparisons. Attribute names and most attribute values in DNs are
+// case-insensitive, so this is good enough to detect the same group being found twice.
+func normalizeDN(dn string) string {
+	return strings.ToLower(dn)
+}
+
 func (p *Provider) validateConfig() error {
 	if p.c.UserSearch.UsernameAttribute == distinguishedNameAttributeName && len(p.c.UserSearch.Filter) == 0 {
 		// LDAP search filters do not allow searching by DN, so we would have no reasonable default for Filter.
@@ -514,14 +874,14 @@ func (p *Provider) SearchForDefaultNamingContext(ctx context.Context) (string, e
 	conn, err := p.dial(ctx)
 	if err != nil {
 		p.traceSearchBaseDiscoveryFailure(t, err)
-		return "", fmt.Errorf(`error dialing host %q: %w`, p.c.Host, err)
+		return "", err
 	}
 	defer conn.Close()
 
-	err = conn.Bind(p.c.BindUsername, p.c.BindPassword)
+	err = p.bindAsServiceAccount(conn)
 	if err != nil {
 		p.traceSearchBaseDiscoveryFailure(t, err)
-		return "", fmt.Errorf(`error binding as %q before querying for defaultNamingContext: %w`, p.c.BindUsername, err)
+		return "", fmt.Errorf(`error binding as %s before querying for defaultNamingContext: %w`, p.serviceAccountDescription(), err)
 	}
 
 	searchResult, err := conn.Search(p.defaultNamingContextRequest())
@@ -540,7 +900,8 @@ func (p *Provider) SearchForDefaultNamingContext(ctx context.Context) (string, e
 	return searchBase, nil
 }
 
-func (p *Provider) searchAndBindUser(conn Conn, username string, bindFunc func(conn Conn, foundUserDN string) error) (*authenticators.Response, error) {
+// searchForUser searches for the user and their groups, returning nil when the user is not found.
+func (p *Provider) searchForUser(conn Conn, username string) (*authenticators.Response, error) {
 	searchResult, err := conn.Search(p.userSearchRequest(username))
 	if err != nil {
 		plog.All(`error searching for user`,
@@ -586,7 +947,12 @@ func (p *Provider) searchAndBindUser(conn Conn, username string, bindFunc func(c
 		return nil, err
 	}
 
-	mappedGroupNames, err := p.searchGroupsForUserDN(conn, userEntry.DN)
+	groupSearchUserAttributeValue, err := p.groupSearchUserAttributeValue(userEntry, username)
+	if err != nil {
+		return nil, err
+	}
+
+	mappedGroupNames, err := p.searchGroupsForUserDN(conn, userEntry.DN, groupSearchUserAttributeValue)
 	if err != nil {
 		return nil, err
 	}
@@ -599,21 +965,12 @@ func (p *Provider) searchAndBindUser(conn Conn, username string, bindFunc func(c
 		}
 		mappedRefreshAttributes[k] = mappedVal
 	}
-
-	// Caution: Note that any other LDAP commands after this bind will be run as this user instead of as the configured BindUsername!
-	err = bindFunc(conn, userEntry.DN)
-	if err != nil {
-		plog.DebugErr("error binding for user (if this is not the expected dn for this username, please check the user search configuration)",
-			err, "upstreamName", p.GetName(), "username", username, "dn", userEntry.DN)
-		ldapErr := &ldap.Error{}
-		if errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.LDAPResultInvalidCredentials {
-			return nil, nil
-		}
-		return nil, fmt.Errorf(`error binding for user %q using provided password against DN %q: %w`, username, userEntry.DN, err)
+	if p.usesGroupSearchUserAttributeForFilter() {
+		mappedRefreshAttributes[groupSearchUserAttributeForFilterRefreshKey] = groupSearchUserAttributeValue
 	}
 
 	if len(mappedUsername) == 0 || len(mappedUID) == 0 {
-		// Couldn't find the username or couldn't bind using the password.
+		// Couldn't find the username.
 		return nil, nil
 	}
 
@@ -630,6 +987,21 @@ func (p *Provider) searchAndBindUser(conn Conn, username string, bindFunc func(c
 	return response, nil
 }
 
+// bindUser confirms the user's credentials using the bindFunc, returning false when they are not valid.
+func (p *Provider) bindUser(ctx context.Context, username, userDN string, bindFunc func(ctx context.Context, foundUserDN string) error) (bool, error) {
+	err := bindFunc(ctx, userDN)
+	if err != nil {
+		plog.DebugErr("error binding for user (if this is not the expected dn for this username, please check the user search configuration)",
+			err, "upstreamName", p.GetName(), "username", username, "dn", userDN)
+		ldapErr := &ldap.Error{}
+		if errors.As(err, &ldapErr) && ldapErr.ResultCode == ldap.LDAPResultInvalidCredentials {
+			return false, nil
+		}
+		return false, fmt.Errorf(`error binding for user %q using provided password against DN %q: %w`, username, userDN, err)
+	}
+	return true, nil
+}
+
 func (p *Provider) defaultNamingContextRequest() *ldap.SearchRequest {
 	return &ldap.SearchRequest{
 		BaseDN:       "",
@@ -659,7 +1031,7 @@ func (p *Provider) userSearchRequest(username string) *ldap.SearchRequest {
 	}
 }
 
-func (p *Provider) groupSearchRequest(userDN string) *ldap.SearchRequest {
+func (p *Provider) groupSearchRequest(filter string) *ldap.SearchRequest {
 	// See https://ldap.com/the-ldap-search-operation for general documentation of LDAP search options.
 	return &ldap.SearchRequest{
 		BaseDN:       p.c.GroupSearch.Base,
@@ -668,12 +1040,28 @@ func (p *Provider) groupSearchRequest(userDN string) *ldap.SearchRequest {
 		SizeLimit:    0, // unlimited size because we will search with paging
 		TimeLimit:    90,
 		TypesOnly:    false,
-		Filter:       p.groupSearchFilter(userDN),
+		Filter:       filter,
 		Attributes:   p.groupSearchRequestedAttributes(),
 		Controls:     nil, // nil because ldap.SearchWithPaging() will set the appropriate controls for us
 	}
 }
 
+func (p *Provider) tokenGroupsSearchRequest(userDN string) *ldap.SearchRequest {
+	// See https://ldap.com/the-ldap-search-operation for general documentation of LDAP search options.
+	// The tokenGroups attribute is constructed by the server, so it can only be read using a base object search.
+	return &ldap.SearchRequest{
+		BaseDN:       userDN,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    2,
+		TimeLimit:    90,
+		TypesOnly:    false,
+		Filter:       "(objectClass=*)", // we already have the dn, so the filter doesn't matter
+		Attributes:   []string{tokenGroupsAttributeName},
+		Controls:     nil, // this could be used to enable paging, but we're already limiting the result max size
+	}
+}
+
 func (p *Provider) refreshUserSearchRequest(dn string) *ldap.SearchRequest {
 	// See https://ldap.com/the-ldap-search-operation for general documentation of LDAP search options.
 	return &ldap.SearchRequest{
@@ -690,13 +1078,16 @@ func (p *Provider) refreshUserSearchRequest(dn string) *ldap.SearchRequest {
 }
 
 func (p *Provider) userSearchRequestedAttributes() []string {
-	attributes := make([]string, 0, len(p.c.RefreshAttributeChecks)+2)
+	attributes := make([]string, 0, len(p.c.RefreshAttributeChecks)+3)
 	if p.c.UserSearch.UsernameAttribute != distinguishedNameAttributeName {
 		attributes = append(attributes, p.c.UserSearch.UsernameAttribute)
 	}
 	if p.c.UserSearch.UIDAttribute != distinguishedNameAttributeName {
 		attributes = append(attributes, p.c.UserSearch.UIDAttribute)
 	}
+	if p.usesGroupSearchUserAttributeForFilter() {
+		attributes = append(attributes, p.c.GroupSearch.UserAttributeForFilter)
+	}
 	for k := range p.c.RefreshAttributeChecks {
 		attributes = append(attributes, k)
 	}
@@ -729,6 +1120,40 @@ func (p *Provider) groupSearchFilter(userDN string) string {
 	return interpolateSearchFilter(p.c.GroupSearch.Filter, userDN)
 }
 
+// nestedGroupSearchFilter returns a filter which matches the groups which contain any of the given groups.
+func (p *Provider) nestedGroupSearchFilter(groupDNs []string) string {
+	if len(groupDNs) == 1 {
+		return p.groupSearchFilter(groupDNs[0])
+	}
+	var filter strings.Builder
+	filter.WriteString("(|")
+	for _, groupDN := range groupDNs {
+		filter.WriteString(p.groupSearchFilter(groupDN))
+	}
+	filter.WriteString(")")
+	return filter.String()
+}
+
+// objectSIDSearchFilter returns a filter which matches the entries which have any of the given binary SIDs.
+func objectSIDSearchFilter(sids [][]byte) string {
+	var filter strings.Builder
+	if len(sids) > 1 {
+		filter.WriteString("(|")
+	}
+	for _, sid := range sids {
+		filter.WriteString("(" + objectSIDAttributeName + "=")
+		// Every byte is escaped, since binary values may contain bytes which are not allowed in filters.
+		for _, b := range sid {
+			fmt.Fprintf(&filter, `\%02x`, b)
+		}
+		filter.WriteString(")")
+	}
+	if len(sids) > 1 {
+		filter.WriteString(")")
+	}
+	return filter.String()
+}
+
 func interpolateSearchFilter(filterFormat, valueToInterpolateIntoFilter string) string {
 	filter := strings.ReplaceAll(filterFormat, searchFilterInterpolationLocationMarker, valueToInterpolateIntoFilter)
 	if strings.HasPrefix(filter, "(") && strings.HasSuffix(filter, ")") {
@@ -13,13 +13,17 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/golang/mock/gomock"
+	"github.com/jcmturner/gokrb5/v8/keytab"
 	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/apiserver/pkg/authentication/user"
+	clocktesting "k8s.io/utils/clock/testing"
 
 	"go.pinniped.dev/internal/authenticators"
 	"go.pinniped.dev/internal/certauthority"
@@ -61,6 +65,11 @@ var (
 )
 
 func TestEndUserAuthentication(t *testing.T) {
+	ca, err := certauthority.New("Test CA", time.Hour)
+	require.NoError(t, err)
+	clientCert, err := ca.IssueClientCert("some-bind-client", nil, time.Hour)
+	require.NoError(t, err)
+
 	providerConfig := func(editFunc func(p *ProviderConfig)) *ProviderConfig {
 		config := &ProviderConfig{
 			Name:               "some-provider-name",
@@ -264,6 +273,250 @@ func TestEndUserAuthentication(t *testing.T) {
 				}
 			}),
 		},
+		{
+			name:     "happy path when binding with a client certificate",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.BindUsername = ""
+				p.BindPassword = ""
+				p.BindClientCertificate = clientCert
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().ExternalBind().Times(1)
+				conn.EXPECT().Search(expectedUserSearch(nil)).Return(exampleUserSearchResult, nil).Times(1)
+				conn.EXPECT().SearchWithPaging(expectedGroupSearch(nil), expectedGroupSearchPageSize).
+					Return(exampleGroupSearchResult, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			bindEndUserMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Times(1)
+			},
+			wantAuthResponse: expectedAuthResponse(nil),
+		},
+		{
+			name:     "when nested groups are resolved, it searches for the groups which contain the groups that were found",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.ResolveNestedGroups = true
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(nil)).Return(exampleUserSearchResult, nil).Times(1)
+				conn.EXPECT().SearchWithPaging(expectedGroupSearch(nil), expectedGroupSearchPageSize).
+					Return(exampleGroupSearchResult, nil).Times(1)
+				// The groups which contain both of the user's groups are searched for at once.
+				conn.EXPECT().SearchWithPaging(expectedGroupSearch(func(r *ldap.SearchRequest) {
+					r.Filter = fmt.Sprintf("(|(some-group-filter=%s-and-more-filter=%s)(some-group-filter=%s-and-more-filter=%s))",
+						testGroupSearchResultDNValue1, testGroupSearchResultDNValue1, testGroupSearchResultDNValue2, testGroupSearchResultDNValue2)
+				}), expectedGroupSearchPageSize).
+					Return(&ldap.SearchResult{Entries: []*ldap.Entry{
+						{
+							DN: "some-upstream-parent-group-dn",
+							Attributes: []*ldap.EntryAttribute{
+								ldap.NewEntryAttribute(testGroupSearchGroupNameAttribute, []string{"some-upstream-parent-group-name-value"}),
+							},
+						},
+						{
+							// Already found, so it is not searched for again.
+							DN: strings.ToUpper(testGroupSearchResultDNValue2),
+							Attributes: []*ldap.EntryAttribute{
+								ldap.NewEntryAttribute(testGroupSearchGroupNameAttribute, []string{testGroupSearchResultGroupNameAttributeValue2}),
+							},
+						},
+					}}, nil).Times(1)
+				// The parent group is a member of one of the user's groups, which is a cycle that stops the search.
+				conn.EXPECT().SearchWithPaging(expectedGroupSearch(func(r *ldap.SearchRequest) {
+					r.Filter = "(some-group-filter=some-upstream-parent-group-dn-and-more-filter=some-upstream-parent-group-dn)"
+				}), expectedGroupSearchPageSize).
+					Return(&ldap.SearchResult{Entries: []*ldap.Entry{exampleGroupSearchResult.Entries[0]}}, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			bindEndUserMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Times(1)
+			},
+			wantAuthResponse: expectedAuthResponse(func(r *authenticators.Response) {
+				r.User = &user.DefaultInfo{
+					Name: testUserSearchResultUsernameAttributeValue,
+					UID:  base64.RawURLEncoding.EncodeToString([]byte(testUserSearchResultUIDAttributeValue)),
+					Groups: []string{
+						"some-upstream-group-name-value1",
+						"some-upstream-group-name-value2",
+						"some-upstream-parent-group-name-value",
+					},
+				}
+			}),
+		},
+		{
+			name:     "when nested groups are resolved, it stops at the maximum depth",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.ResolveNestedGroups = true
+				p.GroupSearch.GroupNameAttribute = "dn"
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(nil)).Return(exampleUserSearchResult, nil).Times(1)
+				// Each group is a member of another group, in a chain which is deeper than the maximum depth.
+				memberDN := testUserSearchResultDNValue
+				for i := 0; i <= maxNestedGroupDepth; i++ {
+					groupDN := fmt.Sprintf("group-%02d", i)
+					conn.EXPECT().SearchWithPaging(expectedGroupSearch(func(r *ldap.SearchRequest) {
+						r.Filter = fmt.Sprintf("(some-group-filter=%s-and-more-filter=%s)", memberDN, memberDN)
+						r.Attributes = []string{}
+					}), expectedGroupSearchPageSize).
+						Return(&ldap.SearchResult{Entries: []*ldap.Entry{{DN: groupDN}}}, nil).Times(1)
+					memberDN = groupDN
+				}
+				conn.EXPECT().Close().Times(1)
+			},
+			bindEndUserMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Times(1)
+			},
+			wantAuthResponse: expectedAuthResponse(func(r *authenticators.Response) {
+				r.User = &user.DefaultInfo{
+					Name: testUserSearchResultUsernameAttributeValue,
+					UID:  base64.RawURLEncoding.EncodeToString([]byte(testUserSearchResultUIDAttributeValue)),
+					Groups: []string{
+						"group-00", "group-01", "group-02", "group-03", "group-04", "group-05",
+						"group-06", "group-07", "group-08", "group-09", "group-10",
+					},
+				}
+			}),
+		},
+		{
+			name:     "when using tokenGroups, it searches for the groups with the SIDs from the user's tokenGroups",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.UseTokenGroups = true
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(nil)).Return(exampleUserSearchResult, nil).Times(1)
+				conn.EXPECT().Search(&ldap.SearchRequest{
+					BaseDN:       testUserSearchResultDNValue,
+					Scope:        ldap.ScopeBaseObject,
+					DerefAliases: ldap.NeverDerefAliases,
+					SizeLimit:    2,
+					TimeLimit:    90,
+					TypesOnly:    false,
+					Filter:       "(objectClass=*)",
+					Attributes:   []string{"tokenGroups"},
+					Controls:     nil,
+				}).Return(&ldap.SearchResult{Entries: []*ldap.Entry{
+					{
+						DN: testUserSearchResultDNValue,
+						Attributes: []*ldap.EntryAttribute{
+							{Name: "tokenGroups", ByteValues: [][]byte{{0x01, 0x02, 0x00, 0x2a}, {0x01, 0x01, 0x5c, 0x28}}},
+						},
+					},
+				}}, nil).Times(1)
+				// All the SIDs are searched for at once, with every byte escaped.
+				conn.EXPECT().SearchWithPaging(expectedGroupSearch(func(r *ldap.SearchRequest) {
+					r.Filter = `(|(objectSid=\01\02\00\2a)(objectSid=\01\01\5c\28))`
+				}), expectedGroupSearchPageSize).
+					Return(exampleGroupSearchResult, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			bindEndUserMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Times(1)
+			},
+			wantAuthResponse: expectedAuthResponse(nil),
+		},
+		{
+			name:     "when using tokenGroups and the user has no tokenGroups, it does not search for groups",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.UseTokenGroups = true
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(nil)).Return(exampleUserSearchResult, nil).Times(1)
+				conn.EXPECT().Search(gomock.Any()).
+					Return(&ldap.SearchResult{Entries: []*ldap.Entry{{DN: testUserSearchResultDNValue}}}, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			bindEndUserMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Times(1)
+			},
+			wantAuthResponse: expectedAuthResponse(func(r *authenticators.Response) {
+				info := r.User.(*user.DefaultInfo)
+				info.Groups = []string{}
+			}),
+		},
+		{
+			name:     "when using tokenGroups and the user's entry is not found",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.UseTokenGroups = true
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(nil)).Return(exampleUserSearchResult, nil).Times(1)
+				conn.EXPECT().Search(gomock.Any()).Return(&ldap.SearchResult{}, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantError: fmt.Sprintf(`searching for the tokenGroups of user with DN %q resulted in 0 search results, but expected 1 result`,
+				testUserSearchResultDNValue),
+		},
+		{
+			name:     "when the group search filter uses a user attribute, it searches using the escaped value of that attribute",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.Filter = "&(objectClass=posixGroup)(memberUid={})"
+				p.GroupSearch.UserAttributeForFilter = "uid"
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(func(r *ldap.SearchRequest) {
+					r.Attributes = []string{testUserSearchUsernameAttribute, testUserSearchUIDAttribute, "uid"}
+				})).Return(&ldap.SearchResult{
+					Entries: []*ldap.Entry{
+						{
+							DN: testUserSearchResultDNValue,
+							Attributes: []*ldap.EntryAttribute{
+								ldap.NewEntryAttribute(testUserSearchUsernameAttribute, []string{testUserSearchResultUsernameAttributeValue}),
+								ldap.NewEntryAttribute(testUserSearchUIDAttribute, []string{testUserSearchResultUIDAttributeValue}),
+								ldap.NewEntryAttribute("uid", []string{"some(uid)"}),
+							},
+						},
+					},
+				}, nil).Times(1)
+				conn.EXPECT().SearchWithPaging(expectedGroupSearch(func(r *ldap.SearchRequest) {
+					r.Filter = `(&(objectClass=posixGroup)(memberUid=some\28uid\29))`
+				}), expectedGroupSearchPageSize).
+					Return(exampleGroupSearchResult, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			bindEndUserMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Times(1)
+			},
+			wantAuthResponse: expectedAuthResponse(func(r *authenticators.Response) {
+				r.ExtraRefreshAttributes = map[string]string{"groupSearchUserAttributeForFilter": "some(uid)"}
+			}),
+		},
+		{
+			name:     "when the group search filter uses a user attribute which the user does not have",
+			username: testUpstreamUsername,
+			password: testUpstreamPassword,
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.GroupSearch.UserAttributeForFilter = "uid"
+			}),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(expectedUserSearch(func(r *ldap.SearchRequest) {
+					r.Attributes = []string{testUserSearchUsernameAttribute, testUserSearchUIDAttribute, "uid"}
+				})).Return(exampleUserSearchResult, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantError: fmt.Sprintf(`found 0 values for attribute "uid" while searching for user %q, but expected 1 result`, testUpstreamUsername),
+		},
 		{
 			name:     "when the group search base is empty then skip the group search entirely",
 			username: testUpstreamUsername,
@@ -1059,27 +1312,37 @@ func TestEndUserAuthentication(t *testing.T) {
 			ctrl := gomock.NewController(t)
 			t.Cleanup(ctrl.Finish)
 
+			// The searches are performed using a pooled connection which is bound as the service account,
+			// and the end user bind is performed using a separate connection.
 			conn := mockldapconn.NewMockConn(ctrl)
 			if tt.searchMocks != nil {
 				tt.searchMocks(conn)
 			}
+			endUserConn := mockldapconn.NewMockConn(ctrl)
 			if tt.bindEndUserMocks != nil {
-				tt.bindEndUserMocks(conn)
+				tt.bindEndUserMocks(endUserConn)
+				endUserConn.EXPECT().Close().Times(1)
 			}
 
 			dialWasAttempted := false
 			tt.providerConfig.Dialer = LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
-				dialWasAttempted = true
 				require.Equal(t, tt.providerConfig.Host, addr.Endpoint())
 				if tt.dialError != nil {
+					dialWasAttempted = true
 					return nil, tt.dialError
 				}
+				if dialWasAttempted {
+					return endUserConn, nil
+				}
+				dialWasAttempted = true
 				return conn, nil
 			})
 
 			ldapProvider := New(*tt.providerConfig)
 
 			authResponse, authenticated, err := ldapProvider.AuthenticateUser(context.Background(), tt.username, tt.password)
+			// Close the connection which was returned to the pool, if any.
+			ldapProvider.CloseIdleConnections()
 			require.Equal(t, !tt.wantToSkipDial, dialWasAttempted)
 			switch {
 			case tt.wantError != "":
@@ -1112,6 +1375,7 @@ func TestEndUserAuthentication(t *testing.T) {
 			// Skip tt.bindEndUserMocks since DryRunAuthenticateUser() never binds as the end user.
 
 			authResponse, authenticated, err = ldapProvider.DryRunAuthenticateUser(context.Background(), tt.username)
+			ldapProvider.CloseIdleConnections()
 			require.Equal(t, !tt.wantToSkipDial, dialWasAttempted)
 			switch {
 			case tt.wantError != "":
@@ -1131,6 +1395,280 @@ func TestEndUserAuthentication(t *testing.T) {
 	}
 }
 
+func TestAuthenticateUserWithGroupCache(t *testing.T) {
+	expectedUserSearch := &ldap.SearchRequest{
+		BaseDN:       testUserSearchBase,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    2,
+		TimeLimit:    90,
+		TypesOnly:    false,
+		Filter:       testUserSearchFilterInterpolated,
+		Attributes:   []string{testUserSearchUsernameAttribute, testUserSearchUIDAttribute},
+		Controls:     nil, // don't need paging because we set the SizeLimit so small
+	}
+
+	expectedGroupSearch := &ldap.SearchRequest{
+		BaseDN:       testGroupSearchBase,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    0, // unlimited size because we will search with paging
+		TimeLimit:    90,
+		TypesOnly:    false,
+		Filter:       testGroupSearchFilterInterpolated,
+		Attributes:   []string{testGroupSearchGroupNameAttribute},
+		Controls:     nil, // nil because ldap.SearchWithPaging() will set the appropriate controls for us
+	}
+
+	userSearchResult := &ldap.SearchResult{
+		Entries: []*ldap.Entry{
+			{
+				DN: testUserSearchResultDNValue,
+				Attributes: []*ldap.EntryAttribute{
+					ldap.NewEntryAttribute(testUserSearchUsernameAttribute, []string{testUserSearchResultUsernameAttributeValue}),
+					ldap.NewEntryAttribute(testUserSearchUIDAttribute, []string{testUserSearchResultUIDAttributeValue}),
+				},
+			},
+		},
+	}
+
+	groupSearchResult := &ldap.SearchResult{
+		Entries: []*ldap.Entry{
+			{
+				DN: testGroupSearchResultDNValue1,
+				Attributes: []*ldap.EntryAttribute{
+					ldap.NewEntryAttribute(testGroupSearchGroupNameAttribute, []string{testGroupSearchResultGroupNameAttributeValue1}),
+				},
+			},
+		},
+	}
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	// The searches are performed using a pooled connection which is bound as the service account,
+	// and the end user bind is performed using a separate connection.
+	var conn, endUserConn *mockldapconn.MockConn
+	dialCount := 0
+	groupCache := NewGroupCache()
+	ldapProvider := New(ProviderConfig{
+		Name:               "some-provider-name",
+		Host:               testHost,
+		ConnectionProtocol: TLS,
+		BindUsername:       testBindUsername,
+		BindPassword:       testBindPassword,
+		UserSearch: UserSearchConfig{
+			Base:              testUserSearchBase,
+			Filter:            testUserSearchFilter,
+			UsernameAttribute: testUserSearchUsernameAttribute,
+			UIDAttribute:      testUserSearchUIDAttribute,
+		},
+		GroupSearch: GroupSearchConfig{
+			Base:               testGroupSearchBase,
+			Filter:             testGroupSearchFilter,
+			GroupNameAttribute: testGroupSearchGroupNameAttribute,
+			CacheTTL:           time.Minute,
+		},
+		GroupCache: groupCache,
+		Dialer: LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+			dialCount++
+			if dialCount%2 == 1 {
+				return conn, nil
+			}
+			return endUserConn, nil
+		}),
+	})
+
+	authenticate := func(endUserBindErr error) bool {
+		t.Helper()
+		conn = mockldapconn.NewMockConn(ctrl)
+		conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+		conn.EXPECT().Search(expectedUserSearch).Return(userSearchResult, nil).Times(1)
+		conn.EXPECT().SearchWithPaging(expectedGroupSearch, expectedGroupSearchPageSize).Return(groupSearchResult, nil).Times(1)
+		conn.EXPECT().Close().Times(1)
+		endUserConn = mockldapconn.NewMockConn(ctrl)
+		endUserConn.EXPECT().Bind(testUserSearchResultDNValue, testUpstreamPassword).Return(endUserBindErr).Times(1)
+		endUserConn.EXPECT().Close().Times(1)
+
+		_, authenticated, err := ldapProvider.AuthenticateUser(context.Background(), testUpstreamUsername, testUpstreamPassword)
+		// Close the connection which was returned to the pool, so the next authentication dials again.
+		ldapProvider.CloseIdleConnections()
+		require.NoError(t, err)
+		return authenticated
+	}
+
+	// The groups which were found for a user whose password was wrong are not remembered.
+	require.False(t, authenticate(&ldap.Error{Err: errors.New("some bind error"), ResultCode: ldap.LDAPResultInvalidCredentials}))
+	_, found := groupCache.get(testUserSearchResultDNValue)
+	require.False(t, found)
+
+	// The groups are remembered once the user's password was confirmed.
+	require.True(t, authenticate(nil))
+	groups, found := groupCache.get(testUserSearchResultDNValue)
+	require.True(t, found)
+	require.Equal(t, []string{testGroupSearchResultGroupNameAttributeValue1}, groups)
+}
+
+func TestAuthenticateKerberosUser(t *testing.T) {
+	const (
+		testRealm = "EXAMPLE.COM"
+		testSPN   = "HTTP/supervisor.example.com"
+	)
+
+	kdc := testutil.NewTestKDC(t, testRealm, testSPN)
+	kt := keytab.New()
+	require.NoError(t, kt.Unmarshal(kdc.Keytab(t)))
+
+	otherKDC := testutil.NewTestKDC(t, testRealm, testSPN)
+
+	providerConfig := func(editFunc func(p *ProviderConfig)) *ProviderConfig {
+		config := &ProviderConfig{
+			Name:               "some-provider-name",
+			Host:               testHost,
+			ConnectionProtocol: TLS,
+			BindUsername:       testBindUsername,
+			BindPassword:       testBindPassword,
+			UserSearch: UserSearchConfig{
+				Base:              testUserSearchBase,
+				Filter:            testUserSearchFilter,
+				UsernameAttribute: testUserSearchUsernameAttribute,
+				UIDAttribute:      testUserSearchUIDAttribute,
+			},
+			GroupSearch: GroupSearchConfig{
+				Base:               testGroupSearchBase,
+				Filter:             testGroupSearchFilter,
+				GroupNameAttribute: testGroupSearchGroupNameAttribute,
+			},
+			KerberosKeytab:               kt,
+			KerberosServicePrincipalName: testSPN,
+		}
+		if editFunc != nil {
+			editFunc(config)
+		}
+		return config
+	}
+
+	tests := []struct {
+		name                string
+		providerConfig      *ProviderConfig
+		negotiateToken      []byte
+		searchMocks         func(conn *mockldapconn.MockConn)
+		wantError           string
+		wantUnauthenticated bool
+		wantAuthResponse    *authenticators.Response
+	}{
+		{
+			name:           "happy path searches for the user from the ticket without binding as the user",
+			providerConfig: providerConfig(nil),
+			negotiateToken: kdc.NegotiateToken(t, testUpstreamUsername, testRealm),
+			searchMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(gomock.Any()).DoAndReturn(func(r *ldap.SearchRequest) (*ldap.SearchResult, error) {
+					require.Equal(t, testUserSearchFilterInterpolated, r.Filter)
+					return &ldap.SearchResult{Entries: []*ldap.Entry{{
+						DN: testUserSearchResultDNValue,
+						Attributes: []*ldap.EntryAttribute{
+							ldap.NewEntryAttribute(testUserSearchUsernameAttribute, []string{testUserSearchResultUsernameAttributeValue}),
+							ldap.NewEntryAttribute(testUserSearchUIDAttribute, []string{testUserSearchResultUIDAttributeValue}),
+						},
+					}}}, nil
+				}).Times(1)
+				conn.EXPECT().SearchWithPaging(gomock.Any(), expectedGroupSearchPageSize).
+					Return(&ldap.SearchResult{Entries: []*ldap.Entry{{
+						DN: testGroupSearchResultDNValue1,
+						Attributes: []*ldap.EntryAttribute{
+							ldap.NewEntryAttribute(testGroupSearchGroupNameAttribute, []string{testGroupSearchResultGroupNameAttributeValue1}),
+						},
+					}}}, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantAuthResponse: &authenticators.Response{
+				User: &user.DefaultInfo{
+					Name:   testUserSearchResultUsernameAttributeValue,
+					UID:    base64.RawURLEncoding.EncodeToString([]byte(testUserSearchResultUIDAttributeValue)),
+					Groups: []string{testGroupSearchResultGroupNameAttributeValue1},
+				},
+				DN:                     testUserSearchResultDNValue,
+				ExtraRefreshAttributes: map[string]string{},
+			},
+		},
+		{
+			name:                "ticket encrypted with a key that is not in the keytab",
+			providerConfig:      providerConfig(nil),
+			negotiateToken:      otherKDC.NegotiateToken(t, testUpstreamUsername, testRealm),
+			wantUnauthenticated: true,
+		},
+		{
+			name:                "ticket for a user from another realm",
+			providerConfig:      providerConfig(nil),
+			negotiateToken:      kdc.NegotiateToken(t, testUpstreamUsername, "OTHER.EXAMPLE.COM"),
+			wantUnauthenticated: true,
+		},
+		{
+			name: "ticket for a different service principal than the configured one",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.KerberosServicePrincipalName = "HTTP/other.example.com"
+			}),
+			negotiateToken:      kdc.NegotiateToken(t, testUpstreamUsername, testRealm),
+			wantUnauthenticated: true,
+		},
+		{
+			name:                "token is not a SPNEGO token",
+			providerConfig:      providerConfig(nil),
+			negotiateToken:      []byte("not a SPNEGO token"),
+			wantUnauthenticated: true,
+		},
+		{
+			name: "kerberos is not configured",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.KerberosKeytab = nil
+			}),
+			negotiateToken: kdc.NegotiateToken(t, testUpstreamUsername, testRealm),
+			wantError:      "kerberos logins are not allowed by this provider",
+		},
+	}
+
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			t.Cleanup(ctrl.Finish)
+
+			conn := mockldapconn.NewMockConn(ctrl)
+			if tt.searchMocks != nil {
+				tt.searchMocks(conn)
+			}
+
+			dialWasAttempted := false
+			tt.providerConfig.Dialer = LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+				dialWasAttempted = true
+				return conn, nil
+			})
+
+			ldapProvider := New(*tt.providerConfig)
+			require.Equal(t, tt.providerConfig.KerberosKeytab != nil, ldapProvider.AllowsKerberos())
+
+			authResponse, authenticated, err := ldapProvider.AuthenticateKerberosUser(context.Background(), tt.negotiateToken)
+			ldapProvider.CloseIdleConnections()
+			require.Equal(t, tt.searchMocks != nil, dialWasAttempted)
+			switch {
+			case tt.wantError != "":
+				require.EqualError(t, err, tt.wantError)
+				require.False(t, authenticated)
+				require.Nil(t, authResponse)
+			case tt.wantUnauthenticated:
+				require.NoError(t, err)
+				require.False(t, authenticated)
+				require.Nil(t, authResponse)
+			default:
+				require.NoError(t, err)
+				require.True(t, authenticated)
+				require.Equal(t, tt.wantAuthResponse, authResponse)
+			}
+		})
+	}
+}
+
 func TestUpstreamRefresh(t *testing.T) {
 	pwdLastSetAttribute := "pwdLastSet"
 	expectedUserSearch := &ldap.SearchRequest{
@@ -1197,13 +1735,74 @@ func TestUpstreamRefresh(t *testing.T) {
 		},
 	}
 
+	posixGroupProviderConfig := &ProviderConfig{
+		Name:               "some-provider-name",
+		Host:               testHost,
+		CABundle:           nil, // this field is only used by the production dialer, which is replaced by a mock for this test
+		ConnectionProtocol: TLS,
+		BindUsername:       testBindUsername,
+		BindPassword:       testBindPassword,
+		UserSearch: UserSearchConfig{
+			Base:              testUserSearchBase,
+			UIDAttribute:      testUserSearchUIDAttribute,
+			UsernameAttribute: testUserSearchUsernameAttribute,
+		},
+		GroupSearch: GroupSearchConfig{
+			Base:                   testGroupSearchBase,
+			Filter:                 "&(objectClass=posixGroup)(memberUid={})",
+			UserAttributeForFilter: "uid",
+			GroupNameAttribute:     testGroupSearchGroupNameAttribute,
+		},
+		RefreshAttributeChecks: map[string]func(*ldap.Entry, provider.StoredRefreshAttributes) error{
+			pwdLastSetAttribute: AttributeUnchangedSinceLogin(pwdLastSetAttribute),
+		},
+	}
+
+	posixGroupUserSearch := &ldap.SearchRequest{
+		BaseDN:       testUserSearchResultDNValue,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    2,
+		TimeLimit:    90,
+		TypesOnly:    false,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{testUserSearchUsernameAttribute, testUserSearchUIDAttribute, "uid", pwdLastSetAttribute},
+		Controls:     nil, // don't need paging because we set the SizeLimit so small
+	}
+
+	posixGroupUserSearchResult := &ldap.SearchResult{
+		Entries: []*ldap.Entry{
+			{
+				DN: testUserSearchResultDNValue,
+				Attributes: append([]*ldap.EntryAttribute{
+					ldap.NewEntryAttribute("uid", []string{"some-new-uid"}),
+				}, happyPathUserSearchResult.Entries[0].Attributes...),
+			},
+		},
+	}
+
+	posixGroupSearch := func(uid string) *ldap.SearchRequest {
+		return &ldap.SearchRequest{
+			BaseDN:       testGroupSearchBase,
+			Scope:        ldap.ScopeWholeSubtree,
+			DerefAliases: ldap.NeverDerefAliases,
+			SizeLimit:    0, // unlimited size because we will search with paging
+			TimeLimit:    90,
+			TypesOnly:    false,
+			Filter:       fmt.Sprintf("(&(objectClass=posixGroup)(memberUid=%s))", uid),
+			Attributes:   []string{testGroupSearchGroupNameAttribute},
+			Controls:     nil, // nil because ldap.SearchWithPaging() will set the appropriate controls for us
+		}
+	}
+
 	tests := []struct {
-		name           string
-		providerConfig *ProviderConfig
-		setupMocks     func(conn *mockldapconn.MockConn)
-		dialError      error
-		wantErr        string
-		wantGroups     []string
+		name                       string
+		providerConfig             *ProviderConfig
+		storedAdditionalAttributes map[string]string
+		setupMocks                 func(conn *mockldapconn.MockConn)
+		dialError                  error
+		wantErr                    string
+		wantGroups                 []string
 	}{
 		{
 			name:           "happy path where searching the dn returns a single entry",
@@ -1263,6 +1862,38 @@ func TestUpstreamRefresh(t *testing.T) {
 			},
 			wantGroups: []string{testGroupSearchResultGroupNameAttributeValue1, testGroupSearchResultGroupNameAttributeValue2},
 		},
+		{
+			name:                       "happy path where the group search filter uses the user attribute value from the session",
+			providerConfig:             posixGroupProviderConfig,
+			storedAdditionalAttributes: map[string]string{"groupSearchUserAttributeForFilter": "some-uid"},
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(posixGroupUserSearch).Return(posixGroupUserSearchResult, nil).Times(1)
+				conn.EXPECT().SearchWithPaging(posixGroupSearch("some-uid"), expectedGroupSearchPageSize).Return(&ldap.SearchResult{
+					Entries: []*ldap.Entry{
+						{
+							DN: testGroupSearchResultDNValue1,
+							Attributes: []*ldap.EntryAttribute{
+								ldap.NewEntryAttribute(testGroupSearchGroupNameAttribute, []string{testGroupSearchResultGroupNameAttributeValue1}),
+							},
+						},
+					},
+				}, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantGroups: []string{testGroupSearchResultGroupNameAttributeValue1},
+		},
+		{
+			name:           "happy path where the group search filter uses a user attribute which was not stored in the session",
+			providerConfig: posixGroupProviderConfig,
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+				conn.EXPECT().Search(posixGroupUserSearch).Return(posixGroupUserSearchResult, nil).Times(1)
+				conn.EXPECT().SearchWithPaging(posixGroupSearch("some-new-uid"), expectedGroupSearchPageSize).Return(&ldap.SearchResult{}, nil).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantGroups: []string{},
+		},
 		{
 			name: "happy path where group search returns no groups",
 			providerConfig: &ProviderConfig{
@@ -1650,14 +2281,20 @@ func TestUpstreamRefresh(t *testing.T) {
 			})
 
 			initialPwdLastSetEncoded := base64.RawURLEncoding.EncodeToString([]byte("132801740800000000"))
+			additionalAttributes := map[string]string{pwdLastSetAttribute: initialPwdLastSetEncoded}
+			for k, v := range tt.storedAdditionalAttributes {
+				additionalAttributes[k] = v
+			}
 			ldapProvider := New(*tt.providerConfig)
 			subject := "ldaps://ldap.example.com:8443?base=some-upstream-user-base-dn&sub=c29tZS11cHN0cmVhbS11aWQtdmFsdWU"
 			groups, err := ldapProvider.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
 				Username:             testUserSearchResultUsernameAttributeValue,
 				Subject:              subject,
 				DN:                   testUserSearchResultDNValue,
-				AdditionalAttributes: map[string]string{pwdLastSetAttribute: initialPwdLastSetEncoded},
+				AdditionalAttributes: additionalAttributes,
 			})
+			// Close the connection which was returned to the pool, if any.
+			ldapProvider.CloseIdleConnections()
 			if tt.wantErr != "" {
 				require.Error(t, err)
 				require.Equal(t, tt.wantErr, err.Error())
@@ -1670,7 +2307,142 @@ func TestUpstreamRefresh(t *testing.T) {
 	}
 }
 
+func TestUpstreamRefreshWithGroupCache(t *testing.T) {
+	expectedUserSearch := &ldap.SearchRequest{
+		BaseDN:       testUserSearchResultDNValue,
+		Scope:        ldap.ScopeBaseObject,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    2,
+		TimeLimit:    90,
+		TypesOnly:    false,
+		Filter:       "(objectClass=*)",
+		Attributes:   []string{testUserSearchUsernameAttribute, testUserSearchUIDAttribute},
+		Controls:     nil, // don't need paging because we set the SizeLimit so small
+	}
+
+	expectedGroupSearch := &ldap.SearchRequest{
+		BaseDN:       testGroupSearchBase,
+		Scope:        ldap.ScopeWholeSubtree,
+		DerefAliases: ldap.NeverDerefAliases,
+		SizeLimit:    0, // unlimited size because we will search with paging
+		TimeLimit:    90,
+		TypesOnly:    false,
+		Filter:       testGroupSearchFilterInterpolated,
+		Attributes:   []string{testGroupSearchGroupNameAttribute},
+		Controls:     nil, // nil because ldap.SearchWithPaging() will set the appropriate controls for us
+	}
+
+	userSearchResult := &ldap.SearchResult{
+		Entries: []*ldap.Entry{
+			{
+				DN: testUserSearchResultDNValue,
+				Attributes: []*ldap.EntryAttribute{
+					ldap.NewEntryAttribute(testUserSearchUsernameAttribute, []string{testUserSearchResultUsernameAttributeValue}),
+					{
+						Name:       testUserSearchUIDAttribute,
+						ByteValues: [][]byte{[]byte(testUserSearchResultUIDAttributeValue)},
+					},
+				},
+			},
+		},
+	}
+
+	groupSearchResult := func(groupNames ...string) *ldap.SearchResult {
+		result := &ldap.SearchResult{}
+		for i, groupName := range groupNames {
+			result.Entries = append(result.Entries, &ldap.Entry{
+				DN: fmt.Sprintf("some-upstream-group-dn%d", i),
+				Attributes: []*ldap.EntryAttribute{
+					ldap.NewEntryAttribute(testGroupSearchGroupNameAttribute, []string{groupName}),
+				},
+			})
+		}
+		return result
+	}
+
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	var conn *mockldapconn.MockConn
+	providerConfig := ProviderConfig{
+		Name:               "some-provider-name",
+		Host:               testHost,
+		ConnectionProtocol: TLS,
+		BindUsername:       testBindUsername,
+		BindPassword:       testBindPassword,
+		UserSearch: UserSearchConfig{
+			Base:              testUserSearchBase,
+			UIDAttribute:      testUserSearchUIDAttribute,
+			UsernameAttribute: testUserSearchUsernameAttribute,
+		},
+		GroupSearch: GroupSearchConfig{
+			Base:               testGroupSearchBase,
+			Filter:             testGroupSearchFilter,
+			GroupNameAttribute: testGroupSearchGroupNameAttribute,
+			CacheTTL:           time.Minute,
+		},
+		Dialer: LDAPDialerFunc(func(ctx context.Context, addr endpointaddr.HostPort) (Conn, error) {
+			return conn, nil
+		}),
+	}
+
+	fakeClock := clocktesting.NewFakeClock(time.Now())
+	groupCache := &GroupCache{cache: cache.NewExpiringWithClock(fakeClock)}
+	providerConfig.GroupCache = groupCache
+
+	refresh := func(ldapProvider *Provider, wantGroupSearchResult *ldap.SearchResult, wantGroups []string) {
+		t.Helper()
+		conn = mockldapconn.NewMockConn(ctrl)
+		conn.EXPECT().Bind(testBindUsername, testBindPassword).Times(1)
+		conn.EXPECT().Search(expectedUserSearch).Return(userSearchResult, nil).Times(1)
+		if wantGroupSearchResult != nil {
+			conn.EXPECT().SearchWithPaging(expectedGroupSearch, expectedGroupSearchPageSize).Return(wantGroupSearchResult, nil).Times(1)
+		}
+		conn.EXPECT().Close().Times(1)
+
+		groups, err := ldapProvider.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
+			Username: testUserSearchResultUsernameAttributeValue,
+			Subject:  "ldaps://ldap.example.com:8443?base=some-upstream-user-base-dn&sub=c29tZS11cHN0cmVhbS11aWQtdmFsdWU",
+			DN:       testUserSearchResultDNValue,
+		})
+		// Close the connection which was returned to the pool, so the next refresh dials again.
+		ldapProvider.CloseIdleConnections()
+		require.NoError(t, err)
+		require.Equal(t, wantGroups, groups)
+	}
+
+	ldapProvider := New(providerConfig)
+
+	// The first refresh searches for the groups, and remembers them.
+	refresh(ldapProvider, groupSearchResult("group1", "group2"), []string{"group1", "group2"})
+
+	// Refreshes which happen before the TTL has passed skip the group search, but still search for the user.
+	fakeClock.Step(30 * time.Second)
+	refresh(ldapProvider, nil, []string{"group1", "group2"})
+
+	// The cache is shared by providers which were created using the same GroupCache, e.g. after a resync.
+	ldapProvider = New(providerConfig)
+	refresh(ldapProvider, nil, []string{"group1", "group2"})
+
+	// Once the TTL has passed, the groups are searched for again, and the new results are remembered.
+	fakeClock.Step(31 * time.Second)
+	refresh(ldapProvider, groupSearchResult("group3"), []string{"group3"})
+	refresh(ldapProvider, nil, []string{"group3"})
+
+	// Providers which do not share the cache search for the groups during every refresh.
+	providerConfig.GroupCache = nil
+	providerConfig.GroupSearch.CacheTTL = 0
+	ldapProvider = New(providerConfig)
+	refresh(ldapProvider, groupSearchResult("group4"), []string{"group4"})
+	refresh(ldapProvider, groupSearchResult("group4"), []string{"group4"})
+}
+
 func TestTestConnection(t *testing.T) {
+	ca, err := certauthority.New("Test CA", time.Hour)
+	require.NoError(t, err)
+	clientCert, err := ca.IssueClientCert("some-bind-client", nil, time.Hour)
+	require.NoError(t, err)
+
 	providerConfig := func(editFunc func(p *ProviderConfig)) *ProviderConfig {
 		config := &ProviderConfig{
 			Name:               "some-provider-name",
@@ -1718,6 +2490,31 @@ func TestTestConnection(t *testing.T) {
 			},
 			wantError: fmt.Sprintf(`error binding as "%s": some bind error`, testBindUsername),
 		},
+		{
+			name: "happy path when binding with a client certificate",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.BindUsername = ""
+				p.BindPassword = ""
+				p.BindClientCertificate = clientCert
+			}),
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().ExternalBind().Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+		},
+		{
+			name: "when binding with a client certificate returns an error",
+			providerConfig: providerConfig(func(p *ProviderConfig) {
+				p.BindUsername = ""
+				p.BindPassword = ""
+				p.BindClientCertificate = clientCert
+			}),
+			setupMocks: func(conn *mockldapconn.MockConn) {
+				conn.EXPECT().ExternalBind().Return(errors.New("some bind error")).Times(1)
+				conn.EXPECT().Close().Times(1)
+			},
+			wantError: `error binding as client certificate with subject "CN=some-bind-client" using SASL EXTERNAL: some bind error`,
+		},
 		{
 			name: "when the config is invalid",
 			providerConfig: providerConfig(func(p *ProviderConfig) {
@@ -1942,7 +2739,7 @@ func TestRealTLSDialing(t *testing.T) {
 				ConnectionProtocol: tt.connProto,
 				Dialer:             nil, // this test is for the default (production) TLS dialer
 			})
-			conn, err := provider.dial(tt.context)
+			conn, err := provider.dialHost(tt.context, tt.host)
 			if conn != nil {
 				defer conn.Close()
 			}
@@ -0,0 +1,222 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamlocal implements an abstraction of identity providers whose users are stored in Secrets.
+package upstreamlocal
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/user"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/utils/clock"
+
+	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/internal/plog"
+)
+
+const (
+	// UserSecretType is the type of the Secrets which define the users of local identity providers.
+	UserSecretType corev1.SecretType = "secrets.pinniped.dev/local-user"
+
+	passwordHashDataKey      = "passwordHash"
+	groupsDataKey            = "groups"
+	disabledDataKey          = "disabled"
+	passwordExpiresAtDataKey = "passwordExpiresAt"
+)
+
+// dummyPasswordHash is compared with the password when the user does not exist, so that the response takes about as
+// long as for an existing user, and usernames cannot be discovered by timing failed logins.
+var dummyPasswordHash = []byte("$2a$10$8MilB7uAPFKPalSYFOZd.uJ84Uw8pZqhZ3TwADVeu/pQvdKhVQazS") //nolint:gochecknoglobals
+
+// ProviderConfig holds the active configuration of a local identity provider.
+type ProviderConfig struct {
+	Name        string
+	ResourceUID types.UID
+
+	// Namespace is the namespace of the LocalIdentityProvider, which is also the namespace of its users' Secrets.
+	Namespace string
+
+	// SecretSelector selects the Secrets which define the users of this identity provider.
+	SecretSelector labels.Selector
+
+	Secrets corev1listers.SecretLister
+	Clock   clock.PassiveClock
+}
+
+var _ provider.UpstreamLDAPIdentityProviderI = (*ProviderConfig)(nil)
+
+// localUser is a user of a local identity provider, as read from its Secret.
+type localUser struct {
+	username          string
+	uid               string
+	passwordHash      []byte
+	groups            []string
+	disabled          bool
+	passwordExpiresAt *time.Time
+}
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+// GetURL returns a URL which identifies this identity provider, e.g. "local://supervisor-namespace/my-idp". It is
+// combined with the UIDs of the users to form the subjects of the downstream ID tokens.
+func (p *ProviderConfig) GetURL() *url.URL {
+	return &url.URL{Scheme: "local", Host: p.Namespace, Path: "/" + p.Name}
+}
+
+// AuthenticateUser validates the password of the user, and that the user is not disabled and their password has
+// not expired.
+func (p *ProviderConfig) AuthenticateUser(_ context.Context, username, password string) (*authenticators.Response, bool, error) {
+	if username == "" || password == "" {
+		return nil, false, nil
+	}
+
+	localUser, err := p.getUser(username)
+	if err != nil {
+		return nil, false, fmt.Errorf(`error authenticating user %q using local identity provider %q: %w`, username, p.Name, err)
+	}
+	if localUser == nil {
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		plog.Debug("local user not found", "upstreamName", p.Name, "username", username)
+		return nil, false, nil
+	}
+
+	if bcrypt.CompareHashAndPassword(localUser.passwordHash, []byte(password)) != nil {
+		plog.Debug("local user provided an incorrect password", "upstreamName", p.Name, "username", username)
+		return nil, false, nil
+	}
+	if err := p.checkUserIsActive(localUser); err != nil {
+		plog.Debug("local user is not allowed to log in", "upstreamName", p.Name, "username", username, "reason", err.Error())
+		return nil, false, nil
+	}
+
+	return &authenticators.Response{
+		User: &user.DefaultInfo{
+			Name:   localUser.username,
+			UID:    localUser.uid,
+			Groups: localUser.groups,
+		},
+	}, true, nil
+}
+
+// PerformRefresh revalidates the user, and returns their current groups. It returns an error when the user no longer
+// exists, has been disabled, or has an expired password, or when the user was deleted and recreated with the same
+// username since they logged in.
+func (p *ProviderConfig) PerformRefresh(_ context.Context, storedRefreshAttributes provider.StoredRefreshAttributes) ([]string, error) {
+	username := storedRefreshAttributes.Username
+
+	localUser, err := p.getUser(username)
+	if err != nil {
+		return nil, fmt.Errorf(`error refreshing user %q using local identity provider %q: %w`, username, p.Name, err)
+	}
+	if localUser == nil {
+		return nil, fmt.Errorf(`user %q no longer exists in local identity provider %q`, username, p.Name)
+	}
+
+	newSubject := downstreamsession.DownstreamLDAPSubject(localUser.uid, *p.GetURL())
+	if newSubject != storedRefreshAttributes.Subject {
+		return nil, fmt.Errorf(`refreshing user %q produced a different subject than the previous value. expected: %q, actual: %q`,
+			username, storedRefreshAttributes.Subject, newSubject)
+	}
+	if err := p.checkUserIsActive(localUser); err != nil {
+		return nil, fmt.Errorf(`user %q is no longer allowed to log in to local identity provider %q: %w`, username, p.Name, err)
+	}
+
+	return localUser.groups, nil
+}
+
+// getUser returns the user with the given username, or nil when there is no such user.
+func (p *ProviderConfig) getUser(username string) (*localUser, error) {
+	secret, err := p.Secrets.Secrets(p.Namespace).Get(username)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if secret.Type != UserSecretType || !p.SecretSelector.Matches(labels.Set(secret.Labels)) {
+		return nil, nil
+	}
+	return userFromSecret(secret)
+}
+
+func (p *ProviderConfig) checkUserIsActive(localUser *localUser) error {
+	if localUser.disabled {
+		return errors.New("user is disabled")
+	}
+	if localUser.passwordExpiresAt != nil && !p.Clock.Now().Before(*localUser.passwordExpiresAt) {
+		return fmt.Errorf("password expired at %s", localUser.passwordExpiresAt.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// ValidateUserSecret returns an error when the Secret does not define a valid user.
+func ValidateUserSecret(secret *corev1.Secret) error {
+	_, err := userFromSecret(secret)
+	return err
+}
+
+// userFromSecret parses a user from its Secret, using the same format for the "passwordHash" and "groups" keys as
+// the local-user-authenticator.
+func userFromSecret(secret *corev1.Secret) (*localUser, error) {
+	result := localUser{
+		username:     secret.Name,
+		uid:          string(secret.UID),
+		passwordHash: secret.Data[passwordHashDataKey],
+		groups:       []string{},
+	}
+
+	if len(result.passwordHash) == 0 {
+		return nil, fmt.Errorf("user Secret %q is missing required key %q", secret.Name, passwordHashDataKey)
+	}
+
+	if groupsData := secret.Data[groupsDataKey]; len(groupsData) > 0 {
+		groups, err := csv.NewReader(bytes.NewReader(groupsData)).Read()
+		if err != nil {
+			return nil, fmt.Errorf("user Secret %q has invalid %q: %w", secret.Name, groupsDataKey, err)
+		}
+		for _, group := range groups {
+			result.groups = append(result.groups, strings.TrimSpace(group))
+		}
+	}
+
+	if disabledData := secret.Data[disabledDataKey]; len(disabledData) > 0 {
+		switch strings.TrimSpace(string(disabledData)) {
+		case "true":
+			result.disabled = true
+		case "false":
+		default:
+			return nil, fmt.Errorf(`user Secret %q has invalid %q: must be "true" or "false"`, secret.Name, disabledDataKey)
+		}
+	}
+
+	if expiresAtData := secret.Data[passwordExpiresAtDataKey]; len(expiresAtData) > 0 {
+		expiresAt, err := time.Parse(time.RFC3339, strings.TrimSpace(string(expiresAtData)))
+		if err != nil {
+			return nil, fmt.Errorf("user Secret %q has invalid %q: %w", secret.Name, passwordExpiresAtDataKey, err)
+		}
+		result.passwordExpiresAt = &expiresAt
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,270 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamlocal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apiserver/pkg/authentication/user"
+	corev1listers "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+func TestProviderConfig(t *testing.T) {
+	const (
+		testNamespace    = "test-namespace"
+		testName         = "test-name"
+		testUsername     = "some-user"
+		testPassword     = "some-password"
+		testUserUID      = "some-user-uid"
+		testSubject      = "local://test-namespace/test-name?sub=some-user-uid"
+		otherUserSubject = "local://test-namespace/test-name?sub=some-other-uid"
+	)
+
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	validSecret := func(editData func(map[string][]byte)) *corev1.Secret {
+		data := map[string][]byte{
+			"passwordHash": passwordHash,
+			"groups":       []byte("group-b, group-a"),
+		}
+		if editData != nil {
+			editData(data)
+		}
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: testNamespace,
+				Name:      testUsername,
+				UID:       testUserUID,
+				Labels:    map[string]string{"users": "local"},
+			},
+			Type: "secrets.pinniped.dev/local-user",
+			Data: data,
+		}
+	}
+
+	newProvider := func(t *testing.T, secrets ...*corev1.Secret) *ProviderConfig {
+		t.Helper()
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		for _, secret := range secrets {
+			require.NoError(t, indexer.Add(secret))
+		}
+		selector, err := labels.Parse("users=local")
+		require.NoError(t, err)
+		return &ProviderConfig{
+			Name:           testName,
+			ResourceUID:    "test-resource-uid",
+			Namespace:      testNamespace,
+			SecretSelector: selector,
+			Secrets:        corev1listers.NewSecretLister(indexer),
+			Clock:          clocktesting.NewFakeClock(now),
+		}
+	}
+
+	t.Run("getters", func(t *testing.T) {
+		p := newProvider(t)
+		require.Equal(t, testName, p.GetName())
+		require.Equal(t, "test-resource-uid", string(p.GetResourceUID()))
+		require.Equal(t, "local://test-namespace/test-name", p.GetURL().String())
+		_, isKerberos := interface{}(p).(provider.UpstreamKerberosIdentityProviderI)
+		require.False(t, isKerberos)
+	})
+
+	tests := []struct {
+		name            string
+		secrets         []*corev1.Secret
+		username        string
+		password        string
+		wantResponse    *authenticators.Response
+		wantAuthErr     string
+		refreshSubject  string
+		wantGroups      []string
+		wantRefreshErr  string
+		skipRefreshTest bool
+	}{
+		{
+			name:     "valid user",
+			secrets:  []*corev1.Secret{validSecret(nil)},
+			username: testUsername,
+			password: testPassword,
+			wantResponse: &authenticators.Response{
+				User: &user.DefaultInfo{Name: testUsername, UID: testUserUID, Groups: []string{"group-b", "group-a"}},
+			},
+			wantGroups: []string{"group-b", "group-a"},
+		},
+		{
+			name: "valid user without groups whose password expires in the future",
+			secrets: []*corev1.Secret{validSecret(func(data map[string][]byte) {
+				delete(data, "groups")
+				data["disabled"] = []byte("false")
+				data["passwordExpiresAt"] = []byte("2022-06-01T12:00:01Z")
+			})},
+			username: testUsername,
+			password: testPassword,
+			wantResponse: &authenticators.Response{
+				User: &user.DefaultInfo{Name: testUsername, UID: testUserUID, Groups: []string{}},
+			},
+			wantGroups: []string{},
+		},
+		{
+			name:            "wrong password",
+			secrets:         []*corev1.Secret{validSecret(nil)},
+			username:        testUsername,
+			password:        "wrong-password",
+			skipRefreshTest: true,
+		},
+		{
+			name:            "empty password",
+			secrets:         []*corev1.Secret{validSecret(nil)},
+			username:        testUsername,
+			skipRefreshTest: true,
+		},
+		{
+			name:           "user does not exist",
+			username:       testUsername,
+			password:       testPassword,
+			wantRefreshErr: `user "some-user" no longer exists in local identity provider "test-name"`,
+		},
+		{
+			name: "user Secret has the wrong type",
+			secrets: []*corev1.Secret{func() *corev1.Secret {
+				s := validSecret(nil)
+				s.Type = corev1.SecretTypeOpaque
+				return s
+			}()},
+			username:       testUsername,
+			password:       testPassword,
+			wantRefreshErr: `user "some-user" no longer exists in local identity provider "test-name"`,
+		},
+		{
+			name: "user Secret is not selected",
+			secrets: []*corev1.Secret{func() *corev1.Secret {
+				s := validSecret(nil)
+				s.Labels = map[string]string{"users": "other"}
+				return s
+			}()},
+			username:       testUsername,
+			password:       testPassword,
+			wantRefreshErr: `user "some-user" no longer exists in local identity provider "test-name"`,
+		},
+		{
+			name: "user is disabled",
+			secrets: []*corev1.Secret{validSecret(func(data map[string][]byte) {
+				data["disabled"] = []byte("true")
+			})},
+			username:       testUsername,
+			password:       testPassword,
+			wantRefreshErr: `user "some-user" is no longer allowed to log in to local identity provider "test-name": user is disabled`,
+		},
+		{
+			name: "password has expired",
+			secrets: []*corev1.Secret{validSecret(func(data map[string][]byte) {
+				data["passwordExpiresAt"] = []byte("2022-06-01T12:00:00Z")
+			})},
+			username:       testUsername,
+			password:       testPassword,
+			wantRefreshErr: `user "some-user" is no longer allowed to log in to local identity provider "test-name": password expired at 2022-06-01T12:00:00Z`,
+		},
+		{
+			name:           "user was recreated with a different UID",
+			secrets:        []*corev1.Secret{validSecret(nil)},
+			refreshSubject: otherUserSubject,
+			username:       testUsername,
+			password:       testPassword,
+			wantResponse: &authenticators.Response{
+				User: &user.DefaultInfo{Name: testUsername, UID: testUserUID, Groups: []string{"group-b", "group-a"}},
+			},
+			wantRefreshErr: `refreshing user "some-user" produced a different subject than the previous value. expected: "local://test-namespace/test-name?sub=some-other-uid", actual: "local://test-namespace/test-name?sub=some-user-uid"`,
+		},
+		{
+			name: "user Secret is missing the password hash",
+			secrets: []*corev1.Secret{validSecret(func(data map[string][]byte) {
+				delete(data, "passwordHash")
+			})},
+			username:       testUsername,
+			password:       testPassword,
+			wantAuthErr:    `error authenticating user "some-user" using local identity provider "test-name": user Secret "some-user" is missing required key "passwordHash"`,
+			wantRefreshErr: `error refreshing user "some-user" using local identity provider "test-name": user Secret "some-user" is missing required key "passwordHash"`,
+		},
+		{
+			name: "user Secret has an invalid disabled flag",
+			secrets: []*corev1.Secret{validSecret(func(data map[string][]byte) {
+				data["disabled"] = []byte("yes")
+			})},
+			username:       testUsername,
+			password:       testPassword,
+			wantAuthErr:    `error authenticating user "some-user" using local identity provider "test-name": user Secret "some-user" has invalid "disabled": must be "true" or "false"`,
+			wantRefreshErr: `error refreshing user "some-user" using local identity provider "test-name": user Secret "some-user" has invalid "disabled": must be "true" or "false"`,
+		},
+		{
+			name: "user Secret has an invalid password expiration",
+			secrets: []*corev1.Secret{validSecret(func(data map[string][]byte) {
+				data["passwordExpiresAt"] = []byte("tomorrow")
+			})},
+			username:       testUsername,
+			password:       testPassword,
+			wantAuthErr:    `error authenticating user "some-user" using local identity provider "test-name": user Secret "some-user" has invalid "passwordExpiresAt": parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+			wantRefreshErr: `error refreshing user "some-user" using local identity provider "test-name": user Secret "some-user" has invalid "passwordExpiresAt": parsing time "tomorrow" as "2006-01-02T15:04:05Z07:00": cannot parse "tomorrow" as "2006"`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProvider(t, tt.secrets...)
+
+			response, authenticated, err := p.AuthenticateUser(context.Background(), tt.username, tt.password)
+			if tt.wantAuthErr != "" {
+				require.EqualError(t, err, tt.wantAuthErr)
+				require.False(t, authenticated)
+				require.Nil(t, response)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.wantResponse != nil, authenticated)
+				require.Equal(t, tt.wantResponse, response)
+			}
+
+			if tt.skipRefreshTest {
+				return
+			}
+			subject := tt.refreshSubject
+			if subject == "" {
+				subject = testSubject
+			}
+			groups, err := p.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
+				Username: testUsername,
+				Subject:  subject,
+				UID:      testUserUID,
+			})
+			if tt.wantRefreshErr != "" {
+				require.EqualError(t, err, tt.wantRefreshErr)
+				require.Nil(t, groups)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tt.wantGroups, groups)
+			}
+		})
+	}
+}
+
+func TestDummyPasswordHashCostsAsMuchAsARealHash(t *testing.T) {
+	// Comparing with an invalid hash would fail immediately, so the hash must be valid and use the default cost
+	// of the hashes which are created for users.
+	cost, err := bcrypt.Cost(dummyPasswordHash)
+	require.NoError(t, err)
+	require.Equal(t, bcrypt.DefaultCost, cost)
+}
@@ -0,0 +1,256 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamoauth2 implements an abstraction of upstream OAuth2 provider interactions for providers which do
+// not support OpenID Connect, but which offer an API endpoint to look up the profile of the user.
+package upstreamoauth2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/jsonpath"
+
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/pkg/oidcclient/pkce"
+)
+
+// The maximum size of a response body from the profile endpoint which we are willing to read.
+const maxResponseBodySize = 10 * 1024 * 1024
+
+// ProviderConfig holds the active configuration of an upstream OAuth2 provider.
+type ProviderConfig struct {
+	Name        string
+	ResourceUID types.UID
+
+	// ProfileURL is the URL of the endpoint which returns the profile of the user who owns an access token.
+	ProfileURL *url.URL
+
+	// UsernameExpression, GroupsExpression and UserIDExpression are JSONPath expressions which are evaluated
+	// against the profile of the user. GroupsExpression may be empty, in which case the user has no groups.
+	// They are kept as strings because a parsed jsonpath.JSONPath is not safe for concurrent use.
+	UsernameExpression string
+	GroupsExpression   string
+	UserIDExpression   string
+
+	AdditionalAuthcodeParams map[string]string
+
+	OAuth2Config *oauth2.Config
+	HTTPClient   *http.Client
+}
+
+var _ provider.UpstreamOAuth2IdentityProviderI = (*ProviderConfig)(nil)
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+func (p *ProviderConfig) GetClientID() string {
+	return p.OAuth2Config.ClientID
+}
+
+func (p *ProviderConfig) GetAuthorizationURL() string {
+	return p.OAuth2Config.Endpoint.AuthURL
+}
+
+func (p *ProviderConfig) GetScopes() []string {
+	return p.OAuth2Config.Scopes
+}
+
+func (p *ProviderConfig) GetAdditionalAuthcodeParams() map[string]string {
+	return p.AdditionalAuthcodeParams
+}
+
+// ExchangeAuthcode performs the upstream OAuth2 authorization code exchange using the PKCE code verifier.
+func (p *ProviderConfig) ExchangeAuthcode(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, redirectURI string) (*oauth2.Token, error) {
+	return p.OAuth2Config.Exchange(
+		context.WithValue(ctx, oauth2.HTTPClient, p.HTTPClient),
+		authcode,
+		pkceCodeVerifier.Verifier(),
+		oauth2.SetAuthURLParam("redirect_uri", redirectURI),
+	)
+}
+
+// PerformRefresh uses the upstream refresh token to get new tokens from the token endpoint.
+func (p *ProviderConfig) PerformRefresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+	// Create a TokenSource without an access token, so it thinks that a refresh is immediately required.
+	// Then ask it for the tokens to cause it to perform the refresh and return the results.
+	return p.OAuth2Config.TokenSource(
+		context.WithValue(ctx, oauth2.HTTPClient, p.HTTPClient),
+		&oauth2.Token{RefreshToken: refreshToken},
+	).Token()
+}
+
+// GetUser uses the profile endpoint to look up the user who owns the access token, and reads the identity of
+// the user from the profile using the configured JSONPath expressions.
+func (p *ProviderConfig) GetUser(ctx context.Context, accessToken string) (*provider.OAuth2User, error) {
+	profile, err := p.getProfile(ctx, accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching user profile: %w", err)
+	}
+
+	username, err := singleValue(p.UsernameExpression, profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not determine username from user profile: %w", err)
+	}
+
+	userID := username
+	if p.UserIDExpression != "" {
+		userID, err = singleValue(p.UserIDExpression, profile)
+		if err != nil {
+			return nil, fmt.Errorf("could not determine user ID from user profile: %w", err)
+		}
+	}
+
+	var groups []string
+	if p.GroupsExpression != "" {
+		groups, err = stringValues(p.GroupsExpression, profile)
+		if err != nil {
+			return nil, fmt.Errorf("could not determine groups from user profile: %w", err)
+		}
+	}
+
+	return &provider.OAuth2User{
+		Username:          username,
+		Groups:            sets.NewString(groups...).List(),
+		DownstreamSubject: p.downstreamSubject(userID),
+	}, nil
+}
+
+// downstreamSubject returns a subject which is unique to this user across all upstream providers, because it is
+// formed from the profile URL of this provider and the user's ID.
+func (p *ProviderConfig) downstreamSubject(userID string) string {
+	subjectURL := *p.ProfileURL
+	q := subjectURL.Query()
+	q.Set(oidc.IDTokenSubjectClaim, userID)
+	subjectURL.RawQuery = q.Encode()
+	return subjectURL.String()
+}
+
+func (p *ProviderConfig) getProfile(ctx context.Context, accessToken string) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.ProfileURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %q with body: %s", resp.Status, body)
+	}
+
+	// Keep numbers as json.Number so that large numeric IDs do not lose precision.
+	var profile interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&profile); err != nil {
+		return nil, fmt.Errorf("could not decode response: %w", err)
+	}
+	return profile, nil
+}
+
+// ParseJSONPath parses a JSONPath expression which is used to read a value from the profile of the user.
+func ParseJSONPath(expression string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(expression, "{") || !strings.HasSuffix(expression, "}") {
+		return nil, fmt.Errorf("JSONPath expression %q must be enclosed in curly braces, e.g. \"{.login}\"", expression)
+	}
+	j := jsonpath.New("profile").AllowMissingKeys(true)
+	if err := j.Parse(expression); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath expression %q: %w", expression, err)
+	}
+	return j, nil
+}
+
+func evaluate(expression string, profile interface{}) ([]interface{}, error) {
+	j, err := ParseJSONPath(expression)
+	if err != nil {
+		return nil, err
+	}
+	results, err := j.FindResults(profile)
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate JSONPath expression %q: %w", expression, err)
+	}
+	var values []interface{}
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, value.Interface())
+		}
+	}
+	return values, nil
+}
+
+// singleValue evaluates the expression, which must select exactly one non-empty string or number.
+func singleValue(expression string, profile interface{}) (string, error) {
+	values, err := evaluate(expression, profile)
+	if err != nil {
+		return "", err
+	}
+	if len(values) != 1 {
+		return "", fmt.Errorf("JSONPath expression %q must select exactly one value, but selected %d", expression, len(values))
+	}
+
+	var value string
+	switch v := values[0].(type) {
+	case string:
+		value = v
+	case json.Number:
+		value = v.String()
+	default:
+		return "", fmt.Errorf("JSONPath expression %q must select a string or a number, but selected %T", expression, v)
+	}
+	if value == "" {
+		return "", fmt.Errorf("JSONPath expression %q selected an empty string", expression)
+	}
+	return value, nil
+}
+
+// stringValues evaluates the expression, which must select strings or lists of strings.
+func stringValues(expression string, profile interface{}) ([]string, error) {
+	values, err := evaluate(expression, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var strs []string
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			strs = append(strs, v)
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("JSONPath expression %q must select strings or lists of strings, but selected a list containing %T", expression, item)
+				}
+				strs = append(strs, s)
+			}
+		default:
+			return nil, fmt.Errorf("JSONPath expression %q must select strings or lists of strings, but selected %T", expression, v)
+		}
+	}
+	return strs, nil
+}
@@ -0,0 +1,242 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamoauth2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"go.pinniped.dev/internal/oidc/provider"
+	"go.pinniped.dev/pkg/oidcclient/pkce"
+)
+
+func TestProviderConfig(t *testing.T) {
+	t.Run("getters get", func(t *testing.T) {
+		p := ProviderConfig{
+			Name:                     "test-name",
+			ResourceUID:              "test-uid",
+			AdditionalAuthcodeParams: map[string]string{"prompt": "consent"},
+			OAuth2Config: &oauth2.Config{
+				ClientID: "test-client-id",
+				Endpoint: oauth2.Endpoint{AuthURL: "https://example.com/authorize"},
+				Scopes:   []string{"profile", "offline"},
+			},
+		}
+		require.Equal(t, "test-name", p.GetName())
+		require.Equal(t, "test-uid", string(p.GetResourceUID()))
+		require.Equal(t, "test-client-id", p.GetClientID())
+		require.Equal(t, "https://example.com/authorize", p.GetAuthorizationURL())
+		require.Equal(t, []string{"profile", "offline"}, p.GetScopes())
+		require.Equal(t, map[string]string{"prompt": "consent"}, p.GetAdditionalAuthcodeParams())
+	})
+
+	t.Run("ExchangeAuthcode and PerformRefresh", func(t *testing.T) {
+		pkceCode := pkce.Code("test-pkce-verifier-which-is-long-enough-0123456789")
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, "/token", r.URL.Path)
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "test-client-id", r.Form.Get("client_id"))
+			require.Equal(t, "test-client-secret", r.Form.Get("client_secret"))
+			switch r.Form.Get("grant_type") {
+			case "authorization_code":
+				require.Equal(t, "https://example.com/callback", r.Form.Get("redirect_uri"))
+				require.Equal(t, string(pkceCode), r.Form.Get("code_verifier"))
+				if r.Form.Get("code") != "good-code" {
+					http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("content-type", "application/json")
+				_, _ = fmt.Fprint(w, `{"access_token":"test-access-token","refresh_token":"test-refresh-token","token_type":"bearer"}`)
+			case "refresh_token":
+				require.Equal(t, "test-refresh-token", r.Form.Get("refresh_token"))
+				w.Header().Set("content-type", "application/json")
+				_, _ = fmt.Fprint(w, `{"access_token":"new-access-token","refresh_token":"new-refresh-token","token_type":"bearer"}`)
+			default:
+				t.Errorf("unexpected grant type %q", r.Form.Get("grant_type"))
+			}
+		}))
+		t.Cleanup(server.Close)
+
+		p := ProviderConfig{
+			OAuth2Config: &oauth2.Config{
+				ClientID:     "test-client-id",
+				ClientSecret: "test-client-secret",
+				Endpoint: oauth2.Endpoint{
+					TokenURL:  server.URL + "/token",
+					AuthStyle: oauth2.AuthStyleInParams,
+				},
+			},
+			HTTPClient: server.Client(),
+		}
+
+		token, err := p.ExchangeAuthcode(context.Background(), "good-code", pkceCode, "https://example.com/callback")
+		require.NoError(t, err)
+		require.Equal(t, "test-access-token", token.AccessToken)
+		require.Equal(t, "test-refresh-token", token.RefreshToken)
+
+		token, err = p.ExchangeAuthcode(context.Background(), "bad-code", pkceCode, "https://example.com/callback")
+		require.EqualError(t, err, "oauth2: cannot fetch token: 400 Bad Request\nResponse: {\"error\":\"invalid_grant\"}\n")
+		require.Nil(t, token)
+
+		token, err = p.PerformRefresh(context.Background(), "test-refresh-token")
+		require.NoError(t, err)
+		require.Equal(t, "new-access-token", token.AccessToken)
+		require.Equal(t, "new-refresh-token", token.RefreshToken)
+	})
+}
+
+func TestGetUser(t *testing.T) {
+	t.Parallel()
+
+	const accessToken = "test-access-token"
+
+	tests := []struct {
+		name               string
+		profileJSON        string
+		profileStatus      int
+		usernameExpression string
+		groupsExpression   string
+		userIDExpression   string
+		wantUser           *provider.OAuth2User
+		wantErr            string
+	}{
+		{
+			name:               "username, groups and numeric user ID",
+			profileJSON:        `{"data":{"id":12345678901234567890,"login":"some-user","teams":[{"name":"team-2"},{"name":"team-1"},{"name":"team-2"}]}}`,
+			usernameExpression: "{.data.login}",
+			groupsExpression:   "{.data.teams[*].name}",
+			userIDExpression:   "{.data.id}",
+			wantUser: &provider.OAuth2User{
+				Username:          "some-user",
+				Groups:            []string{"team-1", "team-2"},
+				DownstreamSubject: "PROFILE_URL?sub=12345678901234567890",
+			},
+		},
+		{
+			name:               "groups from a list of strings and user ID defaults to username",
+			profileJSON:        `{"email":"user@example.com","roles":["admin","dev"]}`,
+			usernameExpression: "{.email}",
+			groupsExpression:   "{.roles}",
+			wantUser: &provider.OAuth2User{
+				Username:          "user@example.com",
+				Groups:            []string{"admin", "dev"},
+				DownstreamSubject: "PROFILE_URL?sub=user%40example.com",
+			},
+		},
+		{
+			name:               "no groups expression and missing groups",
+			profileJSON:        `{"login":"some-user"}`,
+			usernameExpression: "{.login}",
+			wantUser: &provider.OAuth2User{
+				Username:          "some-user",
+				Groups:            []string{},
+				DownstreamSubject: "PROFILE_URL?sub=some-user",
+			},
+		},
+		{
+			name:               "missing username",
+			profileJSON:        `{"name":"Some User"}`,
+			usernameExpression: "{.login}",
+			wantErr:            `could not determine username from user profile: JSONPath expression "{.login}" must select exactly one value, but selected 0`,
+		},
+		{
+			name:               "empty username",
+			profileJSON:        `{"login":""}`,
+			usernameExpression: "{.login}",
+			wantErr:            `could not determine username from user profile: JSONPath expression "{.login}" selected an empty string`,
+		},
+		{
+			name:               "username is not a string",
+			profileJSON:        `{"login":{"name":"some-user"}}`,
+			usernameExpression: "{.login}",
+			wantErr:            `could not determine username from user profile: JSONPath expression "{.login}" must select a string or a number, but selected map[string]interface {}`,
+		},
+		{
+			name:               "multiple user IDs",
+			profileJSON:        `{"login":"some-user","ids":[1,2]}`,
+			usernameExpression: "{.login}",
+			userIDExpression:   "{.ids[*]}",
+			wantErr:            `could not determine user ID from user profile: JSONPath expression "{.ids[*]}" must select exactly one value, but selected 2`,
+		},
+		{
+			name:               "groups are not strings",
+			profileJSON:        `{"login":"some-user","groups":[1,2]}`,
+			usernameExpression: "{.login}",
+			groupsExpression:   "{.groups}",
+			wantErr:            `could not determine groups from user profile: JSONPath expression "{.groups}" must select strings or lists of strings, but selected a list containing json.Number`,
+		},
+		{
+			name:               "profile endpoint returns an error",
+			profileStatus:      http.StatusUnauthorized,
+			usernameExpression: "{.login}",
+			wantErr:            `error fetching user profile: unexpected response status "401 Unauthorized" with body: {"error":"invalid_token"}` + "\n",
+		},
+		{
+			name:               "profile endpoint returns invalid JSON",
+			profileJSON:        `not json`,
+			usernameExpression: "{.login}",
+			wantErr:            `error fetching user profile: could not decode response: invalid character 'o' in literal null (expecting 'u')`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodGet, r.Method)
+				require.Equal(t, "/v1/me", r.URL.Path)
+				require.Equal(t, "Bearer "+accessToken, r.Header.Get("Authorization"))
+				require.Equal(t, "application/json", r.Header.Get("Accept"))
+				if tt.profileStatus != 0 {
+					http.Error(w, `{"error":"invalid_token"}`, tt.profileStatus)
+					return
+				}
+				w.Header().Set("content-type", "application/json")
+				_, _ = fmt.Fprint(w, tt.profileJSON)
+			}))
+			t.Cleanup(server.Close)
+
+			profileURL, err := url.Parse(server.URL + "/v1/me")
+			require.NoError(t, err)
+
+			p := ProviderConfig{
+				ProfileURL:         profileURL,
+				UsernameExpression: tt.usernameExpression,
+				GroupsExpression:   tt.groupsExpression,
+				UserIDExpression:   tt.userIDExpression,
+				HTTPClient:         server.Client(),
+			}
+
+			user, err := p.GetUser(context.Background(), accessToken)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, user)
+				return
+			}
+			require.NoError(t, err)
+			tt.wantUser.DownstreamSubject = profileURL.String() + tt.wantUser.DownstreamSubject[len("PROFILE_URL"):]
+			require.Equal(t, tt.wantUser, user)
+		})
+	}
+}
+
+func TestParseJSONPath(t *testing.T) {
+	_, err := ParseJSONPath("{.data.login}")
+	require.NoError(t, err)
+
+	_, err = ParseJSONPath(".data.login")
+	require.EqualError(t, err, `JSONPath expression ".data.login" must be enclosed in curly braces, e.g. "{.login}"`)
+
+	_, err = ParseJSONPath("{.data[}")
+	require.ErrorContains(t, err, `invalid JSONPath expression "{.data[}"`)
+}
@@ -0,0 +1,153 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamoidc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/util/keyutil"
+
+	"go.pinniped.dev/internal/httputil/roundtripper"
+)
+
+const (
+	// clientAssertionType is the value of the client_assertion_type parameter for JWT client assertions.
+	// See https://datatracker.ietf.org/doc/html/rfc7523#section-2.2.
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// clientAssertionLifetime is how long each client assertion is valid. A new assertion is signed for every request.
+	clientAssertionLifetime = 5 * time.Minute
+)
+
+// PrivateKeyJWT holds the key used to authenticate to the upstream token endpoint using the private_key_jwt client
+// authentication method, as described in https://openid.net/specs/openid-connect-core-1_0.html#ClientAuthentication
+// and https://datatracker.ietf.org/doc/html/rfc7523#section-2.2.
+type PrivateKeyJWT struct {
+	signer jose.Signer
+}
+
+// NewPrivateKeyJWT parses a PEM encoded RSA or ECDSA private key. The optional keyID will be sent as the "kid" header
+// of each client assertion, which some providers require to select the registered public key.
+func NewPrivateKeyJWT(keyPEM []byte, keyID string) (*PrivateKeyJWT, error) {
+	key, err := keyutil.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	alg, err := signatureAlgorithm(key)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: alg, Key: jose.JSONWebKey{Key: key, KeyID: keyID}},
+		(&jose.SignerOptions{}).WithType("JWT"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrivateKeyJWT{signer: signer}, nil
+}
+
+func signatureAlgorithm(key interface{}) (jose.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jose.RS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jose.ES256, nil
+		case elliptic.P384():
+			return jose.ES384, nil
+		case elliptic.P521():
+			return jose.ES512, nil
+		default:
+			return "", fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+	default:
+		return "", fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// assertion returns a newly signed client assertion. The client ID is used as both the issuer and the subject, and
+// the audience is the upstream's token endpoint.
+func (k *PrivateKeyJWT) assertion(clientID, audience string) (string, error) {
+	now := time.Now()
+	return jwt.Signed(k.signer).Claims(jwt.Claims{
+		Issuer:   clientID,
+		Subject:  clientID,
+		Audience: jwt.Audience{audience},
+		ID:       string(uuid.NewUUID()),
+		IssuedAt: jwt.NewNumericDate(now),
+		Expiry:   jwt.NewNumericDate(now.Add(clientAssertionLifetime)),
+	}).CompactSerialize()
+}
+
+// setParams replaces any client secret in the provided request parameters with a client assertion.
+func (k *PrivateKeyJWT) setParams(params url.Values, clientID, audience string) error {
+	assertion, err := k.assertion(clientID, audience)
+	if err != nil {
+		return fmt.Errorf("could not sign client assertion: %w", err)
+	}
+	params.Del("client_secret")
+	params.Set("client_id", clientID)
+	params.Set("client_assertion_type", clientAssertionType)
+	params.Set("client_assertion", assertion)
+	return nil
+}
+
+// httpClient returns a copy of the provided client which authenticates every POST to the token endpoint using a client
+// assertion. The oauth2 library does not allow adding parameters to password grant and refresh requests, so the
+// assertion is added by the client's transport instead. All other requests are unchanged.
+func (k *PrivateKeyJWT) httpClient(client *http.Client, clientID, tokenURL string) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	delegate := client.Transport
+	if delegate == nil {
+		delegate = http.DefaultTransport
+	}
+
+	c := *client
+	c.Transport = roundtripper.WrapFunc(delegate, func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPost || req.URL.String() != tokenURL {
+			return delegate.RoundTrip(req)
+		}
+
+		body, err := io.ReadAll(req.Body)
+		_ = req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read token request: %w", err)
+		}
+		params, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("could not parse token request: %w", err)
+		}
+		if err := k.setParams(params, clientID, tokenURL); err != nil {
+			return nil, err
+		}
+		encoded := params.Encode()
+
+		// The original request must not be modified by a RoundTripper, so send a copy.
+		r := req.Clone(req.Context())
+		r.Header.Del("Authorization") // the oauth2 library may have also tried to use basic auth with an empty secret
+		r.ContentLength = int64(len(encoded))
+		r.Body = io.NopCloser(strings.NewReader(encoded))
+		r.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(strings.NewReader(encoded)), nil }
+		return delegate.RoundTrip(r)
+	})
+	return &c
+}
@@ -0,0 +1,185 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamoidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+func TestNewPrivateKeyJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	p224Key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	require.NoError(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		keyPEM  []byte
+		wantAlg string
+		wantErr string
+	}{
+		{
+			name:    "RSA key in PKCS #1 format",
+			keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}),
+			wantAlg: "RS256",
+		},
+		{
+			name:    "ECDSA key in PKCS #8 format",
+			keyPEM:  pkcs8PEM(t, p384Key),
+			wantAlg: "ES384",
+		},
+		{
+			name:    "unsupported ECDSA curve",
+			keyPEM:  pkcs8PEM(t, p224Key),
+			wantErr: "unsupported ECDSA curve P-224",
+		},
+		{
+			name:    "unsupported key type",
+			keyPEM:  pkcs8PEM(t, ed25519Key),
+			wantErr: "unsupported private key type ed25519.PrivateKey",
+		},
+		{
+			name:    "not a key",
+			keyPEM:  []byte("not a key"),
+			wantErr: "data does not contain a valid RSA or ECDSA private key",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewPrivateKeyJWT(tt.keyPEM, "test-kid")
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, k)
+				return
+			}
+			require.NoError(t, err)
+
+			assertion, err := k.assertion("test-client-id", "https://example.com/token")
+			require.NoError(t, err)
+			jws, err := jose.ParseSigned(assertion)
+			require.NoError(t, err)
+			require.Len(t, jws.Signatures, 1)
+			require.Equal(t, tt.wantAlg, jws.Signatures[0].Header.Algorithm)
+			require.Equal(t, "test-kid", jws.Signatures[0].Header.KeyID)
+			require.Equal(t, "JWT", jws.Signatures[0].Header.ExtraHeaders[jose.HeaderType])
+		})
+	}
+}
+
+func TestPrivateKeyJWTClientAuthentication(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	privateKeyJWT, err := NewPrivateKeyJWT(pkcs8PEM(t, key), "")
+	require.NoError(t, err)
+
+	var tokenURL string
+	requireClientAssertion := func(t *testing.T, r *http.Request) {
+		t.Helper()
+		require.Empty(t, r.Header.Get("Authorization"))
+		require.NoError(t, r.ParseForm())
+		require.Empty(t, r.Form["client_secret"])
+		require.Equal(t, "test-client-id", r.Form.Get("client_id"))
+		require.Equal(t, "urn:ietf:params:oauth:client-assertion-type:jwt-bearer", r.Form.Get("client_assertion_type"))
+		requireValidClientAssertion(t, r.Form.Get("client_assertion"), &key.PublicKey, tokenURL)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			requireClientAssertion(t, r)
+			require.Equal(t, "refresh_token", r.Form.Get("grant_type"))
+			require.Equal(t, "test-initial-refresh-token", r.Form.Get("refresh_token"))
+			w.Header().Set("content-type", "application/json")
+			require.NoError(t, json.NewEncoder(w).Encode(&oauth2.Token{AccessToken: "test-access-token", TokenType: "Bearer"}))
+		case "/revoke":
+			requireClientAssertion(t, r)
+			require.Equal(t, "test-upstream-token", r.Form.Get("token"))
+			require.Equal(t, "refresh_token", r.Form.Get("token_type_hint"))
+			// Client assertions cannot be sent using basic auth, so this response must not cause a retry.
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+		default:
+			t.Fatalf("unexpected request to %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(server.Close)
+	tokenURL = server.URL + "/token"
+	revocationURL, err := url.Parse(server.URL + "/revoke")
+	require.NoError(t, err)
+
+	p := ProviderConfig{
+		Name: "test-name",
+		Config: &oauth2.Config{
+			ClientID: "test-client-id",
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  "https://example.com",
+				TokenURL: tokenURL,
+				// The auto-detected style will first try basic auth with an empty client secret.
+				AuthStyle: oauth2.AuthStyleAutoDetect,
+			},
+		},
+		PrivateKeyJWT: privateKeyJWT,
+		RevocationURL: revocationURL,
+		Client:        server.Client(),
+	}
+
+	tok, err := p.PerformRefresh(context.Background(), "test-initial-refresh-token")
+	require.NoError(t, err)
+	require.Equal(t, "test-access-token", tok.AccessToken)
+
+	err = p.RevokeToken(context.Background(), "test-upstream-token", provider.RefreshTokenType)
+	require.EqualError(t, err, `server responded with status 400 with body: {"error":"invalid_client"}`)
+}
+
+func requireValidClientAssertion(t *testing.T, assertion string, publicKey crypto.PublicKey, wantAudience string) {
+	t.Helper()
+
+	token, err := jwt.ParseSigned(assertion)
+	require.NoError(t, err)
+	var claims jwt.Claims
+	require.NoError(t, token.Claims(publicKey, &claims))
+	require.NoError(t, claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:   "test-client-id",
+		Subject:  "test-client-id",
+		Audience: jwt.Audience{wantAudience},
+		Time:     time.Now(),
+	}, 0))
+	require.NotEmpty(t, claims.ID)
+	require.Equal(t, 5*time.Minute, claims.Expiry.Time().Sub(claims.IssuedAt.Time()))
+}
+
+func pkcs8PEM(t *testing.T, key interface{}) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
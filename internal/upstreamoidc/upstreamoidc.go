@@ -7,6 +7,7 @@ package upstreamoidc
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -20,6 +21,7 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
 
+	"go.pinniped.dev/internal/claimexpression"
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/oidc"
 	"go.pinniped.dev/internal/oidc/provider"
@@ -29,6 +31,13 @@ import (
 	"go.pinniped.dev/pkg/oidcclient/pkce"
 )
 
+const (
+	// The names of the synthetic claims which hold the results of the username and groups expressions. They are added
+	// to the merged claims so that the rest of the Supervisor can treat them like any other configured claim.
+	usernameExpressionClaim = "pinniped:username-expression"
+	groupsExpressionClaim   = "pinniped:groups-expression"
+)
+
 func New(config *oauth2.Config, provider *coreosoidc.Provider, client *http.Client) provider.UpstreamOIDCIdentityProviderI {
 	return &ProviderConfig{Config: config, Provider: provider, Client: client}
 }
@@ -39,7 +48,10 @@ type ProviderConfig struct {
 	ResourceUID              types.UID
 	UsernameClaim            string
 	GroupsClaim              string
+	UsernameExpression       *claimexpression.UsernameExpression // when set, takes the place of UsernameClaim
+	GroupsExpression         *claimexpression.GroupsExpression   // when set, takes the place of GroupsClaim
 	Config                   *oauth2.Config
+	PrivateKeyJWT            *PrivateKeyJWT // when set, used instead of Config.ClientSecret for client authentication
 	Client                   *http.Client
 	AllowPasswordGrant       bool
 	AdditionalAuthcodeParams map[string]string
@@ -96,10 +108,16 @@ func (p *ProviderConfig) GetScopes() []string {
 }
 
 func (p *ProviderConfig) GetUsernameClaim() string {
+	if p.UsernameExpression != nil {
+		return usernameExpressionClaim
+	}
 	return p.UsernameClaim
 }
 
 func (p *ProviderConfig) GetGroupsClaim() string {
+	if p.GroupsExpression != nil {
+		return groupsExpressionClaim
+	}
 	return p.GroupsClaim
 }
 
@@ -115,7 +133,7 @@ func (p *ProviderConfig) PasswordCredentialsGrantAndValidateTokens(ctx context.C
 
 	// Note that this implicitly uses the scopes from p.Config.Scopes.
 	tok, err := p.Config.PasswordCredentialsToken(
-		coreosoidc.ClientContext(ctx, p.Client),
+		coreosoidc.ClientContext(ctx, p.tokenEndpointClient()),
 		username,
 		password,
 	)
@@ -131,7 +149,7 @@ func (p *ProviderConfig) PasswordCredentialsGrantAndValidateTokens(ctx context.C
 
 func (p *ProviderConfig) ExchangeAuthcodeAndValidateTokens(ctx context.Context, authcode string, pkceCodeVerifier pkce.Code, expectedIDTokenNonce nonce.Nonce, redirectURI string) (*oidctypes.Token, error) {
 	tok, err := p.Config.Exchange(
-		coreosoidc.ClientContext(ctx, p.Client),
+		coreosoidc.ClientContext(ctx, p.tokenEndpointClient()),
 		authcode,
 		pkceCodeVerifier.Verifier(),
 		oauth2.SetAuthURLParam("redirect_uri", redirectURI),
@@ -145,12 +163,21 @@ func (p *ProviderConfig) ExchangeAuthcodeAndValidateTokens(ctx context.Context,
 
 func (p *ProviderConfig) PerformRefresh(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
 	// Use the provided HTTP client to benefit from its CA, proxy, and other settings.
-	httpClientContext := coreosoidc.ClientContext(ctx, p.Client)
+	httpClientContext := coreosoidc.ClientContext(ctx, p.tokenEndpointClient())
 	// Create a TokenSource without an access token, so it thinks that a refresh is immediately required.
 	// Then ask it for the tokens to cause it to perform the refresh and return the results.
 	return p.Config.TokenSource(httpClientContext, &oauth2.Token{RefreshToken: refreshToken}).Token()
 }
 
+// tokenEndpointClient returns the HTTP client to use for requests to the token endpoint. When the private_key_jwt client
+// authentication method is configured, the client adds a client assertion to each token request.
+func (p *ProviderConfig) tokenEndpointClient() *http.Client {
+	if p.PrivateKeyJWT == nil {
+		return p.Client
+	}
+	return p.PrivateKeyJWT.httpClient(p.Client, p.Config.ClientID, p.Config.Endpoint.TokenURL)
+}
+
 // RevokeToken will attempt to revoke the given token, if the provider has a revocation endpoint.
 // It may return an error wrapped by a RetryableRevocationError, which is an error indicating that it may
 // be worth trying to revoke the same token again later. Any other error returned should be assumed to
@@ -163,9 +190,10 @@ func (p *ProviderConfig) RevokeToken(ctx context.Context, token string, tokenTyp
 		)
 		return nil
 	}
-	// First try using client auth in the request params.
+	// First try using client auth in the request params. Basic auth requires a client secret, so there is no other
+	// client auth method to try when using private_key_jwt or when only using a TLS client certificate.
 	tryAnotherClientAuthMethod, err := p.tryRevokeToken(ctx, token, tokenType, false)
-	if tryAnotherClientAuthMethod {
+	if tryAnotherClientAuthMethod && p.Config.ClientSecret != "" {
 		// Try again using basic auth this time. Overwrite the first client auth error,
 		// which isn't useful anymore when retrying.
 		_, err = p.tryRevokeToken(ctx, token, tokenType, true)
@@ -195,9 +223,19 @@ func (p *ProviderConfig) tryRevokeToken(
 		"token":           []string{token},
 		"token_type_hint": []string{string(tokenType)},
 	}
-	if !useBasicAuth {
+	switch {
+	case useBasicAuth:
+		// Client auth will be added as a header below.
+	case p.PrivateKeyJWT != nil:
+		// Client assertions always use the token endpoint as their audience, as recommended by the OIDC spec.
+		if err := p.PrivateKeyJWT.setParams(params, clientID, p.Config.Endpoint.TokenURL); err != nil {
+			return false, err
+		}
+	default:
 		params["client_id"] = []string{clientID}
-		params["client_secret"] = []string{clientSecret}
+		if clientSecret != "" {
+			params["client_secret"] = []string{clientSecret}
+		}
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.RevocationURL.String(), strings.NewReader(params.Encode()))
@@ -296,6 +334,10 @@ func (p *ProviderConfig) ValidateTokenAndMergeWithUserInfo(ctx context.Context,
 		}
 	}
 
+	if err := p.evaluateClaimExpressions(validatedClaims); err != nil {
+		return nil, httperr.Wrap(http.StatusUnprocessableEntity, "could not evaluate claim expressions", err)
+	}
+
 	return &oidctypes.Token{
 		AccessToken: &oidctypes.AccessToken{
 			Token:  tok.AccessToken,
@@ -391,6 +433,46 @@ func (p *ProviderConfig) maybeFetchUserInfoAndMergeClaims(ctx context.Context, t
 	return nil
 }
 
+// evaluateClaimExpressions computes the username and groups from the merged claims when expressions are configured,
+// and adds the results to the claims. When an expression refers to a claim which is not present, the result is
+// omitted from the claims, which is handled the same way as a missing username or groups claim would be.
+func (p *ProviderConfig) evaluateClaimExpressions(claims map[string]interface{}) error {
+	// The names of the results are reserved, so the upstream cannot choose the username or groups by returning claims
+	// with these names, e.g. when an expression refers to a claim which is missing.
+	delete(claims, usernameExpressionClaim)
+	delete(claims, groupsExpressionClaim)
+
+	if len(claims) == 0 {
+		return nil // e.g. a refresh without an ID token or userinfo endpoint, so there is nothing to map
+	}
+
+	if p.UsernameExpression != nil {
+		username, err := p.UsernameExpression.Evaluate(claims)
+		switch {
+		case errors.Is(err, claimexpression.ErrMissingClaim):
+			plog.Debug("username expression refers to a missing claim", "providerName", p.Name, "error", err.Error())
+		case err != nil:
+			return fmt.Errorf("username expression: %w", err)
+		default:
+			claims[usernameExpressionClaim] = username
+		}
+	}
+
+	if p.GroupsExpression != nil {
+		groups, err := p.GroupsExpression.Evaluate(claims)
+		switch {
+		case errors.Is(err, claimexpression.ErrMissingClaim):
+			plog.Debug("groups expression refers to a missing claim", "providerName", p.Name, "error", err.Error())
+		case err != nil:
+			return fmt.Errorf("groups expression: %w", err)
+		default:
+			claims[groupsExpressionClaim] = groups
+		}
+	}
+
+	return nil
+}
+
 func (p *ProviderConfig) maybeFetchUserInfo(ctx context.Context, tok *oauth2.Token, requireUserInfo bool) (*coreosoidc.UserInfo, error) {
 	// implementing the user info endpoint is not required by the OIDC spec, but we may require it in certain situations.
 	if !p.HasUserInfoURL() {
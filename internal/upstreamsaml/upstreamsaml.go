@@ -0,0 +1,159 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamsaml implements an abstraction of upstream SAML identity provider interactions.
+package upstreamsaml
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/crewjam/saml"
+	dsig "github.com/russellhaering/goxmldsig"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+// ProviderConfig holds the active configuration of an upstream SAML identity provider.
+type ProviderConfig struct {
+	Name        string
+	ResourceUID types.UID
+
+	// UsernameAttribute is the name of the attribute to use as the username. When empty, the NameID is used.
+	UsernameAttribute string
+
+	// GroupsAttribute is the name of the attribute to use as the groups. When empty, there are no groups.
+	GroupsAttribute string
+
+	// IDPMetadata is the metadata of the identity provider, which includes its signing certificates.
+	IDPMetadata *saml.EntityDescriptor
+
+	// Key and Certificate are the optional key pair of the service provider, which are used to sign authentication
+	// requests and to decrypt encrypted assertions.
+	Key         *rsa.PrivateKey
+	Certificate *x509.Certificate
+}
+
+var _ provider.UpstreamSAMLIdentityProviderI = (*ProviderConfig)(nil)
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+// AuthnRequestURL returns the URL of the single sign-on service of the identity provider, including a SAML
+// authentication request using the HTTP-Redirect binding. The request is signed when the provider has a key pair.
+func (p *ProviderConfig) AuthnRequestURL(sp provider.SAMLServiceProvider, requestID string, relayState string) (*url.URL, error) {
+	serviceProvider := p.serviceProvider(sp)
+
+	ssoURL := serviceProvider.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if ssoURL == "" {
+		return nil, errors.New("identity provider metadata does not contain a single sign-on service with the HTTP-Redirect binding")
+	}
+
+	authnRequest, err := serviceProvider.MakeAuthenticationRequest(ssoURL, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		return nil, err
+	}
+	// Use our own request ID, so that it can be remembered in the relay state and validated in the response.
+	authnRequest.ID = requestID
+
+	// The relay state is not escaped by the library, but it must be escaped before it is signed.
+	return authnRequest.Redirect(url.QueryEscape(relayState), serviceProvider)
+}
+
+// ParseResponse validates the SAML response which was posted to the assertion consumer service, including its
+// signature, audience, destination, validity period, and that it is a response to the given request ID. It returns
+// the identity of the user from the assertion.
+func (p *ProviderConfig) ParseResponse(r *http.Request, sp provider.SAMLServiceProvider, requestID string) (*provider.SAMLUser, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	assertion, err := p.serviceProvider(sp).ParseResponse(r, []string{requestID})
+	if err != nil {
+		var invalidResponseErr *saml.InvalidResponseError
+		if errors.As(err, &invalidResponseErr) {
+			// The Error() method of this type intentionally hides the details, which are useful in our logs.
+			return nil, fmt.Errorf("invalid SAML response: %w", invalidResponseErr.PrivateErr)
+		}
+		return nil, err
+	}
+
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		return nil, errors.New("SAML assertion does not contain a NameID")
+	}
+	nameID := assertion.Subject.NameID.Value
+
+	username := nameID
+	if p.UsernameAttribute != "" {
+		values := attributeValues(assertion, p.UsernameAttribute)
+		if len(values) != 1 || values[0] == "" {
+			return nil, fmt.Errorf("SAML assertion must contain exactly one non-empty value for username attribute %q, but found %d values",
+				p.UsernameAttribute, len(values))
+		}
+		username = values[0]
+	}
+
+	var groups []string
+	if p.GroupsAttribute != "" {
+		groups = sets.NewString(attributeValues(assertion, p.GroupsAttribute)...).List()
+	}
+
+	var sessionNotOnOrAfter time.Time
+	for _, authnStatement := range assertion.AuthnStatements {
+		if authnStatement.SessionNotOnOrAfter != nil &&
+			(sessionNotOnOrAfter.IsZero() || authnStatement.SessionNotOnOrAfter.Before(sessionNotOnOrAfter)) {
+			sessionNotOnOrAfter = *authnStatement.SessionNotOnOrAfter
+		}
+	}
+
+	return &provider.SAMLUser{
+		Username:            username,
+		Groups:              groups,
+		DownstreamSubject:   fmt.Sprintf("%s?%s=%s", p.IDPMetadata.EntityID, oidc.IDTokenSubjectClaim, url.QueryEscape(nameID)),
+		SessionNotOnOrAfter: sessionNotOnOrAfter,
+	}, nil
+}
+
+func (p *ProviderConfig) serviceProvider(sp provider.SAMLServiceProvider) *saml.ServiceProvider {
+	serviceProvider := &saml.ServiceProvider{
+		EntityID:          sp.EntityID,
+		AcsURL:            sp.ACSURL,
+		IDPMetadata:       p.IDPMetadata,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+	}
+	if p.Key != nil {
+		serviceProvider.Key = p.Key
+		serviceProvider.Certificate = p.Certificate
+		serviceProvider.SignatureMethod = dsig.RSASHA256SignatureMethod
+	}
+	return serviceProvider
+}
+
+// attributeValues returns the values of all attributes of the assertion whose Name or FriendlyName is the given name.
+func attributeValues(assertion *saml.Assertion, name string) []string {
+	var values []string
+	for _, statement := range assertion.AttributeStatements {
+		for _, attribute := range statement.Attributes {
+			if attribute.Name != name && attribute.FriendlyName != name {
+				continue
+			}
+			for _, value := range attribute.Values {
+				values = append(values, value.Value)
+			}
+		}
+	}
+	return values
+}
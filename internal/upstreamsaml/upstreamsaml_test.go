@@ -0,0 +1,237 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamsaml
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+func TestProviderConfig(t *testing.T) {
+	p := ProviderConfig{Name: "test-name", ResourceUID: "test-uid"}
+	require.Equal(t, "test-name", p.GetName())
+	require.Equal(t, "test-uid", string(p.GetResourceUID()))
+}
+
+// fakeServiceProviderProvider returns the metadata of the only service provider which is known to the fake IDP.
+type fakeServiceProviderProvider struct {
+	metadata *saml.EntityDescriptor
+}
+
+func (f *fakeServiceProviderProvider) GetServiceProvider(_ *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if serviceProviderID != f.metadata.EntityID {
+		return nil, os.ErrNotExist
+	}
+	return f.metadata, nil
+}
+
+// sessionNotOnOrAfterAssertionMaker makes the default assertion, plus an optional SessionNotOnOrAfter.
+type sessionNotOnOrAfterAssertionMaker struct {
+	sessionNotOnOrAfter *time.Time
+}
+
+func (m sessionNotOnOrAfterAssertionMaker) MakeAssertion(req *saml.IdpAuthnRequest, session *saml.Session) error {
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		return err
+	}
+	req.Assertion.AuthnStatements[0].SessionNotOnOrAfter = m.sessionNotOnOrAfter
+	return nil
+}
+
+func newKeyPair(t *testing.T, commonName string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return key, cert
+}
+
+func TestAuthnRequestAndResponse(t *testing.T) {
+	t.Parallel()
+
+	idpKey, idpCert := newKeyPair(t, "idp")
+	spKey, spCert := newKeyPair(t, "sp")
+	otherIDPKey, otherIDPCert := newKeyPair(t, "other-idp")
+
+	idpMetadataURL, err := url.Parse("https://idp.example.com/metadata")
+	require.NoError(t, err)
+	idpSSOURL, err := url.Parse("https://idp.example.com/sso")
+	require.NoError(t, err)
+	acsURL, err := url.Parse("https://pinniped.example.com/issuer/saml/acs")
+	require.NoError(t, err)
+	sp := provider.SAMLServiceProvider{EntityID: "https://pinniped.example.com/issuer", ACSURL: *acsURL}
+
+	sessionNotOnOrAfter := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	tests := []struct {
+		name                string
+		withKeyPair         bool
+		usernameAttribute   string
+		groupsAttribute     string
+		session             *saml.Session
+		sessionNotOnOrAfter *time.Time
+		responseRequestID   string
+		signWithOtherIDPKey bool
+		wantUser            *provider.SAMLUser
+		wantErr             string
+	}{
+		{
+			name:    "username from NameID without groups",
+			session: &saml.Session{NameID: "some-name-id", UserName: "some-user", Groups: []string{"g1"}},
+			wantUser: &provider.SAMLUser{
+				Username:          "some-name-id",
+				DownstreamSubject: "https://idp.example.com/metadata?sub=some-name-id",
+			},
+		},
+		{
+			name:              "username and groups from attributes matched by FriendlyName and Name, with signed requests and encrypted assertions",
+			withKeyPair:       true,
+			usernameAttribute: "uid",
+			groupsAttribute:   "urn:oid:1.3.6.1.4.1.5923.1.1.1.1",
+			session: &saml.Session{
+				NameID:   "some name/id",
+				UserName: "some-user",
+				Groups:   []string{"g2", "g1", "g2"},
+			},
+			sessionNotOnOrAfter: &sessionNotOnOrAfter,
+			wantUser: &provider.SAMLUser{
+				Username:            "some-user",
+				Groups:              []string{"g1", "g2"},
+				DownstreamSubject:   "https://idp.example.com/metadata?sub=some+name%2Fid",
+				SessionNotOnOrAfter: sessionNotOnOrAfter,
+			},
+		},
+		{
+			name:              "username attribute is missing",
+			usernameAttribute: "mail",
+			session:           &saml.Session{NameID: "some-name-id", UserName: "some-user"},
+			wantErr:           `SAML assertion must contain exactly one non-empty value for username attribute "mail", but found 0 values`,
+		},
+		{
+			name:              "username attribute has multiple values",
+			usernameAttribute: "multi",
+			session: &saml.Session{NameID: "some-name-id", CustomAttributes: []saml.Attribute{{
+				Name:   "multi",
+				Values: []saml.AttributeValue{{Type: "xs:string", Value: "a"}, {Type: "xs:string", Value: "b"}},
+			}}},
+			wantErr: `SAML assertion must contain exactly one non-empty value for username attribute "multi", but found 2 values`,
+		},
+		{
+			name:              "response to a different request",
+			session:           &saml.Session{NameID: "some-name-id"},
+			responseRequestID: "id-some-other-request",
+			wantErr:           "invalid SAML response: `InResponseTo` does not match any of the possible request IDs (expected [id-test-request-id])",
+		},
+		{
+			name:                "response signed by another key",
+			session:             &saml.Session{NameID: "some-name-id"},
+			signWithOtherIDPKey: true,
+			wantErr:             "invalid SAML response: cannot validate signature on Response: Could not verify certificate against trusted certs",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			idp := &saml.IdentityProvider{
+				Key:            idpKey,
+				Certificate:    idpCert,
+				MetadataURL:    *idpMetadataURL,
+				SSOURL:         *idpSSOURL,
+				AssertionMaker: sessionNotOnOrAfterAssertionMaker{sessionNotOnOrAfter: tt.sessionNotOnOrAfter},
+			}
+
+			p := &ProviderConfig{
+				UsernameAttribute: tt.usernameAttribute,
+				GroupsAttribute:   tt.groupsAttribute,
+				IDPMetadata:       idp.Metadata(),
+			}
+			if tt.withKeyPair {
+				p.Key = spKey
+				p.Certificate = spCert
+			}
+			idp.ServiceProviderProvider = &fakeServiceProviderProvider{metadata: p.serviceProvider(sp).Metadata()}
+
+			authnRequestURL, err := p.AuthnRequestURL(sp, "id-test-request-id", "some state&more")
+			require.NoError(t, err)
+			require.True(t, strings.HasPrefix(authnRequestURL.String(), "https://idp.example.com/sso?"))
+			require.Equal(t, "some state&more", authnRequestURL.Query().Get("RelayState"))
+			if tt.withKeyPair {
+				require.NotEmpty(t, authnRequestURL.Query().Get("Signature"))
+			} else {
+				require.Empty(t, authnRequestURL.Query().Get("Signature"))
+			}
+
+			// Act as the IDP to process the request and make a response.
+			idpReq, err := saml.NewIdpAuthnRequest(idp, httptest.NewRequest(http.MethodGet, authnRequestURL.String(), nil))
+			require.NoError(t, err)
+			require.NoError(t, idpReq.Validate())
+			require.Equal(t, "id-test-request-id", idpReq.Request.ID)
+			if tt.responseRequestID != "" {
+				idpReq.Request.ID = tt.responseRequestID
+			}
+			if tt.signWithOtherIDPKey {
+				idp.Key = otherIDPKey
+				idp.Certificate = otherIDPCert
+			}
+			require.NoError(t, idp.AssertionMaker.MakeAssertion(idpReq, tt.session))
+			require.NoError(t, idpReq.MakeResponse())
+			form, err := idpReq.PostBinding()
+			require.NoError(t, err)
+			require.Equal(t, acsURL.String(), form.URL)
+
+			// Post the response to the ACS.
+			body := url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}.Encode()
+			acsReq := httptest.NewRequest(http.MethodPost, acsURL.String(), strings.NewReader(body))
+			acsReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			user, err := p.ParseResponse(acsReq, sp, "id-test-request-id")
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				require.Nil(t, user)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantUser, user)
+		})
+	}
+}
+
+func TestAuthnRequestURLRequiresRedirectBinding(t *testing.T) {
+	p := &ProviderConfig{IDPMetadata: &saml.EntityDescriptor{
+		EntityID: "https://idp.example.com/metadata",
+		IDPSSODescriptors: []saml.IDPSSODescriptor{{SingleSignOnServices: []saml.Endpoint{
+			{Binding: saml.HTTPPostBinding, Location: "https://idp.example.com/sso"},
+		}}},
+	}}
+	authnRequestURL, err := p.AuthnRequestURL(provider.SAMLServiceProvider{EntityID: "https://pinniped.example.com/issuer"}, "id-1", "state")
+	require.EqualError(t, err, "identity provider metadata does not contain a single sign-on service with the HTTP-Redirect binding")
+	require.Nil(t, authnRequestURL)
+}
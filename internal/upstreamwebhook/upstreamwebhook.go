@@ -0,0 +1,179 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamwebhook implements an abstraction of upstream identity providers which validate usernames and
+// passwords using an HTTPS webhook.
+package upstreamwebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/oidc/downstreamsession"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+const (
+	// The maximum size of a response body from the webhook which we are willing to read.
+	maxResponseBodySize = 1024 * 1024
+
+	requestTypeAuthenticate = "authenticate"
+	requestTypeRefresh      = "refresh"
+)
+
+// ProviderConfig holds the active configuration of an upstream webhook identity provider.
+type ProviderConfig struct {
+	Name        string
+	ResourceUID types.UID
+
+	// Endpoint is the URL of the webhook.
+	Endpoint *url.URL
+
+	// BearerToken is sent to the webhook in the "Authorization" header, when it is not empty.
+	BearerToken string
+
+	HTTPClient *http.Client
+}
+
+var _ provider.UpstreamLDAPIdentityProviderI = (*ProviderConfig)(nil)
+
+// webhookRequest is the body of a request to the webhook.
+type webhookRequest struct {
+	Type     string `json:"type"`
+	Username string `json:"username"`
+	Password string `json:"password,omitempty"`
+	UID      string `json:"uid,omitempty"`
+}
+
+// webhookResponse is the body of a response from the webhook.
+type webhookResponse struct {
+	Authenticated bool         `json:"authenticated"`
+	User          *webhookUser `json:"user,omitempty"`
+}
+
+type webhookUser struct {
+	Username string   `json:"username"`
+	UID      string   `json:"uid"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+// GetURL returns the URL of the webhook, which is combined with the UIDs of the users to form the subjects of
+// the downstream ID tokens.
+func (p *ProviderConfig) GetURL() *url.URL {
+	return p.Endpoint
+}
+
+// AuthenticateUser asks the webhook to validate the username and password.
+func (p *ProviderConfig) AuthenticateUser(ctx context.Context, username, password string) (*authenticators.Response, bool, error) {
+	if username == "" || password == "" {
+		return nil, false, nil
+	}
+
+	webhookUser, err := p.call(ctx, &webhookRequest{Type: requestTypeAuthenticate, Username: username, Password: password})
+	if err != nil {
+		return nil, false, fmt.Errorf(`error authenticating user %q using webhook identity provider %q: %w`, username, p.Name, err)
+	}
+	if webhookUser == nil {
+		return nil, false, nil
+	}
+
+	return &authenticators.Response{
+		User: &user.DefaultInfo{
+			Name:   webhookUser.Username,
+			UID:    webhookUser.UID,
+			Groups: webhookUser.Groups,
+		},
+	}, true, nil
+}
+
+// PerformRefresh asks the webhook to revalidate the user, and returns their current groups. It returns an error
+// when the user is no longer valid, or when their identity has changed since they logged in.
+func (p *ProviderConfig) PerformRefresh(ctx context.Context, storedRefreshAttributes provider.StoredRefreshAttributes) ([]string, error) {
+	username := storedRefreshAttributes.Username
+	uid := storedRefreshAttributes.UID
+
+	webhookUser, err := p.call(ctx, &webhookRequest{Type: requestTypeRefresh, Username: username, UID: uid})
+	if err != nil {
+		return nil, fmt.Errorf(`error refreshing user %q using webhook identity provider %q: %w`, username, p.Name, err)
+	}
+	if webhookUser == nil {
+		return nil, fmt.Errorf(`user %q is no longer valid according to webhook identity provider %q`, username, p.Name)
+	}
+
+	if webhookUser.Username != username {
+		return nil, fmt.Errorf(`refreshing user %q returned a different username: %q`, username, webhookUser.Username)
+	}
+	newSubject := downstreamsession.DownstreamLDAPSubject(webhookUser.UID, *p.GetURL())
+	if newSubject != storedRefreshAttributes.Subject {
+		return nil, fmt.Errorf(`refreshing user %q produced a different subject than the previous value. expected: %q, actual: %q`,
+			username, storedRefreshAttributes.Subject, newSubject)
+	}
+
+	return webhookUser.Groups, nil
+}
+
+// call sends the request to the webhook, and returns the user from the response. It returns a nil user when the
+// webhook responded that the user is not authenticated.
+func (p *ProviderConfig) call(ctx context.Context, webhookReq *webhookRequest) (*webhookUser, error) {
+	reqBody, err := json.Marshal(webhookReq)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Endpoint.String(), bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if p.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.BearerToken)
+	}
+
+	resp, err := p.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodySize))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status %q with body: %s", resp.Status, respBody)
+	}
+
+	var webhookResp webhookResponse
+	if err := json.Unmarshal(respBody, &webhookResp); err != nil {
+		return nil, fmt.Errorf("could not decode response: %w", err)
+	}
+	if !webhookResp.Authenticated {
+		return nil, nil
+	}
+	if webhookResp.User == nil || webhookResp.User.Username == "" || webhookResp.User.UID == "" {
+		return nil, errors.New("response must include the username and uid of an authenticated user")
+	}
+
+	webhookResp.User.Groups = sets.NewString(webhookResp.User.Groups...).List()
+	return webhookResp.User, nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apiserver/pkg/authentication/user"
+
+	"go.pinniped.dev/internal/authenticators"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+func TestProviderConfig(t *testing.T) {
+	t.Run("getters get", func(t *testing.T) {
+		p := ProviderConfig{
+			Name:        "test-name",
+			ResourceUID: "test-uid",
+			Endpoint:    &url.URL{Scheme: "https", Host: "users.example.com", Path: "/pinniped"},
+		}
+		require.Equal(t, "test-name", p.GetName())
+		require.Equal(t, "test-uid", string(p.GetResourceUID()))
+		require.Equal(t, "https://users.example.com/pinniped", p.GetURL().String())
+		_, isKerberos := interface{}(&p).(provider.UpstreamKerberosIdentityProviderI)
+		require.False(t, isKerberos)
+	})
+
+	tests := []struct {
+		name           string
+		bearerToken    string
+		responseStatus int
+		responseBody   string
+		wantRequest    webhookRequest
+		call           func(p *ProviderConfig, serverURL string) (interface{}, error)
+		wantResult     interface{}
+		wantErr        string
+	}{
+		{
+			name:           "AuthenticateUser when the webhook authenticates the user",
+			bearerToken:    "some-bearer-token",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": true, "user": {"username": "pinny", "uid": "1234", "groups": ["b", "a", "b"]}}`,
+			wantRequest:    webhookRequest{Type: "authenticate", Username: "pinny", Password: "some-password"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				response, authenticated, err := p.AuthenticateUser(context.Background(), "pinny", "some-password")
+				require.Equal(t, err == nil, authenticated)
+				return response, err
+			},
+			wantResult: &authenticators.Response{
+				User: &user.DefaultInfo{Name: "pinny", UID: "1234", Groups: []string{"a", "b"}},
+			},
+		},
+		{
+			name:           "AuthenticateUser when the webhook does not authenticate the user",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": false}`,
+			wantRequest:    webhookRequest{Type: "authenticate", Username: "pinny", Password: "wrong-password"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				response, authenticated, err := p.AuthenticateUser(context.Background(), "pinny", "wrong-password")
+				require.False(t, authenticated)
+				return response, err
+			},
+			wantResult: (*authenticators.Response)(nil),
+		},
+		{
+			name:           "AuthenticateUser when the webhook returns an error status",
+			responseStatus: http.StatusInternalServerError,
+			responseBody:   `some error`,
+			wantRequest:    webhookRequest{Type: "authenticate", Username: "pinny", Password: "some-password"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				response, authenticated, err := p.AuthenticateUser(context.Background(), "pinny", "some-password")
+				require.False(t, authenticated)
+				return response, err
+			},
+			wantErr: `error authenticating user "pinny" using webhook identity provider "test-name": unexpected response status "500 Internal Server Error" with body: some error`,
+		},
+		{
+			name:           "AuthenticateUser when the webhook does not return the uid of an authenticated user",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": true, "user": {"username": "pinny"}}`,
+			wantRequest:    webhookRequest{Type: "authenticate", Username: "pinny", Password: "some-password"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				response, authenticated, err := p.AuthenticateUser(context.Background(), "pinny", "some-password")
+				require.False(t, authenticated)
+				return response, err
+			},
+			wantErr: `error authenticating user "pinny" using webhook identity provider "test-name": response must include the username and uid of an authenticated user`,
+		},
+		{
+			name:           "AuthenticateUser when the webhook returns invalid JSON",
+			responseStatus: http.StatusOK,
+			responseBody:   `not json`,
+			wantRequest:    webhookRequest{Type: "authenticate", Username: "pinny", Password: "some-password"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				response, authenticated, err := p.AuthenticateUser(context.Background(), "pinny", "some-password")
+				require.False(t, authenticated)
+				return response, err
+			},
+			wantErr: `error authenticating user "pinny" using webhook identity provider "test-name": could not decode response: invalid character 'o' in literal null (expecting 'u')`,
+		},
+		{
+			name:           "PerformRefresh when the user is still valid",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": true, "user": {"username": "pinny", "uid": "1234", "groups": ["c"]}}`,
+			wantRequest:    webhookRequest{Type: "refresh", Username: "pinny", UID: "1234"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				return p.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
+					Username: "pinny",
+					Subject:  serverURL + "/pinniped?sub=1234",
+					UID:      "1234",
+				})
+			},
+			wantResult: []string{"c"},
+		},
+		{
+			name:           "PerformRefresh when the user is no longer valid",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": false}`,
+			wantRequest:    webhookRequest{Type: "refresh", Username: "pinny", UID: "1234"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				return p.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
+					Username: "pinny",
+					Subject:  serverURL + "/pinniped?sub=1234",
+					UID:      "1234",
+				})
+			},
+			wantErr: `user "pinny" is no longer valid according to webhook identity provider "test-name"`,
+		},
+		{
+			name:           "PerformRefresh when the webhook returns a different username",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": true, "user": {"username": "someone-else", "uid": "1234"}}`,
+			wantRequest:    webhookRequest{Type: "refresh", Username: "pinny", UID: "1234"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				return p.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
+					Username: "pinny",
+					Subject:  serverURL + "/pinniped?sub=1234",
+					UID:      "1234",
+				})
+			},
+			wantErr: `refreshing user "pinny" returned a different username: "someone-else"`,
+		},
+		{
+			name:           "PerformRefresh when the webhook returns a different uid",
+			responseStatus: http.StatusOK,
+			responseBody:   `{"authenticated": true, "user": {"username": "pinny", "uid": "5678"}}`,
+			wantRequest:    webhookRequest{Type: "refresh", Username: "pinny", UID: "1234"},
+			call: func(p *ProviderConfig, serverURL string) (interface{}, error) {
+				return p.PerformRefresh(context.Background(), provider.StoredRefreshAttributes{
+					Username: "pinny",
+					Subject:  serverURL + "/pinniped?sub=1234",
+					UID:      "1234",
+				})
+			},
+			wantErr: `refreshing user "pinny" produced a different subject than the previous value. expected: "SERVER_URL/pinniped?sub=1234", actual: "SERVER_URL/pinniped?sub=5678"`,
+		},
+	}
+	for _, test := range tests {
+		tt := test
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, http.MethodPost, r.Method)
+				require.Equal(t, "/pinniped", r.URL.Path)
+				require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				if tt.bearerToken != "" {
+					require.Equal(t, "Bearer "+tt.bearerToken, r.Header.Get("Authorization"))
+				} else {
+					require.Empty(t, r.Header.Get("Authorization"))
+				}
+				var gotRequest webhookRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&gotRequest))
+				require.Equal(t, tt.wantRequest, gotRequest)
+				w.WriteHeader(tt.responseStatus)
+				_, _ = fmt.Fprint(w, tt.responseBody)
+			}))
+			t.Cleanup(server.Close)
+
+			endpoint, err := url.Parse(server.URL + "/pinniped")
+			require.NoError(t, err)
+			p := &ProviderConfig{
+				Name:        "test-name",
+				Endpoint:    endpoint,
+				BearerToken: tt.bearerToken,
+				HTTPClient:  server.Client(),
+			}
+
+			result, err := tt.call(p, server.URL)
+			if tt.wantErr != "" {
+				// The subjects in the errors refer to the URL of the test server.
+				require.EqualError(t, err, strings.ReplaceAll(tt.wantErr, "SERVER_URL", server.URL))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResult, result)
+		})
+	}
+}
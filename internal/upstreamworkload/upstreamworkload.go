@@ -0,0 +1,164 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package upstreamworkload implements an abstraction of external issuers of JWTs to workloads, e.g. Kubernetes
+// service accounts or CI pipelines, whose JWTs may be exchanged for downstream tokens.
+package upstreamworkload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
+	"k8s.io/apimachinery/pkg/types"
+
+	"go.pinniped.dev/internal/claimexpression"
+	"go.pinniped.dev/internal/oidc"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+// defaultUsernameClaim is used as the username when neither a username claim nor a username expression is configured.
+const defaultUsernameClaim = oidc.IDTokenSubjectClaim
+
+// ProviderConfig holds the active configuration of a workload identity provider.
+type ProviderConfig struct {
+	Name        string
+	ResourceUID types.UID
+
+	// Issuer is the issuer of the JWTs, which is also the issuer of the discovery document of Provider.
+	Issuer string
+
+	// Audience must be one of the audiences of the JWTs.
+	Audience string
+
+	UsernameClaim      string
+	GroupsClaim        string
+	UsernameExpression *claimexpression.UsernameExpression // when set, takes the place of UsernameClaim
+	GroupsExpression   *claimexpression.GroupsExpression   // when set, takes the place of GroupsClaim
+
+	// Conditions must all be true for a JWT to be accepted.
+	Conditions []*claimexpression.ConditionExpression
+
+	Client   *http.Client
+	Provider interface {
+		Verifier(*coreosoidc.Config) *coreosoidc.IDTokenVerifier
+	}
+}
+
+var _ provider.WorkloadIdentityProviderI = (*ProviderConfig)(nil)
+
+func (p *ProviderConfig) GetName() string {
+	return p.Name
+}
+
+func (p *ProviderConfig) GetResourceUID() types.UID {
+	return p.ResourceUID
+}
+
+func (p *ProviderConfig) GetIssuer() string {
+	return p.Issuer
+}
+
+// AuthenticateToken verifies the signature, issuer, audience, and expiry of the JWT, checks the conditions, and maps
+// its claims to a downstream identity. The downstream subject combines the issuer and the subject of the JWT in the
+// same way as for the users of OIDC identity providers.
+func (p *ProviderConfig) AuthenticateToken(ctx context.Context, token string) (*provider.WorkloadIdentity, error) {
+	verified, err := p.Provider.Verifier(&coreosoidc.Config{ClientID: p.Audience}).Verify(coreosoidc.ClientContext(ctx, p.Client), token)
+	if err != nil {
+		return nil, fmt.Errorf("workload identity provider %q could not verify the token: %w", p.Name, err)
+	}
+	if verified.Subject == "" {
+		return nil, fmt.Errorf("workload identity provider %q requires the token to have a %q claim", p.Name, oidc.IDTokenSubjectClaim)
+	}
+
+	var claims map[string]interface{}
+	if err := verified.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("workload identity provider %q could not read the claims of the token: %w", p.Name, err)
+	}
+
+	for _, condition := range p.Conditions {
+		ok, err := condition.Evaluate(claims)
+		if errors.Is(err, claimexpression.ErrMissingClaim) {
+			ok, err = false, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("workload identity provider %q could not evaluate the condition %q: %w", p.Name, condition.Source(), err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("workload identity provider %q rejected the token because the condition %q is false", p.Name, condition.Source())
+		}
+	}
+
+	username, err := p.username(claims)
+	if err != nil {
+		return nil, fmt.Errorf("workload identity provider %q could not determine the username: %w", p.Name, err)
+	}
+	groups, err := p.groups(claims)
+	if err != nil {
+		return nil, fmt.Errorf("workload identity provider %q could not determine the groups: %w", p.Name, err)
+	}
+
+	return &provider.WorkloadIdentity{
+		Username:          username,
+		Groups:            groups,
+		DownstreamSubject: fmt.Sprintf("%s?%s=%s", verified.Issuer, oidc.IDTokenSubjectClaim, url.QueryEscape(verified.Subject)),
+	}, nil
+}
+
+func (p *ProviderConfig) username(claims map[string]interface{}) (string, error) {
+	var username string
+	if p.UsernameExpression != nil {
+		var err error
+		if username, err = p.UsernameExpression.Evaluate(claims); err != nil {
+			return "", err
+		}
+	} else {
+		claimName := p.UsernameClaim
+		if claimName == "" {
+			claimName = defaultUsernameClaim
+		}
+		var ok bool
+		if username, ok = claims[claimName].(string); !ok {
+			return "", fmt.Errorf("the %q claim is missing or is not a string", claimName)
+		}
+	}
+	if username == "" {
+		return "", errors.New("the username must not be empty")
+	}
+	return username, nil
+}
+
+// groups returns the group names of the workload, which may be empty. A missing groups claim means no groups.
+func (p *ProviderConfig) groups(claims map[string]interface{}) ([]string, error) {
+	if p.GroupsExpression != nil {
+		return p.GroupsExpression.Evaluate(claims)
+	}
+	if p.GroupsClaim == "" {
+		return []string{}, nil
+	}
+
+	groups := []string{}
+	switch value := claims[p.GroupsClaim].(type) {
+	case nil:
+	case string:
+		if value != "" {
+			groups = append(groups, value)
+		}
+	case []interface{}:
+		for _, item := range value {
+			group, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("the %q claim must be a string or a list of strings", p.GroupsClaim)
+			}
+			if group != "" {
+				groups = append(groups, group)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("the %q claim must be a string or a list of strings", p.GroupsClaim)
+	}
+	return groups, nil
+}
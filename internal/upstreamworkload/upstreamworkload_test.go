@@ -0,0 +1,278 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package upstreamworkload
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	coreosoidc "github.com/coreos/go-oidc/v3/oidc"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.pinniped.dev/internal/claimexpression"
+	"go.pinniped.dev/internal/oidc/provider"
+)
+
+const (
+	testIssuer   = "https://token.actions.example.com"
+	testAudience = "https://supervisor.example.com/workloads"
+)
+
+// staticKeySet verifies signatures with a single public key instead of fetching a JWKS.
+type staticKeySet struct {
+	publicKey *ecdsa.PublicKey
+}
+
+func (s *staticKeySet) VerifySignature(_ context.Context, token string) ([]byte, error) {
+	parsed, err := jose.ParseSigned(token)
+	if err != nil {
+		return nil, err
+	}
+	return parsed.Verify(s.publicKey)
+}
+
+type staticProvider struct {
+	keySet coreosoidc.KeySet
+}
+
+func (p *staticProvider) Verifier(config *coreosoidc.Config) *coreosoidc.IDTokenVerifier {
+	config.SupportedSigningAlgs = []string{coreosoidc.ES256}
+	return coreosoidc.NewVerifier(testIssuer, p.keySet, config)
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	sign := func(key *ecdsa.PrivateKey, claims map[string]interface{}) string {
+		t.Helper()
+		signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+		require.NoError(t, err)
+		token, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+		require.NoError(t, err)
+		return token
+	}
+	validClaims := func(editFunc func(claims map[string]interface{})) map[string]interface{} {
+		claims := map[string]interface{}{
+			"iss":              testIssuer,
+			"aud":              testAudience,
+			"sub":              "repo:my-org/my-repo:ref:refs/heads/main",
+			"exp":              time.Now().Add(5 * time.Minute).Unix(),
+			"iat":              time.Now().Unix(),
+			"repository":       "my-org/my-repo",
+			"repository_owner": "my-org",
+			"ref":              "refs/heads/main",
+			"teams":            []interface{}{"team1", "", "team2"},
+		}
+		if editFunc != nil {
+			editFunc(claims)
+		}
+		return claims
+	}
+	mustCondition := func(expression string) *claimexpression.ConditionExpression {
+		t.Helper()
+		condition, err := claimexpression.NewConditionExpression(expression)
+		require.NoError(t, err)
+		return condition
+	}
+	mustUsernameExpression := func(expression string) *claimexpression.UsernameExpression {
+		t.Helper()
+		e, err := claimexpression.NewUsernameExpression(expression)
+		require.NoError(t, err)
+		return e
+	}
+	mustGroupsExpression := func(expression string) *claimexpression.GroupsExpression {
+		t.Helper()
+		e, err := claimexpression.NewGroupsExpression(expression)
+		require.NoError(t, err)
+		return e
+	}
+
+	const wantSubject = "https://token.actions.example.com?sub=repo%3Amy-org%2Fmy-repo%3Aref%3Arefs%2Fheads%2Fmain"
+
+	tests := []struct {
+		name          string
+		editProvider  func(p *ProviderConfig)
+		token         string
+		wantIdentity  *provider.WorkloadIdentity
+		wantErr       string
+		wantErrPrefix string
+	}{
+		{
+			name:  "default claims",
+			token: sign(signingKey, validClaims(nil)),
+			wantIdentity: &provider.WorkloadIdentity{
+				Username:          "repo:my-org/my-repo:ref:refs/heads/main",
+				Groups:            []string{},
+				DownstreamSubject: wantSubject,
+			},
+		},
+		{
+			name: "configured claims",
+			editProvider: func(p *ProviderConfig) {
+				p.UsernameClaim = "repository"
+				p.GroupsClaim = "teams"
+			},
+			token: sign(signingKey, validClaims(nil)),
+			wantIdentity: &provider.WorkloadIdentity{
+				Username:          "my-org/my-repo",
+				Groups:            []string{"team1", "team2"},
+				DownstreamSubject: wantSubject,
+			},
+		},
+		{
+			name: "groups claim which is a single string",
+			editProvider: func(p *ProviderConfig) {
+				p.GroupsClaim = "repository_owner"
+			},
+			token: sign(signingKey, validClaims(nil)),
+			wantIdentity: &provider.WorkloadIdentity{
+				Username:          "repo:my-org/my-repo:ref:refs/heads/main",
+				Groups:            []string{"my-org"},
+				DownstreamSubject: wantSubject,
+			},
+		},
+		{
+			name: "missing groups claim",
+			editProvider: func(p *ProviderConfig) {
+				p.GroupsClaim = "teams"
+			},
+			token: sign(signingKey, validClaims(func(claims map[string]interface{}) { delete(claims, "teams") })),
+			wantIdentity: &provider.WorkloadIdentity{
+				Username:          "repo:my-org/my-repo:ref:refs/heads/main",
+				Groups:            []string{},
+				DownstreamSubject: wantSubject,
+			},
+		},
+		{
+			name: "expressions and conditions",
+			editProvider: func(p *ProviderConfig) {
+				p.UsernameExpression = mustUsernameExpression(`"github:" + claims.repository`)
+				p.GroupsExpression = mustGroupsExpression(`["github:" + claims.repository_owner]`)
+				p.Conditions = []*claimexpression.ConditionExpression{
+					mustCondition(`claims.repository_owner == "my-org"`),
+					mustCondition(`claims.ref == "refs/heads/main"`),
+				}
+			},
+			token: sign(signingKey, validClaims(nil)),
+			wantIdentity: &provider.WorkloadIdentity{
+				Username:          "github:my-org/my-repo",
+				Groups:            []string{"github:my-org"},
+				DownstreamSubject: wantSubject,
+			},
+		},
+		{
+			name: "false condition",
+			editProvider: func(p *ProviderConfig) {
+				p.Conditions = []*claimexpression.ConditionExpression{mustCondition(`claims.ref == "refs/heads/main"`)}
+			},
+			token:   sign(signingKey, validClaims(func(claims map[string]interface{}) { claims["ref"] = "refs/heads/feature" })),
+			wantErr: `workload identity provider "my-workload-idp" rejected the token because the condition "claims.ref == \"refs/heads/main\"" is false`,
+		},
+		{
+			name: "condition which refers to a missing claim",
+			editProvider: func(p *ProviderConfig) {
+				p.Conditions = []*claimexpression.ConditionExpression{mustCondition(`claims.environment == "production"`)}
+			},
+			token:   sign(signingKey, validClaims(nil)),
+			wantErr: `workload identity provider "my-workload-idp" rejected the token because the condition "claims.environment == \"production\"" is false`,
+		},
+		{
+			name: "condition which evaluates to the wrong type",
+			editProvider: func(p *ProviderConfig) {
+				p.Conditions = []*claimexpression.ConditionExpression{mustCondition(`claims.ref`)}
+			},
+			token:   sign(signingKey, validClaims(nil)),
+			wantErr: `workload identity provider "my-workload-idp" could not evaluate the condition "claims.ref": expression must evaluate to a bool, but got string`,
+		},
+		{
+			name:    "wrong signing key",
+			token:   sign(otherKey, validClaims(nil)),
+			wantErr: `workload identity provider "my-workload-idp" could not verify the token: failed to verify signature: square/go-jose: error in cryptographic primitive`,
+		},
+		{
+			name:    "wrong audience",
+			token:   sign(signingKey, validClaims(func(claims map[string]interface{}) { claims["aud"] = "some-other-audience" })),
+			wantErr: `workload identity provider "my-workload-idp" could not verify the token: oidc: expected audience "https://supervisor.example.com/workloads" got ["some-other-audience"]`,
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(signingKey, validClaims(func(claims map[string]interface{}) { claims["iss"] = "https://other.example.com" })),
+			wantErr: `workload identity provider "my-workload-idp" could not verify the token: oidc: id token issued by a different provider, expected "https://token.actions.example.com" got "https://other.example.com"`,
+		},
+		{
+			name:          "expired",
+			token:         sign(signingKey, validClaims(func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Minute).Unix() })),
+			wantErrPrefix: `workload identity provider "my-workload-idp" could not verify the token: oidc: token is expired`,
+		},
+		{
+			name:    "missing subject",
+			token:   sign(signingKey, validClaims(func(claims map[string]interface{}) { delete(claims, "sub") })),
+			wantErr: `workload identity provider "my-workload-idp" requires the token to have a "sub" claim`,
+		},
+		{
+			name: "username claim which is not a string",
+			editProvider: func(p *ProviderConfig) {
+				p.UsernameClaim = "teams"
+			},
+			token:   sign(signingKey, validClaims(nil)),
+			wantErr: `workload identity provider "my-workload-idp" could not determine the username: the "teams" claim is missing or is not a string`,
+		},
+		{
+			name: "empty username",
+			editProvider: func(p *ProviderConfig) {
+				p.UsernameExpression = mustUsernameExpression(`""`)
+			},
+			token:   sign(signingKey, validClaims(nil)),
+			wantErr: `workload identity provider "my-workload-idp" could not determine the username: the username must not be empty`,
+		},
+		{
+			name: "groups claim with the wrong type",
+			editProvider: func(p *ProviderConfig) {
+				p.GroupsClaim = "exp"
+			},
+			token:   sign(signingKey, validClaims(nil)),
+			wantErr: `workload identity provider "my-workload-idp" could not determine the groups: the "exp" claim must be a string or a list of strings`,
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			p := &ProviderConfig{
+				Name:     "my-workload-idp",
+				Issuer:   testIssuer,
+				Audience: testAudience,
+				Provider: &staticProvider{keySet: &staticKeySet{publicKey: &signingKey.PublicKey}},
+			}
+			if test.editProvider != nil {
+				test.editProvider(p)
+			}
+			require.Equal(t, testIssuer, p.GetIssuer())
+
+			identity, err := p.AuthenticateToken(context.Background(), test.token)
+			if test.wantErrPrefix != "" {
+				require.Error(t, err)
+				require.True(t, strings.HasPrefix(err.Error(), test.wantErrPrefix), err.Error())
+				require.Nil(t, identity)
+				return
+			}
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				require.Nil(t, identity)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantIdentity, identity)
+		})
+	}
+}
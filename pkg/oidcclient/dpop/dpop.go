@@ -0,0 +1,123 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package dpop implements the client side of RFC 9449: OAuth 2.0 Demonstrating Proof of Possession (DPoP).
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+
+	"go.pinniped.dev/internal/httputil/roundtripper"
+)
+
+const (
+	// HeaderName is the name of the HTTP header which holds a DPoP proof.
+	HeaderName = "DPoP"
+
+	// SigningAlgorithm is the JWS algorithm of the proofs, which the server must support.
+	SigningAlgorithm = string(jose.ES256)
+)
+
+// Generate generates a new random DPoP key.
+func Generate() (Key, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("could not generate DPoP key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("could not encode DPoP key: %w", err)
+	}
+	return Key(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+}
+
+// Key is a PEM-encoded ECDSA P-256 private key. The tokens which the server issues to requests with proofs of
+// possession of the key can only be used by requests with proofs of possession of the same key.
+type Key string
+
+// Proof returns a new DPoP proof for an HTTP request with the method to the URL.
+func (k Key) Proof(method, url string) (string, error) {
+	privateKey, err := k.privateKey()
+	if err != nil {
+		return "", err
+	}
+
+	var jti [16]byte
+	if _, err := io.ReadFull(rand.Reader, jti[:]); err != nil {
+		return "", fmt.Errorf("could not generate DPoP proof ID: %w", err)
+	}
+
+	signer, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: privateKey},
+		(&jose.SignerOptions{EmbedJWK: true}).WithType("dpop+jwt"),
+	)
+	if err != nil {
+		return "", fmt.Errorf("could not create DPoP proof signer: %w", err)
+	}
+
+	proof, err := jwt.Signed(signer).Claims(map[string]interface{}{
+		"jti": hex.EncodeToString(jti[:]),
+		"htm": method,
+		"htu": url,
+		"iat": time.Now().Unix(),
+	}).CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("could not sign DPoP proof: %w", err)
+	}
+	return proof, nil
+}
+
+// HTTPClient returns a copy of the provided client which adds a DPoP proof to every POST to the token endpoint, so
+// the proof is also sent by the oauth2 library. All other requests are unchanged.
+func (k Key) HTTPClient(client *http.Client, tokenURL string) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	delegate := client.Transport
+	if delegate == nil {
+		delegate = http.DefaultTransport
+	}
+
+	c := *client
+	c.Transport = roundtripper.WrapFunc(delegate, func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodPost || req.URL.String() != tokenURL {
+			return delegate.RoundTrip(req)
+		}
+
+		proof, err := k.Proof(req.Method, tokenURL)
+		if err != nil {
+			return nil, err
+		}
+
+		// The original request must not be modified by a RoundTripper, so send a copy.
+		r := req.Clone(req.Context())
+		r.Header.Set(HeaderName, proof)
+		return delegate.RoundTrip(r)
+	})
+	return &c
+}
+
+func (k Key) privateKey() (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(k))
+	if block == nil {
+		return nil, errors.New("could not decode DPoP key: no PEM data found")
+	}
+	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode DPoP key: %w", err)
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,128 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filesession
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// clientCertificateLifetime is how long a generated client certificate is valid. The Supervisor does not check the
+// validity period of client certificates, so this only needs to satisfy TLS libraries.
+const clientCertificateLifetime = 100 * 365 * 24 * time.Hour
+
+// LoadOrCreateClientCertificate loads the client certificate and private key which are stored in the PEM file at
+// the path, or generates a new self-signed client certificate and stores it at the path when the file does not exist.
+// Tokens can be bound to the client certificate by presenting it to the token endpoint of the Supervisor.
+func LoadOrCreateClientCertificate(path string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(path, path)
+	if err == nil {
+		return cert, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return tls.Certificate{}, fmt.Errorf("could not load client certificate: %w", err)
+	}
+
+	certPEM, err := generateClientCertificate()
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not generate client certificate: %w", err)
+	}
+
+	if err := createFileAtomically(path, certPEM); err != nil && !errors.Is(err, os.ErrExist) {
+		return tls.Certificate{}, fmt.Errorf("could not write client certificate: %w", err)
+	}
+
+	// When another process created the file at the same time, use the certificate of the process which won the race.
+	cert, err = tls.LoadX509KeyPair(path, path)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("could not load client certificate: %w", err)
+	}
+	return cert, nil
+}
+
+func generateClientCertificate() ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: "pinniped-cli"},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(clientCertificateLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	return append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})...), nil
+}
+
+// createFileAtomically creates a file which is only readable by the current user, so other processes never see a
+// partially written file. It returns an error which wraps os.ErrExist when the file already exists.
+func createFileAtomically(path string, contents []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(contents); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return linkOrRename(os.Link, tmp.Name(), path)
+}
+
+// linkOrRename moves the file at oldpath to newpath using the link function, which unlike a rename does not replace
+// an existing file. It falls back to a rename on filesystems which do not support hard links, such as FAT and some
+// network filesystems. The rename could replace a file which another process created after it was checked, which at
+// worst causes that process to log in again.
+func linkOrRename(link func(oldpath, newpath string) error, oldpath, newpath string) error {
+	err := link(oldpath, newpath)
+	if err == nil || errors.Is(err, os.ErrExist) {
+		return err
+	}
+	if _, statErr := os.Lstat(newpath); statErr == nil {
+		return &os.LinkError{Op: "link", Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+	return os.Rename(oldpath, newpath)
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package filesession
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"go.pinniped.dev/internal/testutil"
+)
+
+func TestLoadOrCreateClientCertificate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("creates a client certificate once", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(testutil.TempDir(t), "some-dir", "session-client-certificate.pem")
+
+		cert, err := LoadOrCreateClientCertificate(path)
+		require.NoError(t, err)
+		require.Len(t, cert.Certificate, 1)
+
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		require.Equal(t, "pinniped-cli", parsed.Subject.CommonName)
+		require.Equal(t, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, parsed.ExtKeyUsage)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		// The same certificate is loaded the next time.
+		loaded, err := LoadOrCreateClientCertificate(path)
+		require.NoError(t, err)
+		require.Equal(t, cert.Certificate, loaded.Certificate)
+
+		// No temporary files are left behind.
+		entries, err := ioutil.ReadDir(filepath.Dir(path))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+	})
+
+	t.Run("invalid file", func(t *testing.T) {
+		t.Parallel()
+		path := filepath.Join(testutil.TempDir(t), "session-client-certificate.pem")
+		require.NoError(t, ioutil.WriteFile(path, []byte("invalid"), 0600))
+
+		_, err := LoadOrCreateClientCertificate(path)
+		require.EqualError(t, err, "could not load client certificate: tls: failed to find any PEM data in certificate input")
+	})
+}
+
+func TestLinkOrRename(t *testing.T) {
+	t.Parallel()
+
+	unsupportedLink := func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "link", Old: oldpath, New: newpath, Err: errors.New("operation not supported")}
+	}
+
+	t.Run("falls back to a rename when links are not supported", func(t *testing.T) {
+		t.Parallel()
+		dir := testutil.TempDir(t)
+		oldpath, newpath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+		require.NoError(t, ioutil.WriteFile(oldpath, []byte("some-contents"), 0600))
+
+		require.NoError(t, linkOrRename(unsupportedLink, oldpath, newpath))
+
+		contents, err := ioutil.ReadFile(newpath)
+		require.NoError(t, err)
+		require.Equal(t, "some-contents", string(contents))
+		require.NoFileExists(t, oldpath)
+	})
+
+	t.Run("does not replace an existing file when links are not supported", func(t *testing.T) {
+		t.Parallel()
+		dir := testutil.TempDir(t)
+		oldpath, newpath := filepath.Join(dir, "old"), filepath.Join(dir, "new")
+		require.NoError(t, ioutil.WriteFile(oldpath, []byte("some-contents"), 0600))
+		require.NoError(t, ioutil.WriteFile(newpath, []byte("existing-contents"), 0600))
+
+		err := linkOrRename(unsupportedLink, oldpath, newpath)
+		require.ErrorIs(t, err, os.ErrExist)
+
+		contents, err := ioutil.ReadFile(newpath)
+		require.NoError(t, err)
+		require.Equal(t, "existing-contents", string(contents))
+	})
+}
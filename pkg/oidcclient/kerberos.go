@@ -0,0 +1,89 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidcclient
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/credentials"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+)
+
+const (
+	kerberosConfigEnvVarName          = "KRB5_CONFIG"
+	kerberosCredentialCacheEnvVarName = "KRB5CCNAME"
+	defaultKerberosConfigPath         = "/etc/krb5.conf"
+)
+
+// kerberosNegotiateToken uses the ticket-granting ticket from the user's credential cache to get a service ticket
+// for the given service principal, and returns it as a base64-encoded SPNEGO token for an "Authorization: Negotiate"
+// header. Only file-based credential caches are supported.
+func kerberosNegotiateToken(spn string) (string, error) {
+	configPath := os.Getenv(kerberosConfigEnvVarName)
+	if configPath == "" {
+		configPath = defaultKerberosConfigPath
+	}
+	krb5Config, err := config.Load(configPath)
+	if err != nil {
+		return "", fmt.Errorf("could not load kerberos configuration from %q: %w", configPath, err)
+	}
+
+	cachePath, err := kerberosCredentialCachePath(os.Getenv(kerberosCredentialCacheEnvVarName), runtime.GOOS, os.Getuid())
+	if err != nil {
+		return "", err
+	}
+	credentialCache, err := credentials.LoadCCache(cachePath)
+	if err != nil {
+		return "", fmt.Errorf("could not load kerberos credential cache from %q: %w", cachePath, err)
+	}
+
+	krb5Client, err := client.NewFromCCache(credentialCache, krb5Config, client.DisablePAFXFAST(true))
+	if err != nil {
+		return "", fmt.Errorf("could not use kerberos credential cache: %w", err)
+	}
+	defer krb5Client.Destroy()
+
+	contextToken, err := spnego.SPNEGOClient(krb5Client, spn).InitSecContext()
+	if err != nil {
+		return "", fmt.Errorf("could not get service ticket for %q: %w", spn, err)
+	}
+	tokenBytes, err := contextToken.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("could not encode SPNEGO token: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(tokenBytes), nil
+}
+
+// kerberosCredentialCachePath returns the path of the credential cache named by the value of KRB5CCNAME, or of the
+// default credential cache when it is empty. See https://web.mit.edu/kerberos/krb5-latest/doc/basic/ccache_def.html.
+// Only FILE: credential caches are supported, because the other types of credential caches are stored by the
+// operating system and can only be read using its native Kerberos libraries.
+func kerberosCredentialCachePath(cacheName string, goos string, uid int) (string, error) {
+	if cacheName == "" {
+		if goos == "windows" {
+			return "", fmt.Errorf("%s must name a FILE: kerberos credential cache, because the Windows credential cache is not supported",
+				kerberosCredentialCacheEnvVarName)
+		}
+		return fmt.Sprintf("/tmp/krb5cc_%d", uid), nil
+	}
+
+	// A name without a type is the path of a file. On Windows, a single letter before the colon is a drive letter.
+	colon := strings.Index(cacheName, ":")
+	if colon < 0 || (goos == "windows" && colon == 1) {
+		return cacheName, nil
+	}
+	cacheType := cacheName[:colon]
+	if cacheType != "FILE" {
+		return "", fmt.Errorf("kerberos credential cache type %q of %s is not supported, only FILE: credential caches are supported "+
+			`(use "kinit -c FILE:/path/to/cache" and set %s to the same value)`,
+			cacheType, kerberosCredentialCacheEnvVarName, kerberosCredentialCacheEnvVarName)
+	}
+	return cacheName[colon+1:], nil
+}
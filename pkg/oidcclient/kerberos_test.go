@@ -0,0 +1,88 @@
+// Copyright 2022 the Pinniped contributors. All Rights Reserved.
+// SPDX-License-Identifier: Apache-2.0
+
+package oidcclient
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKerberosCredentialCachePath(t *testing.T) {
+	tests := []struct {
+		name      string
+		cacheName string
+		goos      string
+		wantPath  string
+		wantErr   string
+	}{
+		{
+			name:     "default on linux",
+			goos:     "linux",
+			wantPath: "/tmp/krb5cc_1000",
+		},
+		{
+			name:    "default on windows",
+			goos:    "windows",
+			wantErr: "KRB5CCNAME must name a FILE: kerberos credential cache, because the Windows credential cache is not supported",
+		},
+		{
+			name:      "file without a type",
+			cacheName: "/home/pinny/krb5cc",
+			goos:      "linux",
+			wantPath:  "/home/pinny/krb5cc",
+		},
+		{
+			name:      "file with a type",
+			cacheName: "FILE:/home/pinny/krb5cc",
+			goos:      "darwin",
+			wantPath:  "/home/pinny/krb5cc",
+		},
+		{
+			name:      "windows path without a type",
+			cacheName: `C:\Users\pinny\krb5cc`,
+			goos:      "windows",
+			wantPath:  `C:\Users\pinny\krb5cc`,
+		},
+		{
+			name:      "windows path with a type",
+			cacheName: `FILE:C:\Users\pinny\krb5cc`,
+			goos:      "windows",
+			wantPath:  `C:\Users\pinny\krb5cc`,
+		},
+		{
+			name:      "keyring",
+			cacheName: "KEYRING:persistent:1000",
+			goos:      "linux",
+			wantErr: `kerberos credential cache type "KEYRING" of KRB5CCNAME is not supported, only FILE: credential caches are supported ` +
+				`(use "kinit -c FILE:/path/to/cache" and set KRB5CCNAME to the same value)`,
+		},
+		{
+			name:      "kcm",
+			cacheName: "KCM:",
+			goos:      "linux",
+			wantErr: `kerberos credential cache type "KCM" of KRB5CCNAME is not supported, only FILE: credential caches are supported ` +
+				`(use "kinit -c FILE:/path/to/cache" and set KRB5CCNAME to the same value)`,
+		},
+		{
+			name:      "macOS API",
+			cacheName: "API:ABCDEF",
+			goos:      "darwin",
+			wantErr: `kerberos credential cache type "API" of KRB5CCNAME is not supported, only FILE: credential caches are supported ` +
+				`(use "kinit -c FILE:/path/to/cache" and set KRB5CCNAME to the same value)`,
+		},
+	}
+	for _, tt := range tests {
+		test := tt
+		t.Run(test.name, func(t *testing.T) {
+			path, err := kerberosCredentialCachePath(test.cacheName, test.goos, 1000)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantPath, path)
+		})
+	}
+}
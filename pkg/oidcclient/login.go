@@ -34,6 +34,7 @@ import (
 	"go.pinniped.dev/internal/net/phttp"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/upstreamoidc"
+	"go.pinniped.dev/pkg/oidcclient/dpop"
 	"go.pinniped.dev/pkg/oidcclient/nonce"
 	"go.pinniped.dev/pkg/oidcclient/oidctypes"
 	"go.pinniped.dev/pkg/oidcclient/pkce"
@@ -64,6 +65,10 @@ const (
 
 	httpLocationHeaderName = "Location"
 
+	// The RFC8693 token types of the subject tokens and of the exchanged tokens.
+	tokenTypeAccessToken = "urn:ietf:params:oauth:token-type:access_token" //nolint:gosec // this is not a credential
+	tokenTypeJWT         = "urn:ietf:params:oauth:token-type:jwt"          //nolint:gosec // this is not a credential
+
 	debugLogLevel = 4
 )
 
@@ -82,8 +87,10 @@ type handlerState struct {
 	upstreamIdentityProviderName string
 	upstreamIdentityProviderType string
 	cliToSendCredentials         bool
+	cliToSendKerberosTicket      bool
 
-	requestedAudience string
+	requestedAudience     string
+	workloadIdentityToken string
 
 	httpClient *http.Client
 
@@ -95,22 +102,26 @@ type handlerState struct {
 	provider     *oidc.Provider
 	oauth2Config *oauth2.Config
 	useFormPost  bool
+	useDPoP      bool
 	state        state.State
 	nonce        nonce.Nonce
 	pkce         pkce.Code
+	dpopKey      dpop.Key
 
 	// External calls for things.
-	generateState   func() (state.State, error)
-	generatePKCE    func() (pkce.Code, error)
-	generateNonce   func() (nonce.Nonce, error)
-	openURL         func(string) error
-	getEnv          func(key string) string
-	listen          func(string, string) (net.Listener, error)
-	isTTY           func(int) bool
-	getProvider     func(*oauth2.Config, *oidc.Provider, *http.Client) provider.UpstreamOIDCIdentityProviderI
-	validateIDToken func(ctx context.Context, provider *oidc.Provider, audience string, token string) (*oidc.IDToken, error)
-	promptForValue  func(ctx context.Context, promptLabel string) (string, error)
-	promptForSecret func(promptLabel string) (string, error)
+	generateState    func() (state.State, error)
+	generatePKCE     func() (pkce.Code, error)
+	generateNonce    func() (nonce.Nonce, error)
+	generateDPoPKey  func() (dpop.Key, error)
+	openURL          func(string) error
+	getEnv           func(key string) string
+	listen           func(string, string) (net.Listener, error)
+	isTTY            func(int) bool
+	getProvider      func(*oauth2.Config, *oidc.Provider, *http.Client) provider.UpstreamOIDCIdentityProviderI
+	validateIDToken  func(ctx context.Context, provider *oidc.Provider, audience string, token string) (*oidc.IDToken, error)
+	promptForValue   func(ctx context.Context, promptLabel string) (string, error)
+	promptForSecret  func(promptLabel string) (string, error)
+	getKerberosToken func(spn string) (string, error)
 
 	callbacks chan callbackResult
 }
@@ -231,6 +242,17 @@ func WithRequestAudience(audience string) Option {
 	}
 }
 
+// WithWorkloadIdentityToken causes the login to exchange the provided JWT for a token with the audience of
+// WithRequestAudience using the RFC8693 flow, instead of logging in a user. The JWT must have been issued to a
+// workload, e.g. a CI pipeline or a Kubernetes service account, by an issuer which is trusted by a
+// WorkloadIdentityProvider of the Pinniped Supervisor. Nothing is stored in the session cache.
+func WithWorkloadIdentityToken(token string) Option {
+	return func(h *handlerState) error {
+		h.workloadIdentityToken = token
+		return nil
+	}
+}
+
 // WithCLISendingCredentials causes the login flow to use CLI-based prompts for username and password and causes the
 // call to the Issuer's authorize endpoint to be made directly (no web browser) with the username and password on custom
 // HTTP headers. This is only intended to be used when the issuer is a Pinniped Supervisor and the upstream identity
@@ -245,6 +267,22 @@ func WithCLISendingCredentials() Option {
 	}
 }
 
+// WithCLISendingKerberosTicket causes the call to the Issuer's authorize endpoint to be made directly (no web browser)
+// with a Kerberos ticket from the user's credential cache, sent using the SPNEGO "Authorization: Negotiate" HTTP
+// authentication scheme. The ticket is requested for the service principal named "HTTP/" followed by the hostname of
+// the issuer. The credential cache and Kerberos configuration are found using the standard KRB5CCNAME and KRB5_CONFIG
+// environment variables. Only file-based credential caches are supported, so the KEYRING: and KCM: caches which are
+// the default on some Linux distributions, and the native credential caches of macOS and Windows, cannot be used.
+// Use "kinit -c FILE:/path/to/cache" and set KRB5CCNAME to the same value instead. This is only intended to be used
+// when the issuer is a Pinniped Supervisor and the upstream identity provider is an ActiveDirectoryIdentityProvider
+// which allows Kerberos logins.
+func WithCLISendingKerberosTicket() Option {
+	return func(h *handlerState) error {
+		h.cliToSendKerberosTicket = true
+		return nil
+	}
+}
+
 // WithUpstreamIdentityProvider causes the specified name and type to be sent as custom query parameters to the
 // issuer's authorize endpoint. This is only intended to be used when the issuer is a Pinniped Supervisor, in which
 // case it provides a mechanism to choose among several upstream identity providers.
@@ -278,19 +316,21 @@ func Login(issuer string, clientID string, opts ...Option) (*oidctypes.Token, er
 		httpClient:   phttp.Default(nil),
 
 		// Default implementations of external dependencies (to be mocked in tests).
-		generateState: state.Generate,
-		generateNonce: nonce.Generate,
-		generatePKCE:  pkce.Generate,
-		openURL:       browser.OpenURL,
-		getEnv:        os.Getenv,
-		listen:        net.Listen,
-		isTTY:         term.IsTerminal,
-		getProvider:   upstreamoidc.New,
+		generateState:   state.Generate,
+		generateNonce:   nonce.Generate,
+		generatePKCE:    pkce.Generate,
+		generateDPoPKey: dpop.Generate,
+		openURL:         browser.OpenURL,
+		getEnv:          os.Getenv,
+		listen:          net.Listen,
+		isTTY:           term.IsTerminal,
+		getProvider:     upstreamoidc.New,
 		validateIDToken: func(ctx context.Context, provider *oidc.Provider, audience string, token string) (*oidc.IDToken, error) {
 			return provider.Verifier(&oidc.Config{ClientID: audience}).Verify(ctx, token)
 		},
-		promptForValue:  promptForValue,
-		promptForSecret: promptForSecret,
+		promptForValue:   promptForValue,
+		promptForSecret:  promptForSecret,
+		getKerberosToken: kerberosNegotiateToken,
 	}
 	for _, opt := range opts {
 		if err := opt(&h); err != nil {
@@ -309,6 +349,18 @@ func Login(issuer string, clientID string, opts ...Option) (*oidctypes.Token, er
 	ctx = oidc.ClientContext(ctx, h.httpClient)
 	h.ctx = ctx
 
+	// A workload exchanges its JWT directly, since there is no user to log in.
+	if h.workloadIdentityToken != "" {
+		if h.requestedAudience == "" {
+			return nil, fmt.Errorf("a workload identity token can only be exchanged for a token with a requested audience")
+		}
+		exchangedToken, err := h.tokenExchangeRFC8693(h.workloadIdentityToken, tokenTypeJWT, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to exchange workload identity token: %w", err)
+		}
+		return exchangedToken, nil
+	}
+
 	// Initialize login parameters.
 	var err error
 	h.state, err = h.generateState()
@@ -336,7 +388,7 @@ func Login(issuer string, clientID string, opts ...Option) (*oidctypes.Token, er
 	}
 
 	// Perform the RFC8693 token exchange.
-	exchangedToken, err := h.tokenExchangeRFC8693(baseToken)
+	exchangedToken, err := h.tokenExchangeRFC8693(baseToken.AccessToken.Token, tokenTypeAccessToken, baseToken.DPoPKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange token: %w", err)
 	}
@@ -367,17 +419,31 @@ func (h *handlerState) baseLogin() (*oidctypes.Token, error) {
 
 	// If there was a cached refresh token, attempt to use the refresh flow instead of a fresh login.
 	if cached != nil && cached.RefreshToken != nil && cached.RefreshToken.Token != "" {
+		// The refresh must prove possession of the DPoP key to which the cached tokens are bound, if any.
+		if cached.DPoPKey != nil {
+			h.dpopKey = dpop.Key(cached.DPoPKey.Key)
+		}
 		freshToken, err := h.handleRefresh(h.ctx, cached.RefreshToken)
 		if err != nil {
 			return nil, err
 		}
 		// If we got a fresh token, we can update the cache and return it. Otherwise we fall through to the full refresh flow.
 		if freshToken != nil {
+			freshToken.DPoPKey = cached.DPoPKey
 			h.cache.PutToken(cacheKey, freshToken)
 			return freshToken, nil
 		}
 	}
 
+	// Bind the tokens of the new session to a new DPoP key, when the issuer supports it.
+	h.dpopKey = ""
+	if h.useDPoP {
+		var err error
+		if h.dpopKey, err = h.generateDPoPKey(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Prepare the common options for the authorization URL. We don't have the redirect URL yet though.
 	authorizeOptions := []oauth2.AuthCodeOption{
 		oauth2.AccessTypeOffline,
@@ -396,15 +462,18 @@ func (h *handlerState) baseLogin() (*oidctypes.Token, error) {
 
 	// Choose the appropriate authorization and authcode exchange strategy.
 	var authFunc = h.webBrowserBasedAuth
-	if h.cliToSendCredentials {
+	if h.cliToSendCredentials || h.cliToSendKerberosTicket {
 		authFunc = h.cliBasedAuth
 	}
 
 	// Perform the authorize request and authcode exchange to get back OIDC tokens.
 	token, err := authFunc(&authorizeOptions)
 
-	// If we got tokens, put them in the cache.
+	// If we got tokens, put them in the cache along with the DPoP key to which they are bound.
 	if err == nil {
+		if h.dpopKey != "" {
+			token.DPoPKey = &oidctypes.DPoPKey{Key: string(h.dpopKey)}
+		}
 		h.cache.PutToken(cacheKey, token)
 	}
 
@@ -412,10 +481,11 @@ func (h *handlerState) baseLogin() (*oidctypes.Token, error) {
 }
 
 // Make a direct call to the authorize endpoint, including the user's username and password on custom http headers,
-// and parse the authcode from the response. Exchange the authcode for tokens. Return the tokens or an error.
+// or their Kerberos ticket on the Authorization header, and parse the authcode from the response. Exchange the
+// authcode for tokens. Return the tokens or an error.
 func (h *handlerState) cliBasedAuth(authorizeOptions *[]oauth2.AuthCodeOption) (*oidctypes.Token, error) {
-	// Ask the user for their username and password, or get them from env vars.
-	username, password, err := h.getUsernameAndPassword()
+	// Get the user's credentials and prepare to add them to the authorize request.
+	setCredentialHeaders, err := h.getCredentialHeaders()
 	if err != nil {
 		return nil, err
 	}
@@ -448,8 +518,7 @@ func (h *handlerState) cliBasedAuth(authorizeOptions *[]oauth2.AuthCodeOption) (
 	if err != nil {
 		return nil, fmt.Errorf("could not build authorize request: %w", err)
 	}
-	authReq.Header.Set(supervisoroidc.AuthorizeUsernameHeaderName, username)
-	authReq.Header.Set(supervisoroidc.AuthorizePasswordHeaderName, password)
+	setCredentialHeaders(authReq.Header)
 	authRes, err := h.httpClient.Do(authReq)
 	if err != nil {
 		return nil, fmt.Errorf("authorization response error: %w", err)
@@ -494,7 +563,7 @@ func (h *handlerState) cliBasedAuth(authorizeOptions *[]oauth2.AuthCodeOption) (
 	// validations on the returned ID token.
 	tokenCtx, tokenCtxCancelFunc := context.WithTimeout(h.ctx, httpRequestTimeout)
 	defer tokenCtxCancelFunc()
-	token, err := h.getProvider(h.oauth2Config, h.provider, h.httpClient).
+	token, err := h.getProvider(h.oauth2Config, h.provider, h.tokenHTTPClient()).
 		ExchangeAuthcodeAndValidateTokens(
 			tokenCtx,
 			authCode,
@@ -509,6 +578,34 @@ func (h *handlerState) cliBasedAuth(authorizeOptions *[]oauth2.AuthCodeOption) (
 	return token, nil
 }
 
+// Get the user's Kerberos ticket, or their username and password, and return a function which adds them
+// to the headers of the authorize request.
+func (h *handlerState) getCredentialHeaders() (func(http.Header), error) {
+	if h.cliToSendKerberosTicket {
+		issuerURL, err := url.Parse(h.issuer)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse issuer URL: %w", err)
+		}
+		negotiateToken, err := h.getKerberosToken("HTTP/" + issuerURL.Hostname())
+		if err != nil {
+			return nil, fmt.Errorf("error getting kerberos ticket: %w", err)
+		}
+		return func(header http.Header) {
+			header.Set("Authorization", "Negotiate "+negotiateToken)
+		}, nil
+	}
+
+	// Ask the user for their username and password, or get them from env vars.
+	username, password, err := h.getUsernameAndPassword()
+	if err != nil {
+		return nil, err
+	}
+	return func(header http.Header) {
+		header.Set(supervisoroidc.AuthorizeUsernameHeaderName, username)
+		header.Set(supervisoroidc.AuthorizePasswordHeaderName, password)
+	}, nil
+}
+
 // Prompt for the user's username and password, or read them from env vars if they are available.
 func (h *handlerState) getUsernameAndPassword() (string, string, error) {
 	var err error
@@ -743,9 +840,27 @@ func (h *handlerState) initOIDCDiscovery() error {
 		return fmt.Errorf("could not decode response_modes_supported in OIDC discovery from %q: %w", h.issuer, err)
 	}
 	h.useFormPost = stringSliceContains(discoveryClaims.ResponseModesSupported, "form_post")
+
+	// Bind new sessions to a DPoP key if the provider supports it (see https://datatracker.ietf.org/doc/html/rfc9449#section-5.1).
+	var dpopDiscoveryClaims struct {
+		DPoPSigningAlgValuesSupported []string `json:"dpop_signing_alg_values_supported"`
+	}
+	if err := h.provider.Claims(&dpopDiscoveryClaims); err != nil {
+		return fmt.Errorf("could not decode dpop_signing_alg_values_supported in OIDC discovery from %q: %w", h.issuer, err)
+	}
+	h.useDPoP = stringSliceContains(dpopDiscoveryClaims.DPoPSigningAlgValuesSupported, dpop.SigningAlgorithm)
 	return nil
 }
 
+// tokenHTTPClient returns the HTTP client for requests to the token endpoint, which proves possession of the DPoP
+// key of the session, if any.
+func (h *handlerState) tokenHTTPClient() *http.Client {
+	if h.dpopKey == "" {
+		return h.httpClient
+	}
+	return h.dpopKey.HTTPClient(h.httpClient, h.oauth2Config.Endpoint.TokenURL)
+}
+
 func validateURLUsesHTTPS(uri string, uriName string) error {
 	parsed, err := url.Parse(uri)
 	if err != nil {
@@ -766,7 +881,7 @@ func stringSliceContains(slice []string, s string) bool {
 	return false
 }
 
-func (h *handlerState) tokenExchangeRFC8693(baseToken *oidctypes.Token) (*oidctypes.Token, error) {
+func (h *handlerState) tokenExchangeRFC8693(subjectToken string, subjectTokenType string, dpopKey *oidctypes.DPoPKey) (*oidctypes.Token, error) {
 	h.logger.V(debugLogLevel).Info("Pinniped: Performing RFC8693 token exchange", "requestedAudience", h.requestedAudience)
 	// Perform OIDC discovery. This may have already been performed if there was not a cached base token.
 	if err := h.initOIDCDiscovery(); err != nil {
@@ -778,9 +893,9 @@ func (h *handlerState) tokenExchangeRFC8693(baseToken *oidctypes.Token) (*oidcty
 		"client_id":            []string{h.clientID},
 		"grant_type":           []string{"urn:ietf:params:oauth:grant-type:token-exchange"},
 		"audience":             []string{h.requestedAudience},
-		"subject_token":        []string{baseToken.AccessToken.Token},
-		"subject_token_type":   []string{"urn:ietf:params:oauth:token-type:access_token"},
-		"requested_token_type": []string{"urn:ietf:params:oauth:token-type:jwt"},
+		"subject_token":        []string{subjectToken},
+		"subject_token_type":   []string{subjectTokenType},
+		"requested_token_type": []string{tokenTypeJWT},
 	}.Encode())
 	req, err := http.NewRequestWithContext(h.ctx, http.MethodPost, h.oauth2Config.Endpoint.TokenURL, reqBody)
 	if err != nil {
@@ -788,6 +903,15 @@ func (h *handlerState) tokenExchangeRFC8693(baseToken *oidctypes.Token) (*oidcty
 	}
 	req.Header.Set("content-type", "application/x-www-form-urlencoded")
 
+	// Prove possession of the DPoP key to which the subject token is bound, if any.
+	if dpopKey != nil {
+		proof, err := dpop.Key(dpopKey.Key).Proof(http.MethodPost, h.oauth2Config.Endpoint.TokenURL)
+		if err != nil {
+			return nil, fmt.Errorf("could not build RFC8693 request: %w", err)
+		}
+		req.Header.Set(dpop.HeaderName, proof)
+	}
+
 	// Perform the request.
 	resp, err := h.httpClient.Do(req)
 	if err != nil {
@@ -821,7 +945,7 @@ func (h *handlerState) tokenExchangeRFC8693(baseToken *oidctypes.Token) (*oidcty
 	if respBody.TokenType != "N_A" {
 		return nil, fmt.Errorf("got unexpected token_type %q", respBody.TokenType)
 	}
-	if respBody.IssuedTokenType != "urn:ietf:params:oauth:token-type:jwt" {
+	if respBody.IssuedTokenType != tokenTypeJWT {
 		return nil, fmt.Errorf("got unexpected issued_token_type %q", respBody.IssuedTokenType)
 	}
 
@@ -839,7 +963,7 @@ func (h *handlerState) tokenExchangeRFC8693(baseToken *oidctypes.Token) (*oidcty
 
 func (h *handlerState) handleRefresh(ctx context.Context, refreshToken *oidctypes.RefreshToken) (*oidctypes.Token, error) {
 	h.logger.V(debugLogLevel).Info("Pinniped: Refreshing cached token.")
-	upstreamOIDCIdentityProvider := h.getProvider(h.oauth2Config, h.provider, h.httpClient)
+	upstreamOIDCIdentityProvider := h.getProvider(h.oauth2Config, h.provider, h.tokenHTTPClient())
 
 	refreshed, err := upstreamOIDCIdentityProvider.PerformRefresh(ctx, refreshToken.Token)
 	if err != nil {
@@ -956,7 +1080,7 @@ func (h *handlerState) handleAuthCodeCallback(w http.ResponseWriter, r *http.Req
 }
 
 func (h *handlerState) redeemAuthCode(ctx context.Context, code string) (*oidctypes.Token, error) {
-	return h.getProvider(h.oauth2Config, h.provider, h.httpClient).
+	return h.getProvider(h.oauth2Config, h.provider, h.tokenHTTPClient()).
 		ExchangeAuthcodeAndValidateTokens(
 			ctx,
 			code,
@@ -6,8 +6,11 @@ package oidcclient
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -29,16 +32,19 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
+	"gopkg.in/square/go-jose.v2"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 
 	"go.pinniped.dev/internal/httputil/httperr"
 	"go.pinniped.dev/internal/httputil/roundtripper"
 	"go.pinniped.dev/internal/mocks/mockupstreamoidcidentityprovider"
+	supervisordpop "go.pinniped.dev/internal/oidc/dpop"
 	"go.pinniped.dev/internal/oidc/provider"
 	"go.pinniped.dev/internal/testutil"
 	"go.pinniped.dev/internal/testutil/testlogger"
 	"go.pinniped.dev/internal/upstreamoidc"
+	"go.pinniped.dev/pkg/oidcclient/dpop"
 	"go.pinniped.dev/pkg/oidcclient/nonce"
 	"go.pinniped.dev/pkg/oidcclient/oidctypes"
 	"go.pinniped.dev/pkg/oidcclient/pkce"
@@ -88,6 +94,21 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 		IDToken: &oidctypes.IDToken{Token: "test-id-token-with-requested-audience", Expiry: metav1.NewTime(time1.Add(3 * time.Minute))},
 	}
 
+	testDPoPKey, err := dpop.Generate()
+	require.NoError(t, err)
+	testDPoPKeyThumbprint := func() string {
+		block, _ := pem.Decode([]byte(testDPoPKey))
+		require.NotNil(t, block)
+		privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+		require.NoError(t, err)
+		thumbprint, err := (&jose.JSONWebKey{Key: &privateKey.PublicKey}).Thumbprint(crypto.SHA256)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(thumbprint)
+	}()
+
+	testTokenWithDPoPKey := testToken
+	testTokenWithDPoPKey.DPoPKey = &oidctypes.DPoPKey{Key: string(testDPoPKey)}
+
 	// Start a test server that returns 500 errors.
 	errorServer := tlsserver.TLSTestServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "some discovery error", http.StatusInternalServerError)
@@ -188,7 +209,7 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 		})
 	})
 
-	discoveryHandler := func(server *httptest.Server, responseModes []string) http.HandlerFunc {
+	discoveryHandler := func(server *httptest.Server, responseModes []string, dpopSigningAlgs []string) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			if r.Method != http.MethodGet {
 				http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
@@ -201,12 +222,14 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 				TokenURL               string   `json:"token_endpoint"`
 				JWKSURL                string   `json:"jwks_uri"`
 				ResponseModesSupported []string `json:"response_modes_supported,omitempty"`
+				DPoPSigningAlgs        []string `json:"dpop_signing_alg_values_supported,omitempty"`
 			}{
 				Issuer:                 server.URL,
 				AuthURL:                server.URL + "/authorize",
 				TokenURL:               server.URL + "/token",
 				JWKSURL:                server.URL + "/keys",
 				ResponseModesSupported: responseModes,
+				DPoPSigningAlgs:        dpopSigningAlgs,
 			})
 		}
 	}
@@ -251,6 +274,11 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 				http.Error(w, "bad client_id", http.StatusBadRequest)
 				return
 			}
+			if r.Form.Get("subject_token_type") == "urn:ietf:params:oauth:token-type:jwt" &&
+				r.Form.Get("subject_token") != "test-workload-identity-token" {
+				http.Error(w, "bad subject_token", http.StatusBadRequest)
+				return
+			}
 
 			switch r.Form.Get("audience") {
 			case "test-audience-produce-invalid-http-response":
@@ -296,15 +324,30 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 	// Start a test server that returns a real discovery document and answers refresh requests.
 	providerMux := http.NewServeMux()
 	successServer := tlsserver.TLSTestServer(t, providerMux, nil)
-	providerMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(successServer, nil))
+	providerMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(successServer, nil, nil))
 	providerMux.HandleFunc("/token", tokenHandler)
 
 	// Start a test server that returns a real discovery document and answers refresh requests, _and_ supports form_mode=post.
 	formPostProviderMux := http.NewServeMux()
 	formPostSuccessServer := tlsserver.TLSTestServer(t, formPostProviderMux, nil)
-	formPostProviderMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(formPostSuccessServer, []string{"query", "form_post"}))
+	formPostProviderMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(formPostSuccessServer, []string{"query", "form_post"}, nil))
 	formPostProviderMux.HandleFunc("/token", tokenHandler)
 
+	// Start a test server that returns a real discovery document and answers refresh requests, _and_ supports DPoP.
+	// It only answers token requests which prove possession of testDPoPKey.
+	dpopProviderMux := http.NewServeMux()
+	dpopSuccessServer := tlsserver.TLSTestServer(t, dpopProviderMux, nil)
+	dpopReplays := supervisordpop.NewReplayCache()
+	dpopProviderMux.HandleFunc("/.well-known/openid-configuration", discoveryHandler(dpopSuccessServer, nil, []string{"ES256", "RS256"}))
+	dpopProviderMux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		thumbprint, err := supervisordpop.ValidateProof(r, dpopSuccessServer.URL+"/token", time.Now(), dpopReplays)
+		if err != nil || thumbprint != testDPoPKeyThumbprint {
+			http.Error(w, "expected a proof of possession of the test DPoP key", http.StatusBadRequest)
+			return
+		}
+		tokenHandler(w, r)
+	})
+
 	defaultDiscoveryResponse := func(req *http.Request) (*http.Response, error) {
 		// Call the handler function from the test server to calculate the response.
 		handler, _ := providerMux.Handler(req)
@@ -546,6 +589,52 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 				"\"level\"=4 \"msg\"=\"Pinniped: Refreshing cached token.\""},
 			wantToken: &testToken,
 		},
+		{
+			name:     "session cache hit with refreshable token bound to a DPoP key",
+			issuer:   dpopSuccessServer.URL,
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					require.NoError(t, WithClient(newClientForServer(dpopSuccessServer))(h))
+
+					h.getProvider = func(config *oauth2.Config, provider *oidc.Provider, client *http.Client) provider.UpstreamOIDCIdentityProviderI {
+						mock := mockUpstream(t)
+						mock.EXPECT().
+							ValidateTokenAndMergeWithUserInfo(gomock.Any(), HasAccessToken(testToken.AccessToken.Token), nonce.Nonce(""), true, false).
+							DoAndReturn(func(_ context.Context, _ *oauth2.Token, _ nonce.Nonce, _ bool, _ bool) (*oidctypes.Token, error) {
+								token := testToken
+								return &token, nil
+							})
+						mock.EXPECT().
+							PerformRefresh(gomock.Any(), testToken.RefreshToken.Token).
+							DoAndReturn(func(ctx context.Context, refreshToken string) (*oauth2.Token, error) {
+								// Call the real production code to perform a refresh, which the test server only answers
+								// when the request proves possession of the DPoP key.
+								return upstreamoidc.New(config, provider, client).PerformRefresh(ctx, refreshToken)
+							})
+						return mock
+					}
+
+					cache := &mockSessionCache{t: t, getReturnsToken: &oidctypes.Token{
+						IDToken: &oidctypes.IDToken{
+							Token:  "expired-test-id-token",
+							Expiry: metav1.Now(), // less than Now() + minIDTokenValidity
+						},
+						RefreshToken: &oidctypes.RefreshToken{Token: "test-refresh-token"},
+						DPoPKey:      &oidctypes.DPoPKey{Key: string(testDPoPKey)},
+					}}
+					t.Cleanup(func() {
+						require.Len(t, cache.sawPutTokens, 1)
+						require.Equal(t, &testTokenWithDPoPKey, cache.sawPutTokens[0])
+					})
+					h.cache = cache
+					return nil
+				}
+			},
+			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + dpopSuccessServer.URL + "\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Refreshing cached token.\""},
+			wantToken: &testTokenWithDPoPKey,
+		},
 		{
 			name:     "session cache hit but refresh returns invalid token",
 			issuer:   successServer.URL,
@@ -1014,6 +1103,24 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
 			wantErr:  "error prompting for password: some prompt error",
 		},
+		{
+			name:     "active directory kerberos login when getting the kerberos ticket returns an error",
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					_ = defaultLDAPTestOpts(t, h, nil, nil)
+					require.NoError(t, WithCLISendingKerberosTicket()(h))
+					h.getKerberosToken = func(spn string) (string, error) {
+						require.Equal(t, "HTTP/127.0.0.1", spn)
+						return "", errors.New("some kerberos error")
+					}
+					return nil
+				}
+			},
+			issuer:   successServer.URL,
+			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
+			wantErr:  "error getting kerberos ticket: some kerberos error",
+		},
 		{
 			name:     "ldap login when there is a problem with parsing the authorize URL",
 			clientID: "test-client-id",
@@ -1275,6 +1382,177 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 			wantLogs:  []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
 			wantToken: &testToken,
 		},
+		{
+			name:     "successful ldap login binds the tokens to a new DPoP key",
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					fakeAuthCode := "test-authcode-value"
+
+					h.getProvider = func(config *oauth2.Config, provider *oidc.Provider, client *http.Client) provider.UpstreamOIDCIdentityProviderI {
+						mock := mockUpstream(t)
+						mock.EXPECT().
+							ExchangeAuthcodeAndValidateTokens(
+								gomock.Any(), fakeAuthCode, pkce.Code("test-pkce"), nonce.Nonce("test-nonce"), "http://127.0.0.1:0/callback").
+							DoAndReturn(func(ctx context.Context, _ string, _ pkce.Code, _ nonce.Nonce, _ string) (*oidctypes.Token, error) {
+								// The test server only answers token requests which prove possession of the DPoP key,
+								// so this checks that the client which is used for the authcode exchange sends proofs.
+								_, err := upstreamoidc.New(config, provider, client).PerformRefresh(ctx, testToken.RefreshToken.Token)
+								require.NoError(t, err)
+								token := testToken
+								return &token, nil
+							})
+						return mock
+					}
+
+					h.generateState = func() (state.State, error) { return "test-state", nil }
+					h.generatePKCE = func() (pkce.Code, error) { return "test-pkce", nil }
+					h.generateNonce = func() (nonce.Nonce, error) { return "test-nonce", nil }
+					h.generateDPoPKey = func() (dpop.Key, error) { return testDPoPKey, nil }
+					h.promptForValue = func(_ context.Context, promptLabel string) (string, error) { return "some-upstream-username", nil }
+					h.promptForSecret = func(_ string) (string, error) { return "some-upstream-password", nil }
+
+					cache := &mockSessionCache{t: t, getReturnsToken: nil}
+					t.Cleanup(func() {
+						require.Equal(t, []*oidctypes.Token{&testTokenWithDPoPKey}, cache.sawPutTokens)
+					})
+					require.NoError(t, WithSessionCache(cache)(h))
+					require.NoError(t, WithCLISendingCredentials()(h))
+
+					client := newClientForServer(dpopSuccessServer)
+					client.Transport = roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+						switch req.URL.Scheme + "://" + req.URL.Host + req.URL.Path {
+						case "https://" + dpopSuccessServer.Listener.Addr().String() + "/.well-known/openid-configuration",
+							"https://" + dpopSuccessServer.Listener.Addr().String() + "/token":
+							handler, _ := dpopProviderMux.Handler(req)
+							recorder := httptest.NewRecorder()
+							handler.ServeHTTP(recorder, req)
+							return recorder.Result(), nil
+						case "https://" + dpopSuccessServer.Listener.Addr().String() + "/authorize":
+							return &http.Response{
+								StatusCode: http.StatusFound,
+								Header: http.Header{"Location": []string{
+									fmt.Sprintf("http://127.0.0.1:0/callback?code=%s&state=test-state", fakeAuthCode),
+								}},
+							}, nil
+						default:
+							require.FailNow(t, fmt.Sprintf("saw unexpected http call from the CLI: %s", req.URL.String()))
+							return nil, nil
+						}
+					})
+					require.NoError(t, WithClient(client)(h))
+					return nil
+				}
+			},
+			issuer:    dpopSuccessServer.URL,
+			wantLogs:  []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + dpopSuccessServer.URL + "\""},
+			wantToken: &testTokenWithDPoPKey,
+		},
+		{
+			name:     "successful active directory login with a kerberos ticket",
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					fakeAuthCode := "test-authcode-value"
+
+					h.getProvider = func(_ *oauth2.Config, _ *oidc.Provider, _ *http.Client) provider.UpstreamOIDCIdentityProviderI {
+						mock := mockUpstream(t)
+						mock.EXPECT().
+							ExchangeAuthcodeAndValidateTokens(
+								gomock.Any(), fakeAuthCode, pkce.Code("test-pkce"), nonce.Nonce("test-nonce"), "http://127.0.0.1:0/callback").
+							Return(&testToken, nil)
+						return mock
+					}
+
+					h.generateState = func() (state.State, error) { return "test-state", nil }
+					h.generatePKCE = func() (pkce.Code, error) { return "test-pkce", nil }
+					h.generateNonce = func() (nonce.Nonce, error) { return "test-nonce", nil }
+					h.getEnv = func(_ string) string {
+						return "" // asking for any env var returns empty as if it were unset
+					}
+					h.promptForValue = func(_ context.Context, promptLabel string) (string, error) {
+						require.FailNow(t, fmt.Sprintf("saw unexpected prompt from the CLI: %q", promptLabel))
+						return "", nil
+					}
+					h.promptForSecret = func(promptLabel string) (string, error) {
+						require.FailNow(t, fmt.Sprintf("saw unexpected prompt from the CLI: %q", promptLabel))
+						return "", nil
+					}
+					h.getKerberosToken = func(spn string) (string, error) {
+						require.Equal(t, "HTTP/127.0.0.1", spn)
+						return "some-negotiate-token", nil
+					}
+
+					cache := &mockSessionCache{t: t, getReturnsToken: nil}
+					cacheKey := SessionCacheKey{
+						Issuer:      successServer.URL,
+						ClientID:    "test-client-id",
+						Scopes:      []string{"test-scope"},
+						RedirectURI: "http://localhost:0/callback",
+					}
+					t.Cleanup(func() {
+						require.Equal(t, []SessionCacheKey{cacheKey}, cache.sawGetKeys)
+						require.Equal(t, []SessionCacheKey{cacheKey}, cache.sawPutKeys)
+						require.Equal(t, []*oidctypes.Token{&testToken}, cache.sawPutTokens)
+					})
+					require.NoError(t, WithSessionCache(cache)(h))
+					require.NoError(t, WithCLISendingKerberosTicket()(h))
+					require.NoError(t, WithUpstreamIdentityProvider("some-upstream-name", "activedirectory")(h))
+
+					discoveryRequestWasMade := false
+					authorizeRequestWasMade := false
+					t.Cleanup(func() {
+						require.True(t, discoveryRequestWasMade, "should have made an discovery request")
+						require.True(t, authorizeRequestWasMade, "should have made an authorize request")
+					})
+
+					client := newClientForServer(successServer)
+					client.Transport = roundtripper.Func(func(req *http.Request) (*http.Response, error) {
+						switch req.URL.Scheme + "://" + req.URL.Host + req.URL.Path {
+						case "https://" + successServer.Listener.Addr().String() + "/.well-known/openid-configuration":
+							discoveryRequestWasMade = true
+							return defaultDiscoveryResponse(req)
+						case "https://" + successServer.Listener.Addr().String() + "/authorize":
+							authorizeRequestWasMade = true
+							require.Equal(t, "Negotiate some-negotiate-token", req.Header.Get("Authorization"))
+							require.Empty(t, req.Header.Get("Pinniped-Username"))
+							require.Empty(t, req.Header.Get("Pinniped-Password"))
+							require.Equal(t, url.Values{
+								// This is the PKCE challenge which is calculated as base64(sha256("test-pkce")). For example:
+								// $ echo -n test-pkce | shasum -a 256 | cut -d" " -f1 | xxd -r -p | base64 | cut -d"=" -f1
+								// VVaezYqum7reIhoavCHD1n2d+piN3r/mywoYj7fCR7g
+								"code_challenge":        []string{"VVaezYqum7reIhoavCHD1n2d-piN3r_mywoYj7fCR7g"},
+								"code_challenge_method": []string{"S256"},
+								"response_type":         []string{"code"},
+								"scope":                 []string{"test-scope"},
+								"nonce":                 []string{"test-nonce"},
+								"state":                 []string{"test-state"},
+								"access_type":           []string{"offline"},
+								"client_id":             []string{"test-client-id"},
+								"redirect_uri":          []string{"http://127.0.0.1:0/callback"},
+								"pinniped_idp_name":     []string{"some-upstream-name"},
+								"pinniped_idp_type":     []string{"activedirectory"},
+							}, req.URL.Query())
+							return &http.Response{
+								StatusCode: http.StatusFound,
+								Header: http.Header{"Location": []string{
+									fmt.Sprintf("http://127.0.0.1:0/callback?code=%s&state=test-state", fakeAuthCode),
+								}},
+							}, nil
+						default:
+							// Note that "/token" requests should not be made. They are mocked by mocking calls to ExchangeAuthcodeAndValidateTokens().
+							require.FailNow(t, fmt.Sprintf("saw unexpected http call from the CLI: %s", req.URL.String()))
+							return nil, nil
+						}
+					})
+					require.NoError(t, WithClient(client)(h))
+					return nil
+				}
+			},
+			issuer:    successServer.URL,
+			wantLogs:  []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
+			wantToken: &testToken,
+		},
 		{
 			name:     "successful ldap login with env vars for username and password",
 			clientID: "test-client-id",
@@ -1827,6 +2105,107 @@ func TestLogin(t *testing.T) { // nolint:gocyclo
 				"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
 			wantToken: &testExchangedToken,
 		},
+		{
+			name:     "with requested audience, session cache hit with valid token bound to a DPoP key, and token exchange request succeeds",
+			issuer:   dpopSuccessServer.URL,
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					cache := &mockSessionCache{t: t, getReturnsToken: &testTokenWithDPoPKey}
+					t.Cleanup(func() {
+						require.Empty(t, cache.sawPutTokens)
+					})
+					require.NoError(t, WithClient(newClientForServer(dpopSuccessServer))(h))
+					require.NoError(t, WithSessionCache(cache)(h))
+					require.NoError(t, WithRequestAudience("test-audience")(h))
+
+					h.validateIDToken = func(ctx context.Context, provider *oidc.Provider, audience string, token string) (*oidc.IDToken, error) {
+						require.Equal(t, "test-audience", audience)
+						require.Equal(t, "test-id-token-with-requested-audience", token)
+						return &oidc.IDToken{Expiry: testExchangedToken.IDToken.Expiry.Time}, nil
+					}
+					return nil
+				}
+			},
+			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Found unexpired cached token.\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Performing RFC8693 token exchange\"  \"requestedAudience\"=\"test-audience\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + dpopSuccessServer.URL + "\""},
+			wantToken: &testExchangedToken,
+		},
+		{
+			name:     "with requested audience, session cache hit with valid token which is not bound to a DPoP key, and token exchange request requires a DPoP proof",
+			issuer:   dpopSuccessServer.URL,
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					cache := &mockSessionCache{t: t, getReturnsToken: &testToken}
+					require.NoError(t, WithClient(newClientForServer(dpopSuccessServer))(h))
+					require.NoError(t, WithSessionCache(cache)(h))
+					require.NoError(t, WithRequestAudience("test-audience")(h))
+					return nil
+				}
+			},
+			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Found unexpired cached token.\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Performing RFC8693 token exchange\"  \"requestedAudience\"=\"test-audience\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + dpopSuccessServer.URL + "\""},
+			wantErr: "failed to exchange token: unexpected HTTP response status 400",
+		},
+		{
+			name:     "with workload identity token and requested audience, token exchange request succeeds",
+			issuer:   successServer.URL,
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					cache := &mockSessionCache{t: t}
+					t.Cleanup(func() {
+						require.Empty(t, cache.sawGetKeys)
+						require.Empty(t, cache.sawPutTokens)
+					})
+					require.NoError(t, WithClient(newClientForServer(successServer))(h))
+					require.NoError(t, WithSessionCache(cache)(h))
+					require.NoError(t, WithRequestAudience("test-audience")(h))
+					require.NoError(t, WithWorkloadIdentityToken("test-workload-identity-token")(h))
+
+					h.validateIDToken = func(ctx context.Context, provider *oidc.Provider, audience string, token string) (*oidc.IDToken, error) {
+						require.Equal(t, "test-audience", audience)
+						require.Equal(t, "test-id-token-with-requested-audience", token)
+						return &oidc.IDToken{Expiry: testExchangedToken.IDToken.Expiry.Time}, nil
+					}
+					return nil
+				}
+			},
+			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing RFC8693 token exchange\"  \"requestedAudience\"=\"test-audience\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
+			wantToken: &testExchangedToken,
+		},
+		{
+			name:     "with workload identity token and requested audience, but token exchange request returns non-200",
+			issuer:   successServer.URL,
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					require.NoError(t, WithClient(newClientForServer(successServer))(h))
+					require.NoError(t, WithRequestAudience("test-audience")(h))
+					require.NoError(t, WithWorkloadIdentityToken("some-untrusted-token")(h))
+					return nil
+				}
+			},
+			wantLogs: []string{"\"level\"=4 \"msg\"=\"Pinniped: Performing RFC8693 token exchange\"  \"requestedAudience\"=\"test-audience\"",
+				"\"level\"=4 \"msg\"=\"Pinniped: Performing OIDC discovery\"  \"issuer\"=\"" + successServer.URL + "\""},
+			wantErr: "failed to exchange workload identity token: unexpected HTTP response status 400",
+		},
+		{
+			name:     "with workload identity token, but without requested audience",
+			issuer:   successServer.URL,
+			clientID: "test-client-id",
+			opt: func(t *testing.T) Option {
+				return func(h *handlerState) error {
+					require.NoError(t, WithWorkloadIdentityToken("test-workload-identity-token")(h))
+					return nil
+				}
+			},
+			wantErr: "a workload identity token can only be exchanged for a token with a requested audience",
+		},
 		{
 			name:     "with requested audience, session cache hit with valid refresh token, and token exchange request succeeds",
 			issuer:   successServer.URL,
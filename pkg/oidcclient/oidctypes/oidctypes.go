@@ -1,4 +1,4 @@
-// Copyright 2020 the Pinniped contributors. All Rights Reserved.
+// Copyright 2020-2022 the Pinniped contributors. All Rights Reserved.
 // SPDX-License-Identifier: Apache-2.0
 
 // Package oidctypes provides core data types for OIDC token structures.
@@ -36,6 +36,12 @@ type IDToken struct {
 	Claims map[string]interface{} `json:"claims,omitempty"`
 }
 
+// DPoPKey is the key to which the tokens of an OIDC session are bound, as described in RFC 9449.
+type DPoPKey struct {
+	// Key is the PEM-encoded private key.
+	Key string `json:"key"`
+}
+
 // Token contains the elements of an OIDC session.
 type Token struct {
 	// AccessToken is the token that authorizes and authenticates the requests.
@@ -48,4 +54,8 @@ type Token struct {
 
 	// IDToken is an OpenID Connect ID token.
 	IDToken *IDToken `json:"id,omitempty"`
+
+	// DPoPKey is the optional key to which the other tokens are bound. Requests which use
+	// the tokens must prove possession of the key.
+	DPoPKey *DPoPKey `json:"dpopKey,omitempty"`
 }
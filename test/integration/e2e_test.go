@@ -133,7 +133,7 @@ func TestE2EFullIntegration_Browser(t *testing.T) { // nolint:gocyclo
 		// Create upstream OIDC provider and wait for it to become ready.
 		testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &idpv1alpha1.TLSSpec{
+			TLS: &idpv1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: idpv1alpha1.OIDCAuthorizationConfig{
@@ -302,7 +302,7 @@ func TestE2EFullIntegration_Browser(t *testing.T) { // nolint:gocyclo
 		// Create upstream OIDC provider and wait for it to become ready.
 		testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &idpv1alpha1.TLSSpec{
+			TLS: &idpv1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: idpv1alpha1.OIDCAuthorizationConfig{
@@ -424,7 +424,7 @@ func TestE2EFullIntegration_Browser(t *testing.T) { // nolint:gocyclo
 		// Create upstream OIDC provider and wait for it to become ready.
 		testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &idpv1alpha1.TLSSpec{
+			TLS: &idpv1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: idpv1alpha1.OIDCAuthorizationConfig{
@@ -552,7 +552,7 @@ func TestE2EFullIntegration_Browser(t *testing.T) { // nolint:gocyclo
 		// Create upstream OIDC provider and wait for it to become ready.
 		testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &idpv1alpha1.TLSSpec{
+			TLS: &idpv1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: idpv1alpha1.OIDCAuthorizationConfig{
@@ -623,7 +623,7 @@ func TestE2EFullIntegration_Browser(t *testing.T) { // nolint:gocyclo
 		// Create upstream OIDC provider and wait for it to become ready.
 		oidcIdentityProvider := testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &idpv1alpha1.TLSSpec{
+			TLS: &idpv1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: idpv1alpha1.OIDCAuthorizationConfig{
@@ -171,15 +171,15 @@ func formpostCallbackServer(t *testing.T) (string, func(*testing.T, url.Values))
 	}
 }
 
-// formpostTemplateServer runs a test server that serves formposthtml.Template() rendered with test parameters.
+// formpostTemplateServer runs a test server that serves formposthtml.Template(nil) rendered with test parameters.
 func formpostTemplateServer(t *testing.T, redirectURI string, responseParams url.Values) string {
 	t.Helper()
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fosite.WriteAuthorizeFormPostResponse(redirectURI, responseParams, formposthtml.Template(), w)
+		fosite.WriteAuthorizeFormPostResponse(redirectURI, responseParams, formposthtml.Template(nil), w)
 	})
 	server := httptest.NewServer(securityheader.WrapWithCustomCSP(
 		handler,
-		formposthtml.ContentSecurityPolicy(),
+		formposthtml.ContentSecurityPolicy(nil),
 	))
 	t.Cleanup(server.Close)
 	return server.URL
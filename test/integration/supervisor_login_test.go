@@ -71,7 +71,7 @@ func TestSupervisorLogin_Browser(t *testing.T) {
 				t.Helper()
 				oidcIDP := testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 					Issuer: env.SupervisorUpstreamOIDC.Issuer,
-					TLS: &idpv1alpha1.TLSSpec{
+					TLS: &idpv1alpha1.OIDCTLSSpec{
 						CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 					},
 					Client: idpv1alpha1.OIDCClient{
@@ -99,7 +99,7 @@ func TestSupervisorLogin_Browser(t *testing.T) {
 				t.Helper()
 				oidcIDP := testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 					Issuer: env.SupervisorUpstreamOIDC.Issuer,
-					TLS: &idpv1alpha1.TLSSpec{
+					TLS: &idpv1alpha1.OIDCTLSSpec{
 						CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 					},
 					Client: idpv1alpha1.OIDCClient{
@@ -153,7 +153,7 @@ func TestSupervisorLogin_Browser(t *testing.T) {
 				}
 				oidcIDP := testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 					Issuer: env.SupervisorUpstreamOIDC.Issuer,
-					TLS: &idpv1alpha1.TLSSpec{
+					TLS: &idpv1alpha1.OIDCTLSSpec{
 						CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 					},
 					Client: idpv1alpha1.OIDCClient{
@@ -187,7 +187,7 @@ func TestSupervisorLogin_Browser(t *testing.T) {
 				t.Helper()
 				oidcIDP := testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 					Issuer: env.SupervisorUpstreamOIDC.Issuer,
-					TLS: &idpv1alpha1.TLSSpec{
+					TLS: &idpv1alpha1.OIDCTLSSpec{
 						CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 					},
 					Client: idpv1alpha1.OIDCClient{
@@ -1550,7 +1550,7 @@ func TestSupervisorLogin_Browser(t *testing.T) {
 }
 
 func requireSuccessfulLDAPIdentityProviderConditions(t *testing.T, ldapIDP *idpv1alpha1.LDAPIdentityProvider, expectedLDAPConnectionValidMessage string) {
-	require.Len(t, ldapIDP.Status.Conditions, 3)
+	require.Len(t, ldapIDP.Status.Conditions, 4)
 
 	conditionsSummary := [][]string{}
 	for _, condition := range ldapIDP.Status.Conditions {
@@ -1564,6 +1564,8 @@ func requireSuccessfulLDAPIdentityProviderConditions(t *testing.T, ldapIDP *idpv
 			require.Equal(t, "loaded TLS configuration", condition.Message)
 		case "LDAPConnectionValid":
 			require.Equal(t, expectedLDAPConnectionValidMessage, condition.Message)
+		case "GroupSearchValid":
+			require.Equal(t, "group search configuration is valid", condition.Message)
 		}
 	}
 
@@ -1571,6 +1573,7 @@ func requireSuccessfulLDAPIdentityProviderConditions(t *testing.T, ldapIDP *idpv
 		{"BindSecretValid", "True", "Success"},
 		{"TLSConfigurationValid", "True", "Success"},
 		{"LDAPConnectionValid", "True", "Success"},
+		{"GroupSearchValid", "True", "Success"},
 	}, conditionsSummary)
 }
 func requireSuccessfulActiveDirectoryIdentityProviderConditions(t *testing.T, adIDP *idpv1alpha1.ActiveDirectoryIdentityProvider, expectedActiveDirectoryConnectionValidMessage string) {
@@ -1608,7 +1611,7 @@ func requireSuccessfulActiveDirectoryIdentityProviderConditions(t *testing.T, ad
 
 func requireEventuallySuccessfulLDAPIdentityProviderConditions(t *testing.T, requireEventually *require.Assertions, ldapIDP *idpv1alpha1.LDAPIdentityProvider, expectedLDAPConnectionValidMessage string) {
 	t.Helper()
-	requireEventually.Len(ldapIDP.Status.Conditions, 3)
+	requireEventually.Len(ldapIDP.Status.Conditions, 4)
 
 	conditionsSummary := [][]string{}
 	for _, condition := range ldapIDP.Status.Conditions {
@@ -1622,6 +1625,8 @@ func requireEventuallySuccessfulLDAPIdentityProviderConditions(t *testing.T, req
 			requireEventually.Equal("loaded TLS configuration", condition.Message)
 		case "LDAPConnectionValid":
 			requireEventually.Equal(expectedLDAPConnectionValidMessage, condition.Message)
+		case "GroupSearchValid":
+			requireEventually.Equal("group search configuration is valid", condition.Message)
 		}
 	}
 
@@ -1629,6 +1634,7 @@ func requireEventuallySuccessfulLDAPIdentityProviderConditions(t *testing.T, req
 		{"BindSecretValid", "True", "Success"},
 		{"TLSConfigurationValid", "True", "Success"},
 		{"LDAPConnectionValid", "True", "Success"},
+		{"GroupSearchValid", "True", "Success"},
 	}, conditionsSummary)
 }
 
@@ -53,7 +53,7 @@ Get "https://127.0.0.1:444444/invalid-url-that-is-really-really-long-nananananan
 		t.Parallel()
 		spec := v1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer + "/",
-			TLS: &v1alpha1.TLSSpec{
+			TLS: &v1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: v1alpha1.OIDCAuthorizationConfig{
@@ -91,7 +91,7 @@ oidc: issuer did not match the issuer returned by provider, expected "` + env.Su
 		t.Parallel()
 		spec := v1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &v1alpha1.TLSSpec{
+			TLS: &v1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: v1alpha1.OIDCAuthorizationConfig{
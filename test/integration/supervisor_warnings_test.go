@@ -384,7 +384,7 @@ func TestSupervisorWarnings_Browser(t *testing.T) {
 		// Create upstream OIDC provider and wait for it to become ready.
 		testlib.CreateTestOIDCIdentityProvider(t, idpv1alpha1.OIDCIdentityProviderSpec{
 			Issuer: env.SupervisorUpstreamOIDC.Issuer,
-			TLS: &idpv1alpha1.TLSSpec{
+			TLS: &idpv1alpha1.OIDCTLSSpec{
 				CertificateAuthorityData: base64.StdEncoding.EncodeToString([]byte(env.SupervisorUpstreamOIDC.CABundle)),
 			},
 			AuthorizationConfig: idpv1alpha1.OIDCAuthorizationConfig{